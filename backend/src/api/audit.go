@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strconv"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+// auditExportPage is the number of events read at a time by a CSV export.
+const auditExportPage = 1000
+
+type AuditHandler struct {
+	auditService service.AuditServiceInterface
+}
+
+func NewAuditHandler(
+	auditService service.AuditServiceInterface,
+) *AuditHandler {
+	p := new(AuditHandler)
+	p.auditService = auditService
+	return p
+}
+
+func (self *AuditHandler) RegisterAuditHandler(api huma.API) {
+	huma.Get(api, "/audit", self.ListAuditEvents, huma.OperationTags("samba"))
+	huma.Get(api, "/audit/export", self.ExportAuditEvents, huma.OperationTags("samba"))
+}
+
+// AuditQuery holds the filters of the audit endpoints.
+type AuditQuery struct {
+	Username  string    `query:"user" doc:"Only the operations of this user"`
+	Share     string    `query:"share" doc:"Only the operations on this share"`
+	ClientIP  string    `query:"client_ip" doc:"Only the operations from this client address"`
+	Operation string    `query:"operation" example:"unlinkat" doc:"Only this vfs_full_audit operation"`
+	From      time.Time `query:"from" doc:"Only the operations done at or after this time"`
+	To        time.Time `query:"to" doc:"Only the operations done before this time"`
+}
+
+func (q AuditQuery) filter() dto.AuditFilter {
+	return dto.AuditFilter{
+		Username:  q.Username,
+		Share:     q.Share,
+		ClientIP:  q.ClientIP,
+		Operation: q.Operation,
+		From:      q.From,
+		To:        q.To,
+	}
+}
+
+// auditError maps audit service errors to API errors.
+func auditError(err errors.E) error {
+	if errors.Is(err, dto.ErrorInvalidParameter) {
+		details := errors.AllDetails(err)
+		if reason, ok := details["reason"].(string); ok {
+			return huma.Error422UnprocessableEntity(err.Error() + ": " + reason)
+		}
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	return errors.Wrap(err, "failed to list audit events")
+}
+
+// ListAuditEvents returns the file operations logged on the audited shares,
+// newest first.
+func (self *AuditHandler) ListAuditEvents(ctx context.Context, input *struct {
+	AuditQuery
+	Limit  int `query:"limit" minimum:"0" maximum:"1000" default:"100" doc:"Maximum number of events returned"`
+	Offset int `query:"offset" minimum:"0" doc:"Number of events skipped, for paging"`
+}) (*struct{ Body []dto.AuditEvent }, error) {
+	filter := input.filter()
+	filter.Limit = input.Limit
+	filter.Offset = input.Offset
+	events, err := self.auditService.ListAuditEvents(filter)
+	if err != nil {
+		return nil, auditError(err)
+	}
+	return &struct{ Body []dto.AuditEvent }{Body: events}, nil
+}
+
+// ExportAuditEvents returns all the events matching the filters as CSV,
+// newest first.
+func (self *AuditHandler) ExportAuditEvents(ctx context.Context, input *struct {
+	AuditQuery
+}) (*struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	Body               []byte
+}, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	_ = writer.Write([]string{"time", "username", "client_ip", "share", "operation", "success", "error", "path", "target"})
+
+	filter := input.filter()
+	filter.Limit = auditExportPage
+	// Events collected during the export would shift the pages.
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+	for {
+		events, err := self.auditService.ListAuditEvents(filter)
+		if err != nil {
+			return nil, auditError(err)
+		}
+		for _, event := range events {
+			_ = writer.Write([]string{
+				event.Time.Format(time.RFC3339Nano),
+				event.Username,
+				event.ClientIP,
+				event.Share,
+				event.Operation,
+				strconv.FormatBool(event.Success),
+				event.Error,
+				event.Path,
+				event.Target,
+			})
+		}
+		if len(events) < filter.Limit {
+			break
+		}
+		filter.Offset += len(events)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &struct {
+		ContentType        string `header:"Content-Type"`
+		ContentDisposition string `header:"Content-Disposition"`
+		Body               []byte
+	}{
+		ContentType:        "text/csv; charset=utf-8",
+		ContentDisposition: `attachment; filename="audit.csv"`,
+		Body:               buffer.Bytes(),
+	}, nil
+}
@@ -0,0 +1,137 @@
+package api_test
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type AuditHandlerSuite struct {
+	suite.Suite
+	app              *fxtest.App
+	handler          *api.AuditHandler
+	mockAuditService service.AuditServiceInterface
+	ctx              context.Context
+	cancel           context.CancelFunc
+}
+
+func TestAuditHandlerSuite(t *testing.T) {
+	suite.Run(t, new(AuditHandlerSuite))
+}
+
+func (suite *AuditHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewAuditHandler,
+			mock.Mock[service.AuditServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockAuditService),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *AuditHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *AuditHandlerSuite) TestListAuditEvents() {
+	when := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	var got dto.AuditFilter
+	mock.When(suite.mockAuditService.ListAuditEvents(mock.Any[dto.AuditFilter]())).ThenAnswer(func(args []any) []any {
+		got = args[0].(dto.AuditFilter)
+		return []any{[]dto.AuditEvent{
+			{ID: 1, Time: when, Username: "alice", ClientIP: "192.168.1.10", Share: "docs", Operation: "unlinkat", Success: true, Path: "/mnt/docs/a"},
+		}, nil}
+	})
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterAuditHandler(api)
+
+	resp := api.Get("/audit?user=alice&share=docs&operation=unlinkat&from=2026-02-01T00:00:00Z&limit=10&offset=20")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+
+	var events []dto.AuditEvent
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &events))
+	suite.Require().Len(events, 1)
+	suite.Equal("/mnt/docs/a", events[0].Path)
+	suite.Equal(dto.AuditFilter{
+		Username:  "alice",
+		Share:     "docs",
+		Operation: "unlinkat",
+		From:      time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		Limit:     10,
+		Offset:    20,
+	}, got)
+}
+
+func (suite *AuditHandlerSuite) TestListAuditEventsInvalid() {
+	mock.When(suite.mockAuditService.ListAuditEvents(mock.Any[dto.AuditFilter]())).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorInvalidParameter, "reason", "offset is negative"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterAuditHandler(api)
+
+	resp := api.Get("/audit")
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+}
+
+func (suite *AuditHandlerSuite) TestExportAuditEvents() {
+	when := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	page := make([]dto.AuditEvent, 1000)
+	for i := range page {
+		page[i] = dto.AuditEvent{Time: when, Username: "alice", Share: "docs", Operation: "unlinkat", Success: true, Path: "/mnt/docs/a"}
+	}
+	mock.When(suite.mockAuditService.ListAuditEvents(mock.Any[dto.AuditFilter]())).ThenAnswer(func(args []any) []any {
+		filter := args[0].(dto.AuditFilter)
+		suite.Equal("192.168.1.10", filter.ClientIP)
+		if filter.Offset == 0 {
+			return []any{page, nil}
+		}
+		return []any{[]dto.AuditEvent{
+			{Time: when, Username: "bob", ClientIP: "192.168.1.10", Share: "docs", Operation: "renameat", Success: true,
+				Path: "/mnt/docs/a, b", Target: "/mnt/docs/c"},
+		}, nil}
+	})
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterAuditHandler(api)
+
+	resp := api.Get("/audit/export?client_ip=192.168.1.10")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	suite.True(strings.HasPrefix(resp.Header().Get("Content-Type"), "text/csv"))
+	suite.Contains(resp.Header().Get("Content-Disposition"), "audit.csv")
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	suite.Require().NoError(err)
+	suite.Require().Len(records, 1002, "header and every page")
+	suite.Equal([]string{"time", "username", "client_ip", "share", "operation", "success", "error", "path", "target"}, records[0])
+	suite.Equal([]string{"2026-02-01T10:00:00Z", "bob", "192.168.1.10", "docs", "renameat", "true", "", "/mnt/docs/a, b", "/mnt/docs/c"}, records[1001])
+}
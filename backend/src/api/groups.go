@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type GroupHandler struct {
+	groupService service.GroupServiceInterface
+}
+
+func NewGroupHandler(
+	groupService service.GroupServiceInterface,
+) *GroupHandler {
+	p := new(GroupHandler)
+	p.groupService = groupService
+	return p
+}
+
+func (self *GroupHandler) RegisterGroupHandler(api huma.API) {
+	huma.Get(api, "/groups", self.ListGroups, huma.OperationTags("user"))
+	huma.Post(api, "/group", self.CreateGroup, huma.OperationTags("user"))
+	huma.Put(api, "/group/{groupname}", self.UpdateGroup, huma.OperationTags("user"))
+	huma.Delete(api, "/group/{groupname}", self.DeleteGroup, huma.OperationTags("user"))
+}
+
+// groupError maps group service errors to the matching HTTP status.
+func groupError(err error) error {
+	switch {
+	case errors.Is(err, dto.ErrorGroupNotFound):
+		return huma.Error404NotFound(err.Error())
+	case errors.Is(err, dto.ErrorGroupAlreadyExists):
+		return huma.Error409Conflict(err.Error())
+	case errors.Is(err, dto.ErrorUserNotFound):
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	return nil
+}
+
+// ListGroups returns every Samba group with its members and the shares it is
+// bound to.
+func (handler *GroupHandler) ListGroups(ctx context.Context, input *struct{}) (*struct{ Body []dto.Group }, error) {
+	groups, err := handler.groupService.ListGroups()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list groups")
+	}
+	return &struct{ Body []dto.Group }{Body: groups}, nil
+}
+
+// CreateGroup creates a new Samba group. It returns 409 when the group already
+// exists and 422 when a member is not a known user.
+func (handler *GroupHandler) CreateGroup(ctx context.Context, input *struct {
+	Body dto.Group `required:"true"`
+}) (*struct {
+	Status int
+	Body   dto.Group
+}, error) {
+	createdGroup, err := handler.groupService.CreateGroup(input.Body)
+	if err != nil {
+		if herr := groupError(err); herr != nil {
+			return nil, herr
+		}
+		return nil, errors.Wrapf(err, "failed to create group %s", input.Body.Name)
+	}
+
+	return &struct {
+		Status int
+		Body   dto.Group
+	}{Status: 201, Body: *createdGroup}, nil
+}
+
+// UpdateGroup renames a group and/or replaces its members. Members are left
+// untouched when the body omits them.
+func (handler *GroupHandler) UpdateGroup(ctx context.Context, input *struct {
+	GroupName string    `path:"groupname" pattern:"^[a-zA-Z0-9_-]+$" maxLength:"30" example:"family" doc:"Group name"`
+	Body      dto.Group `required:"true"`
+}) (*struct{ Body dto.Group }, error) {
+	updatedGroup, err := handler.groupService.UpdateGroup(input.GroupName, input.Body)
+	if err != nil {
+		if herr := groupError(err); herr != nil {
+			return nil, herr
+		}
+		return nil, errors.Wrapf(err, "failed to update group %s", input.GroupName)
+	}
+	return &struct{ Body dto.Group }{Body: *updatedGroup}, nil
+}
+
+func (handler *GroupHandler) DeleteGroup(ctx context.Context, input *struct {
+	GroupName string `path:"groupname" pattern:"^[a-zA-Z0-9_-]+$" maxLength:"30" example:"family" doc:"Group name"`
+}) (*struct{}, error) {
+	err := handler.groupService.DeleteGroup(input.GroupName)
+	if err != nil {
+		if herr := groupError(err); herr != nil {
+			return nil, herr
+		}
+		return nil, errors.Wrapf(err, "failed to delete group %s", input.GroupName)
+	}
+	return &struct{}{}, nil
+}
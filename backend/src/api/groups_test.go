@@ -0,0 +1,128 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type GroupHandlerSuite struct {
+	suite.Suite
+	app              *fxtest.App
+	handler          *api.GroupHandler
+	mockGroupService service.GroupServiceInterface
+	ctx              context.Context
+	cancel           context.CancelFunc
+}
+
+func (suite *GroupHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewGroupHandler,
+			mock.Mock[service.GroupServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockGroupService),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *GroupHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *GroupHandlerSuite) TestListGroupsSuccess() {
+	expected := []dto.Group{
+		{Name: "family", Members: []string{"alice", "bob"}, RwShares: []string{"photos"}},
+	}
+	mock.When(suite.mockGroupService.ListGroups()).ThenReturn(expected, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterGroupHandler(api)
+
+	resp := api.Get("/groups")
+	suite.Require().Equal(http.StatusOK, resp.Code)
+
+	var result []dto.Group
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Equal(expected, result)
+}
+
+func (suite *GroupHandlerSuite) TestCreateGroupSuccess() {
+	created := &dto.Group{Name: "family", Members: []string{"alice"}}
+	mock.When(suite.mockGroupService.CreateGroup(mock.Any[dto.Group]())).ThenReturn(created, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterGroupHandler(api)
+
+	resp := api.Post("/group", dto.Group{Name: "family", Members: []string{"alice"}})
+	suite.Require().Equal(http.StatusCreated, resp.Code)
+}
+
+func (suite *GroupHandlerSuite) TestCreateGroupAlreadyExists() {
+	mock.When(suite.mockGroupService.CreateGroup(mock.Any[dto.Group]())).ThenReturn(nil, dto.ErrorGroupAlreadyExists)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterGroupHandler(api)
+
+	resp := api.Post("/group", dto.Group{Name: "family"})
+	suite.Require().Equal(http.StatusConflict, resp.Code)
+}
+
+func (suite *GroupHandlerSuite) TestCreateGroupUnknownMember() {
+	mock.When(suite.mockGroupService.CreateGroup(mock.Any[dto.Group]())).ThenReturn(nil, dto.ErrorUserNotFound)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterGroupHandler(api)
+
+	resp := api.Post("/group", dto.Group{Name: "family", Members: []string{"ghost"}})
+	suite.Require().Equal(http.StatusUnprocessableEntity, resp.Code)
+}
+
+func (suite *GroupHandlerSuite) TestUpdateGroupNotFound() {
+	mock.When(suite.mockGroupService.UpdateGroup(mock.Exact("family"), mock.Any[dto.Group]())).ThenReturn(nil, dto.ErrorGroupNotFound)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterGroupHandler(api)
+
+	resp := api.Put("/group/family", dto.Group{Name: "family"})
+	suite.Require().Equal(http.StatusNotFound, resp.Code)
+}
+
+func (suite *GroupHandlerSuite) TestDeleteGroupSuccess() {
+	mock.When(suite.mockGroupService.DeleteGroup("family")).ThenReturn(nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterGroupHandler(api)
+
+	resp := api.Delete("/group/family")
+	suite.Require().Equal(http.StatusNoContent, resp.Code)
+	mock.Verify(suite.mockGroupService, matchers.Times(1)).DeleteGroup("family")
+}
+
+func TestGroupHandlerSuite(t *testing.T) {
+	suite.Run(t, new(GroupHandlerSuite))
+}
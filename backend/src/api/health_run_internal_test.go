@@ -46,6 +46,29 @@ func (f *fakeSamba) WriteSambaConfig(ctx context.Context) errors.E
 func (f *fakeSamba) RestartSambaService(ctx context.Context) errors.E             { return nil }
 func (f *fakeSamba) TestSambaConfig(ctx context.Context) errors.E                 { return nil }
 func (f *fakeSamba) WriteConfigsAndRestartProcesses(ctx context.Context) errors.E { return nil }
+func (f *fakeSamba) ReloadConfig(ctx context.Context) errors.E                    { return nil }
+func (f *fakeSamba) ApplyClientBans(ctx context.Context) errors.E                 { return nil }
+func (f *fakeSamba) ListConfigGenerations() ([]dto.ConfigGeneration, errors.E)    { return nil, nil }
+func (f *fakeSamba) RollbackConfig(ctx context.Context, generation uint) errors.E { return nil }
+func (f *fakeSamba) PreviewConfig(ctx context.Context) (*dto.ConfigPreview, errors.E) {
+	return &dto.ConfigPreview{}, nil
+}
+
+func (f *fakeSamba) DisconnectSession(ctx context.Context, sessionID string) errors.E {
+	return nil
+}
+
+func (f *fakeSamba) DisconnectUser(ctx context.Context, username string) (int, errors.E) {
+	return 0, nil
+}
+
+func (f *fakeSamba) DisconnectClient(ctx context.Context, clientIP string) (int, errors.E) {
+	return 0, nil
+}
+
+func (f *fakeSamba) CloseOpenFile(ctx context.Context, path, openID string) (int, errors.E) {
+	return 0, nil
+}
 
 func (f *fakeSamba) SetState(state *dto.ContextState) {}
 
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type IntrusionHandler struct {
+	apictx           *dto.ContextState
+	intrusionService service.IntrusionServiceInterface
+}
+
+func NewIntrusionHandler(
+	apictx *dto.ContextState,
+	intrusionService service.IntrusionServiceInterface,
+) *IntrusionHandler {
+	p := new(IntrusionHandler)
+	p.apictx = apictx
+	p.intrusionService = intrusionService
+	return p
+}
+
+func (self *IntrusionHandler) RegisterIntrusionHandler(api huma.API) {
+	huma.Get(api, "/samba/bans", self.ListBans, huma.OperationTags("samba"))
+	huma.Post(api, "/samba/bans", self.BanClient, huma.OperationTags("samba"))
+	huma.Delete(api, "/samba/ban/{ip}", self.UnbanClient, huma.OperationTags("samba"))
+}
+
+// ListBans returns the clients refused by Samba, the latest banned first.
+func (self *IntrusionHandler) ListBans(ctx context.Context, input *struct{}) (*struct{ Body []dto.ClientBan }, error) {
+	bans, err := self.intrusionService.ListBans()
+	if err != nil {
+		return nil, err
+	}
+	return &struct{ Body []dto.ClientBan }{Body: bans}, nil
+}
+
+// BanClient refuses a client by hand, or changes the expiry of its ban.
+func (self *IntrusionHandler) BanClient(ctx context.Context, input *struct {
+	Body struct {
+		IP      string `json:"ip" example:"192.168.1.66"`
+		Minutes uint   `json:"minutes" minimum:"1" maximum:"525600" doc:"How long the client is refused"`
+		Reason  string `json:"reason,omitempty"`
+	}
+}) (*struct {
+	Status int
+	Body   dto.ClientBan
+}, error) {
+	if self.apictx.ReadOnlyMode {
+		return nil, huma.Error403Forbidden("Cannot ban clients in read-only mode")
+	}
+	ban, err := self.intrusionService.Ban(ctx, input.Body.IP, time.Duration(input.Body.Minutes)*time.Minute, input.Body.Reason)
+	if err != nil {
+		if errors.Is(err, dto.ErrorInvalidParameter) {
+			details := errors.AllDetails(err)
+			if reason, ok := details["reason"].(string); ok {
+				return nil, huma.Error422UnprocessableEntity(err.Error() + ": " + reason)
+			}
+			return nil, huma.Error422UnprocessableEntity(err.Error())
+		}
+		return nil, err
+	}
+	return &struct {
+		Status int
+		Body   dto.ClientBan
+	}{Status: http.StatusCreated, Body: *ban}, nil
+}
+
+// UnbanClient lifts the ban of a client.
+func (self *IntrusionHandler) UnbanClient(ctx context.Context, input *struct {
+	IP string `path:"ip" example:"192.168.1.66"`
+}) (*struct{ Status int }, error) {
+	if self.apictx.ReadOnlyMode {
+		return nil, huma.Error403Forbidden("Cannot unban clients in read-only mode")
+	}
+	if err := self.intrusionService.Unban(ctx, input.IP); err != nil {
+		if errors.Is(err, dto.ErrorClientBanNotFound) {
+			return nil, huma.Error404NotFound(err.Error())
+		}
+		return nil, err
+	}
+	return &struct{ Status int }{Status: http.StatusNoContent}, nil
+}
@@ -0,0 +1,112 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type IntrusionHandlerSuite struct {
+	suite.Suite
+	app                  *fxtest.App
+	handler              *api.IntrusionHandler
+	mockIntrusionService service.IntrusionServiceInterface
+	apictx               *dto.ContextState
+	ctx                  context.Context
+	cancel               context.CancelFunc
+}
+
+func TestIntrusionHandlerSuite(t *testing.T) {
+	suite.Run(t, new(IntrusionHandlerSuite))
+}
+
+func (suite *IntrusionHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			func() *dto.ContextState { return &dto.ContextState{} },
+			api.NewIntrusionHandler,
+			mock.Mock[service.IntrusionServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockIntrusionService),
+		fx.Populate(&suite.apictx),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *IntrusionHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *IntrusionHandlerSuite) TestListBans() {
+	when := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	mock.When(suite.mockIntrusionService.ListBans()).ThenReturn([]dto.ClientBan{
+		{IP: "192.168.1.66", Username: "alice", Failures: 5, BannedAt: when, ExpiresAt: when.Add(time.Hour)},
+	}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterIntrusionHandler(api)
+
+	resp := api.Get("/samba/bans")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var bans []dto.ClientBan
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &bans))
+	suite.Require().Len(bans, 1)
+	suite.Equal("192.168.1.66", bans[0].IP)
+}
+
+func (suite *IntrusionHandlerSuite) TestBanClient() {
+	mock.When(suite.mockIntrusionService.Ban(mock.AnyContext(), mock.Equal("192.168.1.66"), mock.Equal(30*time.Minute), mock.Equal("scanner"))).
+		ThenReturn(&dto.ClientBan{IP: "192.168.1.66", Reason: "scanner"}, nil)
+	mock.When(suite.mockIntrusionService.Ban(mock.AnyContext(), mock.Equal("localhost"), mock.Any[time.Duration](), mock.Any[string]())).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorInvalidParameter, "reason", "not an IP address"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterIntrusionHandler(api)
+
+	resp := api.Post("/samba/bans", map[string]any{"ip": "192.168.1.66", "minutes": 30, "reason": "scanner"})
+	suite.Require().Equal(http.StatusCreated, resp.Code, resp.Body.String())
+
+	resp = api.Post("/samba/bans", map[string]any{"ip": "localhost", "minutes": 30})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+}
+
+func (suite *IntrusionHandlerSuite) TestUnbanClient() {
+	mock.When(suite.mockIntrusionService.Unban(mock.AnyContext(), mock.Equal("192.168.1.66"))).ThenReturn(nil)
+	mock.When(suite.mockIntrusionService.Unban(mock.AnyContext(), mock.Equal("192.168.1.99"))).
+		ThenReturn(errors.WithDetails(dto.ErrorClientBanNotFound, "ip", "192.168.1.99"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterIntrusionHandler(api)
+
+	suite.Equal(http.StatusNoContent, api.Delete("/samba/ban/192.168.1.66").Code)
+	suite.Equal(http.StatusNotFound, api.Delete("/samba/ban/192.168.1.99").Code)
+
+	suite.apictx.ReadOnlyMode = true
+	suite.Equal(http.StatusForbidden, api.Delete("/samba/ban/192.168.1.66").Code)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type JobHandler struct {
+	jobService service.JobServiceInterface
+}
+
+func NewJobHandler(
+	jobService service.JobServiceInterface,
+) *JobHandler {
+	p := new(JobHandler)
+	p.jobService = jobService
+	return p
+}
+
+func (self *JobHandler) RegisterJobHandler(api huma.API) {
+	huma.Get(api, "/jobs", self.ListJobs, huma.OperationTags("system"))
+	huma.Post(api, "/job", self.CreateJob, huma.OperationTags("system"))
+	huma.Get(api, "/job/{job_id}", self.GetJob, huma.OperationTags("system"))
+	huma.Put(api, "/job/{job_id}", self.UpdateJob, huma.OperationTags("system"))
+	huma.Delete(api, "/job/{job_id}", self.DeleteJob, huma.OperationTags("system"))
+	huma.Post(api, "/job/{job_id}/run", self.RunJob, huma.OperationTags("system"))
+	huma.Get(api, "/job/{job_id}/runs", self.ListJobRuns, huma.OperationTags("system"))
+}
+
+// jobError maps job service errors to API errors.
+func jobError(err errors.E, format string, args ...any) error {
+	switch {
+	case errors.Is(err, dto.ErrorJobNotFound):
+		return huma.Error404NotFound(err.Error())
+	case errors.Is(err, dto.ErrorJobAlreadyExists), errors.Is(err, dto.ErrorJobAlreadyRunning):
+		return huma.Error409Conflict(err.Error())
+	case errors.Is(err, dto.ErrorInvalidParameter):
+		details := errors.AllDetails(err)
+		if reason, ok := details["reason"].(string); ok {
+			return huma.Error422UnprocessableEntity(err.Error() + ": " + reason)
+		}
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+func (self *JobHandler) ListJobs(ctx context.Context, input *struct{}) (*struct{ Body []dto.Job }, error) {
+	jobs, err := self.jobService.ListJobs()
+	if err != nil {
+		return nil, jobError(err, "failed to list jobs")
+	}
+	return &struct{ Body []dto.Job }{Body: jobs}, nil
+}
+
+// CreateJob stores a new scheduled job. It returns 422 when the schedule, the
+// target or the options are not valid for the job type.
+func (self *JobHandler) CreateJob(ctx context.Context, input *struct {
+	Body dto.Job `required:"true"`
+}) (*struct {
+	Status int
+	Body   dto.Job
+}, error) {
+	job, err := self.jobService.CreateJob(input.Body)
+	if err != nil {
+		return nil, jobError(err, "failed to create job %s", input.Body.Name)
+	}
+	return &struct {
+		Status int
+		Body   dto.Job
+	}{Status: http.StatusCreated, Body: *job}, nil
+}
+
+func (self *JobHandler) GetJob(ctx context.Context, input *struct {
+	JobID uint `path:"job_id" example:"1" doc:"Id of the job"`
+}) (*struct{ Body dto.Job }, error) {
+	job, err := self.jobService.GetJob(input.JobID)
+	if err != nil {
+		return nil, jobError(err, "failed to get job %d", input.JobID)
+	}
+	return &struct{ Body dto.Job }{Body: *job}, nil
+}
+
+func (self *JobHandler) UpdateJob(ctx context.Context, input *struct {
+	JobID uint    `path:"job_id" example:"1" doc:"Id of the job"`
+	Body  dto.Job `required:"true"`
+}) (*struct{ Body dto.Job }, error) {
+	job, err := self.jobService.UpdateJob(input.JobID, input.Body)
+	if err != nil {
+		return nil, jobError(err, "failed to update job %d", input.JobID)
+	}
+	return &struct{ Body dto.Job }{Body: *job}, nil
+}
+
+func (self *JobHandler) DeleteJob(ctx context.Context, input *struct {
+	JobID uint `path:"job_id" example:"1" doc:"Id of the job"`
+}) (*struct{}, error) {
+	if err := self.jobService.DeleteJob(input.JobID); err != nil {
+		return nil, jobError(err, "failed to delete job %d", input.JobID)
+	}
+	return &struct{}{}, nil
+}
+
+// RunJob starts a job immediately. The run continues in the background and
+// reports through job_run events; 409 is returned while a run is in progress.
+func (self *JobHandler) RunJob(ctx context.Context, input *struct {
+	JobID uint `path:"job_id" example:"1" doc:"Id of the job"`
+}) (*struct {
+	Status int
+	Body   dto.JobRun
+}, error) {
+	run, err := self.jobService.RunJob(input.JobID)
+	if err != nil {
+		return nil, jobError(err, "failed to run job %d", input.JobID)
+	}
+	return &struct {
+		Status int
+		Body   dto.JobRun
+	}{Status: http.StatusAccepted, Body: *run}, nil
+}
+
+// ListJobRuns returns the run history of a job, newest first.
+func (self *JobHandler) ListJobRuns(ctx context.Context, input *struct {
+	JobID uint `path:"job_id" example:"1" doc:"Id of the job"`
+}) (*struct{ Body []dto.JobRun }, error) {
+	runs, err := self.jobService.ListJobRuns(input.JobID)
+	if err != nil {
+		return nil, jobError(err, "failed to list runs of job %d", input.JobID)
+	}
+	return &struct{ Body []dto.JobRun }{Body: runs}, nil
+}
@@ -0,0 +1,116 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type JobHandlerSuite struct {
+	suite.Suite
+	app            *fxtest.App
+	handler        *api.JobHandler
+	mockJobService service.JobServiceInterface
+	ctx            context.Context
+	cancel         context.CancelFunc
+}
+
+func TestJobHandlerSuite(t *testing.T) {
+	suite.Run(t, new(JobHandlerSuite))
+}
+
+func (suite *JobHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewJobHandler,
+			mock.Mock[service.JobServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockJobService),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *JobHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *JobHandlerSuite) TestCreateJobCreated() {
+	job := dto.Job{Name: "weekly scrub", Type: dto.JobTypeScrub, Schedule: "0 3 * * 0", Target: "data", Enabled: true}
+	created := job
+	created.ID = 7
+	mock.When(suite.mockJobService.CreateJob(mock.Any[dto.Job]())).ThenReturn(&created, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterJobHandler(api)
+
+	resp := api.Post("/job", job)
+	suite.Require().Equal(http.StatusCreated, resp.Code, resp.Body.String())
+
+	var result dto.Job
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Equal(uint(7), result.ID)
+	suite.Equal(dto.JobTypeScrub, result.Type)
+}
+
+func (suite *JobHandlerSuite) TestRunJobAccepted() {
+	run := &dto.JobRun{ID: 3, JobID: 7, JobName: "weekly scrub", Trigger: dto.JobTriggerManual, Status: dto.JobRunStatusRunning}
+	mock.When(suite.mockJobService.RunJob(uint(7))).ThenReturn(run, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterJobHandler(api)
+
+	resp := api.Post("/job/7/run")
+	suite.Require().Equal(http.StatusAccepted, resp.Code)
+
+	var result dto.JobRun
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Equal(dto.JobRunStatusRunning, result.Status)
+}
+
+func (suite *JobHandlerSuite) TestJobErrors() {
+	cases := []struct {
+		id   uint
+		err  error
+		code int
+	}{
+		{1, dto.ErrorJobNotFound, http.StatusNotFound},
+		{2, dto.ErrorJobAlreadyRunning, http.StatusConflict},
+		{3, errors.WithDetails(dto.ErrorInvalidParameter, "reason", "job target is required"), http.StatusUnprocessableEntity},
+		{4, errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		mock.When(suite.mockJobService.RunJob(tc.id)).ThenReturn(nil, errors.WithStack(tc.err))
+
+		_, api := humatest.New(suite.T())
+		suite.handler.RegisterJobHandler(api)
+
+		resp := api.Post(fmt.Sprintf("/job/%d/run", tc.id))
+		suite.Equal(tc.code, resp.Code, "error %v", tc.err)
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type LuksHandler struct {
+	luksService service.LuksServiceInterface
+}
+
+func NewLuksHandler(
+	luksService service.LuksServiceInterface,
+) *LuksHandler {
+	p := new(LuksHandler)
+	p.luksService = luksService
+	return p
+}
+
+func (self *LuksHandler) RegisterLuksHandler(api huma.API) {
+	huma.Post(api, "/volume/{partition_id}/luks/unlock", self.Unlock, huma.OperationTags("volume"))
+	huma.Post(api, "/volume/{partition_id}/luks/lock", self.Lock, huma.OperationTags("volume"))
+	huma.Delete(api, "/volume/{partition_id}/luks/keyfile", self.RemoveKeyfile, huma.OperationTags("volume"))
+}
+
+// luksError maps LUKS service errors to API errors.
+func luksError(err errors.E, format string, args ...any) error {
+	message := err.Error()
+	if reason, ok := errors.AllDetails(err)["reason"].(string); ok {
+		message += ": " + reason
+	}
+	switch {
+	case errors.Is(err, dto.ErrorNotFound):
+		return huma.Error404NotFound(message)
+	case errors.Is(err, dto.ErrorOperationNotPermittedInProtectedMode):
+		return huma.Error403Forbidden(message)
+	case errors.Is(err, dto.ErrorInvalidParameter), errors.Is(err, dto.ErrorInvalidStateForOperation):
+		return huma.Error422UnprocessableEntity(message)
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+// Unlock opens the LUKS container of a partition. The opened container is
+// returned as a new partition of the same disk, mounted as any other volume.
+// It returns 422 when the passphrase does not open the container.
+func (self *LuksHandler) Unlock(ctx context.Context, input *struct {
+	PartitionID string                `path:"partition_id" required:"true" doc:"Id of the LUKS container partition"`
+	Body        dto.LuksUnlockRequest `required:"true"`
+}) (*struct{ Body dto.Partition }, error) {
+	partition, err := self.luksService.Unlock(input.PartitionID, input.Body.Passphrase, input.Body.StoreKeyfile)
+	if err != nil {
+		return nil, luksError(err, "failed to unlock %s", input.PartitionID)
+	}
+	return &struct{ Body dto.Partition }{Body: *partition}, nil
+}
+
+// Lock unmounts the volumes of an unlocked LUKS container and closes it.
+func (self *LuksHandler) Lock(ctx context.Context, input *struct {
+	PartitionID string `path:"partition_id" required:"true" doc:"Id of the LUKS container partition"`
+}) (*struct{ Status int }, error) {
+	if err := self.luksService.Lock(input.PartitionID); err != nil {
+		return nil, luksError(err, "failed to lock %s", input.PartitionID)
+	}
+	return &struct{ Status int }{Status: http.StatusNoContent}, nil
+}
+
+// RemoveKeyfile deletes the keyfile unlocking a LUKS container at startup.
+func (self *LuksHandler) RemoveKeyfile(ctx context.Context, input *struct {
+	PartitionID string `path:"partition_id" required:"true" doc:"Id of the LUKS container partition"`
+}) (*struct{ Status int }, error) {
+	if err := self.luksService.RemoveKeyfile(input.PartitionID); err != nil {
+		return nil, luksError(err, "failed to remove the keyfile of %s", input.PartitionID)
+	}
+	return &struct{ Status int }{Status: http.StatusNoContent}, nil
+}
@@ -0,0 +1,122 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type LuksHandlerSuite struct {
+	suite.Suite
+	app      *fxtest.App
+	handler  *api.LuksHandler
+	mockLuks service.LuksServiceInterface
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func TestLuksHandlerSuite(t *testing.T) {
+	suite.Run(t, new(LuksHandlerSuite))
+}
+
+func (suite *LuksHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewLuksHandler,
+			mock.Mock[service.LuksServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockLuks),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *LuksHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *LuksHandlerSuite) TestUnlock() {
+	mock.When(suite.mockLuks.Unlock(mock.Exact("sdb1"), mock.Exact("secret"), mock.Exact(true))).ThenReturn(&dto.Partition{
+		Id:         new("luks-1234"),
+		DevicePath: new("/dev/mapper/luks-1234"),
+		ParentId:   new("sdb1"),
+	}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLuksHandler(api)
+
+	resp := api.Post("/volume/sdb1/luks/unlock", map[string]any{"passphrase": "secret", "store_keyfile": true})
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var partition dto.Partition
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &partition))
+	suite.Equal("luks-1234", *partition.Id)
+	suite.Equal("sdb1", *partition.ParentId)
+}
+
+func (suite *LuksHandlerSuite) TestUnlockWrongPassphrase() {
+	mock.When(suite.mockLuks.Unlock(mock.Any[string](), mock.Any[string](), mock.Any[bool]())).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorInvalidParameter, "reason", "no key is available with this passphrase"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLuksHandler(api)
+
+	resp := api.Post("/volume/sdb1/luks/unlock", map[string]any{"passphrase": "wrong"})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+	suite.Contains(resp.Body.String(), "no key is available with this passphrase")
+}
+
+func (suite *LuksHandlerSuite) TestUnlockRequiresPassphrase() {
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLuksHandler(api)
+
+	resp := api.Post("/volume/sdb1/luks/unlock", map[string]any{"passphrase": ""})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+	mock.Verify(suite.mockLuks, matchers.Times(0)).Unlock(mock.Any[string](), mock.Any[string](), mock.Any[bool]())
+}
+
+func (suite *LuksHandlerSuite) TestLock() {
+	mock.When(suite.mockLuks.Lock(mock.Exact("sdb1"))).ThenReturn(nil)
+	mock.When(suite.mockLuks.Lock(mock.Exact("missing"))).ThenReturn(errors.WithDetails(dto.ErrorNotFound, "reason", "partition not found"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLuksHandler(api)
+
+	resp := api.Post("/volume/sdb1/luks/lock")
+	suite.Equal(http.StatusNoContent, resp.Code, resp.Body.String())
+	resp = api.Post("/volume/missing/luks/lock")
+	suite.Equal(http.StatusNotFound, resp.Code)
+}
+
+func (suite *LuksHandlerSuite) TestRemoveKeyfile() {
+	mock.When(suite.mockLuks.RemoveKeyfile(mock.Exact("sdb1"))).ThenReturn(nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLuksHandler(api)
+
+	resp := api.Delete("/volume/sdb1/luks/keyfile")
+	suite.Equal(http.StatusNoContent, resp.Code, resp.Body.String())
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type LvmHandler struct {
+	lvmService service.LvmServiceInterface
+}
+
+func NewLvmHandler(
+	lvmService service.LvmServiceInterface,
+) *LvmHandler {
+	p := new(LvmHandler)
+	p.lvmService = lvmService
+	return p
+}
+
+func (self *LvmHandler) RegisterLvmHandler(api huma.API) {
+	huma.Get(api, "/lvm", self.Report, huma.OperationTags("lvm"))
+	huma.Post(api, "/lvm/{vg_name}/activate", self.ActivateVolumeGroup, huma.OperationTags("lvm"))
+	huma.Post(api, "/lvm/{vg_name}/lv", self.CreateLogicalVolume, huma.OperationTags("lvm"))
+	huma.Post(api, "/lvm/{vg_name}/lv/{lv_name}/extend", self.ExtendLogicalVolume, huma.OperationTags("lvm"))
+	huma.Post(api, "/lvm/{vg_name}/lv/{lv_name}/snapshot", self.SnapshotLogicalVolume, huma.OperationTags("lvm"))
+}
+
+// lvmError maps LVM service errors to API errors.
+func lvmError(err errors.E, format string, args ...any) error {
+	message := err.Error()
+	if reason, ok := errors.AllDetails(err)["reason"].(string); ok {
+		message += ": " + reason
+	}
+	switch {
+	case errors.Is(err, dto.ErrorNotFound):
+		return huma.Error404NotFound(message)
+	case errors.Is(err, dto.ErrorOperationNotPermittedInProtectedMode):
+		return huma.Error403Forbidden(message)
+	case errors.Is(err, dto.ErrorInvalidParameter), errors.Is(err, dto.ErrorInvalidStateForOperation):
+		return huma.Error422UnprocessableEntity(message)
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+// Report lists the LVM physical volumes, volume groups and logical volumes.
+func (self *LvmHandler) Report(ctx context.Context, input *struct{}) (*struct{ Body dto.LvmReport }, error) {
+	report, err := self.lvmService.Report()
+	if err != nil {
+		return nil, lvmError(err, "failed to read the LVM volumes")
+	}
+	return &struct{ Body dto.LvmReport }{Body: *report}, nil
+}
+
+// ActivateVolumeGroup activates the logical volumes of a volume group, which
+// then become mountable.
+func (self *LvmHandler) ActivateVolumeGroup(ctx context.Context, input *struct {
+	VgName string `path:"vg_name" required:"true" doc:"Name of the volume group"`
+}) (*struct{ Body dto.LvmReport }, error) {
+	report, err := self.lvmService.ActivateVolumeGroup(input.VgName)
+	if err != nil {
+		return nil, lvmError(err, "failed to activate %s", input.VgName)
+	}
+	return &struct{ Body dto.LvmReport }{Body: *report}, nil
+}
+
+// CreateLogicalVolume allocates a logical volume, shown as a new partition of
+// the volume group disk.
+func (self *LvmHandler) CreateLogicalVolume(ctx context.Context, input *struct {
+	VgName string               `path:"vg_name" required:"true" doc:"Name of the volume group"`
+	Body   dto.LvmCreateRequest `required:"true"`
+}) (*struct{ Body dto.LvmLogicalVolume }, error) {
+	lv, err := self.lvmService.CreateLogicalVolume(input.VgName, input.Body)
+	if err != nil {
+		return nil, lvmError(err, "failed to create %s/%s", input.VgName, input.Body.Name)
+	}
+	return &struct{ Body dto.LvmLogicalVolume }{Body: *lv}, nil
+}
+
+// ExtendLogicalVolume grows a logical volume. It returns 422 when the volume
+// group has not enough free space.
+func (self *LvmHandler) ExtendLogicalVolume(ctx context.Context, input *struct {
+	VgName string               `path:"vg_name" required:"true" doc:"Name of the volume group"`
+	LvName string               `path:"lv_name" required:"true" doc:"Name of the logical volume"`
+	Body   dto.LvmExtendRequest `required:"true"`
+}) (*struct{ Body dto.LvmLogicalVolume }, error) {
+	lv, err := self.lvmService.ExtendLogicalVolume(input.VgName, input.LvName, input.Body)
+	if err != nil {
+		return nil, lvmError(err, "failed to extend %s/%s", input.VgName, input.LvName)
+	}
+	return &struct{ Body dto.LvmLogicalVolume }{Body: *lv}, nil
+}
+
+// SnapshotLogicalVolume takes a snapshot of a logical volume, shown as a new
+// partition of the volume group disk.
+func (self *LvmHandler) SnapshotLogicalVolume(ctx context.Context, input *struct {
+	VgName string                 `path:"vg_name" required:"true" doc:"Name of the volume group"`
+	LvName string                 `path:"lv_name" required:"true" doc:"Name of the logical volume"`
+	Body   dto.LvmSnapshotRequest `required:"true"`
+}) (*struct{ Body dto.LvmLogicalVolume }, error) {
+	lv, err := self.lvmService.SnapshotLogicalVolume(input.VgName, input.LvName, input.Body)
+	if err != nil {
+		return nil, lvmError(err, "failed to snapshot %s/%s", input.VgName, input.LvName)
+	}
+	return &struct{ Body dto.LvmLogicalVolume }{Body: *lv}, nil
+}
@@ -0,0 +1,142 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type LvmHandlerSuite struct {
+	suite.Suite
+	app     *fxtest.App
+	handler *api.LvmHandler
+	mockLvm service.LvmServiceInterface
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func TestLvmHandlerSuite(t *testing.T) {
+	suite.Run(t, new(LvmHandlerSuite))
+}
+
+func (suite *LvmHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewLvmHandler,
+			mock.Mock[service.LvmServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockLvm),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *LvmHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *LvmHandlerSuite) TestReport() {
+	mock.When(suite.mockLvm.Report()).ThenReturn(&dto.LvmReport{
+		PhysicalVolumes: []dto.LvmPhysicalVolume{{Device: "/dev/sdb1", VgName: "vg0"}},
+		VolumeGroups:    []dto.LvmVolumeGroup{{Name: "vg0", LvCount: 1}},
+		LogicalVolumes:  []dto.LvmLogicalVolume{{Name: "data", VgName: "vg0", Active: true}},
+	}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLvmHandler(api)
+
+	resp := api.Get("/lvm")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var report dto.LvmReport
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &report))
+	suite.Require().Len(report.LogicalVolumes, 1)
+	suite.Equal("data", report.LogicalVolumes[0].Name)
+	suite.Equal("/dev/sdb1", report.PhysicalVolumes[0].Device)
+}
+
+func (suite *LvmHandlerSuite) TestCreateLogicalVolume() {
+	mock.When(suite.mockLvm.CreateLogicalVolume(mock.Exact("vg0"), mock.Equal(dto.LvmCreateRequest{Name: "media", Size: 1073741824}))).
+		ThenReturn(&dto.LvmLogicalVolume{Name: "media", VgName: "vg0", Size: 1073741824}, nil)
+	mock.When(suite.mockLvm.CreateLogicalVolume(mock.Exact("vg9"), mock.Any[dto.LvmCreateRequest]())).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorNotFound, "reason", "volume group not found"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLvmHandler(api)
+
+	resp := api.Post("/lvm/vg0/lv", map[string]any{"name": "media", "size": 1073741824})
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	resp = api.Post("/lvm/vg9/lv", map[string]any{"name": "media"})
+	suite.Equal(http.StatusNotFound, resp.Code)
+	resp = api.Post("/lvm/vg0/lv", map[string]any{"name": "-bad"})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+}
+
+func (suite *LvmHandlerSuite) TestExtendLogicalVolume() {
+	mock.When(suite.mockLvm.ExtendLogicalVolume(mock.Exact("vg0"), mock.Exact("data"), mock.Equal(dto.LvmExtendRequest{ResizeFs: true}))).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "reason", "Insufficient free space"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLvmHandler(api)
+
+	resp := api.Post("/lvm/vg0/lv/data/extend", map[string]any{"resize_fs": true})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+	suite.Contains(resp.Body.String(), "Insufficient free space")
+}
+
+func (suite *LvmHandlerSuite) TestSnapshotLogicalVolume() {
+	mock.When(suite.mockLvm.SnapshotLogicalVolume(mock.Exact("vg0"), mock.Exact("data"), mock.Equal(dto.LvmSnapshotRequest{Name: "data-snap", Size: 100000000}))).
+		ThenReturn(&dto.LvmLogicalVolume{Name: "data-snap", VgName: "vg0", Origin: new("data")}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLvmHandler(api)
+
+	resp := api.Post("/lvm/vg0/lv/data/snapshot", map[string]any{"name": "data-snap", "size": 100000000})
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var lv dto.LvmLogicalVolume
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &lv))
+	suite.Equal("data", *lv.Origin)
+}
+
+func (suite *LvmHandlerSuite) TestActivateVolumeGroup() {
+	mock.When(suite.mockLvm.ActivateVolumeGroup(mock.Exact("vg0"))).ThenReturn(&dto.LvmReport{
+		LogicalVolumes: []dto.LvmLogicalVolume{{Name: "data", VgName: "vg0", Active: true}},
+	}, nil)
+	mock.When(suite.mockLvm.ActivateVolumeGroup(mock.Exact("vg9"))).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorNotFound, "reason", "volume group not found"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterLvmHandler(api)
+
+	resp := api.Post("/lvm/vg0/activate")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var report dto.LvmReport
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &report))
+	suite.True(report.LogicalVolumes[0].Active)
+
+	resp = api.Post("/lvm/vg9/activate")
+	suite.Equal(http.StatusNotFound, resp.Code)
+}
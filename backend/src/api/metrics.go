@@ -0,0 +1,45 @@
+package api
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/internal/openmetrics"
+	"github.com/dianlight/srat/service"
+)
+
+type MetricsHandler struct {
+	metricsService service.MetricsServiceInterface
+}
+
+func NewMetricsHandler(
+	metricsService service.MetricsServiceInterface,
+) *MetricsHandler {
+	p := new(MetricsHandler)
+	p.metricsService = metricsService
+	return p
+}
+
+func (self *MetricsHandler) RegisterMetricsHandler(api huma.API) {
+	huma.Get(api, "/metrics", self.GetMetrics, huma.OperationTags("system"))
+}
+
+// GetMetrics returns the disk, network, SMART, HDIdle, Samba, mount and
+// problem metrics in the OpenMetrics text format, for Prometheus to scrape.
+func (self *MetricsHandler) GetMetrics(ctx context.Context, input *struct{}) (*struct {
+	ContentType string `header:"Content-Type"`
+	Body        []byte
+}, error) {
+	var buffer bytes.Buffer
+	if err := self.metricsService.WriteMetrics(ctx, &buffer); err != nil {
+		return nil, err
+	}
+	return &struct {
+		ContentType string `header:"Content-Type"`
+		Body        []byte
+	}{
+		ContentType: openmetrics.ContentType,
+		Body:        buffer.Bytes(),
+	}, nil
+}
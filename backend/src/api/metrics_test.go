@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/internal/openmetrics"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type MetricsHandlerSuite struct {
+	suite.Suite
+	app                *fxtest.App
+	handler            *api.MetricsHandler
+	mockMetricsService service.MetricsServiceInterface
+	ctx                context.Context
+	cancel             context.CancelFunc
+}
+
+func TestMetricsHandlerSuite(t *testing.T) {
+	suite.Run(t, new(MetricsHandlerSuite))
+}
+
+func (suite *MetricsHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewMetricsHandler,
+			mock.Mock[service.MetricsServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockMetricsService),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *MetricsHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *MetricsHandlerSuite) TestGetMetrics() {
+	mock.When(suite.mockMetricsService.WriteMetrics(mock.AnyContext(), mock.Any[io.Writer]())).ThenAnswer(func(args []any) []any {
+		_, _ = io.WriteString(args[1].(io.Writer), "srat_hdidle_running 1\n# EOF\n")
+		return []any{nil}
+	})
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterMetricsHandler(api)
+
+	resp := api.Get("/metrics")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	suite.Equal(openmetrics.ContentType, resp.Header().Get("Content-Type"))
+	suite.Equal("srat_hdidle_running 1\n# EOF\n", resp.Body.String())
+}
+
+func (suite *MetricsHandlerSuite) TestGetMetricsError() {
+	mock.When(suite.mockMetricsService.WriteMetrics(mock.AnyContext(), mock.Any[io.Writer]())).
+		ThenReturn(errors.New("write failed"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterMetricsHandler(api)
+
+	resp := api.Get("/metrics")
+	suite.Equal(http.StatusInternalServerError, resp.Code)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+)
+
+type MQTTHandler struct {
+	mqttService service.MQTTServiceInterface
+}
+
+func NewMQTTHandler(
+	mqttService service.MQTTServiceInterface,
+) *MQTTHandler {
+	p := new(MQTTHandler)
+	p.mqttService = mqttService
+	return p
+}
+
+func (self *MQTTHandler) RegisterMQTTHandler(api huma.API) {
+	huma.Get(api, "/mqtt/status", self.GetStatus, huma.OperationTags("system"))
+}
+
+// GetStatus returns the state of the connection to the MQTT broker the
+// entities are published to.
+func (self *MQTTHandler) GetStatus(ctx context.Context, input *struct{}) (*struct{ Body dto.MQTTStatus }, error) {
+	return &struct{ Body dto.MQTTStatus }{Body: self.mqttService.Status()}, nil
+}
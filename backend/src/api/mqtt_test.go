@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type MQTTHandlerSuite struct {
+	suite.Suite
+	app             *fxtest.App
+	handler         *api.MQTTHandler
+	mockMQTTService service.MQTTServiceInterface
+	ctx             context.Context
+	cancel          context.CancelFunc
+}
+
+func TestMQTTHandlerSuite(t *testing.T) {
+	suite.Run(t, new(MQTTHandlerSuite))
+}
+
+func (suite *MQTTHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewMQTTHandler,
+			mock.Mock[service.MQTTServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockMQTTService),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *MQTTHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *MQTTHandlerSuite) TestGetStatus() {
+	mock.When(suite.mockMQTTService.Status()).ThenReturn(dto.MQTTStatus{
+		Enabled:   true,
+		Connected: true,
+		Broker:    "core-mosquitto:1883",
+		Entities:  12,
+	})
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterMQTTHandler(api)
+
+	resp := api.Get("/mqtt/status")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var status dto.MQTTStatus
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &status))
+	suite.True(status.Connected)
+	suite.Equal("core-mosquitto:1883", status.Broker)
+	suite.Equal(12, status.Entities)
+}
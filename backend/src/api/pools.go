@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type PoolHandler struct {
+	poolService service.PoolServiceInterface
+}
+
+func NewPoolHandler(
+	poolService service.PoolServiceInterface,
+) *PoolHandler {
+	p := new(PoolHandler)
+	p.poolService = poolService
+	return p
+}
+
+func (self *PoolHandler) RegisterPoolHandler(api huma.API) {
+	huma.Get(api, "/pools", self.ListPools, huma.OperationTags("volume"))
+	huma.Post(api, "/pool", self.CreatePool, huma.OperationTags("volume"))
+	huma.Post(api, "/pool/{pool_name}/mount", self.MountPool, huma.OperationTags("volume"))
+	huma.Delete(api, "/pool/{pool_name}", self.DeletePool, huma.OperationTags("volume"))
+}
+
+// poolError maps pool service errors to API errors.
+func poolError(err errors.E, format string, args ...any) error {
+	message := err.Error()
+	if reason, ok := errors.AllDetails(err)["reason"].(string); ok {
+		message += ": " + reason
+	}
+	switch {
+	case errors.Is(err, dto.ErrorNotFound):
+		return huma.Error404NotFound(message)
+	case errors.Is(err, dto.ErrorOperationNotPermittedInProtectedMode):
+		return huma.Error403Forbidden(message)
+	case errors.Is(err, dto.ErrorConflict):
+		return huma.Error409Conflict(message)
+	case errors.Is(err, dto.ErrorInvalidParameter), errors.Is(err, dto.ErrorInvalidStateForOperation),
+		errors.Is(err, dto.ErrorMountFail), errors.Is(err, dto.ErrorUnmountFail):
+		return huma.Error422UnprocessableEntity(message)
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+// ListPools lists the storage pools with the aggregate space of their members.
+func (self *PoolHandler) ListPools(ctx context.Context, input *struct{}) (*struct{ Body []dto.StoragePool }, error) {
+	pools, err := self.poolService.ListPools()
+	if err != nil {
+		return nil, poolError(err, "failed to list the storage pools")
+	}
+	return &struct{ Body []dto.StoragePool }{Body: pools}, nil
+}
+
+// CreatePool pools mounted volumes together and mounts the pool on
+// /mnt/<name>, where shares can then be created.
+func (self *PoolHandler) CreatePool(ctx context.Context, input *struct {
+	Body dto.StoragePoolCreateRequest `required:"true"`
+}) (*struct{ Body dto.StoragePool }, error) {
+	pool, err := self.poolService.CreatePool(input.Body)
+	if err != nil {
+		return nil, poolError(err, "failed to create pool %s", input.Body.Name)
+	}
+	return &struct{ Body dto.StoragePool }{Body: *pool}, nil
+}
+
+// MountPool mounts a pool again, e.g. after it was unmounted from the volumes.
+func (self *PoolHandler) MountPool(ctx context.Context, input *struct {
+	PoolName string `path:"pool_name" required:"true" doc:"Name of the pool"`
+}) (*struct{ Body dto.StoragePool }, error) {
+	pool, err := self.poolService.MountPool(input.PoolName)
+	if err != nil {
+		return nil, poolError(err, "failed to mount pool %s", input.PoolName)
+	}
+	return &struct{ Body dto.StoragePool }{Body: *pool}, nil
+}
+
+// DeletePool unmounts and forgets a pool. It returns 422 while shares use it.
+func (self *PoolHandler) DeletePool(ctx context.Context, input *struct {
+	PoolName string `path:"pool_name" required:"true" doc:"Name of the pool"`
+}) (*struct{}, error) {
+	if err := self.poolService.DeletePool(input.PoolName); err != nil {
+		return nil, poolError(err, "failed to delete pool %s", input.PoolName)
+	}
+	return &struct{}{}, nil
+}
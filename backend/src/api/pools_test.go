@@ -0,0 +1,148 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type PoolHandlerSuite struct {
+	suite.Suite
+	app      *fxtest.App
+	handler  *api.PoolHandler
+	mockPool service.PoolServiceInterface
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func TestPoolHandlerSuite(t *testing.T) {
+	suite.Run(t, new(PoolHandlerSuite))
+}
+
+func (suite *PoolHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewPoolHandler,
+			mock.Mock[service.PoolServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockPool),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *PoolHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *PoolHandlerSuite) TestListPools() {
+	mock.When(suite.mockPool.ListPools()).ThenReturn([]dto.StoragePool{{
+		Name:         "media",
+		Path:         "/mnt/media",
+		CreatePolicy: "mfs",
+		Members:      []string{"/mnt/usb1", "/mnt/usb2"},
+		IsMounted:    true,
+		Size:         3000,
+		Free:         1000,
+	}}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterPoolHandler(api)
+
+	resp := api.Get("/pools")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var pools []dto.StoragePool
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &pools))
+	suite.Require().Len(pools, 1)
+	suite.Equal("media", pools[0].Name)
+	suite.Equal(uint64(1000), pools[0].Free)
+}
+
+func (suite *PoolHandlerSuite) TestCreatePool() {
+	request := dto.StoragePoolCreateRequest{Name: "media", Members: []string{"/mnt/usb1", "/mnt/usb2"}, CreatePolicy: "mfs"}
+	mock.When(suite.mockPool.CreatePool(mock.Equal(request))).
+		ThenReturn(&dto.StoragePool{Name: "media", Path: "/mnt/media", CreatePolicy: "mfs", IsMounted: true}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterPoolHandler(api)
+
+	resp := api.Post("/pool", map[string]any{"name": "media", "members": []string{"/mnt/usb1", "/mnt/usb2"}, "create_policy": "mfs"})
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var pool dto.StoragePool
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &pool))
+	suite.Equal("/mnt/media", pool.Path)
+	suite.True(pool.IsMounted)
+
+	resp = api.Post("/pool", map[string]any{"name": "media", "members": []string{"/mnt/usb1", "/mnt/usb2"}, "create_policy": "rand"})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+
+	resp = api.Post("/pool", map[string]any{"name": "media", "members": []string{"/mnt/usb1"}})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+}
+
+func (suite *PoolHandlerSuite) TestCreatePoolConflict() {
+	mock.When(suite.mockPool.CreatePool(mock.Any[dto.StoragePoolCreateRequest]())).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorConflict, "reason", "a pool with this name already exists"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterPoolHandler(api)
+
+	resp := api.Post("/pool", map[string]any{"name": "media", "members": []string{"/mnt/usb1", "/mnt/usb2"}})
+	suite.Equal(http.StatusConflict, resp.Code, resp.Body.String())
+	suite.Contains(resp.Body.String(), "already exists")
+}
+
+func (suite *PoolHandlerSuite) TestDeletePool() {
+	mock.When(suite.mockPool.DeletePool(mock.Exact("media"))).ThenReturn(nil)
+	mock.When(suite.mockPool.DeletePool(mock.Exact("shared"))).
+		ThenReturn(errors.WithDetails(dto.ErrorInvalidStateForOperation, "reason", "the pool is shared as Media"))
+	mock.When(suite.mockPool.DeletePool(mock.Exact("missing"))).
+		ThenReturn(errors.WithDetails(dto.ErrorNotFound, "reason", "no pool is named missing"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterPoolHandler(api)
+
+	resp := api.Delete("/pool/media")
+	suite.Equal(http.StatusNoContent, resp.Code, resp.Body.String())
+	resp = api.Delete("/pool/shared")
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+	suite.Contains(resp.Body.String(), "shared as Media")
+	resp = api.Delete("/pool/missing")
+	suite.Equal(http.StatusNotFound, resp.Code, resp.Body.String())
+}
+
+func (suite *PoolHandlerSuite) TestMountPool() {
+	mock.When(suite.mockPool.MountPool(mock.Exact("media"))).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "reason", "the member /mnt/usb2 is not mounted"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterPoolHandler(api)
+
+	resp := api.Post("/pool/media/mount")
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+	suite.Contains(resp.Body.String(), "/mnt/usb2 is not mounted")
+}
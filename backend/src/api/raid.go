@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type RaidHandler struct {
+	raidService service.RaidServiceInterface
+}
+
+func NewRaidHandler(
+	raidService service.RaidServiceInterface,
+) *RaidHandler {
+	p := new(RaidHandler)
+	p.raidService = raidService
+	return p
+}
+
+func (self *RaidHandler) RegisterRaidHandler(api huma.API) {
+	huma.Get(api, "/raid", self.ListArrays, huma.OperationTags("raid"))
+	huma.Get(api, "/raid/{name}", self.GetArray, huma.OperationTags("raid"))
+	huma.Post(api, "/raid/{name}/re-add", self.ReAdd, huma.OperationTags("raid"))
+}
+
+// raidError maps RAID service errors to API errors.
+func raidError(err errors.E, format string, args ...any) error {
+	message := err.Error()
+	if reason, ok := errors.AllDetails(err)["reason"].(string); ok {
+		message += ": " + reason
+	}
+	switch {
+	case errors.Is(err, dto.ErrorNotFound):
+		return huma.Error404NotFound(message)
+	case errors.Is(err, dto.ErrorOperationNotPermittedInProtectedMode):
+		return huma.Error403Forbidden(message)
+	case errors.Is(err, dto.ErrorInvalidParameter), errors.Is(err, dto.ErrorInvalidStateForOperation):
+		return huma.Error422UnprocessableEntity(message)
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+// ListArrays reads the software RAID arrays again and returns them.
+func (self *RaidHandler) ListArrays(ctx context.Context, input *struct{}) (*struct{ Body []dto.RaidArray }, error) {
+	arrays, err := self.raidService.Refresh()
+	if err != nil {
+		return nil, raidError(err, "failed to read the RAID arrays")
+	}
+	return &struct{ Body []dto.RaidArray }{Body: arrays}, nil
+}
+
+func (self *RaidHandler) GetArray(ctx context.Context, input *struct {
+	Name string `path:"name" required:"true" doc:"Kernel name of the array, e.g. md0"`
+}) (*struct{ Body dto.RaidArray }, error) {
+	array, err := self.raidService.GetArray(input.Name)
+	if err != nil {
+		return nil, raidError(err, "failed to get the RAID array %s", input.Name)
+	}
+	return &struct{ Body dto.RaidArray }{Body: *array}, nil
+}
+
+// ReAdd returns the faulty or missing members to an array, which then
+// rebuilds them. It returns 422 when mdadm refuses the member.
+func (self *RaidHandler) ReAdd(ctx context.Context, input *struct {
+	Name string                `path:"name" required:"true" doc:"Kernel name of the array, e.g. md0"`
+	Body *dto.RaidReAddRequest `required:"false"`
+}) (*struct{ Body dto.RaidArray }, error) {
+	device := ""
+	if input.Body != nil {
+		device = input.Body.Device
+	}
+	array, err := self.raidService.ReAdd(input.Name, device)
+	if err != nil {
+		return nil, raidError(err, "failed to re-add the members of %s", input.Name)
+	}
+	return &struct{ Body dto.RaidArray }{Body: *array}, nil
+}
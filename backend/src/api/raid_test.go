@@ -0,0 +1,111 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type RaidHandlerSuite struct {
+	suite.Suite
+	app      *fxtest.App
+	handler  *api.RaidHandler
+	mockRaid service.RaidServiceInterface
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func TestRaidHandlerSuite(t *testing.T) {
+	suite.Run(t, new(RaidHandlerSuite))
+}
+
+func (suite *RaidHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewRaidHandler,
+			mock.Mock[service.RaidServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockRaid),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *RaidHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *RaidHandlerSuite) TestListArrays() {
+	mock.When(suite.mockRaid.Refresh()).ThenReturn([]dto.RaidArray{{
+		Name:       "md0",
+		DevicePath: "/dev/md0",
+		Level:      "raid1",
+		State:      "clean, degraded, recovering",
+		Degraded:   true,
+		Members:    []dto.RaidMember{{Device: "/dev/sdb1", State: "active sync"}},
+		Sync:       &dto.RaidSync{Action: "recovering", Percent: 12.6},
+	}}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRaidHandler(api)
+
+	resp := api.Get("/raid")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var arrays []dto.RaidArray
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &arrays))
+	suite.Require().Len(arrays, 1)
+	suite.Equal("md0", arrays[0].Name)
+	suite.Equal("recovering", arrays[0].Sync.Action)
+}
+
+func (suite *RaidHandlerSuite) TestGetArray() {
+	mock.When(suite.mockRaid.GetArray(mock.Exact("md0"))).ThenReturn(&dto.RaidArray{Name: "md0", Level: "raid1"}, nil)
+	mock.When(suite.mockRaid.GetArray(mock.Exact("md9"))).ThenReturn(nil, errors.WithDetails(dto.ErrorNotFound, "reason", "RAID array not found"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRaidHandler(api)
+
+	resp := api.Get("/raid/md0")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	resp = api.Get("/raid/md9")
+	suite.Equal(http.StatusNotFound, resp.Code)
+}
+
+func (suite *RaidHandlerSuite) TestReAdd() {
+	mock.When(suite.mockRaid.ReAdd(mock.Exact("md0"), mock.Exact("/dev/sdc1"))).ThenReturn(&dto.RaidArray{Name: "md0"}, nil)
+	mock.When(suite.mockRaid.ReAdd(mock.Exact("md0"), mock.Exact(""))).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "reason", "mdadm: --re-add for /dev/sdc1 to /dev/md0 is not possible"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRaidHandler(api)
+
+	resp := api.Post("/raid/md0/re-add", map[string]any{"device": "/dev/sdc1"})
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	resp = api.Post("/raid/md0/re-add")
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+	suite.Contains(resp.Body.String(), "is not possible")
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type RecycleBinHandler struct {
+	recycleBinService service.RecycleBinServiceInterface
+}
+
+func NewRecycleBinHandler(
+	recycleBinService service.RecycleBinServiceInterface,
+) *RecycleBinHandler {
+	p := new(RecycleBinHandler)
+	p.recycleBinService = recycleBinService
+	return p
+}
+
+func (self *RecycleBinHandler) RegisterRecycleBinHandler(api huma.API) {
+	huma.Get(api, "/share/{share_name}/recycle/{username}", self.ListRecycleBin, huma.OperationTags("share"))
+	huma.Post(api, "/share/{share_name}/recycle/{username}/restore", self.RestoreRecycleBinEntry, huma.OperationTags("share"))
+	huma.Delete(api, "/share/{share_name}/recycle/{username}", self.EmptyRecycleBin, huma.OperationTags("share"))
+}
+
+// recycleBinError maps recycle bin service errors to API errors.
+func recycleBinError(err errors.E, format string, args ...any) error {
+	switch {
+	case errors.Is(err, dto.ErrorShareNotFound), errors.Is(err, dto.ErrorNotFound):
+		return huma.Error404NotFound(err.Error())
+	case errors.Is(err, dto.ErrorConflict):
+		return huma.Error409Conflict(err.Error())
+	case errors.Is(err, dto.ErrorInvalidParameter), errors.Is(err, dto.ErrorShareValidation),
+		errors.Is(err, dto.ErrorInvalidStateForOperation):
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+// ListRecycleBin returns the files deleted by a user, most recent first.
+func (self *RecycleBinHandler) ListRecycleBin(ctx context.Context, input *struct {
+	ShareName string `path:"share_name" maxLength:"128" example:"world" doc:"Name of the share"`
+	Username  string `path:"username" maxLength:"64" example:"homeassistant" doc:"Owner of the recycle bin"`
+}) (*struct{ Body []dto.RecycleBinEntry }, error) {
+	entries, err := self.recycleBinService.ListRecycleBin(input.ShareName, input.Username)
+	if err != nil {
+		return nil, recycleBinError(err, "failed to list recycle bin of %s on share %s", input.Username, input.ShareName)
+	}
+	return &struct{ Body []dto.RecycleBinEntry }{Body: entries}, nil
+}
+
+// RestoreRecycleBinEntry moves a deleted file back to where it was in the
+// share. It returns 409 when a file with the same name exists there.
+func (self *RecycleBinHandler) RestoreRecycleBinEntry(ctx context.Context, input *struct {
+	ShareName string `path:"share_name" maxLength:"128" example:"world" doc:"Name of the share"`
+	Username  string `path:"username" maxLength:"64" example:"homeassistant" doc:"Owner of the recycle bin"`
+	Body      struct {
+		Path string `json:"path" minLength:"1" example:"docs/report.odt" doc:"Path of the entry, as listed"`
+	}
+}) (*struct{}, error) {
+	if err := self.recycleBinService.RestoreRecycleBinEntry(input.ShareName, input.Username, input.Body.Path); err != nil {
+		return nil, recycleBinError(err, "failed to restore %s on share %s", input.Body.Path, input.ShareName)
+	}
+	return &struct{}{}, nil
+}
+
+func (self *RecycleBinHandler) EmptyRecycleBin(ctx context.Context, input *struct {
+	ShareName string `path:"share_name" maxLength:"128" example:"world" doc:"Name of the share"`
+	Username  string `path:"username" maxLength:"64" example:"homeassistant" doc:"Owner of the recycle bin"`
+}) (*struct{ Body dto.RecycleBinPurgeResult }, error) {
+	result, err := self.recycleBinService.EmptyRecycleBin(input.ShareName, input.Username)
+	if err != nil {
+		return nil, recycleBinError(err, "failed to empty recycle bin of %s on share %s", input.Username, input.ShareName)
+	}
+	return &struct{ Body dto.RecycleBinPurgeResult }{Body: *result}, nil
+}
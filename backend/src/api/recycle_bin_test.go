@@ -0,0 +1,123 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type RecycleBinHandlerSuite struct {
+	suite.Suite
+	app                   *fxtest.App
+	handler               *api.RecycleBinHandler
+	mockRecycleBinService service.RecycleBinServiceInterface
+	ctx                   context.Context
+	cancel                context.CancelFunc
+}
+
+func TestRecycleBinHandlerSuite(t *testing.T) {
+	suite.Run(t, new(RecycleBinHandlerSuite))
+}
+
+func (suite *RecycleBinHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewRecycleBinHandler,
+			mock.Mock[service.RecycleBinServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockRecycleBinService),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *RecycleBinHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *RecycleBinHandlerSuite) TestListRecycleBin() {
+	deleted := time.Date(2026, 2, 1, 9, 30, 0, 0, time.UTC)
+	mock.When(suite.mockRecycleBinService.ListRecycleBin("data", "alice")).ThenReturn([]dto.RecycleBinEntry{
+		{Path: "docs/report.odt", Size: 2048, DeletedAt: deleted},
+	}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRecycleBinHandler(api)
+
+	resp := api.Get("/share/data/recycle/alice")
+	suite.Require().Equal(http.StatusOK, resp.Code)
+
+	var result []dto.RecycleBinEntry
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Require().Len(result, 1)
+	suite.Equal("docs/report.odt", result[0].Path)
+	suite.Equal(deleted, result[0].DeletedAt)
+}
+
+func (suite *RecycleBinHandlerSuite) TestEmptyRecycleBin() {
+	mock.When(suite.mockRecycleBinService.EmptyRecycleBin("data", "alice")).
+		ThenReturn(&dto.RecycleBinPurgeResult{RemovedFiles: 3, FreedBytes: 4096}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRecycleBinHandler(api)
+
+	resp := api.Delete("/share/data/recycle/alice")
+	suite.Require().Equal(http.StatusOK, resp.Code)
+
+	var result dto.RecycleBinPurgeResult
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Equal(uint(3), result.RemovedFiles)
+	suite.Equal(uint64(4096), result.FreedBytes)
+}
+
+func (suite *RecycleBinHandlerSuite) TestRestoreRecycleBinEntryErrors() {
+	cases := []struct {
+		path string
+		err  error
+		code int
+	}{
+		{"ok.txt", nil, http.StatusNoContent},
+		{"missing.txt", dto.ErrorNotFound, http.StatusNotFound},
+		{"exists.txt", dto.ErrorConflict, http.StatusConflict},
+		{"../escape.txt", dto.ErrorInvalidParameter, http.StatusUnprocessableEntity},
+		{"boom.txt", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		var errE errors.E
+		if tc.err != nil {
+			errE = errors.WithStack(tc.err)
+		}
+		mock.When(suite.mockRecycleBinService.RestoreRecycleBinEntry("data", "alice", tc.path)).ThenReturn(errE)
+
+		_, api := humatest.New(suite.T())
+		suite.handler.RegisterRecycleBinHandler(api)
+
+		resp := api.Post("/share/data/recycle/alice/restore", map[string]any{"path": tc.path})
+		suite.Equal(tc.code, resp.Code, "path %s: %s", tc.path, resp.Body.String())
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type RemoteMountHandler struct {
+	remoteMountService service.RemoteMountServiceInterface
+}
+
+func NewRemoteMountHandler(
+	remoteMountService service.RemoteMountServiceInterface,
+) *RemoteMountHandler {
+	p := new(RemoteMountHandler)
+	p.remoteMountService = remoteMountService
+	return p
+}
+
+func (self *RemoteMountHandler) RegisterRemoteMountHandler(api huma.API) {
+	huma.Get(api, "/remotes", self.ListRemoteMounts, huma.OperationTags("volume"))
+	huma.Post(api, "/remote", self.CreateRemoteMount, huma.OperationTags("volume"))
+	huma.Put(api, "/remote/{remote_name}", self.UpdateRemoteMount, huma.OperationTags("volume"))
+	huma.Post(api, "/remote/{remote_name}/mount", self.MountRemote, huma.OperationTags("volume"))
+	huma.Post(api, "/remote/{remote_name}/unmount", self.UnmountRemote, huma.OperationTags("volume"))
+	huma.Delete(api, "/remote/{remote_name}", self.DeleteRemoteMount, huma.OperationTags("volume"))
+}
+
+// remoteError maps remote mount service errors to API errors.
+func remoteError(err errors.E, format string, args ...any) error {
+	message := err.Error()
+	if reason, ok := errors.AllDetails(err)["reason"].(string); ok {
+		message += ": " + reason
+	}
+	switch {
+	case errors.Is(err, dto.ErrorNotFound):
+		return huma.Error404NotFound(message)
+	case errors.Is(err, dto.ErrorOperationNotPermittedInProtectedMode):
+		return huma.Error403Forbidden(message)
+	case errors.Is(err, dto.ErrorConflict):
+		return huma.Error409Conflict(message)
+	case errors.Is(err, dto.ErrorInvalidParameter), errors.Is(err, dto.ErrorInvalidStateForOperation),
+		errors.Is(err, dto.ErrorMountFail), errors.Is(err, dto.ErrorUnmountFail):
+		return huma.Error422UnprocessableEntity(message)
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+// ListRemoteMounts lists the CIFS and NFS remote mounts with the health of
+// their server.
+func (self *RemoteMountHandler) ListRemoteMounts(ctx context.Context, input *struct{}) (*struct{ Body []dto.RemoteMount }, error) {
+	remotes, err := self.remoteMountService.ListRemoteMounts()
+	if err != nil {
+		return nil, remoteError(err, "failed to list the remote mounts")
+	}
+	return &struct{ Body []dto.RemoteMount }{Body: remotes}, nil
+}
+
+// CreateRemoteMount mounts a share or an export of another host on
+// /mnt/<name>, where shares can then be created.
+func (self *RemoteMountHandler) CreateRemoteMount(ctx context.Context, input *struct {
+	Body dto.RemoteMountCreateRequest `required:"true"`
+}) (*struct{ Body dto.RemoteMount }, error) {
+	remote, err := self.remoteMountService.CreateRemoteMount(input.Body)
+	if err != nil {
+		return nil, remoteError(err, "failed to create remote mount %s", input.Body.Name)
+	}
+	return &struct{ Body dto.RemoteMount }{Body: *remote}, nil
+}
+
+// UpdateRemoteMount changes the mount options or the credentials of a remote.
+func (self *RemoteMountHandler) UpdateRemoteMount(ctx context.Context, input *struct {
+	RemoteName string                       `path:"remote_name" required:"true" doc:"Name of the remote"`
+	Body       dto.RemoteMountUpdateRequest `required:"true"`
+}) (*struct{ Body dto.RemoteMount }, error) {
+	remote, err := self.remoteMountService.UpdateRemoteMount(input.RemoteName, input.Body)
+	if err != nil {
+		return nil, remoteError(err, "failed to update remote mount %s", input.RemoteName)
+	}
+	return &struct{ Body dto.RemoteMount }{Body: *remote}, nil
+}
+
+// MountRemote mounts a remote again and keeps it mounted across network losses.
+func (self *RemoteMountHandler) MountRemote(ctx context.Context, input *struct {
+	RemoteName string `path:"remote_name" required:"true" doc:"Name of the remote"`
+}) (*struct{ Body dto.RemoteMount }, error) {
+	remote, err := self.remoteMountService.MountRemote(input.RemoteName)
+	if err != nil {
+		return nil, remoteError(err, "failed to mount remote %s", input.RemoteName)
+	}
+	return &struct{ Body dto.RemoteMount }{Body: *remote}, nil
+}
+
+// UnmountRemote unmounts a remote until it is mounted again.
+func (self *RemoteMountHandler) UnmountRemote(ctx context.Context, input *struct {
+	RemoteName string `path:"remote_name" required:"true" doc:"Name of the remote"`
+}) (*struct{ Body dto.RemoteMount }, error) {
+	remote, err := self.remoteMountService.UnmountRemote(input.RemoteName)
+	if err != nil {
+		return nil, remoteError(err, "failed to unmount remote %s", input.RemoteName)
+	}
+	return &struct{ Body dto.RemoteMount }{Body: *remote}, nil
+}
+
+// DeleteRemoteMount unmounts and forgets a remote with its credentials. It
+// returns 422 while shares use it.
+func (self *RemoteMountHandler) DeleteRemoteMount(ctx context.Context, input *struct {
+	RemoteName string `path:"remote_name" required:"true" doc:"Name of the remote"`
+}) (*struct{}, error) {
+	if err := self.remoteMountService.DeleteRemoteMount(input.RemoteName); err != nil {
+		return nil, remoteError(err, "failed to delete remote mount %s", input.RemoteName)
+	}
+	return &struct{}{}, nil
+}
@@ -0,0 +1,186 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type RemoteMountHandlerSuite struct {
+	suite.Suite
+	app        *fxtest.App
+	handler    *api.RemoteMountHandler
+	mockRemote service.RemoteMountServiceInterface
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+func TestRemoteMountHandlerSuite(t *testing.T) {
+	suite.Run(t, new(RemoteMountHandlerSuite))
+}
+
+func (suite *RemoteMountHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewRemoteMountHandler,
+			mock.Mock[service.RemoteMountServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockRemote),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *RemoteMountHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *RemoteMountHandlerSuite) TestListRemoteMounts() {
+	mock.When(suite.mockRemote.ListRemoteMounts()).ThenReturn([]dto.RemoteMount{{
+		Name:        "media",
+		Protocol:    "cifs",
+		Server:      "nas",
+		Share:       "media",
+		Path:        "/mnt/media",
+		Username:    "backup",
+		HasPassword: true,
+		IsMounted:   true,
+		IsReachable: false,
+	}}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRemoteMountHandler(api)
+
+	resp := api.Get("/remotes")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var remotes []dto.RemoteMount
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &remotes))
+	suite.Require().Len(remotes, 1)
+	suite.Equal("nas", remotes[0].Server)
+	suite.True(remotes[0].HasPassword)
+	suite.False(remotes[0].IsReachable)
+}
+
+func (suite *RemoteMountHandlerSuite) TestCreateRemoteMount() {
+	var password string
+	mock.When(suite.mockRemote.CreateRemoteMount(mock.Any[dto.RemoteMountCreateRequest]())).ThenAnswer(func(args []any) []any {
+		request := args[0].(dto.RemoteMountCreateRequest)
+		if request.Password != nil {
+			password = request.Password.Expose()
+		}
+		return []any{&dto.RemoteMount{Name: request.Name, Protocol: request.Protocol, Path: "/mnt/" + request.Name, IsMounted: true, HasPassword: true}, nil}
+	})
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRemoteMountHandler(api)
+
+	resp := api.Post("/remote", map[string]any{
+		"name": "media", "protocol": "cifs", "server": "nas", "share": "media",
+		"username": "backup", "password": "s3cret",
+		"custom_flags": []map[string]any{{"name": "vers", "value": "3.0"}},
+	})
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	suite.Equal("s3cret", password)
+	suite.NotContains(resp.Body.String(), "s3cret")
+	var remote dto.RemoteMount
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &remote))
+	suite.Equal("/mnt/media", remote.Path)
+	suite.True(remote.IsMounted)
+
+	resp = api.Post("/remote", map[string]any{"name": "media", "protocol": "afp", "server": "nas", "share": "media"})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+
+	resp = api.Post("/remote", map[string]any{"name": "../media", "protocol": "nfs", "server": "nas", "share": "/export"})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+}
+
+func (suite *RemoteMountHandlerSuite) TestCreateRemoteMountFailure() {
+	mock.When(suite.mockRemote.CreateRemoteMount(mock.Any[dto.RemoteMountCreateRequest]())).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorMountFail, "reason", "mount error(13): Permission denied"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRemoteMountHandler(api)
+
+	resp := api.Post("/remote", map[string]any{"name": "media", "protocol": "cifs", "server": "nas", "share": "media"})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+	suite.Contains(resp.Body.String(), "Permission denied")
+}
+
+func (suite *RemoteMountHandlerSuite) TestUpdateRemoteMount() {
+	request := dto.RemoteMountUpdateRequest{CustomFlags: &dto.MountFlags{{Name: "seal"}}}
+	mock.When(suite.mockRemote.UpdateRemoteMount(mock.Exact("media"), mock.Equal(request))).
+		ThenReturn(&dto.RemoteMount{Name: "media", CustomFlags: dto.MountFlags{{Name: "seal"}}, IsMounted: true}, nil)
+	mock.When(suite.mockRemote.UpdateRemoteMount(mock.Exact("missing"), mock.Any[dto.RemoteMountUpdateRequest]())).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorNotFound, "reason", "no remote is named missing"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRemoteMountHandler(api)
+
+	resp := api.Put("/remote/media", map[string]any{"custom_flags": []map[string]any{{"name": "seal"}}})
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var remote dto.RemoteMount
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &remote))
+	suite.Equal("seal", remote.CustomFlags[0].Name)
+
+	resp = api.Put("/remote/missing", map[string]any{"is_to_mount_at_startup": false})
+	suite.Equal(http.StatusNotFound, resp.Code, resp.Body.String())
+}
+
+func (suite *RemoteMountHandlerSuite) TestMountAndUnmountRemote() {
+	mock.When(suite.mockRemote.MountRemote(mock.Exact("media"))).
+		ThenReturn(&dto.RemoteMount{Name: "media", IsMounted: true}, nil)
+	mock.When(suite.mockRemote.UnmountRemote(mock.Exact("media"))).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "reason", "the remote is not mounted"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRemoteMountHandler(api)
+
+	resp := api.Post("/remote/media/mount")
+	suite.Equal(http.StatusOK, resp.Code, resp.Body.String())
+	resp = api.Post("/remote/media/unmount")
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+	suite.Contains(resp.Body.String(), "not mounted")
+}
+
+func (suite *RemoteMountHandlerSuite) TestDeleteRemoteMount() {
+	mock.When(suite.mockRemote.DeleteRemoteMount(mock.Exact("media"))).ThenReturn(nil)
+	mock.When(suite.mockRemote.DeleteRemoteMount(mock.Exact("shared"))).
+		ThenReturn(errors.WithDetails(dto.ErrorInvalidStateForOperation, "reason", "the remote is shared as Backups"))
+	mock.When(suite.mockRemote.DeleteRemoteMount(mock.Exact("locked"))).
+		ThenReturn(errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode, "reason", "protected"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterRemoteMountHandler(api)
+
+	resp := api.Delete("/remote/media")
+	suite.Equal(http.StatusNoContent, resp.Code, resp.Body.String())
+	resp = api.Delete("/remote/shared")
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+	suite.Contains(resp.Body.String(), "shared as Backups")
+	resp = api.Delete("/remote/locked")
+	suite.Equal(http.StatusForbidden, resp.Code, resp.Body.String())
+}
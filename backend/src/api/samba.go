@@ -7,6 +7,7 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/dianlight/srat/dto"
 	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
 )
 
 type SambaHanler struct {
@@ -24,7 +25,12 @@ func NewSambaHanler(apictx *dto.ContextState, sambaService service.ServerService
 func (self *SambaHanler) RegisterSambaHandler(api huma.API) {
 	huma.Get(api, "/samba/config", self.GetSambaConfig, huma.OperationTags("samba"))
 	huma.Put(api, "/samba/apply", self.ApplySamba, huma.OperationTags("samba"))
+	huma.Get(api, "/samba/apply/history", self.GetSambaApplyHistory, huma.OperationTags("samba"))
+	huma.Get(api, "/samba/apply/preview", self.GetSambaApplyPreview, huma.OperationTags("samba"))
 	huma.Get(api, "/samba/status", self.GetSambaStatus, huma.OperationTags("samba"))
+	huma.Delete(api, "/samba/session/{session_id}", self.DisconnectSambaSession, huma.OperationTags("samba"))
+	huma.Delete(api, "/samba/sessions", self.DisconnectSambaSessions, huma.OperationTags("samba"))
+	huma.Delete(api, "/samba/open-file", self.CloseSambaOpenFile, huma.OperationTags("samba"))
 }
 
 func (handler *SambaHanler) GetSambaStatus(ctx context.Context, input *struct{}) (*struct{ Body dto.SambaStatus }, error) {
@@ -35,21 +41,119 @@ func (handler *SambaHanler) GetSambaStatus(ctx context.Context, input *struct{})
 	return &struct{ Body dto.SambaStatus }{Body: *status}, nil
 }
 
+// DisconnectSambaSession ends a Samba session, e.g. to force a client off a
+// share before its volume is unmounted.
+func (handler *SambaHanler) DisconnectSambaSession(ctx context.Context, input *struct {
+	SessionID string `path:"session_id" doc:"Session id, as in /samba/status"`
+}) (*struct{ Status int }, error) {
+	if handler.apictx.ReadOnlyMode {
+		return nil, huma.Error403Forbidden("Cannot disconnect Samba sessions in read-only mode")
+	}
+	if err := handler.sambaService.DisconnectSession(ctx, input.SessionID); err != nil {
+		if errors.Is(err, dto.ErrorSambaSessionNotFound) {
+			return nil, huma.Error404NotFound(err.Error())
+		}
+		return nil, err
+	}
+	return &struct{ Status int }{Status: http.StatusNoContent}, nil
+}
+
+// DisconnectSambaSessions ends all the Samba sessions of a user or of a client IP.
+func (handler *SambaHanler) DisconnectSambaSessions(ctx context.Context, input *struct {
+	Username string `query:"username" doc:"End the sessions of this user"`
+	ClientIP string `query:"client_ip" doc:"End the sessions from this client address"`
+}) (*struct{ Body dto.SambaDisconnectResult }, error) {
+	if handler.apictx.ReadOnlyMode {
+		return nil, huma.Error403Forbidden("Cannot disconnect Samba sessions in read-only mode")
+	}
+	if (input.Username == "") == (input.ClientIP == "") {
+		return nil, huma.Error422UnprocessableEntity("Exactly one of username and client_ip is required")
+	}
+
+	var count int
+	var err errors.E
+	if input.Username != "" {
+		count, err = handler.sambaService.DisconnectUser(ctx, input.Username)
+	} else {
+		count, err = handler.sambaService.DisconnectClient(ctx, input.ClientIP)
+	}
+	if err != nil {
+		if errors.Is(err, dto.ErrorInvalidParameter) {
+			return nil, huma.Error422UnprocessableEntity(err.Error())
+		}
+		return nil, err
+	}
+	return &struct{ Body dto.SambaDisconnectResult }{Body: dto.SambaDisconnectResult{Disconnected: count}}, nil
+}
+
+// CloseSambaOpenFile releases a file held open, and locked, by Samba clients,
+// e.g. a Time Machine sparse bundle left locked by a Mac. Samba can't close a
+// single handle, so each client holding the file is disconnected from its
+// share; the client reconnects on its next access.
+func (handler *SambaHanler) CloseSambaOpenFile(ctx context.Context, input *struct {
+	Path   string `query:"path" required:"true" doc:"Key of the file in open_files of /samba/status"`
+	OpenID string `query:"open_id" doc:"Key of the open in the opens of the file. Omit to release all the opens"`
+}) (*struct{ Body dto.SambaDisconnectResult }, error) {
+	if handler.apictx.ReadOnlyMode {
+		return nil, huma.Error403Forbidden("Cannot close Samba open files in read-only mode")
+	}
+	count, err := handler.sambaService.CloseOpenFile(ctx, input.Path, input.OpenID)
+	if err != nil {
+		if errors.Is(err, dto.ErrorOpenFileNotFound) {
+			return nil, huma.Error404NotFound(err.Error())
+		}
+		return nil, err
+	}
+	return &struct{ Body dto.SambaDisconnectResult }{Body: dto.SambaDisconnectResult{Disconnected: count}}, nil
+}
+
 // ApplySamba applies the Samba configuration by writing, testing, and restarting the Samba service.
-// It returns an error if any of the steps fail.
-func (handler *SambaHanler) ApplySamba(ctx context.Context, input *struct{}) (*struct{ Status int }, error) {
+// With a generation it applies the configuration files of that generation again instead.
+// It returns an error if any of the steps fail; the previous configuration is then restored.
+func (handler *SambaHanler) ApplySamba(ctx context.Context, input *struct {
+	Generation uint `query:"generation" doc:"Generation to roll back to, see /samba/apply/history. Omit to apply the current configuration"`
+}) (*struct{ Status int }, error) {
 	if handler.apictx.ReadOnlyMode {
 		return nil, huma.Error403Forbidden("Cannot apply Samba configuration in read-only mode")
 	}
 
-	err := handler.sambaService.WriteConfigsAndRestartProcesses(ctx)
+	var err errors.E
+	if input.Generation > 0 {
+		err = handler.sambaService.RollbackConfig(ctx, input.Generation)
+	} else {
+		err = handler.sambaService.WriteConfigsAndRestartProcesses(ctx)
+	}
 	if err != nil {
+		if errors.Is(err, dto.ErrorConfigGenerationNotFound) {
+			return nil, huma.Error404NotFound(err.Error())
+		}
 		return nil, huma.Error500InternalServerError("Restarting Samba configuration failed", err)
 	}
 
 	return &struct{ Status int }{Status: http.StatusNoContent}, nil
 }
 
+// GetSambaApplyHistory lists the applied configuration generations, newest first.
+func (handler *SambaHanler) GetSambaApplyHistory(ctx context.Context, input *struct{}) (*struct{ Body []dto.ConfigGeneration }, error) {
+	generations, err := handler.sambaService.ListConfigGenerations()
+	if err != nil {
+		return nil, err
+	}
+	return &struct{ Body []dto.ConfigGeneration }{Body: generations}, nil
+}
+
+// GetSambaApplyPreview tells what applying the configuration would change: the
+// unified diff of smb.conf, the username map and the NFS exports against the
+// files on disk, the testparm warnings and the restart of each managed server.
+// Nothing is written or restarted.
+func (handler *SambaHanler) GetSambaApplyPreview(ctx context.Context, input *struct{}) (*struct{ Body dto.ConfigPreview }, error) {
+	preview, err := handler.sambaService.PreviewConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &struct{ Body dto.ConfigPreview }{Body: *preview}, nil
+}
+
 // GetSambaConfig retrieves the Samba configuration.
 // It creates a configuration stream using the sambaService and converts it to a string.
 // The configuration is then returned wrapped in a struct containing the dto.SmbConf.
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2/humatest"
 	"github.com/dianlight/srat/api"
@@ -138,6 +139,132 @@ func (suite *SambaHandlerSuite) TestApplySambaError() {
 	suite.Require().Equal(http.StatusInternalServerError, resp.Code)
 }
 
+func (suite *SambaHandlerSuite) TestApplySambaRollback() {
+	mock.When(suite.mockSambaService.RollbackConfig(mock.AnyContext(), mock.Exact(uint(3)))).ThenReturn(nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSambaHandler(api)
+
+	resp := api.Put("/samba/apply?generation=3", struct{}{})
+	suite.Require().Equal(http.StatusNoContent, resp.Code)
+	mock.Verify(suite.mockSambaService, mock.Never()).WriteConfigsAndRestartProcesses(mock.AnyContext())
+}
+
+func (suite *SambaHandlerSuite) TestApplySambaRollbackUnknownGeneration() {
+	mock.When(suite.mockSambaService.RollbackConfig(mock.AnyContext(), mock.Exact(uint(42)))).
+		ThenReturn(errors.WithDetails(dto.ErrorConfigGenerationNotFound, "generation", 42))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSambaHandler(api)
+
+	resp := api.Put("/samba/apply?generation=42", struct{}{})
+	suite.Require().Equal(http.StatusNotFound, resp.Code)
+}
+
+func (suite *SambaHandlerSuite) TestGetSambaApplyHistory() {
+	appliedAt := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	mock.When(suite.mockSambaService.ListConfigGenerations()).ThenReturn([]dto.ConfigGeneration{
+		{Generation: 2, AppliedAt: appliedAt, Files: []string{"/etc/samba/smb.conf"}, RestoredFrom: 1, Current: true},
+		{Generation: 1, AppliedAt: appliedAt.Add(-time.Hour), Files: []string{"/etc/samba/smb.conf"}},
+	}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSambaHandler(api)
+
+	resp := api.Get("/samba/apply/history")
+	suite.Require().Equal(http.StatusOK, resp.Code)
+
+	var result []dto.ConfigGeneration
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Require().Len(result, 2)
+	suite.Equal(uint(2), result[0].Generation)
+	suite.True(result[0].Current)
+	suite.Equal(uint(1), result[0].RestoredFrom)
+}
+
+func (suite *SambaHandlerSuite) TestGetSambaApplyPreview() {
+	mock.When(suite.mockSambaService.PreviewConfig(mock.AnyContext())).ThenReturn(&dto.ConfigPreview{
+		Files: []dto.ConfigFileDiff{
+			{Path: "/etc/samba/smb.conf", Changed: true, Diff: "--- /etc/samba/smb.conf\n+++ /etc/samba/smb.conf\n"},
+		},
+		Valid:            true,
+		TestparmWarnings: []string{"WARNING: The 'netbios name' is too long"},
+		Dirty:            dto.DataDirtyTracker{Shares: true},
+		Restarts:         []dto.ServiceRestart{{Service: "smbd", Action: dto.ServiceRestartActionSoft}},
+	}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSambaHandler(api)
+
+	resp := api.Get("/samba/apply/preview")
+	suite.Require().Equal(http.StatusOK, resp.Code)
+
+	var result dto.ConfigPreview
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Require().Len(result.Files, 1)
+	suite.True(result.Files[0].Changed)
+	suite.Equal([]string{"WARNING: The 'netbios name' is too long"}, result.TestparmWarnings)
+	suite.Equal(dto.ServiceRestartActionSoft, result.Restarts[0].Action)
+	mock.Verify(suite.mockSambaService, mock.Never()).WriteConfigsAndRestartProcesses(mock.AnyContext())
+}
+
+func (suite *SambaHandlerSuite) TestDisconnectSambaSession() {
+	mock.When(suite.mockSambaService.DisconnectSession(mock.AnyContext(), mock.Exact("1234"))).ThenReturn(nil)
+	mock.When(suite.mockSambaService.DisconnectSession(mock.AnyContext(), mock.Exact("999"))).
+		ThenReturn(errors.WithDetails(dto.ErrorSambaSessionNotFound, "session_id", "999"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSambaHandler(api)
+
+	resp := api.Delete("/samba/session/1234")
+	suite.Equal(http.StatusNoContent, resp.Code)
+
+	resp = api.Delete("/samba/session/999")
+	suite.Equal(http.StatusNotFound, resp.Code)
+}
+
+func (suite *SambaHandlerSuite) TestDisconnectSambaSessions() {
+	mock.When(suite.mockSambaService.DisconnectUser(mock.AnyContext(), mock.Exact("alice"))).ThenReturn(2, nil)
+	mock.When(suite.mockSambaService.DisconnectClient(mock.AnyContext(), mock.Exact("not-an-ip"))).
+		ThenReturn(0, errors.WithDetails(dto.ErrorInvalidParameter, "client_ip", "not-an-ip"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSambaHandler(api)
+
+	resp := api.Delete("/samba/sessions?username=alice")
+	suite.Require().Equal(http.StatusOK, resp.Code)
+	var result dto.SambaDisconnectResult
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Equal(2, result.Disconnected)
+
+	resp = api.Delete("/samba/sessions?client_ip=not-an-ip")
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+
+	resp = api.Delete("/samba/sessions")
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+	resp = api.Delete("/samba/sessions?username=alice&client_ip=192.168.1.10")
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+}
+
+func (suite *SambaHandlerSuite) TestCloseSambaOpenFile() {
+	mock.When(suite.mockSambaService.CloseOpenFile(mock.AnyContext(), mock.Exact("/mnt/backup/mac.sparsebundle"), mock.Exact("4321/12"))).
+		ThenReturn(1, nil)
+	mock.When(suite.mockSambaService.CloseOpenFile(mock.AnyContext(), mock.Exact("/mnt/backup/gone"), mock.Exact(""))).
+		ThenReturn(0, errors.WithDetails(dto.ErrorOpenFileNotFound, "path", "/mnt/backup/gone"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSambaHandler(api)
+
+	resp := api.Delete("/samba/open-file?path=/mnt/backup/mac.sparsebundle&open_id=4321/12")
+	suite.Require().Equal(http.StatusOK, resp.Code)
+	var result dto.SambaDisconnectResult
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Equal(1, result.Disconnected)
+
+	resp = api.Delete("/samba/open-file?path=/mnt/backup/gone")
+	suite.Equal(http.StatusNotFound, resp.Code)
+}
+
 func (suite *SambaHandlerSuite) TestGetSambaConfigSuccess() {
 	configData := []byte("[global]\nworkgroup = WORKGROUP\nsecurity = user\n")
 
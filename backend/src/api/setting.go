@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/angusgmorrison/logfusc"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/dianlight/srat/dto"
 	"github.com/dianlight/srat/events"
@@ -250,9 +251,12 @@ func (self *SettingsHanler) RestartHACore(ctx context.Context, input *struct{})
 //   - An error if any step in the process fails.
 func (self *SettingsHanler) UpdateSettings(ctx context.Context, input *struct {
 	//Name string `path:"name" maxLength:"30" example:"world" doc:"Name to greet"`
-	Body dto.Settings
+	Body dto.SettingsUpdate
 }) (*struct{ Body dto.Settings }, error) {
-	config := input.Body
+	config := input.Body.Settings
+	if input.Body.MQTTPassword != nil {
+		config.MQTTPassword = logfusc.NewSecret(input.Body.MQTTPassword.Expose())
+	}
 
 	err := self.settingService.UpdateSettings(&config)
 	if err != nil {
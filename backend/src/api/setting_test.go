@@ -3,8 +3,10 @@ package api_test
 import (
 	"context"
 	"encoding/json"
+	"maps"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 
@@ -675,3 +677,41 @@ func (suite *SettingsHandlerSuite) TestRestartHACoreHandler_FailsWhenServiceFail
 	suite.Require().Equal(http.StatusInternalServerError, rr.Code, "Response body: %s", rr.Body.String())
 	_ = mock.Verify(suite.haService, matchers.Times(1)).RestartHomeAssistant(mock.AnyContext())
 }
+
+func TestUpdateSettingsHandler_MQTTPasswordIsWriteOnly(t *testing.T) {
+	ctrl := mock.NewMockController(t)
+	settingService := mock.Mock[service.SettingServiceInterface](ctrl)
+	var password string
+	mock.When(settingService.UpdateSettings(mock.Any[*dto.Settings]())).ThenAnswer(func(args []any) []any {
+		password = args[0].(*dto.Settings).MQTTPassword.Expose()
+		return []any{nil}
+	})
+	_, humaAPI := humatest.New(t)
+	api.NewSettingsHanler(settingService, nil, nil, nil, nil, nil).RegisterSettings(humaAPI)
+
+	body := func(fields map[string]any) map[string]any {
+		maps.Copy(fields, map[string]any{
+			"telemetry_mode": "Disabled", "smart_mode": "none", "experimental_lab_mode": false,
+			"standard_share_names": "both", "homes_delete_policy": "keep",
+		})
+		return fields
+	}
+	resp := humaAPI.Put("/settings", body(map[string]any{"mqtt_username": "srat", "mqtt_password": "s3cret"}))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", resp.Code, resp.Body.String())
+	}
+	if password != "s3cret" {
+		t.Errorf("the password was not saved, got %q", password)
+	}
+	if out := resp.Body.String(); strings.Contains(out, "s3cret") || strings.Contains(out, "mqtt_password") {
+		t.Errorf("the password was returned: %s", out)
+	}
+
+	resp = humaAPI.Put("/settings", body(map[string]any{"mqtt_username": "srat"}))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", resp.Code, resp.Body.String())
+	}
+	if password != "" {
+		t.Errorf("an update without the password must leave it empty for the service to keep the stored one, got %q", password)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type SharePermissionHandler struct {
+	permissionService service.SharePermissionServiceInterface
+}
+
+func NewSharePermissionHandler(
+	permissionService service.SharePermissionServiceInterface,
+) *SharePermissionHandler {
+	p := new(SharePermissionHandler)
+	p.permissionService = permissionService
+	return p
+}
+
+func (self *SharePermissionHandler) RegisterSharePermissionHandler(api huma.API) {
+	huma.Post(api, "/share/{share_name}/permissions/repair", self.RepairPermissions, huma.OperationTags("share"))
+}
+
+// RepairPermissions starts a recursive ownership and mode repair of the share
+// tree. The repair runs in background: progress is streamed as command_output
+// websocket events and the returned execution can be polled on /command_output.
+func (self *SharePermissionHandler) RepairPermissions(ctx context.Context, input *struct {
+	ShareName string `path:"share_name" maxLength:"128" example:"world" doc:"Name of the share"`
+}) (*struct {
+	Status int
+	Body   dto.CommandExecutionSnapshot
+}, error) {
+	snapshot, err := self.permissionService.RepairPermissions(input.ShareName)
+	if err != nil {
+		if errors.Is(err, dto.ErrorShareNotFound) {
+			return nil, huma.Error404NotFound(err.Error())
+		}
+		if errors.Is(err, dto.ErrorConflict) {
+			return nil, huma.Error409Conflict("a permission repair is already running for this share")
+		}
+		if errors.Is(err, dto.ErrorShareValidation) || errors.Is(err, dto.ErrorInvalidStateForOperation) {
+			return nil, huma.Error422UnprocessableEntity(err.Error())
+		}
+		return nil, errors.Wrapf(err, "failed to repair permissions of share %s", input.ShareName)
+	}
+
+	return &struct {
+		Status int
+		Body   dto.CommandExecutionSnapshot
+	}{Status: http.StatusAccepted, Body: *snapshot}, nil
+}
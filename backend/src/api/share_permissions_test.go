@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type SharePermissionHandlerSuite struct {
+	suite.Suite
+	app                   *fxtest.App
+	handler               *api.SharePermissionHandler
+	mockPermissionService service.SharePermissionServiceInterface
+	ctx                   context.Context
+	cancel                context.CancelFunc
+}
+
+func TestSharePermissionHandlerSuite(t *testing.T) {
+	suite.Run(t, new(SharePermissionHandlerSuite))
+}
+
+func (suite *SharePermissionHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewSharePermissionHandler,
+			mock.Mock[service.SharePermissionServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockPermissionService),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *SharePermissionHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *SharePermissionHandlerSuite) TestRepairPermissionsAccepted() {
+	snapshot := &dto.CommandExecutionSnapshot{ExecutionID: "exec-1", CommandID: service.SharePermissionRepairCommandID, Running: true}
+	mock.When(suite.mockPermissionService.RepairPermissions("data")).ThenReturn(snapshot, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSharePermissionHandler(api)
+
+	resp := api.Post("/share/data/permissions/repair")
+	suite.Require().Equal(http.StatusAccepted, resp.Code)
+
+	var result dto.CommandExecutionSnapshot
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Equal("exec-1", result.ExecutionID)
+}
+
+func (suite *SharePermissionHandlerSuite) TestRepairPermissionsErrors() {
+	cases := []struct {
+		share string
+		err   error
+		code  int
+	}{
+		{"missing", dto.ErrorShareNotFound, http.StatusNotFound},
+		{"busy", dto.ErrorConflict, http.StatusConflict},
+		{"unmounted", dto.ErrorInvalidStateForOperation, http.StatusUnprocessableEntity},
+		{"broken", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		mock.When(suite.mockPermissionService.RepairPermissions(tc.share)).ThenReturn(nil, errors.WithStack(tc.err))
+
+		_, api := humatest.New(suite.T())
+		suite.handler.RegisterSharePermissionHandler(api)
+
+		resp := api.Post("/share/" + tc.share + "/permissions/repair")
+		suite.Equal(tc.code, resp.Code, "error %v", tc.err)
+	}
+}
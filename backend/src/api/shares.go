@@ -14,17 +14,34 @@ import (
 type ShareHandler struct {
 	apiContext   *dto.ContextState
 	shareService service.ShareServiceInterface
+	quotaService service.QuotaServiceInterface
 }
 
 func NewShareHandler(apiContext *dto.ContextState,
 	shareService service.ShareServiceInterface,
+	quotaService service.QuotaServiceInterface,
 ) *ShareHandler {
 	p := new(ShareHandler)
 	p.apiContext = apiContext
 	p.shareService = shareService
+	p.quotaService = quotaService
 	return p
 }
 
+// withQuota adds the last quota usage report to the share status.
+func (self *ShareHandler) withQuota(share *dto.SharedResource) {
+	quota := self.quotaService.GetShareQuotaStatus(share.Name)
+	if quota == nil {
+		return
+	}
+	var status dto.SharedResourceStatus
+	if share.Status != nil {
+		status = *share.Status
+	}
+	status.Quota = quota
+	share.Status = &status
+}
+
 func (self *ShareHandler) RegisterShareHandler(api huma.API) {
 	huma.Get(api, "/shares", self.ListShares, huma.OperationTags("share"))
 	huma.Get(api, "/share/{share_name}", self.GetShare, huma.OperationTags("share"))
@@ -50,6 +67,9 @@ func (self *ShareHandler) ListShares(ctx context.Context, input *struct{}) (*str
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to list shares")
 	}
+	for i := range shares {
+		self.withQuota(&shares[i])
+	}
 	return &struct{ Body []dto.SharedResource }{Body: shares}, nil
 }
 
@@ -79,6 +99,7 @@ func (self *ShareHandler) GetShare(ctx context.Context, input *struct {
 		}
 		return nil, errors.Wrapf(err, "failed to get share %s", input.ShareName)
 	}
+	self.withQuota(share)
 	return &struct{ Body dto.SharedResource }{Body: *share}, nil
 }
 
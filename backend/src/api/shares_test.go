@@ -42,6 +42,7 @@ func (suite *ShareHandlerSuite) SetupTest() {
 			service.NewDirtyDataService,
 			events.NewEventBus,
 			mock.Mock[service.ShareServiceInterface],
+			mock.Mock[service.QuotaServiceInterface],
 			func() *dto.ContextState {
 				return &dto.ContextState{
 					ReadOnlyMode:    false,
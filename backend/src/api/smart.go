@@ -53,6 +53,7 @@ func (h *SmartHandler) ensureSmartIntegrationEnabled(ctx context.Context) error
 // It sets up the following routes:
 // - GET /disk/{disk_id}/smart/info: Get SMART information for a disk.
 // - GET /disk/{disk_id}/smart/health: Get SMART health status for a disk.
+// - GET /disk/{disk_id}/smart/prediction: Get the SMART trend analysis of a disk.
 // - GET /disk/{disk_id}/smart/test: Get SMART self-test status for a disk.
 // - POST /disk/{disk_id}/smart/test/start: Start a SMART self-test.
 // - POST /disk/{disk_id}/smart/test/abort: Abort a running SMART self-test.
@@ -65,6 +66,7 @@ func (h *SmartHandler) RegisterSmartHandlers(api huma.API) {
 	huma.Get(api, "/disk/{disk_id}/smart/info", h.GetSmartInfo, huma.OperationTags("disk"))
 	huma.Get(api, "/disk/{disk_id}/smart/status", h.GetSmartStatus, huma.OperationTags("disk"))
 	huma.Get(api, "/disk/{disk_id}/smart/health", h.GetSmartHealth, huma.OperationTags("disk"))
+	huma.Get(api, "/disk/{disk_id}/smart/prediction", h.GetSmartPrediction, huma.OperationTags("disk"))
 	huma.Get(api, "/disk/{disk_id}/smart/test", h.GetSmartTestStatus, huma.OperationTags("disk"))
 	huma.Post(api, "/disk/{disk_id}/smart/test/start", h.StartSmartTest, huma.OperationTags("disk"))
 	huma.Post(api, "/disk/{disk_id}/smart/test/abort", h.AbortSmartTest, huma.OperationTags("disk"))
@@ -141,6 +143,29 @@ func (h *SmartHandler) GetSmartHealth(ctx context.Context, input *struct {
 	return &struct{ Body *dto.SmartHealthStatus }{Body: healthStatus}, nil
 }
 
+// GetSmartPrediction retrieves the trend analysis of the SMART attributes of a
+// specific disk
+func (h *SmartHandler) GetSmartPrediction(ctx context.Context, input *struct {
+	DiskID string `path:"disk_id" required:"true" doc:"The disk ID or device path"`
+}) (*struct{ Body *dto.SmartPrediction }, error) {
+	if err := h.ensureSmartIntegrationEnabled(ctx); err != nil {
+		return nil, err
+	}
+
+	prediction, errE := h.smartService.GetSmartPrediction(ctx, input.DiskID)
+	if errE != nil {
+		if errors.Is(errE, dto.ErrorSMARTNotSupported) {
+			return nil, huma.Error406NotAcceptable("SMART not supported on this device", errE)
+		} else if errors.Is(errE, dto.ErrorNotFound) {
+			return nil, huma.Error404NotFound("No SMART data read for this disk", errE)
+		}
+		tlog.ErrorContext(ctx, "Failed to get SMART prediction", "device", input.DiskID, "error", errE)
+		return nil, huma.Error500InternalServerError("Failed to get SMART prediction", errE)
+	}
+
+	return &struct{ Body *dto.SmartPrediction }{Body: prediction}, nil
+}
+
 // GetSmartTestStatus retrieves the status of a SMART self-test for a specific disk
 func (h *SmartHandler) GetSmartTestStatus(ctx context.Context, input *struct {
 	DiskID string `path:"disk_id" required:"true" doc:"The disk ID or device path"`
@@ -186,6 +186,47 @@ func (suite *SmartHandlerSuite) TestGetSmartHealthSuccess() {
 	_, _ = mock.Verify(suite.mockSmartSvc, matchers.Times(1)).GetHealthStatus(mock.Any[context.Context](), mock.Exact(diskID))
 }
 
+func (suite *SmartHandlerSuite) TestGetSmartPredictionSuccess() {
+	wear := 85
+	prediction := &dto.SmartPrediction{
+		DiskId:   "sda",
+		Severity: dto.ProblemSeverities.PROBLEMSEVERITYWARNING,
+		Findings: []dto.SmartFinding{{
+			Attribute: "wear",
+			Value:     85,
+			Severity:  dto.ProblemSeverities.PROBLEMSEVERITYWARNING,
+			Message:   "the SSD used 85% of its rated endurance",
+		}},
+		WearPercent: &wear,
+	}
+	mock.When(suite.mockSmartSvc.GetSmartPrediction(mock.Any[context.Context](), mock.Exact("sda"))).ThenReturn(prediction, nil)
+
+	_, apiInst := humatest.New(suite.T())
+	suite.handler.RegisterSmartHandlers(apiInst)
+
+	resp := apiInst.Get("/disk/sda/smart/prediction")
+	suite.Require().Equal(http.StatusOK, resp.Code)
+
+	var out dto.SmartPrediction
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &out))
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYWARNING, out.Severity)
+	suite.Require().Len(out.Findings, 1)
+	suite.Equal("wear", out.Findings[0].Attribute)
+	suite.Require().NotNil(out.WearPercent)
+	suite.Equal(85, *out.WearPercent)
+}
+
+func (suite *SmartHandlerSuite) TestGetSmartPredictionNotRead() {
+	mock.When(suite.mockSmartSvc.GetSmartPrediction(mock.Any[context.Context](), mock.Exact("sdb"))).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorNotFound, "disk", "sdb"))
+
+	_, apiInst := humatest.New(suite.T())
+	suite.handler.RegisterSmartHandlers(apiInst)
+
+	resp := apiInst.Get("/disk/sdb/smart/prediction")
+	suite.Equal(http.StatusNotFound, resp.Code)
+}
+
 func (suite *SmartHandlerSuite) TestGetSmartTestStatusSuccess() {
 	diskID := "sda"
 	devicePath := "/dev/sda"
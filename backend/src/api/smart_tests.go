@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type SmartTestHandler struct {
+	smartTestService service.SmartTestServiceInterface
+}
+
+func NewSmartTestHandler(
+	smartTestService service.SmartTestServiceInterface,
+) *SmartTestHandler {
+	p := new(SmartTestHandler)
+	p.smartTestService = smartTestService
+	return p
+}
+
+func (self *SmartTestHandler) RegisterSmartTestHandler(api huma.API) {
+	huma.Get(api, "/disk/{disk_id}/smart/schedule", self.GetSchedule, huma.OperationTags("disk"))
+	huma.Put(api, "/disk/{disk_id}/smart/schedule", self.SetSchedule, huma.OperationTags("disk"))
+	huma.Get(api, "/disk/{disk_id}/smart/test/history", self.ListResults, huma.OperationTags("disk"))
+}
+
+// GetSchedule returns when the SMART self-tests of a disk run. A disk never
+// scheduled gets the disabled defaults: short daily, long monthly.
+func (self *SmartTestHandler) GetSchedule(ctx context.Context, input *struct {
+	DiskID string `path:"disk_id" required:"true" doc:"The disk ID or device path"`
+}) (*struct{ Body dto.SmartTestSchedule }, error) {
+	schedule, err := self.smartTestService.GetSchedule(input.DiskID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the SMART test schedule of %s", input.DiskID)
+	}
+	return &struct{ Body dto.SmartTestSchedule }{Body: *schedule}, nil
+}
+
+// SetSchedule stores the SMART self-test schedule of a disk. It returns 422
+// when a cron expression is not valid.
+func (self *SmartTestHandler) SetSchedule(ctx context.Context, input *struct {
+	DiskID string                `path:"disk_id" required:"true" doc:"The disk ID or device path"`
+	Body   dto.SmartTestSchedule `required:"true"`
+}) (*struct{ Body dto.SmartTestSchedule }, error) {
+	schedule, err := self.smartTestService.SetSchedule(input.DiskID, input.Body)
+	if err != nil {
+		if errors.Is(err, dto.ErrorInvalidParameter) {
+			details := errors.AllDetails(err)
+			if reason, ok := details["reason"].(string); ok {
+				return nil, huma.Error422UnprocessableEntity(err.Error() + ": " + reason)
+			}
+			return nil, huma.Error422UnprocessableEntity(err.Error())
+		}
+		return nil, errors.Wrapf(err, "failed to set the SMART test schedule of %s", input.DiskID)
+	}
+	return &struct{ Body dto.SmartTestSchedule }{Body: *schedule}, nil
+}
+
+// ListResults returns the completed SMART self-tests of a disk, newest first.
+func (self *SmartTestHandler) ListResults(ctx context.Context, input *struct {
+	DiskID string `path:"disk_id" required:"true" doc:"The disk ID or device path"`
+	Limit  int    `query:"limit" minimum:"0" maximum:"100" doc:"Number of results, all the kept ones when 0"`
+}) (*struct{ Body []dto.SmartTestResult }, error) {
+	results, err := self.smartTestService.ListResults(input.DiskID, input.Limit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the SMART self-tests of %s", input.DiskID)
+	}
+	return &struct{ Body []dto.SmartTestResult }{Body: results}, nil
+}
@@ -0,0 +1,134 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type SmartTestHandlerSuite struct {
+	suite.Suite
+	app           *fxtest.App
+	handler       *api.SmartTestHandler
+	mockSmartTest service.SmartTestServiceInterface
+	ctx           context.Context
+	cancel        context.CancelFunc
+}
+
+func TestSmartTestHandlerSuite(t *testing.T) {
+	suite.Run(t, new(SmartTestHandlerSuite))
+}
+
+func (suite *SmartTestHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewSmartTestHandler,
+			mock.Mock[service.SmartTestServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockSmartTest),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *SmartTestHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *SmartTestHandlerSuite) TestGetSchedule() {
+	mock.When(suite.mockSmartTest.GetSchedule(mock.Exact("sda"))).ThenReturn(&dto.SmartTestSchedule{
+		DiskId:        "sda",
+		ShortSchedule: dto.SmartTestDefaultShortSchedule,
+		LongSchedule:  dto.SmartTestDefaultLongSchedule,
+	}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSmartTestHandler(api)
+
+	resp := api.Get("/disk/sda/smart/schedule")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var schedule dto.SmartTestSchedule
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &schedule))
+	suite.False(schedule.Enabled)
+	suite.Equal(dto.SmartTestDefaultLongSchedule, schedule.LongSchedule)
+}
+
+func (suite *SmartTestHandlerSuite) TestSetSchedule() {
+	captor := mock.Captor[dto.SmartTestSchedule]()
+	mock.When(suite.mockSmartTest.SetSchedule(mock.Exact("sda"), captor.Capture())).ThenAnswer(func(args []any) []any {
+		schedule := args[1].(dto.SmartTestSchedule)
+		schedule.DiskId = args[0].(string)
+		return []any{&schedule, nil}
+	})
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSmartTestHandler(api)
+
+	resp := api.Put("/disk/sda/smart/schedule", map[string]any{
+		"enabled":        true,
+		"short_schedule": "0 4 * * *",
+		"group":          "usb-hub-1",
+	})
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	suite.True(captor.Last().Enabled)
+	suite.Equal("0 4 * * *", captor.Last().ShortSchedule)
+	suite.Equal("usb-hub-1", captor.Last().Group)
+}
+
+func (suite *SmartTestHandlerSuite) TestSetScheduleInvalid() {
+	mock.When(suite.mockSmartTest.SetSchedule(mock.Any[string](), mock.Any[dto.SmartTestSchedule]())).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorInvalidParameter, "reason", "invalid cron expression"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSmartTestHandler(api)
+
+	resp := api.Put("/disk/sda/smart/schedule", map[string]any{"enabled": true, "short_schedule": "every day"})
+	suite.Equal(http.StatusUnprocessableEntity, resp.Code)
+}
+
+func (suite *SmartTestHandlerSuite) TestListResults() {
+	lba := "123456"
+	mock.When(suite.mockSmartTest.ListResults(mock.Exact("sda"), mock.Exact(5))).ThenReturn([]dto.SmartTestResult{{
+		ID:              2,
+		DiskId:          "sda",
+		TestType:        dto.SmartTestTypes.SMARTTESTTYPELONG,
+		Trigger:         dto.JobTriggerSchedule,
+		Outcome:         dto.SmartTestOutcomeFailed,
+		LBAOfFirstError: lba,
+	}}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSmartTestHandler(api)
+
+	resp := api.Get("/disk/sda/smart/test/history?limit=5")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var results []dto.SmartTestResult
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &results))
+	suite.Require().Len(results, 1)
+	suite.Equal(dto.SmartTestOutcomeFailed, results[0].Outcome)
+	suite.Equal(lba, results[0].LBAOfFirstError)
+}
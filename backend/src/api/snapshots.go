@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type SnapshotHandler struct {
+	snapshotService service.SnapshotServiceInterface
+}
+
+func NewSnapshotHandler(
+	snapshotService service.SnapshotServiceInterface,
+) *SnapshotHandler {
+	p := new(SnapshotHandler)
+	p.snapshotService = snapshotService
+	return p
+}
+
+func (self *SnapshotHandler) RegisterSnapshotHandler(api huma.API) {
+	huma.Get(api, "/share/{share_name}/snapshots", self.ListSnapshots, huma.OperationTags("share"))
+	huma.Post(api, "/share/{share_name}/snapshot", self.CreateSnapshot, huma.OperationTags("share"))
+	huma.Delete(api, "/share/{share_name}/snapshot/{snapshot_name}", self.DeleteSnapshot, huma.OperationTags("share"))
+	huma.Post(api, "/share/{share_name}/snapshot/{snapshot_name}/rollback", self.RollbackSnapshot, huma.OperationTags("share"))
+}
+
+// snapshotError maps snapshot service errors to API errors.
+func snapshotError(err errors.E, format string, args ...any) error {
+	if errors.Is(err, dto.ErrorShareNotFound) || errors.Is(err, dto.ErrorSnapshotNotFound) {
+		return huma.Error404NotFound(err.Error())
+	}
+	if errors.Is(err, dto.ErrorConflict) {
+		return huma.Error409Conflict(err.Error())
+	}
+	if errors.Is(err, dto.ErrorSnapshotNotSupported) || errors.Is(err, dto.ErrorShareValidation) ||
+		errors.Is(err, dto.ErrorInvalidStateForOperation) {
+		return huma.Error422UnprocessableEntity(err.Error())
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+func (self *SnapshotHandler) ListSnapshots(ctx context.Context, input *struct {
+	ShareName string `path:"share_name" maxLength:"128" example:"world" doc:"Name of the share"`
+}) (*struct{ Body []dto.Snapshot }, error) {
+	snapshots, err := self.snapshotService.ListSnapshots(input.ShareName)
+	if err != nil {
+		return nil, snapshotError(err, "failed to list snapshots of share %s", input.ShareName)
+	}
+	return &struct{ Body []dto.Snapshot }{Body: snapshots}, nil
+}
+
+func (self *SnapshotHandler) CreateSnapshot(ctx context.Context, input *struct {
+	ShareName string `path:"share_name" maxLength:"128" example:"world" doc:"Name of the share"`
+}) (*struct {
+	Status int
+	Body   dto.Snapshot
+}, error) {
+	snapshot, err := self.snapshotService.CreateSnapshot(input.ShareName)
+	if err != nil {
+		return nil, snapshotError(err, "failed to snapshot share %s", input.ShareName)
+	}
+	return &struct {
+		Status int
+		Body   dto.Snapshot
+	}{Status: http.StatusCreated, Body: *snapshot}, nil
+}
+
+func (self *SnapshotHandler) DeleteSnapshot(ctx context.Context, input *struct {
+	ShareName    string `path:"share_name" maxLength:"128" example:"world" doc:"Name of the share"`
+	SnapshotName string `path:"snapshot_name" maxLength:"64" example:"GMT-2026.01.31-18.00.00" doc:"Name of the snapshot"`
+}) (*struct{}, error) {
+	if err := self.snapshotService.DeleteSnapshot(input.ShareName, input.SnapshotName); err != nil {
+		return nil, snapshotError(err, "failed to delete snapshot %s of share %s", input.SnapshotName, input.ShareName)
+	}
+	return &struct{}{}, nil
+}
+
+// RollbackSnapshot restores the share to the content of the snapshot. Changes
+// made after the snapshot are lost. It returns 409 when the rollback would
+// destroy newer snapshots, unless destroy_newer is set.
+func (self *SnapshotHandler) RollbackSnapshot(ctx context.Context, input *struct {
+	ShareName    string `path:"share_name" maxLength:"128" example:"world" doc:"Name of the share"`
+	SnapshotName string `path:"snapshot_name" maxLength:"64" example:"GMT-2026.01.31-18.00.00" doc:"Name of the snapshot"`
+	DestroyNewer bool   `query:"destroy_newer" default:"false" doc:"Destroy the snapshots newer than this one when the filesystem requires it"`
+}) (*struct{}, error) {
+	if err := self.snapshotService.RollbackSnapshot(input.ShareName, input.SnapshotName, input.DestroyNewer); err != nil {
+		return nil, snapshotError(err, "failed to roll back share %s to %s", input.ShareName, input.SnapshotName)
+	}
+	return &struct{}{}, nil
+}
@@ -0,0 +1,123 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type SnapshotHandlerSuite struct {
+	suite.Suite
+	app                 *fxtest.App
+	handler             *api.SnapshotHandler
+	mockSnapshotService service.SnapshotServiceInterface
+	ctx                 context.Context
+	cancel              context.CancelFunc
+}
+
+func TestSnapshotHandlerSuite(t *testing.T) {
+	suite.Run(t, new(SnapshotHandlerSuite))
+}
+
+func (suite *SnapshotHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewSnapshotHandler,
+			mock.Mock[service.SnapshotServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockSnapshotService),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *SnapshotHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *SnapshotHandlerSuite) TestCreateSnapshotCreated() {
+	created := time.Date(2026, 1, 31, 18, 0, 0, 0, time.UTC)
+	snapshot := &dto.Snapshot{Name: dto.SnapshotName(created), CreatedAt: created, Path: "/mnt/data/.snapshots/GMT-2026.01.31-18.00.00"}
+	mock.When(suite.mockSnapshotService.CreateSnapshot("data")).ThenReturn(snapshot, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSnapshotHandler(api)
+
+	resp := api.Post("/share/data/snapshot")
+	suite.Require().Equal(http.StatusCreated, resp.Code)
+
+	var result dto.Snapshot
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Equal("GMT-2026.01.31-18.00.00", result.Name)
+}
+
+func (suite *SnapshotHandlerSuite) TestListSnapshots() {
+	mock.When(suite.mockSnapshotService.ListSnapshots("data")).ThenReturn([]dto.Snapshot{{Name: "GMT-2026.01.31-18.00.00"}}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSnapshotHandler(api)
+
+	resp := api.Get("/share/data/snapshots")
+	suite.Require().Equal(http.StatusOK, resp.Code)
+
+	var result []dto.Snapshot
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &result))
+	suite.Len(result, 1)
+}
+
+func (suite *SnapshotHandlerSuite) TestSnapshotErrors() {
+	cases := []struct {
+		snapshot string
+		err      error
+		code     int
+	}{
+		{"GMT-2020.01.01-00.00.00", dto.ErrorSnapshotNotFound, http.StatusNotFound},
+		{"GMT-2020.01.02-00.00.00", dto.ErrorSnapshotNotSupported, http.StatusUnprocessableEntity},
+		{"GMT-2020.01.03-00.00.00", errors.New("boom"), http.StatusInternalServerError},
+		{"GMT-2020.01.04-00.00.00", dto.ErrorConflict, http.StatusConflict},
+	}
+	for _, tc := range cases {
+		mock.When(suite.mockSnapshotService.RollbackSnapshot("data", tc.snapshot, false)).ThenReturn(errors.WithStack(tc.err))
+
+		_, api := humatest.New(suite.T())
+		suite.handler.RegisterSnapshotHandler(api)
+
+		resp := api.Post("/share/data/snapshot/" + tc.snapshot + "/rollback")
+		suite.Equal(tc.code, resp.Code, "error %v", tc.err)
+	}
+}
+
+func (suite *SnapshotHandlerSuite) TestRollbackSnapshot_DestroyNewer() {
+	mock.When(suite.mockSnapshotService.RollbackSnapshot("data", "GMT-2026.01.31-18.00.00", true)).ThenReturn(nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterSnapshotHandler(api)
+
+	resp := api.Post("/share/data/snapshot/GMT-2026.01.31-18.00.00/rollback?destroy_newer=true")
+	suite.Equal(http.StatusNoContent, resp.Code, resp.Body.String())
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service"
+	"gitlab.com/tozd/go/errors"
+)
+
+type StatsHistoryHandler struct {
+	statsHistory service.StatsHistoryServiceInterface
+}
+
+func NewStatsHistoryHandler(
+	statsHistory service.StatsHistoryServiceInterface,
+) *StatsHistoryHandler {
+	p := new(StatsHistoryHandler)
+	p.statsHistory = statsHistory
+	return p
+}
+
+func (self *StatsHistoryHandler) RegisterStatsHistoryHandler(api huma.API) {
+	huma.Get(api, "/stats/history", self.GetStatsHistory, huma.OperationTags("system"))
+}
+
+// GetStatsHistory returns the stored history of a disk, network or SMART
+// metric, one series per disk, interface or SMART attribute.
+func (self *StatsHistoryHandler) GetStatsHistory(ctx context.Context, input *struct {
+	Metric string    `query:"metric" required:"true" enum:"disk_read_iops,disk_write_iops,disk_read_latency_ms,disk_write_latency_ms,network_receive_bytes_per_second,network_transmit_bytes_per_second,smart_temperature_celsius,smart_power_on_hours,smart_power_cycles,smart_attribute"`
+	Series string    `query:"series" doc:"Only this disk id, network interface or disk id/SMART attribute"`
+	From   time.Time `query:"from" doc:"Start of the history, 24 hours before to when not set"`
+	To     time.Time `query:"to" doc:"End of the history, now when not set"`
+	Step   int64     `query:"step" minimum:"0" doc:"Seconds between two points, picked from the time range when 0"`
+}) (*struct{ Body []dto.StatsSeries }, error) {
+	history, err := self.statsHistory.History(ctx, dto.StatsHistoryQuery{
+		Metric: input.Metric,
+		Series: input.Series,
+		From:   input.From,
+		To:     input.To,
+		Step:   time.Duration(input.Step) * time.Second,
+	})
+	if err != nil {
+		if errors.Is(err, dto.ErrorInvalidParameter) {
+			details := errors.AllDetails(err)
+			if reason, ok := details["reason"].(string); ok {
+				return nil, huma.Error422UnprocessableEntity(err.Error() + ": " + reason)
+			}
+			return nil, huma.Error422UnprocessableEntity(err.Error())
+		}
+		return nil, errors.Wrap(err, "failed to read the statistics history")
+	}
+	return &struct{ Body []dto.StatsSeries }{Body: history}, nil
+}
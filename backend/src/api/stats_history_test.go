@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/dianlight/srat/api"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type StatsHistoryHandlerSuite struct {
+	suite.Suite
+	app              *fxtest.App
+	handler          *api.StatsHistoryHandler
+	mockStatsHistory service.StatsHistoryServiceInterface
+	ctx              context.Context
+	cancel           context.CancelFunc
+}
+
+func TestStatsHistoryHandlerSuite(t *testing.T) {
+	suite.Run(t, new(StatsHistoryHandlerSuite))
+}
+
+func (suite *StatsHistoryHandlerSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.WithValue(context.Background(), ctxkeys.WaitGroup, &sync.WaitGroup{}))
+			},
+			api.NewStatsHistoryHandler,
+			mock.Mock[service.StatsHistoryServiceInterface],
+		),
+		fx.Populate(&suite.handler),
+		fx.Populate(&suite.mockStatsHistory),
+		fx.Populate(&suite.ctx),
+		fx.Populate(&suite.cancel),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *StatsHistoryHandlerSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+		suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup).Wait()
+	}
+	suite.app.RequireStop()
+}
+
+func (suite *StatsHistoryHandlerSuite) TestGetStatsHistory() {
+	from := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	query := mock.Captor[dto.StatsHistoryQuery]()
+	mock.When(suite.mockStatsHistory.History(mock.AnyContext(), query.Capture())).ThenReturn([]dto.StatsSeries{{
+		Metric: dto.StatsSmartTemperature,
+		Series: "sda",
+		Step:   3600,
+		Points: []dto.StatsPoint{{Time: from, Avg: 38.5, Min: 30, Max: 47}},
+	}}, nil)
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterStatsHistoryHandler(api)
+
+	resp := api.Get("/stats/history?metric=smart_temperature_celsius&series=sda&from=2026-02-01T00:00:00Z&step=3600")
+	suite.Require().Equal(http.StatusOK, resp.Code, resp.Body.String())
+	var history []dto.StatsSeries
+	suite.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &history))
+	suite.Require().Len(history, 1)
+	suite.Equal("sda", history[0].Series)
+	suite.Require().Len(history[0].Points, 1)
+	suite.Equal(38.5, history[0].Points[0].Avg)
+
+	suite.Equal(dto.StatsHistoryQuery{
+		Metric: dto.StatsSmartTemperature,
+		Series: "sda",
+		From:   from,
+		Step:   time.Hour,
+	}, query.Last())
+}
+
+func (suite *StatsHistoryHandlerSuite) TestGetStatsHistoryInvalid() {
+	mock.When(suite.mockStatsHistory.History(mock.AnyContext(), mock.Any[dto.StatsHistoryQuery]())).
+		ThenReturn(nil, errors.WithDetails(dto.ErrorInvalidParameter, "reason", "step is too small for the time range"))
+
+	_, api := humatest.New(suite.T())
+	suite.handler.RegisterStatsHistoryHandler(api)
+
+	suite.Equal(http.StatusUnprocessableEntity, api.Get("/stats/history?metric=disk_read_iops&step=1").Code)
+	suite.Equal(http.StatusUnprocessableEntity, api.Get("/stats/history?metric=cpu_usage").Code)
+	suite.Equal(http.StatusUnprocessableEntity, api.Get("/stats/history").Code)
+}
@@ -92,10 +92,26 @@ func main() {
 		fx.Provide(
 			server.AsHumaRoute(api.NewHealthHandler),
 			server.AsHumaRoute(api.NewShareHandler),
+			server.AsHumaRoute(api.NewSharePermissionHandler),
+			server.AsHumaRoute(api.NewSnapshotHandler),
+			server.AsHumaRoute(api.NewRecycleBinHandler),
+			server.AsHumaRoute(api.NewJobHandler),
+			server.AsHumaRoute(api.NewAuditHandler),
+			server.AsHumaRoute(api.NewIntrusionHandler),
+			server.AsHumaRoute(api.NewMetricsHandler),
+			server.AsHumaRoute(api.NewStatsHistoryHandler),
+			server.AsHumaRoute(api.NewSmartTestHandler),
+			server.AsHumaRoute(api.NewMQTTHandler),
+			server.AsHumaRoute(api.NewLuksHandler),
+			server.AsHumaRoute(api.NewRaidHandler),
+			server.AsHumaRoute(api.NewLvmHandler),
+			server.AsHumaRoute(api.NewPoolHandler),
+			server.AsHumaRoute(api.NewRemoteMountHandler),
 			server.AsHumaRoute(api.NewVolumeHandler),
 			server.AsHumaRoute(api.NewSmartHandler),
 			server.AsHumaRoute(api.NewSettingsHanler),
 			server.AsHumaRoute(api.NewUserHandler),
+			server.AsHumaRoute(api.NewGroupHandler),
 			server.AsHumaRoute(api.NewSambaHanler),
 			server.AsHumaRoute(api.NewUpgradeHanler),
 			server.AsHumaRoute(api.NewSystemHanler),
@@ -41,6 +41,8 @@ var roMode *bool
 
 // var updateFilePath *string
 var upgradeDataDir *string
+var luksKeyDir *string
+var remoteCredsDir *string
 var dbfile *string
 var supervisorURL *string
 var supervisorToken *string
@@ -79,6 +81,8 @@ func main() {
 	logLevelString = flag.String("loglevel", "info", "Log level string (debug, info, warn, error)")
 	upgradeChannel := flag.String("update-channel", "release", "Upgrade channel (release, prerelease, develop)")
 	upgradeDataDir = flag.String("upgrade-data-dir", "/data/upgrade", "Persistent upgrades data directory")
+	luksKeyDir = flag.String("luks-key-dir", "/data/luks", "Directory of the keyfiles unlocking LUKS volumes at startup")
+	remoteCredsDir = flag.String("remote-creds-dir", "/data/remote", "Directory of the credentials of the CIFS remote mounts")
 	_ = flag.String("update-file-path", os.TempDir()+"/"+filepath.Base(os.Args[0]), "Update file path - used for addon updates *deprecated*")
 	addonIpAddress = flag.String("ip-address", "127.0.0.1", "Addon IP address // $(bashio::addon.ip_address)")
 	noIPv6 = flag.Bool("ipv4-only", false, "Disable IPv6 addresses in Samba interface binding")
@@ -150,6 +154,8 @@ func prog(listener net.Listener, serverPort int) {
 		//UpdateFilePath:  *updateFilePath,
 		UpdateChannel:   upgrade_channel,
 		UpdateDataDir:   *upgradeDataDir,
+		LuksKeyDir:      *luksKeyDir,
+		RemoteCredsDir:  *remoteCredsDir,
 		AutoUpdate:      *autoUpdate,
 		DisableIPv6:     *noIPv6,
 		SambaConfigFile: *smbConfigFile,
@@ -184,10 +190,26 @@ func prog(listener net.Listener, serverPort int) {
 			api.NewWebSocketBroker,
 			server.AsHumaRoute(api.NewHealthHandler),
 			server.AsHumaRoute(api.NewShareHandler),
+			server.AsHumaRoute(api.NewSharePermissionHandler),
+			server.AsHumaRoute(api.NewSnapshotHandler),
+			server.AsHumaRoute(api.NewRecycleBinHandler),
+			server.AsHumaRoute(api.NewJobHandler),
+			server.AsHumaRoute(api.NewAuditHandler),
+			server.AsHumaRoute(api.NewIntrusionHandler),
+			server.AsHumaRoute(api.NewMetricsHandler),
+			server.AsHumaRoute(api.NewStatsHistoryHandler),
+			server.AsHumaRoute(api.NewSmartTestHandler),
+			server.AsHumaRoute(api.NewMQTTHandler),
+			server.AsHumaRoute(api.NewLuksHandler),
+			server.AsHumaRoute(api.NewRaidHandler),
+			server.AsHumaRoute(api.NewLvmHandler),
+			server.AsHumaRoute(api.NewPoolHandler),
+			server.AsHumaRoute(api.NewRemoteMountHandler),
 			server.AsHumaRoute(api.NewVolumeHandler),
 			server.AsHumaRoute(api.NewSmartHandler),
 			server.AsHumaRoute(api.NewSettingsHanler),
 			server.AsHumaRoute(api.NewUserHandler),
+			server.AsHumaRoute(api.NewGroupHandler),
 			server.AsHumaRoute(api.NewSambaHanler),
 			server.AsHumaRoute(api.NewUpgradeHanler),
 			server.AsHumaRoute(api.NewSystemHanler),
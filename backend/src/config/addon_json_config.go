@@ -10,18 +10,62 @@ import (
 )
 
 type Share struct {
-	Name               string   `json:"name,omitempty"`
-	Path               string   `json:"path"`
-	FS                 string   `json:"fs"`
-	Disabled           bool     `json:"disabled,omitempty"`
-	Users              []string `json:"users,omitempty"`
-	RoUsers            []string `json:"ro_users,omitempty"`
-	TimeMachine        bool     `json:"timemachine,omitempty"`
-	RecycleBin         *bool    `json:"recycle_bin_enabled,omitempty"`
-	GuestOk            *bool    `json:"guest_ok,omitempty"`
-	TimeMachineMaxSize *string  `json:"timemachine_max_size,omitempty"`
-	Usage              string   `json:"usage,omitempty"`
-	VetoFiles          []string `json:"veto_files,omitempty"`
+	Name               string            `json:"name,omitempty"`
+	Path               string            `json:"path"`
+	SubPath            string            `json:"sub_path,omitempty"`
+	FS                 string            `json:"fs"`
+	Disabled           bool              `json:"disabled,omitempty"`
+	Users              []string          `json:"users,omitempty"`
+	RoUsers            []string          `json:"ro_users,omitempty"`
+	Groups             []string          `json:"groups,omitempty"`
+	RoGroups           []string          `json:"ro_groups,omitempty"`
+	TimeMachine        bool              `json:"timemachine,omitempty"`
+	RecycleBin         *bool             `json:"recycle_bin_enabled,omitempty"`
+	GuestOk            *bool             `json:"guest_ok,omitempty"`
+	TimeMachineMaxSize *string           `json:"timemachine_max_size,omitempty"`
+	Usage              string            `json:"usage,omitempty"`
+	VetoFiles          []string          `json:"veto_files,omitempty"`
+	SmbEncrypt         string            `json:"smb_encrypt,omitempty"`
+	SmbSigning         string            `json:"smb_signing,omitempty"`
+	SmbMinProtocol     string            `json:"smb_min_protocol,omitempty"`
+	Permissions        *SharePermissions `json:"permissions,omitempty"`
+	QuotaBytes         *uint64           `json:"quota_bytes,omitempty"`
+	UserQuotas         []UserQuota       `json:"user_quotas,omitempty"`
+	Snapshots          *SnapshotPolicy   `json:"snapshots,omitempty"`
+	RecycleBinPolicy   *RecycleBinPolicy `json:"recycle_bin_policy,omitempty"`
+	Audit              *ShareAudit       `json:"audit,omitempty"`
+}
+
+type ShareAudit struct {
+	Enabled     bool     `json:"enabled"`
+	Operations  []string `json:"operations,omitempty"`
+	LogFailures bool     `json:"log_failures,omitempty"`
+}
+
+type RecycleBinPolicy struct {
+	MaxAgeDays   uint     `json:"max_age_days,omitempty"`
+	MaxSizeBytes uint64   `json:"max_size_bytes,omitempty"`
+	Exclude      []string `json:"exclude,omitempty"`
+}
+
+type SnapshotPolicy struct {
+	ShadowCopy bool `json:"shadow_copy,omitempty"`
+	KeepHourly uint `json:"keep_hourly,omitempty"`
+	KeepDaily  uint `json:"keep_daily,omitempty"`
+	KeepWeekly uint `json:"keep_weekly,omitempty"`
+}
+
+type UserQuota struct {
+	Username   string `json:"username"`
+	LimitBytes uint64 `json:"limit_bytes"`
+}
+
+type SharePermissions struct {
+	Owner       string `json:"owner,omitempty"`
+	Group       string `json:"group,omitempty"`
+	FileMode    string `json:"file_mode,omitempty"`
+	DirMode     string `json:"dir_mode,omitempty"`
+	InheritAcls bool   `json:"inherit_acls,omitempty"`
 }
 
 type Shares map[string]Share
@@ -92,6 +136,21 @@ type Config struct {
 	// Samba service. UseComponentMDNSProxy selects the implementation.
 	MDNSRegistration      bool `json:"mdns_registration,omitempty" default:"false"`
 	UseComponentMDNSProxy bool `json:"use_component_mdns_proxy,omitempty" default:"true"`
+	// Homes renders the [homes] share, nil when home directories are disabled.
+	Homes *Homes `json:"homes,omitempty"`
+	// AuditLogFile is where vfs_full_audit logs the operations of the
+	// audited shares, empty when no share is audited.
+	AuditLogFile string `json:"audit_log_file,omitempty"`
+	// AuthLogFile is where smbd logs the authentications checked by
+	// intrusion protection, empty when it is disabled.
+	AuthLogFile string `json:"auth_log_file,omitempty"`
+	// BannedHosts are the client addresses refused by intrusion protection.
+	BannedHosts []string `json:"banned_hosts,omitempty"`
+}
+
+type Homes struct {
+	// Path is the directory holding one home directory per user.
+	Path string `json:"path"`
 }
 
 // ReadConfigBuffer reads and parses a configuration file.
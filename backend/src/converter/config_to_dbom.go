@@ -10,6 +10,8 @@ import (
 // goverter:output:package github.com/dianlight/srat/converter
 // goverter:extend StringToSambaUser
 // goverter:extend SambaUserToString
+// goverter:extend StringToSambaGroup
+// goverter:extend SambaGroupToString
 // goverter:update:ignoreZeroValueField
 // goverter:useZeroValueOnPointerInconsistency
 // goverter:default:update
@@ -47,3 +49,11 @@ func StringToSambaUser(username string, users *dbom.SambaUsers) (dbom.SambaUser,
 func SambaUserToString(user dbom.SambaUser) string {
 	return user.Username
 }
+
+func StringToSambaGroup(name string) dbom.SambaGroup {
+	return dbom.SambaGroup{Name: name}
+}
+
+func SambaGroupToString(group dbom.SambaGroup) string {
+	return group.Name
+}
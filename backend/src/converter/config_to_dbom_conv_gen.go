@@ -19,6 +19,9 @@ func (c *ConfigToDbomConverterImpl) ExportedShareToShare(source dbom.ExportedSha
 	if source.MountPointData.Path != "" {
 		target.Path = source.MountPointData.Path
 	}
+	if source.SubPath != "" {
+		target.SubPath = source.SubPath
+	}
 	if source.MountPointData.FSType != "" {
 		target.FS = source.MountPointData.FSType
 	}
@@ -37,6 +40,18 @@ func (c *ConfigToDbomConverterImpl) ExportedShareToShare(source dbom.ExportedSha
 			target.RoUsers[j] = SambaUserToString(source.RoUsers[j])
 		}
 	}
+	if source.Groups != nil {
+		target.Groups = make([]string, len(source.Groups))
+		for k := 0; k < len(source.Groups); k++ {
+			target.Groups[k] = SambaGroupToString(source.Groups[k])
+		}
+	}
+	if source.RoGroups != nil {
+		target.RoGroups = make([]string, len(source.RoGroups))
+		for l := 0; l < len(source.RoGroups); l++ {
+			target.RoGroups[l] = SambaGroupToString(source.RoGroups[l])
+		}
+	}
 	if source.TimeMachine != false {
 		target.TimeMachine = source.TimeMachine
 	}
@@ -56,6 +71,29 @@ func (c *ConfigToDbomConverterImpl) ExportedShareToShare(source dbom.ExportedSha
 		target.Usage = string(source.Usage)
 	}
 	target.VetoFiles = c.datatypesJSONSliceToStringList(source.VetoFiles)
+	if source.SmbEncrypt != "" {
+		target.SmbEncrypt = string(source.SmbEncrypt)
+	}
+	if source.SmbSigning != "" {
+		target.SmbSigning = string(source.SmbSigning)
+	}
+	if source.SmbMinProtocol != "" {
+		target.SmbMinProtocol = string(source.SmbMinProtocol)
+	}
+	target.Permissions = c.pDtoSharePermissionsToPConfigSharePermissions(source.Permissions)
+	if source.QuotaBytes != nil {
+		xuint64 := *source.QuotaBytes
+		target.QuotaBytes = &xuint64
+	}
+	if source.UserQuotas != nil {
+		target.UserQuotas = make([]config.UserQuota, len(source.UserQuotas))
+		for m := 0; m < len(source.UserQuotas); m++ {
+			target.UserQuotas[m] = c.dtoUserQuotaToConfigUserQuota(source.UserQuotas[m])
+		}
+	}
+	target.Snapshots = c.pDtoSnapshotPolicyToPConfigSnapshotPolicy(source.Snapshots)
+	target.RecycleBinPolicy = c.pDtoRecycleBinPolicyToPConfigRecycleBinPolicy(source.RecycleBinPolicy)
+	target.Audit = c.pDtoShareAuditToPConfigShareAudit(source.Audit)
 	return nil
 }
 func (c *ConfigToDbomConverterImpl) SambaUserToUser(source dbom.SambaUser, target *config.User) error {
@@ -92,6 +130,18 @@ func (c *ConfigToDbomConverterImpl) ShareToExportedShareNoMountPointPath(source
 			target.RoUsers[j] = dbomSambaUser2
 		}
 	}
+	if source.Groups != nil {
+		target.Groups = make([]dbom.SambaGroup, len(source.Groups))
+		for k := 0; k < len(source.Groups); k++ {
+			target.Groups[k] = StringToSambaGroup(source.Groups[k])
+		}
+	}
+	if source.RoGroups != nil {
+		target.RoGroups = make([]dbom.SambaGroup, len(source.RoGroups))
+		for l := 0; l < len(source.RoGroups); l++ {
+			target.RoGroups[l] = StringToSambaGroup(source.RoGroups[l])
+		}
+	}
 	target.VetoFiles = c.stringListToDatatypesJSONSlice(source.VetoFiles)
 	if source.TimeMachine != false {
 		target.TimeMachine = source.TimeMachine
@@ -108,6 +158,32 @@ func (c *ConfigToDbomConverterImpl) ShareToExportedShareNoMountPointPath(source
 	if source.Usage != "" {
 		target.Usage = dto.HAMountUsage(source.Usage)
 	}
+	if source.SmbEncrypt != "" {
+		target.SmbEncrypt = dto.SmbEncryptMode(source.SmbEncrypt)
+	}
+	if source.SmbSigning != "" {
+		target.SmbSigning = dto.SmbSigningMode(source.SmbSigning)
+	}
+	if source.SmbMinProtocol != "" {
+		target.SmbMinProtocol = dto.SmbProtocol(source.SmbMinProtocol)
+	}
+	target.Permissions = c.pConfigSharePermissionsToPDtoSharePermissions(source.Permissions)
+	if source.QuotaBytes != nil {
+		xuint64 := *source.QuotaBytes
+		target.QuotaBytes = &xuint64
+	}
+	if source.UserQuotas != nil {
+		target.UserQuotas = make([]dto.UserQuota, len(source.UserQuotas))
+		for m := 0; m < len(source.UserQuotas); m++ {
+			target.UserQuotas[m] = c.configUserQuotaToDtoUserQuota(source.UserQuotas[m])
+		}
+	}
+	target.Snapshots = c.pConfigSnapshotPolicyToPDtoSnapshotPolicy(source.Snapshots)
+	target.RecycleBinPolicy = c.pConfigRecycleBinPolicyToPDtoRecycleBinPolicy(source.RecycleBinPolicy)
+	target.Audit = c.pConfigShareAuditToPDtoShareAudit(source.Audit)
+	if source.SubPath != "" {
+		target.SubPath = source.SubPath
+	}
 	if source.Path != "" {
 		pString := source.Path
 		target.MountPointDataPath = &pString
@@ -118,6 +194,12 @@ func (c *ConfigToDbomConverterImpl) ShareToExportedShareNoMountPointPath(source
 	}
 	return nil
 }
+func (c *ConfigToDbomConverterImpl) configUserQuotaToDtoUserQuota(source config.UserQuota) dto.UserQuota {
+	var dtoUserQuota dto.UserQuota
+	dtoUserQuota.Username = source.Username
+	dtoUserQuota.LimitBytes = source.LimitBytes
+	return dtoUserQuota
+}
 func (c *ConfigToDbomConverterImpl) datatypesJSONSliceToStringList(source datatypes.JSONSlice[string]) []string {
 	var stringList []string
 	if source != nil {
@@ -128,6 +210,126 @@ func (c *ConfigToDbomConverterImpl) datatypesJSONSliceToStringList(source dataty
 	}
 	return stringList
 }
+func (c *ConfigToDbomConverterImpl) dtoUserQuotaToConfigUserQuota(source dto.UserQuota) config.UserQuota {
+	var configUserQuota config.UserQuota
+	configUserQuota.Username = source.Username
+	configUserQuota.LimitBytes = source.LimitBytes
+	return configUserQuota
+}
+func (c *ConfigToDbomConverterImpl) pConfigRecycleBinPolicyToPDtoRecycleBinPolicy(source *config.RecycleBinPolicy) *dto.RecycleBinPolicy {
+	var pDtoRecycleBinPolicy *dto.RecycleBinPolicy
+	if source != nil {
+		var dtoRecycleBinPolicy dto.RecycleBinPolicy
+		dtoRecycleBinPolicy.MaxAgeDays = (*source).MaxAgeDays
+		dtoRecycleBinPolicy.MaxSizeBytes = (*source).MaxSizeBytes
+		if (*source).Exclude != nil {
+			dtoRecycleBinPolicy.Exclude = make([]string, len((*source).Exclude))
+			for i := 0; i < len((*source).Exclude); i++ {
+				dtoRecycleBinPolicy.Exclude[i] = (*source).Exclude[i]
+			}
+		}
+		pDtoRecycleBinPolicy = &dtoRecycleBinPolicy
+	}
+	return pDtoRecycleBinPolicy
+}
+func (c *ConfigToDbomConverterImpl) pConfigShareAuditToPDtoShareAudit(source *config.ShareAudit) *dto.ShareAudit {
+	var pDtoShareAudit *dto.ShareAudit
+	if source != nil {
+		var dtoShareAudit dto.ShareAudit
+		dtoShareAudit.Enabled = (*source).Enabled
+		if (*source).Operations != nil {
+			dtoShareAudit.Operations = make([]string, len((*source).Operations))
+			for i := 0; i < len((*source).Operations); i++ {
+				dtoShareAudit.Operations[i] = (*source).Operations[i]
+			}
+		}
+		dtoShareAudit.LogFailures = (*source).LogFailures
+		pDtoShareAudit = &dtoShareAudit
+	}
+	return pDtoShareAudit
+}
+func (c *ConfigToDbomConverterImpl) pConfigSharePermissionsToPDtoSharePermissions(source *config.SharePermissions) *dto.SharePermissions {
+	var pDtoSharePermissions *dto.SharePermissions
+	if source != nil {
+		var dtoSharePermissions dto.SharePermissions
+		dtoSharePermissions.Owner = (*source).Owner
+		dtoSharePermissions.Group = (*source).Group
+		dtoSharePermissions.FileMode = (*source).FileMode
+		dtoSharePermissions.DirMode = (*source).DirMode
+		dtoSharePermissions.InheritAcls = (*source).InheritAcls
+		pDtoSharePermissions = &dtoSharePermissions
+	}
+	return pDtoSharePermissions
+}
+func (c *ConfigToDbomConverterImpl) pConfigSnapshotPolicyToPDtoSnapshotPolicy(source *config.SnapshotPolicy) *dto.SnapshotPolicy {
+	var pDtoSnapshotPolicy *dto.SnapshotPolicy
+	if source != nil {
+		var dtoSnapshotPolicy dto.SnapshotPolicy
+		dtoSnapshotPolicy.ShadowCopy = (*source).ShadowCopy
+		dtoSnapshotPolicy.KeepHourly = (*source).KeepHourly
+		dtoSnapshotPolicy.KeepDaily = (*source).KeepDaily
+		dtoSnapshotPolicy.KeepWeekly = (*source).KeepWeekly
+		pDtoSnapshotPolicy = &dtoSnapshotPolicy
+	}
+	return pDtoSnapshotPolicy
+}
+func (c *ConfigToDbomConverterImpl) pDtoRecycleBinPolicyToPConfigRecycleBinPolicy(source *dto.RecycleBinPolicy) *config.RecycleBinPolicy {
+	var pConfigRecycleBinPolicy *config.RecycleBinPolicy
+	if source != nil {
+		var configRecycleBinPolicy config.RecycleBinPolicy
+		configRecycleBinPolicy.MaxAgeDays = (*source).MaxAgeDays
+		configRecycleBinPolicy.MaxSizeBytes = (*source).MaxSizeBytes
+		if (*source).Exclude != nil {
+			configRecycleBinPolicy.Exclude = make([]string, len((*source).Exclude))
+			for i := 0; i < len((*source).Exclude); i++ {
+				configRecycleBinPolicy.Exclude[i] = (*source).Exclude[i]
+			}
+		}
+		pConfigRecycleBinPolicy = &configRecycleBinPolicy
+	}
+	return pConfigRecycleBinPolicy
+}
+func (c *ConfigToDbomConverterImpl) pDtoShareAuditToPConfigShareAudit(source *dto.ShareAudit) *config.ShareAudit {
+	var pConfigShareAudit *config.ShareAudit
+	if source != nil {
+		var configShareAudit config.ShareAudit
+		configShareAudit.Enabled = (*source).Enabled
+		if (*source).Operations != nil {
+			configShareAudit.Operations = make([]string, len((*source).Operations))
+			for i := 0; i < len((*source).Operations); i++ {
+				configShareAudit.Operations[i] = (*source).Operations[i]
+			}
+		}
+		configShareAudit.LogFailures = (*source).LogFailures
+		pConfigShareAudit = &configShareAudit
+	}
+	return pConfigShareAudit
+}
+func (c *ConfigToDbomConverterImpl) pDtoSharePermissionsToPConfigSharePermissions(source *dto.SharePermissions) *config.SharePermissions {
+	var pConfigSharePermissions *config.SharePermissions
+	if source != nil {
+		var configSharePermissions config.SharePermissions
+		configSharePermissions.Owner = (*source).Owner
+		configSharePermissions.Group = (*source).Group
+		configSharePermissions.FileMode = (*source).FileMode
+		configSharePermissions.DirMode = (*source).DirMode
+		configSharePermissions.InheritAcls = (*source).InheritAcls
+		pConfigSharePermissions = &configSharePermissions
+	}
+	return pConfigSharePermissions
+}
+func (c *ConfigToDbomConverterImpl) pDtoSnapshotPolicyToPConfigSnapshotPolicy(source *dto.SnapshotPolicy) *config.SnapshotPolicy {
+	var pConfigSnapshotPolicy *config.SnapshotPolicy
+	if source != nil {
+		var configSnapshotPolicy config.SnapshotPolicy
+		configSnapshotPolicy.ShadowCopy = (*source).ShadowCopy
+		configSnapshotPolicy.KeepHourly = (*source).KeepHourly
+		configSnapshotPolicy.KeepDaily = (*source).KeepDaily
+		configSnapshotPolicy.KeepWeekly = (*source).KeepWeekly
+		pConfigSnapshotPolicy = &configSnapshotPolicy
+	}
+	return pConfigSnapshotPolicy
+}
 func (c *ConfigToDbomConverterImpl) stringListToDatatypesJSONSlice(source []string) datatypes.JSONSlice[string] {
 	var datatypesJSONSlice datatypes.JSONSlice[string]
 	if source != nil {
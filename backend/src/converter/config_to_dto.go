@@ -70,6 +70,10 @@ type ConfigToDtoConverter interface {
 	// goverter:map TelemetryMode TelemetryMode | github.com/dianlight/srat/dto:ParseTelemetryMode
 	// goverter:map . SmartMode | configSmartModeFromConfig
 	// goverter:ignore HASmbPassword ExperimentalLabMode StandardShareNames
+	// goverter:ignore HomesEnabled HomesVolume HomesQuotaBytes HomesDeletePolicy
+	// goverter:ignore AuditRetentionDays
+	// goverter:ignore IntrusionProtection IntrusionMaxFailures IntrusionWindowMinutes IntrusionBanMinutes
+	// goverter:ignore MQTTEnabled MQTTHost MQTTPort MQTTUsername MQTTPassword MQTTTLS MQTTTLSInsecure MQTTTopic MQTTDiscoveryPrefix
 	ConfigToSettings(source config.Config, target *dto.Settings) error
 
 	// g.overter:update target
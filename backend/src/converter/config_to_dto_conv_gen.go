@@ -98,6 +98,18 @@ func (c *ConfigToDtoConverterImpl) ShareToSharedResource(source config.Share, co
 			dtoSharedResource.RoUsers[i] = dtoUser
 		}
 	}
+	if source.Groups != nil {
+		dtoSharedResource.Groups = make([]string, len(source.Groups))
+		for j := 0; j < len(source.Groups); j++ {
+			dtoSharedResource.Groups[j] = source.Groups[j]
+		}
+	}
+	if source.RoGroups != nil {
+		dtoSharedResource.RoGroups = make([]string, len(source.RoGroups))
+		for k := 0; k < len(source.RoGroups); k++ {
+			dtoSharedResource.RoGroups[k] = source.RoGroups[k]
+		}
+	}
 	pBool2 := source.TimeMachine
 	dtoSharedResource.TimeMachine = &pBool2
 	if source.RecycleBin != nil {
@@ -115,15 +127,33 @@ func (c *ConfigToDtoConverterImpl) ShareToSharedResource(source config.Share, co
 	dtoSharedResource.Usage = dto.HAMountUsage(source.Usage)
 	if source.VetoFiles != nil {
 		dtoSharedResource.VetoFiles = make([]string, len(source.VetoFiles))
-		for j := 0; j < len(source.VetoFiles); j++ {
-			dtoSharedResource.VetoFiles[j] = source.VetoFiles[j]
+		for l := 0; l < len(source.VetoFiles); l++ {
+			dtoSharedResource.VetoFiles[l] = source.VetoFiles[l]
 		}
 	}
+	dtoSharedResource.SmbEncrypt = dto.SmbEncryptMode(source.SmbEncrypt)
+	dtoSharedResource.SmbSigning = dto.SmbSigningMode(source.SmbSigning)
+	dtoSharedResource.SmbMinProtocol = dto.SmbProtocol(source.SmbMinProtocol)
+	dtoSharedResource.Permissions = c.pConfigSharePermissionsToPDtoSharePermissions(source.Permissions)
+	if source.QuotaBytes != nil {
+		xuint64 := *source.QuotaBytes
+		dtoSharedResource.QuotaBytes = &xuint64
+	}
+	if source.UserQuotas != nil {
+		dtoSharedResource.UserQuotas = make([]dto.UserQuota, len(source.UserQuotas))
+		for m := 0; m < len(source.UserQuotas); m++ {
+			dtoSharedResource.UserQuotas[m] = c.configUserQuotaToDtoUserQuota(source.UserQuotas[m])
+		}
+	}
+	dtoSharedResource.Snapshots = c.pConfigSnapshotPolicyToPDtoSnapshotPolicy(source.Snapshots)
+	dtoSharedResource.RecycleBinPolicy = c.pConfigRecycleBinPolicyToPDtoRecycleBinPolicy(source.RecycleBinPolicy)
+	dtoSharedResource.Audit = c.pConfigShareAuditToPDtoShareAudit(source.Audit)
 	pDtoMountPointData, err := c.ShareToMountPointData(source)
 	if err != nil {
 		return dtoSharedResource, err
 	}
 	dtoSharedResource.MountPointData = pDtoMountPointData
+	dtoSharedResource.SubPath = source.SubPath
 	return dtoSharedResource, nil
 }
 func (c *ConfigToDtoConverterImpl) SharedResourceToShare(source dto.SharedResource, target *config.Share) error {
@@ -137,6 +167,9 @@ func (c *ConfigToDtoConverterImpl) SharedResourceToShare(source dto.SharedResour
 	if pString != nil {
 		target.Path = *pString
 	}
+	if source.SubPath != "" {
+		target.SubPath = source.SubPath
+	}
 	var pString2 *string
 	if source.MountPointData != nil {
 		pString2 = source.MountPointData.FSType
@@ -159,6 +192,18 @@ func (c *ConfigToDtoConverterImpl) SharedResourceToShare(source dto.SharedResour
 			target.RoUsers[j] = DtoUserToString(source.RoUsers[j])
 		}
 	}
+	if source.Groups != nil {
+		target.Groups = make([]string, len(source.Groups))
+		for k := 0; k < len(source.Groups); k++ {
+			target.Groups[k] = source.Groups[k]
+		}
+	}
+	if source.RoGroups != nil {
+		target.RoGroups = make([]string, len(source.RoGroups))
+		for l := 0; l < len(source.RoGroups); l++ {
+			target.RoGroups[l] = source.RoGroups[l]
+		}
+	}
 	if source.TimeMachine != nil {
 		target.TimeMachine = *source.TimeMachine
 	}
@@ -179,10 +224,33 @@ func (c *ConfigToDtoConverterImpl) SharedResourceToShare(source dto.SharedResour
 	}
 	if source.VetoFiles != nil {
 		target.VetoFiles = make([]string, len(source.VetoFiles))
-		for k := 0; k < len(source.VetoFiles); k++ {
-			target.VetoFiles[k] = source.VetoFiles[k]
+		for m := 0; m < len(source.VetoFiles); m++ {
+			target.VetoFiles[m] = source.VetoFiles[m]
 		}
 	}
+	if source.SmbEncrypt != "" {
+		target.SmbEncrypt = string(source.SmbEncrypt)
+	}
+	if source.SmbSigning != "" {
+		target.SmbSigning = string(source.SmbSigning)
+	}
+	if source.SmbMinProtocol != "" {
+		target.SmbMinProtocol = string(source.SmbMinProtocol)
+	}
+	target.Permissions = c.pDtoSharePermissionsToPConfigSharePermissions(source.Permissions)
+	if source.QuotaBytes != nil {
+		xuint64 := *source.QuotaBytes
+		target.QuotaBytes = &xuint64
+	}
+	if source.UserQuotas != nil {
+		target.UserQuotas = make([]config.UserQuota, len(source.UserQuotas))
+		for n := 0; n < len(source.UserQuotas); n++ {
+			target.UserQuotas[n] = c.dtoUserQuotaToConfigUserQuota(source.UserQuotas[n])
+		}
+	}
+	target.Snapshots = c.pDtoSnapshotPolicyToPConfigSnapshotPolicy(source.Snapshots)
+	target.RecycleBinPolicy = c.pDtoRecycleBinPolicyToPConfigRecycleBinPolicy(source.RecycleBinPolicy)
+	target.Audit = c.pDtoShareAuditToPConfigShareAudit(source.Audit)
 	return nil
 }
 func (c *ConfigToDtoConverterImpl) UserToOtherUser(source dto.User, target *config.User) error {
@@ -191,3 +259,129 @@ func (c *ConfigToDtoConverterImpl) UserToOtherUser(source dto.User, target *conf
 	}
 	return nil
 }
+func (c *ConfigToDtoConverterImpl) configUserQuotaToDtoUserQuota(source config.UserQuota) dto.UserQuota {
+	var dtoUserQuota dto.UserQuota
+	dtoUserQuota.Username = source.Username
+	dtoUserQuota.LimitBytes = source.LimitBytes
+	return dtoUserQuota
+}
+func (c *ConfigToDtoConverterImpl) dtoUserQuotaToConfigUserQuota(source dto.UserQuota) config.UserQuota {
+	var configUserQuota config.UserQuota
+	configUserQuota.Username = source.Username
+	configUserQuota.LimitBytes = source.LimitBytes
+	return configUserQuota
+}
+func (c *ConfigToDtoConverterImpl) pConfigRecycleBinPolicyToPDtoRecycleBinPolicy(source *config.RecycleBinPolicy) *dto.RecycleBinPolicy {
+	var pDtoRecycleBinPolicy *dto.RecycleBinPolicy
+	if source != nil {
+		var dtoRecycleBinPolicy dto.RecycleBinPolicy
+		dtoRecycleBinPolicy.MaxAgeDays = (*source).MaxAgeDays
+		dtoRecycleBinPolicy.MaxSizeBytes = (*source).MaxSizeBytes
+		if (*source).Exclude != nil {
+			dtoRecycleBinPolicy.Exclude = make([]string, len((*source).Exclude))
+			for i := 0; i < len((*source).Exclude); i++ {
+				dtoRecycleBinPolicy.Exclude[i] = (*source).Exclude[i]
+			}
+		}
+		pDtoRecycleBinPolicy = &dtoRecycleBinPolicy
+	}
+	return pDtoRecycleBinPolicy
+}
+func (c *ConfigToDtoConverterImpl) pConfigShareAuditToPDtoShareAudit(source *config.ShareAudit) *dto.ShareAudit {
+	var pDtoShareAudit *dto.ShareAudit
+	if source != nil {
+		var dtoShareAudit dto.ShareAudit
+		dtoShareAudit.Enabled = (*source).Enabled
+		if (*source).Operations != nil {
+			dtoShareAudit.Operations = make([]string, len((*source).Operations))
+			for i := 0; i < len((*source).Operations); i++ {
+				dtoShareAudit.Operations[i] = (*source).Operations[i]
+			}
+		}
+		dtoShareAudit.LogFailures = (*source).LogFailures
+		pDtoShareAudit = &dtoShareAudit
+	}
+	return pDtoShareAudit
+}
+func (c *ConfigToDtoConverterImpl) pConfigSharePermissionsToPDtoSharePermissions(source *config.SharePermissions) *dto.SharePermissions {
+	var pDtoSharePermissions *dto.SharePermissions
+	if source != nil {
+		var dtoSharePermissions dto.SharePermissions
+		dtoSharePermissions.Owner = (*source).Owner
+		dtoSharePermissions.Group = (*source).Group
+		dtoSharePermissions.FileMode = (*source).FileMode
+		dtoSharePermissions.DirMode = (*source).DirMode
+		dtoSharePermissions.InheritAcls = (*source).InheritAcls
+		pDtoSharePermissions = &dtoSharePermissions
+	}
+	return pDtoSharePermissions
+}
+func (c *ConfigToDtoConverterImpl) pConfigSnapshotPolicyToPDtoSnapshotPolicy(source *config.SnapshotPolicy) *dto.SnapshotPolicy {
+	var pDtoSnapshotPolicy *dto.SnapshotPolicy
+	if source != nil {
+		var dtoSnapshotPolicy dto.SnapshotPolicy
+		dtoSnapshotPolicy.ShadowCopy = (*source).ShadowCopy
+		dtoSnapshotPolicy.KeepHourly = (*source).KeepHourly
+		dtoSnapshotPolicy.KeepDaily = (*source).KeepDaily
+		dtoSnapshotPolicy.KeepWeekly = (*source).KeepWeekly
+		pDtoSnapshotPolicy = &dtoSnapshotPolicy
+	}
+	return pDtoSnapshotPolicy
+}
+func (c *ConfigToDtoConverterImpl) pDtoRecycleBinPolicyToPConfigRecycleBinPolicy(source *dto.RecycleBinPolicy) *config.RecycleBinPolicy {
+	var pConfigRecycleBinPolicy *config.RecycleBinPolicy
+	if source != nil {
+		var configRecycleBinPolicy config.RecycleBinPolicy
+		configRecycleBinPolicy.MaxAgeDays = (*source).MaxAgeDays
+		configRecycleBinPolicy.MaxSizeBytes = (*source).MaxSizeBytes
+		if (*source).Exclude != nil {
+			configRecycleBinPolicy.Exclude = make([]string, len((*source).Exclude))
+			for i := 0; i < len((*source).Exclude); i++ {
+				configRecycleBinPolicy.Exclude[i] = (*source).Exclude[i]
+			}
+		}
+		pConfigRecycleBinPolicy = &configRecycleBinPolicy
+	}
+	return pConfigRecycleBinPolicy
+}
+func (c *ConfigToDtoConverterImpl) pDtoShareAuditToPConfigShareAudit(source *dto.ShareAudit) *config.ShareAudit {
+	var pConfigShareAudit *config.ShareAudit
+	if source != nil {
+		var configShareAudit config.ShareAudit
+		configShareAudit.Enabled = (*source).Enabled
+		if (*source).Operations != nil {
+			configShareAudit.Operations = make([]string, len((*source).Operations))
+			for i := 0; i < len((*source).Operations); i++ {
+				configShareAudit.Operations[i] = (*source).Operations[i]
+			}
+		}
+		configShareAudit.LogFailures = (*source).LogFailures
+		pConfigShareAudit = &configShareAudit
+	}
+	return pConfigShareAudit
+}
+func (c *ConfigToDtoConverterImpl) pDtoSharePermissionsToPConfigSharePermissions(source *dto.SharePermissions) *config.SharePermissions {
+	var pConfigSharePermissions *config.SharePermissions
+	if source != nil {
+		var configSharePermissions config.SharePermissions
+		configSharePermissions.Owner = (*source).Owner
+		configSharePermissions.Group = (*source).Group
+		configSharePermissions.FileMode = (*source).FileMode
+		configSharePermissions.DirMode = (*source).DirMode
+		configSharePermissions.InheritAcls = (*source).InheritAcls
+		pConfigSharePermissions = &configSharePermissions
+	}
+	return pConfigSharePermissions
+}
+func (c *ConfigToDtoConverterImpl) pDtoSnapshotPolicyToPConfigSnapshotPolicy(source *dto.SnapshotPolicy) *config.SnapshotPolicy {
+	var pConfigSnapshotPolicy *config.SnapshotPolicy
+	if source != nil {
+		var configSnapshotPolicy config.SnapshotPolicy
+		configSnapshotPolicy.ShadowCopy = (*source).ShadowCopy
+		configSnapshotPolicy.KeepHourly = (*source).KeepHourly
+		configSnapshotPolicy.KeepDaily = (*source).KeepDaily
+		configSnapshotPolicy.KeepWeekly = (*source).KeepWeekly
+		pConfigSnapshotPolicy = &configSnapshotPolicy
+	}
+	return pConfigSnapshotPolicy
+}
@@ -19,6 +19,10 @@ import (
 // goverter:skipCopySameType
 // goverter:extend exportedShareToString
 // goverter:extend stringToExportedShare
+// goverter:extend sambaGroupToString
+// goverter:extend stringToSambaGroup
+// goverter:extend sambaUserToString
+// goverter:extend stringToSambaUser
 // goverter:extend durationToSeconds
 // goverter:extend secondsToDuration
 // goverter:extend secretToString
@@ -144,6 +148,17 @@ type DtoToDbomConverter interface {
 	UserToSambaUser(source dto.User, target *dbom.SambaUser) error
 
 	UsersToSambaUsers(source []dto.User) (target []dbom.SambaUser, err error)
+
+	// goverter:ignore _
+	SambaGroupToGroup(source dbom.SambaGroup) (target dto.Group, err error)
+
+	// goverter:useUnderlyingTypeMethods yes
+	SambaGroupsToGroups(source []dbom.SambaGroup) (target []dto.Group, err error)
+
+	// goverter:update target
+	// goverter:ignore CreatedAt UpdatedAt DeletedAt RwShares RoShares
+	// goverter:ignoreMissing
+	GroupToSambaGroup(source dto.Group, target *dbom.SambaGroup) error
 }
 
 func exportedShareToString(source dbom.ExportedShare) string {
@@ -156,6 +171,26 @@ func stringToExportedShare(source string) dbom.ExportedShare {
 	}
 }
 
+func sambaGroupToString(source dbom.SambaGroup) string {
+	return source.Name
+}
+
+func stringToSambaGroup(source string) dbom.SambaGroup {
+	return dbom.SambaGroup{
+		Name: source,
+	}
+}
+
+func sambaUserToString(source dbom.SambaUser) string {
+	return source.Username
+}
+
+func stringToSambaUser(source string) dbom.SambaUser {
+	return dbom.SambaUser{
+		Username: source,
+	}
+}
+
 // durationToSeconds converts time.Duration (nanoseconds) to int seconds
 func durationToSeconds(d time.Duration) int {
 	return int(d / time.Second)
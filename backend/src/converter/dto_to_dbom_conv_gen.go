@@ -26,6 +26,18 @@ func (c *DtoToDbomConverterImpl) ExportedShareToSharedResource(source dbom.Expor
 		return dtoSharedResource, err
 	}
 	dtoSharedResource.RoUsers = dtoUserList2
+	if source.Groups != nil {
+		dtoSharedResource.Groups = make([]string, len(source.Groups))
+		for i := 0; i < len(source.Groups); i++ {
+			dtoSharedResource.Groups[i] = sambaGroupToString(source.Groups[i])
+		}
+	}
+	if source.RoGroups != nil {
+		dtoSharedResource.RoGroups = make([]string, len(source.RoGroups))
+		for j := 0; j < len(source.RoGroups); j++ {
+			dtoSharedResource.RoGroups[j] = sambaGroupToString(source.RoGroups[j])
+		}
+	}
 	pBool := source.TimeMachine
 	dtoSharedResource.TimeMachine = &pBool
 	pBool2 := source.RecycleBin
@@ -36,11 +48,21 @@ func (c *DtoToDbomConverterImpl) ExportedShareToSharedResource(source dbom.Expor
 	dtoSharedResource.TimeMachineMaxSize = &pString
 	dtoSharedResource.Usage = source.Usage
 	dtoSharedResource.VetoFiles = c.datatypesJSONSliceToStringList(source.VetoFiles)
+	dtoSharedResource.SmbEncrypt = source.SmbEncrypt
+	dtoSharedResource.SmbSigning = source.SmbSigning
+	dtoSharedResource.SmbMinProtocol = source.SmbMinProtocol
+	dtoSharedResource.Permissions = source.Permissions
+	dtoSharedResource.QuotaBytes = source.QuotaBytes
+	dtoSharedResource.UserQuotas = source.UserQuotas
+	dtoSharedResource.Snapshots = source.Snapshots
+	dtoSharedResource.RecycleBinPolicy = source.RecycleBinPolicy
+	dtoSharedResource.Audit = source.Audit
 	pDtoMountPointData, err := c.dbomMountPointPathToPDtoMountPointData(source.MountPointData)
 	if err != nil {
 		return dtoSharedResource, err
 	}
 	dtoSharedResource.MountPointData = pDtoMountPointData
+	dtoSharedResource.SubPath = source.SubPath
 	return dtoSharedResource, nil
 }
 func (c *DtoToDbomConverterImpl) ExportedSharesToSharedResources(source *[]dbom.ExportedShare) (*[]dto.SharedResource, error) {
@@ -61,6 +83,18 @@ func (c *DtoToDbomConverterImpl) ExportedSharesToSharedResources(source *[]dbom.
 	}
 	return pDtoSharedResourceList, nil
 }
+func (c *DtoToDbomConverterImpl) GroupToSambaGroup(source dto.Group, target *dbom.SambaGroup) error {
+	if source.Name != "" {
+		target.Name = source.Name
+	}
+	if source.Members != nil {
+		target.Members = make([]dbom.SambaUser, len(source.Members))
+		for i := 0; i < len(source.Members); i++ {
+			target.Members[i] = stringToSambaUser(source.Members[i])
+		}
+	}
+	return nil
+}
 func (c *DtoToDbomConverterImpl) HDIdleDeviceDTOToHDIdleDevice(source dto.HDIdleDevice) (dbom.HDIdleDevice, error) {
 	var dbomHDIdleDevice dbom.HDIdleDevice
 	dbomHDIdleDevice.DiskId = source.DiskId
@@ -217,6 +251,43 @@ func (c *DtoToDbomConverterImpl) MountPointPathsToMountPointDatas(source []dbom.
 	}
 	return pDtoMountPointDataList, nil
 }
+func (c *DtoToDbomConverterImpl) SambaGroupToGroup(source dbom.SambaGroup) (dto.Group, error) {
+	var dtoGroup dto.Group
+	dtoGroup.Name = source.Name
+	if source.Members != nil {
+		dtoGroup.Members = make([]string, len(source.Members))
+		for i := 0; i < len(source.Members); i++ {
+			dtoGroup.Members[i] = sambaUserToString(source.Members[i])
+		}
+	}
+	if source.RwShares != nil {
+		dtoGroup.RwShares = make([]string, len(source.RwShares))
+		for j := 0; j < len(source.RwShares); j++ {
+			dtoGroup.RwShares[j] = exportedShareToString(source.RwShares[j])
+		}
+	}
+	if source.RoShares != nil {
+		dtoGroup.RoShares = make([]string, len(source.RoShares))
+		for k := 0; k < len(source.RoShares); k++ {
+			dtoGroup.RoShares[k] = exportedShareToString(source.RoShares[k])
+		}
+	}
+	return dtoGroup, nil
+}
+func (c *DtoToDbomConverterImpl) SambaGroupsToGroups(source []dbom.SambaGroup) ([]dto.Group, error) {
+	var dtoGroupList []dto.Group
+	if source != nil {
+		dtoGroupList = make([]dto.Group, len(source))
+		for i := 0; i < len(source); i++ {
+			dtoGroup, err := c.SambaGroupToGroup(source[i])
+			if err != nil {
+				return nil, err
+			}
+			dtoGroupList[i] = dtoGroup
+		}
+	}
+	return dtoGroupList, nil
+}
 func (c *DtoToDbomConverterImpl) SambaUserToUser(source dbom.SambaUser) (dto.User, error) {
 	var dtoUser dto.User
 	dtoUser.Username = source.Username
@@ -259,6 +330,18 @@ func (c *DtoToDbomConverterImpl) SharedResourceToExportedShareNoUsersNoMountPoin
 	if source.Disabled != nil {
 		target.Disabled = source.Disabled
 	}
+	if source.Groups != nil {
+		target.Groups = make([]dbom.SambaGroup, len(source.Groups))
+		for i := 0; i < len(source.Groups); i++ {
+			target.Groups[i] = stringToSambaGroup(source.Groups[i])
+		}
+	}
+	if source.RoGroups != nil {
+		target.RoGroups = make([]dbom.SambaGroup, len(source.RoGroups))
+		for j := 0; j < len(source.RoGroups); j++ {
+			target.RoGroups[j] = stringToSambaGroup(source.RoGroups[j])
+		}
+	}
 	target.VetoFiles = c.stringListToDatatypesJSONSlice(source.VetoFiles)
 	if source.TimeMachine != nil {
 		target.TimeMachine = *source.TimeMachine
@@ -275,6 +358,36 @@ func (c *DtoToDbomConverterImpl) SharedResourceToExportedShareNoUsersNoMountPoin
 	if source.Usage != "" {
 		target.Usage = source.Usage
 	}
+	if source.SmbEncrypt != "" {
+		target.SmbEncrypt = source.SmbEncrypt
+	}
+	if source.SmbSigning != "" {
+		target.SmbSigning = source.SmbSigning
+	}
+	if source.SmbMinProtocol != "" {
+		target.SmbMinProtocol = source.SmbMinProtocol
+	}
+	if source.Permissions != nil {
+		target.Permissions = source.Permissions
+	}
+	if source.QuotaBytes != nil {
+		target.QuotaBytes = source.QuotaBytes
+	}
+	if source.UserQuotas != nil {
+		target.UserQuotas = source.UserQuotas
+	}
+	if source.Snapshots != nil {
+		target.Snapshots = source.Snapshots
+	}
+	if source.RecycleBinPolicy != nil {
+		target.RecycleBinPolicy = source.RecycleBinPolicy
+	}
+	if source.Audit != nil {
+		target.Audit = source.Audit
+	}
+	if source.SubPath != "" {
+		target.SubPath = source.SubPath
+	}
 	var pString *string
 	if source.MountPointData != nil {
 		pString = &source.MountPointData.Path
@@ -553,6 +666,18 @@ func (c *DtoToDbomConverterImpl) sharedResourceToExportedShare(source dto.Shared
 		return dbomExportedShare, err
 	}
 	dbomExportedShare.RoUsers = dbomSambaUserList2
+	if source.Groups != nil {
+		dbomExportedShare.Groups = make([]dbom.SambaGroup, len(source.Groups))
+		for i := 0; i < len(source.Groups); i++ {
+			dbomExportedShare.Groups[i] = stringToSambaGroup(source.Groups[i])
+		}
+	}
+	if source.RoGroups != nil {
+		dbomExportedShare.RoGroups = make([]dbom.SambaGroup, len(source.RoGroups))
+		for j := 0; j < len(source.RoGroups); j++ {
+			dbomExportedShare.RoGroups[j] = stringToSambaGroup(source.RoGroups[j])
+		}
+	}
 	dbomExportedShare.VetoFiles = c.stringListToDatatypesJSONSlice(source.VetoFiles)
 	if source.TimeMachine != nil {
 		dbomExportedShare.TimeMachine = *source.TimeMachine
@@ -567,6 +692,16 @@ func (c *DtoToDbomConverterImpl) sharedResourceToExportedShare(source dto.Shared
 		dbomExportedShare.TimeMachineMaxSize = *source.TimeMachineMaxSize
 	}
 	dbomExportedShare.Usage = source.Usage
+	dbomExportedShare.SmbEncrypt = source.SmbEncrypt
+	dbomExportedShare.SmbSigning = source.SmbSigning
+	dbomExportedShare.SmbMinProtocol = source.SmbMinProtocol
+	dbomExportedShare.Permissions = source.Permissions
+	dbomExportedShare.QuotaBytes = source.QuotaBytes
+	dbomExportedShare.UserQuotas = source.UserQuotas
+	dbomExportedShare.Snapshots = source.Snapshots
+	dbomExportedShare.RecycleBinPolicy = source.RecycleBinPolicy
+	dbomExportedShare.Audit = source.Audit
+	dbomExportedShare.SubPath = source.SubPath
 	var pString *string
 	if source.MountPointData != nil {
 		pString = &source.MountPointData.Path
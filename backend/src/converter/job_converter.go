@@ -0,0 +1,23 @@
+package converter
+
+import (
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+)
+
+// goverter:converter
+// goverter:output:file ./job_to_dto_conv_gen.go
+// goverter:useZeroValueOnPointerInconsistency
+// goverter:skipCopySameType
+type JobToDtoConverter interface {
+	// goverter:ignore NextRunAt LastRun
+	ToDto(source dbom.ScheduledJob) dto.Job
+
+	// goverter:ignore CreatedAt UpdatedAt Runs
+	ToDbom(source dto.Job) dbom.ScheduledJob
+
+	// goverter:ignore JobName Progress
+	RunToDto(source dbom.JobRun) dto.JobRun
+
+	RunsToDto(source []dbom.JobRun) []dto.JobRun
+}
@@ -0,0 +1,55 @@
+// Code generated by github.com/jmattheis/goverter, DO NOT EDIT.
+//go:build !goverter
+
+package converter
+
+import (
+	dbom "github.com/dianlight/srat/dbom"
+	dto "github.com/dianlight/srat/dto"
+)
+
+type JobToDtoConverterImpl struct{}
+
+func (c *JobToDtoConverterImpl) RunToDto(source dbom.JobRun) dto.JobRun {
+	var dtoJobRun dto.JobRun
+	dtoJobRun.ID = source.ID
+	dtoJobRun.JobID = source.JobID
+	dtoJobRun.Trigger = source.Trigger
+	dtoJobRun.Status = source.Status
+	dtoJobRun.Message = source.Message
+	dtoJobRun.StartedAt = source.StartedAt
+	dtoJobRun.FinishedAt = source.FinishedAt
+	return dtoJobRun
+}
+func (c *JobToDtoConverterImpl) RunsToDto(source []dbom.JobRun) []dto.JobRun {
+	var dtoJobRunList []dto.JobRun
+	if source != nil {
+		dtoJobRunList = make([]dto.JobRun, len(source))
+		for i := 0; i < len(source); i++ {
+			dtoJobRunList[i] = c.RunToDto(source[i])
+		}
+	}
+	return dtoJobRunList
+}
+func (c *JobToDtoConverterImpl) ToDbom(source dto.Job) dbom.ScheduledJob {
+	var dbomScheduledJob dbom.ScheduledJob
+	dbomScheduledJob.ID = source.ID
+	dbomScheduledJob.Name = source.Name
+	dbomScheduledJob.Type = source.Type
+	dbomScheduledJob.Schedule = source.Schedule
+	dbomScheduledJob.Target = source.Target
+	dbomScheduledJob.Options = source.Options
+	dbomScheduledJob.Enabled = source.Enabled
+	return dbomScheduledJob
+}
+func (c *JobToDtoConverterImpl) ToDto(source dbom.ScheduledJob) dto.Job {
+	var dtoJob dto.Job
+	dtoJob.ID = source.ID
+	dtoJob.Name = source.Name
+	dtoJob.Type = source.Type
+	dtoJob.Schedule = source.Schedule
+	dtoJob.Target = source.Target
+	dtoJob.Options = source.Options
+	dtoJob.Enabled = source.Enabled
+	return dtoJob
+}
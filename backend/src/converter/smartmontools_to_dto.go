@@ -31,7 +31,7 @@ type SmartMonToolsToDto interface {
 	// goverter:map Current Value
 	smartMonToolsTemperatureToSmartTempValue(source *smartmontools.Temperature) (target dto.SmartTempValue, err error)
 
-	// goverter:ignore Code Min Worst Thresholds
+	// goverter:ignore Code Min Worst Thresholds Raw
 	// goverter:map Hours Value
 	smartMonToolsPowerOnTimeToSmartRangeValue(source *smartmontools.PowerOnTime) (target dto.SmartRangeValue, err error)
 }
@@ -0,0 +1,17 @@
+package dbom
+
+import "time"
+
+// AuditEvent stores a file operation logged by vfs_full_audit on a share.
+type AuditEvent struct {
+	ID        uint      `gorm:"primarykey"`
+	Time      time.Time `gorm:"index"`
+	Username  string    `gorm:"index"`
+	ClientIP  string
+	Share     string `gorm:"index"`
+	Operation string
+	Success   bool
+	Error     string
+	Path      string
+	Target    string
+}
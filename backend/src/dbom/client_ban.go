@@ -0,0 +1,13 @@
+package dbom
+
+import "time"
+
+// ClientBan stores a client address refused by Samba until ExpiresAt.
+type ClientBan struct {
+	IP        string `gorm:"primarykey"`
+	Reason    string
+	Username  string
+	Failures  int
+	BannedAt  time.Time
+	ExpiresAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,24 @@
+package dbom
+
+import (
+	"os"
+	"time"
+)
+
+// ConfigGeneration stores a set of configuration files successfully applied
+// to the servers, so that it can be applied again later.
+type ConfigGeneration struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	// RestoredFrom is the generation this one is a copy of, 0 for a
+	// configuration generated from the database.
+	RestoredFrom uint
+	Files        []ConfigGenerationFile `gorm:"serializer:json"`
+}
+
+// ConfigGenerationFile is a configuration file of a ConfigGeneration.
+type ConfigGenerationFile struct {
+	Path    string      `json:"path"`
+	Mode    os.FileMode `json:"mode"`
+	Content []byte      `json:"content"`
+}
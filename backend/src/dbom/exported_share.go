@@ -14,14 +14,26 @@ type ExportedShare struct {
 	UpdatedAt          time.Time
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 	Disabled           *bool
-	Users              []SambaUser `gorm:"many2many:user_rw_share;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	RoUsers            []SambaUser `gorm:"many2many:user_ro_share;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Users              []SambaUser  `gorm:"many2many:user_rw_share;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	RoUsers            []SambaUser  `gorm:"many2many:user_ro_share;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Groups             []SambaGroup `gorm:"many2many:group_rw_share;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	RoGroups           []SambaGroup `gorm:"many2many:group_ro_share;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	VetoFiles          datatypes.JSONSlice[string]
 	TimeMachine        bool
 	RecycleBin         bool `gorm:"default:false"`
 	GuestOk            bool `gorm:"default:false"`
 	TimeMachineMaxSize string
 	Usage              dto.HAMountUsage
+	SmbEncrypt         dto.SmbEncryptMode
+	SmbSigning         dto.SmbSigningMode
+	SmbMinProtocol     dto.SmbProtocol
+	Permissions        *dto.SharePermissions `gorm:"serializer:json"`
+	QuotaBytes         *uint64
+	UserQuotas         []dto.UserQuota       `gorm:"serializer:json"`
+	Snapshots          *dto.SnapshotPolicy   `gorm:"serializer:json"`
+	RecycleBinPolicy   *dto.RecycleBinPolicy `gorm:"serializer:json"`
+	Audit              *dto.ShareAudit       `gorm:"serializer:json"`
+	SubPath            string                `gorm:"not null;default:''"`
 	MountPointDataPath *string
 	MountPointDataRoot *string
 	MountPointData     MountPointPath `gorm:"foreignKey:MountPointDataPath,MountPointDataRoot;references:Path,Root"`
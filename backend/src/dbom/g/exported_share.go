@@ -18,12 +18,24 @@ var ExportedShare = struct {
 	Disabled           field.Bool
 	Users              field.Slice[dbom.SambaUser]
 	RoUsers            field.Slice[dbom.SambaUser]
+	Groups             field.Slice[dbom.SambaGroup]
+	RoGroups           field.Slice[dbom.SambaGroup]
 	VetoFiles          field.Struct[datatypes.JSONSlice[string]]
 	TimeMachine        field.Bool
 	RecycleBin         field.Bool
 	GuestOk            field.Bool
 	TimeMachineMaxSize field.String
 	Usage              field.Struct[dto.HAMountUsage]
+	SmbEncrypt         field.Struct[dto.SmbEncryptMode]
+	SmbSigning         field.Struct[dto.SmbSigningMode]
+	SmbMinProtocol     field.Struct[dto.SmbProtocol]
+	Permissions        field.Struct[dto.SharePermissions]
+	QuotaBytes         field.Number[uint64]
+	UserQuotas         field.Slice[dto.UserQuota]
+	Snapshots          field.Struct[dto.SnapshotPolicy]
+	RecycleBinPolicy   field.Struct[dto.RecycleBinPolicy]
+	Audit              field.Struct[dto.ShareAudit]
+	SubPath            field.String
 	MountPointDataPath field.String
 	MountPointDataRoot field.String
 	MountPointData     field.Struct[dbom.MountPointPath]
@@ -35,12 +47,24 @@ var ExportedShare = struct {
 	Disabled:           field.Bool{}.WithColumn("disabled"),
 	Users:              field.Slice[dbom.SambaUser]{}.WithName("Users"),
 	RoUsers:            field.Slice[dbom.SambaUser]{}.WithName("RoUsers"),
+	Groups:             field.Slice[dbom.SambaGroup]{}.WithName("Groups"),
+	RoGroups:           field.Slice[dbom.SambaGroup]{}.WithName("RoGroups"),
 	VetoFiles:          field.Struct[datatypes.JSONSlice[string]]{}.WithName("VetoFiles"),
 	TimeMachine:        field.Bool{}.WithColumn("time_machine"),
 	RecycleBin:         field.Bool{}.WithColumn("recycle_bin"),
 	GuestOk:            field.Bool{}.WithColumn("guest_ok"),
 	TimeMachineMaxSize: field.String{}.WithColumn("time_machine_max_size"),
 	Usage:              field.Struct[dto.HAMountUsage]{}.WithName("Usage"),
+	SmbEncrypt:         field.Struct[dto.SmbEncryptMode]{}.WithName("SmbEncrypt"),
+	SmbSigning:         field.Struct[dto.SmbSigningMode]{}.WithName("SmbSigning"),
+	SmbMinProtocol:     field.Struct[dto.SmbProtocol]{}.WithName("SmbMinProtocol"),
+	Permissions:        field.Struct[dto.SharePermissions]{}.WithName("Permissions"),
+	QuotaBytes:         field.Number[uint64]{}.WithColumn("quota_bytes"),
+	UserQuotas:         field.Slice[dto.UserQuota]{}.WithName("UserQuotas"),
+	Snapshots:          field.Struct[dto.SnapshotPolicy]{}.WithName("Snapshots"),
+	RecycleBinPolicy:   field.Struct[dto.RecycleBinPolicy]{}.WithName("RecycleBinPolicy"),
+	Audit:              field.Struct[dto.ShareAudit]{}.WithName("Audit"),
+	SubPath:            field.String{}.WithColumn("sub_path"),
 	MountPointDataPath: field.String{}.WithColumn("mount_point_data_path"),
 	MountPointDataRoot: field.String{}.WithColumn("mount_point_data_root"),
 	MountPointData:     field.Struct[dbom.MountPointPath]{}.WithName("MountPointData"),
@@ -0,0 +1,27 @@
+// Code generated by 'gorm.io/cli/gorm'. DO NOT EDIT.
+
+package g
+
+import (
+	"github.com/dianlight/srat/dbom"
+	"gorm.io/cli/gorm/field"
+	"gorm.io/gorm"
+)
+
+var SambaGroup = struct {
+	CreatedAt field.Time
+	UpdatedAt field.Time
+	DeletedAt field.Field[gorm.DeletedAt]
+	Name      field.String
+	Members   field.Slice[dbom.SambaUser]
+	RwShares  field.Slice[dbom.ExportedShare]
+	RoShares  field.Slice[dbom.ExportedShare]
+}{
+	CreatedAt: field.Time{}.WithColumn("created_at"),
+	UpdatedAt: field.Time{}.WithColumn("updated_at"),
+	DeletedAt: field.Field[gorm.DeletedAt]{}.WithColumn("deleted_at"),
+	Name:      field.String{}.WithColumn("name"),
+	Members:   field.Slice[dbom.SambaUser]{}.WithName("Members"),
+	RwShares:  field.Slice[dbom.ExportedShare]{}.WithName("RwShares"),
+	RoShares:  field.Slice[dbom.ExportedShare]{}.WithName("RoShares"),
+}
@@ -0,0 +1,27 @@
+// Code generated by 'gorm.io/cli/gorm'. DO NOT EDIT.
+
+package g
+
+import (
+	"gorm.io/cli/gorm/field"
+)
+
+var StatsSample = struct {
+	Metric     field.String
+	Series     field.String
+	Resolution field.Number[int64]
+	Time       field.Time
+	Min        field.Number[float64]
+	Max        field.Number[float64]
+	Sum        field.Number[float64]
+	Count      field.Number[int64]
+}{
+	Metric:     field.String{}.WithColumn("metric"),
+	Series:     field.String{}.WithColumn("series"),
+	Resolution: field.Number[int64]{}.WithColumn("resolution"),
+	Time:       field.Time{}.WithColumn("time"),
+	Min:        field.Number[float64]{}.WithColumn("min"),
+	Max:        field.Number[float64]{}.WithColumn("max"),
+	Sum:        field.Number[float64]{}.WithColumn("sum"),
+	Count:      field.Number[int64]{}.WithColumn("count"),
+}
@@ -0,0 +1,23 @@
+package dbom
+
+import (
+	"time"
+)
+
+// RemoteMount stores a CIFS share or an NFS export of another host mounted as
+// a volume. Its mount point is stored as a MountPointPath so shares can be
+// created on it. The password is kept in a credentials file, not here.
+type RemoteMount struct {
+	Name               string `gorm:"primarykey"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Protocol           string         `gorm:"not null"` // cifs or nfs
+	Server             string         `gorm:"not null"`
+	Share              string         `gorm:"not null"` // Share name (cifs) or exported path (nfs).
+	Path               string         `gorm:"not null;uniqueIndex"`
+	Username           string         // Empty for guest access.
+	Domain             string         // Workgroup or domain of the user.
+	Flags              *MounDataFlags `gorm:"not null;default:''"`
+	CustomFlags        *MounDataFlags `gorm:"not null;default:''"`
+	IsToMountAtStartup bool           `gorm:"not null;default:true"`
+}
@@ -0,0 +1,19 @@
+package dbom
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SambaGroups []SambaGroup
+
+type SambaGroup struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt  `gorm:"index"`
+	Name      string          `gorm:"primaryKey"`
+	Members   []SambaUser     `gorm:"many2many:group_members;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	RwShares  []ExportedShare `gorm:"many2many:group_rw_share;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	RoShares  []ExportedShare `gorm:"many2many:group_ro_share;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
@@ -0,0 +1,32 @@
+package dbom
+
+import (
+	"time"
+
+	"github.com/dianlight/srat/dto"
+)
+
+// ScheduledJob stores a user defined recurring job.
+type ScheduledJob struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string `gorm:"size:128;uniqueIndex"`
+	Type      dto.JobType
+	Schedule  string
+	Target    string
+	Options   map[string]string `gorm:"serializer:json"`
+	Enabled   bool
+	Runs      []JobRun `gorm:"foreignKey:JobID;constraint:OnDelete:CASCADE"`
+}
+
+// JobRun stores the history of the runs of a ScheduledJob.
+type JobRun struct {
+	ID         uint `gorm:"primarykey"`
+	JobID      uint `gorm:"index"`
+	Trigger    dto.JobTrigger
+	Status     dto.JobRunStatus
+	Message    string
+	StartedAt  time.Time `gorm:"index"`
+	FinishedAt *time.Time
+}
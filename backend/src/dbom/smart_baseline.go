@@ -0,0 +1,12 @@
+package dbom
+
+import "time"
+
+// SmartBaseline stores the first value SRAT read of a SMART attribute of a
+// disk, to tell how much it grew since.
+type SmartBaseline struct {
+	DiskID    string `gorm:"primarykey"`
+	Attribute string `gorm:"primarykey"`
+	Value     int64
+	SeenAt    time.Time
+}
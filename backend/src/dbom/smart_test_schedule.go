@@ -0,0 +1,31 @@
+package dbom
+
+import (
+	"time"
+
+	"github.com/dianlight/srat/dto"
+)
+
+// SmartTestSchedule stores when the SMART self-tests of a disk run.
+type SmartTestSchedule struct {
+	DiskID        string `gorm:"primarykey"`
+	UpdatedAt     time.Time
+	Enabled       bool
+	ShortSchedule string
+	LongSchedule  string
+	Group         string
+	Force         bool
+}
+
+// SmartTestResult stores a completed SMART self-test.
+type SmartTestResult struct {
+	ID              uint   `gorm:"primarykey"`
+	DiskID          string `gorm:"index"`
+	TestType        dto.SmartTestType
+	Trigger         dto.JobTrigger
+	Outcome         dto.SmartTestOutcome
+	Status          string
+	LBAOfFirstError string
+	StartedAt       time.Time
+	FinishedAt      time.Time
+}
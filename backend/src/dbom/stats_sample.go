@@ -0,0 +1,17 @@
+package dbom
+
+import "time"
+
+// StatsSample stores a bucket of a metric series. Raw samples have a zero
+// Resolution and a Count of 1; they are rolled up into minute, hour and day
+// buckets holding the minimum, maximum, sum and count of the samples.
+type StatsSample struct {
+	Metric     string    `gorm:"primarykey"`
+	Series     string    `gorm:"primarykey"`
+	Resolution int64     `gorm:"primarykey;index:idx_stats_sample_resolution_time,priority:1"` // bucket width in seconds
+	Time       time.Time `gorm:"primarykey;index:idx_stats_sample_resolution_time,priority:2"`
+	Min        float64
+	Max        float64
+	Sum        float64
+	Count      int64
+}
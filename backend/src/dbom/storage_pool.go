@@ -0,0 +1,17 @@
+package dbom
+
+import (
+	"time"
+)
+
+// StoragePool stores a mergerfs union of mounted volumes. Its mount point is
+// stored as a MountPointPath so shares can be created on it.
+type StoragePool struct {
+	Name               string `gorm:"primarykey"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Path               string   `gorm:"not null;uniqueIndex"`
+	CreatePolicy       string   `gorm:"not null;default:'epmfs'"`
+	Members            []string `gorm:"serializer:json"` // Mount paths of the branches, in order.
+	IsToMountAtStartup bool     `gorm:"not null;default:true"`
+}
@@ -0,0 +1,52 @@
+package dto
+
+import "time"
+
+// AuditOperations are the vfs_full_audit operations a share can log.
+var AuditOperations = []string{
+	"connect", "disconnect", "create_file", "openat", "close", "pread", "pwrite",
+	"mkdirat", "renameat", "unlinkat", "linkat", "symlinkat", "fchmod", "fchown",
+	"fntimes", "ftruncate", "fset_dos_attributes", "fset_nt_acl", "fsetxattr",
+}
+
+// DefaultAuditOperations are logged when a share audit sets no operations:
+// enough to tell who created, renamed or deleted what.
+var DefaultAuditOperations = []string{"mkdirat", "renameat", "unlinkat"}
+
+// ShareAudit logs the file operations done on a share (see vfs_full_audit(8)).
+type ShareAudit struct {
+	Enabled     bool     `json:"enabled"`
+	Operations  []string `json:"operations,omitempty" nullable:"false" example:"[\"renameat\",\"unlinkat\"]" doc:"vfs_full_audit operations to log, mkdirat renameat and unlinkat when empty"`
+	LogFailures bool     `json:"log_failures,omitempty" doc:"Log the failed operations too"`
+}
+
+// IsEnabled reports whether the share operations are logged.
+func (a *ShareAudit) IsEnabled() bool {
+	return a != nil && a.Enabled
+}
+
+// AuditEvent is a file operation done on a share.
+type AuditEvent struct {
+	ID        uint      `json:"id"`
+	Time      time.Time `json:"time"`
+	Username  string    `json:"username"`
+	ClientIP  string    `json:"client_ip"`
+	Share     string    `json:"share"`
+	Operation string    `json:"operation" example:"unlinkat"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty" doc:"Reason of a failed operation"`
+	Path      string    `json:"path,omitempty"`
+	Target    string    `json:"target,omitempty" doc:"Destination of a rename or a link"`
+}
+
+// AuditFilter selects audit events. Empty fields match everything.
+type AuditFilter struct {
+	Username  string
+	Share     string
+	ClientIP  string
+	Operation string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
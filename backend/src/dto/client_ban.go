@@ -0,0 +1,14 @@
+package dto
+
+import "time"
+
+// ClientBan is a client address refused by Samba, after too many failed
+// logins or by hand.
+type ClientBan struct {
+	IP        string    `json:"ip" example:"192.168.1.66"`
+	Reason    string    `json:"reason,omitempty"`
+	Username  string    `json:"username,omitempty" doc:"Last user the client tried to log in as"`
+	Failures  int       `json:"failures" doc:"Failed logins that caused the ban"`
+	BannedAt  time.Time `json:"banned_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,13 @@
+package dto
+
+import "time"
+
+// ConfigGeneration is a set of configuration files applied to the servers.
+// Generations are numbered in apply order; any of them can be applied again.
+type ConfigGeneration struct {
+	Generation   uint      `json:"generation"`
+	AppliedAt    time.Time `json:"applied_at"`
+	Files        []string  `json:"files" doc:"Paths of the configuration files of the generation"`
+	RestoredFrom uint      `json:"restored_from,omitempty" doc:"Generation this one was rolled back to, if any"`
+	Current      bool      `json:"current" doc:"Whether this is the configuration in use"`
+}
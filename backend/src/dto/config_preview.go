@@ -0,0 +1,39 @@
+package dto
+
+// ServiceRestartAction is what an apply does to a server.
+type ServiceRestartAction string
+
+const (
+	// ServiceRestartActionNone leaves the server running untouched.
+	ServiceRestartActionNone ServiceRestartAction = "none"
+	// ServiceRestartActionSoft reloads the configuration of the server.
+	ServiceRestartActionSoft ServiceRestartAction = "soft"
+	// ServiceRestartActionHard restarts the server.
+	ServiceRestartActionHard ServiceRestartAction = "hard"
+	// ServiceRestartActionStart starts a server that is not running.
+	ServiceRestartActionStart ServiceRestartAction = "start"
+)
+
+// ServiceRestart is the action an apply takes on a managed server.
+type ServiceRestart struct {
+	Service string               `json:"service"`
+	Action  ServiceRestartAction `json:"action" enum:"none,soft,hard,start"`
+}
+
+// ConfigFileDiff compares a configuration file on disk with the one an
+// apply would write.
+type ConfigFileDiff struct {
+	Path    string `json:"path"`
+	Changed bool   `json:"changed"`
+	Diff    string `json:"diff,omitempty" doc:"Unified diff from the file on disk to the pending file"`
+}
+
+// ConfigPreview tells what applying the configuration would change,
+// without changing anything.
+type ConfigPreview struct {
+	Files            []ConfigFileDiff `json:"files"`
+	Valid            bool             `json:"valid" doc:"Whether testparm accepts the pending smb.conf"`
+	TestparmWarnings []string         `json:"testparm_warnings" nullable:"false"`
+	Dirty            DataDirtyTracker `json:"dirty" doc:"Data changed since the last apply"`
+	Restarts         []ServiceRestart `json:"restarts" nullable:"false" doc:"Actions taken on the managed servers"`
+}
@@ -23,6 +23,8 @@ type ContextState struct {
 	SecureMode           bool   // Whether the application is running in secure mode and need authentication for all operations
 	HACoreReady          bool   // Whether the Home Assistant Core is ready
 	UpdateDataDir        string // Directory where update files are stored
+	LuksKeyDir           string // Directory where the keyfiles unlocking LUKS volumes are stored
+	RemoteCredsDir       string // Directory where the credentials of the CIFS remote mounts are stored
 	//UpdateFilePath  string        // Full path to the update file for current update operation. Useful for onplace_update.
 	UpdateChannel             UpdateChannel                     // Current Update Channel
 	UpdateAvailable           bool                              // Whether an update is available
@@ -99,6 +99,17 @@ type Partition struct {
 	// System true if filesystem considered a system/internal device.
 	System *bool `json:"system,omitempty"`
 
+	// ParentId Id of the partition this one was opened from (e.g. the LUKS container of a mapper device).
+	ParentId *string `json:"parent_id,omitempty" readonly:"true"`
+
+	// Encryption Encryption state when the partition is an encrypted container.
+	Encryption *PartitionEncryption `json:"encryption,omitempty" readonly:"true"`
+
+	// Pool Pool state when the partition exposes a mergerfs storage pool.
+	Pool *StoragePool `json:"pool,omitempty" readonly:"true"`
+	// Remote Remote state when the partition exposes a CIFS or NFS remote mount.
+	Remote *RemoteMount `json:"remote,omitempty" readonly:"true"`
+
 	// HostMountPointData A map of mount points on the host-side keyed by MountPointData.Path.
 	// Using a map allows O(1) lookups and stable identification by path.
 	HostMountPointData *map[string]MountPointData `json:"host_mount_point_data,omitempty"`
@@ -426,3 +426,26 @@ func (m *DiskMap) GetPartitionByID(partitionID string) (*Partition, string, bool
 	}
 	return nil, "", false
 }
+
+// GetByLegacyDevicePath searches all disks for the disk or the partition with
+// the given legacy device path (e.g. /dev/sdb or /dev/sdb1). Returns the disk
+// ID, the partition ID (empty when the path is a whole disk) and true if found.
+func (m *DiskMap) GetByLegacyDevicePath(path string) (string, string, bool) {
+	if m == nil || *m == nil || path == "" {
+		return "", "", false
+	}
+	for diskID, disk := range *m {
+		if disk.LegacyDevicePath != nil && *disk.LegacyDevicePath == path {
+			return diskID, "", true
+		}
+		if disk.Partitions == nil {
+			continue
+		}
+		for partitionID, partition := range *disk.Partitions {
+			if partition.LegacyDevicePath != nil && *partition.LegacyDevicePath == path {
+				return diskID, partitionID, true
+			}
+		}
+	}
+	return "", "", false
+}
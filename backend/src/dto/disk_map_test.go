@@ -715,3 +715,31 @@ func TestDiskMap_AddSmartInfo_Errors(t *testing.T) {
 	err = (&m).AddSmartInfo(&dto.SmartInfo{DiskId: "nonexistent"})
 	assert.Error(t, err)
 }
+
+func TestDiskMap_GetByLegacyDevicePath(t *testing.T) {
+	diskID := "ata-DISK"
+	partID := "ata-DISK-part1"
+	m := dto.DiskMap{}
+	_ = (&m).AddOrUpdate(&dto.Disk{
+		Id:               &diskID,
+		LegacyDevicePath: new("/dev/sdb"),
+		Partitions: &map[string]dto.Partition{
+			partID: {Id: &partID, LegacyDevicePath: new("/dev/sdb1")},
+		},
+	})
+
+	gotDisk, gotPart, ok := (&m).GetByLegacyDevicePath("/dev/sdb1")
+	assert.True(t, ok)
+	assert.Equal(t, diskID, gotDisk)
+	assert.Equal(t, partID, gotPart)
+
+	gotDisk, gotPart, ok = (&m).GetByLegacyDevicePath("/dev/sdb")
+	assert.True(t, ok)
+	assert.Equal(t, diskID, gotDisk)
+	assert.Empty(t, gotPart)
+
+	_, _, ok = (&m).GetByLegacyDevicePath("/dev/sdc1")
+	assert.False(t, ok)
+	_, _, ok = (&m).GetByLegacyDevicePath("")
+	assert.False(t, ok)
+}
@@ -381,7 +381,7 @@ func TestEventType_All(t *testing.T) {
 	for range dto.WebEventTypes.All() {
 		count++
 	}
-	assert.Equal(t, 16, count)
+	assert.Equal(t, 18, count)
 }
 
 func TestEventType_MarshalYAML(t *testing.T) {
@@ -22,6 +22,8 @@ var ErrorAlreadyMounted = errors.Base("Already mounted")
 var ErrorUserAlreadyExists = errors.Base("User already exists")
 var ErrorUserNotFound = errors.Base("User not found")
 var ErrorPasswordRequired = errors.Base("Password is required")
+var ErrorGroupAlreadyExists = errors.Base("Group already exists")
+var ErrorGroupNotFound = errors.Base("Group not found")
 var ErrorNoUpdateAvailable = errors.Base("No update available for the specified channel and architecture")
 var ErrorSMARTNotSupported = errors.Base("SMART not supported for this device")
 var ErrorHDIdleNotSupported = errors.Base("HD Idle not supported for this device")
@@ -31,6 +33,17 @@ var ErrorSMARTOperationFailed = errors.Base("SMART operation failed")
 var ErrorSMARTTestInProgress = errors.Base("SMART test already in progress")
 var ErrorConflict = errors.Base("Operation conflict")
 var ErrorUnsupportedFilesystem = errors.Base("Unsupported filesystem type")
+var ErrorQuotaNotSupported = errors.Base("Quota not supported by the filesystem")
+var ErrorSnapshotNotSupported = errors.Base("Snapshots not supported by the filesystem")
+var ErrorSnapshotNotFound = errors.Base("Snapshot not found")
+var ErrorJobNotFound = errors.Base("Job not found")
+var ErrorJobAlreadyExists = errors.Base("Job already exists")
+var ErrorJobAlreadyRunning = errors.Base("Job already running")
+var ErrorConfigGenerationNotFound = errors.Base("Configuration generation not found")
+var ErrorSambaSessionNotFound = errors.Base("Samba session not found")
+var ErrorOpenFileNotFound = errors.Base("Open file not found")
+var ErrorClientBanNotFound = errors.Base("Client ban not found")
+var ErrorConfigApplyFailed = errors.Base("Configuration apply failed, previous configuration restored")
 var ErrorOperationNotPermitted = errors.Base("Operation not permitted")
 var ErrorLabModeRequired = errors.Base("Lab Mode is required for this operation")
 var ErrorHDIdleNonRotational = errors.Base("HD Idle target is not a rotational disk; force_enabled is required")
@@ -0,0 +1,11 @@
+package dto
+
+// Group is a Samba/unix group. Shares reference it as an `@group` principal
+// so that membership changes apply to every share at once.
+type Group struct {
+	_        struct{} `json:"-" additionalProperties:"true"`
+	Name     string   `json:"name" pattern:"^[a-zA-Z0-9_-]+$" maxLength:"30"`
+	Members  []string `json:"members,omitempty" nullable:"false"`
+	RwShares []string `json:"rw_shares,omitempty" read-only:"true"`
+	RoShares []string `json:"ro_shares,omitempty" read-only:"true"`
+}
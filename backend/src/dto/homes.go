@@ -0,0 +1,36 @@
+package dto
+
+import "encoding/json"
+
+// HomesDir is the directory, relative to the homes volume, holding one home
+// directory per user.
+const HomesDir = "homes"
+
+// HomesArchiveDir is the directory, relative to HomesDir, where the home
+// directories of deleted users are moved by the archive policy.
+const HomesArchiveDir = ".archive"
+
+// HomesDeletePolicy tells what happens to the home directory of a deleted
+// user.
+type HomesDeletePolicy string
+
+const (
+	// HomesDeletePolicyArchive moves the directory under HomesArchiveDir. It
+	// is the default when the setting is unset.
+	HomesDeletePolicyArchive HomesDeletePolicy = "archive"
+	// HomesDeletePolicyKeep leaves the directory in place, a user created
+	// again with the same name gets it back.
+	HomesDeletePolicyKeep HomesDeletePolicy = "keep"
+	// HomesDeletePolicyRemove deletes the directory and its content.
+	HomesDeletePolicyRemove HomesDeletePolicy = "remove"
+)
+
+// MarshalJSON serializes the policy, normalizing the zero value to
+// "archive" so that a never-configured setting still produces a value valid
+// for the "keep,archive,remove" enum schema.
+func (p HomesDeletePolicy) MarshalJSON() ([]byte, error) {
+	if p == "" {
+		p = HomesDeletePolicyArchive
+	}
+	return json.Marshal(string(p))
+}
@@ -0,0 +1,76 @@
+package dto
+
+import "time"
+
+// JobType is the kind of work a scheduled job performs.
+type JobType string
+
+const (
+	// JobTypeSmartSelfTest runs a SMART self-test. Target is a disk id, the
+	// "test_type" option selects short (default), long or conveyance. The
+	// group and force settings of the SmartTestSchedule of the disk apply.
+	JobTypeSmartSelfTest JobType = "smart_self_test"
+	// JobTypeFilesystemCheck checks a partition. Target is a device path, the
+	// "auto_fix" option enables repairs.
+	JobTypeFilesystemCheck JobType = "filesystem_check"
+	// JobTypeRecycleBinPurge empties old entries of a share recycle bin.
+	// Target is a share name, the "max_age_days" option overrides the max
+	// age of the share policy.
+	JobTypeRecycleBinPurge JobType = "recycle_bin_purge"
+	// JobTypeScrub verifies the checksums of the volume behind a share.
+	// Target is a share name.
+	JobTypeScrub JobType = "scrub"
+	// JobTypeSync replicates a share with rsync. Target is the source share,
+	// see SyncOptions for the options.
+	JobTypeSync JobType = "sync"
+)
+
+// JobRunStatus is the outcome of a job run.
+type JobRunStatus string
+
+const (
+	JobRunStatusRunning JobRunStatus = "running"
+	JobRunStatusSuccess JobRunStatus = "success"
+	JobRunStatusFailure JobRunStatus = "failure"
+	// JobRunStatusSkipped is recorded when a run was due while the previous
+	// one was still going.
+	JobRunStatusSkipped JobRunStatus = "skipped"
+	// JobRunStatusInterrupted is recorded at startup for the runs that were
+	// still going when SRAT stopped.
+	JobRunStatusInterrupted JobRunStatus = "interrupted"
+)
+
+// JobTrigger tells what started a job run.
+type JobTrigger string
+
+const (
+	JobTriggerSchedule JobTrigger = "schedule"
+	JobTriggerManual   JobTrigger = "manual"
+)
+
+// Job is a recurring task run on a cron schedule.
+type Job struct {
+	ID        uint              `json:"id" readOnly:"true"`
+	Name      string            `json:"name" minLength:"1" maxLength:"128"`
+	Type      JobType           `json:"type" enum:"smart_self_test,filesystem_check,recycle_bin_purge,scrub,sync"`
+	Schedule  string            `json:"schedule" maxLength:"128" example:"0 3 * * 0" doc:"Five-field cron expression (minute hour day-of-month month day-of-week) or @hourly, @daily, @weekly, @monthly, @yearly"`
+	Target    string            `json:"target" maxLength:"256" doc:"Disk id, device path or share name, depending on the job type"`
+	Options   map[string]string `json:"options,omitempty" doc:"Job type specific options"`
+	Enabled   bool              `json:"enabled"`
+	NextRunAt *time.Time        `json:"next_run_at,omitempty" readOnly:"true"`
+	LastRun   *JobRun           `json:"last_run,omitempty" readOnly:"true"`
+}
+
+// JobRun is one execution of a Job. It is also the payload of the job_run
+// websocket event, sent when a run starts, progresses and ends.
+type JobRun struct {
+	ID         uint         `json:"id"`
+	JobID      uint         `json:"job_id"`
+	JobName    string       `json:"job_name"`
+	Trigger    JobTrigger   `json:"trigger" enum:"schedule,manual"`
+	Status     JobRunStatus `json:"status" enum:"running,success,failure,skipped,interrupted"`
+	Progress   int          `json:"progress,omitempty" doc:"Completion percentage while running, when known"`
+	Message    string       `json:"message,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+}
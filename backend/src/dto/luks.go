@@ -0,0 +1,16 @@
+package dto
+
+// PartitionEncryption is the state of an encrypted container partition.
+type PartitionEncryption struct {
+	Type              string  `json:"type" enum:"luks"`
+	Unlocked          bool    `json:"unlocked"`
+	MapperDevice      *string `json:"mapper_device,omitempty" doc:"Device of the opened container, e.g. /dev/mapper/luks-<uuid>"`
+	MapperPartitionId *string `json:"mapper_partition_id,omitempty" doc:"Id of the partition exposing the opened container"`
+	HasKeyfile        bool    `json:"has_keyfile" doc:"A keyfile is stored to unlock the container at startup"`
+}
+
+// LuksUnlockRequest carries the passphrase opening a LUKS container.
+type LuksUnlockRequest struct {
+	Passphrase   string `json:"passphrase" minLength:"1" maxLength:"512" doc:"Passphrase of the container, never stored unless store_keyfile is set"`
+	StoreKeyfile bool   `json:"store_keyfile,omitempty" doc:"Store the passphrase as a keyfile in the addon data to unlock the container at startup"`
+}
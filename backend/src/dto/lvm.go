@@ -0,0 +1,63 @@
+package dto
+
+// LvmReport lists the LVM physical volumes, volume groups and logical volumes.
+type LvmReport struct {
+	PhysicalVolumes []LvmPhysicalVolume `json:"physical_volumes"`
+	VolumeGroups    []LvmVolumeGroup    `json:"volume_groups"`
+	LogicalVolumes  []LvmLogicalVolume  `json:"logical_volumes"`
+}
+
+// LvmPhysicalVolume is a device given to LVM.
+type LvmPhysicalVolume struct {
+	Device      string  `json:"device" doc:"Device of the physical volume, e.g. /dev/sdb1"`
+	Uuid        string  `json:"uuid"`
+	VgName      string  `json:"vg_name,omitempty" doc:"Volume group the physical volume belongs to, if any"`
+	Size        int64   `json:"size" doc:"Size in bytes"`
+	Free        int64   `json:"free" doc:"Unallocated bytes"`
+	DiskId      *string `json:"disk_id,omitempty" doc:"Id of the disk holding the physical volume"`
+	PartitionId *string `json:"partition_id,omitempty" doc:"Id of the partition, unset when a whole disk is the physical volume"`
+}
+
+// LvmVolumeGroup is a pool of physical volumes the logical volumes are
+// allocated from.
+type LvmVolumeGroup struct {
+	Name    string  `json:"name"`
+	Uuid    string  `json:"uuid"`
+	Size    int64   `json:"size" doc:"Size in bytes"`
+	Free    int64   `json:"free" doc:"Unallocated bytes"`
+	PvCount int     `json:"pv_count"`
+	LvCount int     `json:"lv_count"`
+	DiskId  *string `json:"disk_id,omitempty" doc:"Id of the disk exposing the logical volumes as partitions"`
+}
+
+// LvmLogicalVolume is a volume allocated in a volume group.
+type LvmLogicalVolume struct {
+	Name        string  `json:"name"`
+	VgName      string  `json:"vg_name"`
+	Uuid        string  `json:"uuid"`
+	Path        string  `json:"path,omitempty" doc:"Device of the logical volume, e.g. /dev/vg0/data, unset for pools"`
+	Size        int64   `json:"size" doc:"Size in bytes"`
+	Attr        string  `json:"attr" doc:"lv_attr flags as shown by lvs"`
+	Active      bool    `json:"active"`
+	Origin      *string `json:"origin,omitempty" doc:"Logical volume a snapshot was taken of"`
+	Pool        *string `json:"pool,omitempty" doc:"Thin pool of a thin logical volume"`
+	PartitionId *string `json:"partition_id,omitempty" doc:"Id of the partition to mount the logical volume with"`
+}
+
+// LvmCreateRequest describes a new logical volume.
+type LvmCreateRequest struct {
+	Name string `json:"name" minLength:"1" maxLength:"64" pattern:"^[a-zA-Z0-9+_.][a-zA-Z0-9+_.-]*$" doc:"Name of the logical volume"`
+	Size int64  `json:"size,omitempty" minimum:"0" doc:"Size in bytes, all the free space of the volume group when 0"`
+}
+
+// LvmExtendRequest grows a logical volume.
+type LvmExtendRequest struct {
+	Size     int64 `json:"size,omitempty" minimum:"0" doc:"New size in bytes, all the free space of the volume group added when 0"`
+	ResizeFs bool  `json:"resize_fs,omitempty" doc:"Grow the filesystem of the logical volume too"`
+}
+
+// LvmSnapshotRequest describes a snapshot of a logical volume.
+type LvmSnapshotRequest struct {
+	Name string `json:"name" minLength:"1" maxLength:"64" pattern:"^[a-zA-Z0-9+_.][a-zA-Z0-9+_.-]*$" doc:"Name of the snapshot logical volume"`
+	Size int64  `json:"size,omitempty" minimum:"0" doc:"Space in bytes reserved for the changes, required unless the origin is thin provisioned"`
+}
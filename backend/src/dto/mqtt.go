@@ -0,0 +1,13 @@
+package dto
+
+import "time"
+
+// MQTTStatus is the state of the connection to the MQTT broker.
+type MQTTStatus struct {
+	Enabled     bool       `json:"enabled"`
+	Connected   bool       `json:"connected"`
+	Broker      string     `json:"broker,omitempty" doc:"host:port of the broker"`
+	ConnectedAt *time.Time `json:"connected_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	Entities    int        `json:"entities" doc:"Number of entities announced to Home Assistant"`
+}
@@ -0,0 +1,23 @@
+package dto
+
+// StoragePool is a mergerfs union of mounted volumes, shown as a volume of its
+// own that shares can be created on.
+type StoragePool struct {
+	Name               string   `json:"name"`
+	Path               string   `json:"path" doc:"Mount path of the pool, e.g. /mnt/pool"`
+	CreatePolicy       string   `json:"create_policy" enum:"epmfs,mfs,lfs" doc:"mergerfs policy choosing the branch new files are created on"`
+	Members            []string `json:"members" doc:"Mount paths of the volumes pooled together"`
+	IsMounted          bool     `json:"is_mounted"`
+	Degraded           bool     `json:"degraded" doc:"A member went away while the pool was mounted: the pool was unmounted until all its members are mounted again"`
+	IsToMountAtStartup bool     `json:"is_to_mount_at_startup"`
+	Size               uint64   `json:"size" doc:"Aggregate size of the members in bytes"`
+	Free               uint64   `json:"free" doc:"Aggregate free space of the members in bytes"`
+	PartitionId        string   `json:"partition_id" doc:"Id of the partition exposing the pool in the volumes"`
+}
+
+// StoragePoolCreateRequest describes a new pool.
+type StoragePoolCreateRequest struct {
+	Name         string   `json:"name" minLength:"1" maxLength:"64" pattern:"^[a-zA-Z0-9_-]+$" doc:"Name of the pool, mounted at /mnt/<name>"`
+	Members      []string `json:"members" minItems:"2" uniqueItems:"true" doc:"Mount paths of the mounted volumes to pool together"`
+	CreatePolicy string   `json:"create_policy,omitempty" enum:"epmfs,mfs,lfs" default:"epmfs" doc:"epmfs keeps new files next to their existing path, mfs picks the member with the most free space, lfs the one with the least"`
+}
@@ -9,3 +9,8 @@ const (
 	problemSeverityError                           // "error"
 	problemSeverityCritical                        // "critical"
 )
+
+// Rank orders the severities, from info to critical.
+func (p ProblemSeverity) Rank() int {
+	return int(p.problemSeverity)
+}
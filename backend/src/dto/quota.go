@@ -0,0 +1,41 @@
+package dto
+
+// QuotaWarningPercent is the usage threshold that raises a quota Problem.
+const QuotaWarningPercent = 90
+
+// UserQuota caps how much a user can store on the filesystem of a share.
+type UserQuota struct {
+	Username   string `json:"username" maxLength:"30"`
+	LimitBytes uint64 `json:"limit_bytes" doc:"Hard limit in bytes, 0 removes the quota"`
+}
+
+// QuotaUsage reports the space used against a hard limit. LimitBytes is 0 when
+// no limit is set.
+type QuotaUsage struct {
+	UsedBytes   uint64  `json:"used_bytes"`
+	LimitBytes  uint64  `json:"limit_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// NewQuotaUsage builds a QuotaUsage computing the used percentage.
+func NewQuotaUsage(used, limit uint64) QuotaUsage {
+	usage := QuotaUsage{UsedBytes: used, LimitBytes: limit}
+	if limit > 0 {
+		usage.UsedPercent = float64(used) * 100 / float64(limit)
+	}
+	return usage
+}
+
+// UserQuotaUsage is the QuotaUsage of a single user.
+type UserQuotaUsage struct {
+	Username string `json:"username"`
+	QuotaUsage
+}
+
+// ShareQuotaStatus is the usage-vs-limit report of a share.
+type ShareQuotaStatus struct {
+	Supported bool             `json:"supported"`
+	Share     *QuotaUsage      `json:"share,omitempty"`
+	Users     []UserQuotaUsage `json:"users,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
@@ -0,0 +1,48 @@
+package dto
+
+// RaidArray is an assembled software RAID (md) array. It is also the payload
+// of the raid_array websocket event, sent when the array changes and while it
+// is resyncing or rebuilding.
+type RaidArray struct {
+	Name        string       `json:"name" doc:"Kernel name of the array, e.g. md0"`
+	DevicePath  string       `json:"device_path" doc:"Device of the array, e.g. /dev/md0"`
+	Level       string       `json:"level,omitempty" doc:"RAID level, e.g. raid1"`
+	State       string       `json:"state,omitempty" doc:"State reported by mdadm, e.g. clean, degraded, recovering"`
+	Uuid        *string      `json:"uuid,omitempty"`
+	Label       *string      `json:"label,omitempty" doc:"Name stored in the array superblock"`
+	Size        *int         `json:"size,omitempty" doc:"Size of the array in bytes"`
+	DiskId      *string      `json:"disk_id,omitempty" doc:"Id of the disk exposing the array as a volume"`
+	PartitionId *string      `json:"partition_id,omitempty" doc:"Id of the partition to mount the array with"`
+	DisksActive int          `json:"disks_active"`
+	DisksTotal  int          `json:"disks_total" doc:"Number of members the array requires"`
+	DisksFailed int          `json:"disks_failed"`
+	DisksSpare  int          `json:"disks_spare"`
+	Degraded    bool         `json:"degraded" doc:"The array runs with fewer members than it requires"`
+	Members     []RaidMember `json:"members"`
+	Sync        *RaidSync    `json:"sync,omitempty" doc:"Running resync, rebuild, reshape or check"`
+}
+
+// RaidMember is a device of a RAID array.
+type RaidMember struct {
+	Device      string  `json:"device" doc:"Member device, e.g. /dev/sdb1"`
+	Slot        *int    `json:"slot,omitempty" doc:"Role of the member in the array, unset for spares and failed members"`
+	State       string  `json:"state" doc:"State reported by mdadm, e.g. active sync, spare rebuilding, faulty, removed"`
+	Faulty      bool    `json:"faulty"`
+	Spare       bool    `json:"spare"`
+	Missing     bool    `json:"missing" doc:"The member left the array and can be re-added"`
+	DiskId      *string `json:"disk_id,omitempty" doc:"Id of the disk holding the member"`
+	PartitionId *string `json:"partition_id,omitempty" doc:"Id of the member partition, unset when a whole disk is the member"`
+}
+
+// RaidSync is the progress of a resync, rebuild, reshape or check.
+type RaidSync struct {
+	Action        string  `json:"action" enum:"resyncing,recovering,reshaping,checking"`
+	Percent       float64 `json:"percent"`
+	FinishMinutes float64 `json:"finish_minutes,omitempty" doc:"Estimated time left"`
+	SpeedKBps     int64   `json:"speed_kbps,omitempty"`
+}
+
+// RaidReAddRequest names the member to return to an array.
+type RaidReAddRequest struct {
+	Device string `json:"device,omitempty" doc:"Member device to re-add, every faulty or missing member when empty"`
+}
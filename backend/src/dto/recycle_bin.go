@@ -0,0 +1,28 @@
+package dto
+
+import "time"
+
+// RecycleBinDir is the directory, relative to the share root, where the
+// vfs_recycle module moves deleted files. Each user has a sub directory.
+const RecycleBinDir = ".recycle"
+
+// RecycleBinPolicy limits what the recycle bin of a share keeps. Deletion
+// time is the access time set by `recycle:touch`.
+type RecycleBinPolicy struct {
+	MaxAgeDays   uint     `json:"max_age_days,omitempty" maximum:"3650" doc:"Entries deleted more days ago are purged, 0 keeps them forever"`
+	MaxSizeBytes uint64   `json:"max_size_bytes,omitempty" doc:"The oldest entries are purged while the bin of the share is larger, 0 means no limit"`
+	Exclude      []string `json:"exclude,omitempty" nullable:"false" doc:"File name patterns (* and ? wildcards) deleted for good instead of being moved to the bin"`
+}
+
+// RecycleBinEntry is a deleted file waiting in the recycle bin of a user.
+type RecycleBinEntry struct {
+	Path      string    `json:"path" example:"docs/report.odt" doc:"Path relative to the user bin, which is also where the file is restored in the share"`
+	Size      uint64    `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// RecycleBinPurgeResult reports what a purge removed.
+type RecycleBinPurgeResult struct {
+	RemovedFiles uint   `json:"removed_files"`
+	FreedBytes   uint64 `json:"freed_bytes"`
+}
@@ -0,0 +1,45 @@
+package dto
+
+// RemoteMount is a CIFS share or an NFS export of another host mounted as a
+// volume of its own, which can be shared again or used as a backup target.
+type RemoteMount struct {
+	Name               string     `json:"name"`
+	Protocol           string     `json:"protocol" enum:"cifs,nfs"`
+	Server             string     `json:"server" doc:"Host name or address of the server"`
+	Share              string     `json:"share" doc:"Share name (cifs) or exported path (nfs)"`
+	Path               string     `json:"path" doc:"Mount path of the remote, e.g. /mnt/nas"`
+	Username           string     `json:"username,omitempty"`
+	Domain             string     `json:"domain,omitempty"`
+	HasPassword        bool       `json:"has_password" doc:"Whether a password is stored for the user"`
+	Flags              MountFlags `json:"flags,omitempty" doc:"Standard mount flags"`
+	CustomFlags        MountFlags `json:"custom_flags,omitempty" doc:"Mount flags of the protocol, see the custom mount flags of the filesystem"`
+	IsMounted          bool       `json:"is_mounted"`
+	IsReachable        bool       `json:"is_reachable" doc:"Whether the server answered the last health probe"`
+	IsToMountAtStartup bool       `json:"is_to_mount_at_startup" doc:"Mount the remote once the network is up, and mount it again after a network loss"`
+	PartitionId        string     `json:"partition_id" doc:"Id of the partition exposing the remote in the volumes"`
+}
+
+// RemoteMountCreateRequest describes a new remote mount.
+type RemoteMountCreateRequest struct {
+	Name               string          `json:"name" minLength:"1" maxLength:"64" pattern:"^[a-zA-Z0-9_-]+$" doc:"Name of the remote, mounted at /mnt/<name>"`
+	Protocol           string          `json:"protocol" enum:"cifs,nfs"`
+	Server             string          `json:"server" minLength:"1" maxLength:"253" pattern:"^[a-zA-Z0-9.:_\\[\\]-]+$" doc:"Host name or address of the server"`
+	Share              string          `json:"share" minLength:"1" doc:"Share name (cifs) or exported path (nfs)"`
+	Username           string          `json:"username,omitempty" doc:"User of a cifs share, empty for guest access"`
+	Password           *Secret[string] `json:"password,omitempty" writeOnly:"true" format:"password"`
+	Domain             string          `json:"domain,omitempty" doc:"Workgroup or domain of the user"`
+	Flags              MountFlags      `json:"flags,omitempty"`
+	CustomFlags        MountFlags      `json:"custom_flags,omitempty"`
+	IsToMountAtStartup *bool           `json:"is_to_mount_at_startup,omitempty" default:"true"`
+}
+
+// RemoteMountUpdateRequest changes the mount options, the credentials or the
+// startup mount of a remote. Absent fields are left unchanged.
+type RemoteMountUpdateRequest struct {
+	Username           *string         `json:"username,omitempty"`
+	Password           *Secret[string] `json:"password,omitempty" writeOnly:"true" format:"password"`
+	Domain             *string         `json:"domain,omitempty"`
+	Flags              *MountFlags     `json:"flags,omitempty"`
+	CustomFlags        *MountFlags     `json:"custom_flags,omitempty"`
+	IsToMountAtStartup *bool           `json:"is_to_mount_at_startup,omitempty"`
+}
@@ -34,6 +34,10 @@ type SambaStatus struct {
 	SmbConf   string                  `json:"smb_conf"`
 	Sessions  map[string]SambaSession `json:"sessions"`
 	Tcons     map[string]SambaTcon    `json:"tcons"`
+	// OpenFiles is keyed by the full path of the open file.
+	OpenFiles map[string]SambaOpenFile `json:"open_files,omitempty"`
+	// ByteRangeLocks is keyed by the full path of the locked file.
+	ByteRangeLocks map[string]SambaLockedFile `json:"byte_range_locks,omitempty"`
 }
 
 type SambaServerID struct {
@@ -91,3 +95,60 @@ type SambaTcon struct {
 		Degree string `json:"degree"`
 	} `json:"signing"`
 }
+
+// SambaFlags is a bit mask reported by smbstatus, with its textual form.
+type SambaFlags struct {
+	Hex  string `json:"hex,omitempty"`
+	Text string `json:"text"`
+}
+
+type SambaFileID struct {
+	DevID uint64 `json:"devid"`
+	Inode uint64 `json:"inode"`
+	ExtID uint64 `json:"extid"`
+}
+
+// SambaOpenFile is a file opened by one or more clients.
+type SambaOpenFile struct {
+	ServicePath       string      `json:"service_path"`
+	Filename          string      `json:"filename"`
+	FileID            SambaFileID `json:"fileid"`
+	NumPendingDeletes int         `json:"num_pending_deletes"`
+	// Opens is keyed by "<pid>/<share_file_id>", the open id.
+	Opens map[string]SambaFileOpen `json:"opens"`
+}
+
+// SambaFileOpen is an open handle of a file.
+type SambaFileOpen struct {
+	ServerID    SambaServerID `json:"server_id"`
+	UserID      uint64        `json:"uid"`
+	ShareFileID uint64        `json:"share_file_id"`
+	ShareMode   SambaFlags    `json:"sharemode"`
+	AccessMask  SambaFlags    `json:"access_mask"`
+	Caching     SambaFlags    `json:"caching"`
+	Oplock      SambaFlags    `json:"oplock"`
+	OpenedAt    CustomTime    `json:"opened_at"`
+}
+
+// SambaLockedFile is a file with byte-range locks.
+type SambaLockedFile struct {
+	FileID    SambaFileID      `json:"fileid"`
+	FileName  string           `json:"file_name"`
+	SharePath string           `json:"share_path"`
+	Locks     []SambaRangeLock `json:"locks"`
+}
+
+// SambaRangeLock is a byte-range lock held by a client.
+type SambaRangeLock struct {
+	ServerID SambaServerID `json:"server_id"`
+	Type     string        `json:"type" doc:"R for read, W for write locks"`
+	Flavour  string        `json:"flavour" doc:"Windows or Posix"`
+	Start    uint64        `json:"start"`
+	Size     uint64        `json:"size"`
+}
+
+// SambaDisconnectResult counts the sessions ended by a disconnect, or the
+// clients released by closing an open file.
+type SambaDisconnectResult struct {
+	Disconnected int `json:"disconnected"`
+}
@@ -252,3 +252,62 @@ func TestSambaStatus_JSON(t *testing.T) {
 	assert.Equal(t, "AES-128-GCM", status.Sessions["session-1"].Encryption.Cipher)
 	assert.Equal(t, "AES-128-CMAC", status.Sessions["session-1"].Signing.Cipher)
 }
+
+func TestSambaStatus_OpenFilesAndLocks_JSON(t *testing.T) {
+	jsonData := `{
+		"open_files": {
+			"/mnt/backup/mac.sparsebundle/token": {
+				"service_path": "/mnt/backup",
+				"filename": "mac.sparsebundle/token",
+				"fileid": {"devid": 2049, "inode": 1234, "extid": 0},
+				"num_pending_deletes": 0,
+				"opens": {
+					"4321/12": {
+						"server_id": {"pid": "4321", "task_id": "0", "vnn": "4294967295", "unique_id": "99"},
+						"uid": 1000,
+						"share_file_id": 12,
+						"sharemode": {"hex": "0x00000003", "READ": true, "WRITE": true, "DELETE": false, "text": "RW"},
+						"access_mask": {"hex": "0x0012019f", "READ_DATA": true, "text": "RW"},
+						"caching": {"hex": "0x00000007", "READ": true, "WRITE": true, "HANDLE": true, "text": "RWH"},
+						"oplock": {},
+						"opened_at": "2025-06-28T15:04:28.288225+0200"
+					}
+				}
+			}
+		},
+		"byte_range_locks": {
+			"/mnt/backup/mac.sparsebundle/token": {
+				"fileid": {"devid": 2049, "inode": 1234, "extid": 0},
+				"file_name": "mac.sparsebundle/token",
+				"share_path": "/mnt/backup",
+				"locks": [
+					{"server_id": {"pid": "4321"}, "type": "W", "flavour": "Posix", "start": 0, "size": 1}
+				]
+			}
+		}
+	}`
+
+	var status dto.SambaStatus
+	require.NoError(t, json.Unmarshal([]byte(jsonData), &status))
+
+	require.Contains(t, status.OpenFiles, "/mnt/backup/mac.sparsebundle/token")
+	file := status.OpenFiles["/mnt/backup/mac.sparsebundle/token"]
+	assert.Equal(t, "/mnt/backup", file.ServicePath)
+	assert.Equal(t, uint64(1234), file.FileID.Inode)
+	require.Contains(t, file.Opens, "4321/12")
+	open := file.Opens["4321/12"]
+	assert.Equal(t, "4321", open.ServerID.PID)
+	assert.Equal(t, uint64(12), open.ShareFileID)
+	assert.Equal(t, "RW", open.ShareMode.Text)
+	assert.Equal(t, "0x00000007", open.Caching.Hex)
+	assert.Empty(t, open.Oplock.Text)
+	assert.Equal(t, 2025, open.OpenedAt.Year())
+
+	require.Contains(t, status.ByteRangeLocks, "/mnt/backup/mac.sparsebundle/token")
+	locks := status.ByteRangeLocks["/mnt/backup/mac.sparsebundle/token"]
+	assert.Equal(t, "/mnt/backup", locks.SharePath)
+	require.Len(t, locks.Locks, 1)
+	assert.Equal(t, "W", locks.Locks[0].Type)
+	assert.Equal(t, "Posix", locks.Locks[0].Flavour)
+	assert.Equal(t, uint64(1), locks.Locks[0].Size)
+}
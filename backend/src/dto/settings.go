@@ -30,4 +30,48 @@ type Settings struct {
 	// "old" (addons, addon_configs), "new" (local_apps, app_configs), or
 	// "both". Defaults to both for backward compatibility.
 	StandardShareNames StandardShareNamesMode `json:"standard_share_names" enum:"old,new,both" default:"both"`
+	// HomesEnabled exports the [homes] share: every user gets a private
+	// directory under the HomesDir directory of HomesVolume.
+	HomesEnabled *bool `json:"homes_enabled,omitempty" default:"false"`
+	// HomesVolume is the mount point path of the volume holding the home
+	// directories.
+	HomesVolume string `json:"homes_volume,omitempty"`
+	// HomesQuotaBytes caps the space each user can use on HomesVolume, 0 is
+	// unlimited. It needs a filesystem with user quotas.
+	HomesQuotaBytes uint64 `json:"homes_quota_bytes,omitempty"`
+	// HomesDeletePolicy tells what happens to the home directory of a
+	// deleted user.
+	HomesDeletePolicy HomesDeletePolicy `json:"homes_delete_policy" enum:"keep,archive,remove" default:"archive"`
+	// AuditRetentionDays is how long the audit events of the shares are
+	// kept.
+	AuditRetentionDays uint `json:"audit_retention_days,omitempty" minimum:"1" maximum:"3650" default:"90"`
+	// IntrusionProtection bans the clients failing too many logins:
+	// IntrusionMaxFailures within IntrusionWindowMinutes ban the client
+	// address for IntrusionBanMinutes.
+	IntrusionProtection    *bool `json:"intrusion_protection,omitempty" default:"false"`
+	IntrusionMaxFailures   uint  `json:"intrusion_max_failures,omitempty" minimum:"1" maximum:"1000" default:"5"`
+	IntrusionWindowMinutes uint  `json:"intrusion_window_minutes,omitempty" minimum:"1" maximum:"1440" default:"10"`
+	IntrusionBanMinutes    uint  `json:"intrusion_ban_minutes,omitempty" minimum:"1" maximum:"525600" default:"60"`
+	// MQTTEnabled publishes disks, volumes, shares, SMART, HDIdle and Samba
+	// sessions to the MQTT broker at MQTTHost:MQTTPort, with Home Assistant
+	// MQTT discovery under MQTTDiscoveryPrefix. State and command topics
+	// start with MQTTTopic.
+	MQTTEnabled  *bool                  `json:"mqtt_enabled,omitempty" default:"false"`
+	MQTTHost     string                 `json:"mqtt_host,omitempty" default:"core-mosquitto"`
+	MQTTPort     uint                   `json:"mqtt_port,omitempty" minimum:"1" maximum:"65535" default:"1883"`
+	MQTTUsername string                 `json:"mqtt_username,omitempty"`
+	MQTTPassword logfusc.Secret[string] `json:"-"`
+	// MQTTTLS connects to the broker over TLS, MQTTTLSInsecure accepts a
+	// certificate that is not trusted, as a self signed one.
+	MQTTTLS             *bool  `json:"mqtt_tls,omitempty" default:"false"`
+	MQTTTLSInsecure     *bool  `json:"mqtt_tls_insecure,omitempty" default:"false"`
+	MQTTTopic           string `json:"mqtt_topic,omitempty" pattern:"^[A-Za-z0-9_-]+$" default:"srat"`
+	MQTTDiscoveryPrefix string `json:"mqtt_discovery_prefix,omitempty" pattern:"^[A-Za-z0-9_-]+$" default:"homeassistant"`
+}
+
+// SettingsUpdate is the body of a settings update. The secrets are write-only:
+// they are never returned, and an empty one keeps the stored value.
+type SettingsUpdate struct {
+	Settings
+	MQTTPassword *Secret[string] `json:"mqtt_password,omitempty" writeOnly:"true" format:"password"`
 }
@@ -0,0 +1,55 @@
+package dto
+
+// Default POSIX settings used when a share does not define its own.
+const (
+	DefaultShareOwner    = "root"
+	DefaultShareGroup    = "root"
+	DefaultShareFileMode = "0664"
+	DefaultShareDirMode  = "0775"
+)
+
+// SharePermissions is the POSIX ownership model of a share root.
+//
+// Owner and Group are rendered as `force user`/`force group`, so every file
+// written through Samba gets them; FileMode and DirMode become the create and
+// directory masks. With InheritAcls the masks are not forced and new entries
+// inherit the ACLs of their parent directory, stored by acl_xattr.
+type SharePermissions struct {
+	Owner       string `json:"owner,omitempty" pattern:"^[a-zA-Z0-9_-]*$" maxLength:"30" example:"root" doc:"Unix user owning the share (default root)"`
+	Group       string `json:"group,omitempty" pattern:"^[a-zA-Z0-9_-]*$" maxLength:"30" example:"root" doc:"Unix group owning the share (default root)"`
+	FileMode    string `json:"file_mode,omitempty" pattern:"^(0?[0-7]{3})?$" example:"0664" doc:"Mode of new files (default 0664)"`
+	DirMode     string `json:"dir_mode,omitempty" pattern:"^(0?[0-7]{3})?$" example:"0775" doc:"Mode of new directories (default 0775)"`
+	InheritAcls bool   `json:"inherit_acls,omitempty" doc:"Inherit ACLs from the parent directory instead of forcing the modes"`
+}
+
+// EffectiveOwner returns the owner, falling back to DefaultShareOwner.
+func (p *SharePermissions) EffectiveOwner() string {
+	if p == nil || p.Owner == "" {
+		return DefaultShareOwner
+	}
+	return p.Owner
+}
+
+// EffectiveGroup returns the group, falling back to DefaultShareGroup.
+func (p *SharePermissions) EffectiveGroup() string {
+	if p == nil || p.Group == "" {
+		return DefaultShareGroup
+	}
+	return p.Group
+}
+
+// EffectiveFileMode returns the file mode, falling back to DefaultShareFileMode.
+func (p *SharePermissions) EffectiveFileMode() string {
+	if p == nil || p.FileMode == "" {
+		return DefaultShareFileMode
+	}
+	return p.FileMode
+}
+
+// EffectiveDirMode returns the directory mode, falling back to DefaultShareDirMode.
+func (p *SharePermissions) EffectiveDirMode() string {
+	if p == nil || p.DirMode == "" {
+		return DefaultShareDirMode
+	}
+	return p.DirMode
+}
@@ -1,22 +1,49 @@
 package dto
 
+import "path/filepath"
+
 type SharedResource struct {
 	_                  struct{}              `json:"-" additionalProperties:"true"`
 	Name               string                `json:"name,omitempty"  mapper:"mapkey" maxLength:"128"`
 	Disabled           *bool                 `json:"disabled,omitempty"`
 	Users              []User                `json:"users,omitempty"`
 	RoUsers            []User                `json:"ro_users,omitempty"`
+	Groups             []string              `json:"groups,omitempty" nullable:"false" doc:"Groups granted read/write access, rendered as @group"`
+	RoGroups           []string              `json:"ro_groups,omitempty" nullable:"false" doc:"Groups granted read-only access, rendered as @group"`
 	TimeMachine        *bool                 `json:"timemachine,omitempty"`
 	RecycleBin         *bool                 `json:"recycle_bin_enabled,omitempty"`
 	GuestOk            *bool                 `json:"guest_ok,omitempty"`
 	TimeMachineMaxSize *string               `json:"timemachine_max_size,omitempty"`
 	Usage              HAMountUsage          `json:"usage,omitempty" enum:"none,backup,media,share,internal"`
 	VetoFiles          []string              `json:"veto_files,omitempty"  nullable:"false"`
+	SmbEncrypt         SmbEncryptMode        `json:"smb_encrypt,omitempty" enum:"default,off,if_required,desired,required"`
+	SmbSigning         SmbSigningMode        `json:"smb_signing,omitempty" enum:"default,auto,mandatory"`
+	SmbMinProtocol     SmbProtocol           `json:"smb_min_protocol,omitempty" enum:"default,NT1,SMB2_02,SMB2_10,SMB3_00,SMB3_02,SMB3_11"`
+	Permissions        *SharePermissions     `json:"permissions,omitempty"`
+	QuotaBytes         *uint64               `json:"quota_bytes,omitempty" doc:"Hard limit of the share in bytes, 0 removes the quota"`
+	UserQuotas         []UserQuota           `json:"user_quotas,omitempty" nullable:"false"`
+	Snapshots          *SnapshotPolicy       `json:"snapshots,omitempty"`
+	RecycleBinPolicy   *RecycleBinPolicy     `json:"recycle_bin_policy,omitempty" doc:"Retention of the recycle bin, applied when recycle_bin_enabled is set"`
+	Audit              *ShareAudit           `json:"audit,omitempty"`
 	MountPointData     *MountPointData       `json:"mount_point_data,omitempty"`
+	SubPath            string                `json:"sub_path,omitempty" maxLength:"4096" example:"photos" doc:"Directory exported by the share, relative to the mount point. Empty exports the whole volume"`
 	Status             *SharedResourceStatus `json:"status,omitempty" read-only:"true"`
 }
 
 type SharedResourceStatus struct {
-	IsValid     bool `json:"is_valid" default:"false" read-only:"true"`
-	IsHAMounted bool `json:"is_ha_mounted,omitempty" default:"false" read-only:"true"`
+	IsValid     bool              `json:"is_valid" default:"false" read-only:"true"`
+	IsHAMounted bool              `json:"is_ha_mounted,omitempty" default:"false" read-only:"true"`
+	Quota       *ShareQuotaStatus `json:"quota,omitempty" read-only:"true"`
+}
+
+// ExportPath is the directory exported by the share: the mount point path
+// followed by SubPath. It is empty without mount point data.
+func (s SharedResource) ExportPath() string {
+	if s.MountPointData == nil || s.MountPointData.Path == "" {
+		return ""
+	}
+	if s.SubPath == "" {
+		return s.MountPointData.Path
+	}
+	return filepath.Join(s.MountPointData.Path, s.SubPath)
 }
@@ -1,11 +1,12 @@
 package dto
 
 type SmartRangeValue struct {
-	Code       int `json:"code,omitempty"`
-	Value      int `json:"value"`
-	Min        int `json:"min,omitempty"`
-	Worst      int `json:"worst,omitempty"`
-	Thresholds int `json:"thresholds,omitempty"`
+	Code       int   `json:"code,omitempty"`
+	Value      int   `json:"value"`
+	Min        int   `json:"min,omitempty"`
+	Worst      int   `json:"worst,omitempty"`
+	Thresholds int   `json:"thresholds,omitempty"`
+	Raw        int64 `json:"raw,omitempty" doc:"Raw value of the attribute, the count for the error counters"`
 }
 
 type SmartTempValue struct {
@@ -51,6 +52,7 @@ type SmartTestStatus struct {
 	TestType        string `json:"test_type"`                  // Type of test
 	PercentComplete int    `json:"percent_complete,omitempty"` // Percentage complete (0-100)
 	LBAOfFirstError string `json:"lba_of_first_error,omitempty"`
+	Passed          *bool  `json:"passed,omitempty"` // Outcome of the last test, unset while running, when aborted or unknown
 }
 
 // SmartHealthStatus represents the overall health status of a disk
@@ -0,0 +1,23 @@
+package dto
+
+import "time"
+
+// SmartFinding is a worrying SMART attribute found by the trend analysis.
+type SmartFinding struct {
+	Attribute string          `json:"attribute" example:"Reallocated_Sector_Ct"`
+	Value     int64           `json:"value"`
+	Baseline  *int64          `json:"baseline,omitempty" doc:"Value when SRAT first read the attribute"`
+	Since     *time.Time      `json:"since,omitempty" doc:"When the baseline was read"`
+	Severity  ProblemSeverity `json:"severity" enum:"info,warning,error,critical"`
+	Message   string          `json:"message"`
+}
+
+// SmartPrediction is the outcome of the SMART trend analysis of a disk.
+type SmartPrediction struct {
+	DiskId            string          `json:"disk_id"`
+	Severity          ProblemSeverity `json:"severity" enum:"info,warning,error,critical" doc:"Highest severity of the findings, info when there are none"`
+	Findings          []SmartFinding  `json:"findings"`
+	WearPercent       *int            `json:"wear_percent,omitempty" doc:"Rated endurance used, SSDs only"`
+	RemainingLifeDays *int            `json:"remaining_life_days,omitempty" doc:"Days before the SSD reaches its rated endurance at the observed wear rate"`
+	AnalyzedAt        time.Time       `json:"analyzed_at"`
+}
@@ -0,0 +1,48 @@
+package dto
+
+import "time"
+
+// Default schedules of the SMART self-tests of a disk.
+const (
+	SmartTestDefaultShortSchedule = "0 2 * * *" // daily
+	SmartTestDefaultLongSchedule  = "0 3 1 * *" // monthly
+)
+
+// SmartTestOutcome is the result of a completed SMART self-test.
+type SmartTestOutcome string
+
+const (
+	SmartTestOutcomePassed SmartTestOutcome = "passed"
+	SmartTestOutcomeFailed SmartTestOutcome = "failed"
+	// SmartTestOutcomeAborted is recorded when the test was aborted by the
+	// host or interrupted by a reset.
+	SmartTestOutcomeAborted SmartTestOutcome = "aborted"
+	// SmartTestOutcomeUnknown is recorded when the disk does not report how
+	// the test ended.
+	SmartTestOutcomeUnknown SmartTestOutcome = "unknown"
+)
+
+// SmartTestSchedule tells when the SMART self-tests of a disk run.
+type SmartTestSchedule struct {
+	DiskId        string     `json:"disk_id" readOnly:"true"`
+	Enabled       bool       `json:"enabled"`
+	ShortSchedule string     `json:"short_schedule,omitempty" maxLength:"128" example:"0 2 * * *" doc:"Cron expression of the short self-test, empty to never run it"`
+	LongSchedule  string     `json:"long_schedule,omitempty" maxLength:"128" example:"0 3 1 * *" doc:"Cron expression of the long self-test, empty to never run it"`
+	Group         string     `json:"group,omitempty" maxLength:"64" example:"usb-hub-1" doc:"Disks of the same group, e.g. behind the same USB hub or power supply, never test at the same time"`
+	Force         bool       `json:"force,omitempty" doc:"Run the tests even when the disk is spun down by HDIdle, instead of waiting for it to spin up"`
+	NextShortAt   *time.Time `json:"next_short_at,omitempty" readOnly:"true"`
+	NextLongAt    *time.Time `json:"next_long_at,omitempty" readOnly:"true"`
+}
+
+// SmartTestResult is a completed SMART self-test.
+type SmartTestResult struct {
+	ID              uint             `json:"id"`
+	DiskId          string           `json:"disk_id"`
+	TestType        SmartTestType    `json:"test_type"`
+	Trigger         JobTrigger       `json:"trigger" enum:"schedule,manual"`
+	Outcome         SmartTestOutcome `json:"outcome" enum:"passed,failed,aborted,unknown"`
+	Status          string           `json:"status,omitempty" doc:"Status reported by the disk"`
+	LBAOfFirstError string           `json:"lba_of_first_error,omitempty"`
+	StartedAt       time.Time        `json:"started_at"`
+	FinishedAt      time.Time        `json:"finished_at"`
+}
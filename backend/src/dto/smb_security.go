@@ -0,0 +1,79 @@
+package dto
+
+// SmbEncryptMode is the per-share SMB3 encryption policy rendered as
+// `server smb encrypt` (Samba >= 4.15) or `smb encrypt` (older releases).
+type SmbEncryptMode string
+
+const (
+	// SmbEncryptDefault inherits the global Samba policy (no per-share line).
+	SmbEncryptDefault    SmbEncryptMode = "default"
+	SmbEncryptOff        SmbEncryptMode = "off"
+	SmbEncryptIfRequired SmbEncryptMode = "if_required"
+	SmbEncryptDesired    SmbEncryptMode = "desired"
+	SmbEncryptRequired   SmbEncryptMode = "required"
+)
+
+// SmbSigningMode is the signing requirement a share asks for.
+//
+// Samba only knows `server signing` as a global parameter because signing is
+// negotiated at session setup, before the client picks a share. The strictest
+// value requested by an enabled share is therefore applied to the server.
+type SmbSigningMode string
+
+const (
+	// SmbSigningDefault keeps the global `server signing = auto`.
+	SmbSigningDefault   SmbSigningMode = "default"
+	SmbSigningAuto      SmbSigningMode = "auto"
+	SmbSigningMandatory SmbSigningMode = "mandatory"
+)
+
+// SmbProtocol is an SMB dialect name as used by Samba `%R` and
+// `server min protocol`.
+type SmbProtocol string
+
+const (
+	// SmbProtocolDefault keeps the global `server min protocol`.
+	SmbProtocolDefault SmbProtocol = "default"
+	SmbProtocolNT1     SmbProtocol = "NT1"
+	SmbProtocolSMB2_02 SmbProtocol = "SMB2_02"
+	SmbProtocolSMB2_10 SmbProtocol = "SMB2_10"
+	SmbProtocolSMB3_00 SmbProtocol = "SMB3_00"
+	SmbProtocolSMB3_02 SmbProtocol = "SMB3_02"
+	SmbProtocolSMB3_11 SmbProtocol = "SMB3_11"
+)
+
+// SmbProtocols lists the known dialects from the oldest to the newest.
+var SmbProtocols = []SmbProtocol{
+	SmbProtocolNT1,
+	SmbProtocolSMB2_02,
+	SmbProtocolSMB2_10,
+	SmbProtocolSMB3_00,
+	SmbProtocolSMB3_02,
+	SmbProtocolSMB3_11,
+}
+
+// IsDefault reports whether the value leaves the global setting untouched.
+func (m SmbEncryptMode) IsDefault() bool {
+	return m == "" || m == SmbEncryptDefault
+}
+
+// IsDefault reports whether the value leaves the global setting untouched.
+func (m SmbSigningMode) IsDefault() bool {
+	return m == "" || m == SmbSigningDefault
+}
+
+// IsDefault reports whether the value leaves the global setting untouched.
+func (p SmbProtocol) IsDefault() bool {
+	return p == "" || p == SmbProtocolDefault
+}
+
+// Rank returns the position of the dialect in SmbProtocols, or -1 when the
+// dialect is unknown or the default.
+func (p SmbProtocol) Rank() int {
+	for i, known := range SmbProtocols {
+		if known == p {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,46 @@
+package dto
+
+import "time"
+
+// SnapshotTimeLayout is the Go layout of snapshot names. It matches the
+// `shadow:format = GMT-%Y.%m.%d-%H.%M.%S` rendered for vfs_shadow_copy2, so
+// every snapshot shows up as a Windows "Previous Version".
+const SnapshotTimeLayout = "GMT-2006.01.02-15.04.05"
+
+// SnapshotPolicy enables snapshots on a share. The Keep* counts are
+// retention windows: the newest snapshot of each of the last N hours, days
+// and ISO weeks is kept, every other snapshot is deleted. A snapshot is taken
+// automatically each hour, day or week, following the finest non-zero window.
+type SnapshotPolicy struct {
+	ShadowCopy bool `json:"shadow_copy,omitempty" doc:"Expose snapshots as Windows Previous Versions"`
+	KeepHourly uint `json:"keep_hourly,omitempty" maximum:"168" doc:"Hourly snapshots to keep, 0 disables them"`
+	KeepDaily  uint `json:"keep_daily,omitempty" maximum:"366" doc:"Daily snapshots to keep, 0 disables them"`
+	KeepWeekly uint `json:"keep_weekly,omitempty" maximum:"520" doc:"Weekly snapshots to keep, 0 disables them"`
+}
+
+// IsScheduled reports whether the policy takes snapshots automatically.
+func (p *SnapshotPolicy) IsScheduled() bool {
+	return p != nil && (p.KeepHourly > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0)
+}
+
+// Snapshot is a read-only, point in time copy of a share.
+type Snapshot struct {
+	Name      string    `json:"name" example:"GMT-2026.01.31-18.00.00"`
+	CreatedAt time.Time `json:"created_at"`
+	Path      string    `json:"path" doc:"Directory where the snapshot content can be browsed"`
+}
+
+// SnapshotName returns the name of a snapshot taken at t.
+func SnapshotName(t time.Time) string {
+	return t.UTC().Format(SnapshotTimeLayout)
+}
+
+// ParseSnapshotName returns the creation time encoded in a snapshot name.
+// Names not following SnapshotTimeLayout do not belong to SRAT.
+func ParseSnapshotName(name string) (time.Time, bool) {
+	t, err := time.ParseInLocation(SnapshotTimeLayout, name, time.UTC)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,60 @@
+package dto
+
+import "time"
+
+// Metrics stored in the statistics history. Disk metrics are kept per disk
+// id, network metrics per interface and SMART attributes per disk id and
+// attribute name, joined by a slash.
+const (
+	StatsDiskReadIOPS      = "disk_read_iops"
+	StatsDiskWriteIOPS     = "disk_write_iops"
+	StatsDiskReadLatency   = "disk_read_latency_ms"
+	StatsDiskWriteLatency  = "disk_write_latency_ms"
+	StatsNetworkReceive    = "network_receive_bytes_per_second"
+	StatsNetworkTransmit   = "network_transmit_bytes_per_second"
+	StatsSmartTemperature  = "smart_temperature_celsius"
+	StatsSmartPowerOnHours = "smart_power_on_hours"
+	StatsSmartPowerCycles  = "smart_power_cycles"
+	StatsSmartAttribute    = "smart_attribute"
+)
+
+// StatsMetrics lists the metrics of the statistics history.
+var StatsMetrics = []string{
+	StatsDiskReadIOPS, StatsDiskWriteIOPS, StatsDiskReadLatency, StatsDiskWriteLatency,
+	StatsNetworkReceive, StatsNetworkTransmit,
+	StatsSmartTemperature, StatsSmartPowerOnHours, StatsSmartPowerCycles, StatsSmartAttribute,
+}
+
+// StatsSample is a value of a metric series, taken at a point in time.
+type StatsSample struct {
+	Metric string
+	Series string
+	Value  float64
+}
+
+// StatsPoint summarizes the samples of a series within a step.
+type StatsPoint struct {
+	Time time.Time `json:"time" doc:"Start of the step"`
+	Avg  float64   `json:"avg"`
+	Min  float64   `json:"min"`
+	Max  float64   `json:"max"`
+}
+
+// StatsSeries is the history of a metric for a disk, an interface or a SMART
+// attribute.
+type StatsSeries struct {
+	Metric string       `json:"metric" example:"smart_temperature_celsius"`
+	Series string       `json:"series" example:"WDC-WD40EFRX-68N32N0_WD-WCC7K0000000" doc:"Disk id, network interface or disk id/SMART attribute"`
+	Step   int64        `json:"step" doc:"Seconds between two points"`
+	Points []StatsPoint `json:"points"`
+}
+
+// StatsHistoryQuery selects the history of a metric. An empty Series matches
+// every series, a zero Step picks one giving a few hundred points.
+type StatsHistoryQuery struct {
+	Metric string
+	Series string
+	From   time.Time
+	To     time.Time
+	Step   time.Duration
+}
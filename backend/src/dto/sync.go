@@ -0,0 +1,48 @@
+package dto
+
+// SyncMode tells how a sync job treats the destination.
+type SyncMode string
+
+const (
+	// SyncModeMirror makes the destination an exact copy of the source,
+	// deleting what the source no longer has.
+	SyncModeMirror SyncMode = "mirror"
+	// SyncModeAppend copies new and changed files and never deletes.
+	SyncModeAppend SyncMode = "append"
+	// SyncModeVersioned mirrors the source, moving replaced and deleted
+	// files under SyncVersionsDir instead of losing them.
+	SyncModeVersioned SyncMode = "versioned"
+)
+
+// SyncDestinationType is the kind of destination of a sync job.
+type SyncDestinationType string
+
+const (
+	// SyncDestinationShare is another share, by name.
+	SyncDestinationShare SyncDestinationType = "share"
+	// SyncDestinationPath is an absolute local path, such as a mounted
+	// remote filesystem.
+	SyncDestinationPath SyncDestinationType = "path"
+	// SyncDestinationRsync is an rsync daemon (rsync://host/module/path) or
+	// an SSH target ([user@]host:path).
+	SyncDestinationRsync SyncDestinationType = "rsync"
+)
+
+// SyncVersionsDir is the directory, relative to the destination root, where
+// versioned syncs keep the previous copies. Each run has a sub directory.
+const SyncVersionsDir = ".versions"
+
+// SyncOptions are the options of a sync job, parsed from the job options
+// "destination_type", "destination", "mode", "bwlimit_kbps" and
+// "ssh_host_key".
+type SyncOptions struct {
+	DestinationType SyncDestinationType
+	Destination     string
+	Mode            SyncMode
+	// SSHHostKey is the public key of an SSH target, as "<type> <base64>"
+	// like a known_hosts entry. It is required for SSH targets, whose key
+	// is never accepted on first use.
+	SSHHostKey string
+	// BandwidthLimitKBps caps the transfer rate in KiB/s, 0 is unlimited.
+	BandwidthLimitKBps uint
+}
@@ -21,6 +21,8 @@ var WebEventMap = WebEventMapTypes{
 	WebEventTypes.EVENTCOMMANDSTARTED.String():    CommandStartedNotification{},
 	WebEventTypes.EVENTCOMMANDOUTPUT.String():     CommandOutputNotification{},
 	WebEventTypes.EVENTCOMMANDTERMINATED.String(): CommandTerminatedNotification{},
+	WebEventTypes.EVENTJOBRUN.String():            JobRun{},
+	WebEventTypes.EVENTRAIDARRAY.String():         RaidArray{},
 }
 
 func (WebEventMapTypes) IsValidEvent(event any) bool {
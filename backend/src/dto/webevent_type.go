@@ -20,4 +20,6 @@ const (
 	eventCommandStarted                        // "command_started"
 	eventCommandOutput                         // "command_output"
 	eventCommandTerminated                     // "command_terminated"
+	eventJobRun                                // "job_run"
+	eventRaidArray                             // "raid_array"
 )
@@ -28,6 +28,8 @@ func TestWebEventType_String(t *testing.T) {
 		{"Command Started", dto.WebEventTypes.EVENTCOMMANDSTARTED, "command_started"},
 		{"Command Output", dto.WebEventTypes.EVENTCOMMANDOUTPUT, "command_output"},
 		{"Command Terminated", dto.WebEventTypes.EVENTCOMMANDTERMINATED, "command_terminated"},
+		{"Job Run", dto.WebEventTypes.EVENTJOBRUN, "job_run"},
+		{"Raid Array", dto.WebEventTypes.EVENTRAIDARRAY, "raid_array"},
 	}
 
 	for _, tt := range tests {
@@ -57,6 +59,8 @@ func TestWebEventType_IsValidEvent_ValidTypes(t *testing.T) {
 		{"Valid CommandStartedNotification", dto.CommandStartedNotification{}},
 		{"Valid CommandOutputNotification", dto.CommandOutputNotification{}},
 		{"Valid CommandTerminatedNotification", dto.CommandTerminatedNotification{}},
+		{"Valid JobRun", dto.JobRun{}},
+		{"Valid RaidArray", dto.RaidArray{}},
 	}
 
 	for _, tt := range tests {
@@ -103,6 +107,8 @@ func TestWebEventMap_ContainsAllEventTypes(t *testing.T) {
 		"command_started",
 		"command_output",
 		"command_terminated",
+		"job_run",
+		"raid_array",
 	}
 
 	for _, key := range expectedKeys {
@@ -111,7 +117,7 @@ func TestWebEventMap_ContainsAllEventTypes(t *testing.T) {
 }
 
 func TestWebEventMap_Size(t *testing.T) {
-	assert.Len(t, dto.WebEventMap, 16, "WebEventMap should contain exactly 16 event types")
+	assert.Len(t, dto.WebEventMap, 18, "WebEventMap should contain exactly 18 event types")
 }
 
 func TestWebEventType_IsValidEvent_WithConcreteTypes(t *testing.T) {
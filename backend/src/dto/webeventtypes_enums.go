@@ -39,6 +39,8 @@ type webEventTypesContainer struct {
 	EVENTCOMMANDSTARTED    WebEventType
 	EVENTCOMMANDOUTPUT     WebEventType
 	EVENTCOMMANDTERMINATED WebEventType
+	EVENTJOBRUN            WebEventType
+	EVENTRAIDARRAY         WebEventType
 }
 
 // WebEventTypes is a main entry point using the WebEventType type.
@@ -92,6 +94,12 @@ var WebEventTypes = webEventTypesContainer{
 	EVENTCOMMANDTERMINATED: WebEventType{
 		webEventType: eventCommandTerminated,
 	},
+	EVENTJOBRUN: WebEventType{
+		webEventType: eventJobRun,
+	},
+	EVENTRAIDARRAY: WebEventType{
+		webEventType: eventRaidArray,
+	},
 }
 
 // invalidWebEventType is an invalid sentinel value for WebEventType
@@ -119,6 +127,8 @@ func (w webEventTypesContainer) allSlice() []WebEventType {
 		WebEventTypes.EVENTCOMMANDSTARTED,
 		WebEventTypes.EVENTCOMMANDOUTPUT,
 		WebEventTypes.EVENTCOMMANDTERMINATED,
+		WebEventTypes.EVENTJOBRUN,
+		WebEventTypes.EVENTRAIDARRAY,
 	}
 }
 
@@ -221,6 +231,8 @@ var webEventTypesNameMap = map[string]WebEventType{
 	"command_started":    WebEventTypes.EVENTCOMMANDSTARTED,
 	"command_output":     WebEventTypes.EVENTCOMMANDOUTPUT,
 	"command_terminated": WebEventTypes.EVENTCOMMANDTERMINATED,
+	"job_run":            WebEventTypes.EVENTJOBRUN,
+	"raid_array":         WebEventTypes.EVENTRAIDARRAY,
 }
 
 // stringToWebEventType converts a string representation of an enum value into its WebEventType representation
@@ -340,6 +352,18 @@ func numberToWebEventType[T interface {
 			return nil
 		}
 		return &result
+	case 16:
+		result := WebEventTypes.EVENTJOBRUN
+		if !result.IsValid() {
+			return nil
+		}
+		return &result
+	case 17:
+		result := WebEventTypes.EVENTRAIDARRAY
+		if !result.IsValid() {
+			return nil
+		}
+		return &result
 	default:
 		return nil
 	}
@@ -371,6 +395,8 @@ var validWebEventTypes = map[WebEventType]bool{
 	WebEventTypes.EVENTCOMMANDSTARTED:    true,
 	WebEventTypes.EVENTCOMMANDOUTPUT:     true,
 	WebEventTypes.EVENTCOMMANDTERMINATED: true,
+	WebEventTypes.EVENTJOBRUN:            true,
+	WebEventTypes.EVENTRAIDARRAY:         true,
 }
 
 // IsValid checks whether the WebEventTypes value is valid.
@@ -479,7 +505,7 @@ func (w *WebEventType) UnmarshalYAML(by []byte) error {
 }
 
 // webeventtypeNames is a constant string containing the canonical names for all enum values.
-const webeventtypeNames = "helloupdatingvolumesheartbeatsharesdirty_data_trackersmart_test_statusfilesystem_taskerrorrepair_commandproblemapp_config_changedmdns_registercommand_startedcommand_outputcommand_terminated"
+const webeventtypeNames = "helloupdatingvolumesheartbeatsharesdirty_data_trackersmart_test_statusfilesystem_taskerrorrepair_commandproblemapp_config_changedmdns_registercommand_startedcommand_outputcommand_terminatedjob_runraid_array"
 
 // webeventtypeNamesMap is a map of enum values to their canonical absolute
 // name positions within the webeventtypeNames string slice
@@ -500,6 +526,8 @@ var webeventtypeNamesMap = map[WebEventType]string{
 	WebEventTypes.EVENTCOMMANDSTARTED:    webeventtypeNames[142:157],
 	WebEventTypes.EVENTCOMMANDOUTPUT:     webeventtypeNames[157:171],
 	WebEventTypes.EVENTCOMMANDTERMINATED: webeventtypeNames[171:189],
+	WebEventTypes.EVENTJOBRUN:            webeventtypeNames[189:196],
+	WebEventTypes.EVENTRAIDARRAY:         webeventtypeNames[196:206],
 }
 
 // String implements the Stringer interface.
@@ -518,7 +546,7 @@ func _() {
 	// An "invalid array index" compiler error signifies that the constant values have changed.
 	// Re-run the goenums command to generate them again.
 	// Does not identify newly added constant values unless order changes
-	var x [16]struct{}
+	var x [18]struct{}
 	_ = x[eventHello]
 	_ = x[eventUpdating-1]
 	_ = x[eventVolumes-2]
@@ -535,4 +563,6 @@ func _() {
 	_ = x[eventCommandStarted-13]
 	_ = x[eventCommandOutput-14]
 	_ = x[eventCommandTerminated-15]
+	_ = x[eventJobRun-16]
+	_ = x[eventRaidArray-17]
 }
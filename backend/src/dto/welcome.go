@@ -3,7 +3,7 @@ package dto
 type Welcome struct {
 	Message         string         `json:"message"`
 	ActiveClients   int32          `json:"active_clients"`
-	SupportedEvents []WebEventType `json:"supported_events" enum:"hello,updating,volumes,heartbeat,shares,dirty_data_tracker,smart_test_status,filesystem_task,error,repair_command,problem,app_config_changed,mdns_register,command_started,command_output,command_terminated"`
+	SupportedEvents []WebEventType `json:"supported_events" enum:"hello,updating,volumes,heartbeat,shares,dirty_data_tracker,smart_test_status,filesystem_task,error,repair_command,problem,app_config_changed,mdns_register,command_started,command_output,command_terminated,job_run,raid_array"`
 	UpdateChannel   string         `json:"update_channel" enum:"None,Develop,Release,Prerelease"`
 	MachineId       *string        `json:"machine_id,omitempty"`
 	BuildVersion    string         `json:"build_version"`
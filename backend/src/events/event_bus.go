@@ -214,6 +214,10 @@ type EventBusInterface interface {
 	EmitUser(event UserEvent)
 	OnUser(handler func(context.Context, UserEvent) errors.E) func()
 
+	// Group events
+	EmitGroup(event GroupEvent)
+	OnGroup(handler func(context.Context, GroupEvent) errors.E) func()
+
 	// Setting events
 	EmitSetting(event SettingEvent)
 	OnSetting(handler func(context.Context, SettingEvent) errors.E) func()
@@ -254,6 +258,14 @@ type EventBusInterface interface {
 	// Problem events
 	EmitProblem(event ProblemEvent)
 	OnProblem(handler func(context.Context, ProblemEvent) errors.E) func()
+
+	// Scheduled job run events
+	EmitJob(event JobEvent)
+	OnJob(handler func(context.Context, JobEvent) errors.E) func()
+
+	// Software RAID array events
+	EmitRaid(event RaidEvent)
+	OnRaid(handler func(context.Context, RaidEvent) errors.E) func()
 }
 
 // EventBus implements EventBusInterface using maniartech/signals SyncSignal
@@ -266,6 +278,7 @@ type EventBus struct {
 	share            signals.SyncSignal[ShareEvent]
 	mountPoint       signals.SyncSignal[MountPointEvent]
 	user             signals.SyncSignal[UserEvent]
+	group            signals.SyncSignal[GroupEvent]
 	setting          signals.SyncSignal[SettingEvent]
 	appConfig        signals.SyncSignal[AppConfigEvent]
 	samba            signals.SyncSignal[ServerProcessEvent]
@@ -277,6 +290,8 @@ type EventBus struct {
 	filesystemTask   signals.SyncSignal[FilesystemTaskEvent]
 	commandExecution signals.SyncSignal[CommandExecutionEvent]
 	problem          signals.SyncSignal[ProblemEvent]
+	job              signals.SyncSignal[JobEvent]
+	raid             signals.SyncSignal[RaidEvent]
 }
 
 // NewEventBus creates a new EventBus instance
@@ -288,6 +303,7 @@ func NewEventBus(ctx context.Context) EventBusInterface {
 		share:            *signals.NewSync[ShareEvent](),
 		mountPoint:       *signals.NewSync[MountPointEvent](),
 		user:             *signals.NewSync[UserEvent](),
+		group:            *signals.NewSync[GroupEvent](),
 		setting:          *signals.NewSync[SettingEvent](),
 		appConfig:        *signals.NewSync[AppConfigEvent](),
 		samba:            *signals.NewSync[ServerProcessEvent](),
@@ -299,6 +315,8 @@ func NewEventBus(ctx context.Context) EventBusInterface {
 		filesystemTask:   *signals.NewSync[FilesystemTaskEvent](),
 		commandExecution: *signals.NewSync[CommandExecutionEvent](),
 		problem:          *signals.NewSync[ProblemEvent](),
+		job:              *signals.NewSync[JobEvent](),
+		raid:             *signals.NewSync[RaidEvent](),
 	}
 }
 
@@ -397,6 +415,15 @@ func (eb *EventBus) OnUser(handler func(context.Context, UserEvent) errors.E) fu
 	return onEvent(eb.user, "User", handler)
 }
 
+// Group event methods
+func (eb *EventBus) EmitGroup(event GroupEvent) {
+	_ = emitEvent(eb.group, eb.ctx, event)
+}
+
+func (eb *EventBus) OnGroup(handler func(context.Context, GroupEvent) errors.E) func() {
+	return onEvent(eb.group, "Group", handler)
+}
+
 // Setting event methods
 func (eb *EventBus) EmitSetting(event SettingEvent) {
 	_ = emitEvent(eb.setting, eb.ctx, event)
@@ -495,3 +522,21 @@ func (eb *EventBus) EmitProblem(event ProblemEvent) {
 func (eb *EventBus) OnProblem(handler func(context.Context, ProblemEvent) errors.E) func() {
 	return onEvent(eb.problem, "Problem", handler)
 }
+
+// Job event methods
+func (eb *EventBus) EmitJob(event JobEvent) {
+	_ = emitEvent(eb.job, eb.ctx, event)
+}
+
+func (eb *EventBus) OnJob(handler func(context.Context, JobEvent) errors.E) func() {
+	return onEvent(eb.job, "Job", handler)
+}
+
+// Raid event methods
+func (eb *EventBus) EmitRaid(event RaidEvent) {
+	_ = emitEvent(eb.raid, eb.ctx, event)
+}
+
+func (eb *EventBus) OnRaid(handler func(context.Context, RaidEvent) errors.E) func() {
+	return onEvent(eb.raid, "Raid", handler)
+}
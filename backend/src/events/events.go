@@ -62,6 +62,12 @@ type UserEvent struct {
 	User *dto.User
 }
 
+// GroupEvent represents a group-related event
+type GroupEvent struct {
+	Event
+	Group *dto.Group
+}
+
 // SettingEvent represents a setting-related event
 type SettingEvent struct {
 	Event
@@ -149,3 +155,16 @@ type ProblemEvent struct {
 	Event
 	Problem *dto.Problem
 }
+
+// JobEvent represents the start, progress or end of a scheduled job run.
+type JobEvent struct {
+	Event
+	Run *dto.JobRun
+}
+
+// RaidEvent represents a change of a software RAID array, or the progress of
+// its resync or rebuild.
+type RaidEvent struct {
+	Event
+	Array *dto.RaidArray
+}
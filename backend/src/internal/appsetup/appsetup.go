@@ -105,7 +105,27 @@ func ProvideCoreDependencies(params BaseAppParams) fx.Option {
 			service.NewHaRootService,
 			service.NewFilesystemService,
 			service.NewShareService,
+			service.NewSharePermissionService,
+			service.NewQuotaService,
+			service.NewSnapshotService,
+			service.NewRecycleBinService,
+			service.NewReplicationService,
+			service.NewJobService,
+			service.NewHomesService,
+			service.NewAuditService,
+			service.NewIntrusionService,
+			service.NewMetricsService,
+			service.NewStatsHistoryService,
+			service.NewSmartAnalysisService,
+			service.NewSmartTestService,
+			service.NewMQTTService,
+			service.NewLuksService,
+			service.NewRaidService,
+			service.NewLvmService,
+			service.NewPoolService,
+			service.NewRemoteMountService,
 			service.NewUserService,
+			service.NewGroupService,
 			service.NewHostService,
 			service.NewDiskStatsService,
 			service.NewNetworkStatsService,
@@ -0,0 +1,206 @@
+// Package cronexpr parses standard five-field cron expressions and computes
+// their activation times.
+//
+// Supported syntax per field: "*", values, ranges "a-b", steps "*/n" and
+// "a-b/n", and comma separated lists. Months and weekdays accept three letter
+// English names, and 7 is an alias of Sunday. The @yearly, @annually,
+// @monthly, @weekly, @daily, @midnight and @hourly macros are recognised.
+//
+// As in Vixie cron, when both day-of-month and day-of-week are restricted a
+// time matches if either of them matches.
+package cronexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record an unrestricted day field, which switches
+	// day matching from "either" to "both".
+	domStar, dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a five-field cron expression or one of the @ macros.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := macros[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	s := &Schedule{}
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	// Sunday may be written as 0 or 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parse returns the bit set of the values matched by one field.
+func (f field) parse(expr string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(expr, ",") {
+		values, err := f.parseRange(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", f.name, expr, err)
+		}
+		set |= values
+	}
+	return set, nil
+}
+
+func (f field) parseRange(part string) (uint64, error) {
+	rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+	step := 1
+	if hasStep {
+		var err error
+		step, err = strconv.Atoi(stepExpr)
+		if err != nil || step <= 0 {
+			return 0, fmt.Errorf("bad step %q", stepExpr)
+		}
+	}
+
+	var low, high int
+	switch {
+	case rangeExpr == "*":
+		low, high = f.min, f.max
+	case strings.Contains(rangeExpr, "-"):
+		lowExpr, highExpr, _ := strings.Cut(rangeExpr, "-")
+		var err error
+		if low, err = f.value(lowExpr); err != nil {
+			return 0, err
+		}
+		if high, err = f.value(highExpr); err != nil {
+			return 0, err
+		}
+		if low > high {
+			return 0, fmt.Errorf("range %q is reversed", rangeExpr)
+		}
+	default:
+		var err error
+		if low, err = f.value(rangeExpr); err != nil {
+			return 0, err
+		}
+		high = low
+		// "5/15" means from 5 to the end in steps of 15.
+		if hasStep {
+			high = f.max
+		}
+	}
+
+	var set uint64
+	for v := low; v <= high; v += step {
+		set |= 1 << uint(v)
+	}
+	return set, nil
+}
+
+func (f field) value(expr string) (int, error) {
+	if v, ok := f.names[strings.ToLower(expr)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(expr)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", expr)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d,%d]", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// maxSearchYears bounds Next for expressions that can never match, such as
+// "0 0 30 2 *".
+const maxSearchYears = 5
+
+// Next returns the first activation strictly after t, in t's location. It
+// returns the zero time when the schedule never fires.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,69 @@
+package cronexpr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		errContains string
+	}{
+		{"too few fields", "* * * *", "expected 5 fields"},
+		{"minute out of range", "60 * * * *", "out of range"},
+		{"reversed range", "* 10-2 * * *", "reversed"},
+		{"bad step", "*/0 * * * *", "bad step"},
+		{"unknown name", "* * * foo *", "bad value"},
+		{"unknown macro", "@often", "expected 5 fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.spec)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errContains)
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Friday
+	from := time.Date(2026, 1, 30, 10, 17, 42, 0, time.UTC)
+	tests := []struct {
+		name string
+		spec string
+		want time.Time
+	}{
+		{"every minute", "* * * * *", time.Date(2026, 1, 30, 10, 18, 0, 0, time.UTC)},
+		{"step minutes", "*/15 * * * *", time.Date(2026, 1, 30, 10, 30, 0, 0, time.UTC)},
+		{"offset step", "5/20 * * * *", time.Date(2026, 1, 30, 10, 25, 0, 0, time.UTC)},
+		{"daily macro", "@daily", time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"hourly macro", "@hourly", time.Date(2026, 1, 30, 11, 0, 0, 0, time.UTC)},
+		{"list and range", "0 3,22 * * mon-wed", time.Date(2026, 2, 2, 3, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "30 2 * * 7", time.Date(2026, 2, 1, 2, 30, 0, 0, time.UTC)},
+		{"month name", "0 0 1 mar *", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"dom or dow", "0 4 15 * sat", time.Date(2026, 1, 31, 4, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, schedule.Next(from))
+		})
+	}
+}
+
+func TestNextIsStrictlyAfter(t *testing.T) {
+	schedule, err := Parse("0 * * * *")
+	require.NoError(t, err)
+	at := time.Date(2026, 1, 30, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, at.Add(time.Hour), schedule.Next(at))
+}
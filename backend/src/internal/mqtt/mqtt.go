@@ -0,0 +1,453 @@
+// Package mqtt is a minimal MQTT 3.1.1 client.
+//
+// It covers what publishing Home Assistant entities needs: a clean session,
+// username and password authentication, TLS, a last will, QoS 0 publishing
+// with the retain flag, QoS 0 subscriptions and keep alive. Messages at QoS 1
+// and 2 are received, and acknowledged, as QoS 0 ones.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Control packet types.
+const (
+	CONNECT     byte = 1
+	CONNACK     byte = 2
+	PUBLISH     byte = 3
+	PUBACK      byte = 4
+	PUBREC      byte = 5
+	PUBREL      byte = 6
+	PUBCOMP     byte = 7
+	SUBSCRIBE   byte = 8
+	SUBACK      byte = 9
+	UNSUBSCRIBE byte = 10
+	UNSUBACK    byte = 11
+	PINGREQ     byte = 12
+	PINGRESP    byte = 13
+	DISCONNECT  byte = 14
+)
+
+// maxRemainingLength is the largest remaining length the four bytes of the
+// variable length encoding can hold.
+const maxRemainingLength = 268435455
+
+// maxPacketLength bounds the remaining length of the packets read, so that a
+// broker cannot make the client allocate up to maxRemainingLength bytes.
+const maxPacketLength = 4 << 20
+
+// ErrClosed is returned by the operations on a closed client.
+var ErrClosed = errors.New("mqtt: client closed")
+
+// ErrPacketTooLarge is returned when a packet read exceeds maxPacketLength.
+var ErrPacketTooLarge = errors.New("mqtt: packet too large")
+
+// ConnectError is a connection refused by the broker.
+type ConnectError struct {
+	Code byte
+}
+
+func (e ConnectError) Error() string {
+	reasons := map[byte]string{
+		1: "unacceptable protocol version",
+		2: "identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorized",
+	}
+	if reason, ok := reasons[e.Code]; ok {
+		return "mqtt: connection refused, " + reason
+	}
+	return fmt.Sprintf("mqtt: connection refused, code %d", e.Code)
+}
+
+// Packet is a raw control packet.
+type Packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// ReadPacket reads a control packet.
+func ReadPacket(r *bufio.Reader) (Packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return Packet{}, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return Packet{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return Packet{}, errors.New("mqtt: malformed remaining length")
+		}
+		multiplier *= 128
+	}
+	if length > maxPacketLength {
+		return Packet{}, ErrPacketTooLarge
+	}
+	p := Packet{Type: header >> 4, Flags: header & 0x0f, Body: make([]byte, length)}
+	if _, err := io.ReadFull(r, p.Body); err != nil {
+		return Packet{}, err
+	}
+	return p, nil
+}
+
+// Bytes encodes the packet.
+func (p Packet) Bytes() []byte {
+	out := make([]byte, 0, len(p.Body)+5)
+	out = append(out, p.Type<<4|p.Flags)
+	length := len(p.Body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(out, p.Body...)
+}
+
+// AppendString appends a length prefixed UTF-8 string.
+func AppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// ReadString reads a length prefixed UTF-8 string, returning the rest of b.
+func ReadString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("mqtt: truncated string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("mqtt: truncated string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// Message is an application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// EncodePublish encodes a QoS 0 PUBLISH packet.
+func EncodePublish(msg Message) Packet {
+	p := Packet{Type: PUBLISH, Body: AppendString(nil, msg.Topic)}
+	if msg.Retain {
+		p.Flags = 0x01
+	}
+	p.Body = append(p.Body, msg.Payload...)
+	return p
+}
+
+// DecodePublish decodes a PUBLISH packet. The packet identifier of QoS 1 and 2
+// messages is returned to acknowledge them, 0 for QoS 0 ones.
+func DecodePublish(p Packet) (Message, uint16, error) {
+	topic, rest, err := ReadString(p.Body)
+	if err != nil {
+		return Message{}, 0, err
+	}
+	var id uint16
+	if p.Flags&0x06 != 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, errors.New("mqtt: truncated packet identifier")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	return Message{Topic: topic, Payload: rest, Retain: p.Flags&0x01 != 0}, id, nil
+}
+
+// Options configures a connection.
+type Options struct {
+	// Addr is the host:port of the broker.
+	Addr     string
+	ClientID string
+	Username string
+	Password string
+	// TLS, when not nil, secures the connection with this configuration.
+	// The server name is taken from Addr when it is empty.
+	TLS *tls.Config
+	// KeepAlive is the longest time without packets from the client, 60
+	// seconds when zero.
+	KeepAlive time.Duration
+	// Will is published, retained, by the broker when the connection is lost.
+	Will *Message
+	// OnMessage receives the messages of the subscribed topics. It runs on
+	// the reading goroutine, so it must not block.
+	OnMessage func(Message)
+}
+
+// Client is a connection to a broker.
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+	onMessage func(Message)
+
+	writeMu sync.Mutex
+	nextID  uint16
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// Dial connects to the broker and waits for it to accept the connection.
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = time.Minute
+	}
+	var conn net.Conn
+	var err error
+	if opts.TLS != nil {
+		dialer := tls.Dialer{Config: opts.TLS}
+		conn, err = dialer.DialContext(ctx, "tcp", opts.Addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", opts.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:      conn,
+		keepAlive: opts.KeepAlive,
+		onMessage: opts.OnMessage,
+		done:      make(chan struct{}),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(opts.KeepAlive))
+	}
+	if _, err := conn.Write(encodeConnect(opts).Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	ack, err := ReadPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if ack.Type != CONNACK || len(ack.Body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: unexpected packet type %d in place of CONNACK", ack.Type)
+	}
+	if ack.Body[1] != 0 {
+		conn.Close()
+		return nil, ConnectError{Code: ack.Body[1]}
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	go c.readLoop(r)
+	go c.pingLoop()
+	return c, nil
+}
+
+func encodeConnect(opts Options) Packet {
+	body := AppendString(nil, "MQTT")
+	body = append(body, 4) // protocol level 3.1.1
+	flags := byte(0x02)    // clean session
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = AppendString(body, opts.ClientID)
+	if opts.Will != nil {
+		body = AppendString(body, opts.Will.Topic)
+		body = binary.BigEndian.AppendUint16(body, uint16(len(opts.Will.Payload)))
+		body = append(body, opts.Will.Payload...)
+	}
+	if opts.Username != "" {
+		body = AppendString(body, opts.Username)
+		if opts.Password != "" {
+			body = AppendString(body, opts.Password)
+		}
+	}
+	return Packet{Type: CONNECT, Body: body}
+}
+
+// Publish sends a QoS 0 message.
+func (c *Client) Publish(msg Message) error {
+	if msg.Topic == "" || strings.ContainsAny(msg.Topic, "+#") {
+		return fmt.Errorf("mqtt: invalid topic name %q", msg.Topic)
+	}
+	if len(msg.Topic)+len(msg.Payload)+2 > maxRemainingLength {
+		return errors.New("mqtt: message too large")
+	}
+	return c.write(EncodePublish(msg))
+}
+
+// Subscribe subscribes to topic filters at QoS 0. The broker acknowledges the
+// subscription asynchronously: as it processes packets in order, messages
+// published after Subscribe returns are delivered.
+func (c *Client) Subscribe(filters ...string) error {
+	if len(filters) == 0 {
+		return nil
+	}
+	c.writeMu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	body := binary.BigEndian.AppendUint16(nil, c.nextID)
+	c.writeMu.Unlock()
+	for _, filter := range filters {
+		body = AppendString(body, filter)
+		body = append(body, 0)
+	}
+	return c.write(Packet{Type: SUBSCRIBE, Flags: 0x02, Body: body})
+}
+
+func (c *Client) write(p Packet) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	if _, err := c.conn.Write(p.Bytes()); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// Done is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, ErrClosed after Close.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close disconnects from the broker. The last will is not published.
+func (c *Client) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	c.writeMu.Lock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, _ = c.conn.Write(Packet{Type: DISCONNECT}.Bytes())
+	c.writeMu.Unlock()
+	c.fail(ErrClosed)
+	return nil
+}
+
+func (c *Client) fail(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+func (c *Client) readLoop(r *bufio.Reader) {
+	for {
+		// The broker answers each ping, silence past the keep alive means
+		// the connection is gone.
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		p, err := ReadPacket(r)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		switch p.Type {
+		case PUBLISH:
+			msg, id, err := DecodePublish(p)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			if id != 0 {
+				ack := Packet{Type: PUBACK, Body: binary.BigEndian.AppendUint16(nil, id)}
+				if p.Flags&0x06 == 0x04 {
+					ack.Type = PUBREC
+				}
+				go func() { _ = c.write(ack) }()
+			}
+			if c.onMessage != nil {
+				c.onMessage(msg)
+			}
+		case PUBREL:
+			go func() { _ = c.write(Packet{Type: PUBCOMP, Body: p.Body}) }()
+		}
+	}
+}
+
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			_ = c.write(Packet{Type: PINGREQ})
+		}
+	}
+}
+
+// Match tells whether a topic name matches a topic filter with the + and #
+// wildcards.
+func Match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && !strings.HasPrefix(filter, "$") {
+		return false
+	}
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
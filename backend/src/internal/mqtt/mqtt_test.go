@@ -0,0 +1,161 @@
+package mqtt_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/internal/mqtt"
+	"github.com/dianlight/srat/internal/mqtt/mqtttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 2097152} {
+		p := mqtt.Packet{Type: mqtt.PUBLISH, Flags: 0x01, Body: bytes.Repeat([]byte{'x'}, size)}
+		got, err := mqtt.ReadPacket(bufio.NewReader(bytes.NewReader(p.Bytes())))
+		require.NoError(t, err, "size %d", size)
+		assert.Equal(t, p.Type, got.Type)
+		assert.Equal(t, p.Flags, got.Flags)
+		assert.Len(t, got.Body, size)
+	}
+
+	_, err := mqtt.ReadPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01})))
+	assert.Error(t, err)
+}
+
+func TestReadPacketTooLarge(t *testing.T) {
+	// The largest remaining length, with no body behind it.
+	_, err := mqtt.ReadPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0x7f})))
+	assert.ErrorIs(t, err, mqtt.ErrPacketTooLarge)
+}
+
+func TestDecodePublish(t *testing.T) {
+	msg, id, err := mqtt.DecodePublish(mqtt.EncodePublish(mqtt.Message{Topic: "a/b", Payload: []byte("on"), Retain: true}))
+	require.NoError(t, err)
+	assert.Equal(t, mqtt.Message{Topic: "a/b", Payload: []byte("on"), Retain: true}, msg)
+	assert.Zero(t, id)
+
+	qos1 := mqtt.Packet{Type: mqtt.PUBLISH, Flags: 0x02, Body: append(mqtt.AppendString(nil, "a/b"), 0, 7, 'o', 'n')}
+	msg, id, err = mqtt.DecodePublish(qos1)
+	require.NoError(t, err)
+	assert.Equal(t, "on", string(msg.Payload))
+	assert.Equal(t, uint16(7), id)
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"srat/disk/sda/state", "srat/disk/sda/state", true},
+		{"srat/+/sda/state", "srat/disk/sda/state", true},
+		{"srat/+/set", "srat/disk/sda/set", false},
+		{"srat/#", "srat/disk/sda/set", true},
+		{"srat/#", "srat", true},
+		{"#", "$SYS/uptime", false},
+		{"srat/disk", "srat/disk/sda", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, mqtt.Match(tt.filter, tt.topic), "%s ~ %s", tt.filter, tt.topic)
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	broker.RequireCredentials("srat", "secret")
+	broker.Publish(mqtt.Message{Topic: "srat/share/media/enabled/set", Payload: []byte("OFF"), Retain: true})
+
+	var mu sync.Mutex
+	var received []mqtt.Message
+	got := make(chan struct{}, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := mqtt.Dial(ctx, mqtt.Options{
+		Addr:     broker.Addr(),
+		ClientID: "test",
+		Username: "srat",
+		Password: "secret",
+		Will:     &mqtt.Message{Topic: "srat/status", Payload: []byte("offline"), Retain: true},
+		OnMessage: func(msg mqtt.Message) {
+			mu.Lock()
+			received = append(received, msg)
+			mu.Unlock()
+			got <- struct{}{}
+		},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.Subscribe("srat/+/+/+/set"))
+	require.NoError(t, client.Publish(mqtt.Message{Topic: "srat/status", Payload: []byte("online"), Retain: true}))
+	assert.Equal(t, "online", string(broker.WaitFor(t, "srat/status", 5*time.Second).Payload))
+	retained, ok := broker.Retained("srat/status")
+	require.True(t, ok)
+	assert.Equal(t, "online", string(retained.Payload))
+
+	broker.Publish(mqtt.Message{Topic: "srat/disk/sda/spin_down/set", Payload: []byte("PRESS")})
+	for range 2 {
+		select {
+		case <-got:
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+	mu.Lock()
+	assert.Equal(t, []mqtt.Message{
+		{Topic: "srat/share/media/enabled/set", Payload: []byte("OFF"), Retain: true},
+		{Topic: "srat/disk/sda/spin_down/set", Payload: []byte("PRESS")},
+	}, received)
+	mu.Unlock()
+
+	assert.Error(t, client.Publish(mqtt.Message{Topic: "srat/+/state"}))
+	require.NoError(t, client.Close())
+	assert.ErrorIs(t, client.Err(), mqtt.ErrClosed)
+	assert.ErrorIs(t, client.Publish(mqtt.Message{Topic: "srat/status"}), mqtt.ErrClosed)
+}
+
+func TestDialRefused(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	broker.RequireCredentials("srat", "secret")
+
+	_, err := mqtt.Dial(context.Background(), mqtt.Options{Addr: broker.Addr(), ClientID: "test", Username: "srat", Password: "wrong"})
+	var refused mqtt.ConnectError
+	require.ErrorAs(t, err, &refused)
+	assert.Equal(t, byte(4), refused.Code)
+	assert.True(t, strings.Contains(err.Error(), "bad user name or password"))
+}
+
+func TestDialTLS(t *testing.T) {
+	broker, roots := mqtttest.NewTLSBroker(t)
+
+	client, err := mqtt.Dial(context.Background(), mqtt.Options{Addr: broker.Addr(), ClientID: "test", TLS: &tls.Config{RootCAs: roots}})
+	require.NoError(t, err)
+	require.NoError(t, client.Publish(mqtt.Message{Topic: "srat/status", Payload: []byte("online")}))
+	assert.Equal(t, "online", string(broker.WaitFor(t, "srat/status", 5*time.Second).Payload))
+	require.NoError(t, client.Close())
+
+	_, err = mqtt.Dial(context.Background(), mqtt.Options{Addr: broker.Addr(), ClientID: "test", TLS: &tls.Config{}})
+	assert.Error(t, err, "the self signed certificate is not trusted")
+}
+
+func TestConnectionLost(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	client, err := mqtt.Dial(context.Background(), mqtt.Options{Addr: broker.Addr(), ClientID: "test"})
+	require.NoError(t, err)
+
+	broker.Close()
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection loss not detected")
+	}
+	assert.Error(t, client.Err())
+	assert.NotErrorIs(t, client.Err(), mqtt.ErrClosed)
+}
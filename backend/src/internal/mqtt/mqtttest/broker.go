@@ -0,0 +1,351 @@
+// Package mqtttest runs an in-process MQTT broker for tests.
+//
+// The broker keeps retained messages, honours the wildcards of the
+// subscriptions, publishes the last will of the connections lost without a
+// DISCONNECT and records every message the clients publish.
+package mqtttest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/internal/mqtt"
+)
+
+// Broker is an in-process MQTT broker listening on the loopback interface.
+type Broker struct {
+	ln net.Listener
+
+	mu        sync.Mutex
+	username  string
+	password  string
+	conns     map[*brokerConn]struct{}
+	retained  map[string]mqtt.Message
+	published []mqtt.Message
+	changed   chan struct{}
+}
+
+type brokerConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	filters []string
+	will    *mqtt.Message
+}
+
+// NewBroker starts a broker, stopped at the end of the test.
+func NewBroker(t testing.TB) *Broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("mqtttest: listen: %v", err)
+	}
+	return startBroker(t, ln)
+}
+
+// NewTLSBroker starts a broker accepting only TLS connections, with a self
+// signed certificate for 127.0.0.1. The returned pool trusts it.
+func NewTLSBroker(t testing.TB) (*Broker, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("mqtttest: generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("mqtttest: create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("mqtttest: parse certificate: %v", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}},
+	})
+	if err != nil {
+		t.Fatalf("mqtttest: listen: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return startBroker(t, ln), pool
+}
+
+func startBroker(t testing.TB, ln net.Listener) *Broker {
+	b := &Broker{
+		ln:       ln,
+		conns:    make(map[*brokerConn]struct{}),
+		retained: make(map[string]mqtt.Message),
+		changed:  make(chan struct{}),
+	}
+	go b.serve()
+	t.Cleanup(b.Close)
+	return b
+}
+
+// Addr is the host:port to connect to.
+func (b *Broker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// RequireCredentials refuses the connections without this user name and
+// password.
+func (b *Broker) RequireCredentials(username, password string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.username, b.password = username, password
+}
+
+// Close stops the broker and drops the connections, as a crash would.
+func (b *Broker) Close() {
+	b.ln.Close()
+	b.mu.Lock()
+	conns := make([]*brokerConn, 0, len(b.conns))
+	for c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+	for _, c := range conns {
+		c.conn.Close()
+	}
+}
+
+// Publish delivers a message to the subscribers, as if another client sent
+// it.
+func (b *Broker) Publish(msg mqtt.Message) {
+	b.route(msg, false)
+}
+
+// Retained returns the retained message of a topic.
+func (b *Broker) Retained(topic string) (mqtt.Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg, ok := b.retained[topic]
+	return msg, ok
+}
+
+// Published returns the messages the clients published, oldest first.
+func (b *Broker) Published() []mqtt.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]mqtt.Message(nil), b.published...)
+}
+
+// WaitFor waits for a message matching the topic filter and returns the
+// newest one, failing the test after the timeout.
+func (b *Broker) WaitFor(t testing.TB, filter string, timeout time.Duration) mqtt.Message {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		b.mu.Lock()
+		changed := b.changed
+		for i := len(b.published) - 1; i >= 0; i-- {
+			if mqtt.Match(filter, b.published[i].Topic) {
+				msg := b.published[i]
+				b.mu.Unlock()
+				return msg
+			}
+		}
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("mqtttest: no message on %s within %s", filter, timeout)
+			return mqtt.Message{}
+		}
+	}
+}
+
+func (b *Broker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(&brokerConn{conn: conn})
+	}
+}
+
+func (b *Broker) handle(c *brokerConn) {
+	defer c.conn.Close()
+	r := bufio.NewReader(c.conn)
+	p, err := mqtt.ReadPacket(r)
+	if err != nil || p.Type != mqtt.CONNECT {
+		return
+	}
+	code := b.connect(c, p.Body)
+	c.write(mqtt.Packet{Type: mqtt.CONNACK, Body: []byte{0, code}})
+	if code != 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.conns[c] = struct{}{}
+	b.mu.Unlock()
+	disconnected := false
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, c)
+		b.mu.Unlock()
+		if !disconnected && c.will != nil {
+			b.route(*c.will, true)
+		}
+	}()
+
+	for {
+		p, err := mqtt.ReadPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.Type {
+		case mqtt.PUBLISH:
+			msg, _, err := mqtt.DecodePublish(p)
+			if err != nil {
+				return
+			}
+			b.route(msg, true)
+		case mqtt.SUBSCRIBE:
+			b.subscribe(c, p.Body)
+		case mqtt.PINGREQ:
+			c.write(mqtt.Packet{Type: mqtt.PINGRESP})
+		case mqtt.DISCONNECT:
+			disconnected = true
+			return
+		}
+	}
+}
+
+// connect parses a CONNECT packet and returns the CONNACK return code.
+func (b *Broker) connect(c *brokerConn, body []byte) byte {
+	name, rest, err := mqtt.ReadString(body)
+	if err != nil || name != "MQTT" || len(rest) < 4 || rest[0] != 4 {
+		return 1
+	}
+	flags := rest[1]
+	rest = rest[4:]
+	if _, rest, err = mqtt.ReadString(rest); err != nil {
+		return 2
+	}
+	if flags&0x04 != 0 {
+		var topic, payload string
+		if topic, rest, err = mqtt.ReadString(rest); err != nil {
+			return 2
+		}
+		if payload, rest, err = mqtt.ReadString(rest); err != nil {
+			return 2
+		}
+		c.will = &mqtt.Message{Topic: topic, Payload: []byte(payload), Retain: flags&0x20 != 0}
+	}
+	var username, password string
+	if flags&0x80 != 0 {
+		if username, rest, err = mqtt.ReadString(rest); err != nil {
+			return 4
+		}
+	}
+	if flags&0x40 != 0 {
+		if password, _, err = mqtt.ReadString(rest); err != nil {
+			return 4
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.username != "" && (username != b.username || password != b.password) {
+		return 4
+	}
+	return 0
+}
+
+func (b *Broker) subscribe(c *brokerConn, body []byte) {
+	if len(body) < 2 {
+		return
+	}
+	id, rest := body[:2], body[2:]
+	var filters []string
+	for len(rest) > 0 {
+		filter, next, err := mqtt.ReadString(rest)
+		if err != nil || len(next) < 1 {
+			return
+		}
+		filters = append(filters, filter)
+		rest = next[1:]
+	}
+
+	b.mu.Lock()
+	c.filters = append(c.filters, filters...)
+	var retained []mqtt.Message
+	for _, msg := range b.retained {
+		for _, filter := range filters {
+			if mqtt.Match(filter, msg.Topic) {
+				retained = append(retained, msg)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	ack := append([]byte(nil), id...)
+	for range filters {
+		ack = append(ack, 0)
+	}
+	c.write(mqtt.Packet{Type: mqtt.SUBACK, Body: ack})
+	for _, msg := range retained {
+		c.write(mqtt.EncodePublish(msg))
+	}
+}
+
+// route stores a message and delivers it to the matching subscriptions.
+func (b *Broker) route(msg mqtt.Message, fromClient bool) {
+	b.mu.Lock()
+	if msg.Retain {
+		if len(msg.Payload) == 0 {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg
+		}
+	}
+	if fromClient {
+		b.published = append(b.published, msg)
+		close(b.changed)
+		b.changed = make(chan struct{})
+	}
+	var targets []*brokerConn
+	for c := range b.conns {
+		for _, filter := range c.filters {
+			if mqtt.Match(filter, msg.Topic) {
+				targets = append(targets, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	// Messages are delivered without the retain flag, as for a live publish.
+	live := mqtt.Message{Topic: msg.Topic, Payload: msg.Payload}
+	for _, c := range targets {
+		c.write(mqtt.EncodePublish(live))
+	}
+}
+
+func (c *brokerConn) write(p mqtt.Packet) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, _ = c.conn.Write(p.Bytes())
+}
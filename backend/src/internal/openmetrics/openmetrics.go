@@ -0,0 +1,144 @@
+// Package openmetrics writes metrics in the OpenMetrics text exposition
+// format, as scraped by Prometheus.
+package openmetrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of the exposition written by Set.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Type is the type of a metric family.
+type Type string
+
+const (
+	Gauge   Type = "gauge"
+	Counter Type = "counter"
+)
+
+// Family is a set of samples sharing a name, a type and a help text.
+type Family struct {
+	name    string
+	typ     Type
+	unit    string
+	help    string
+	samples []sample
+}
+
+type sample struct {
+	labels []string // name, value pairs
+	value  float64
+}
+
+// Add adds a sample with the given labels, as name and value pairs.
+func (f *Family) Add(value float64, labels ...string) {
+	if len(labels)%2 != 0 {
+		panic("openmetrics: labels must be name and value pairs")
+	}
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+// Set is an ordered collection of metric families.
+type Set struct {
+	families []*Family
+}
+
+// Gauge adds a gauge family. unit, when set, must be the suffix of name.
+func (s *Set) Gauge(name, unit, help string) *Family {
+	return s.add(name, Gauge, unit, help)
+}
+
+// Counter adds a counter family. The samples are named name_total.
+func (s *Set) Counter(name, unit, help string) *Family {
+	return s.add(name, Counter, unit, help)
+}
+
+func (s *Set) add(name string, typ Type, unit, help string) *Family {
+	f := &Family{name: name, typ: typ, unit: unit, help: help}
+	s.families = append(s.families, f)
+	return f
+}
+
+// Append adds the families of other after those of s.
+func (s *Set) Append(other *Set) {
+	s.families = append(s.families, other.families...)
+}
+
+// WriteTo writes the families in the order they were added, followed by
+// the EOF marker.
+func (s *Set) WriteTo(out io.Writer) (int64, error) {
+	w := &countingWriter{w: bufio.NewWriter(out)}
+	for _, f := range s.families {
+		w.str("# TYPE " + f.name + " " + string(f.typ) + "\n")
+		if f.unit != "" {
+			w.str("# UNIT " + f.name + " " + f.unit + "\n")
+		}
+		if f.help != "" {
+			w.str("# HELP " + f.name + " " + escape(f.help, false) + "\n")
+		}
+		name := f.name
+		if f.typ == Counter {
+			name += "_total"
+		}
+		for _, smp := range f.samples {
+			w.str(name)
+			if len(smp.labels) > 0 {
+				w.str("{")
+				for i := 0; i < len(smp.labels); i += 2 {
+					if i > 0 {
+						w.str(",")
+					}
+					w.str(smp.labels[i] + `="` + escape(smp.labels[i+1], true) + `"`)
+				}
+				w.str("}")
+			}
+			w.str(" " + formatValue(smp.value) + "\n")
+		}
+	}
+	w.str("# EOF\n")
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return w.n, w.err
+}
+
+// escape escapes a help text or, with quotes, a label value.
+func escape(s string, quotes bool) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	if quotes {
+		r = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	}
+	return r.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) str(s string) {
+	if c.err != nil {
+		return
+	}
+	n, err := c.w.WriteString(s)
+	c.n += int64(n)
+	c.err = err
+}
@@ -0,0 +1,40 @@
+package openmetrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTo(t *testing.T) {
+	var set Set
+	temp := set.Gauge("disk_temperature_celsius", "celsius", "Disk temperature.")
+	temp.Add(41, "disk", "sda")
+	temp.Add(math.NaN(), "disk", `odd "name"\`)
+	set.Counter("logins", "", "Logins,\nfailed or not.").Add(3)
+	set.Gauge("empty", "", "").Add(math.Inf(1))
+
+	var out strings.Builder
+	n, err := set.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Equal(t, int64(out.Len()), n)
+	assert.Equal(t, "# TYPE disk_temperature_celsius gauge\n"+
+		"# UNIT disk_temperature_celsius celsius\n"+
+		"# HELP disk_temperature_celsius Disk temperature.\n"+
+		"disk_temperature_celsius{disk=\"sda\"} 41\n"+
+		"disk_temperature_celsius{disk=\"odd \\\"name\\\"\\\\\"} NaN\n"+
+		"# TYPE logins counter\n"+
+		"# HELP logins Logins,\\nfailed or not.\n"+
+		"logins_total 3\n"+
+		"# TYPE empty gauge\n"+
+		"empty +Inf\n"+
+		"# EOF\n", out.String())
+}
+
+func TestAddOddLabels(t *testing.T) {
+	var set Set
+	assert.Panics(t, func() { set.Gauge("g", "", "").Add(1, "disk") })
+}
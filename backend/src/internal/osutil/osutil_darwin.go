@@ -5,6 +5,9 @@ package osutil
 import (
 	"context"
 	"fmt"
+	"os"
+	"syscall"
+	"time"
 )
 
 // IsKernelModuleLoaded returns false on macOS (no Linux kernel modules).
@@ -52,3 +55,13 @@ func LoadMountInfo() ([]*MountInfoEntry, error) {
 
 	return []*MountInfoEntry{}, nil
 }
+
+// ChangeTime returns the last status change time of a file, which renames
+// update, falling back to the modification time when the platform stat data
+// is not available.
+func ChangeTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Ctimespec.Unix())
+	}
+	return info.ModTime()
+}
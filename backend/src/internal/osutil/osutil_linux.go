@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
@@ -137,3 +138,13 @@ func GetFileSystems() ([]string, error) {
 
 	return ret, nil
 }
+
+// ChangeTime returns the last status change time of a file, which renames
+// update, falling back to the modification time when the platform stat data
+// is not available.
+func ChangeTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Ctim.Unix())
+	}
+	return info.ModTime()
+}
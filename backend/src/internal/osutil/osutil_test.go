@@ -1,7 +1,10 @@
 package osutil
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -366,3 +369,19 @@ func (suite *OsutilSuite) TestCommandExists_CommandNameOnly() {
 	result := CommandExists([]string{"cat"})
 	suite.True(result, "commandExists should handle single-element command slices")
 }
+
+func (suite *OsutilSuite) TestChangeTimeFollowsRename() {
+	t := suite.T()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "deleted.txt")
+	require.NoError(t, os.WriteFile(file, []byte("x"), 0o644))
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(file, old, old))
+
+	moved := filepath.Join(dir, "moved.txt")
+	before := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Rename(file, moved))
+	info, err := os.Stat(moved)
+	require.NoError(t, err)
+	assert.True(t, ChangeTime(info).After(before), "a rename sets the ctime whatever the atime and mtime are")
+}
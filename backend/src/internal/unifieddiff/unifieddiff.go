@@ -0,0 +1,119 @@
+// Package unifieddiff renders line based differences between two texts in
+// the unified format of diff -u.
+package unifieddiff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DefaultContext is the number of unchanged lines shown around a change.
+const DefaultContext = 3
+
+type line struct {
+	op   diffmatchpatch.Operation
+	text string
+}
+
+// Diff returns the unified diff turning a into b, labelled fromFile and
+// toFile, with context unchanged lines around each change. It returns an
+// empty string when a and b are equal.
+func Diff(fromFile, toFile, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	dmp := diffmatchpatch.New()
+	charsA, charsB, lines := dmp.DiffLinesToChars(a, b)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(charsA, charsB, false), lines)
+
+	var all []line
+	for _, d := range diffs {
+		for _, text := range splitLines(d.Text) {
+			all = append(all, line{op: d.Type, text: text})
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromFile, toFile)
+	// oldLine and newLine are the line numbers of all[i] in a and b.
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(all); {
+		if all[i].op == diffmatchpatch.DiffEqual {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		// A hunk goes on while at most 2*context unchanged lines separate the
+		// changes.
+		last := i
+		for j := i; j < len(all) && j-last <= 2*context+1; j++ {
+			if all[j].op != diffmatchpatch.DiffEqual {
+				last = j
+			}
+		}
+		start := max(0, i-context)
+		stop := min(len(all), last+context+1)
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+
+		var body strings.Builder
+		oldCount, newCount := 0, 0
+		for _, l := range all[start:stop] {
+			switch l.op {
+			case diffmatchpatch.DiffEqual:
+				body.WriteByte(' ')
+				oldCount++
+				newCount++
+			case diffmatchpatch.DiffDelete:
+				body.WriteByte('-')
+				oldCount++
+			case diffmatchpatch.DiffInsert:
+				body.WriteByte('+')
+				newCount++
+			}
+			body.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		out.WriteString(body.String())
+
+		for _, l := range all[i:stop] {
+			if l.op != diffmatchpatch.DiffInsert {
+				oldLine++
+			}
+			if l.op != diffmatchpatch.DiffDelete {
+				newLine++
+			}
+		}
+		i = stop
+	}
+	return out.String()
+}
+
+// hunkRange formats the range of a hunk side. An empty side refers to the
+// line before it, as diff -u does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits text after each newline, keeping the newlines.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
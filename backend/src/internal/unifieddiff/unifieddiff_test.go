@@ -0,0 +1,67 @@
+package unifieddiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffEqual(t *testing.T) {
+	assert.Empty(t, Diff("a", "b", "x\ny\n", "x\ny\n", DefaultContext))
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{
+			name:    "changed line",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:       "1\n2\n3\n4\nfive\n6\n7\n8\n",
+			context: 3,
+			want: "--- old\n+++ new\n" +
+				"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name:    "distant changes make two hunks",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:       "one\n2\n3\n4\n5\n6\n7\n8\nnine\n",
+			context: 1,
+			want: "--- old\n+++ new\n" +
+				"@@ -1,2 +1,2 @@\n-1\n+one\n 2\n" +
+				"@@ -8,2 +8,2 @@\n 8\n-9\n+nine\n",
+		},
+		{
+			name:    "close changes share a hunk",
+			a:       "1\n2\n3\n4\n",
+			b:       "one\n2\n3\nfour\n",
+			context: 1,
+			want: "--- old\n+++ new\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n-4\n+four\n",
+		},
+		{
+			name:    "new file",
+			a:       "",
+			b:       "x\ny\n",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name:    "missing final newline",
+			a:       "x\ny",
+			b:       "x\nz\n",
+			context: 3,
+			want: "--- old\n+++ new\n" +
+				"@@ -1,2 +1,2 @@\n x\n-y\n\\ No newline at end of file\n+z\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Diff("old", "new", tt.a, tt.b, tt.context))
+		})
+	}
+}
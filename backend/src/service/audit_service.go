@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+const (
+	// auditCollectInterval is how often the audit log is read.
+	auditCollectInterval = 30 * time.Second
+	// auditLogTag starts the vfs_full_audit prefix rendered in smb.gtpl
+	// (`full_audit:prefix = srat-audit|%u|%I|%S`), telling our lines apart.
+	auditLogTag = "srat-audit"
+	// defaultAuditLimit and maxAuditLimit bound the events of a query.
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	// auditInsertBatch is the number of events stored per insert.
+	auditInsertBatch = 500
+	// defaultAuditRetentionDays applies when the setting is not set.
+	defaultAuditRetentionDays = 90
+)
+
+// auditLogFile is where smbd writes the full_audit debug class, see the
+// `log level` of smb.gtpl.
+var auditLogFile = "/var/log/samba/audit.log"
+
+type AuditServiceInterface interface {
+	// CollectAuditLog stores the events logged since the last collection and
+	// removes the events older than the retention. It returns how many events
+	// were stored.
+	CollectAuditLog(ctx context.Context) (int, errors.E)
+	// ListAuditEvents returns the events matching filter, newest first.
+	ListAuditEvents(filter dto.AuditFilter) ([]dto.AuditEvent, errors.E)
+}
+
+type AuditService struct {
+	ctx            context.Context
+	db             *gorm.DB
+	settingService SettingServiceInterface
+	wg             *sync.WaitGroup
+	now            func() time.Time
+
+	mu       sync.Mutex
+	tail     sambaLogTail
+	lastTime time.Time // time of the last debug header read
+	caughtUp bool      // events stored before a restart are skipped
+}
+
+type AuditServiceParams struct {
+	fx.In
+	Ctx            context.Context
+	Db             *gorm.DB
+	SettingService SettingServiceInterface
+}
+
+func NewAuditService(lc fx.Lifecycle, in AuditServiceParams) AuditServiceInterface {
+	wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup)
+	if !ok || wg == nil {
+		wg = &sync.WaitGroup{}
+	}
+	s := &AuditService{
+		ctx:            in.Ctx,
+		db:             in.Db,
+		settingService: in.SettingService,
+		wg:             wg,
+		now:            time.Now,
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if _, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok {
+				s.wg.Go(func() {
+					if err := s.run(); err != nil && !errors.Is(err, context.Canceled) {
+						slog.WarnContext(s.ctx, "AuditService run loop stopped with error", "error", err)
+					}
+				})
+			}
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *AuditService) run() errors.E {
+	for {
+		if _, err := s.CollectAuditLog(s.ctx); err != nil {
+			tlog.DebugContext(s.ctx, "Failed to collect the audit log", "error", err)
+		}
+		select {
+		case <-s.ctx.Done():
+			slog.DebugContext(s.ctx, "Run process closed", "err", s.ctx.Err())
+			return errors.WithStack(s.ctx.Err())
+		case <-time.After(auditCollectInterval):
+		}
+	}
+}
+
+func (s *AuditService) CollectAuditLog(ctx context.Context) (int, errors.E) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// After a restart the log is read again from the start: skip what was
+	// already stored.
+	var since time.Time
+	if !s.caughtUp {
+		latest, err := gorm.G[dbom.AuditEvent](s.db).Order(g.AuditEvent.Time.Desc()).First(ctx)
+		if err == nil {
+			since = latest.Time
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errors.Wrap(err, "failed to read the last audit event")
+		}
+	}
+
+	lines, errE := s.tail.readLines(auditLogFile)
+	if errE != nil {
+		return 0, errE
+	}
+	s.caughtUp = true
+
+	var events []dbom.AuditEvent
+	for _, line := range lines {
+		if t, ok := parseSambaHeaderTime(line); ok {
+			s.lastTime = t
+			continue
+		}
+		when := s.lastTime
+		if when.IsZero() {
+			when = s.now()
+		}
+		event, ok := parseAuditLine(line, when)
+		if !ok || !event.Time.After(since) {
+			continue
+		}
+		events = append(events, event)
+	}
+	if len(events) > 0 {
+		if err := gorm.G[dbom.AuditEvent](s.db).CreateInBatches(ctx, &events, auditInsertBatch); err != nil {
+			return 0, errors.Wrap(err, "failed to store audit events")
+		}
+	}
+
+	if err := s.pruneAuditEvents(ctx); err != nil {
+		return len(events), err
+	}
+	return len(events), nil
+}
+
+// parseAuditLine parses a vfs_full_audit message:
+// `srat-audit|user|client ip|share|operation|ok or fail (reason)|path[|target]`.
+func parseAuditLine(line string, when time.Time) (dbom.AuditEvent, bool) {
+	start := strings.Index(line, auditLogTag+"|")
+	if start < 0 {
+		return dbom.AuditEvent{}, false
+	}
+	fields := strings.Split(strings.TrimSpace(line[start:]), "|")
+	if len(fields) < 6 {
+		return dbom.AuditEvent{}, false
+	}
+	event := dbom.AuditEvent{
+		Time:      when,
+		Username:  fields[1],
+		ClientIP:  fields[2],
+		Share:     fields[3],
+		Operation: fields[4],
+	}
+	result := fields[5]
+	switch {
+	case result == "ok":
+		event.Success = true
+	case strings.HasPrefix(result, "fail"):
+		event.Error = strings.Trim(strings.TrimPrefix(result, "fail"), " ()")
+	default:
+		return dbom.AuditEvent{}, false
+	}
+	if len(fields) > 6 {
+		event.Path = fields[6]
+	}
+	if len(fields) > 7 {
+		event.Target = strings.Join(fields[7:], "|")
+	}
+	return event, true
+}
+
+// pruneAuditEvents removes the events older than the retention.
+func (s *AuditService) pruneAuditEvents(ctx context.Context) errors.E {
+	days := uint(defaultAuditRetentionDays)
+	if s.settingService != nil {
+		settings, err := s.settingService.Load()
+		if err != nil {
+			return err
+		}
+		if settings.AuditRetentionDays > 0 {
+			days = settings.AuditRetentionDays
+		}
+	}
+	cutoff := s.now().Add(-time.Duration(days) * 24 * time.Hour)
+	if _, err := gorm.G[dbom.AuditEvent](s.db).Where(g.AuditEvent.Time.Lt(cutoff)).Delete(ctx); err != nil {
+		return errors.Wrap(err, "failed to prune audit events")
+	}
+	return nil
+}
+
+func (s *AuditService) ListAuditEvents(filter dto.AuditFilter) ([]dto.AuditEvent, errors.E) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "limit", filter.Limit, "reason", "limit is too high")
+	}
+	if filter.Offset < 0 {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "offset", filter.Offset, "reason", "offset is negative")
+	}
+
+	query := gorm.G[dbom.AuditEvent](s.db).Order(g.AuditEvent.Time.Desc()).Order(g.AuditEvent.ID.Desc())
+	if filter.Username != "" {
+		query = query.Where(g.AuditEvent.Username.Eq(filter.Username))
+	}
+	if filter.Share != "" {
+		query = query.Where(g.AuditEvent.Share.Eq(filter.Share))
+	}
+	if filter.ClientIP != "" {
+		query = query.Where(g.AuditEvent.ClientIP.Eq(filter.ClientIP))
+	}
+	if filter.Operation != "" {
+		query = query.Where(g.AuditEvent.Operation.Eq(filter.Operation))
+	}
+	if !filter.From.IsZero() {
+		query = query.Where(g.AuditEvent.Time.Gte(filter.From))
+	}
+	if !filter.To.IsZero() {
+		query = query.Where(g.AuditEvent.Time.Lt(filter.To))
+	}
+	rows, err := query.Limit(filter.Limit).Offset(filter.Offset).Find(s.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list audit events")
+	}
+
+	events := make([]dto.AuditEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, dto.AuditEvent{
+			ID:        row.ID,
+			Time:      row.Time,
+			Username:  row.Username,
+			ClientIP:  row.ClientIP,
+			Share:     row.Share,
+			Operation: row.Operation,
+			Success:   row.Success,
+			Error:     row.Error,
+			Path:      row.Path,
+			Target:    row.Target,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+func TestParseAuditLine(t *testing.T) {
+	when := time.Date(2026, 1, 31, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		line string
+		want dbom.AuditEvent
+		ok   bool
+	}{
+		{
+			name: "delete",
+			line: "  srat-audit|alice|192.168.1.10|docs|unlinkat|ok|/mnt/docs/report.odt",
+			want: dbom.AuditEvent{Time: when, Username: "alice", ClientIP: "192.168.1.10", Share: "docs",
+				Operation: "unlinkat", Success: true, Path: "/mnt/docs/report.odt"},
+			ok: true,
+		},
+		{
+			name: "rename",
+			line: "srat-audit|bob|10.0.0.2|docs|renameat|ok|/mnt/docs/a.txt|/mnt/docs/b.txt",
+			want: dbom.AuditEvent{Time: when, Username: "bob", ClientIP: "10.0.0.2", Share: "docs",
+				Operation: "renameat", Success: true, Path: "/mnt/docs/a.txt", Target: "/mnt/docs/b.txt"},
+			ok: true,
+		},
+		{
+			name: "failure",
+			line: "Jan 31 18:00:00 nas smbd[42]: srat-audit|bob|10.0.0.2|docs|unlinkat|fail (Permission denied)|/mnt/docs/locked",
+			want: dbom.AuditEvent{Time: when, Username: "bob", ClientIP: "10.0.0.2", Share: "docs",
+				Operation: "unlinkat", Error: "Permission denied", Path: "/mnt/docs/locked"},
+			ok: true,
+		},
+		{name: "other message", line: "  Closing connection", ok: false},
+		{name: "short", line: "srat-audit|alice|192.168.1.10|docs", ok: false},
+		{name: "unknown result", line: "srat-audit|alice|192.168.1.10|docs|unlinkat|maybe|/x", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := parseAuditLine(tt.line, when)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.want, event)
+			}
+		})
+	}
+}
+
+type AuditServiceSuite struct {
+	suite.Suite
+	app     *fxtest.App
+	db      *gorm.DB
+	service *AuditService
+	logFile string
+	oldFile string
+}
+
+func TestAuditServiceSuite(t *testing.T) {
+	suite.Run(t, new(AuditServiceSuite))
+}
+
+func (suite *AuditServiceSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+				}
+			},
+			dbom.NewDB,
+		),
+		fx.Populate(&suite.db),
+	)
+	suite.app.RequireStart()
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.AuditEvent{}).Error)
+
+	suite.oldFile = auditLogFile
+	suite.logFile = filepath.Join(suite.T().TempDir(), "audit.log")
+	auditLogFile = suite.logFile
+	suite.service = suite.newService()
+}
+
+func (suite *AuditServiceSuite) TearDownTest() {
+	auditLogFile = suite.oldFile
+	suite.app.RequireStop()
+}
+
+// newService returns a collector starting from scratch, as after a restart.
+func (suite *AuditServiceSuite) newService() *AuditService {
+	return &AuditService{
+		ctx: context.Background(),
+		db:  suite.db,
+		now: func() time.Time { return time.Date(2026, 2, 1, 12, 0, 0, 0, time.Local) },
+	}
+}
+
+func (suite *AuditServiceSuite) appendLog(text string) {
+	file, err := os.OpenFile(suite.logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	suite.Require().NoError(err)
+	_, err = file.WriteString(text)
+	suite.Require().NoError(err)
+	suite.Require().NoError(file.Close())
+}
+
+func (suite *AuditServiceSuite) collect(expected int) {
+	count, err := suite.service.CollectAuditLog(context.Background())
+	suite.Require().NoError(err)
+	suite.Equal(expected, count)
+}
+
+const auditLogEntries = "[2026/02/01 10:00:00.000001,  1, class=full_audit] ../../source3/modules/vfs_full_audit.c:1041(do_log)\n" +
+	"  srat-audit|alice|192.168.1.10|docs|unlinkat|ok|/mnt/docs/report.odt\n" +
+	"[2026/02/01 10:05:00.000001,  1, class=full_audit] ../../source3/modules/vfs_full_audit.c:1041(do_log)\n" +
+	"  srat-audit|bob|192.168.1.11|media|renameat|ok|/mnt/media/a.mkv|/mnt/media/b.mkv\n"
+
+func (suite *AuditServiceSuite) TestCollectAuditLog() {
+	suite.collect(0) // no log yet
+
+	suite.appendLog(auditLogEntries + "[2026/02/01 10:06:00.000001,  1, class=full_audit] do_log\n  srat-audit|alice|192.168")
+	suite.collect(2)
+
+	// The line being written is collected once complete.
+	suite.appendLog(".1.10|docs|mkdirat|ok|/mnt/docs/new\n")
+	suite.collect(1)
+	suite.collect(0)
+
+	events, err := suite.service.ListAuditEvents(dto.AuditFilter{})
+	suite.Require().NoError(err)
+	suite.Require().Len(events, 3)
+	suite.Equal("mkdirat", events[0].Operation)
+	suite.Equal(time.Date(2026, 2, 1, 10, 6, 0, 1000, time.Local), events[0].Time.Local())
+	suite.Equal("/mnt/media/b.mkv", events[1].Target)
+
+	// A restarted collector reads the log again but skips what is stored.
+	suite.service = suite.newService()
+	suite.collect(0)
+}
+
+func (suite *AuditServiceSuite) TestCollectAuditLogRotated() {
+	// The second entry is half written when smbd rotates the log.
+	split := strings.Index(auditLogEntries, "[2026/02/01 10:05") + 10
+	suite.appendLog(auditLogEntries[:split])
+	suite.collect(1)
+
+	// smbd renames the full log to .old and starts a new one.
+	suite.appendLog(auditLogEntries[split:])
+	suite.Require().NoError(os.Rename(suite.logFile, suite.logFile+".old"))
+	suite.appendLog("[2026/02/01 11:00:00.000001,  1, class=full_audit] do_log\n" +
+		"  srat-audit|alice|192.168.1.10|docs|mkdirat|ok|/mnt/docs/new\n")
+	suite.collect(2)
+
+	events, err := suite.service.ListAuditEvents(dto.AuditFilter{})
+	suite.Require().NoError(err)
+	suite.Len(events, 3)
+}
+
+func (suite *AuditServiceSuite) TestCollectAuditLogPrunesOldEvents() {
+	suite.Require().NoError(suite.db.Create(&dbom.AuditEvent{
+		Time: suite.service.now().Add(-(defaultAuditRetentionDays + 1) * 24 * time.Hour), Username: "old",
+	}).Error)
+	suite.appendLog(auditLogEntries)
+	suite.collect(2)
+
+	events, err := suite.service.ListAuditEvents(dto.AuditFilter{Username: "old"})
+	suite.Require().NoError(err)
+	suite.Empty(events)
+}
+
+func (suite *AuditServiceSuite) TestListAuditEventsFilters() {
+	suite.appendLog(auditLogEntries)
+	suite.collect(2)
+
+	filters := map[string]dto.AuditFilter{
+		"user":      {Username: "alice"},
+		"share":     {Share: "docs"},
+		"client":    {ClientIP: "192.168.1.10"},
+		"operation": {Operation: "unlinkat"},
+		"time": {
+			From: time.Date(2026, 2, 1, 9, 0, 0, 0, time.Local),
+			To:   time.Date(2026, 2, 1, 10, 1, 0, 0, time.Local),
+		},
+	}
+	for name, filter := range filters {
+		events, err := suite.service.ListAuditEvents(filter)
+		suite.Require().NoError(err, name)
+		suite.Require().Len(events, 1, name)
+		suite.Equal("alice", events[0].Username, name)
+	}
+
+	events, err := suite.service.ListAuditEvents(dto.AuditFilter{Limit: 1, Offset: 1})
+	suite.Require().NoError(err)
+	suite.Require().Len(events, 1)
+	suite.Equal("alice", events[0].Username, "newest first")
+
+	_, err = suite.service.ListAuditEvents(dto.AuditFilter{Limit: maxAuditLimit + 1})
+	suite.True(errors.Is(err, dto.ErrorInvalidParameter))
+}
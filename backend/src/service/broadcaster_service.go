@@ -97,7 +97,7 @@ func NewBroadcasterService(
 }
 
 func (broker *BroadcasterService) setupEventListeners() []func() {
-	ret := make([]func(), 10)
+	ret := make([]func(), 12)
 	// Listen for disk events
 	ret[0] = broker.eventBus.OnDisk(func(ctx context.Context, event events.DiskEvent) errors.E {
 		diskID := "unknown"
@@ -181,6 +181,22 @@ func (broker *BroadcasterService) setupEventListeners() []func() {
 		broker.BroadcastMessage(*event.Problem)
 		return nil
 	})
+	ret[10] = broker.eventBus.OnJob(func(ctx context.Context, event events.JobEvent) errors.E {
+		if event.Run == nil {
+			return nil
+		}
+		tlog.TraceContext(ctx, "BroadcasterService received Job event", "job", event.Run.JobName, "status", event.Run.Status)
+		broker.BroadcastMessage(*event.Run)
+		return nil
+	})
+	ret[11] = broker.eventBus.OnRaid(func(ctx context.Context, event events.RaidEvent) errors.E {
+		if event.Array == nil {
+			return nil
+		}
+		tlog.TraceContext(ctx, "BroadcasterService received Raid event", "array", event.Array.Name, "state", event.Array.State)
+		broker.BroadcastMessage(*event.Array)
+		return nil
+	})
 
 	return ret
 }
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/dianlight/tlog"
+	"github.com/shirou/gopsutil/v4/process"
+	"gitlab.com/tozd/go/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	// configGenerationLimit is the number of applied configurations kept.
+	configGenerationLimit = 20
+)
+
+var (
+	// healthCheckedServices are the servers that must be running after a
+	// configuration is applied.
+	healthCheckedServices = []string{"smbd", "nmbd", "nfsd"}
+	// serverHealthTimeout is how long the servers have to come up after a
+	// restart.
+	serverHealthTimeout = 10 * time.Second
+)
+
+// configBackup is the content of a configuration file before an apply.
+type configBackup struct {
+	file    dbom.ConfigGenerationFile
+	missing bool
+}
+
+// generateConfigFiles renders the configuration files of the servers from
+// the database.
+func (self *ServerService) generateConfigFiles(ctx context.Context) ([]dbom.ConfigGenerationFile, errors.E) {
+	stream, errE := self.CreateSambaConfigStream()
+	if errE != nil {
+		return nil, errE
+	}
+	files := []dbom.ConfigGenerationFile{{Path: self.state.SambaConfigFile, Mode: 0o600, Content: *stream}}
+	// smb.conf has the bans of now, the ones of ApplyClientBans are dropped.
+	files = append(files, dbom.ConfigGenerationFile{Path: self.sambaHostsFile(), Mode: 0o600, Content: []byte{}})
+
+	// The username map lives in /etc/samba, which can't be written in
+	// protected mode (see writeSambaUsersMapConfig).
+	if !self.state.ProtectedMode {
+		stream, errE = self.CreateSambaUsersMapStream()
+		if errE != nil {
+			return nil, errE
+		}
+		files = append(files, dbom.ConfigGenerationFile{Path: sambaUsersMapFile, Mode: 0o644, Content: *stream})
+	}
+
+	if setting, err := self.setting_service.Load(); err == nil && setting.HAUseNFS != nil && *setting.HAUseNFS {
+		stream, errE = self.createNFSExportsStream(ctx)
+		if errE != nil {
+			return nil, errE
+		}
+		files = append(files, dbom.ConfigGenerationFile{Path: nfsExportsFile, Mode: 0o644, Content: *stream})
+	}
+	return files, nil
+}
+
+// applyConfigFiles applies files as a transaction: every file is staged next
+// to its target and validated, then all of them are swapped in with atomic
+// renames and the servers are restarted. When the restart or the health
+// check of the servers fails, the previous files are put back and the
+// servers restarted again. A successful apply is recorded as a new
+// generation, restoredFrom tells which generation files come from.
+func (self *ServerService) applyConfigFiles(ctx context.Context, files []dbom.ConfigGenerationFile, dirty dto.DataDirtyTracker, restoredFrom uint) errors.E {
+	self.applyMutex.Lock()
+	defer self.applyMutex.Unlock()
+
+	staged := make(map[string]string, len(files))
+	defer func() {
+		for _, path := range staged {
+			_ = os.Remove(path)
+		}
+	}()
+	for _, file := range files {
+		path, errE := stageConfigFile(file)
+		if errE != nil {
+			return errE
+		}
+		staged[file.Path] = path
+	}
+	if path, ok := staged[self.state.SambaConfigFile]; ok {
+		if errE := self.testSambaConfigFile(ctx, path); errE != nil {
+			return errE
+		}
+	}
+
+	backups, errE := backupConfigFiles(files)
+	if errE != nil {
+		return errE
+	}
+	expected := self.expectedServerProcesses(ctx)
+
+	for _, file := range files {
+		if err := os.Rename(staged[file.Path], file.Path); err != nil {
+			errE := errors.Wrapf(err, "failed to install %s", file.Path)
+			return self.rollbackConfigFiles(ctx, backups, dirty, errE)
+		}
+		delete(staged, file.Path)
+	}
+
+	if errE := self.restartServerServices(ctx, dirty); errE != nil {
+		return self.rollbackConfigFiles(ctx, backups, dirty, errE)
+	}
+	if errE := self.checkServerHealth(ctx, expected); errE != nil {
+		return self.rollbackConfigFiles(ctx, backups, dirty, errE)
+	}
+
+	self.recordConfigGeneration(ctx, files, restoredFrom)
+	return nil
+}
+
+// stageConfigFile writes file to a temporary file in the directory of its
+// target, so that it can be renamed over the target.
+func stageConfigFile(file dbom.ConfigGenerationFile) (string, errors.E) {
+	dir := filepath.Dir(file.Path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", errors.Wrapf(err, "failed to create %s", dir)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file.Path)+".srat-*")
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to stage %s", file.Path)
+	}
+	_, err = tmp.Write(file.Content)
+	if err == nil {
+		err = tmp.Chmod(file.Mode)
+	}
+	if errC := tmp.Close(); err == nil {
+		err = errC
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", errors.Wrapf(err, "failed to stage %s", file.Path)
+	}
+	return tmp.Name(), nil
+}
+
+// backupConfigFiles reads the current content of the targets of files.
+func backupConfigFiles(files []dbom.ConfigGenerationFile) ([]configBackup, errors.E) {
+	backups := make([]configBackup, 0, len(files))
+	for _, file := range files {
+		backup := configBackup{file: dbom.ConfigGenerationFile{Path: file.Path, Mode: file.Mode}}
+		content, err := os.ReadFile(file.Path)
+		switch {
+		case os.IsNotExist(err):
+			backup.missing = true
+		case err != nil:
+			return nil, errors.Wrapf(err, "failed to back up %s", file.Path)
+		default:
+			backup.file.Content = content
+			if info, err := os.Stat(file.Path); err == nil {
+				backup.file.Mode = info.Mode().Perm()
+			}
+		}
+		backups = append(backups, backup)
+	}
+	return backups, nil
+}
+
+// rollbackConfigFiles puts backups back after cause made an apply fail and
+// restarts the servers on the restored configuration.
+func (self *ServerService) rollbackConfigFiles(ctx context.Context, backups []configBackup, dirty dto.DataDirtyTracker, cause errors.E) errors.E {
+	tlog.ErrorContext(ctx, "Configuration apply failed, restoring the previous configuration", "error", cause)
+	var errs []error
+	for _, backup := range backups {
+		if backup.missing {
+			if err := os.Remove(backup.file.Path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, errors.Wrapf(err, "failed to remove %s", backup.file.Path))
+			}
+			continue
+		}
+		path, errE := stageConfigFile(backup.file)
+		if errE != nil {
+			errs = append(errs, errE)
+			continue
+		}
+		if err := os.Rename(path, backup.file.Path); err != nil {
+			_ = os.Remove(path)
+			errs = append(errs, errors.Wrapf(err, "failed to restore %s", backup.file.Path))
+		}
+	}
+	if errE := self.restartServerServices(ctx, dirty); errE != nil {
+		errs = append(errs, errE)
+	}
+	if err := errors.Join(errs...); err != nil {
+		tlog.ErrorContext(ctx, "Unable to restore the previous configuration", "error", err)
+		return errors.WithDetails(errors.WrapWith(cause, dto.ErrorConfigApplyFailed), "restore_error", err.Error())
+	}
+	return errors.WrapWith(cause, dto.ErrorConfigApplyFailed)
+}
+
+// expectedServerProcesses returns the health checked servers that must be
+// running once restarted: the managed ones that are running now or can be
+// started.
+func (self *ServerService) expectedServerProcesses(ctx context.Context) []string {
+	processes, err := self.GetServerProcesses()
+	if err != nil {
+		tlog.WarnContext(ctx, "Unable to get server processes, skipping health check", "error", err)
+		return nil
+	}
+	var expected []string
+	for _, name := range healthCheckedServices {
+		config, ok := serviceConfigMap[name]
+		if !ok || !config.Managed {
+			continue
+		}
+		if processRunning(ctx, *processes, name) || (len(config.StartCommand) > 0 && osutil.CommandExists(config.StartCommand)) {
+			expected = append(expected, name)
+		}
+	}
+	return expected
+}
+
+// processRunning tells whether the process of the server name is alive.
+func processRunning(ctx context.Context, processes dto.ServerProcessStatus, name string) bool {
+	status, ok := processes[name]
+	if !ok || status == nil || status.Pid <= 0 {
+		return false
+	}
+	exists, err := process.PidExistsWithContext(ctx, status.Pid)
+	return err == nil && exists
+}
+
+// checkServerHealth waits up to serverHealthTimeout for the expected servers
+// to be running.
+func (self *ServerService) checkServerHealth(ctx context.Context, expected []string) errors.E {
+	if len(expected) == 0 {
+		return nil
+	}
+	deadline := time.Now().Add(serverHealthTimeout)
+	for {
+		var down []string
+		if processes, err := self.GetServerProcesses(); err == nil {
+			for _, name := range expected {
+				if !processRunning(ctx, *processes, name) {
+					down = append(down, name)
+				}
+			}
+		} else {
+			down = slices.Clone(expected)
+		}
+		if len(down) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.WithDetails(dto.ErrorInvalidStateForOperation, "services", down, "reason", "servers not running after restart")
+		}
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// recordConfigGeneration stores files as the newest generation and drops
+// the generations beyond configGenerationLimit.
+func (self *ServerService) recordConfigGeneration(ctx context.Context, files []dbom.ConfigGenerationFile, restoredFrom uint) {
+	if self.db == nil {
+		return
+	}
+	generation := dbom.ConfigGeneration{RestoredFrom: restoredFrom, Files: files}
+	if err := gorm.G[dbom.ConfigGeneration](self.db).Create(ctx, &generation); err != nil {
+		tlog.WarnContext(ctx, "Failed to record configuration generation", "error", err)
+		return
+	}
+	err := self.db.WithContext(ctx).
+		Where("id NOT IN (?)", self.db.Model(&dbom.ConfigGeneration{}).Select("id").Order("id DESC").Limit(configGenerationLimit)).
+		Delete(&dbom.ConfigGeneration{}).Error
+	if err != nil {
+		tlog.WarnContext(ctx, "Failed to prune configuration history", "error", err)
+	}
+}
+
+func (self *ServerService) ListConfigGenerations() ([]dto.ConfigGeneration, errors.E) {
+	generations, err := gorm.G[dbom.ConfigGeneration](self.db).Order(g.ConfigGeneration.ID.Desc()).Find(self.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list configuration generations")
+	}
+	result := make([]dto.ConfigGeneration, 0, len(generations))
+	for i, generation := range generations {
+		paths := make([]string, 0, len(generation.Files))
+		for _, file := range generation.Files {
+			paths = append(paths, file.Path)
+		}
+		result = append(result, dto.ConfigGeneration{
+			Generation:   generation.ID,
+			AppliedAt:    generation.CreatedAt,
+			Files:        paths,
+			RestoredFrom: generation.RestoredFrom,
+			Current:      i == 0,
+		})
+	}
+	return result, nil
+}
+
+func (self *ServerService) RollbackConfig(ctx context.Context, generation uint) errors.E {
+	stored, err := gorm.G[dbom.ConfigGeneration](self.db).Where(g.ConfigGeneration.ID.Eq(generation)).First(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.WithDetails(dto.ErrorConfigGenerationNotFound, "generation", generation)
+		}
+		return errors.Wrap(err, "failed to load configuration generation")
+	}
+	tlog.InfoContext(ctx, "Rolling back configuration", "generation", generation)
+	if errE := self.applyConfigFiles(ctx, stored.Files, defaultDirtyMask, stored.ID); errE != nil {
+		return errE
+	}
+	// The generation has the bans of back then.
+	if errE := self.ApplyClientBans(ctx); errE != nil {
+		tlog.WarnContext(ctx, "Unable to apply the client bans after the rollback", "error", errE)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	cache "github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+// applyCommandRunner records the commands run by an apply and fails the ones
+// listed in fail.
+type applyCommandRunner struct {
+	commandexec.Executor
+	commands [][]string
+	fail     map[string]bool
+}
+
+func (r *applyCommandRunner) Execute(_ context.Context, _, _, command string, args ...string) (dto.CommandExecutionSnapshot, error) {
+	r.commands = append(r.commands, append([]string{command}, args...))
+	if r.fail[command] {
+		return dto.CommandExecutionSnapshot{}, errors.Errorf("%s failed", command)
+	}
+	return dto.CommandExecutionSnapshot{}, nil
+}
+
+type ConfigApplySuite struct {
+	suite.Suite
+	app       *fxtest.App
+	db        *gorm.DB
+	runner    *applyCommandRunner
+	service   *ServerService
+	dir       string
+	configMap map[string]serviceConfig
+}
+
+func TestConfigApplySuite(t *testing.T) {
+	suite.Run(t, new(ConfigApplySuite))
+}
+
+func (suite *ConfigApplySuite) SetupTest() {
+	var eventBus events.EventBusInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+				}
+			},
+			dbom.NewDB,
+			events.NewEventBus,
+		),
+		fx.Populate(&suite.db),
+		fx.Populate(&eventBus),
+	)
+	suite.app.RequireStart()
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.ConfigGeneration{}).Error)
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.ClientBan{}).Error)
+
+	suite.dir = suite.T().TempDir()
+	suite.runner = &applyCommandRunner{fail: map[string]bool{}}
+	suite.service = &ServerService{
+		ctx:           context.Background(),
+		state:         &dto.ContextState{SambaConfigFile: filepath.Join(suite.dir, "smb.conf")},
+		db:            suite.db,
+		eventBus:      eventBus,
+		commandRunner: suite.runner,
+		cache:         cache.New(cache.NoExpiration, cache.NoExpiration),
+		status:        dto.ServerProcessStatus{},
+	}
+
+	// No managed server: restarts and health checks do nothing unless a test
+	// sets its own servers.
+	suite.configMap = serviceConfigMap
+	serviceConfigMap = map[string]serviceConfig{}
+}
+
+func (suite *ConfigApplySuite) TearDownTest() {
+	serviceConfigMap = suite.configMap
+	suite.app.RequireStop()
+}
+
+func (suite *ConfigApplySuite) files(smbConf, exports string) []dbom.ConfigGenerationFile {
+	return []dbom.ConfigGenerationFile{
+		{Path: filepath.Join(suite.dir, "smb.conf"), Mode: 0o600, Content: []byte(smbConf)},
+		{Path: filepath.Join(suite.dir, "exports"), Mode: 0o644, Content: []byte(exports)},
+	}
+}
+
+func (suite *ConfigApplySuite) assertFile(name, content string) {
+	data, err := os.ReadFile(filepath.Join(suite.dir, name))
+	suite.Require().NoError(err)
+	suite.Equal(content, string(data))
+}
+
+func (suite *ConfigApplySuite) TestApplyRecordsGeneration() {
+	suite.Require().NoError(suite.service.applyConfigFiles(context.Background(), suite.files("v1", "e1"), defaultDirtyMask, 0))
+	suite.Require().NoError(suite.service.applyConfigFiles(context.Background(), suite.files("v2", "e2"), defaultDirtyMask, 0))
+
+	suite.assertFile("smb.conf", "v2")
+	suite.assertFile("exports", "e2")
+	info, err := os.Stat(filepath.Join(suite.dir, "smb.conf"))
+	suite.Require().NoError(err)
+	suite.Equal(os.FileMode(0o600), info.Mode().Perm())
+
+	// testparm validates the staged file, before it replaces smb.conf.
+	suite.Require().NotEmpty(suite.runner.commands)
+	suite.Equal("testparm", suite.runner.commands[0][0])
+	suite.NotEqual(filepath.Join(suite.dir, "smb.conf"), suite.runner.commands[0][2])
+
+	entries, err := os.ReadDir(suite.dir)
+	suite.Require().NoError(err)
+	suite.Len(entries, 2, "no staged file is left behind")
+
+	generations, errE := suite.service.ListConfigGenerations()
+	suite.Require().NoError(errE)
+	suite.Require().Len(generations, 2)
+	suite.True(generations[0].Current)
+	suite.False(generations[1].Current)
+	suite.Greater(generations[0].Generation, generations[1].Generation)
+	suite.Equal([]string{filepath.Join(suite.dir, "smb.conf"), filepath.Join(suite.dir, "exports")}, generations[0].Files)
+}
+
+func (suite *ConfigApplySuite) TestApplyInvalidConfigKeepsFiles() {
+	suite.Require().NoError(suite.service.applyConfigFiles(context.Background(), suite.files("v1", "e1"), defaultDirtyMask, 0))
+	suite.runner.fail["testparm"] = true
+
+	err := suite.service.applyConfigFiles(context.Background(), suite.files("broken", "e2"), defaultDirtyMask, 0)
+	suite.Require().Error(err)
+
+	suite.assertFile("smb.conf", "v1")
+	suite.assertFile("exports", "e1")
+	generations, errE := suite.service.ListConfigGenerations()
+	suite.Require().NoError(errE)
+	suite.Len(generations, 1)
+}
+
+func (suite *ConfigApplySuite) TestApplyRestartFailureRestoresPreviousFiles() {
+	suite.Require().NoError(suite.service.applyConfigFiles(context.Background(), suite.files("v1", "e1"), defaultDirtyMask, 0))
+	suite.Require().NoError(os.Remove(filepath.Join(suite.dir, "exports")))
+
+	serviceConfigMap = map[string]serviceConfig{
+		// Not running and started with a command that always exists.
+		"fake": {Name: "fake", Managed: true, StartCommand: []string{"true"}},
+	}
+	suite.runner.fail["true"] = true
+
+	err := suite.service.applyConfigFiles(context.Background(), suite.files("v2", "e2"), defaultDirtyMask, 0)
+	suite.Require().Error(err)
+	suite.True(errors.Is(err, dto.ErrorConfigApplyFailed))
+
+	suite.assertFile("smb.conf", "v1")
+	suite.NoFileExists(filepath.Join(suite.dir, "exports"), "a file missing before the apply is removed again")
+	generations, errE := suite.service.ListConfigGenerations()
+	suite.Require().NoError(errE)
+	suite.Len(generations, 1)
+}
+
+func (suite *ConfigApplySuite) TestRollbackConfig() {
+	suite.Require().NoError(suite.service.applyConfigFiles(context.Background(), suite.files("v1", "e1"), defaultDirtyMask, 0))
+	suite.Require().NoError(suite.service.applyConfigFiles(context.Background(), suite.files("v2", "e2"), defaultDirtyMask, 0))
+	generations, errE := suite.service.ListConfigGenerations()
+	suite.Require().NoError(errE)
+	first := generations[1].Generation
+
+	suite.Require().NoError(suite.service.RollbackConfig(context.Background(), first))
+	suite.assertFile("smb.conf", "v1")
+	suite.assertFile("exports", "e1")
+
+	generations, errE = suite.service.ListConfigGenerations()
+	suite.Require().NoError(errE)
+	suite.Require().Len(generations, 3)
+	suite.Equal(first, generations[0].RestoredFrom)
+
+	suite.True(errors.Is(suite.service.RollbackConfig(context.Background(), 9999), dto.ErrorConfigGenerationNotFound))
+}
+
+func (suite *ConfigApplySuite) TestApplyClientBans() {
+	suite.Require().NoError(suite.service.applyConfigFiles(context.Background(), suite.files(
+		"[global]\n   hosts allow = 127.0.0.1 10.0.0.0/8 EXCEPT 10.0.0.5\n", "e1"), defaultDirtyMask, 0))
+	suite.Require().NoError(suite.db.Create(&[]dbom.ClientBan{
+		{IP: "10.0.0.9", ExpiresAt: time.Now().Add(time.Hour)},
+		{IP: "10.0.0.7", ExpiresAt: time.Now().Add(-time.Minute)},
+	}).Error)
+	suite.runner.commands = nil
+
+	suite.Require().NoError(suite.service.ApplyClientBans(context.Background()))
+	suite.assertFile("smb.hosts.conf", "   hosts allow = 127.0.0.1 10.0.0.0/8 EXCEPT 10.0.0.9\n")
+	suite.assertFile("smb.conf", "[global]\n   hosts allow = 127.0.0.1 10.0.0.0/8 EXCEPT 10.0.0.5\n")
+	suite.Equal([][]string{{"smbcontrol", "smbd", "reload-config"}}, suite.runner.commands)
+
+	generations, errE := suite.service.ListConfigGenerations()
+	suite.Require().NoError(errE)
+	suite.Len(generations, 1, "bans don't record a generation")
+
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.ClientBan{}).Error)
+	suite.Require().NoError(suite.service.ApplyClientBans(context.Background()))
+	suite.assertFile("smb.hosts.conf", "   hosts allow = 127.0.0.1 10.0.0.0/8\n")
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/unifieddiff"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+)
+
+// testparmNoise are the informational lines testparm prints on stderr.
+var testparmNoise = []string{"Load smb config files from", "Loaded services file OK.", "Server role:"}
+
+func (self *ServerService) PreviewConfig(ctx context.Context) (*dto.ConfigPreview, errors.E) {
+	files, errE := self.generateConfigFiles(ctx)
+	if errE != nil {
+		return nil, errE
+	}
+
+	preview := &dto.ConfigPreview{TestparmWarnings: []string{}, Restarts: []dto.ServiceRestart{}}
+	for _, file := range files {
+		current, err := os.ReadFile(file.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to read %s", file.Path)
+		}
+		diff := unifieddiff.Diff(file.Path, file.Path, string(current), string(file.Content), unifieddiff.DefaultContext)
+		preview.Files = append(preview.Files, dto.ConfigFileDiff{Path: file.Path, Changed: diff != "", Diff: diff})
+
+		if file.Path == self.state.SambaConfigFile {
+			path, errE := stageConfigFile(file)
+			if errE != nil {
+				return nil, errE
+			}
+			preview.Valid, preview.TestparmWarnings = self.testparmWarnings(ctx, path)
+			_ = os.Remove(path)
+		}
+	}
+
+	if self.dirty_service != nil {
+		preview.Dirty = self.dirty_service.GetDirtyDataTracker()
+	}
+	processes, errE := self.GetServerProcesses()
+	if errE != nil {
+		return nil, errE
+	}
+	for name, processConfig := range serviceConfigMap {
+		if !processConfig.Managed {
+			continue
+		}
+		preview.Restarts = append(preview.Restarts, dto.ServiceRestart{
+			Service: name,
+			Action:  serviceRestartAction(processConfig, (*processes)[name], preview.Dirty),
+		})
+	}
+	sort.Slice(preview.Restarts, func(i, j int) bool { return preview.Restarts[i].Service < preview.Restarts[j].Service })
+	return preview, nil
+}
+
+// testparmWarnings validates the Samba configuration file at path and
+// returns whether it is valid together with the warnings of testparm.
+func (self *ServerService) testparmWarnings(ctx context.Context, path string) (bool, []string) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	warnings := []string{}
+	if self.commandRunner == nil {
+		return false, append(warnings, "command runner is not configured")
+	}
+	snapshot, err := self.commandRunner.ExecuteQuiet(ctx, "samba-testparm-preview", "Preview samba config", "testparm", "-s", path)
+	for _, line := range snapshot.Lines {
+		text := strings.TrimSpace(line.Line)
+		if line.Channel != dto.CommandOutputChannelStderr || text == "" || isTestparmNoise(text) {
+			continue
+		}
+		warnings = append(warnings, text)
+	}
+	if err != nil {
+		tlog.DebugContext(ctx, "testparm rejected the pending configuration", "error", err)
+		return false, append(warnings, err.Error())
+	}
+	return true, warnings
+}
+
+func isTestparmNoise(line string) bool {
+	for _, prefix := range testparmNoise {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
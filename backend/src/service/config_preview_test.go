@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/tozd/go/errors"
+)
+
+func TestServiceRestartAction(t *testing.T) {
+	config := serviceConfig{
+		SoftResetServiceMask: dto.DataDirtyTracker{Shares: true},
+		HardResetServiceMask: dto.DataDirtyTracker{Settings: true},
+	}
+	running := &dto.ProcessStatus{Pid: 42}
+
+	assert.Equal(t, dto.ServiceRestartActionNone, serviceRestartAction(config, running, dto.DataDirtyTracker{}))
+	assert.Equal(t, dto.ServiceRestartActionSoft, serviceRestartAction(config, running, dto.DataDirtyTracker{Shares: true}))
+	assert.Equal(t, dto.ServiceRestartActionHard, serviceRestartAction(config, running, dto.DataDirtyTracker{Shares: true, Settings: true}))
+	assert.Equal(t, dto.ServiceRestartActionHard, serviceRestartAction(config, &dto.ProcessStatus{}, dto.DataDirtyTracker{}), "a server without pid is restarted")
+	assert.Equal(t, dto.ServiceRestartActionNone, serviceRestartAction(config, nil, dto.DataDirtyTracker{Shares: true}), "no start command")
+
+	config.StartCommand = []string{"true"}
+	assert.Equal(t, dto.ServiceRestartActionStart, serviceRestartAction(config, nil, dto.DataDirtyTracker{}))
+}
+
+// testparmRunner answers testparm with canned output.
+type testparmRunner struct {
+	applyCommandRunner
+	lines []dto.CommandOutputLineSnapshot
+	err   error
+}
+
+func (r *testparmRunner) ExecuteQuiet(_ context.Context, _, _, _ string, _ ...string) (dto.CommandExecutionSnapshot, error) {
+	return dto.CommandExecutionSnapshot{Lines: r.lines}, r.err
+}
+
+func TestTestparmWarnings(t *testing.T) {
+	stderr := func(line string) dto.CommandOutputLineSnapshot {
+		return dto.CommandOutputLineSnapshot{Channel: dto.CommandOutputChannelStderr, Line: line}
+	}
+	runner := &testparmRunner{lines: []dto.CommandOutputLineSnapshot{
+		stderr("Load smb config files from /tmp/smb.conf"),
+		stderr("WARNING: The 'netbios name' is too long (max. 15 chars)."),
+		stderr("Loaded services file OK."),
+		stderr("Server role: ROLE_STANDALONE"),
+		stderr(""),
+		{Channel: dto.CommandOutputChannelStdout, Line: "[global]"},
+	}}
+	svc := &ServerService{commandRunner: runner}
+
+	valid, warnings := svc.testparmWarnings(context.Background(), "/tmp/smb.conf")
+	assert.True(t, valid)
+	assert.Equal(t, []string{"WARNING: The 'netbios name' is too long (max. 15 chars)."}, warnings)
+
+	runner.lines = []dto.CommandOutputLineSnapshot{stderr("Unknown parameter encountered: \"bogus\"")}
+	runner.err = errors.New("exit status 1")
+	valid, warnings = svc.testparmWarnings(context.Background(), "/tmp/smb.conf")
+	assert.False(t, valid)
+	assert.Equal(t, []string{"Unknown parameter encountered: \"bogus\"", "exit status 1"}, warnings)
+}
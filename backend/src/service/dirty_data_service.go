@@ -40,7 +40,7 @@ func NewDirtyDataService(lc fx.Lifecycle, ctx context.Context, eventBus events.E
 	p.eventBus = eventBus
 	p.timerMutex = sync.Mutex{}
 
-	unsubscribe := make([]func(), 5)
+	unsubscribe := make([]func(), 6)
 	if eventBus != nil {
 		unsubscribe[0] = eventBus.OnShare(func(ctx context.Context, event events.ShareEvent) errors.E {
 			slog.DebugContext(ctx, "DirtyDataService received Share event", "share", event.Share.Name)
@@ -52,6 +52,12 @@ func NewDirtyDataService(lc fx.Lifecycle, ctx context.Context, eventBus events.E
 			p.setDirtyUsers()
 			return nil
 		})
+		unsubscribe[5] = eventBus.OnGroup(func(ctx context.Context, event events.GroupEvent) errors.E {
+			slog.DebugContext(ctx, "DirtyDataService received Group event", "group", event.Group.Name)
+			// Groups are rendered as @group principals in the share sections.
+			p.setDirtyShares()
+			return nil
+		})
 		unsubscribe[2] = eventBus.OnSetting(func(ctx context.Context, event events.SettingEvent) errors.E {
 			p.setDirtySettings()
 			return nil
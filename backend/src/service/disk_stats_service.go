@@ -45,6 +45,7 @@ type diskStatsService struct {
 	smartEnabledCache        *cache.Cache // smartEnabledCache tracks SMART enabled/disabled state per disk to avoid unnecessary disk access
 	smartIntegrationDisabled atomic.Bool
 	settingService           SettingServiceInterface
+	statsHistory             StatsHistoryServiceInterface
 	pauseResumeCommandChan   chan string // Channel to signal run process to pause/resume
 }
 
@@ -58,6 +59,7 @@ func NewDiskStatsService(
 	EventBus events.EventBusInterface,
 	SettingService SettingServiceInterface,
 	FilesystemService FilesystemServiceInterface,
+	StatsHistory StatsHistoryServiceInterface,
 ) DiskStatsService {
 	var fs blockdevice.FS
 	var err error
@@ -81,6 +83,7 @@ func NewDiskStatsService(
 		hdidleService:     HDIdleService,
 		settingService:    SettingService,
 		filesystemService: FilesystemService,
+		statsHistory:      StatsHistory,
 		readFile:          os.ReadFile,
 		sysFsBasePath:     "/sys/fs",
 		// Initialize cache with 30 minute default expiration and 10 minute cleanup interval
@@ -393,9 +396,34 @@ func (s *diskStatsService) updateDiskStats(isHeavyTick bool) errors.E {
 	}
 
 	s.lastUpdateTime = time.Now()
+	s.recordHistory()
 	return nil
 }
 
+// recordHistory stores the I/O rates and latencies of the disks in the
+// statistics history. Latencies are only stored for disks that did I/O.
+func (s *diskStatsService) recordHistory() {
+	if s.statsHistory == nil || len(s.currentDiskHealth.PerDiskIO) == 0 {
+		return
+	}
+	samples := make([]dto.StatsSample, 0, 4*len(s.currentDiskHealth.PerDiskIO))
+	for _, io := range s.currentDiskHealth.PerDiskIO {
+		samples = append(samples,
+			dto.StatsSample{Metric: dto.StatsDiskReadIOPS, Series: io.DeviceDescription, Value: io.ReadIOPS},
+			dto.StatsSample{Metric: dto.StatsDiskWriteIOPS, Series: io.DeviceDescription, Value: io.WriteIOPS},
+		)
+		if io.ReadIOPS > 0 {
+			samples = append(samples, dto.StatsSample{Metric: dto.StatsDiskReadLatency, Series: io.DeviceDescription, Value: io.ReadLatency})
+		}
+		if io.WriteIOPS > 0 {
+			samples = append(samples, dto.StatsSample{Metric: dto.StatsDiskWriteLatency, Series: io.DeviceDescription, Value: io.WriteLatency})
+		}
+	}
+	if err := s.statsHistory.Record(s.ctx, s.lastUpdateTime, samples...); err != nil {
+		tlog.DebugContext(s.ctx, "Failed to record disk statistics", "error", err)
+	}
+}
+
 // populatePerDiskInfo populates the PerDiskInfo map with SMART info, health status, and HDIdle status for a disk.
 func (s *diskStatsService) populatePerDiskInfo(disk *dto.Disk) {
 	if disk == nil || disk.Id == nil {
@@ -99,6 +99,7 @@ func (suite *EventPropagationTestSuite) SetupTest() {
 			NewDirtyDataService,
 			NewShareService,
 			NewUserService,
+			NewHomesService,
 			// Real VolumeService with injected test mount ops
 			NewVolumeMountManager,
 			NewVolumeService,
@@ -196,6 +196,20 @@ func (b *baseAdapter) runCommandMode(ctx context.Context, quiet bool, name strin
 	return output, exitCode, nil
 }
 
+// runCheckedCommand runs a command and turns a non-zero exit code into an
+// error. Quiet runs do not emit command_output events, which keeps periodic
+// reads from flooding the clients.
+func (b *baseAdapter) runCheckedCommand(ctx context.Context, quiet bool, name string, args ...string) (string, errors.E) {
+	output, exitCode, err := b.runCommandMode(ctx, quiet, name, args...)
+	if err != nil {
+		return output, err
+	}
+	if exitCode != 0 {
+		return output, errors.Errorf("%s %s failed with exit code %d: %s", name, strings.Join(args, " "), exitCode, strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
 // runCommandCached executes a command and caches the result by command name and exact args.
 // This limits command execution to at most once per cache TTL for each unique command+args key.
 func (b *baseAdapter) runCommandCached(ctx context.Context, name string, args ...string) (string, int, errors.E) {
@@ -2,12 +2,36 @@ package filesystem
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dianlight/srat/dto"
 	"gitlab.com/tozd/go/errors"
 )
 
+// btrfsSnapshotDir holds the read-only snapshot subvolumes of a volume.
+const btrfsSnapshotDir = ".snapshots"
+
+// Rollback staging directories, inside the snapshot directory so they stay
+// out of the share and are ignored when listing the snapshots.
+const (
+	btrfsRollbackRestored = ".rollback-restored"
+	btrfsRollbackPrevious = ".rollback-previous"
+)
+
+// btrfsRestoreScript copies the content of the snapshot into a new staging
+// directory, sharing the extents when cp supports reflinks (BusyBox does
+// not). The snapshot directory is skipped. Any failed copy fails the script.
+// Positional arguments: $1 snapshot, $2 staging dir, $3 snapshot dir name.
+const btrfsRestoreScript = `mkdir "$2" && reflink= && ` +
+	`if cp --reflink=auto /dev/null "$2/.probe" 2>/dev/null; then reflink=--reflink=auto; fi && rm -f "$2/.probe" && ` +
+	`for e in "$1"/* "$1"/.[!.]* "$1"/..?*; do ` +
+	`if [ -e "$e" ] || [ -L "$e" ]; then [ "${e##*/}" = "$3" ] || cp -a $reflink "$e" "$2/" || exit 1; fi; ` +
+	`done`
+
 // BtrfsAdapter implements FilesystemAdapter for Btrfs filesystems
 type BtrfsAdapter struct {
 	baseAdapter
@@ -282,3 +306,206 @@ func (a *BtrfsAdapter) GetState(ctx context.Context, device string) (dto.Filesys
 
 	return state, nil
 }
+
+// SetDirQuota limits the qgroup of the subvolume mounted at path. Quota
+// accounting is enabled on demand, which is a no-op when already active.
+func (a *BtrfsAdapter) SetDirQuota(ctx context.Context, path string, limit uint64) errors.E {
+	if _, err := a.runCheckedCommand(ctx, false, "btrfs", "quota", "enable", path); err != nil {
+		return errors.WithDetails(err, "Path", path)
+	}
+	size := "none"
+	if limit > 0 {
+		size = strconv.FormatUint(limit, 10)
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "btrfs", "qgroup", "limit", size, path); err != nil {
+		return errors.WithDetails(err, "Path", path)
+	}
+	return nil
+}
+
+// GetDirQuota reads referenced bytes and max referenced limit of the qgroup of path.
+func (a *BtrfsAdapter) GetDirQuota(ctx context.Context, path string) (dto.QuotaUsage, errors.E) {
+	output, err := a.runCheckedCommand(ctx, true, "btrfs", "qgroup", "show", "-rf", "--raw", path)
+	if err != nil {
+		return dto.QuotaUsage{}, errors.WithDetails(err, "Path", path)
+	}
+	// Format:
+	// Qgroupid    Referenced    Exclusive   Max referenced
+	// --------    ----------    ---------   --------------
+	// 0/257            16384        16384       1073741824
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.Contains(fields[0], "/") || strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		used, errE := parseQuotaNumber(fields[1])
+		if errE != nil {
+			return dto.QuotaUsage{}, errE
+		}
+		limit, errE := parseQuotaNumber(fields[3])
+		if errE != nil {
+			return dto.QuotaUsage{}, errE
+		}
+		return dto.NewQuotaUsage(used, limit), nil
+	}
+	return dto.QuotaUsage{}, errors.Errorf("no qgroup found for %s", path)
+}
+
+// dirQuotaCoversVolume marks btrfs: a qgroup belongs to a subvolume.
+func (a *BtrfsAdapter) dirQuotaCoversVolume() {}
+
+// SetUserQuota is not supported: btrfs qgroups account subvolumes, not users.
+func (a *BtrfsAdapter) SetUserQuota(ctx context.Context, path, username string, limit uint64) errors.E {
+	return errors.WithDetails(dto.ErrorQuotaNotSupported, "Filesystem", a.name, "User", username)
+}
+
+// GetUserQuota is not supported: btrfs qgroups account subvolumes, not users.
+func (a *BtrfsAdapter) GetUserQuota(ctx context.Context, path, username string) (dto.QuotaUsage, errors.E) {
+	return dto.QuotaUsage{}, errors.WithDetails(dto.ErrorQuotaNotSupported, "Filesystem", a.name, "User", username)
+}
+
+// SnapshotDir returns the directory holding the snapshot subvolumes.
+func (a *BtrfsAdapter) SnapshotDir() string {
+	return btrfsSnapshotDir
+}
+
+// CreateSnapshot takes a read-only snapshot of the subvolume mounted at path.
+func (a *BtrfsAdapter) CreateSnapshot(ctx context.Context, path, name string) errors.E {
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+	dir := filepath.Join(path, btrfsSnapshotDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.WithDetails(err, "Dir", dir)
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "btrfs", "subvolume", "snapshot", "-r", path, filepath.Join(dir, name)); err != nil {
+		return errors.WithDetails(err, "Path", path)
+	}
+	return nil
+}
+
+// ListSnapshots lists the snapshot subvolumes of path.
+func (a *BtrfsAdapter) ListSnapshots(ctx context.Context, path string) ([]dto.Snapshot, errors.E) {
+	return snapshotsInDir(filepath.Join(path, btrfsSnapshotDir))
+}
+
+// DeleteSnapshot deletes a snapshot subvolume of path.
+func (a *BtrfsAdapter) DeleteSnapshot(ctx context.Context, path, name string) errors.E {
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "btrfs", "subvolume", "delete", filepath.Join(path, btrfsSnapshotDir, name)); err != nil {
+		return errors.WithDetails(err, "Path", path)
+	}
+	return nil
+}
+
+// RollbackSnapshot restores the volume to a snapshot. Newer snapshots are
+// kept, so destroyNewer is ignored. The live data is never removed before the
+// restored copy is in place:
+//  1. a safety snapshot of the current content is taken, so the rollback
+//     itself can be undone from Previous Versions;
+//  2. the snapshot is copied into a staging directory of the volume;
+//  3. the staged entries are swapped with the live ones by rename;
+//  4. the previous entries are deleted once the swap succeeded.
+//
+// The volume is the mounted subvolume, which cannot be replaced while in use,
+// and entries cannot be renamed across subvolumes, so the restored copy is
+// staged inside it rather than in a snapshot subvolume.
+func (a *BtrfsAdapter) RollbackSnapshot(ctx context.Context, path, name string, destroyNewer bool) errors.E {
+	_ = destroyNewer
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+	dir := filepath.Join(path, btrfsSnapshotDir)
+	snapshot := filepath.Join(dir, name)
+	if _, err := os.Stat(snapshot); err != nil {
+		return errors.WithDetails(dto.ErrorSnapshotNotFound, "Name", name)
+	}
+
+	safety := dto.SnapshotName(time.Now())
+	if _, err := os.Stat(filepath.Join(dir, safety)); err != nil {
+		if err := a.CreateSnapshot(ctx, path, safety); err != nil {
+			return errors.Wrap(err, "failed to take the safety snapshot")
+		}
+	}
+
+	restored := filepath.Join(dir, btrfsRollbackRestored)
+	previous := filepath.Join(dir, btrfsRollbackPrevious)
+	// Leftovers of an interrupted rollback: the live data is never in them.
+	for _, stale := range []string{restored, previous} {
+		if err := os.RemoveAll(stale); err != nil {
+			return errors.WithDetails(err, "Dir", stale)
+		}
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "sh", "-c", btrfsRestoreScript, "sh", snapshot, restored, btrfsSnapshotDir); err != nil {
+		_ = os.RemoveAll(restored)
+		return errors.WithDetails(err, "Path", path)
+	}
+	if err := swapEntries(path, restored, previous, btrfsSnapshotDir); err != nil {
+		_ = os.RemoveAll(restored)
+		return errors.WithDetails(err, "Path", path)
+	}
+	if err := os.RemoveAll(previous); err != nil {
+		return errors.WithDetails(err, "Dir", previous)
+	}
+	if err := os.Remove(restored); err != nil {
+		return errors.WithDetails(err, "Dir", restored)
+	}
+	return nil
+}
+
+// swapEntries moves the entries of root, except skip, into previous and the
+// entries of staging into root, by rename. On failure the entries already
+// moved are put back, leaving root as it was.
+func swapEntries(root, staging, previous, skip string) error {
+	live, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	restored, err := os.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(previous, 0o700); err != nil {
+		return err
+	}
+
+	var saved, placed []string
+	undo := func() {
+		for _, name := range placed {
+			_ = os.Rename(filepath.Join(root, name), filepath.Join(staging, name))
+		}
+		for _, name := range saved {
+			_ = os.Rename(filepath.Join(previous, name), filepath.Join(root, name))
+		}
+	}
+	for _, entry := range live {
+		if entry.Name() == skip {
+			continue
+		}
+		if err := os.Rename(filepath.Join(root, entry.Name()), filepath.Join(previous, entry.Name())); err != nil {
+			undo()
+			return err
+		}
+		saved = append(saved, entry.Name())
+	}
+	for _, entry := range restored {
+		if err := os.Rename(filepath.Join(staging, entry.Name()), filepath.Join(root, entry.Name())); err != nil {
+			undo()
+			return err
+		}
+		placed = append(placed, entry.Name())
+	}
+	return nil
+}
+
+// Scrub runs a foreground scrub of the filesystem mounted at path. btrfs
+// exits with 3 when uncorrectable errors were found.
+func (a *BtrfsAdapter) Scrub(ctx context.Context, path string) (string, errors.E) {
+	output, err := a.runCheckedCommand(ctx, false, "btrfs", "scrub", "start", "-B", path)
+	if err != nil {
+		return output, errors.WithDetails(err, "Path", path)
+	}
+	return output, nil
+}
@@ -0,0 +1,129 @@
+package filesystem
+
+import (
+	"context"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/darwinstubs/mount"
+	"gitlab.com/tozd/go/errors"
+)
+
+// CifsAdapter implements FilesystemAdapter for SMB/CIFS shares of other hosts.
+// The source of a mount is //server/share. A network share has no device, so
+// it is never detected on a partition.
+type CifsAdapter struct {
+	baseAdapter
+}
+
+// NewCifsAdapter creates a new CifsAdapter instance
+func NewCifsAdapter() FilesystemAdapter {
+	return &CifsAdapter{
+		baseAdapter: newBaseAdapter(
+			"cifs",
+			"SMB/CIFS network share",
+			false,
+			"cifs-utils",
+			"",
+			"",
+			"",
+			"",
+			"",
+			[]dto.FsMagicSignature{},
+			"smb3",
+		),
+	}
+}
+
+// GetMountFlags returns CIFS-specific mount flags
+func (a *CifsAdapter) GetMountFlags() []dto.MountFlag {
+	return []dto.MountFlag{
+		{Name: "vers", Description: "SMB protocol version", NeedsValue: true, ValueDescription: "Version (e.g. 3.0)", ValueValidationRegex: `^(1\.0|2\.0|2\.1|3|3\.0|3\.02|3\.1\.1|default)$`},
+		{Name: "uid", Description: "User ID owning the files", NeedsValue: true, ValueDescription: "User ID", ValueValidationRegex: `^\d+$`},
+		{Name: "gid", Description: "Group ID owning the files", NeedsValue: true, ValueDescription: "Group ID", ValueValidationRegex: `^\d+$`},
+		{Name: "file_mode", Description: "Permissions of the files", NeedsValue: true, ValueDescription: "Octal mode (e.g. 0644)", ValueValidationRegex: `^0?[0-7]{3}$`},
+		{Name: "dir_mode", Description: "Permissions of the directories", NeedsValue: true, ValueDescription: "Octal mode (e.g. 0755)", ValueValidationRegex: `^0?[0-7]{3}$`},
+		{Name: "iocharset", Description: "Charset of the file names", NeedsValue: true, ValueDescription: "Charset (e.g. utf8)", ValueValidationRegex: `^[a-zA-Z0-9_-]+$`},
+		{Name: "sec", Description: "Security mode", NeedsValue: true, ValueDescription: "Mode", ValueValidationRegex: `^(none|krb5i?|ntlmv2i?|ntlmsspi?)$`},
+		{Name: "cache", Description: "Caching mode", NeedsValue: true, ValueDescription: "Mode", ValueValidationRegex: `^(none|strict|loose)$`},
+		{Name: "echo_interval", Description: "Seconds between the echoes detecting a dead server", NeedsValue: true, ValueDescription: "Seconds", ValueValidationRegex: `^\d+$`},
+		{Name: "seal", Description: "Encrypt the SMB3 traffic"},
+		{Name: "soft", Description: "Fail the requests when the server does not answer, instead of retrying"},
+		{Name: "noserverino", Description: "Generate the inode numbers instead of using the ones of the server"},
+		{Name: "nounix", Description: "Disable the CIFS Unix extensions"},
+	}
+}
+
+// IsSupported checks if CIFS shares can be mounted on the system
+func (a *CifsAdapter) IsSupported(ctx context.Context) (dto.FilesystemSupport, errors.E) {
+	support := dto.FilesystemSupport{
+		AlpinePackage: a.alpinePackage,
+		MissingTools:  []string{},
+	}
+	support.CanMount = a.commandExists("mount.cifs")
+	if !support.CanMount {
+		support.MissingTools = append(support.MissingTools, "mount.cifs")
+	}
+	support.CanFormat = false   // A network share is formatted on its server
+	support.CanCheck = false    // A network share is checked on its server
+	support.CanSetLabel = false // A network share has no label
+
+	return support, nil
+}
+
+// Mount mounts the //server/share source with mount.cifs.
+func (a *CifsAdapter) Mount(
+	ctx context.Context,
+	source, target, fsType, data string,
+	flags uintptr,
+	prepareTarget func() error,
+) (*mount.MountPoint, errors.E) {
+	_ = fsType
+	return a.helperMount(ctx, "mount.cifs", source, target, data, flags, prepareTarget)
+}
+
+// Unmount unmounts a CIFS share, detaching it when the server is gone.
+func (a *CifsAdapter) Unmount(ctx context.Context, target string, force, lazy bool) errors.E {
+	return a.networkUnmount(ctx, target, force, lazy)
+}
+
+// Format is not supported for network shares
+func (a *CifsAdapter) Format(ctx context.Context, device string, options dto.FormatOptions, progress dto.ProgressCallback) errors.E {
+	if progress != nil {
+		progress("failure", 0, []string{"A network share cannot be formatted"})
+	}
+	return errors.Errorf("a network share cannot be formatted")
+}
+
+// Check is not supported for network shares
+func (a *CifsAdapter) Check(ctx context.Context, device string, options dto.CheckOptions, progress dto.ProgressCallback) (dto.CheckResult, errors.E) {
+	if progress != nil {
+		progress("failure", 0, []string{"Check the filesystem on the server instead"})
+	}
+	result := dto.CheckResult{
+		Success:  false,
+		Message:  "Check the filesystem on the server instead",
+		ExitCode: 1,
+	}
+	return result, errors.Errorf("check the filesystem on the server instead")
+}
+
+// GetLabel is not supported for network shares
+func (a *CifsAdapter) GetLabel(ctx context.Context, device string) (string, errors.E) {
+	return "", errors.Errorf("network shares have no label")
+}
+
+// SetLabel is not supported for network shares
+func (a *CifsAdapter) SetLabel(ctx context.Context, device string, label string) errors.E {
+	return errors.Errorf("network shares have no label")
+}
+
+// GetState returns the state of a CIFS share
+func (a *CifsAdapter) GetState(ctx context.Context, device string) (dto.FilesystemState, errors.E) {
+	state := dto.FilesystemState{
+		AdditionalInfo:   make(map[string]any),
+		IsClean:          true,
+		HasErrors:        false,
+		StateDescription: "SMB/CIFS network share",
+	}
+	return state, nil
+}
@@ -0,0 +1,114 @@
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/stretchr/testify/suite"
+)
+
+type CifsAdapterTestSuite struct {
+	suite.Suite
+	adapter filesystem.FilesystemAdapter
+	clean   func()
+	ctx     context.Context
+}
+
+func TestCifsAdapterTestSuite(t *testing.T) {
+	suite.Run(t, new(CifsAdapterTestSuite))
+}
+
+func (suite *CifsAdapterTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.adapter = filesystem.NewCifsAdapter()
+	suite.Require().NotNil(suite.adapter)
+	suite.clean = suite.adapter.SetExecOpsForTesting(
+		func(cmd string) (string, error) {
+			if cmd == "mount.cifs" {
+				return cmd, nil
+			}
+			return "", errors.New("command not found")
+		})
+}
+
+func (suite *CifsAdapterTestSuite) TearDownTest() {
+	if suite.clean != nil {
+		suite.clean()
+	}
+}
+
+func (suite *CifsAdapterTestSuite) TestGetName() {
+	suite.Equal("cifs", suite.adapter.GetName())
+	suite.Contains(suite.adapter.GetAliasNames(), "smb3")
+}
+
+func (suite *CifsAdapterTestSuite) TestIsSupported() {
+	support, err := suite.adapter.IsSupported(suite.ctx)
+	suite.NoError(err)
+	suite.True(support.CanMount)
+	suite.False(support.CanFormat)
+	suite.False(support.CanCheck)
+	suite.False(support.CanSetLabel)
+	suite.Equal("cifs-utils", support.AlpinePackage)
+	suite.Empty(support.MissingTools)
+}
+
+func (suite *CifsAdapterTestSuite) TestIsSupportedWithoutHelper() {
+	suite.clean()
+	suite.clean = suite.adapter.SetExecOpsForTesting(
+		func(cmd string) (string, error) {
+			return "", errors.New("command not found")
+		})
+
+	support, err := suite.adapter.IsSupported(suite.ctx)
+	suite.NoError(err)
+	suite.False(support.CanMount)
+	suite.Contains(support.MissingTools, "mount.cifs")
+}
+
+func (suite *CifsAdapterTestSuite) TestMountRunsHelperWithOptions() {
+	binDir := suite.T().TempDir()
+	args := filepath.Join(suite.T().TempDir(), "args")
+	script := "#!/bin/sh\necho \"$*\" > \"" + args + "\"\n"
+	suite.Require().NoError(os.WriteFile(filepath.Join(binDir, "mount.cifs"), []byte(script), 0o755))
+	suite.T().Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	target := filepath.Join(suite.T().TempDir(), "media")
+
+	mp, err := suite.adapter.Mount(suite.ctx, "//nas/media", target, "cifs", "vers=3.0,credentials=/data/remote/media.cred",
+		syscall.MS_RDONLY|syscall.MS_NOEXEC, func() error {
+			return os.MkdirAll(target, 0o750)
+		})
+	suite.Require().NoError(err)
+	suite.Equal("cifs", mp.FSType)
+	suite.Equal("//nas/media", mp.Device)
+	suite.DirExists(target)
+
+	data, errR := os.ReadFile(args)
+	suite.Require().NoError(errR)
+	suite.Equal("//nas/media "+target+" -o noexec,ro,vers=3.0,credentials=/data/remote/media.cred", strings.TrimSpace(string(data)))
+}
+
+func (suite *CifsAdapterTestSuite) TestMountFailureReportsHelperOutput() {
+	binDir := suite.T().TempDir()
+	script := "#!/bin/sh\necho 'mount error(113): could not connect to nas'\nexit 32\n"
+	suite.Require().NoError(os.WriteFile(filepath.Join(binDir, "mount.cifs"), []byte(script), 0o755))
+	suite.T().Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, err := suite.adapter.Mount(suite.ctx, "//nas/media", suite.T().TempDir(), "cifs", "", 0, nil)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "mount.cifs failed")
+}
+
+func (suite *CifsAdapterTestSuite) TestIsDeviceNeverSupported() {
+	path := createTempDeviceWithMagic(suite.T(), 0, []byte("SMB"))
+
+	supported, err := suite.adapter.IsDeviceSupported(suite.ctx, path)
+	suite.NoError(err)
+	suite.False(supported)
+}
@@ -2,6 +2,7 @@ package filesystem
 
 import (
 	"context"
+	"strconv"
 	"strings"
 
 	"github.com/dianlight/srat/dto"
@@ -302,3 +303,49 @@ func (a *Ext4Adapter) GetState(ctx context.Context, device string) (dto.Filesyst
 
 	return state, nil
 }
+
+// SetDirQuota tags path with a project (see ProjectID), inherited by new
+// entries, and sets its hard block limit. The filesystem needs the quota and
+// project features and must be mounted with the prjquota option.
+func (a *Ext4Adapter) SetDirQuota(ctx context.Context, path string, limit uint64) errors.E {
+	id := strconv.FormatUint(uint64(ProjectID(path)), 10)
+	if _, err := a.runCheckedCommand(ctx, false, "chattr", "-p", id, "+P", path); err != nil {
+		return errors.WithDetails(err, "Path", path)
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "setquota", "-P", id, "0", strconv.FormatUint(kib(limit), 10), "0", "0", path); err != nil {
+		return errors.WithDetails(err, "Path", path)
+	}
+	return nil
+}
+
+// DirQuotaTagCommand tags every entry under path with its project.
+func (a *Ext4Adapter) DirQuotaTagCommand(path string) (string, []string) {
+	return "chattr", []string{"-R", "-p", strconv.FormatUint(uint64(ProjectID(path)), 10), "+P", path}
+}
+
+// GetDirQuota reports the block usage of the project bound to path.
+func (a *Ext4Adapter) GetDirQuota(ctx context.Context, path string) (dto.QuotaUsage, errors.E) {
+	output, err := a.runCheckedCommand(ctx, true, "repquota", "-P", "-n", "-O", "csv", path)
+	if err != nil {
+		return dto.QuotaUsage{}, errors.WithDetails(err, "Path", path)
+	}
+	return parseRepquotaCSV(output, strconv.FormatUint(uint64(ProjectID(path)), 10))
+}
+
+// SetUserQuota sets the hard block limit of username. The filesystem must be
+// mounted with the usrquota option.
+func (a *Ext4Adapter) SetUserQuota(ctx context.Context, path, username string, limit uint64) errors.E {
+	if _, err := a.runCheckedCommand(ctx, false, "setquota", "-u", username, "0", strconv.FormatUint(kib(limit), 10), "0", "0", path); err != nil {
+		return errors.WithDetails(err, "Path", path, "User", username)
+	}
+	return nil
+}
+
+// GetUserQuota reports the block usage of username.
+func (a *Ext4Adapter) GetUserQuota(ctx context.Context, path, username string) (dto.QuotaUsage, errors.E) {
+	output, err := a.runCheckedCommand(ctx, true, "repquota", "-u", "-O", "csv", path)
+	if err != nil {
+		return dto.QuotaUsage{}, errors.WithDetails(err, "Path", path, "User", username)
+	}
+	return parseRepquotaCSV(output, username)
+}
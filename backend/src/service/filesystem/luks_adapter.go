@@ -0,0 +1,120 @@
+package filesystem
+
+import (
+	"context"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/darwinstubs/mount"
+	"gitlab.com/tozd/go/errors"
+)
+
+// LuksFsType is the udev ID_FS_TYPE of a LUKS container.
+const LuksFsType = "crypto_LUKS"
+
+// LuksAdapter implements FilesystemAdapter for LUKS encrypted containers. A
+// container is not mounted itself: it is detected here and opened by the LUKS
+// service, which exposes the mapper device as a partition of its own.
+type LuksAdapter struct {
+	baseAdapter
+}
+
+// NewLuksAdapter creates a new LuksAdapter instance
+func NewLuksAdapter() FilesystemAdapter {
+	return &LuksAdapter{
+		baseAdapter: newBaseAdapter(
+			"luks",
+			"LUKS Encrypted Container",
+			false,
+			"cryptsetup",
+			"",
+			"",
+			"",
+			"cryptsetup",
+			"",
+			[]dto.FsMagicSignature{
+				{Offset: 0, Magic: []byte{'L', 'U', 'K', 'S', 0xba, 0xbe}},      // LUKS1 and LUKS2 primary header
+				{Offset: 0x4000, Magic: []byte{'S', 'K', 'U', 'L', 0xba, 0xbe}}, // LUKS2 secondary header
+			},
+			LuksFsType,
+		),
+	}
+}
+
+// GetMountFlags returns no flags, the mapper device is mounted with the flags
+// of its own filesystem.
+func (a *LuksAdapter) GetMountFlags() []dto.MountFlag {
+	return []dto.MountFlag{}
+}
+
+// IsSupported checks if LUKS containers can be opened on the system
+func (a *LuksAdapter) IsSupported(ctx context.Context) (dto.FilesystemSupport, errors.E) {
+	support := dto.FilesystemSupport{
+		AlpinePackage: a.alpinePackage,
+		MissingTools:  []string{},
+	}
+	// Unlocking takes the place of mounting.
+	support.CanMount = a.commandExists("cryptsetup")
+	if !support.CanMount {
+		support.MissingTools = append(support.MissingTools, "cryptsetup")
+	}
+	support.CanFormat = false   // Creating containers is left to cryptsetup luksFormat
+	support.CanCheck = false    // The filesystem inside is checked once unlocked
+	support.CanSetLabel = false // The filesystem inside carries the label
+
+	return support, nil
+}
+
+// Mount refuses to mount a LUKS container directly: it has to be unlocked and
+// the opened mapper device mounted instead.
+func (a *LuksAdapter) Mount(
+	ctx context.Context,
+	source, target, fsType, data string,
+	flags uintptr,
+	prepareTarget func() error,
+) (*mount.MountPoint, errors.E) {
+	return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation,
+		"Source", source, "Target", target, "Message", "LUKS container must be unlocked before mounting")
+}
+
+// Format is not supported for LUKS containers
+func (a *LuksAdapter) Format(ctx context.Context, device string, options dto.FormatOptions, progress dto.ProgressCallback) errors.E {
+	if progress != nil {
+		progress("failure", 0, []string{"LUKS containers are not created by SRAT"})
+	}
+	return errors.Errorf("LUKS containers are not created by SRAT, use cryptsetup luksFormat")
+}
+
+// Check is not supported for LUKS containers
+func (a *LuksAdapter) Check(ctx context.Context, device string, options dto.CheckOptions, progress dto.ProgressCallback) (dto.CheckResult, errors.E) {
+	if progress != nil {
+		progress("failure", 0, []string{"Unlock the LUKS container to check its filesystem"})
+	}
+	result := dto.CheckResult{
+		Success:  false,
+		Message:  "Unlock the LUKS container to check its filesystem",
+		ExitCode: 1,
+	}
+	return result, errors.Errorf("unlock the LUKS container to check its filesystem")
+}
+
+// GetLabel is not supported for LUKS containers
+func (a *LuksAdapter) GetLabel(ctx context.Context, device string) (string, errors.E) {
+	return "", errors.Errorf("unlock the LUKS container to read its filesystem label")
+}
+
+// SetLabel is not supported for LUKS containers
+func (a *LuksAdapter) SetLabel(ctx context.Context, device string, label string) errors.E {
+	return errors.Errorf("unlock the LUKS container to set its filesystem label")
+}
+
+// GetState returns the state of a LUKS container
+func (a *LuksAdapter) GetState(ctx context.Context, device string) (dto.FilesystemState, errors.E) {
+	state := dto.FilesystemState{
+		AdditionalInfo:   make(map[string]any),
+		IsClean:          true,
+		HasErrors:        false,
+		StateDescription: "Encrypted container",
+	}
+	state.AdditionalInfo["encrypted"] = true
+	return state, nil
+}
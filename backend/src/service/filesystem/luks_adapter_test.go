@@ -0,0 +1,101 @@
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/stretchr/testify/suite"
+)
+
+type LuksAdapterTestSuite struct {
+	suite.Suite
+	adapter filesystem.FilesystemAdapter
+	clean   func()
+	ctx     context.Context
+}
+
+func TestLuksAdapterTestSuite(t *testing.T) {
+	suite.Run(t, new(LuksAdapterTestSuite))
+}
+
+func (suite *LuksAdapterTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.adapter = filesystem.NewLuksAdapter()
+	suite.Require().NotNil(suite.adapter)
+	suite.clean = suite.adapter.SetExecOpsForTesting(
+		func(cmd string) (string, error) {
+			if cmd == "cryptsetup" {
+				return cmd, nil
+			}
+			return "", errors.New("command not found")
+		})
+}
+
+func (suite *LuksAdapterTestSuite) TearDownTest() {
+	if suite.clean != nil {
+		suite.clean()
+	}
+}
+
+func (suite *LuksAdapterTestSuite) TestGetName() {
+	suite.Equal("luks", suite.adapter.GetName())
+	suite.Contains(suite.adapter.GetAliasNames(), filesystem.LuksFsType)
+}
+
+func (suite *LuksAdapterTestSuite) TestRegistryResolvesUdevType() {
+	adapter, err := filesystem.NewRegistry().Get("crypto_LUKS")
+	suite.Require().NoError(err)
+	suite.Equal("luks", adapter.GetName())
+}
+
+func (suite *LuksAdapterTestSuite) TestIsSupported() {
+	support, err := suite.adapter.IsSupported(suite.ctx)
+	suite.NoError(err)
+	suite.True(support.CanMount)
+	suite.False(support.CanFormat)
+	suite.False(support.CanCheck)
+	suite.False(support.CanSetLabel)
+	suite.False(support.IsExportable)
+	suite.Equal("cryptsetup", support.AlpinePackage)
+	suite.Empty(support.MissingTools)
+}
+
+func (suite *LuksAdapterTestSuite) TestIsSupportedWithoutCryptsetup() {
+	suite.clean()
+	suite.clean = suite.adapter.SetExecOpsForTesting(
+		func(cmd string) (string, error) {
+			return "", errors.New("command not found")
+		})
+
+	support, err := suite.adapter.IsSupported(suite.ctx)
+	suite.NoError(err)
+	suite.False(support.CanMount)
+	suite.Contains(support.MissingTools, "cryptsetup")
+}
+
+func (suite *LuksAdapterTestSuite) TestMountRequiresUnlock() {
+	_, err := suite.adapter.Mount(suite.ctx, "/dev/sda1", "/mnt/secret", "crypto_LUKS", "", 0, nil)
+	suite.Require().Error(err)
+	suite.ErrorIs(err, dto.ErrorInvalidStateForOperation)
+}
+
+func (suite *LuksAdapterTestSuite) TestIsDeviceSupportedWithSignature() {
+	for _, signature := range suite.adapter.GetFsSignatureMagic() {
+		path := createTempDeviceWithMagic(suite.T(), signature.Offset, signature.Magic)
+
+		supported, err := suite.adapter.IsDeviceSupported(suite.ctx, path)
+		suite.NoError(err)
+		suite.True(supported, "signature at offset %#x", signature.Offset)
+	}
+}
+
+func (suite *LuksAdapterTestSuite) TestIsDeviceSupportedWithoutSignature() {
+	path := createTempDeviceWithMagic(suite.T(), 0, []byte("NOTLUKS"))
+
+	supported, err := suite.adapter.IsDeviceSupported(suite.ctx, path)
+	suite.NoError(err)
+	suite.False(supported)
+}
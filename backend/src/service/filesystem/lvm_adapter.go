@@ -0,0 +1,124 @@
+package filesystem
+
+import (
+	"context"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/darwinstubs/mount"
+	"gitlab.com/tozd/go/errors"
+)
+
+// LvmFsType is the udev ID_FS_TYPE of an LVM physical volume.
+const LvmFsType = "LVM2_member"
+
+// LvmAdapter implements FilesystemAdapter for LVM physical volumes. A physical
+// volume is not mounted itself: it is detected here and its logical volumes
+// are exposed by the LVM service as partitions of their own.
+type LvmAdapter struct {
+	baseAdapter
+}
+
+// NewLvmAdapter creates a new LvmAdapter instance
+func NewLvmAdapter() FilesystemAdapter {
+	lvm2 := []byte{'L', 'V', 'M', '2', ' ', '0', '0', '1'}
+	return &LvmAdapter{
+		baseAdapter: newBaseAdapter(
+			"lvm",
+			"LVM Physical Volume",
+			false,
+			"lvm2",
+			"",
+			"",
+			"",
+			"pvs",
+			"",
+			// The label is in one of the first four sectors, the second by
+			// default, with the type 0x18 bytes after LABELONE.
+			[]dto.FsMagicSignature{
+				{Offset: 0x018, Magic: lvm2},
+				{Offset: 0x218, Magic: lvm2},
+				{Offset: 0x418, Magic: lvm2},
+				{Offset: 0x618, Magic: lvm2},
+			},
+			LvmFsType,
+		),
+	}
+}
+
+// GetMountFlags returns no flags, the logical volumes are mounted with the
+// flags of their own filesystem.
+func (a *LvmAdapter) GetMountFlags() []dto.MountFlag {
+	return []dto.MountFlag{}
+}
+
+// IsSupported checks if LVM logical volumes can be used on the system
+func (a *LvmAdapter) IsSupported(ctx context.Context) (dto.FilesystemSupport, errors.E) {
+	support := dto.FilesystemSupport{
+		AlpinePackage: a.alpinePackage,
+		MissingTools:  []string{},
+	}
+	// Mounting a logical volume takes the place of mounting the physical one.
+	support.CanMount = a.commandExists("lvs")
+	if !support.CanMount {
+		support.MissingTools = append(support.MissingTools, "lvs")
+	}
+	support.CanFormat = false   // Physical volumes are created with pvcreate
+	support.CanCheck = false    // The filesystems of the logical volumes are checked
+	support.CanSetLabel = false // The logical volumes carry the labels
+
+	return support, nil
+}
+
+// Mount refuses to mount an LVM physical volume directly, its logical volumes
+// are mounted instead.
+func (a *LvmAdapter) Mount(
+	ctx context.Context,
+	source, target, fsType, data string,
+	flags uintptr,
+	prepareTarget func() error,
+) (*mount.MountPoint, errors.E) {
+	return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation,
+		"Source", source, "Target", target, "Message", "LVM physical volume cannot be mounted, mount its logical volumes instead")
+}
+
+// Format is not supported for LVM physical volumes
+func (a *LvmAdapter) Format(ctx context.Context, device string, options dto.FormatOptions, progress dto.ProgressCallback) errors.E {
+	if progress != nil {
+		progress("failure", 0, []string{"LVM physical volumes are not created by SRAT"})
+	}
+	return errors.Errorf("LVM physical volumes are not created by SRAT, use pvcreate")
+}
+
+// Check is not supported for LVM physical volumes
+func (a *LvmAdapter) Check(ctx context.Context, device string, options dto.CheckOptions, progress dto.ProgressCallback) (dto.CheckResult, errors.E) {
+	if progress != nil {
+		progress("failure", 0, []string{"Check the filesystems of the logical volumes instead"})
+	}
+	result := dto.CheckResult{
+		Success:  false,
+		Message:  "Check the filesystems of the logical volumes instead",
+		ExitCode: 1,
+	}
+	return result, errors.Errorf("check the filesystems of the logical volumes instead")
+}
+
+// GetLabel is not supported for LVM physical volumes
+func (a *LvmAdapter) GetLabel(ctx context.Context, device string) (string, errors.E) {
+	return "", errors.Errorf("LVM physical volumes have no label")
+}
+
+// SetLabel is not supported for LVM physical volumes
+func (a *LvmAdapter) SetLabel(ctx context.Context, device string, label string) errors.E {
+	return errors.Errorf("LVM physical volumes have no label")
+}
+
+// GetState returns the state of an LVM physical volume
+func (a *LvmAdapter) GetState(ctx context.Context, device string) (dto.FilesystemState, errors.E) {
+	state := dto.FilesystemState{
+		AdditionalInfo:   make(map[string]any),
+		IsClean:          true,
+		HasErrors:        false,
+		StateDescription: "LVM physical volume",
+	}
+	return state, nil
+}
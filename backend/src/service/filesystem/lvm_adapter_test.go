@@ -0,0 +1,101 @@
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/stretchr/testify/suite"
+)
+
+type LvmAdapterTestSuite struct {
+	suite.Suite
+	adapter filesystem.FilesystemAdapter
+	clean   func()
+	ctx     context.Context
+}
+
+func TestLvmAdapterTestSuite(t *testing.T) {
+	suite.Run(t, new(LvmAdapterTestSuite))
+}
+
+func (suite *LvmAdapterTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.adapter = filesystem.NewLvmAdapter()
+	suite.Require().NotNil(suite.adapter)
+	suite.clean = suite.adapter.SetExecOpsForTesting(
+		func(cmd string) (string, error) {
+			if cmd == "lvs" {
+				return cmd, nil
+			}
+			return "", errors.New("command not found")
+		})
+}
+
+func (suite *LvmAdapterTestSuite) TearDownTest() {
+	if suite.clean != nil {
+		suite.clean()
+	}
+}
+
+func (suite *LvmAdapterTestSuite) TestGetName() {
+	suite.Equal("lvm", suite.adapter.GetName())
+	suite.Contains(suite.adapter.GetAliasNames(), filesystem.LvmFsType)
+}
+
+func (suite *LvmAdapterTestSuite) TestRegistryResolvesUdevType() {
+	adapter, err := filesystem.NewRegistry().Get("LVM2_member")
+	suite.Require().NoError(err)
+	suite.Equal("lvm", adapter.GetName())
+}
+
+func (suite *LvmAdapterTestSuite) TestIsSupported() {
+	support, err := suite.adapter.IsSupported(suite.ctx)
+	suite.NoError(err)
+	suite.True(support.CanMount)
+	suite.False(support.CanFormat)
+	suite.False(support.CanCheck)
+	suite.False(support.CanSetLabel)
+	suite.False(support.IsExportable)
+	suite.Equal("lvm2", support.AlpinePackage)
+	suite.Empty(support.MissingTools)
+}
+
+func (suite *LvmAdapterTestSuite) TestIsSupportedWithoutLvm() {
+	suite.clean()
+	suite.clean = suite.adapter.SetExecOpsForTesting(
+		func(cmd string) (string, error) {
+			return "", errors.New("command not found")
+		})
+
+	support, err := suite.adapter.IsSupported(suite.ctx)
+	suite.NoError(err)
+	suite.False(support.CanMount)
+	suite.Contains(support.MissingTools, "lvs")
+}
+
+func (suite *LvmAdapterTestSuite) TestMountRefused() {
+	_, err := suite.adapter.Mount(suite.ctx, "/dev/sda1", "/mnt/data", "LVM2_member", "", 0, nil)
+	suite.Require().Error(err)
+	suite.ErrorIs(err, dto.ErrorInvalidStateForOperation)
+}
+
+func (suite *LvmAdapterTestSuite) TestIsDeviceSupportedWithSignature() {
+	for _, signature := range suite.adapter.GetFsSignatureMagic() {
+		path := createTempDeviceWithMagic(suite.T(), signature.Offset, signature.Magic)
+
+		supported, err := suite.adapter.IsDeviceSupported(suite.ctx, path)
+		suite.NoError(err)
+		suite.True(supported, "signature at offset %#x", signature.Offset)
+	}
+}
+
+func (suite *LvmAdapterTestSuite) TestIsDeviceSupportedWithoutSignature() {
+	path := createTempDeviceWithMagic(suite.T(), 0, []byte("LABELONE"))
+
+	supported, err := suite.adapter.IsDeviceSupported(suite.ctx, path)
+	suite.NoError(err)
+	suite.False(supported)
+}
@@ -0,0 +1,187 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/darwinstubs/mount"
+	"gitlab.com/tozd/go/errors"
+)
+
+// MergerfsFsType is the fstype of a mergerfs union as shown in the mount table.
+const MergerfsFsType = "fuse.mergerfs"
+
+// MergerfsAdapter implements FilesystemAdapter for mergerfs unions. The source
+// of a mount is the list of the branch directories joined by ':'. A union has
+// no device of its own, so it is never detected on a partition.
+type MergerfsAdapter struct {
+	baseAdapter
+}
+
+// NewMergerfsAdapter creates a new MergerfsAdapter instance
+func NewMergerfsAdapter() FilesystemAdapter {
+	return &MergerfsAdapter{
+		baseAdapter: newBaseAdapter(
+			"mergerfs",
+			"mergerfs union of directories (FUSE)",
+			false,
+			"mergerfs",
+			"",
+			"",
+			"",
+			"",
+			"",
+			[]dto.FsMagicSignature{},
+			MergerfsFsType,
+		),
+	}
+}
+
+// GetMountFlags returns mergerfs-specific mount flags
+func (a *MergerfsAdapter) GetMountFlags() []dto.MountFlag {
+	return []dto.MountFlag{
+		{Name: "category.create", Description: "Policy choosing the branch new files are created on", NeedsValue: true, ValueDescription: "Create policy", ValueValidationRegex: `^(epmfs|mfs|lfs)$`},
+		{Name: "minfreespace", Description: "Minimum free space of a branch to create files on it", NeedsValue: true, ValueDescription: "Size (e.g. 4G)", ValueValidationRegex: `^\d+[KMGT]?$`},
+		{Name: "moveonenospc", Description: "Move a file to another branch when its branch is full"},
+		{Name: "allow_other", Description: "Allow other users to access the union"},
+	}
+}
+
+// IsSupported checks if mergerfs unions can be mounted on the system
+func (a *MergerfsAdapter) IsSupported(ctx context.Context) (dto.FilesystemSupport, errors.E) {
+	support := dto.FilesystemSupport{
+		AlpinePackage: a.alpinePackage,
+		MissingTools:  []string{},
+	}
+	support.CanMount = a.commandExists("mergerfs")
+	if !support.CanMount {
+		support.MissingTools = append(support.MissingTools, "mergerfs")
+	}
+	support.CanFormat = false   // A union is made of directories, not devices
+	support.CanCheck = false    // The filesystems of the branches are checked
+	support.CanSetLabel = false // A union has no label
+
+	return support, nil
+}
+
+// Mount mounts the union of the ':' separated branch directories of source.
+func (a *MergerfsAdapter) Mount(
+	ctx context.Context,
+	source, target, fsType, data string,
+	flags uintptr,
+	prepareTarget func() error,
+) (*mount.MountPoint, errors.E) {
+	_ = fsType
+
+	if prepareTarget != nil {
+		if err := prepareTarget(); err != nil {
+			return nil, errors.WithDetails(err, "Target", target, "Message", "failed to prepare mergerfs mount target")
+		}
+	}
+
+	args := make([]string, 0, 4)
+	if strings.TrimSpace(data) != "" {
+		args = append(args, "-o", data)
+	}
+	args = append(args, source, target)
+
+	output, exitCode, err := a.runCommand(ctx, "mergerfs", args...)
+	if err != nil {
+		return nil, errors.WithDetails(err,
+			"Source", source,
+			"Target", target,
+			"Data", data,
+			"ExitCode", exitCode,
+			"Output", output,
+		)
+	}
+	if exitCode != 0 {
+		return nil, errors.WithDetails(errors.New("mergerfs mount failed"),
+			"Source", source,
+			"Target", target,
+			"Data", data,
+			"ExitCode", exitCode,
+			"Output", output,
+		)
+	}
+
+	return &mount.MountPoint{
+		Path:   target,
+		Device: source,
+		FSType: MergerfsFsType,
+		Flags:  flags,
+		Data:   data,
+	}, nil
+}
+
+// Unmount unmounts a mergerfs union using FUSE-first semantics.
+func (a *MergerfsAdapter) Unmount(ctx context.Context, target string, force, lazy bool) errors.E {
+	if a.commandExists("fusermount3") {
+		args := []string{"-u", target}
+		if lazy {
+			args = []string{"-u", "-z", target}
+		}
+		output, exitCode, err := a.runCommand(ctx, "fusermount3", args...)
+		if err == nil && exitCode == 0 {
+			return nil
+		}
+
+		if err != nil {
+			err = errors.WithDetails(err, "Output", output, "ExitCode", exitCode, "Target", target)
+			_ = err // fallback to generic unmount below
+		}
+	}
+
+	if err := a.baseAdapter.Unmount(ctx, target, force, lazy); err != nil {
+		return errors.WithDetails(err,
+			"Target", target,
+			"Message", fmt.Sprintf("mergerfs unmount failed via fusermount3 and generic unmount fallback: %v", err),
+		)
+	}
+
+	return nil
+}
+
+// Format is not supported for mergerfs unions
+func (a *MergerfsAdapter) Format(ctx context.Context, device string, options dto.FormatOptions, progress dto.ProgressCallback) errors.E {
+	if progress != nil {
+		progress("failure", 0, []string{"A mergerfs union cannot be formatted, format its branches instead"})
+	}
+	return errors.Errorf("a mergerfs union cannot be formatted, format its branches instead")
+}
+
+// Check is not supported for mergerfs unions
+func (a *MergerfsAdapter) Check(ctx context.Context, device string, options dto.CheckOptions, progress dto.ProgressCallback) (dto.CheckResult, errors.E) {
+	if progress != nil {
+		progress("failure", 0, []string{"Check the filesystems of the branches instead"})
+	}
+	result := dto.CheckResult{
+		Success:  false,
+		Message:  "Check the filesystems of the branches instead",
+		ExitCode: 1,
+	}
+	return result, errors.Errorf("check the filesystems of the branches instead")
+}
+
+// GetLabel is not supported for mergerfs unions
+func (a *MergerfsAdapter) GetLabel(ctx context.Context, device string) (string, errors.E) {
+	return "", errors.Errorf("mergerfs unions have no label")
+}
+
+// SetLabel is not supported for mergerfs unions
+func (a *MergerfsAdapter) SetLabel(ctx context.Context, device string, label string) errors.E {
+	return errors.Errorf("mergerfs unions have no label")
+}
+
+// GetState returns the state of a mergerfs union
+func (a *MergerfsAdapter) GetState(ctx context.Context, device string) (dto.FilesystemState, errors.E) {
+	state := dto.FilesystemState{
+		AdditionalInfo:   make(map[string]any),
+		IsClean:          true,
+		HasErrors:        false,
+		StateDescription: "mergerfs union",
+	}
+	return state, nil
+}
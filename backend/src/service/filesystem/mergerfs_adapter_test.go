@@ -0,0 +1,107 @@
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/stretchr/testify/suite"
+)
+
+type MergerfsAdapterTestSuite struct {
+	suite.Suite
+	adapter filesystem.FilesystemAdapter
+	clean   func()
+	ctx     context.Context
+}
+
+func TestMergerfsAdapterTestSuite(t *testing.T) {
+	suite.Run(t, new(MergerfsAdapterTestSuite))
+}
+
+func (suite *MergerfsAdapterTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.adapter = filesystem.NewMergerfsAdapter()
+	suite.Require().NotNil(suite.adapter)
+	suite.clean = suite.adapter.SetExecOpsForTesting(
+		func(cmd string) (string, error) {
+			if cmd == "mergerfs" {
+				return cmd, nil
+			}
+			return "", errors.New("command not found")
+		})
+}
+
+func (suite *MergerfsAdapterTestSuite) TearDownTest() {
+	if suite.clean != nil {
+		suite.clean()
+	}
+}
+
+func (suite *MergerfsAdapterTestSuite) TestGetName() {
+	suite.Equal("mergerfs", suite.adapter.GetName())
+	suite.Contains(suite.adapter.GetAliasNames(), filesystem.MergerfsFsType)
+}
+
+func (suite *MergerfsAdapterTestSuite) TestRegistryResolvesMountType() {
+	adapter, err := filesystem.NewRegistry().Get("fuse.mergerfs")
+	suite.Require().NoError(err)
+	suite.Equal("mergerfs", adapter.GetName())
+}
+
+func (suite *MergerfsAdapterTestSuite) TestIsSupported() {
+	support, err := suite.adapter.IsSupported(suite.ctx)
+	suite.NoError(err)
+	suite.True(support.CanMount)
+	suite.False(support.CanFormat)
+	suite.False(support.CanCheck)
+	suite.False(support.CanSetLabel)
+	suite.Equal("mergerfs", support.AlpinePackage)
+	suite.Empty(support.MissingTools)
+}
+
+func (suite *MergerfsAdapterTestSuite) TestIsSupportedWithoutMergerfs() {
+	suite.clean()
+	suite.clean = suite.adapter.SetExecOpsForTesting(
+		func(cmd string) (string, error) {
+			return "", errors.New("command not found")
+		})
+
+	support, err := suite.adapter.IsSupported(suite.ctx)
+	suite.NoError(err)
+	suite.False(support.CanMount)
+	suite.Contains(support.MissingTools, "mergerfs")
+}
+
+func (suite *MergerfsAdapterTestSuite) TestMountRunsMergerfs() {
+	binDir := suite.T().TempDir()
+	args := filepath.Join(suite.T().TempDir(), "args")
+	script := "#!/bin/sh\necho \"$*\" > \"" + args + "\"\n"
+	suite.Require().NoError(os.WriteFile(filepath.Join(binDir, "mergerfs"), []byte(script), 0o755))
+	suite.T().Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	target := filepath.Join(suite.T().TempDir(), "pool")
+
+	mp, err := suite.adapter.Mount(suite.ctx, "/mnt/a:/mnt/b", target, "mergerfs", "category.create=mfs", 0, func() error {
+		return os.MkdirAll(target, 0o750)
+	})
+	suite.Require().NoError(err)
+	suite.Equal(filesystem.MergerfsFsType, mp.FSType)
+	suite.Equal("/mnt/a:/mnt/b", mp.Device)
+	suite.DirExists(target)
+
+	data, errR := os.ReadFile(args)
+	suite.Require().NoError(errR)
+	suite.Equal("-o category.create=mfs /mnt/a:/mnt/b "+target, strings.TrimSpace(string(data)))
+}
+
+func (suite *MergerfsAdapterTestSuite) TestIsDeviceNeverSupported() {
+	path := createTempDeviceWithMagic(suite.T(), 0, []byte("mergerfs"))
+
+	supported, err := suite.adapter.IsDeviceSupported(suite.ctx, path)
+	suite.NoError(err)
+	suite.False(supported)
+}
@@ -0,0 +1,104 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/darwinstubs/mount"
+	"gitlab.com/tozd/go/errors"
+)
+
+// helperMountOptions turns the syscall flags and the data of a mount into the
+// -o options of a mount helper such as mount.cifs or mount.nfs.
+func helperMountOptions(flags uintptr, data string) string {
+	flagMap := dto.MountFlagsMap()
+	names := make([]string, 0, len(flagMap))
+	for name, value := range flagMap {
+		if value != 0 && flags&value == value {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	options := make([]string, 0, len(names)+1)
+	var seen uintptr
+	for _, name := range names {
+		// acl and posixacl share a bit, keep only one of them.
+		if seen&flagMap[name] != 0 {
+			continue
+		}
+		seen |= flagMap[name]
+		options = append(options, name)
+	}
+	if data = strings.TrimSpace(data); data != "" {
+		options = append(options, data)
+	}
+	return strings.Join(options, ",")
+}
+
+// helperMount mounts a network filesystem with its mount helper, which
+// resolves the server name and reads the credentials files the kernel cannot.
+func (b *baseAdapter) helperMount(
+	ctx context.Context,
+	helper, source, target, data string,
+	flags uintptr,
+	prepareTarget func() error,
+) (*mount.MountPoint, errors.E) {
+	if prepareTarget != nil {
+		if err := prepareTarget(); err != nil {
+			return nil, errors.WithDetails(err, "Target", target, "Message", "failed to prepare "+b.name+" mount target")
+		}
+	}
+
+	options := helperMountOptions(flags, data)
+	args := []string{source, target}
+	if options != "" {
+		args = append(args, "-o", options)
+	}
+
+	output, exitCode, err := b.runCommand(ctx, helper, args...)
+	if err != nil {
+		return nil, errors.WithDetails(err,
+			"Source", source,
+			"Target", target,
+			"Options", options,
+			"ExitCode", exitCode,
+			"Output", output,
+		)
+	}
+	if exitCode != 0 {
+		return nil, errors.WithDetails(errors.Errorf("%s failed", helper),
+			"Source", source,
+			"Target", target,
+			"Options", options,
+			"ExitCode", exitCode,
+			"Output", output,
+		)
+	}
+
+	return &mount.MountPoint{
+		Path:   target,
+		Device: source,
+		FSType: b.name,
+		Flags:  flags,
+		Data:   data,
+	}, nil
+}
+
+// networkUnmount unmounts a network filesystem, detaching it lazily when the
+// server is gone and a plain unmount fails.
+func (b *baseAdapter) networkUnmount(ctx context.Context, target string, force, lazy bool) errors.E {
+	err := b.Unmount(ctx, target, force, lazy)
+	if err == nil || lazy {
+		return err
+	}
+	if errLazy := b.Unmount(ctx, target, true, true); errLazy != nil {
+		return errors.WithDetails(errLazy,
+			"Target", target,
+			"Message", fmt.Sprintf("%s unmount failed, also when detaching lazily: %v", b.name, err),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package filesystem
+
+import (
+	"context"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/darwinstubs/mount"
+	"gitlab.com/tozd/go/errors"
+)
+
+// NfsAdapter implements FilesystemAdapter for NFS exports of other hosts. The
+// source of a mount is server:/export. A network export has no device, so it
+// is never detected on a partition.
+type NfsAdapter struct {
+	baseAdapter
+}
+
+// NewNfsAdapter creates a new NfsAdapter instance
+func NewNfsAdapter() FilesystemAdapter {
+	return &NfsAdapter{
+		baseAdapter: newBaseAdapter(
+			"nfs",
+			"NFS network export",
+			false,
+			"nfs-utils",
+			"",
+			"",
+			"",
+			"",
+			"",
+			[]dto.FsMagicSignature{},
+			"nfs4",
+		),
+	}
+}
+
+// GetMountFlags returns NFS-specific mount flags
+func (a *NfsAdapter) GetMountFlags() []dto.MountFlag {
+	return []dto.MountFlag{
+		{Name: "vers", Description: "NFS protocol version", NeedsValue: true, ValueDescription: "Version (e.g. 4.2)", ValueValidationRegex: `^(3|4|4\.0|4\.1|4\.2)$`},
+		{Name: "proto", Description: "Transport protocol", NeedsValue: true, ValueDescription: "Protocol", ValueValidationRegex: `^(tcp|udp|rdma)6?$`},
+		{Name: "port", Description: "Port of the NFS server", NeedsValue: true, ValueDescription: "Port", ValueValidationRegex: `^\d+$`},
+		{Name: "timeo", Description: "Tenths of a second to wait for an answer before retrying", NeedsValue: true, ValueDescription: "Tenths of a second", ValueValidationRegex: `^\d+$`},
+		{Name: "retrans", Description: "Retries before a soft mount fails or a hard mount warns", NeedsValue: true, ValueDescription: "Retries", ValueValidationRegex: `^\d+$`},
+		{Name: "rsize", Description: "Maximum bytes of a read request", NeedsValue: true, ValueDescription: "Bytes", ValueValidationRegex: `^\d+$`},
+		{Name: "wsize", Description: "Maximum bytes of a write request", NeedsValue: true, ValueDescription: "Bytes", ValueValidationRegex: `^\d+$`},
+		{Name: "sec", Description: "Security flavor", NeedsValue: true, ValueDescription: "Flavor", ValueValidationRegex: `^(sys|krb5[ip]?)$`},
+		{Name: "soft", Description: "Fail the requests when the server does not answer, instead of retrying"},
+		{Name: "hard", Description: "Retry the requests until the server answers again"},
+		{Name: "nolock", Description: "Use local locks instead of the NLM protocol"},
+	}
+}
+
+// IsSupported checks if NFS exports can be mounted on the system
+func (a *NfsAdapter) IsSupported(ctx context.Context) (dto.FilesystemSupport, errors.E) {
+	support := dto.FilesystemSupport{
+		AlpinePackage: a.alpinePackage,
+		MissingTools:  []string{},
+	}
+	support.CanMount = a.commandExists("mount.nfs")
+	if !support.CanMount {
+		support.MissingTools = append(support.MissingTools, "mount.nfs")
+	}
+	support.CanFormat = false   // A network export is formatted on its server
+	support.CanCheck = false    // A network export is checked on its server
+	support.CanSetLabel = false // A network export has no label
+
+	return support, nil
+}
+
+// Mount mounts the server:/export source with mount.nfs.
+func (a *NfsAdapter) Mount(
+	ctx context.Context,
+	source, target, fsType, data string,
+	flags uintptr,
+	prepareTarget func() error,
+) (*mount.MountPoint, errors.E) {
+	_ = fsType
+	return a.helperMount(ctx, "mount.nfs", source, target, data, flags, prepareTarget)
+}
+
+// Unmount unmounts an NFS export, detaching it when the server is gone.
+func (a *NfsAdapter) Unmount(ctx context.Context, target string, force, lazy bool) errors.E {
+	return a.networkUnmount(ctx, target, force, lazy)
+}
+
+// Format is not supported for network exports
+func (a *NfsAdapter) Format(ctx context.Context, device string, options dto.FormatOptions, progress dto.ProgressCallback) errors.E {
+	if progress != nil {
+		progress("failure", 0, []string{"A network export cannot be formatted"})
+	}
+	return errors.Errorf("a network export cannot be formatted")
+}
+
+// Check is not supported for network exports
+func (a *NfsAdapter) Check(ctx context.Context, device string, options dto.CheckOptions, progress dto.ProgressCallback) (dto.CheckResult, errors.E) {
+	if progress != nil {
+		progress("failure", 0, []string{"Check the filesystem on the server instead"})
+	}
+	result := dto.CheckResult{
+		Success:  false,
+		Message:  "Check the filesystem on the server instead",
+		ExitCode: 1,
+	}
+	return result, errors.Errorf("check the filesystem on the server instead")
+}
+
+// GetLabel is not supported for network exports
+func (a *NfsAdapter) GetLabel(ctx context.Context, device string) (string, errors.E) {
+	return "", errors.Errorf("network exports have no label")
+}
+
+// SetLabel is not supported for network exports
+func (a *NfsAdapter) SetLabel(ctx context.Context, device string, label string) errors.E {
+	return errors.Errorf("network exports have no label")
+}
+
+// GetState returns the state of a NFS export
+func (a *NfsAdapter) GetState(ctx context.Context, device string) (dto.FilesystemState, errors.E) {
+	state := dto.FilesystemState{
+		AdditionalInfo:   make(map[string]any),
+		IsClean:          true,
+		HasErrors:        false,
+		StateDescription: "NFS network export",
+	}
+	return state, nil
+}
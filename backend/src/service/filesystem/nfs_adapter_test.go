@@ -0,0 +1,87 @@
+package filesystem_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/stretchr/testify/suite"
+)
+
+type NfsAdapterTestSuite struct {
+	suite.Suite
+	adapter filesystem.FilesystemAdapter
+	clean   func()
+	ctx     context.Context
+}
+
+func TestNfsAdapterTestSuite(t *testing.T) {
+	suite.Run(t, new(NfsAdapterTestSuite))
+}
+
+func (suite *NfsAdapterTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.adapter = filesystem.NewNfsAdapter()
+	suite.Require().NotNil(suite.adapter)
+	suite.clean = suite.adapter.SetExecOpsForTesting(
+		func(cmd string) (string, error) {
+			if cmd == "mount.nfs" {
+				return cmd, nil
+			}
+			return "", errors.New("command not found")
+		})
+}
+
+func (suite *NfsAdapterTestSuite) TearDownTest() {
+	if suite.clean != nil {
+		suite.clean()
+	}
+}
+
+func (suite *NfsAdapterTestSuite) TestRegistryResolvesNfs4() {
+	adapter, err := filesystem.NewRegistry().Get("nfs4")
+	suite.Require().NoError(err)
+	suite.Equal("nfs", adapter.GetName())
+}
+
+func (suite *NfsAdapterTestSuite) TestIsSupported() {
+	support, err := suite.adapter.IsSupported(suite.ctx)
+	suite.NoError(err)
+	suite.True(support.CanMount)
+	suite.False(support.CanFormat)
+	suite.Equal("nfs-utils", support.AlpinePackage)
+	suite.Empty(support.MissingTools)
+}
+
+func (suite *NfsAdapterTestSuite) TestMountFlagsIncludeVersion() {
+	names := make([]string, 0)
+	for _, flag := range suite.adapter.GetMountFlags() {
+		names = append(names, flag.Name)
+	}
+	suite.Contains(names, "vers")
+	suite.Contains(names, "soft")
+}
+
+func (suite *NfsAdapterTestSuite) TestMountRunsHelper() {
+	binDir := suite.T().TempDir()
+	args := filepath.Join(suite.T().TempDir(), "args")
+	script := "#!/bin/sh\necho \"$*\" > \"" + args + "\"\n"
+	suite.Require().NoError(os.WriteFile(filepath.Join(binDir, "mount.nfs"), []byte(script), 0o755))
+	suite.T().Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	target := filepath.Join(suite.T().TempDir(), "backup")
+
+	mp, err := suite.adapter.Mount(suite.ctx, "nas:/export/backup", target, "nfs", "vers=4.2", syscall.MS_NOATIME, func() error {
+		return os.MkdirAll(target, 0o750)
+	})
+	suite.Require().NoError(err)
+	suite.Equal("nfs", mp.FSType)
+
+	data, errR := os.ReadFile(args)
+	suite.Require().NoError(errR)
+	suite.Equal("nas:/export/backup "+target+" -o noatime,vers=4.2", strings.TrimSpace(string(data)))
+}
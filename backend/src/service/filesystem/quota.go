@@ -0,0 +1,129 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/csv"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/dianlight/srat/dto"
+	"gitlab.com/tozd/go/errors"
+)
+
+// QuotaAdapter is an optional FilesystemAdapter capability for filesystems
+// with a native quota mechanism. Callers discover it with AsQuotaAdapter.
+//
+// path is always the root of a share. A limit of 0 removes the quota.
+// Per-user methods return dto.ErrorQuotaNotSupported when the filesystem can
+// only cap directory trees.
+type QuotaAdapter interface {
+	// SetDirQuota caps the space used by the directory tree rooted at path.
+	SetDirQuota(ctx context.Context, path string, limit uint64) errors.E
+
+	// GetDirQuota reports usage and limit of the directory tree rooted at path.
+	GetDirQuota(ctx context.Context, path string) (dto.QuotaUsage, errors.E)
+
+	// SetUserQuota caps the space username can use on the filesystem of path.
+	SetUserQuota(ctx context.Context, path, username string, limit uint64) errors.E
+
+	// GetUserQuota reports usage and limit of username on the filesystem of path.
+	GetUserQuota(ctx context.Context, path, username string) (dto.QuotaUsage, errors.E)
+}
+
+// QuotaTreeTagger is implemented by QuotaAdapters whose directory quota only
+// counts the entries tagged with the project of the share. SetDirQuota tags
+// the share root, whose new entries inherit the project; the entries already
+// in the tree are tagged by the returned command, which walks the whole tree
+// and is meant to run in the background.
+type QuotaTreeTagger interface {
+	DirQuotaTagCommand(path string) (string, []string)
+}
+
+// volumeDirQuota is implemented by QuotaAdapters whose directory quota is
+// the quota of the subvolume or dataset mounted at path.
+type volumeDirQuota interface {
+	dirQuotaCoversVolume()
+}
+
+// DirQuotaCoversVolume reports whether the directory quota of an adapter caps
+// the whole subvolume or dataset rather than a directory tree, so it can't be
+// set for a directory below the mount point.
+func DirQuotaCoversVolume(quota QuotaAdapter) bool {
+	_, ok := quota.(volumeDirQuota)
+	return ok
+}
+
+// AsQuotaAdapter returns the quota capability of an adapter, if any.
+func AsQuotaAdapter(adapter FilesystemAdapter) (QuotaAdapter, bool) {
+	quota, ok := adapter.(QuotaAdapter)
+	return quota, ok
+}
+
+// ProjectID derives a stable, non-zero project quota id from a share path so
+// xfs and ext4 project quotas survive restarts without extra bookkeeping.
+func ProjectID(path string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(path))
+	id := h.Sum32() & 0x7fffffff
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+// kib converts a byte limit to the 1KiB blocks used by quota tools, rounding up.
+func kib(limit uint64) uint64 {
+	return (limit + 1023) / 1024
+}
+
+// parseQuotaNumber parses a raw quota value. "none", "-" and empty mean 0.
+func parseQuotaNumber(value string) (uint64, errors.E) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "-" || value == "none" {
+		return 0, nil
+	}
+	// Quota tools flag exceeded limits with a trailing '*'.
+	n, err := strconv.ParseUint(strings.TrimSuffix(value, "*"), 10, 64)
+	if err != nil {
+		return 0, errors.WithDetails(err, "Value", value)
+	}
+	return n, nil
+}
+
+// parseRepquotaCSV extracts the block usage of one entry from
+// `repquota -O csv` output. Sizes are reported in 1KiB blocks.
+func parseRepquotaCSV(output, entry string) (dto.QuotaUsage, errors.E) {
+	records, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		return dto.QuotaUsage{}, errors.WithDetails(err, "Output", output)
+	}
+	if len(records) == 0 {
+		return dto.QuotaUsage{}, errors.Errorf("empty repquota output")
+	}
+	column := map[string]int{}
+	for i, name := range records[0] {
+		column[strings.TrimSpace(name)] = i
+	}
+	usedCol, okUsed := column["BlockUsed"]
+	hardCol, okHard := column["BlockHardLimit"]
+	if !okUsed || !okHard {
+		return dto.QuotaUsage{}, errors.Errorf("unexpected repquota header: %v", records[0])
+	}
+	for _, record := range records[1:] {
+		if len(record) <= max(usedCol, hardCol) || strings.TrimPrefix(strings.TrimSpace(record[0]), "#") != entry {
+			continue
+		}
+		used, errE := parseQuotaNumber(record[usedCol])
+		if errE != nil {
+			return dto.QuotaUsage{}, errE
+		}
+		limit, errE := parseQuotaNumber(record[hardCol])
+		if errE != nil {
+			return dto.QuotaUsage{}, errE
+		}
+		return dto.NewQuotaUsage(used*1024, limit*1024), nil
+	}
+	// Entries without usage nor limits are not listed.
+	return dto.NewQuotaUsage(0, 0), nil
+}
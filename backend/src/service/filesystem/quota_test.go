@@ -0,0 +1,156 @@
+package filesystem
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/stretchr/testify/suite"
+)
+
+type QuotaTestSuite struct {
+	suite.Suite
+	ctx context.Context
+}
+
+func TestQuotaTestSuite(t *testing.T) {
+	suite.Run(t, new(QuotaTestSuite))
+}
+
+func (suite *QuotaTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+}
+
+// recordingRunner answers every command with output and records the command lines.
+func recordingRunner(output string, commands *[]string) *fakeCommandRunner {
+	return &fakeCommandRunner{
+		execute: func(_ context.Context, _ string, _ string, command string, args ...string) (dto.CommandExecutionSnapshot, error) {
+			*commands = append(*commands, strings.Join(append([]string{command}, args...), " "))
+			return dto.CommandExecutionSnapshot{
+				Success: true,
+				Lines: []dto.CommandOutputLineSnapshot{{
+					Channel: dto.CommandOutputChannelStdout,
+					Line:    output,
+				}},
+			}, nil
+		},
+	}
+}
+
+func (suite *QuotaTestSuite) TestProjectID_StableAndNonZero() {
+	id := ProjectID("/mnt/data")
+	suite.NotZero(id)
+	suite.Equal(id, ProjectID("/mnt/data"))
+	suite.NotEqual(id, ProjectID("/mnt/other"))
+}
+
+func (suite *QuotaTestSuite) TestAdaptersWithNativeQuota() {
+	for _, adapter := range []FilesystemAdapter{NewBtrfsAdapter(), NewExt4Adapter(), NewXfsAdapter(), NewZfsAdapter()} {
+		_, ok := AsQuotaAdapter(adapter)
+		suite.True(ok, adapter.GetName())
+	}
+	_, ok := AsQuotaAdapter(NewVfatAdapter())
+	suite.False(ok)
+}
+
+func (suite *QuotaTestSuite) TestParseRepquotaCSV() {
+	output := "Name,Status,BlockUsed,BlockSoftLimit,BlockHardLimit,BlockGrace,FileUsed,FileSoftLimit,FileHardLimit,FileGrace\n" +
+		"#0,ok,20,0,0,,2,0,0,\n" +
+		"#1234,+-,1100*,0,1000,6days,3,0,0,\n"
+
+	usage, err := parseRepquotaCSV(output, "1234")
+	suite.Require().NoError(err)
+	suite.Equal(uint64(1100*1024), usage.UsedBytes)
+	suite.Equal(uint64(1000*1024), usage.LimitBytes)
+	suite.InDelta(110.0, usage.UsedPercent, 0.01)
+
+	usage, err = parseRepquotaCSV(output, "42")
+	suite.Require().NoError(err)
+	suite.Equal(dto.NewQuotaUsage(0, 0), usage)
+
+	_, err = parseRepquotaCSV("Name,Status\n", "42")
+	suite.Error(err)
+}
+
+func (suite *QuotaTestSuite) TestXfsQuotaUsage() {
+	usage, err := xfsQuotaUsage("/dev/sdb1 900 0 1000 00 [--------] /mnt/data\n")
+	suite.Require().NoError(err)
+	suite.Equal(uint64(900*1024), usage.UsedBytes)
+	suite.Equal(uint64(1000*1024), usage.LimitBytes)
+	suite.InDelta(90.0, usage.UsedPercent, 0.01)
+
+	usage, err = xfsQuotaUsage("")
+	suite.Require().NoError(err)
+	suite.Zero(usage.LimitBytes)
+}
+
+func (suite *QuotaTestSuite) TestBtrfsGetDirQuota() {
+	adapter := NewBtrfsAdapter().(*BtrfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(recordingRunner(
+		"Qgroupid    Referenced    Exclusive   Max referenced\n"+
+			"--------    ----------    ---------   --------------\n"+
+			"0/257            16384        16384       1073741824", &commands))
+	defer reset()
+
+	usage, err := adapter.GetDirQuota(suite.ctx, "/mnt/data")
+	suite.Require().NoError(err)
+	suite.Equal(uint64(16384), usage.UsedBytes)
+	suite.Equal(uint64(1073741824), usage.LimitBytes)
+	suite.Equal([]string{"btrfs qgroup show -rf --raw /mnt/data"}, commands)
+}
+
+func (suite *QuotaTestSuite) TestBtrfsUserQuotaNotSupported() {
+	adapter := NewBtrfsAdapter().(*BtrfsAdapter)
+	err := adapter.SetUserQuota(suite.ctx, "/mnt/data", "alice", 1024)
+	suite.ErrorIs(err, dto.ErrorQuotaNotSupported)
+}
+
+func (suite *QuotaTestSuite) TestZfsSetDirQuota_ZeroRemovesLimit() {
+	adapter := NewZfsAdapter().(*ZfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(recordingRunner("pool/data", &commands))
+	defer reset()
+
+	suite.Require().NoError(adapter.SetDirQuota(suite.ctx, "/mnt/data", 0))
+	suite.Equal([]string{
+		"zfs list -H -o name /mnt/data",
+		"zfs set quota=none pool/data",
+	}, commands)
+}
+
+func (suite *QuotaTestSuite) TestExt4SetDirQuota_UsesProjectID() {
+	adapter := NewExt4Adapter().(*Ext4Adapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(recordingRunner("", &commands))
+	defer reset()
+
+	suite.Require().NoError(adapter.SetDirQuota(suite.ctx, "/mnt/data", 1500))
+	id := ProjectID("/mnt/data")
+	suite.Require().Len(commands, 2)
+	suite.Equal("chattr -p "+strconv.FormatUint(uint64(id), 10)+" +P /mnt/data", commands[0])
+	suite.Equal("setquota -P "+strconv.FormatUint(uint64(id), 10)+" 0 2 0 0 /mnt/data", commands[1])
+
+	command, args := adapter.DirQuotaTagCommand("/mnt/data")
+	suite.Equal("chattr", command)
+	suite.Equal([]string{"-R", "-p", strconv.FormatUint(uint64(id), 10), "+P", "/mnt/data"}, args)
+}
+
+func (suite *QuotaTestSuite) TestXfsSetDirQuota_QuotesPath() {
+	adapter := NewXfsAdapter().(*XfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(recordingRunner("", &commands))
+	defer reset()
+
+	suite.Require().NoError(adapter.SetDirQuota(suite.ctx, "/mnt/my data", 1500))
+	id := strconv.FormatUint(uint64(ProjectID("/mnt/my data")), 10)
+	suite.Require().Len(commands, 2)
+	suite.Equal(`xfs_quota -x -c project -s -d 0 -p "/mnt/my data" `+id+` /mnt/my data`, commands[0])
+
+	_, args := adapter.DirQuotaTagCommand("/mnt/my data")
+	suite.Equal(`project -s -p "/mnt/my data" `+id, args[2])
+
+	suite.ErrorIs(adapter.SetDirQuota(suite.ctx, `/mnt/say "hi"`, 1500), dto.ErrorInvalidParameter)
+}
@@ -34,6 +34,11 @@ func NewRegistry() *Registry {
 	registry.Register(NewReiserfsAdapter())
 	registry.Register(NewZfsAdapter())
 	registry.Register(NewApfsAdapter())
+	registry.Register(NewLuksAdapter())
+	registry.Register(NewLvmAdapter())
+	registry.Register(NewMergerfsAdapter())
+	registry.Register(NewCifsAdapter())
+	registry.Register(NewNfsAdapter())
 
 	return registry
 }
@@ -0,0 +1,23 @@
+package filesystem
+
+import (
+	"context"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// ScrubAdapter is an optional FilesystemAdapter capability for filesystems
+// that checksum their data and can verify it online. Callers discover it with
+// AsScrubAdapter.
+type ScrubAdapter interface {
+	// Scrub reads back all the data of the volume mounted at path, repairing
+	// what redundancy allows. It blocks until the scrub is over and returns
+	// the tool summary.
+	Scrub(ctx context.Context, path string) (string, errors.E)
+}
+
+// AsScrubAdapter returns the scrub capability of an adapter, if any.
+func AsScrubAdapter(adapter FilesystemAdapter) (ScrubAdapter, bool) {
+	scrub, ok := adapter.(ScrubAdapter)
+	return scrub, ok
+}
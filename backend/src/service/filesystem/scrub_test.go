@@ -0,0 +1,53 @@
+package filesystem
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ScrubTestSuite struct {
+	suite.Suite
+	ctx context.Context
+}
+
+func TestScrubTestSuite(t *testing.T) {
+	suite.Run(t, new(ScrubTestSuite))
+}
+
+func (suite *ScrubTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+}
+
+func (suite *ScrubTestSuite) TestAdaptersWithScrub() {
+	for _, adapter := range []FilesystemAdapter{NewBtrfsAdapter(), NewZfsAdapter()} {
+		_, ok := AsScrubAdapter(adapter)
+		suite.True(ok, adapter.GetName())
+	}
+	_, ok := AsScrubAdapter(NewExt4Adapter())
+	suite.False(ok)
+}
+
+func (suite *ScrubTestSuite) TestBtrfsScrub() {
+	adapter := NewBtrfsAdapter().(*BtrfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(recordingRunner("Error summary:    no errors found", &commands))
+	defer reset()
+
+	output, err := adapter.Scrub(suite.ctx, "/mnt/data")
+	suite.Require().NoError(err)
+	suite.Contains(output, "no errors found")
+	suite.Equal([]string{"btrfs scrub start -B /mnt/data"}, commands)
+}
+
+func (suite *ScrubTestSuite) TestZfsScrubUsesPool() {
+	adapter := NewZfsAdapter().(*ZfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(recordingRunner("tank/media/data", &commands))
+	defer reset()
+
+	_, err := adapter.Scrub(suite.ctx, "/mnt/data")
+	suite.Require().NoError(err)
+	suite.Equal([]string{"zfs list -H -o name /mnt/data", "zpool scrub -w tank"}, commands)
+}
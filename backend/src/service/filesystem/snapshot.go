@@ -0,0 +1,85 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/dianlight/srat/dto"
+	"gitlab.com/tozd/go/errors"
+)
+
+// SnapshotAdapter is an optional FilesystemAdapter capability for filesystems
+// with native copy-on-write snapshots. Callers discover it with
+// AsSnapshotAdapter.
+//
+// path is always the root of a share, which is the mount point of its volume.
+// Snapshot names follow dto.SnapshotTimeLayout.
+type SnapshotAdapter interface {
+	// SnapshotDir is where snapshots are browsable, relative to path. It is
+	// rendered as the vfs_shadow_copy2 shadow:snapdir.
+	SnapshotDir() string
+
+	// CreateSnapshot takes a read-only snapshot of path.
+	CreateSnapshot(ctx context.Context, path, name string) errors.E
+
+	// ListSnapshots returns the snapshots of path, newest first.
+	ListSnapshots(ctx context.Context, path string) ([]dto.Snapshot, errors.E)
+
+	// DeleteSnapshot removes a snapshot of path.
+	DeleteSnapshot(ctx context.Context, path, name string) errors.E
+
+	// RollbackSnapshot restores path to the content of a snapshot. It fails
+	// with dto.ErrorConflict when the rollback would destroy newer snapshots,
+	// unless destroyNewer is set.
+	RollbackSnapshot(ctx context.Context, path, name string, destroyNewer bool) errors.E
+}
+
+// AsSnapshotAdapter returns the snapshot capability of an adapter, if any.
+func AsSnapshotAdapter(adapter FilesystemAdapter) (SnapshotAdapter, bool) {
+	snapshot, ok := adapter.(SnapshotAdapter)
+	return snapshot, ok
+}
+
+// checkSnapshotName rejects names that are not snapshot timestamps, so a
+// name can never escape the snapshot directory.
+func checkSnapshotName(name string) errors.E {
+	if _, ok := dto.ParseSnapshotName(name); !ok {
+		return errors.WithDetails(dto.ErrorSnapshotNotFound, "Name", name)
+	}
+	return nil
+}
+
+// sortSnapshots orders snapshots newest first.
+func sortSnapshots(snapshots []dto.Snapshot) {
+	slices.SortFunc(snapshots, func(a, b dto.Snapshot) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+}
+
+// snapshotsInDir lists the snapshots stored as entries of dir. A missing dir
+// means no snapshot was taken yet.
+func snapshotsInDir(dir string) ([]dto.Snapshot, errors.E) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []dto.Snapshot{}, nil
+		}
+		return nil, errors.WithDetails(err, "Dir", dir)
+	}
+	snapshots := make([]dto.Snapshot, 0, len(entries))
+	for _, entry := range entries {
+		created, ok := dto.ParseSnapshotName(entry.Name())
+		if !ok || !entry.IsDir() {
+			continue
+		}
+		snapshots = append(snapshots, dto.Snapshot{
+			Name:      entry.Name(),
+			CreatedAt: created,
+			Path:      filepath.Join(dir, entry.Name()),
+		})
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
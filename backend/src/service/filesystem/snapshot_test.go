@@ -0,0 +1,233 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+)
+
+type SnapshotTestSuite struct {
+	suite.Suite
+	ctx context.Context
+}
+
+func TestSnapshotTestSuite(t *testing.T) {
+	suite.Run(t, new(SnapshotTestSuite))
+}
+
+func (suite *SnapshotTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+}
+
+func (suite *SnapshotTestSuite) TestAdaptersWithSnapshots() {
+	for _, adapter := range []FilesystemAdapter{NewBtrfsAdapter(), NewZfsAdapter()} {
+		_, ok := AsSnapshotAdapter(adapter)
+		suite.True(ok, adapter.GetName())
+	}
+	_, ok := AsSnapshotAdapter(NewExt4Adapter())
+	suite.False(ok)
+}
+
+func (suite *SnapshotTestSuite) TestSnapshotsInDir_NewestFirst() {
+	root := suite.T().TempDir()
+	dir := filepath.Join(root, btrfsSnapshotDir)
+	for _, name := range []string{"GMT-2026.01.01-10.00.00", "GMT-2026.01.02-10.00.00", "not-a-snapshot"} {
+		suite.Require().NoError(os.MkdirAll(filepath.Join(dir, name), 0o755))
+	}
+
+	snapshots, err := NewBtrfsAdapter().(*BtrfsAdapter).ListSnapshots(suite.ctx, root)
+	suite.Require().NoError(err)
+	suite.Require().Len(snapshots, 2)
+	suite.Equal("GMT-2026.01.02-10.00.00", snapshots[0].Name)
+	suite.Equal(filepath.Join(dir, "GMT-2026.01.02-10.00.00"), snapshots[0].Path)
+	suite.Equal("GMT-2026.01.01-10.00.00", snapshots[1].Name)
+}
+
+func (suite *SnapshotTestSuite) TestSnapshotsInDir_Missing() {
+	snapshots, err := snapshotsInDir(filepath.Join(suite.T().TempDir(), "missing"))
+	suite.Require().NoError(err)
+	suite.Empty(snapshots)
+}
+
+func (suite *SnapshotTestSuite) TestBtrfsCreateSnapshot() {
+	root := suite.T().TempDir()
+	adapter := NewBtrfsAdapter().(*BtrfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(recordingRunner("", &commands))
+	defer reset()
+
+	suite.Require().NoError(adapter.CreateSnapshot(suite.ctx, root, "GMT-2026.01.01-10.00.00"))
+	suite.DirExists(filepath.Join(root, btrfsSnapshotDir))
+	suite.Equal([]string{
+		"btrfs subvolume snapshot -r " + root + " " + filepath.Join(root, btrfsSnapshotDir, "GMT-2026.01.01-10.00.00"),
+	}, commands)
+}
+
+func (suite *SnapshotTestSuite) TestInvalidNameRejected() {
+	adapter := NewBtrfsAdapter().(*BtrfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(recordingRunner("", &commands))
+	defer reset()
+
+	err := adapter.DeleteSnapshot(suite.ctx, "/mnt/data", "../../etc")
+	suite.ErrorIs(err, dto.ErrorSnapshotNotFound)
+	suite.Empty(commands)
+}
+
+func (suite *SnapshotTestSuite) TestZfsListSnapshots() {
+	adapter := NewZfsAdapter().(*ZfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(&fakeCommandRunner{
+		execute: func(_ context.Context, _ string, _ string, command string, args ...string) (dto.CommandExecutionSnapshot, error) {
+			commands = append(commands, command+" "+args[0])
+			line := "pool/data"
+			if len(commands) == 2 {
+				line = "pool/data@GMT-2026.01.01-10.00.00\npool/data@manual\npool/data@GMT-2026.01.03-10.00.00"
+			}
+			return dto.CommandExecutionSnapshot{
+				Success: true,
+				Lines:   []dto.CommandOutputLineSnapshot{{Channel: dto.CommandOutputChannelStdout, Line: line}},
+			}, nil
+		},
+	})
+	defer reset()
+
+	snapshots, err := adapter.ListSnapshots(suite.ctx, "/mnt/data")
+	suite.Require().NoError(err)
+	suite.Require().Len(snapshots, 2)
+	suite.Equal("GMT-2026.01.03-10.00.00", snapshots[0].Name)
+	suite.Equal("/mnt/data/.zfs/snapshot/GMT-2026.01.03-10.00.00", snapshots[0].Path)
+	suite.Equal([]string{"zfs list", "zfs list"}, commands)
+}
+
+// rollbackRunner emulates btrfs snapshots with directories and runs the shell
+// scripts for real, failing them when failScripts is set.
+func rollbackRunner(commands *[]string, failScripts bool) *fakeCommandRunner {
+	return &fakeCommandRunner{
+		execute: func(_ context.Context, _ string, _ string, command string, args ...string) (dto.CommandExecutionSnapshot, error) {
+			*commands = append(*commands, command+" "+args[0])
+			switch {
+			case command == "btrfs":
+				if err := os.MkdirAll(args[len(args)-1], 0o755); err != nil {
+					return dto.CommandExecutionSnapshot{}, err
+				}
+			case failScripts:
+				return dto.CommandExecutionSnapshot{Success: false, ExitCode: 1}, nil
+			default:
+				output, err := exec.Command(command, args...).CombinedOutput()
+				if err != nil {
+					return dto.CommandExecutionSnapshot{Success: false, ExitCode: 1, Lines: []dto.CommandOutputLineSnapshot{{Line: string(output)}}}, nil
+				}
+			}
+			return dto.CommandExecutionSnapshot{Success: true}, nil
+		},
+	}
+}
+
+func (suite *SnapshotTestSuite) btrfsVolume() (string, string) {
+	root := suite.T().TempDir()
+	snapshot := filepath.Join(root, btrfsSnapshotDir, "GMT-2026.01.01-10.00.00")
+	suite.Require().NoError(os.MkdirAll(filepath.Join(snapshot, "docs"), 0o755))
+	suite.Require().NoError(os.WriteFile(filepath.Join(snapshot, "docs", "a.txt"), []byte("old"), 0o644))
+	suite.Require().NoError(os.WriteFile(filepath.Join(snapshot, ".hidden"), []byte("old"), 0o644))
+	suite.Require().NoError(os.MkdirAll(filepath.Join(root, "docs"), 0o755))
+	suite.Require().NoError(os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("new"), 0o644))
+	suite.Require().NoError(os.WriteFile(filepath.Join(root, "added.txt"), []byte("new"), 0o644))
+	return root, "GMT-2026.01.01-10.00.00"
+}
+
+func (suite *SnapshotTestSuite) TestBtrfsRollback_SwapsRestoredCopy() {
+	root, name := suite.btrfsVolume()
+	adapter := NewBtrfsAdapter().(*BtrfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(rollbackRunner(&commands, false))
+	defer reset()
+
+	suite.Require().NoError(adapter.RollbackSnapshot(suite.ctx, root, name, false))
+
+	suite.Equal([]string{"btrfs subvolume", "sh -c"}, commands, "safety snapshot first")
+	content, err := os.ReadFile(filepath.Join(root, "docs", "a.txt"))
+	suite.Require().NoError(err)
+	suite.Equal("old", string(content))
+	suite.FileExists(filepath.Join(root, ".hidden"))
+	suite.NoFileExists(filepath.Join(root, "added.txt"))
+	snapshots, errE := adapter.ListSnapshots(suite.ctx, root)
+	suite.Require().NoError(errE)
+	suite.Len(snapshots, 2, "the safety snapshot is kept")
+	entries, err := os.ReadDir(filepath.Join(root, btrfsSnapshotDir))
+	suite.Require().NoError(err)
+	for _, entry := range entries {
+		suite.False(strings.HasPrefix(entry.Name(), ".rollback"), entry.Name())
+	}
+}
+
+func (suite *SnapshotTestSuite) TestBtrfsRollback_FailedRestoreKeepsLiveData() {
+	root, name := suite.btrfsVolume()
+	adapter := NewBtrfsAdapter().(*BtrfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(rollbackRunner(&commands, true))
+	defer reset()
+
+	suite.Require().Error(adapter.RollbackSnapshot(suite.ctx, root, name, false))
+
+	content, err := os.ReadFile(filepath.Join(root, "docs", "a.txt"))
+	suite.Require().NoError(err)
+	suite.Equal("new", string(content))
+	suite.FileExists(filepath.Join(root, "added.txt"))
+	suite.NoDirExists(filepath.Join(root, btrfsSnapshotDir, btrfsRollbackRestored))
+}
+
+func (suite *SnapshotTestSuite) TestSwapEntries_UndoOnFailure() {
+	root := suite.T().TempDir()
+	staging := filepath.Join(root, btrfsSnapshotDir, btrfsRollbackRestored)
+	previous := filepath.Join(root, btrfsSnapshotDir, btrfsRollbackPrevious)
+	suite.Require().NoError(os.MkdirAll(staging, 0o755))
+	suite.Require().NoError(os.WriteFile(filepath.Join(root, "live.txt"), []byte("live"), 0o644))
+	suite.Require().NoError(os.WriteFile(filepath.Join(staging, "a.txt"), []byte("old"), 0o644))
+	// A restored file cannot replace the skipped, non-empty directory, failing
+	// the swap after a.txt was placed.
+	suite.Require().NoError(os.WriteFile(filepath.Join(staging, "z"), nil, 0o644))
+	suite.Require().NoError(os.MkdirAll(filepath.Join(root, "z", "busy"), 0o755))
+
+	suite.Require().Error(swapEntries(root, staging, previous, "z"))
+	suite.FileExists(filepath.Join(root, "live.txt"))
+	suite.NoFileExists(filepath.Join(root, "a.txt"))
+	suite.FileExists(filepath.Join(staging, "a.txt"))
+}
+
+func (suite *SnapshotTestSuite) TestZfsRollback_RefusesToDestroyNewer() {
+	adapter := NewZfsAdapter().(*ZfsAdapter)
+	var commands []string
+	reset := adapter.SetCommandRunner(&fakeCommandRunner{
+		execute: func(_ context.Context, _ string, _ string, command string, args ...string) (dto.CommandExecutionSnapshot, error) {
+			commands = append(commands, command+" "+strings.Join(args, " "))
+			line := "pool/data"
+			if args[0] == "list" && args[2] == "-t" {
+				line = "pool/data@GMT-2026.01.01-10.00.00\npool/data@GMT-2026.01.02-10.00.00\npool/data@manual"
+			}
+			return dto.CommandExecutionSnapshot{
+				Success: true,
+				Lines:   []dto.CommandOutputLineSnapshot{{Channel: dto.CommandOutputChannelStdout, Line: line}},
+			}, nil
+		},
+	})
+	defer reset()
+
+	err := adapter.RollbackSnapshot(suite.ctx, "/mnt/data", "GMT-2026.01.01-10.00.00", false)
+	suite.Require().ErrorIs(err, dto.ErrorConflict)
+	suite.NotContains(strings.Join(commands, "\n"), "zfs rollback")
+
+	suite.Require().NoError(adapter.RollbackSnapshot(suite.ctx, "/mnt/data", "GMT-2026.01.02-10.00.00", true))
+	suite.Equal("zfs rollback -r pool/data@GMT-2026.01.02-10.00.00", commands[len(commands)-1])
+
+	err = adapter.RollbackSnapshot(suite.ctx, "/mnt/data", "GMT-2026.01.02-10.00.00", false)
+	suite.Require().ErrorIs(err, dto.ErrorConflict, "snapshots not taken by SRAT are destroyed as well")
+	suite.Equal([]string{"manual"}, errors.AllDetails(err)["Newer"])
+}
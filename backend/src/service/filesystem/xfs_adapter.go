@@ -2,6 +2,7 @@ package filesystem
 
 import (
 	"context"
+	"strconv"
 	"strings"
 
 	"github.com/dianlight/srat/dto"
@@ -272,3 +273,89 @@ func (a *XfsAdapter) GetState(ctx context.Context, device string) (dto.Filesyste
 
 	return state, nil
 }
+
+// xfsQuotaUsage parses `xfs_quota -c "quota -N -b ..."` output.
+// Format: <device> <blocks> <soft> <hard> <warn/grace> [...] <mountpoint>
+// with sizes in 1KiB blocks.
+func xfsQuotaUsage(output string) (dto.QuotaUsage, errors.E) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		used, err := parseQuotaNumber(fields[1])
+		if err != nil {
+			return dto.QuotaUsage{}, err
+		}
+		limit, err := parseQuotaNumber(fields[3])
+		if err != nil {
+			return dto.QuotaUsage{}, err
+		}
+		return dto.NewQuotaUsage(used*1024, limit*1024), nil
+	}
+	// No output means no usage and no limit for the id.
+	return dto.NewQuotaUsage(0, 0), nil
+}
+
+// xfsQuotedPath quotes path for an xfs_quota command line, which splits its
+// arguments on spaces but keeps quoted strings whole. It has no escapes, so
+// paths with a double quote are refused.
+func xfsQuotedPath(path string) (string, errors.E) {
+	if strings.Contains(path, `"`) {
+		return "", errors.WithDetails(dto.ErrorInvalidParameter, "Path", path, "reason", "xfs_quota cannot handle paths with a double quote")
+	}
+	return `"` + path + `"`, nil
+}
+
+// SetDirQuota binds path to a project (see ProjectID), inherited by new
+// entries, and sets its hard block limit. The filesystem must be mounted with
+// the prjquota option.
+func (a *XfsAdapter) SetDirQuota(ctx context.Context, path string, limit uint64) errors.E {
+	id := strconv.FormatUint(uint64(ProjectID(path)), 10)
+	quoted, errE := xfsQuotedPath(path)
+	if errE != nil {
+		return errE
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "xfs_quota", "-x", "-c", "project -s -d 0 -p "+quoted+" "+id, path); err != nil {
+		return errors.WithDetails(err, "Path", path)
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "xfs_quota", "-x", "-c", "limit -p bhard="+strconv.FormatUint(kib(limit), 10)+"k "+id, path); err != nil {
+		return errors.WithDetails(err, "Path", path)
+	}
+	return nil
+}
+
+// DirQuotaTagCommand binds every entry under path to its project. The path
+// was checked by SetDirQuota, which runs first.
+func (a *XfsAdapter) DirQuotaTagCommand(path string) (string, []string) {
+	quoted, _ := xfsQuotedPath(path)
+	return "xfs_quota", []string{"-x", "-c", "project -s -p " + quoted + " " + strconv.FormatUint(uint64(ProjectID(path)), 10), path}
+}
+
+// GetDirQuota reports the block usage of the project bound to path.
+func (a *XfsAdapter) GetDirQuota(ctx context.Context, path string) (dto.QuotaUsage, errors.E) {
+	id := strconv.FormatUint(uint64(ProjectID(path)), 10)
+	output, err := a.runCheckedCommand(ctx, true, "xfs_quota", "-x", "-c", "quota -p -N -b "+id, path)
+	if err != nil {
+		return dto.QuotaUsage{}, errors.WithDetails(err, "Path", path)
+	}
+	return xfsQuotaUsage(output)
+}
+
+// SetUserQuota sets the hard block limit of username. The filesystem must be
+// mounted with the uquota option.
+func (a *XfsAdapter) SetUserQuota(ctx context.Context, path, username string, limit uint64) errors.E {
+	if _, err := a.runCheckedCommand(ctx, false, "xfs_quota", "-x", "-c", "limit -u bhard="+strconv.FormatUint(kib(limit), 10)+"k "+username, path); err != nil {
+		return errors.WithDetails(err, "Path", path, "User", username)
+	}
+	return nil
+}
+
+// GetUserQuota reports the block usage of username.
+func (a *XfsAdapter) GetUserQuota(ctx context.Context, path, username string) (dto.QuotaUsage, errors.E) {
+	output, err := a.runCheckedCommand(ctx, true, "xfs_quota", "-x", "-c", "quota -u -N -b "+username, path)
+	if err != nil {
+		return dto.QuotaUsage{}, errors.WithDetails(err, "Path", path, "User", username)
+	}
+	return xfsQuotaUsage(output)
+}
@@ -2,6 +2,9 @@ package filesystem
 
 import (
 	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/dianlight/srat/dto"
 	"gitlab.com/tozd/go/errors"
@@ -132,3 +135,207 @@ func (a *ZfsAdapter) GetState(ctx context.Context, device string) (dto.Filesyste
 
 	return state, nil
 }
+
+// zfsDataset resolves the dataset mounted at path.
+func (a *ZfsAdapter) zfsDataset(ctx context.Context, path string) (string, errors.E) {
+	output, err := a.runCheckedCommand(ctx, true, "zfs", "list", "-H", "-o", "name", path)
+	if err != nil {
+		return "", errors.WithDetails(err, "Path", path)
+	}
+	dataset := strings.TrimSpace(output)
+	if dataset == "" {
+		return "", errors.Errorf("no zfs dataset mounted at %s", path)
+	}
+	return dataset, nil
+}
+
+// zfsSetProperty sets a quota property; a zero limit resets it to none.
+func (a *ZfsAdapter) zfsSetProperty(ctx context.Context, path, property string, limit uint64) errors.E {
+	dataset, err := a.zfsDataset(ctx, path)
+	if err != nil {
+		return err
+	}
+	value := "none"
+	if limit > 0 {
+		value = strconv.FormatUint(limit, 10)
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "zfs", "set", property+"="+value, dataset); err != nil {
+		return errors.WithDetails(err, "Dataset", dataset)
+	}
+	return nil
+}
+
+// zfsGetUsage reads a used/limit property pair in bytes.
+func (a *ZfsAdapter) zfsGetUsage(ctx context.Context, path, usedProperty, limitProperty string) (dto.QuotaUsage, errors.E) {
+	dataset, err := a.zfsDataset(ctx, path)
+	if err != nil {
+		return dto.QuotaUsage{}, err
+	}
+	output, err := a.runCheckedCommand(ctx, true, "zfs", "get", "-Hp", "-o", "value", usedProperty+","+limitProperty, dataset)
+	if err != nil {
+		return dto.QuotaUsage{}, errors.WithDetails(err, "Dataset", dataset)
+	}
+	values := strings.Fields(output)
+	if len(values) != 2 {
+		return dto.QuotaUsage{}, errors.Errorf("unexpected zfs get output for %s: %s", dataset, output)
+	}
+	used, err := parseQuotaNumber(values[0])
+	if err != nil {
+		return dto.QuotaUsage{}, err
+	}
+	limit, err := parseQuotaNumber(values[1])
+	if err != nil {
+		return dto.QuotaUsage{}, err
+	}
+	return dto.NewQuotaUsage(used, limit), nil
+}
+
+// SetDirQuota sets the quota property of the dataset mounted at path.
+func (a *ZfsAdapter) SetDirQuota(ctx context.Context, path string, limit uint64) errors.E {
+	return a.zfsSetProperty(ctx, path, "quota", limit)
+}
+
+// GetDirQuota reports used and quota of the dataset mounted at path.
+func (a *ZfsAdapter) GetDirQuota(ctx context.Context, path string) (dto.QuotaUsage, errors.E) {
+	return a.zfsGetUsage(ctx, path, "used", "quota")
+}
+
+// dirQuotaCoversVolume marks zfs: the quota property belongs to a dataset.
+func (a *ZfsAdapter) dirQuotaCoversVolume() {}
+
+// SetUserQuota sets the userquota@username property of the dataset.
+func (a *ZfsAdapter) SetUserQuota(ctx context.Context, path, username string, limit uint64) errors.E {
+	return a.zfsSetProperty(ctx, path, "userquota@"+username, limit)
+}
+
+// GetUserQuota reports userused@username and userquota@username of the dataset.
+func (a *ZfsAdapter) GetUserQuota(ctx context.Context, path, username string) (dto.QuotaUsage, errors.E) {
+	return a.zfsGetUsage(ctx, path, "userused@"+username, "userquota@"+username)
+}
+
+// zfsSnapshotDir is the hidden directory where zfs exposes the snapshots of
+// a dataset.
+const zfsSnapshotDir = ".zfs/snapshot"
+
+// SnapshotDir returns the zfs snapshot control directory.
+func (a *ZfsAdapter) SnapshotDir() string {
+	return zfsSnapshotDir
+}
+
+// CreateSnapshot takes dataset@name of the dataset mounted at path.
+func (a *ZfsAdapter) CreateSnapshot(ctx context.Context, path, name string) errors.E {
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+	dataset, err := a.zfsDataset(ctx, path)
+	if err != nil {
+		return err
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "zfs", "snapshot", dataset+"@"+name); err != nil {
+		return errors.WithDetails(err, "Dataset", dataset)
+	}
+	return nil
+}
+
+// ListSnapshots lists the snapshots of the dataset mounted at path. Snapshots
+// not named after dto.SnapshotTimeLayout are ignored.
+func (a *ZfsAdapter) ListSnapshots(ctx context.Context, path string) ([]dto.Snapshot, errors.E) {
+	dataset, err := a.zfsDataset(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	output, err := a.runCheckedCommand(ctx, true, "zfs", "list", "-H", "-t", "snapshot", "-o", "name", "-d", "1", dataset)
+	if err != nil {
+		return nil, errors.WithDetails(err, "Dataset", dataset)
+	}
+	snapshots := []dto.Snapshot{}
+	for _, line := range strings.Split(output, "\n") {
+		_, name, found := strings.Cut(strings.TrimSpace(line), "@")
+		if !found {
+			continue
+		}
+		created, ok := dto.ParseSnapshotName(name)
+		if !ok {
+			continue
+		}
+		snapshots = append(snapshots, dto.Snapshot{
+			Name:      name,
+			CreatedAt: created,
+			Path:      filepath.Join(path, zfsSnapshotDir, name),
+		})
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+// DeleteSnapshot destroys dataset@name.
+func (a *ZfsAdapter) DeleteSnapshot(ctx context.Context, path, name string) errors.E {
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+	dataset, err := a.zfsDataset(ctx, path)
+	if err != nil {
+		return err
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "zfs", "destroy", dataset+"@"+name); err != nil {
+		return errors.WithDetails(err, "Dataset", dataset)
+	}
+	return nil
+}
+
+// RollbackSnapshot rolls the dataset back to dataset@name. zfs can only roll
+// back to the most recent snapshot, so when newer ones exist the rollback is
+// refused unless destroyNewer asks to destroy them.
+func (a *ZfsAdapter) RollbackSnapshot(ctx context.Context, path, name string, destroyNewer bool) errors.E {
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+	dataset, err := a.zfsDataset(ctx, path)
+	if err != nil {
+		return err
+	}
+	args := []string{"rollback", dataset + "@" + name}
+	if destroyNewer {
+		args = []string{"rollback", "-r", dataset + "@" + name}
+	} else {
+		output, err := a.runCheckedCommand(ctx, true, "zfs", "list", "-H", "-t", "snapshot", "-o", "name", "-s", "createtxg", "-d", "1", dataset)
+		if err != nil {
+			return errors.WithDetails(err, "Dataset", dataset)
+		}
+		newer := []string{}
+		found := false
+		for _, line := range strings.Split(output, "\n") {
+			_, snapshot, ok := strings.Cut(strings.TrimSpace(line), "@")
+			switch {
+			case !ok:
+			case found:
+				newer = append(newer, snapshot)
+			case snapshot == name:
+				found = true
+			}
+		}
+		if len(newer) > 0 {
+			return errors.WithDetails(dto.ErrorConflict, "Dataset", dataset, "Newer", newer,
+				"reason", "newer snapshots exist and would be destroyed by the rollback")
+		}
+	}
+	if _, err := a.runCheckedCommand(ctx, false, "zfs", args...); err != nil {
+		return errors.WithDetails(err, "Dataset", dataset)
+	}
+	return nil
+}
+
+// Scrub scrubs the pool holding the dataset mounted at path and waits for it
+// to finish.
+func (a *ZfsAdapter) Scrub(ctx context.Context, path string) (string, errors.E) {
+	dataset, err := a.zfsDataset(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	pool, _, _ := strings.Cut(dataset, "/")
+	output, err := a.runCheckedCommand(ctx, false, "zpool", "scrub", "-w", pool)
+	if err != nil {
+		return output, errors.WithDetails(err, "Pool", pool)
+	}
+	return output, nil
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/dianlight/srat/converter"
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/unixsamba"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+type GroupServiceInterface interface {
+	ListGroups() ([]dto.Group, error)
+	GetGroup(name string) (*dto.Group, error)
+	CreateGroup(group dto.Group) (*dto.Group, error)
+	UpdateGroup(currentName string, group dto.Group) (*dto.Group, error)
+	DeleteGroup(name string) error
+}
+
+type GroupService struct {
+	db       *gorm.DB
+	ctx      context.Context
+	eventBus events.EventBusInterface
+}
+
+type GroupServiceParams struct {
+	fx.In
+	Db       *gorm.DB
+	Ctx      context.Context
+	EventBus events.EventBusInterface
+}
+
+func NewGroupService(lc fx.Lifecycle, params GroupServiceParams) GroupServiceInterface {
+	gs := &GroupService{
+		ctx:      params.Ctx,
+		db:       params.Db,
+		eventBus: params.EventBus,
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if os.Getenv("SRAT_MOCK") == "true" {
+				return nil
+			}
+			tlog.TraceContext(ctx, "******* Autocreating groups ********")
+			groups, err := gorm.G[dbom.SambaGroup](gs.db).Preload(g.SambaGroup.Members.Name(), nil).Find(gs.ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "Cant load groups", "err", err)
+				return nil
+			}
+			for _, group := range groups {
+				if err := gs.syncUnixGroup(ctx, group); err != nil {
+					slog.ErrorContext(ctx, "Error autocreating group", "name", group.Name, "err", err)
+				}
+			}
+			slog.DebugContext(ctx, "******* Autocreating groups done! ********")
+			return nil
+		},
+	})
+	return gs
+}
+
+// syncUnixGroup makes sure the unix group exists with the stored members.
+func (s *GroupService) syncUnixGroup(ctx context.Context, group dbom.SambaGroup) errors.E {
+	if err := unixsamba.CreateUnixGroup(ctx, group.Name); err != nil {
+		return err
+	}
+	members := make([]string, 0, len(group.Members))
+	for _, member := range group.Members {
+		members = append(members, member.Username)
+	}
+	return unixsamba.SetUnixGroupMembers(ctx, group.Name, members)
+}
+
+func (s *GroupService) loadGroup(db *gorm.DB, name string) (dbom.SambaGroup, error) {
+	return gorm.G[dbom.SambaGroup](db).
+		Preload(g.SambaGroup.Members.Name(), nil).
+		Preload(g.SambaGroup.RwShares.Name(), nil).
+		Preload(g.SambaGroup.RoShares.Name(), nil).
+		Where(g.SambaGroup.Name.Eq(name)).First(s.ctx)
+}
+
+// checkMembers verifies that every member is a known user.
+func (s *GroupService) checkMembers(db *gorm.DB, members []string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	names := slices.Clone(members)
+	slices.Sort(names)
+	names = slices.Compact(names)
+	count, err := gorm.G[dbom.SambaUser](db).Where(g.SambaUser.Username.In(names...)).Count(s.ctx, "*")
+	if err != nil {
+		return errors.Wrap(err, "failed to check group members")
+	}
+	if int(count) != len(names) {
+		return errors.WithDetails(dto.ErrorUserNotFound, "members", names)
+	}
+	return nil
+}
+
+func (s *GroupService) ListGroups() ([]dto.Group, error) {
+	dbgroups, err := gorm.G[dbom.SambaGroup](s.db).
+		Preload(g.SambaGroup.Members.Name(), nil).
+		Preload(g.SambaGroup.RwShares.Name(), nil).
+		Preload(g.SambaGroup.RoShares.Name(), nil).
+		Find(s.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list groups from repository")
+	}
+	var conv converter.DtoToDbomConverterImpl
+	groups, err := conv.SambaGroupsToGroups(dbgroups)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert db groups to dto")
+	}
+	return groups, nil
+}
+
+func (s *GroupService) GetGroup(name string) (*dto.Group, error) {
+	dbGroup, err := s.loadGroup(s.db, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, dto.ErrorGroupNotFound
+		}
+		return nil, errors.Wrapf(err, "failed to get group %s from repository", name)
+	}
+	var conv converter.DtoToDbomConverterImpl
+	group, err := conv.SambaGroupToGroup(dbGroup)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert db group to dto")
+	}
+	return &group, nil
+}
+
+func (s *GroupService) CreateGroup(groupDto dto.Group) (*dto.Group, error) {
+	var dbGroup dbom.SambaGroup
+	var conv converter.DtoToDbomConverterImpl
+	if err := conv.GroupToSambaGroup(groupDto, &dbGroup); err != nil {
+		return nil, errors.Wrap(err, "failed to convert group DTO to DBOM")
+	}
+
+	errF := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.checkMembers(tx, groupDto.Members); err != nil {
+			return err
+		}
+		// A soft-deleted group with the same name is purged so it can be recreated.
+		if err := tx.Unscoped().Where("name = ? AND deleted_at IS NOT NULL", dbGroup.Name).Delete(&dbom.SambaGroup{}).Error; err != nil {
+			return errors.Wrapf(err, "failed to purge soft-deleted group %s", dbGroup.Name)
+		}
+		if err := tx.Omit("Members.*").Create(&dbGroup).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return dto.ErrorGroupAlreadyExists
+			}
+			return errors.Wrap(err, "failed to create group in repository")
+		}
+		return nil
+	})
+	if errF != nil {
+		return nil, errF
+	}
+	// The unix group is created only once the group is committed, so a failed
+	// transaction leaves no unix state behind.
+	if err := s.syncUnixGroup(s.ctx, dbGroup); err != nil {
+		return nil, err
+	}
+
+	return s.emitGroup(dbGroup.Name, events.EventTypes.ADD)
+}
+
+func (s *GroupService) UpdateGroup(currentName string, groupDto dto.Group) (*dto.Group, error) {
+	newName := currentName
+	var dbGroup dbom.SambaGroup
+	errF := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		dbGroup, err = s.loadGroup(tx, currentName)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return dto.ErrorGroupNotFound
+			}
+			return errors.Wrapf(err, "failed to get group %s from repository", currentName)
+		}
+
+		if groupDto.Name != "" && groupDto.Name != currentName {
+			if _, checkErr := gorm.G[dbom.SambaGroup](tx).Where(g.SambaGroup.Name.Eq(groupDto.Name)).First(s.ctx); checkErr == nil {
+				return errors.WithMessagef(dto.ErrorGroupAlreadyExists, "cannot rename to %s, group already exists", groupDto.Name)
+			} else if !errors.Is(checkErr, gorm.ErrRecordNotFound) {
+				return errors.Wrapf(checkErr, "error checking if new group name %s exists", groupDto.Name)
+			}
+			// Share bindings follow the rename via ON UPDATE CASCADE, the
+			// group owning shares is renamed in their permissions.
+			if err := tx.Model(&dbom.SambaGroup{}).Where("name = ?", currentName).Update("name", groupDto.Name).Error; err != nil {
+				return errors.Wrapf(err, "failed to rename group in DB from %s to %s", currentName, groupDto.Name)
+			}
+			if err := renameShareOwnership(s.ctx, tx, true, currentName, groupDto.Name); err != nil {
+				return err
+			}
+			newName = groupDto.Name
+			dbGroup.Name = newName
+		}
+
+		if groupDto.Members != nil {
+			if err := s.checkMembers(tx, groupDto.Members); err != nil {
+				return err
+			}
+			members := make([]dbom.SambaUser, 0, len(groupDto.Members))
+			for _, member := range groupDto.Members {
+				members = append(members, dbom.SambaUser{Username: member})
+			}
+			if err := tx.Model(&dbGroup).Omit("Members.*").Association("Members").Replace(members); err != nil {
+				return errors.Wrapf(err, "failed to update members of group %s", newName)
+			}
+			dbGroup.Members = members
+		}
+		return nil
+	})
+	if errF != nil {
+		return nil, errF
+	}
+
+	// The unix side effects run only once the transaction is committed: on a
+	// rename the old unix group is dropped and the new one recreated with the
+	// same members.
+	if newName != currentName {
+		if err := unixsamba.DeleteUnixGroup(s.ctx, currentName); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.syncUnixGroup(s.ctx, dbGroup); err != nil {
+		return nil, err
+	}
+
+	return s.emitGroup(newName, events.EventTypes.UPDATE)
+}
+
+func (s *GroupService) DeleteGroup(name string) error {
+	dbGroup, err := s.loadGroup(s.db, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return dto.ErrorGroupNotFound
+		}
+		return errors.Wrapf(err, "failed to get group %s from repository", name)
+	}
+
+	// Hard delete: the membership and share bindings must go with the group,
+	// otherwise shares would keep rendering an @group that no longer exists.
+	// The shares it owns fall back to the default group.
+	errF := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Select("Members", "RwShares", "RoShares").Delete(&dbGroup).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete group %s from repository", name)
+		}
+		return renameShareOwnership(s.ctx, tx, true, name, "")
+	})
+	if errF != nil {
+		return errF
+	}
+
+	if err := unixsamba.DeleteUnixGroup(s.ctx, name); err != nil {
+		return errors.Wrapf(err, "failed to delete unix group %s", name)
+	}
+
+	s.eventBus.EmitGroup(events.GroupEvent{
+		Event: events.Event{
+			Type: events.EventTypes.REMOVE,
+		},
+		Group: &dto.Group{Name: name},
+	})
+	return nil
+}
+
+func (s *GroupService) emitGroup(name string, eventType events.EventType) (*dto.Group, error) {
+	group, err := s.GetGroup(name)
+	if err != nil {
+		return nil, err
+	}
+	s.eventBus.EmitGroup(events.GroupEvent{
+		Event: events.Event{
+			Type: eventType,
+		},
+		Group: group,
+	})
+	return group, nil
+}
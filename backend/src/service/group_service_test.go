@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/unixsamba"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+// GroupServiceSuite contains unit tests for group_service.go
+type GroupServiceSuite struct {
+	suite.Suite
+	app          *fxtest.App
+	db           *gorm.DB
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           *sync.WaitGroup
+	appFS        *unixsamba.MockSystem
+	dirtyService DirtyDataServiceInterface
+	groupService GroupServiceInterface
+}
+
+func TestGroupServiceSuite(t *testing.T) {
+	suite.Run(t, new(GroupServiceSuite))
+}
+
+func (suite *GroupServiceSuite) SetupTest() {
+	os.Setenv("SRAT_MOCK", "true")
+	suite.wg = &sync.WaitGroup{}
+
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() (context.Context, context.CancelFunc) {
+				ctx := context.WithValue(context.Background(), ctxkeys.WaitGroup, suite.wg)
+				return context.WithCancel(ctx)
+			},
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+				}
+			},
+			dbom.NewDB,
+			NewGroupService,
+			NewDirtyDataService,
+			events.NewEventBus,
+		),
+		fx.Populate(&suite.ctx, &suite.cancel),
+		fx.Populate(&suite.dirtyService),
+		fx.Populate(&suite.groupService),
+		fx.Populate(&suite.db),
+	)
+
+	suite.appFS = unixsamba.NewMockSystem()
+	unixsamba.SetCommandExecutor(suite.appFS)
+	unixsamba.SetOSUserLookuper(suite.appFS)
+
+	suite.app.RequireStart()
+
+	suite.Require().NoError(suite.db.Exec("DELETE FROM group_members").Error)
+	suite.Require().NoError(suite.db.Exec("DELETE FROM group_rw_share").Error)
+	suite.Require().NoError(suite.db.Exec("DELETE FROM group_ro_share").Error)
+	suite.Require().NoError(suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&dbom.SambaGroup{}).Error)
+	suite.Require().NoError(suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&dbom.SambaUser{}).Error)
+
+	suite.Require().NoError(suite.db.Create(&[]dbom.SambaUser{
+		{Username: "alice", Password: "password"},
+		{Username: "bob", Password: "password"},
+	}).Error)
+}
+
+func (suite *GroupServiceSuite) TearDownTest() {
+	if suite.cancel != nil {
+		suite.cancel()
+	}
+	if suite.ctx != nil {
+		if wg, ok := suite.ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok && wg != nil {
+			wg.Wait()
+		}
+	}
+	if suite.app != nil {
+		suite.app.RequireStop()
+	}
+	unixsamba.ResetExecutorsToDefaults()
+}
+
+func (suite *GroupServiceSuite) TestCreateGroup_Success() {
+	created, err := suite.groupService.CreateGroup(dto.Group{Name: "family", Members: []string{"alice", "bob"}})
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(created)
+	suite.Equal("family", created.Name)
+	suite.ElementsMatch([]string{"alice", "bob"}, created.Members)
+	suite.True(suite.dirtyService.GetDirtyDataTracker().Shares)
+
+	members, ok := suite.appFS.GroupMembers("family")
+	suite.Require().True(ok, "unix group should exist")
+	suite.ElementsMatch([]string{"alice", "bob"}, members)
+}
+
+func (suite *GroupServiceSuite) TestCreateGroup_Duplicate() {
+	_, err := suite.groupService.CreateGroup(dto.Group{Name: "family"})
+	suite.Require().NoError(err)
+
+	_, err = suite.groupService.CreateGroup(dto.Group{Name: "family"})
+	suite.Require().ErrorIs(err, dto.ErrorGroupAlreadyExists)
+}
+
+func (suite *GroupServiceSuite) TestCreateGroup_UnknownMember() {
+	_, err := suite.groupService.CreateGroup(dto.Group{Name: "family", Members: []string{"alice", "ghost"}})
+
+	suite.Require().ErrorIs(err, dto.ErrorUserNotFound)
+	_, ok := suite.appFS.GroupMembers("family")
+	suite.False(ok, "unix group must not be created when validation fails")
+	_, err = suite.groupService.GetGroup("family")
+	suite.ErrorIs(err, dto.ErrorGroupNotFound)
+}
+
+func (suite *GroupServiceSuite) TestUpdateGroup_ReplaceMembers() {
+	_, err := suite.groupService.CreateGroup(dto.Group{Name: "family", Members: []string{"alice"}})
+	suite.Require().NoError(err)
+
+	updated, err := suite.groupService.UpdateGroup("family", dto.Group{Name: "family", Members: []string{"bob"}})
+
+	suite.Require().NoError(err)
+	suite.Equal([]string{"bob"}, updated.Members)
+	members, ok := suite.appFS.GroupMembers("family")
+	suite.Require().True(ok)
+	suite.Equal([]string{"bob"}, members)
+}
+
+func (suite *GroupServiceSuite) TestUpdateGroup_RenameKeepsShareBindings() {
+	_, err := suite.groupService.CreateGroup(dto.Group{Name: "family", Members: []string{"alice"}})
+	suite.Require().NoError(err)
+	share := dbom.ExportedShare{Name: "photos", Groups: []dbom.SambaGroup{{Name: "family"}}}
+	suite.Require().NoError(suite.db.Omit("Groups.*").Create(&share).Error)
+	defer suite.db.Unscoped().Select("Groups").Delete(&share)
+
+	updated, err := suite.groupService.UpdateGroup("family", dto.Group{Name: "relatives"})
+
+	suite.Require().NoError(err)
+	suite.Equal("relatives", updated.Name)
+	suite.Equal([]string{"alice"}, updated.Members, "members are kept when omitted")
+	suite.Equal([]string{"photos"}, updated.RwShares)
+	_, ok := suite.appFS.GroupMembers("family")
+	suite.False(ok, "old unix group should be removed")
+	members, ok := suite.appFS.GroupMembers("relatives")
+	suite.Require().True(ok)
+	suite.Equal([]string{"alice"}, members)
+}
+
+func (suite *GroupServiceSuite) TestUpdateGroup_RenameFollowsSharePermissions() {
+	_, err := suite.groupService.CreateGroup(dto.Group{Name: "family", Members: []string{"alice"}})
+	suite.Require().NoError(err)
+	share := dbom.ExportedShare{Name: "photos", Permissions: &dto.SharePermissions{Owner: "alice", Group: "family"}}
+	suite.Require().NoError(suite.db.Create(&share).Error)
+	defer suite.db.Unscoped().Delete(&share)
+
+	_, err = suite.groupService.UpdateGroup("family", dto.Group{Name: "relatives"})
+
+	suite.Require().NoError(err)
+	var stored dbom.ExportedShare
+	suite.Require().NoError(suite.db.First(&stored, "name = ?", "photos").Error)
+	suite.Require().NotNil(stored.Permissions)
+	suite.Equal("relatives", stored.Permissions.Group)
+	suite.Equal("alice", stored.Permissions.Owner)
+}
+
+func (suite *GroupServiceSuite) TestUpdateGroup_FailureLeavesUnixGroup() {
+	_, err := suite.groupService.CreateGroup(dto.Group{Name: "family", Members: []string{"alice"}})
+	suite.Require().NoError(err)
+
+	_, err = suite.groupService.UpdateGroup("family", dto.Group{Name: "relatives", Members: []string{"bob", "ghost"}})
+
+	suite.Require().ErrorIs(err, dto.ErrorUserNotFound)
+	members, ok := suite.appFS.GroupMembers("family")
+	suite.Require().True(ok, "unix group must survive a rolled back rename")
+	suite.Equal([]string{"alice"}, members)
+	_, ok = suite.appFS.GroupMembers("relatives")
+	suite.False(ok)
+}
+
+func (suite *GroupServiceSuite) TestUpdateGroup_NotFound() {
+	_, err := suite.groupService.UpdateGroup("missing", dto.Group{Name: "missing"})
+	suite.Require().ErrorIs(err, dto.ErrorGroupNotFound)
+}
+
+func (suite *GroupServiceSuite) TestDeleteGroup_RemovesShareBindings() {
+	_, err := suite.groupService.CreateGroup(dto.Group{Name: "family", Members: []string{"alice"}})
+	suite.Require().NoError(err)
+	share := dbom.ExportedShare{Name: "photos", RoGroups: []dbom.SambaGroup{{Name: "family"}}}
+	suite.Require().NoError(suite.db.Omit("RoGroups.*").Create(&share).Error)
+	defer suite.db.Unscoped().Delete(&share)
+
+	suite.Require().NoError(suite.groupService.DeleteGroup("family"))
+
+	var count int64
+	suite.Require().NoError(suite.db.Table("group_ro_share").Count(&count).Error)
+	suite.Zero(count)
+	_, ok := suite.appFS.GroupMembers("family")
+	suite.False(ok)
+	suite.ErrorIs(suite.groupService.DeleteGroup("family"), dto.ErrorGroupNotFound)
+}
+
+func (suite *GroupServiceSuite) TestDeleteGroup_ClearsSharePermissions() {
+	_, err := suite.groupService.CreateGroup(dto.Group{Name: "family", Members: []string{"alice"}})
+	suite.Require().NoError(err)
+	share := dbom.ExportedShare{Name: "photos", Permissions: &dto.SharePermissions{Owner: "alice", Group: "family"}}
+	suite.Require().NoError(suite.db.Create(&share).Error)
+	defer suite.db.Unscoped().Delete(&share)
+
+	suite.Require().NoError(suite.groupService.DeleteGroup("family"))
+
+	var stored dbom.ExportedShare
+	suite.Require().NoError(suite.db.First(&stored, "name = ?", "photos").Error)
+	suite.Require().NotNil(stored.Permissions)
+	suite.Empty(stored.Permissions.Group, "the share falls back to the default group")
+	suite.Equal(dto.DefaultShareGroup, stored.Permissions.EffectiveGroup())
+	suite.Equal("alice", stored.Permissions.Owner)
+}
@@ -68,6 +68,8 @@ type HDIdleServiceInterface interface {
 	// /dev path) to an absolute device path that exists on this system.
 	// Returns dto.ErrorNotFound if no candidate resolves.
 	ResolveDevicePath(diskID string) (string, errors.E)
+	// SpinDown spins a disk down now, with the command recommended for it.
+	SpinDown(diskID string) errors.E
 }
 
 // HDIdleService implements HDIdleServiceInterface
@@ -946,6 +948,47 @@ func (s *HDIdleService) initDiskState(name string, reads, writes uint64, now tim
 	}
 }
 
+// SpinDown spins a disk down on request, whether or not HDIdle monitors it.
+// A monitored disk counts as spun down until its next I/O, as after an idle
+// spindown.
+func (s *HDIdleService) SpinDown(diskID string) errors.E {
+	path, err := s.ResolveDevicePath(diskID)
+	if err != nil {
+		return err
+	}
+	support, err := s.CheckDeviceSupport(path)
+	if err != nil {
+		return err
+	}
+	if !support.Supported || support.RecommendedCommand == nil {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "disk", diskID, "reason", "the disk does not support spin down", "error", support.ErrorMessage)
+	}
+	device := s.getRealPathNotSymlink(path)
+	if err := s.spindownDisk(device, *support.RecommendedCommand, hdidleDefaultPowerCond); err != nil {
+		return err
+	}
+	tlog.InfoContext(s.ctx, "Spindown on request", "disk", diskID, "device", device, "type", support.RecommendedCommand.String())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.findDiskStateIndex(strings.TrimPrefix(device, "/dev/")); i >= 0 {
+		ds := s.diskStats[i]
+		ds.SpinDownAt = time.Now()
+		ds.SpunDown = true
+		if ds.LastEmittedSpunDown != ds.SpunDown {
+			ds.LastEmittedSpunDown = ds.SpunDown
+			s.eventBus.EmitPower(events.PowerEvent{
+				Event: events.Event{
+					Type: events.EventTypes.UPDATE,
+				},
+				Kind:        events.PowerEventKindStatus,
+				PowerStatus: ds.HDIdleDeviceStatus,
+			})
+		}
+	}
+	return nil
+}
+
 // spindownDisk spins down a disk using the appropriate command
 func (s *HDIdleService) spindownDisk(device string, command dto.HdidleCommand, powerCondition uint8) errors.E {
 	switch command {
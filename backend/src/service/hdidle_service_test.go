@@ -228,6 +228,13 @@ func (suite *HDIdleServiceSuite) TestCheckDeviceSupport_RecommendedCommandNilWhe
 	suite.Nil(support.RecommendedCommand)
 }
 
+func (suite *HDIdleServiceSuite) TestSpinDownUnsupportedDevice() {
+	// /dev/null takes neither the SCSI nor the ATA command
+	err := suite.service.SpinDown("/dev/null")
+	suite.Require().Error(err)
+	suite.ErrorIs(err, dto.ErrorInvalidParameter)
+}
+
 // Tests for GetProcessStatus
 func (suite *HDIdleServiceSuite) TestGetProcessStatus_WhenNotRunning() {
 	// When service is not running, should return idle status
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/dianlight/srat/unixsamba"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+type HomesServiceInterface interface {
+	// CreateHome creates the home directory of username, owned by the user,
+	// and applies the per-user quota. It does nothing while homes are
+	// disabled and is safe to call for an existing directory.
+	CreateHome(username string) errors.E
+	// RemoveHome keeps, archives or removes the home directory of a deleted
+	// user according to the delete policy.
+	RemoveHome(username string) errors.E
+	// RenameHome follows the rename of a user.
+	RenameHome(oldUsername, newUsername string) errors.E
+	// EnsureHomes creates the home directory of every user.
+	EnsureHomes() errors.E
+}
+
+type HomesService struct {
+	ctx               context.Context
+	db                *gorm.DB
+	settingService    SettingServiceInterface
+	filesystemService FilesystemServiceInterface
+	isMounted         func(path string) (bool, error)
+	lookupUser        func(username string) (*user.User, error)
+	now               func() time.Time
+}
+
+type HomesServiceParams struct {
+	fx.In
+	Ctx               context.Context
+	Db                *gorm.DB
+	SettingService    SettingServiceInterface
+	FilesystemService FilesystemServiceInterface
+	EventBus          events.EventBusInterface
+}
+
+func NewHomesService(lc fx.Lifecycle, in HomesServiceParams) HomesServiceInterface {
+	s := &HomesService{
+		ctx:               in.Ctx,
+		db:                in.Db,
+		settingService:    in.SettingService,
+		filesystemService: in.FilesystemService,
+		isMounted:         osutil.IsMounted,
+		lookupUser:        user.Lookup,
+		now:               time.Now,
+	}
+	unsubscribe := in.EventBus.OnSetting(func(ctx context.Context, event events.SettingEvent) errors.E {
+		if event.Setting == nil || event.Setting.HomesEnabled == nil || !*event.Setting.HomesEnabled {
+			return nil
+		}
+		if err := s.EnsureHomes(); err != nil {
+			slog.WarnContext(ctx, "Unable to create home directories", "volume", event.Setting.HomesVolume, "err", err)
+		}
+		return nil
+	})
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			unsubscribe()
+			return nil
+		},
+	})
+	return s
+}
+
+// homesRoot is the directory holding the home directories on volume.
+func homesRoot(volume string) string {
+	return filepath.Join(volume, dto.HomesDir)
+}
+
+// homesSettings returns the settings when homes are enabled, nil otherwise.
+func (s *HomesService) homesSettings() (*dto.Settings, errors.E) {
+	settings, err := s.settingService.Load()
+	if err != nil {
+		return nil, err
+	}
+	if settings.HomesEnabled == nil || !*settings.HomesEnabled || settings.HomesVolume == "" {
+		return nil, nil
+	}
+	mounted, errM := s.isMounted(settings.HomesVolume)
+	if errM != nil || !mounted {
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "volume", settings.HomesVolume,
+			"reason", "homes volume is not mounted")
+	}
+	return settings, nil
+}
+
+// homeUser returns the unix account of a samba user, which names its home
+// directory: unixsamba drops the spaces the account name can't have.
+func homeUser(username string) string {
+	return unixsamba.NormalizeUsernameForUnixSamba(username)
+}
+
+// homePath returns the home directory of username, refusing names that
+// would escape the homes root or clash with HomesArchiveDir.
+func homePath(root, username string) (string, errors.E) {
+	username = homeUser(username)
+	if username == "" || strings.HasPrefix(username, ".") || strings.ContainsAny(username, "/\x00") {
+		return "", errors.WithDetails(dto.ErrorInvalidParameter, "username", username, "reason", "invalid home directory name")
+	}
+	return filepath.Join(root, username), nil
+}
+
+func (s *HomesService) CreateHome(username string) errors.E {
+	username = homeUser(username)
+	settings, errE := s.homesSettings()
+	if errE != nil || settings == nil {
+		return errE
+	}
+	root := homesRoot(settings.HomesVolume)
+	path, errE := homePath(root, username)
+	if errE != nil {
+		return errE
+	}
+	u, err := s.lookupUser(username)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve user %s", username)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return errors.Wrapf(err, "invalid uid of user %s", username)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return errors.Wrapf(err, "invalid gid of user %s", username)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return errors.Wrapf(err, "failed to create %s", root)
+	}
+	if err := os.Mkdir(path, 0o700); err != nil && !os.IsExist(err) {
+		return errors.Wrapf(err, "failed to create home directory of %s", username)
+	}
+	if err := os.Chown(path, uid, gid); err != nil {
+		return errors.Wrapf(err, "failed to chown %s", path)
+	}
+	if err := os.Chmod(path, 0o700); err != nil {
+		return errors.Wrapf(err, "failed to chmod %s", path)
+	}
+	if settings.HomesQuotaBytes > 0 {
+		if err := s.applyQuota(settings, username); err != nil {
+			// The directory is usable without a quota: report and go on.
+			tlog.WarnContext(s.ctx, "Unable to apply home directory quota", "user", username, "volume", settings.HomesVolume, "err", err)
+		}
+	}
+	return nil
+}
+
+// applyQuota caps the space username can use on the homes volume.
+func (s *HomesService) applyQuota(settings *dto.Settings, username string) errors.E {
+	mount, err := gorm.G[dbom.MountPointPath](s.db).Where(g.MountPointPath.Path.Eq(settings.HomesVolume)).First(s.ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find volume %s", settings.HomesVolume)
+	}
+	adapter, errE := s.filesystemService.GetAdapter(mount.FSType)
+	if errE != nil {
+		return errors.WithDetails(dto.ErrorQuotaNotSupported, "fstype", mount.FSType)
+	}
+	quota, ok := filesystem.AsQuotaAdapter(adapter)
+	if !ok {
+		return errors.WithDetails(dto.ErrorQuotaNotSupported, "fstype", mount.FSType)
+	}
+	return quota.SetUserQuota(s.ctx, settings.HomesVolume, username, settings.HomesQuotaBytes)
+}
+
+func (s *HomesService) RemoveHome(username string) errors.E {
+	username = homeUser(username)
+	settings, errE := s.homesSettings()
+	if errE != nil || settings == nil {
+		return errE
+	}
+	root := homesRoot(settings.HomesVolume)
+	path, errE := homePath(root, username)
+	if errE != nil {
+		return errE
+	}
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	switch settings.HomesDeletePolicy {
+	case dto.HomesDeletePolicyKeep:
+		return nil
+	case dto.HomesDeletePolicyRemove:
+		if err := os.RemoveAll(path); err != nil {
+			return errors.Wrapf(err, "failed to remove home directory of %s", username)
+		}
+		return nil
+	}
+	archive := filepath.Join(root, dto.HomesArchiveDir)
+	if err := os.MkdirAll(archive, 0o700); err != nil {
+		return errors.Wrapf(err, "failed to create %s", archive)
+	}
+	target := filepath.Join(archive, fmt.Sprintf("%s-%s", username, s.now().UTC().Format("2006-01-02_15-04-05")))
+	if err := os.Rename(path, target); err != nil {
+		return errors.Wrapf(err, "failed to archive home directory of %s", username)
+	}
+	return nil
+}
+
+func (s *HomesService) RenameHome(oldUsername, newUsername string) errors.E {
+	settings, errE := s.homesSettings()
+	if errE != nil || settings == nil {
+		return errE
+	}
+	root := homesRoot(settings.HomesVolume)
+	oldPath, errE := homePath(root, oldUsername)
+	if errE != nil {
+		return errE
+	}
+	newPath, errE := homePath(root, newUsername)
+	if errE != nil {
+		return errE
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return errors.WithDetails(dto.ErrorConflict, "path", newPath, "reason", "home directory already exists")
+	}
+	if err := os.Rename(oldPath, newPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to rename home directory of %s", oldUsername)
+	}
+	// The uid is unchanged by a rename, CreateHome only fills the gaps.
+	return s.CreateHome(newUsername)
+}
+
+func (s *HomesService) EnsureHomes() errors.E {
+	if settings, errE := s.homesSettings(); errE != nil || settings == nil {
+		return errE
+	}
+	users, err := gorm.G[dbom.SambaUser](s.db).Find(s.ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list users")
+	}
+	var errs []error
+	for _, u := range users {
+		if err := s.CreateHome(u.Username); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
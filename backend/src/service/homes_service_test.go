@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+type HomesServiceSuite struct {
+	suite.Suite
+	app               *fxtest.App
+	db                *gorm.DB
+	settingService    SettingServiceInterface
+	filesystemService FilesystemServiceInterface
+	homesService      *HomesService
+	volume            string
+	settings          *dto.Settings
+}
+
+func TestHomesServiceSuite(t *testing.T) {
+	suite.Run(t, new(HomesServiceSuite))
+}
+
+func (suite *HomesServiceSuite) SetupTest() {
+	var homesService HomesServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+				}
+			},
+			dbom.NewDB,
+			events.NewEventBus,
+			mock.Mock[SettingServiceInterface],
+			mock.Mock[FilesystemServiceInterface],
+			NewHomesService,
+		),
+		fx.Populate(&suite.db),
+		fx.Populate(&suite.settingService),
+		fx.Populate(&suite.filesystemService),
+		fx.Populate(&homesService),
+	)
+	suite.app.RequireStart()
+
+	// Home directories belong to the test user, who can chown to itself.
+	current, err := user.Current()
+	suite.Require().NoError(err)
+	suite.homesService = homesService.(*HomesService)
+	suite.homesService.isMounted = func(string) (bool, error) { return true, nil }
+	suite.homesService.lookupUser = func(string) (*user.User, error) { return current, nil }
+	suite.homesService.now = func() time.Time { return time.Date(2026, 3, 1, 2, 30, 0, 0, time.UTC) }
+
+	suite.volume = suite.T().TempDir()
+	suite.settings = &dto.Settings{
+		HomesEnabled:      new(true),
+		HomesVolume:       suite.volume,
+		HomesDeletePolicy: dto.HomesDeletePolicyArchive,
+	}
+	mock.When(suite.settingService.Load()).ThenAnswer(func(_ []any) []any {
+		return []any{suite.settings, nil}
+	})
+}
+
+func (suite *HomesServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+func (suite *HomesServiceSuite) homeOf(username string) string {
+	return filepath.Join(suite.volume, dto.HomesDir, username)
+}
+
+func (suite *HomesServiceSuite) TestCreateHome() {
+	suite.Require().NoError(suite.homesService.CreateHome("alice"))
+
+	info, err := os.Stat(suite.homeOf("alice"))
+	suite.Require().NoError(err)
+	suite.True(info.IsDir())
+	suite.Equal(os.FileMode(0o700), info.Mode().Perm())
+
+	suite.Require().NoError(suite.homesService.CreateHome("alice"), "an existing directory is fine")
+}
+
+func (suite *HomesServiceSuite) TestCreateHome_Disabled() {
+	suite.settings.HomesEnabled = new(false)
+	suite.Require().NoError(suite.homesService.CreateHome("alice"))
+	suite.NoDirExists(filepath.Join(suite.volume, dto.HomesDir))
+}
+
+func (suite *HomesServiceSuite) TestCreateHome_VolumeNotMounted() {
+	suite.homesService.isMounted = func(string) (bool, error) { return false, nil }
+	suite.ErrorIs(suite.homesService.CreateHome("alice"), dto.ErrorInvalidStateForOperation)
+	suite.NoDirExists(filepath.Join(suite.volume, dto.HomesDir))
+}
+
+func (suite *HomesServiceSuite) TestCreateHome_RejectsUnsafeNames() {
+	for _, username := range []string{"", "..", ".archive", "a/b"} {
+		suite.ErrorIs(suite.homesService.CreateHome(username), dto.ErrorInvalidParameter, "username %q", username)
+	}
+}
+
+func (suite *HomesServiceSuite) TestCreateHome_UsesUnixAccountName() {
+	lookup := suite.homesService.lookupUser
+	var looked []string
+	suite.homesService.lookupUser = func(username string) (*user.User, error) {
+		looked = append(looked, username)
+		return lookup(username)
+	}
+
+	suite.Require().NoError(suite.homesService.CreateHome(" John Doe "))
+	suite.Equal([]string{"JohnDoe"}, looked, "the unix account has no spaces")
+	suite.DirExists(suite.homeOf("JohnDoe"))
+	suite.NoDirExists(suite.homeOf("John Doe"))
+
+	suite.Require().NoError(suite.homesService.RemoveHome("John Doe"))
+	suite.NoDirExists(suite.homeOf("JohnDoe"))
+	suite.DirExists(filepath.Join(suite.volume, dto.HomesDir, dto.HomesArchiveDir, "JohnDoe-2026-03-01_02-30-00"))
+	suite.ErrorIs(suite.homesService.CreateHome("   "), dto.ErrorInvalidParameter)
+}
+
+func (suite *HomesServiceSuite) TestCreateHome_AppliesUserQuota() {
+	suite.settings.HomesQuotaBytes = 1 << 30
+	suite.Require().NoError(suite.db.Create(&dbom.MountPointPath{
+		Path:     suite.volume,
+		Type:     "ADDON",
+		DeviceId: "homes-test",
+		FSType:   "xfs",
+	}).Error)
+	adapter := &fakeQuotaAdapter{userLimits: map[string]uint64{}}
+	mock.When(suite.filesystemService.GetAdapter(mock.Exact("xfs"))).ThenReturn(adapter, nil)
+
+	suite.Require().NoError(suite.homesService.CreateHome("alice"))
+	suite.Equal(uint64(1<<30), adapter.userLimits["alice"])
+}
+
+func (suite *HomesServiceSuite) TestRemoveHome_Policies() {
+	suite.Require().NoError(suite.homesService.CreateHome("alice"))
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.homeOf("alice"), "notes.txt"), []byte("x"), 0o600))
+
+	suite.settings.HomesDeletePolicy = dto.HomesDeletePolicyKeep
+	suite.Require().NoError(suite.homesService.RemoveHome("alice"))
+	suite.DirExists(suite.homeOf("alice"))
+
+	suite.settings.HomesDeletePolicy = dto.HomesDeletePolicyArchive
+	suite.Require().NoError(suite.homesService.RemoveHome("alice"))
+	suite.NoDirExists(suite.homeOf("alice"))
+	suite.FileExists(filepath.Join(suite.volume, dto.HomesDir, dto.HomesArchiveDir, "alice-2026-03-01_02-30-00", "notes.txt"))
+
+	suite.Require().NoError(suite.homesService.CreateHome("bob"))
+	suite.settings.HomesDeletePolicy = dto.HomesDeletePolicyRemove
+	suite.Require().NoError(suite.homesService.RemoveHome("bob"))
+	suite.NoDirExists(suite.homeOf("bob"))
+
+	suite.Require().NoError(suite.homesService.RemoveHome("carol"), "a missing directory is fine")
+}
+
+func (suite *HomesServiceSuite) TestRenameHome() {
+	suite.Require().NoError(suite.homesService.CreateHome("alice"))
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.homeOf("alice"), "notes.txt"), []byte("x"), 0o600))
+
+	suite.Require().NoError(suite.homesService.RenameHome("alice", "alicia"))
+	suite.NoDirExists(suite.homeOf("alice"))
+	suite.FileExists(filepath.Join(suite.homeOf("alicia"), "notes.txt"))
+
+	suite.Require().NoError(suite.homesService.CreateHome("bob"))
+	suite.ErrorIs(suite.homesService.RenameHome("bob", "alicia"), dto.ErrorConflict)
+}
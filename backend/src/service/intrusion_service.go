@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+const (
+	// intrusionCheckInterval is how often the authentication log is read.
+	intrusionCheckInterval = 10 * time.Second
+	// intrusionProblemPrefix starts the key of the Problem raised for a ban,
+	// followed by the client address.
+	intrusionProblemPrefix = "intrusion_ban_"
+	// intrusionProblemTranslationKey is shared by every "client banned"
+	// Problem.
+	intrusionProblemTranslationKey = "intrusion_ban"
+	// intrusionUnbanAction is the ProblemAction lifting a ban.
+	intrusionUnbanAction = "unban"
+	// Defaults applying when the settings are not set.
+	defaultIntrusionMaxFailures   = 5
+	defaultIntrusionWindowMinutes = 10
+	defaultIntrusionBanMinutes    = 60
+)
+
+// authLogFile is where smbd writes the auth_audit debug class when intrusion
+// protection is on, see the `log level` of smb.gtpl.
+var authLogFile = "/var/log/samba/auth.log"
+
+// authLogLine matches the authentication message of the auth_audit debug
+// class, like `Auth: [SMB2,(null)] user [WORKGROUP]\[alice] at [...] with
+// [NTLMv2] status [NT_STATUS_WRONG_PASSWORD] workstation [PC] remote host
+// [ipv4:192.168.1.10:51234] ...`.
+var authLogLine = regexp.MustCompile(`Auth: \[[^\]]*\] user \[[^\]]*\]\\\[([^\]]*)\] at \[[^\]]*\] with \[[^\]]*\] status \[(\w+)\] .*remote host \[ipv[46]:(.+?):\d+\]`)
+
+type IntrusionServiceInterface interface {
+	// CheckAuthLog reads the authentications logged since the last check,
+	// bans the clients failing too many of them and lifts the expired bans.
+	// It returns how many clients were banned.
+	CheckAuthLog(ctx context.Context) (int, errors.E)
+	// ListBans returns the bans in force, the latest first.
+	ListBans() ([]dto.ClientBan, errors.E)
+	// Ban refuses ip for duration.
+	Ban(ctx context.Context, ip string, duration time.Duration, reason string) (*dto.ClientBan, errors.E)
+	// Unban lifts the ban of ip.
+	Unban(ctx context.Context, ip string) errors.E
+}
+
+type IntrusionService struct {
+	ctx            context.Context
+	db             *gorm.DB
+	settingService SettingServiceInterface
+	serverService  ServerServiceInterface
+	problemService ProblemServiceInterface
+	eventBus       events.EventBusInterface
+	wg             *sync.WaitGroup
+	now            func() time.Time
+
+	mu       sync.Mutex
+	tail     sambaLogTail
+	lastTime time.Time              // time of the last debug header read
+	failures map[string][]time.Time // recent failed logins by client
+}
+
+type IntrusionServiceParams struct {
+	fx.In
+	Ctx            context.Context
+	Db             *gorm.DB
+	SettingService SettingServiceInterface
+	ServerService  ServerServiceInterface
+	ProblemService ProblemServiceInterface
+	EventBus       events.EventBusInterface
+}
+
+func NewIntrusionService(lc fx.Lifecycle, in IntrusionServiceParams) IntrusionServiceInterface {
+	wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup)
+	if !ok || wg == nil {
+		wg = &sync.WaitGroup{}
+	}
+	s := &IntrusionService{
+		ctx:            in.Ctx,
+		db:             in.Db,
+		settingService: in.SettingService,
+		serverService:  in.ServerService,
+		problemService: in.ProblemService,
+		eventBus:       in.EventBus,
+		wg:             wg,
+		now:            time.Now,
+		failures:       map[string][]time.Time{},
+	}
+	var unsubscribe func()
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			unsubscribe = s.eventBus.OnProblem(s.handleProblemEvent)
+			if _, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok {
+				s.wg.Go(func() {
+					if err := s.run(); err != nil && !errors.Is(err, context.Canceled) {
+						slog.WarnContext(s.ctx, "IntrusionService run loop stopped with error", "error", err)
+					}
+				})
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			if unsubscribe != nil {
+				unsubscribe()
+			}
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *IntrusionService) run() errors.E {
+	for {
+		if _, err := s.CheckAuthLog(s.ctx); err != nil {
+			tlog.DebugContext(s.ctx, "Failed to check the authentication log", "error", err)
+		}
+		select {
+		case <-s.ctx.Done():
+			slog.DebugContext(s.ctx, "Run process closed", "err", s.ctx.Err())
+			return errors.WithStack(s.ctx.Err())
+		case <-time.After(intrusionCheckInterval):
+		}
+	}
+}
+
+// handleProblemEvent lifts a ban when its Problem is fixed, which is what
+// running the "unban" action does.
+func (s *IntrusionService) handleProblemEvent(ctx context.Context, event events.ProblemEvent) errors.E {
+	if event.Type != events.EventTypes.UPDATE || event.Problem == nil ||
+		event.Problem.Status != dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSFIXED {
+		return nil
+	}
+	ip, ok := strings.CutPrefix(event.Problem.ProblemKey, intrusionProblemPrefix)
+	if !ok {
+		return nil
+	}
+	if err := s.Unban(ctx, ip); err != nil && !errors.Is(err, dto.ErrorClientBanNotFound) {
+		return err
+	}
+	return nil
+}
+
+// intrusionSettings returns the protection settings, with the defaults
+// filled in. Protection is on when there are no settings to read.
+func (s *IntrusionService) intrusionSettings() (enabled bool, maxFailures int, window, ban time.Duration, err errors.E) {
+	maxFailures = defaultIntrusionMaxFailures
+	window = defaultIntrusionWindowMinutes * time.Minute
+	ban = defaultIntrusionBanMinutes * time.Minute
+	if s.settingService == nil {
+		return true, maxFailures, window, ban, nil
+	}
+	settings, err := s.settingService.Load()
+	if err != nil {
+		return false, maxFailures, window, ban, err
+	}
+	if settings.IntrusionMaxFailures > 0 {
+		maxFailures = int(settings.IntrusionMaxFailures)
+	}
+	if settings.IntrusionWindowMinutes > 0 {
+		window = time.Duration(settings.IntrusionWindowMinutes) * time.Minute
+	}
+	if settings.IntrusionBanMinutes > 0 {
+		ban = time.Duration(settings.IntrusionBanMinutes) * time.Minute
+	}
+	return settings.IntrusionProtection != nil && *settings.IntrusionProtection, maxFailures, window, ban, nil
+}
+
+func (s *IntrusionService) CheckAuthLog(ctx context.Context) (int, errors.E) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed, errE := s.expireBans(ctx)
+	if errE != nil {
+		return 0, errE
+	}
+
+	enabled, maxFailures, window, duration, errE := s.intrusionSettings()
+	if errE != nil {
+		return 0, errE
+	}
+	lines, errE := s.tail.readLines(authLogFile)
+	if errE != nil {
+		return 0, errE
+	}
+	if !enabled {
+		clear(s.failures)
+		return 0, s.reloadIf(ctx, changed)
+	}
+
+	now := s.now()
+	var banned []string
+	for _, line := range lines {
+		if t, ok := parseSambaHeaderTime(line); ok {
+			s.lastTime = t
+			continue
+		}
+		username, ip, ok := parseAuthFailure(line)
+		if !ok {
+			continue
+		}
+		when := s.lastTime
+		if when.IsZero() {
+			when = now
+		}
+		// Failures read again after a restart are too old to count.
+		if !when.After(now.Add(-window)) {
+			continue
+		}
+		recent := []time.Time{when}
+		for _, t := range s.failures[ip] {
+			if t.After(when.Add(-window)) {
+				recent = append(recent, t)
+			}
+		}
+		s.failures[ip] = recent
+		if len(recent) < maxFailures {
+			continue
+		}
+		delete(s.failures, ip)
+		reason := fmt.Sprintf("%d failed logins in %s", len(recent), window)
+		if _, err := s.ban(ctx, ip, username, len(recent), duration, reason); err != nil {
+			return len(banned), err
+		}
+		banned = append(banned, ip)
+		changed = true
+	}
+	// Forget the clients that stopped failing.
+	for ip, recent := range s.failures {
+		if !recent[0].After(now.Add(-window)) {
+			delete(s.failures, ip)
+		}
+	}
+	if err := s.reloadIf(ctx, changed); err != nil {
+		return len(banned), err
+	}
+	s.disconnect(ctx, banned...)
+	return len(banned), nil
+}
+
+// parseAuthFailure returns the user and the client address of a failed
+// authentication message. Logins from the host itself are never reported.
+func parseAuthFailure(line string) (username, ip string, ok bool) {
+	match := authLogLine.FindStringSubmatch(line)
+	if match == nil || match[2] == "NT_STATUS_OK" {
+		return "", "", false
+	}
+	addr := net.ParseIP(match[3])
+	if addr == nil || addr.IsLoopback() {
+		return "", "", false
+	}
+	return match[1], addr.String(), true
+}
+
+func (s *IntrusionService) ListBans() ([]dto.ClientBan, errors.E) {
+	rows, err := gorm.G[dbom.ClientBan](s.db).Where(g.ClientBan.ExpiresAt.Gt(s.now())).Order(g.ClientBan.BannedAt.Desc()).Find(s.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list client bans")
+	}
+	bans := make([]dto.ClientBan, 0, len(rows))
+	for _, row := range rows {
+		bans = append(bans, clientBanToDto(row))
+	}
+	return bans, nil
+}
+
+func (s *IntrusionService) Ban(ctx context.Context, ip string, duration time.Duration, reason string) (*dto.ClientBan, errors.E) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "ip", ip, "reason", "not an IP address")
+	}
+	if addr.IsLoopback() {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "ip", ip, "reason", "the host itself can't be banned")
+	}
+	if duration <= 0 {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "duration", duration, "reason", "duration must be positive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ban, err := s.ban(ctx, addr.String(), "", 0, duration, reason)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.reloadIf(ctx, true); err != nil {
+		return ban, err
+	}
+	s.disconnect(ctx, ban.IP)
+	return ban, nil
+}
+
+// ban stores the ban of ip and raises its Problem.
+func (s *IntrusionService) ban(ctx context.Context, ip, username string, failures int, duration time.Duration, reason string) (*dto.ClientBan, errors.E) {
+	now := s.now()
+	row := dbom.ClientBan{
+		IP:        ip,
+		Reason:    reason,
+		Username:  username,
+		Failures:  failures,
+		BannedAt:  now,
+		ExpiresAt: now.Add(duration),
+	}
+	if err := s.db.WithContext(ctx).Save(&row).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to store the client ban")
+	}
+	slog.WarnContext(ctx, "Client banned", "ip", ip, "username", username, "reason", reason, "expires_at", row.ExpiresAt)
+
+	if s.problemService != nil {
+		description := fmt.Sprintf("Samba refuses the connections from %s until %s", ip, row.ExpiresAt.Format(time.RFC1123))
+		if reason != "" {
+			description += ": " + reason
+		}
+		_, err := s.problemService.Upsert(&dto.Problem{
+			ProblemKey:     intrusionProblemPrefix + ip,
+			Title:          fmt.Sprintf("Client %s banned", ip),
+			Description:    description + ".",
+			Severity:       dto.ProblemSeverities.PROBLEMSEVERITYWARNING,
+			Status:         dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSCREATED,
+			Actions:        []dto.ProblemAction{{Key: intrusionUnbanAction, Label: "Unban", IsDefault: true}},
+			TranslationKey: intrusionProblemTranslationKey,
+			TranslationPlaceholders: map[string]string{
+				"ip":         ip,
+				"expires_at": row.ExpiresAt.Format(time.RFC3339),
+			},
+			IsFixable:    true,
+			IsPersistent: true,
+		})
+		if err != nil {
+			tlog.WarnContext(ctx, "Unable to upsert client ban problem", "ip", ip, "error", err)
+		}
+	}
+	ban := clientBanToDto(row)
+	return &ban, nil
+}
+
+func (s *IntrusionService) Unban(ctx context.Context, ip string) errors.E {
+	if addr := net.ParseIP(ip); addr != nil {
+		ip = addr.String()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted, err := gorm.G[dbom.ClientBan](s.db).Where(g.ClientBan.IP.Eq(ip)).Delete(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete the client ban")
+	}
+	if deleted == 0 {
+		return errors.WithDetails(dto.ErrorClientBanNotFound, "ip", ip)
+	}
+	delete(s.failures, ip)
+	slog.InfoContext(ctx, "Client unbanned", "ip", ip)
+	s.dismissProblem(ctx, ip)
+	return s.reloadIf(ctx, true)
+}
+
+// expireBans removes the bans past their expiry and tells whether there
+// were any.
+func (s *IntrusionService) expireBans(ctx context.Context) (bool, errors.E) {
+	expired, err := gorm.G[dbom.ClientBan](s.db).Where(g.ClientBan.ExpiresAt.Lte(s.now())).Find(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list expired client bans")
+	}
+	for _, row := range expired {
+		if _, err := gorm.G[dbom.ClientBan](s.db).Where(g.ClientBan.IP.Eq(row.IP)).Delete(ctx); err != nil {
+			return false, errors.Wrap(err, "failed to delete the client ban")
+		}
+		slog.InfoContext(ctx, "Client ban expired", "ip", row.IP)
+		s.dismissProblem(ctx, row.IP)
+	}
+	return len(expired) > 0, nil
+}
+
+func (s *IntrusionService) dismissProblem(ctx context.Context, ip string) {
+	if s.problemService == nil {
+		return
+	}
+	if err := s.problemService.Dismiss(intrusionProblemPrefix + ip); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		tlog.WarnContext(ctx, "Unable to dismiss client ban problem", "ip", ip, "error", err)
+	}
+}
+
+// reloadIf has smbd apply the bans when they changed. Only the bans are
+// applied, the other pending changes wait for the next apply.
+func (s *IntrusionService) reloadIf(ctx context.Context, changed bool) errors.E {
+	if !changed || s.serverService == nil {
+		return nil
+	}
+	if err := s.serverService.ApplyClientBans(ctx); err != nil {
+		return errors.Wrap(err, "failed to apply the client bans")
+	}
+	return nil
+}
+
+// disconnect ends the sessions the banned clients already have, which the
+// bans don't close.
+func (s *IntrusionService) disconnect(ctx context.Context, ips ...string) {
+	if s.serverService == nil {
+		return
+	}
+	for _, ip := range ips {
+		if _, err := s.serverService.DisconnectClient(ctx, ip); err != nil {
+			tlog.WarnContext(ctx, "Unable to disconnect banned client", "ip", ip, "error", err)
+		}
+	}
+}
+
+func clientBanToDto(row dbom.ClientBan) dto.ClientBan {
+	return dto.ClientBan{
+		IP:        row.IP,
+		Reason:    row.Reason,
+		Username:  row.Username,
+		Failures:  row.Failures,
+		BannedAt:  row.BannedAt,
+		ExpiresAt: row.ExpiresAt,
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+func TestParseAuthFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		username string
+		ip       string
+		ok       bool
+	}{
+		{
+			name:     "wrong password",
+			line:     `  Auth: [SMB2,(null)] user [WORKGROUP]\[alice] at [Sun, 01 Feb 2026 11:58:00.000001 CET] with [NTLMv2] status [NT_STATUS_WRONG_PASSWORD] workstation [DESKTOP] remote host [ipv4:192.168.1.66:51234] mapped to [WORKGROUP]\[alice]. local host [ipv4:192.168.1.2:445]`,
+			username: "alice", ip: "192.168.1.66", ok: true,
+		},
+		{
+			name:     "unknown user over ipv6",
+			line:     `  Auth: [SMB2,(null)] user [WORKGROUP]\[admin] at [Sun, 01 Feb 2026 11:58:00.000001 CET] with [NTLMv2] status [NT_STATUS_NO_SUCH_USER] workstation [] remote host [ipv6:fe80::1:51234] mapped to [WORKGROUP]\[admin]. local host [ipv6:fe80::2:445]`,
+			username: "admin", ip: "fe80::1", ok: true,
+		},
+		{
+			name: "success",
+			line: `  Auth: [SMB2,(null)] user [WORKGROUP]\[alice] at [Sun, 01 Feb 2026 11:58:00.000001 CET] with [NTLMv2] status [NT_STATUS_OK] workstation [DESKTOP] remote host [ipv4:192.168.1.66:51234] mapped to [WORKGROUP]\[alice]. local host [ipv4:192.168.1.2:445]`,
+		},
+		{
+			name: "loopback",
+			line: `  Auth: [SMB2,(null)] user [WORKGROUP]\[alice] at [Sun, 01 Feb 2026 11:58:00.000001 CET] with [NTLMv2] status [NT_STATUS_WRONG_PASSWORD] workstation [] remote host [ipv4:127.0.0.1:51234] mapped to [WORKGROUP]\[alice]. local host [ipv4:127.0.0.1:445]`,
+		},
+		{name: "other message", line: "  Closing connection"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, ip, ok := parseAuthFailure(tt.line)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.username, username)
+			assert.Equal(t, tt.ip, ip)
+		})
+	}
+}
+
+type IntrusionServiceSuite struct {
+	suite.Suite
+	app            *fxtest.App
+	db             *gorm.DB
+	service        *IntrusionService
+	serverService  ServerServiceInterface
+	problemService ProblemServiceInterface
+	logFile        string
+	oldFile        string
+}
+
+func TestIntrusionServiceSuite(t *testing.T) {
+	suite.Run(t, new(IntrusionServiceSuite))
+}
+
+func (suite *IntrusionServiceSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+				}
+			},
+			dbom.NewDB,
+		),
+		fx.Populate(&suite.db),
+	)
+	suite.app.RequireStart()
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.ClientBan{}).Error)
+
+	suite.oldFile = authLogFile
+	suite.logFile = filepath.Join(suite.T().TempDir(), "auth.log")
+	authLogFile = suite.logFile
+
+	ctrl := mock.NewMockController(suite.T())
+	suite.serverService = mock.Mock[ServerServiceInterface](ctrl)
+	suite.problemService = mock.Mock[ProblemServiceInterface](ctrl)
+	mock.When(suite.problemService.Upsert(mock.Any[*dto.Problem]())).ThenAnswer(func(args []any) []any {
+		return []any{args[0].(*dto.Problem), nil}
+	})
+	suite.service = &IntrusionService{
+		ctx:            context.Background(),
+		db:             suite.db,
+		serverService:  suite.serverService,
+		problemService: suite.problemService,
+		now:            func() time.Time { return time.Date(2026, 2, 1, 12, 0, 0, 0, time.Local) },
+		failures:       map[string][]time.Time{},
+	}
+}
+
+func (suite *IntrusionServiceSuite) TearDownTest() {
+	authLogFile = suite.oldFile
+	suite.app.RequireStop()
+}
+
+// appendFailures logs a failed login from ip at each of the times.
+func (suite *IntrusionServiceSuite) appendFailures(ip string, times ...string) {
+	file, err := os.OpenFile(suite.logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	suite.Require().NoError(err)
+	defer file.Close()
+	for _, t := range times {
+		_, err = fmt.Fprintf(file, "[2026/02/01 %s.000001,  2, class=auth_audit] ../../auth/auth_log.c:760(log_authentication_event_human_readable)\n"+
+			"  Auth: [SMB2,(null)] user [WORKGROUP]\\[alice] at [Sun, 01 Feb 2026 %s.000001 CET] with [NTLMv2] status [NT_STATUS_WRONG_PASSWORD] workstation [DESKTOP] remote host [ipv4:%s:51234] mapped to [WORKGROUP]\\[alice]. local host [ipv4:192.168.1.2:445]\n",
+			t, t, ip)
+		suite.Require().NoError(err)
+	}
+}
+
+func (suite *IntrusionServiceSuite) check(expected int) {
+	banned, err := suite.service.CheckAuthLog(context.Background())
+	suite.Require().NoError(err)
+	suite.Equal(expected, banned)
+}
+
+func (suite *IntrusionServiceSuite) TestCheckAuthLogBans() {
+	suite.appendFailures("192.168.1.66", "11:55:00", "11:56:00", "11:57:00", "11:58:00")
+	suite.check(0)
+	mock.Verify(suite.serverService, mock.Never()).ApplyClientBans(mock.AnyContext())
+
+	suite.appendFailures("192.168.1.66", "11:59:00")
+	suite.check(1)
+	mock.Verify(suite.serverService, mock.Once()).ApplyClientBans(mock.AnyContext())
+	mock.Verify(suite.serverService, mock.Once()).DisconnectClient(mock.AnyContext(), mock.Exact("192.168.1.66"))
+	// Bans leave the other pending changes and the generations alone.
+	mock.Verify(suite.serverService, mock.Never()).ReloadConfig(mock.AnyContext())
+
+	captor := mock.Captor[*dto.Problem]()
+	mock.Verify(suite.problemService, mock.Once()).Upsert(captor.Capture())
+	problem := captor.Last()
+	suite.Equal("intrusion_ban_192.168.1.66", problem.ProblemKey)
+	suite.Equal([]dto.ProblemAction{{Key: "unban", Label: "Unban", IsDefault: true}}, problem.Actions)
+
+	bans, err := suite.service.ListBans()
+	suite.Require().NoError(err)
+	suite.Require().Len(bans, 1)
+	suite.Equal("192.168.1.66", bans[0].IP)
+	suite.Equal("alice", bans[0].Username)
+	suite.Equal(5, bans[0].Failures)
+	suite.Equal(suite.service.now().Add(defaultIntrusionBanMinutes*time.Minute), bans[0].ExpiresAt.Local())
+}
+
+func (suite *IntrusionServiceSuite) TestCheckAuthLogWindow() {
+	// Spread over more than the window, or older than it.
+	suite.appendFailures("192.168.1.66", "11:00:00", "11:30:00", "11:45:00", "11:52:00", "11:54:00", "11:56:00", "11:58:00")
+	suite.check(0)
+
+	bans, err := suite.service.ListBans()
+	suite.Require().NoError(err)
+	suite.Empty(bans)
+}
+
+func (suite *IntrusionServiceSuite) TestCheckAuthLogExpiresBans() {
+	suite.Require().NoError(suite.db.Create(&dbom.ClientBan{
+		IP: "192.168.1.66", ExpiresAt: suite.service.now().Add(-time.Minute),
+	}).Error)
+	suite.check(0)
+
+	mock.Verify(suite.problemService, mock.Once()).Dismiss("intrusion_ban_192.168.1.66")
+	mock.Verify(suite.serverService, mock.Once()).ApplyClientBans(mock.AnyContext())
+	var count int64
+	suite.Require().NoError(suite.db.Model(&dbom.ClientBan{}).Count(&count).Error)
+	suite.Zero(count)
+}
+
+func (suite *IntrusionServiceSuite) TestUnbanAction() {
+	_, err := suite.service.Ban(context.Background(), "192.168.1.66", time.Hour, "manual")
+	suite.Require().NoError(err)
+
+	// Running the "unban" action of the Problem marks it fixed.
+	suite.Require().NoError(suite.service.handleProblemEvent(context.Background(), events.ProblemEvent{
+		Event: events.Event{Type: events.EventTypes.UPDATE},
+		Problem: &dto.Problem{
+			ProblemKey: "intrusion_ban_192.168.1.66",
+			Status:     dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSFIXED,
+		},
+	}))
+
+	bans, err := suite.service.ListBans()
+	suite.Require().NoError(err)
+	suite.Empty(bans)
+	mock.Verify(suite.problemService, mock.Once()).Dismiss("intrusion_ban_192.168.1.66")
+	mock.Verify(suite.serverService, mock.Times(2)).ApplyClientBans(mock.AnyContext())
+	mock.Verify(suite.serverService, mock.Once()).DisconnectClient(mock.AnyContext(), mock.Exact("192.168.1.66"))
+}
+
+func (suite *IntrusionServiceSuite) TestBanErrors() {
+	for _, ip := range []string{"not-an-ip", "127.0.0.1"} {
+		_, err := suite.service.Ban(context.Background(), ip, time.Hour, "")
+		suite.True(errors.Is(err, dto.ErrorInvalidParameter), ip)
+	}
+	err := suite.service.Unban(context.Background(), "192.168.1.99")
+	suite.True(errors.Is(err, dto.ErrorClientBanNotFound))
+}
@@ -0,0 +1,660 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/converter"
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/cronexpr"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+const (
+	// jobCheckInterval is how often due jobs are looked for. Cron has minute
+	// resolution, so a run starts at most this late.
+	jobCheckInterval = 30 * time.Second
+	// jobHistoryLimit is the number of runs kept per job.
+	jobHistoryLimit = 50
+	// defaultRecycleMaxAgeDays is the recycle_bin_purge max age when neither
+	// the job nor the share policy sets one.
+	defaultRecycleMaxAgeDays = 30
+)
+
+type JobServiceInterface interface {
+	ListJobs() ([]dto.Job, errors.E)
+	GetJob(id uint) (*dto.Job, errors.E)
+	CreateJob(job dto.Job) (*dto.Job, errors.E)
+	UpdateJob(id uint, job dto.Job) (*dto.Job, errors.E)
+	DeleteJob(id uint) errors.E
+	// RunJob starts a job now, outside of its schedule. The run goes on in
+	// the background; its progress is sent as job_run events.
+	RunJob(id uint) (*dto.JobRun, errors.E)
+	// ListJobRuns returns the run history of a job, newest first.
+	ListJobRuns(id uint) ([]dto.JobRun, errors.E)
+}
+
+// jobRunner performs run, a run of job, and returns a summary of the
+// outcome. progress may be called with a completion percentage while it
+// works.
+type jobRunner func(ctx context.Context, job dto.Job, run dto.JobRun, progress func(percent int)) (string, errors.E)
+
+type JobService struct {
+	ctx                context.Context
+	db                 *gorm.DB
+	eventBus           events.EventBusInterface
+	smartService       SmartServiceInterface
+	filesystemService  FilesystemServiceInterface
+	shareService       ShareServiceInterface
+	recycleBinService  RecycleBinServiceInterface
+	replicationService ReplicationServiceInterface
+	hdidleService      HDIdleServiceInterface
+	problemService     ProblemServiceInterface
+	wg                 *sync.WaitGroup
+	now                func() time.Time
+	runners            map[dto.JobType]jobRunner
+
+	mu         sync.Mutex
+	running    map[uint]bool         // jobs with a run in progress
+	next       map[uint]time.Time    // next scheduled run of enabled jobs
+	smartTests map[uint]smartTestRun // SMART self-tests running on a disk, by job
+}
+
+type JobServiceParams struct {
+	fx.In
+	Ctx                context.Context
+	Db                 *gorm.DB
+	EventBus           events.EventBusInterface
+	SmartService       SmartServiceInterface
+	FilesystemService  FilesystemServiceInterface
+	ShareService       ShareServiceInterface
+	RecycleBinService  RecycleBinServiceInterface
+	ReplicationService ReplicationServiceInterface
+	HDIdleService      HDIdleServiceInterface  `optional:"true"`
+	ProblemService     ProblemServiceInterface `optional:"true"`
+}
+
+func NewJobService(lc fx.Lifecycle, in JobServiceParams) JobServiceInterface {
+	wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup)
+	if !ok || wg == nil {
+		wg = &sync.WaitGroup{}
+	}
+	s := &JobService{
+		ctx:                in.Ctx,
+		db:                 in.Db,
+		eventBus:           in.EventBus,
+		smartService:       in.SmartService,
+		filesystemService:  in.FilesystemService,
+		shareService:       in.ShareService,
+		recycleBinService:  in.RecycleBinService,
+		replicationService: in.ReplicationService,
+		hdidleService:      in.HDIdleService,
+		problemService:     in.ProblemService,
+		wg:                 wg,
+		now:                time.Now,
+		running:            make(map[uint]bool),
+		next:               make(map[uint]time.Time),
+		smartTests:         make(map[uint]smartTestRun),
+	}
+	s.runners = map[dto.JobType]jobRunner{
+		dto.JobTypeSmartSelfTest:   s.runSmartSelfTest,
+		dto.JobTypeFilesystemCheck: s.runFilesystemCheck,
+		dto.JobTypeRecycleBinPurge: s.runRecycleBinPurge,
+		dto.JobTypeScrub:           s.runScrub,
+		dto.JobTypeSync:            s.runSync,
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.reconcileRuns()
+			if _, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok {
+				s.wg.Go(func() {
+					if err := s.run(); err != nil && !errors.Is(err, context.Canceled) {
+						slog.WarnContext(s.ctx, "JobService run loop stopped with error", "error", err)
+					}
+				})
+			}
+			return nil
+		},
+	})
+	return s
+}
+
+// reconcileRuns marks the runs left running by a crash or a restart as
+// interrupted: nothing is executing them anymore.
+func (s *JobService) reconcileRuns() {
+	finished := s.now()
+	result := s.db.WithContext(s.ctx).Model(&dbom.JobRun{}).
+		Where("status = ?", dto.JobRunStatusRunning).
+		Updates(&dbom.JobRun{Status: dto.JobRunStatusInterrupted, Message: "interrupted by a restart", FinishedAt: &finished})
+	if result.Error != nil {
+		tlog.WarnContext(s.ctx, "Failed to reconcile interrupted job runs", "error", result.Error)
+	} else if result.RowsAffected > 0 {
+		tlog.WarnContext(s.ctx, "Job runs interrupted by a restart", "count", result.RowsAffected)
+	}
+}
+
+func (s *JobService) run() errors.E {
+	for {
+		if err := s.runDueJobs(); err != nil {
+			tlog.DebugContext(s.ctx, "Failed to run scheduled jobs", "error", err)
+		}
+		select {
+		case <-s.ctx.Done():
+			slog.DebugContext(s.ctx, "Run process closed", "err", s.ctx.Err())
+			return errors.WithStack(s.ctx.Err())
+		case <-time.After(jobCheckInterval):
+		}
+	}
+}
+
+// runDueJobs starts the enabled jobs whose next run time has passed. A job
+// seen for the first time is scheduled from now: runs missed while the
+// service was down are not caught up.
+func (s *JobService) runDueJobs() errors.E {
+	jobs, err := gorm.G[dbom.ScheduledJob](s.db).Where(g.ScheduledJob.Enabled.Eq(true)).Find(s.ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list scheduled jobs")
+	}
+	now := s.now()
+	var conv converter.JobToDtoConverterImpl
+	for _, dbJob := range jobs {
+		job := conv.ToDto(dbJob)
+		schedule, errE := parseJobSchedule(job.Schedule)
+		if errE != nil {
+			tlog.WarnContext(s.ctx, "Skipping job with invalid schedule", "job", job.Name, "error", errE)
+			continue
+		}
+		s.mu.Lock()
+		next, known := s.next[job.ID]
+		due := known && !next.IsZero() && !now.Before(next)
+		if !known || due {
+			s.next[job.ID] = schedule.Next(now)
+		}
+		s.mu.Unlock()
+		if !due {
+			continue
+		}
+		if _, errE := s.startRun(job, dto.JobTriggerSchedule); errE != nil && !errors.Is(errE, dto.ErrorJobAlreadyRunning) {
+			tlog.WarnContext(s.ctx, "Unable to start scheduled job", "job", job.Name, "error", errE)
+		}
+	}
+	return nil
+}
+
+func parseJobSchedule(spec string) (*cronexpr.Schedule, errors.E) {
+	schedule, err := cronexpr.Parse(spec)
+	if err != nil {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "schedule", spec, "reason", err.Error())
+	}
+	return schedule, nil
+}
+
+// validateJob checks the schedule, the target and the options of a job.
+func (s *JobService) validateJob(job dto.Job) errors.E {
+	if strings.TrimSpace(job.Name) == "" {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "reason", "job name is required")
+	}
+	if _, ok := s.runners[job.Type]; !ok {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "type", job.Type, "reason", "unknown job type")
+	}
+	if _, err := parseJobSchedule(job.Schedule); err != nil {
+		return err
+	}
+	if strings.TrimSpace(job.Target) == "" {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "type", job.Type, "reason", "job target is required")
+	}
+	switch job.Type {
+	case dto.JobTypeSmartSelfTest:
+		if _, err := jobSmartTestType(job); err != nil {
+			return err
+		}
+	case dto.JobTypeFilesystemCheck:
+		if _, err := jobBoolOption(job, "auto_fix"); err != nil {
+			return err
+		}
+	case dto.JobTypeRecycleBinPurge:
+		if _, err := jobRecycleMaxAge(job); err != nil {
+			return err
+		}
+	case dto.JobTypeSync:
+		if _, err := parseSyncOptions(job.Options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *JobService) loadJob(id uint) (*dbom.ScheduledJob, errors.E) {
+	job, err := gorm.G[dbom.ScheduledJob](s.db).Where(g.ScheduledJob.ID.Eq(id)).First(s.ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.WithDetails(dto.ErrorJobNotFound, "id", id)
+		}
+		return nil, errors.Wrapf(err, "failed to get job %d", id)
+	}
+	return &job, nil
+}
+
+// toDto converts a stored job adding its next and last run.
+func (s *JobService) toDto(dbJob dbom.ScheduledJob) (dto.Job, errors.E) {
+	var conv converter.JobToDtoConverterImpl
+	job := conv.ToDto(dbJob)
+	s.mu.Lock()
+	if next, ok := s.next[job.ID]; ok && job.Enabled && !next.IsZero() {
+		job.NextRunAt = &next
+	}
+	s.mu.Unlock()
+	runs, err := gorm.G[dbom.JobRun](s.db).Where(g.JobRun.JobID.Eq(job.ID)).Order(g.JobRun.ID.Desc()).Limit(1).Find(s.ctx)
+	if err != nil {
+		return job, errors.Wrapf(err, "failed to get last run of job %s", job.Name)
+	}
+	if len(runs) > 0 {
+		last := conv.RunToDto(runs[0])
+		last.JobName = job.Name
+		job.LastRun = &last
+	}
+	return job, nil
+}
+
+func (s *JobService) ListJobs() ([]dto.Job, errors.E) {
+	dbJobs, err := gorm.G[dbom.ScheduledJob](s.db).Order(g.ScheduledJob.Name.Asc()).Find(s.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list jobs")
+	}
+	jobs := make([]dto.Job, 0, len(dbJobs))
+	for _, dbJob := range dbJobs {
+		job, errE := s.toDto(dbJob)
+		if errE != nil {
+			return nil, errE
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *JobService) GetJob(id uint) (*dto.Job, errors.E) {
+	dbJob, errE := s.loadJob(id)
+	if errE != nil {
+		return nil, errE
+	}
+	job, errE := s.toDto(*dbJob)
+	if errE != nil {
+		return nil, errE
+	}
+	return &job, nil
+}
+
+// reschedule recomputes the next run of a job after it changed.
+func (s *JobService) reschedule(job dto.Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !job.Enabled {
+		delete(s.next, job.ID)
+		return
+	}
+	if schedule, err := parseJobSchedule(job.Schedule); err == nil {
+		s.next[job.ID] = schedule.Next(s.now())
+	}
+}
+
+func (s *JobService) CreateJob(job dto.Job) (*dto.Job, errors.E) {
+	if err := s.validateJob(job); err != nil {
+		return nil, err
+	}
+	var conv converter.JobToDtoConverterImpl
+	dbJob := conv.ToDbom(job)
+	dbJob.ID = 0
+	if err := s.db.WithContext(s.ctx).Create(&dbJob).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errors.WithDetails(dto.ErrorJobAlreadyExists, "name", job.Name)
+		}
+		return nil, errors.Wrapf(err, "failed to create job %s", job.Name)
+	}
+	job.ID = dbJob.ID
+	s.reschedule(job)
+	tlog.InfoContext(s.ctx, "Scheduled job created", "job", job.Name, "type", job.Type, "schedule", job.Schedule)
+	return s.GetJob(dbJob.ID)
+}
+
+func (s *JobService) UpdateJob(id uint, job dto.Job) (*dto.Job, errors.E) {
+	if _, errE := s.loadJob(id); errE != nil {
+		return nil, errE
+	}
+	if err := s.validateJob(job); err != nil {
+		return nil, err
+	}
+	var conv converter.JobToDtoConverterImpl
+	dbJob := conv.ToDbom(job)
+	dbJob.ID = id
+	err := s.db.WithContext(s.ctx).Model(&dbJob).
+		Select("Name", "Type", "Schedule", "Target", "Options", "Enabled").
+		Updates(&dbJob).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errors.WithDetails(dto.ErrorJobAlreadyExists, "name", job.Name)
+		}
+		return nil, errors.Wrapf(err, "failed to update job %d", id)
+	}
+	job.ID = id
+	s.reschedule(job)
+	return s.GetJob(id)
+}
+
+func (s *JobService) DeleteJob(id uint) errors.E {
+	dbJob, errE := s.loadJob(id)
+	if errE != nil {
+		return errE
+	}
+	errF := s.db.WithContext(s.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("job_id = ?", id).Delete(&dbom.JobRun{}).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete history of job %s", dbJob.Name)
+		}
+		if err := tx.Delete(dbJob).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete job %s", dbJob.Name)
+		}
+		return nil
+	})
+	if errF != nil {
+		return errors.WithStack(errF)
+	}
+	s.mu.Lock()
+	delete(s.next, id)
+	s.mu.Unlock()
+	tlog.InfoContext(s.ctx, "Scheduled job deleted", "job", dbJob.Name)
+	return nil
+}
+
+func (s *JobService) RunJob(id uint) (*dto.JobRun, errors.E) {
+	dbJob, errE := s.loadJob(id)
+	if errE != nil {
+		return nil, errE
+	}
+	var conv converter.JobToDtoConverterImpl
+	return s.startRun(conv.ToDto(*dbJob), dto.JobTriggerManual)
+}
+
+func (s *JobService) ListJobRuns(id uint) ([]dto.JobRun, errors.E) {
+	dbJob, errE := s.loadJob(id)
+	if errE != nil {
+		return nil, errE
+	}
+	dbRuns, err := gorm.G[dbom.JobRun](s.db).Where(g.JobRun.JobID.Eq(id)).Order(g.JobRun.ID.Desc()).Find(s.ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list runs of job %s", dbJob.Name)
+	}
+	var conv converter.JobToDtoConverterImpl
+	runs := make([]dto.JobRun, 0, len(dbRuns))
+	for _, dbRun := range dbRuns {
+		run := conv.RunToDto(dbRun)
+		run.JobName = dbJob.Name
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// startRun records a new run and executes it in the background. A job never
+// runs twice at the same time: a manual run fails with
+// dto.ErrorJobAlreadyRunning, a scheduled one is recorded as skipped. The
+// lock only guards the running set: the run is recorded and announced
+// without it, as event subscribers may call back into the service.
+func (s *JobService) startRun(job dto.Job, trigger dto.JobTrigger) (*dto.JobRun, errors.E) {
+	runner, ok := s.runners[job.Type]
+	if !ok {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "type", job.Type, "reason", "unknown job type")
+	}
+
+	s.mu.Lock()
+	skipped := s.running[job.ID]
+	if skipped && trigger == dto.JobTriggerManual {
+		s.mu.Unlock()
+		return nil, errors.WithDetails(dto.ErrorJobAlreadyRunning, "job", job.Name)
+	}
+	if !skipped {
+		s.running[job.ID] = true
+	}
+	s.mu.Unlock()
+
+	now := s.now()
+	dbRun := dbom.JobRun{JobID: job.ID, Trigger: trigger, Status: dto.JobRunStatusRunning, StartedAt: now}
+	if skipped {
+		dbRun.Status = dto.JobRunStatusSkipped
+		dbRun.Message = "previous run still in progress"
+		dbRun.FinishedAt = &now
+	}
+	if err := s.db.WithContext(s.ctx).Create(&dbRun).Error; err != nil {
+		if !skipped {
+			s.mu.Lock()
+			delete(s.running, job.ID)
+			s.mu.Unlock()
+		}
+		return nil, errors.Wrapf(err, "failed to record run of job %s", job.Name)
+	}
+	var conv converter.JobToDtoConverterImpl
+	run := conv.RunToDto(dbRun)
+	run.JobName = job.Name
+	if skipped {
+		tlog.WarnContext(s.ctx, "Scheduled job skipped, previous run still in progress", "job", job.Name)
+		s.emitRun(events.EventTypes.STOP, run)
+		return nil, errors.WithDetails(dto.ErrorJobAlreadyRunning, "job", job.Name)
+	}
+
+	s.emitRun(events.EventTypes.START, run)
+	tlog.InfoContext(s.ctx, "Job run started", "job", job.Name, "trigger", trigger)
+	s.wg.Go(func() {
+		s.execute(job, run, runner)
+	})
+	return &run, nil
+}
+
+func (s *JobService) execute(job dto.Job, run dto.JobRun, runner jobRunner) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.ID)
+		s.mu.Unlock()
+	}()
+
+	message, err := runner(s.ctx, job, run, func(percent int) {
+		progress := run
+		progress.Progress = percent
+		s.emitRun(events.EventTypes.UPDATE, progress)
+	})
+	finished := s.now()
+	run.FinishedAt = &finished
+	run.Status = dto.JobRunStatusSuccess
+	run.Message = message
+	if err != nil {
+		run.Status = dto.JobRunStatusFailure
+		run.Message = err.Error()
+		tlog.WarnContext(s.ctx, "Job run failed", "job", job.Name, "error", err)
+	} else {
+		tlog.InfoContext(s.ctx, "Job run completed", "job", job.Name, "message", message)
+	}
+
+	updates := dbom.JobRun{Status: run.Status, Message: run.Message, FinishedAt: run.FinishedAt}
+	if err := s.db.WithContext(s.ctx).Model(&dbom.JobRun{ID: run.ID}).Updates(&updates).Error; err != nil {
+		tlog.WarnContext(s.ctx, "Failed to record job run result", "job", job.Name, "error", err)
+	}
+	s.pruneRuns(job)
+	s.emitRun(events.EventTypes.STOP, run)
+}
+
+// pruneRuns keeps only the last jobHistoryLimit runs of a job.
+func (s *JobService) pruneRuns(job dto.Job) {
+	err := s.db.WithContext(s.ctx).
+		Where("job_id = ? AND id NOT IN (?)", job.ID,
+			s.db.Model(&dbom.JobRun{}).Select("id").Where("job_id = ?", job.ID).Order("id DESC").Limit(jobHistoryLimit)).
+		Delete(&dbom.JobRun{}).Error
+	if err != nil {
+		tlog.WarnContext(s.ctx, "Failed to prune job history", "job", job.Name, "error", err)
+	}
+}
+
+func (s *JobService) emitRun(eventType events.EventType, run dto.JobRun) {
+	s.eventBus.EmitJob(events.JobEvent{
+		Event: events.Event{Type: eventType},
+		Run:   &run,
+	})
+}
+
+func jobSmartTestType(job dto.Job) (dto.SmartTestType, errors.E) {
+	value, ok := job.Options["test_type"]
+	if !ok || value == "" {
+		return dto.SmartTestTypes.SMARTTESTTYPESHORT, nil
+	}
+	testType, err := dto.ParseSmartTestType(value)
+	if err != nil || !testType.IsValid() {
+		return testType, errors.WithDetails(dto.ErrorInvalidParameter, "test_type", value)
+	}
+	return testType, nil
+}
+
+func jobBoolOption(job dto.Job, name string) (bool, errors.E) {
+	value, ok := job.Options[name]
+	if !ok || value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.WithDetails(dto.ErrorInvalidParameter, name, value)
+	}
+	return enabled, nil
+}
+
+func jobRecycleMaxAge(job dto.Job) (time.Duration, errors.E) {
+	days := 0
+	if value, ok := job.Options["max_age_days"]; ok && value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return 0, errors.WithDetails(dto.ErrorInvalidParameter, "max_age_days", value)
+		}
+		days = parsed
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// runFilesystemCheck starts a check and waits for its terminal task event.
+func (s *JobService) runFilesystemCheck(ctx context.Context, job dto.Job, _ dto.JobRun, progress func(int)) (string, errors.E) {
+	autoFix, errE := jobBoolOption(job, "auto_fix")
+	if errE != nil {
+		return "", errE
+	}
+	fsType, errE := s.filesystemService.FsTypeFromDevice(job.Target)
+	if errE != nil {
+		return "", errE
+	}
+
+	done := make(chan dto.FilesystemTask, 1)
+	unsubscribe := s.eventBus.OnFilesystemTask(func(_ context.Context, event events.FilesystemTaskEvent) errors.E {
+		task := event.Task
+		if task == nil || task.Device != job.Target || task.Operation != "check" {
+			return nil
+		}
+		switch task.Status {
+		case "success", "failure", "canceled":
+			select {
+			case done <- *task:
+			default:
+			}
+		default:
+			if task.Progress > 0 && task.Progress <= 100 {
+				progress(task.Progress)
+			}
+		}
+		return nil
+	})
+	defer unsubscribe()
+
+	if _, err := s.filesystemService.CheckPartition(ctx, job.Target, fsType, dto.CheckOptions{AutoFix: autoFix}); err != nil {
+		return "", err
+	}
+	select {
+	case <-ctx.Done():
+		return "", errors.WithStack(ctx.Err())
+	case task := <-done:
+		if task.Status != "success" {
+			return "", errors.Errorf("%s: %s", task.Message, task.Error)
+		}
+		return task.Message, nil
+	}
+}
+
+// jobSharePath resolves the mounted path of the share a job targets.
+func (s *JobService) jobSharePath(job dto.Job) (*dto.SharedResource, string, errors.E) {
+	share, errE := s.shareService.GetShare(job.Target)
+	if errE != nil {
+		return nil, "", errE
+	}
+	path, errE := sharePath(*share)
+	if errE != nil {
+		return nil, "", errE
+	}
+	return share, path, nil
+}
+
+// runRecycleBinPurge applies the retention policy of a share recycle bin.
+// max_age_days overrides the max age of the policy; without either, entries
+// older than defaultRecycleMaxAgeDays are removed.
+func (s *JobService) runRecycleBinPurge(_ context.Context, job dto.Job, _ dto.JobRun, _ func(int)) (string, errors.E) {
+	maxAge, errE := jobRecycleMaxAge(job)
+	if errE != nil {
+		return "", errE
+	}
+	share, errE := s.shareService.GetShare(job.Target)
+	if errE != nil {
+		return "", errE
+	}
+	if maxAge == 0 && (share.RecycleBinPolicy == nil || share.RecycleBinPolicy.MaxAgeDays == 0) {
+		maxAge = defaultRecycleMaxAgeDays * 24 * time.Hour
+	}
+	result, errE := s.recycleBinService.PurgeRecycleBin(job.Target, maxAge)
+	if errE != nil {
+		return "", errE
+	}
+	return fmt.Sprintf("removed %d files (%d bytes) from the recycle bin of %s", result.RemovedFiles, result.FreedBytes, job.Target), nil
+}
+
+// runScrub scrubs the checksummed volume behind a share.
+func (s *JobService) runScrub(ctx context.Context, job dto.Job, _ dto.JobRun, _ func(int)) (string, errors.E) {
+	share, path, errE := s.jobSharePath(job)
+	if errE != nil {
+		return "", errE
+	}
+	if share.MountPointData.FSType == nil {
+		return "", errors.WithDetails(dto.ErrorUnsupportedFilesystem, "share", share.Name)
+	}
+	adapter, errE := s.filesystemService.GetAdapter(*share.MountPointData.FSType)
+	if errE != nil {
+		return "", errE
+	}
+	scrub, ok := filesystem.AsScrubAdapter(adapter)
+	if !ok {
+		return "", errors.WithDetails(dto.ErrorUnsupportedFilesystem, "share", share.Name, "fstype", *share.MountPointData.FSType)
+	}
+	output, errE := scrub.Scrub(ctx, path)
+	if errE != nil {
+		return "", errE
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// runSync replicates the target share to the destination of the job.
+func (s *JobService) runSync(ctx context.Context, job dto.Job, _ dto.JobRun, _ func(int)) (string, errors.E) {
+	options, errE := parseSyncOptions(job.Options)
+	if errE != nil {
+		return "", errE
+	}
+	return s.replicationService.Sync(ctx, job.Name, job.Target, options)
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+type JobServiceSuite struct {
+	suite.Suite
+	app          *fxtest.App
+	db           *gorm.DB
+	eventBus     events.EventBusInterface
+	shareService ShareServiceInterface
+	jobService   *JobService
+	now          time.Time
+	shareRoot    string
+
+	mu     sync.Mutex
+	events []dto.JobRun
+}
+
+func TestJobServiceSuite(t *testing.T) {
+	suite.Run(t, new(JobServiceSuite))
+}
+
+func (suite *JobServiceSuite) SetupTest() {
+	os.Setenv("SRAT_MOCK", "true")
+	fileChangeTime = func(info os.FileInfo) time.Time { return info.ModTime() }
+	var jobService JobServiceInterface
+	var recycleBinService RecycleBinServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+				}
+			},
+			dbom.NewDB,
+			events.NewEventBus,
+			mock.Mock[SmartServiceInterface],
+			mock.Mock[FilesystemServiceInterface],
+			mock.Mock[ShareServiceInterface],
+			mock.Mock[ReplicationServiceInterface],
+			NewRecycleBinService,
+			NewJobService,
+		),
+		fx.Populate(&suite.db),
+		fx.Populate(&suite.eventBus),
+		fx.Populate(&suite.shareService),
+		fx.Populate(&jobService),
+		fx.Populate(&recycleBinService),
+	)
+	suite.app.RequireStart()
+
+	suite.Require().NoError(suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&dbom.JobRun{}).Error)
+	suite.Require().NoError(suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&dbom.ScheduledJob{}).Error)
+
+	suite.jobService = jobService.(*JobService)
+	suite.now = time.Date(2026, 1, 30, 10, 17, 0, 0, time.UTC)
+	suite.jobService.now = func() time.Time { return suite.now }
+	recycleBinService.(*RecycleBinService).now = suite.jobService.now
+
+	suite.shareRoot = suite.T().TempDir()
+	share := dto.SharedResource{
+		Name:           "data",
+		MountPointData: &dto.MountPointData{Path: suite.shareRoot, IsMounted: true},
+	}
+	mock.When(suite.shareService.GetShare(mock.Exact("data"))).ThenReturn(&share, nil)
+
+	suite.events = nil
+	suite.eventBus.OnJob(func(_ context.Context, event events.JobEvent) errors.E {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		suite.events = append(suite.events, *event.Run)
+		return nil
+	})
+}
+
+func (suite *JobServiceSuite) TearDownTest() {
+	suite.jobService.wg.Wait()
+	suite.app.RequireStop()
+	fileChangeTime = osutil.ChangeTime
+}
+
+func purgeJob(schedule string) dto.Job {
+	return dto.Job{
+		Name:     "purge data",
+		Type:     dto.JobTypeRecycleBinPurge,
+		Schedule: schedule,
+		Target:   "data",
+		Options:  map[string]string{"max_age_days": "7"},
+		Enabled:  true,
+	}
+}
+
+// waitRuns waits for the background runs to end and returns the history.
+func (suite *JobServiceSuite) waitRuns(id uint) []dto.JobRun {
+	suite.jobService.wg.Wait()
+	runs, err := suite.jobService.ListJobRuns(id)
+	suite.Require().NoError(err)
+	return runs
+}
+
+func (suite *JobServiceSuite) TestCreateJob_Validation() {
+	cases := []dto.Job{
+		purgeJob("every day"),
+		func() dto.Job { j := purgeJob("@daily"); j.Target = ""; return j }(),
+		func() dto.Job { j := purgeJob("@daily"); j.Type = "defrag"; return j }(),
+		func() dto.Job { j := purgeJob("@daily"); j.Options["max_age_days"] = "-1"; return j }(),
+		{Name: "smart", Type: dto.JobTypeSmartSelfTest, Schedule: "@daily", Target: "disk", Options: map[string]string{"test_type": "quick"}},
+		{Name: "sync", Type: dto.JobTypeSync, Schedule: "@daily", Target: "data", Options: map[string]string{"destination_type": "path", "destination": "backup"}},
+	}
+	for _, job := range cases {
+		_, err := suite.jobService.CreateJob(job)
+		suite.ErrorIs(err, dto.ErrorInvalidParameter, "job %+v", job)
+	}
+}
+
+func (suite *JobServiceSuite) TestCreateJob_DuplicateName() {
+	created, err := suite.jobService.CreateJob(purgeJob("@daily"))
+	suite.Require().NoError(err)
+	suite.Equal(time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC), *created.NextRunAt)
+
+	_, err = suite.jobService.CreateJob(purgeJob("@hourly"))
+	suite.ErrorIs(err, dto.ErrorJobAlreadyExists)
+}
+
+func (suite *JobServiceSuite) TestRunJob_RecycleBinPurge() {
+	recycle := filepath.Join(suite.shareRoot, ".recycle", "alice", "docs")
+	suite.Require().NoError(os.MkdirAll(recycle, 0o755))
+	oldFile := filepath.Join(recycle, "old.txt")
+	newFile := filepath.Join(suite.shareRoot, ".recycle", "alice", "new.txt")
+	suite.Require().NoError(os.WriteFile(oldFile, []byte("x"), 0o644))
+	suite.Require().NoError(os.WriteFile(newFile, []byte("x"), 0o644))
+	old := suite.now.Add(-8 * 24 * time.Hour)
+	suite.Require().NoError(os.Chtimes(oldFile, old, old))
+	suite.Require().NoError(os.Chtimes(newFile, suite.now, suite.now))
+
+	job, err := suite.jobService.CreateJob(purgeJob("@daily"))
+	suite.Require().NoError(err)
+	run, err := suite.jobService.RunJob(job.ID)
+	suite.Require().NoError(err)
+	suite.Equal(dto.JobRunStatusRunning, run.Status)
+	suite.Equal(dto.JobTriggerManual, run.Trigger)
+
+	runs := suite.waitRuns(job.ID)
+	suite.Require().Len(runs, 1)
+	suite.Equal(dto.JobRunStatusSuccess, runs[0].Status, runs[0].Message)
+	suite.Contains(runs[0].Message, "removed 1 files")
+	suite.NoFileExists(oldFile)
+	suite.NoDirExists(recycle, "emptied directories are removed")
+	suite.FileExists(newFile)
+
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	suite.Require().Len(suite.events, 2)
+	suite.Equal(dto.JobRunStatusRunning, suite.events[0].Status)
+	suite.Equal(dto.JobRunStatusSuccess, suite.events[1].Status)
+
+	got, err := suite.jobService.GetJob(job.ID)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(got.LastRun)
+	suite.Equal(dto.JobRunStatusSuccess, got.LastRun.Status)
+}
+
+func (suite *JobServiceSuite) TestRunJob_FailureIsRecorded() {
+	mock.When(suite.shareService.GetShare(mock.Exact("gone"))).ThenReturn(nil, errors.WithStack(dto.ErrorShareNotFound))
+	job := purgeJob("@daily")
+	job.Target = "gone"
+	created, err := suite.jobService.CreateJob(job)
+	suite.Require().NoError(err)
+
+	_, err = suite.jobService.RunJob(created.ID)
+	suite.Require().NoError(err)
+
+	runs := suite.waitRuns(created.ID)
+	suite.Require().Len(runs, 1)
+	suite.Equal(dto.JobRunStatusFailure, runs[0].Status)
+	suite.NotNil(runs[0].FinishedAt)
+}
+
+func (suite *JobServiceSuite) TestRunJob_NoOverlap() {
+	job, err := suite.jobService.CreateJob(purgeJob("@hourly"))
+	suite.Require().NoError(err)
+	suite.jobService.running[job.ID] = true
+
+	_, err = suite.jobService.RunJob(job.ID)
+	suite.ErrorIs(err, dto.ErrorJobAlreadyRunning)
+
+	suite.now = time.Date(2026, 1, 30, 11, 0, 0, 0, time.UTC)
+	suite.Require().NoError(suite.jobService.runDueJobs())
+	runs := suite.waitRuns(job.ID)
+	suite.Require().Len(runs, 1)
+	suite.Equal(dto.JobRunStatusSkipped, runs[0].Status)
+	suite.Equal(dto.JobTriggerSchedule, runs[0].Trigger)
+	delete(suite.jobService.running, job.ID)
+}
+
+func (suite *JobServiceSuite) TestRunDueJobs_FollowsSchedule() {
+	job, err := suite.jobService.CreateJob(purgeJob("@hourly"))
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.jobService.runDueJobs())
+	suite.Empty(suite.waitRuns(job.ID), "not due before 11:00")
+
+	suite.now = time.Date(2026, 1, 30, 11, 0, 20, 0, time.UTC)
+	suite.Require().NoError(suite.jobService.runDueJobs())
+	suite.Require().NoError(suite.jobService.runDueJobs())
+	suite.Len(suite.waitRuns(job.ID), 1, "one run per activation")
+
+	got, err := suite.jobService.GetJob(job.ID)
+	suite.Require().NoError(err)
+	suite.Equal(time.Date(2026, 1, 30, 12, 0, 0, 0, time.UTC), *got.NextRunAt)
+
+	job.Enabled = false
+	_, err = suite.jobService.UpdateJob(job.ID, *job)
+	suite.Require().NoError(err)
+	suite.now = time.Date(2026, 1, 30, 12, 0, 0, 0, time.UTC)
+	suite.Require().NoError(suite.jobService.runDueJobs())
+	suite.Len(suite.waitRuns(job.ID), 1, "disabled jobs do not run")
+}
+
+func (suite *JobServiceSuite) TestDeleteJob() {
+	job, err := suite.jobService.CreateJob(purgeJob("@daily"))
+	suite.Require().NoError(err)
+	_, err = suite.jobService.RunJob(job.ID)
+	suite.Require().NoError(err)
+	suite.waitRuns(job.ID)
+
+	suite.Require().NoError(suite.jobService.DeleteJob(job.ID))
+	_, err = suite.jobService.GetJob(job.ID)
+	suite.ErrorIs(err, dto.ErrorJobNotFound)
+	var count int64
+	suite.Require().NoError(suite.db.Model(&dbom.JobRun{}).Where("job_id = ?", job.ID).Count(&count).Error)
+	suite.Zero(count)
+}
+
+func (suite *JobServiceSuite) TestRunJob_SubscriberCanCallBack() {
+	job, err := suite.jobService.CreateJob(purgeJob("@daily"))
+	suite.Require().NoError(err)
+	called := make(chan struct{}, 4)
+	suite.eventBus.OnJob(func(_ context.Context, event events.JobEvent) errors.E {
+		_, errE := suite.jobService.GetJob(event.Run.JobID)
+		suite.NoError(errE)
+		called <- struct{}{}
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := suite.jobService.RunJob(job.ID)
+		suite.NoError(err)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		suite.FailNow("RunJob deadlocked with a subscriber calling back into the service")
+	}
+	suite.waitRuns(job.ID)
+	suite.NotEmpty(called)
+}
+
+func (suite *JobServiceSuite) TestReconcileRuns_MarksRunningAsInterrupted() {
+	job, err := suite.jobService.CreateJob(purgeJob("@daily"))
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.db.Create(&dbom.JobRun{JobID: job.ID, Trigger: dto.JobTriggerSchedule, Status: dto.JobRunStatusRunning, StartedAt: suite.now.Add(-time.Hour)}).Error)
+
+	suite.jobService.reconcileRuns()
+
+	runs := suite.waitRuns(job.ID)
+	suite.Require().Len(runs, 1)
+	suite.Equal(dto.JobRunStatusInterrupted, runs[0].Status)
+	suite.Require().NotNil(runs[0].FinishedAt)
+	suite.Equal(suite.now, runs[0].FinishedAt.UTC())
+}
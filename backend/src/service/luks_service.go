@@ -0,0 +1,557 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// LuksCommandID identifies the cryptsetup executions.
+const LuksCommandID = "luks"
+
+// luksMapperPrefix prefixes the device mapper name of an opened container,
+// which is also the id of the partition exposing it.
+const luksMapperPrefix = "luks-"
+
+// cryptsetupBadPassphrase is the exit code of cryptsetup open when no key
+// slot matches the passphrase.
+const cryptsetupBadPassphrase = 2
+
+type LuksServiceInterface interface {
+	// Unlock opens the LUKS container of a partition and exposes the opened
+	// device as a partition of the same disk, mountable as any other. The
+	// passphrase is stored as a keyfile only when storeKeyfile is set.
+	Unlock(partitionID string, passphrase string, storeKeyfile bool) (*dto.Partition, errors.E)
+	// Lock unmounts the volumes of an unlocked LUKS container and closes it.
+	Lock(partitionID string) errors.E
+	// RemoveKeyfile deletes the keyfile unlocking a LUKS container at startup.
+	RemoveKeyfile(partitionID string) errors.E
+}
+
+// luksMapping is an opened LUKS container.
+type luksMapping struct {
+	diskID   string
+	parentID string
+	name     string // device mapper name, also the id of the opened partition
+}
+
+type LuksService struct {
+	ctx           context.Context
+	state         *dto.ContextState
+	db            *gorm.DB
+	disks         *dto.DiskMap
+	eventBus      events.EventBusInterface
+	fsService     FilesystemServiceInterface
+	volumeService VolumeServiceInterface
+	executor      commandexec.Executor
+	mapperDir     string
+
+	mu        sync.Mutex
+	open      map[string]*luksMapping // container partition id -> mapping
+	mounted   map[string]string       // mount path -> container partition id
+	attempted map[string]bool         // containers the keyfile unlock was tried on
+}
+
+type LuksServiceParams struct {
+	fx.In
+	Ctx               context.Context
+	State             *dto.ContextState
+	Db                *gorm.DB
+	Disks             *dto.DiskMap
+	EventBus          events.EventBusInterface
+	FilesystemService FilesystemServiceInterface
+	VolumeService     VolumeServiceInterface
+	Executor          commandexec.Executor
+}
+
+func NewLuksService(lc fx.Lifecycle, in LuksServiceParams) LuksServiceInterface {
+	s := &LuksService{
+		ctx:           in.Ctx,
+		state:         in.State,
+		db:            in.Db,
+		disks:         in.Disks,
+		eventBus:      in.EventBus,
+		fsService:     in.FilesystemService,
+		volumeService: in.VolumeService,
+		executor:      in.Executor,
+		mapperDir:     "/dev/mapper",
+		open:          make(map[string]*luksMapping),
+		mounted:       make(map[string]string),
+		attempted:     make(map[string]bool),
+	}
+
+	// Subscribed here rather than on start: the partitions found by the
+	// volume service on start are the ones unlocked with their keyfile.
+	unsubscribe := []func(){
+		in.EventBus.OnPartition(s.handlePartitionEvent),
+		in.EventBus.OnMountPoint(s.handleMountPointEvent),
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			for _, unsub := range unsubscribe {
+				unsub()
+			}
+			return nil
+		},
+	})
+
+	return s
+}
+
+func (s *LuksService) Unlock(partitionID string, passphrase string, storeKeyfile bool) (*dto.Partition, errors.E) {
+	if s.state.ProtectedMode {
+		return nil, errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "Unlock", "reason", "unlocking is not permitted when ProtectedMode is enabled")
+	}
+	if passphrase == "" {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "reason", "the passphrase is empty")
+	}
+	part, diskID, errE := s.container(partitionID)
+	if errE != nil {
+		return nil, errE
+	}
+
+	m := newLuksMapping(diskID, part)
+	if errE := s.reserve(m); errE != nil {
+		return nil, errE
+	}
+	device := containerDevice(part)
+	snapshot, err := s.executor.ExecuteWithInputQuiet(s.ctx, LuksCommandID, "Unlock "+partitionID,
+		passphrase, "cryptsetup", "open", "--type", "luks", "--key-file=-", device, m.name)
+	if err != nil {
+		s.release(m)
+		if snapshot.ExitCode == cryptsetupBadPassphrase {
+			return nil, errors.WithDetails(dto.ErrorInvalidParameter,
+				"PartitionId", partitionID, "reason", "no key is available with this passphrase")
+		}
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation,
+			"PartitionId", partitionID, "reason", cryptsetupReason(snapshot, err))
+	}
+
+	if storeKeyfile {
+		if err := s.writeKeyfile(m, passphrase); err != nil {
+			if errE := s.close(m); errE != nil {
+				slog.WarnContext(s.ctx, "Failed to close LUKS container after keyfile failure", "partition_id", partitionID, "err", errE)
+			}
+			return nil, errors.WithDetails(err, "PartitionId", partitionID, "reason", "the keyfile could not be stored")
+		}
+	}
+
+	slog.InfoContext(s.ctx, "Unlocked LUKS container", "partition_id", partitionID, "mapper", m.name, "keyfile", storeKeyfile)
+	return s.attach(m, part), nil
+}
+
+func (s *LuksService) Lock(partitionID string) errors.E {
+	s.mu.Lock()
+	m := s.open[partitionID]
+	s.mu.Unlock()
+	if m == nil {
+		if _, _, errE := s.container(partitionID); errE != nil {
+			return errE
+		}
+		return errors.WithDetails(dto.ErrorInvalidStateForOperation,
+			"PartitionId", partitionID, "reason", "the LUKS container is not unlocked")
+	}
+
+	for _, mp := range s.mountPoints(m) {
+		if !mp.IsMounted {
+			continue
+		}
+		// Unmounting the last volume closes the container already.
+		if errE := s.volumeService.UnmountVolume(mp.Path, false); errE != nil {
+			return errors.WithDetails(errE, "PartitionId", partitionID, "Path", mp.Path,
+				"reason", "the volume of the LUKS container could not be unmounted")
+		}
+	}
+	return s.close(m)
+}
+
+func (s *LuksService) RemoveKeyfile(partitionID string) errors.E {
+	part, diskID, errE := s.container(partitionID)
+	if errE != nil {
+		return errE
+	}
+	m := newLuksMapping(diskID, part)
+	if err := os.Remove(s.keyfilePath(m)); err != nil {
+		if os.IsNotExist(err) {
+			return errors.WithDetails(dto.ErrorNotFound, "PartitionId", partitionID, "reason", "no keyfile is stored")
+		}
+		return errors.WithDetails(err, "PartitionId", partitionID)
+	}
+	slog.InfoContext(s.ctx, "Removed LUKS keyfile", "partition_id", partitionID)
+	if disk := s.updateEncryption(diskID, partitionID); disk != nil {
+		s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.UPDATE}, Disk: disk})
+	}
+	return nil
+}
+
+// handlePartitionEvent follows the LUKS containers found by the volume
+// service. A hardware refresh replaces the partitions of a disk, so the one of
+// an opened container is added back; a locked container is unlocked with its
+// keyfile once, when its volume is mounted at startup.
+func (s *LuksService) handlePartitionEvent(ctx context.Context, e events.PartitionEvent) errors.E {
+	if e.Type != events.EventTypes.ADD && e.Type != events.EventTypes.UPDATE {
+		return nil
+	}
+	part := e.Partition
+	if part == nil || part.Id == nil || part.ParentId != nil || !isLuksPartition(part) {
+		return nil
+	}
+	diskID := ""
+	if part.DiskId != nil {
+		diskID = *part.DiskId
+	} else if e.Disk != nil && e.Disk.Id != nil {
+		diskID = *e.Disk.Id
+	}
+	if diskID == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	m := s.open[*part.Id]
+	attempted := s.attempted[*part.Id]
+	s.attempted[*part.Id] = true
+	if m == nil {
+		// Opened before a restart of the addon.
+		candidate := newLuksMapping(diskID, part)
+		if _, err := os.Stat(filepath.Join(s.mapperDir, candidate.name)); err == nil {
+			m = candidate
+			s.open[*part.Id] = m
+		}
+	}
+	s.mu.Unlock()
+
+	if m != nil {
+		tlog.TraceContext(ctx, "Adding back the partition of an unlocked LUKS container", "partition_id", *part.Id, "mapper", m.name)
+		s.attach(m, part)
+		return nil
+	}
+
+	m = newLuksMapping(diskID, part)
+	if !attempted && s.hasKeyfile(m) && s.isToMountAtStartup(m.name) {
+		if errE := s.unlockWithKeyfile(m, part); errE != nil {
+			slog.ErrorContext(ctx, "Failed to unlock LUKS container with its keyfile", "partition_id", *part.Id, "err", errE)
+		} else {
+			return nil
+		}
+	}
+	s.updateEncryption(diskID, *part.Id)
+	return nil
+}
+
+// handleMountPointEvent closes a LUKS container when its last mounted volume
+// is unmounted.
+func (s *LuksService) handleMountPointEvent(ctx context.Context, e events.MountPointEvent) errors.E {
+	mp := e.MountPoint
+	if mp == nil || !strings.HasPrefix(mp.DeviceId, luksMapperPrefix) {
+		return nil
+	}
+
+	s.mu.Lock()
+	var m *luksMapping
+	for _, candidate := range s.open {
+		if candidate.name == mp.DeviceId {
+			m = candidate
+			break
+		}
+	}
+	if m == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	if mp.IsMounted {
+		s.mounted[mp.Path] = m.parentID
+		s.mu.Unlock()
+		return nil
+	}
+	if _, ok := s.mounted[mp.Path]; !ok {
+		// Never mounted, e.g. about to be mounted at startup.
+		s.mu.Unlock()
+		return nil
+	}
+	if mounted, _ := osutil.IsMounted(mp.Path); mounted {
+		// Mounted again by an earlier handler of the same event.
+		s.mu.Unlock()
+		return nil
+	}
+	delete(s.mounted, mp.Path)
+	for _, parentID := range s.mounted {
+		if parentID == m.parentID {
+			s.mu.Unlock()
+			return nil
+		}
+	}
+	s.mu.Unlock()
+
+	slog.InfoContext(ctx, "Closing LUKS container after its volume was unmounted", "partition_id", m.parentID, "path", mp.Path)
+	if errE := s.close(m); errE != nil {
+		slog.WarnContext(ctx, "Failed to close LUKS container", "partition_id", m.parentID, "err", errE)
+	}
+	return nil
+}
+
+func (s *LuksService) unlockWithKeyfile(m *luksMapping, part *dto.Partition) errors.E {
+	if errE := s.reserve(m); errE != nil {
+		return errE
+	}
+	snapshot, err := s.executor.ExecuteQuiet(s.ctx, LuksCommandID, "Unlock "+m.parentID,
+		"cryptsetup", "open", "--type", "luks", "--key-file", s.keyfilePath(m), containerDevice(part), m.name)
+	if err != nil {
+		s.release(m)
+		return errors.WithDetails(dto.ErrorInvalidStateForOperation,
+			"PartitionId", m.parentID, "reason", cryptsetupReason(snapshot, err))
+	}
+	slog.InfoContext(s.ctx, "Unlocked LUKS container with its keyfile", "partition_id", m.parentID, "mapper", m.name)
+	s.attach(m, part)
+	return nil
+}
+
+// reserve records m as opened, failing when the container already is.
+func (s *LuksService) reserve(m *luksMapping) errors.E {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.open[m.parentID]; ok {
+		return errors.WithDetails(dto.ErrorInvalidStateForOperation,
+			"PartitionId", m.parentID, "reason", "the LUKS container is already unlocked")
+	}
+	s.open[m.parentID] = m
+	return nil
+}
+
+func (s *LuksService) release(m *luksMapping) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open[m.parentID] == m {
+		delete(s.open, m.parentID)
+	}
+}
+
+// close closes the container of m and removes its partition. A container
+// closed in the meantime is left alone.
+func (s *LuksService) close(m *luksMapping) errors.E {
+	s.mu.Lock()
+	if s.open[m.parentID] != m {
+		s.mu.Unlock()
+		return nil
+	}
+	snapshot, err := s.executor.ExecuteQuiet(s.ctx, LuksCommandID, "Lock "+m.parentID, "cryptsetup", "close", m.name)
+	if err != nil {
+		s.mu.Unlock()
+		return errors.WithDetails(dto.ErrorInvalidStateForOperation,
+			"PartitionId", m.parentID, "reason", cryptsetupReason(snapshot, err))
+	}
+	delete(s.open, m.parentID)
+	for path, parentID := range s.mounted {
+		if parentID == m.parentID {
+			delete(s.mounted, path)
+		}
+	}
+	s.mu.Unlock()
+
+	slog.InfoContext(s.ctx, "Locked LUKS container", "partition_id", m.parentID, "mapper", m.name)
+	s.disks.RemovePartition(m.diskID, m.name)
+	if disk := s.updateEncryption(m.diskID, m.parentID); disk != nil {
+		s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.UPDATE}, Disk: disk})
+	}
+	return nil
+}
+
+// attach adds the partition of the opened container m next to parent and
+// returns it.
+func (s *LuksService) attach(m *luksMapping, parent *dto.Partition) *dto.Partition {
+	device := filepath.Join(s.mapperDir, m.name)
+	legacyDevice := device
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		legacyDevice = resolved
+	}
+	child := dto.Partition{
+		Id:               new(m.name),
+		DevicePath:       new(device),
+		LegacyDevicePath: new(legacyDevice),
+		LegacyDeviceName: new(filepath.Base(legacyDevice)),
+		DiskId:           new(m.diskID),
+		ParentId:         new(m.parentID),
+		Name:             parent.Name,
+		Size:             parent.Size,
+		RefreshVersion:   parent.RefreshVersion,
+	}
+	if fsType, errE := s.fsService.FsTypeFromDevice(device); errE == nil {
+		child.FsType = new(fsType)
+		child.FilesystemInfo, _ = s.fsService.GetSupportAndInfo(s.ctx, fsType)
+	}
+	if child.FilesystemInfo == nil || child.FilesystemInfo.Support == nil {
+		// Unknown content, as for a raw partition only formatting is offered.
+		child.FilesystemInfo = &dto.FilesystemInfo{Support: &dto.FilesystemSupport{CanFormat: true}}
+	}
+
+	if err := s.disks.AddPartition(m.diskID, child); err != nil {
+		slog.WarnContext(s.ctx, "Failed to add the partition of an unlocked LUKS container", "partition_id", m.parentID, "err", err)
+		return &child
+	}
+	disk := s.updateEncryption(m.diskID, m.parentID)
+	s.eventBus.EmitPartition(events.PartitionEvent{
+		Event:     events.Event{Type: events.EventTypes.ADD},
+		Partition: &child,
+		Disk:      disk,
+	})
+	s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.UPDATE}, Disk: disk})
+	return &child
+}
+
+// updateEncryption refreshes the encryption state of a container partition
+// and returns its disk.
+func (s *LuksService) updateEncryption(diskID, partitionID string) *dto.Disk {
+	disk, ok := s.disks.Get(diskID)
+	if !ok || disk.Partitions == nil {
+		return nil
+	}
+	part, ok := (*disk.Partitions)[partitionID]
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	m, unlocked := s.open[partitionID]
+	s.mu.Unlock()
+	if !unlocked {
+		m = newLuksMapping(diskID, &part)
+	}
+	part.Encryption = &dto.PartitionEncryption{
+		Type:       "luks",
+		Unlocked:   unlocked,
+		HasKeyfile: s.hasKeyfile(m),
+	}
+	if unlocked {
+		part.Encryption.MapperDevice = new(filepath.Join(s.mapperDir, m.name))
+		part.Encryption.MapperPartitionId = new(m.name)
+	}
+	(*disk.Partitions)[partitionID] = part
+	return disk
+}
+
+// mountPoints returns the mount points of the partition of the opened
+// container m.
+func (s *LuksService) mountPoints(m *luksMapping) []dto.MountPointData {
+	disk, ok := s.disks.Get(m.diskID)
+	if !ok || disk.Partitions == nil {
+		return nil
+	}
+	part, ok := (*disk.Partitions)[m.name]
+	if !ok || part.MountPointData == nil {
+		return nil
+	}
+	mps := make([]dto.MountPointData, 0, len(*part.MountPointData))
+	for _, mp := range *part.MountPointData {
+		mps = append(mps, mp)
+	}
+	return mps
+}
+
+// container returns the LUKS container partition with the given id and the
+// id of its disk.
+func (s *LuksService) container(partitionID string) (*dto.Partition, string, errors.E) {
+	if s.disks != nil {
+		for diskID, disk := range *s.disks {
+			if disk.Partitions == nil {
+				continue
+			}
+			part, ok := (*disk.Partitions)[partitionID]
+			if !ok {
+				continue
+			}
+			if !isLuksPartition(&part) {
+				return nil, "", errors.WithDetails(dto.ErrorInvalidParameter,
+					"PartitionId", partitionID, "reason", "the partition is not a LUKS container")
+			}
+			return &part, diskID, nil
+		}
+	}
+	return nil, "", errors.WithDetails(dto.ErrorNotFound, "PartitionId", partitionID, "reason", "partition not found")
+}
+
+func (s *LuksService) isToMountAtStartup(partitionID string) bool {
+	count, err := gorm.G[dbom.MountPointPath](s.db).
+		Where(g.MountPointPath.DeviceId.Eq(partitionID)).
+		Where(g.MountPointPath.IsToMountAtStartup.Eq(true)).
+		Count(s.ctx, "*")
+	if err != nil {
+		slog.WarnContext(s.ctx, "Failed to read the mount points of a LUKS container", "partition_id", partitionID, "err", err)
+		return false
+	}
+	return count > 0
+}
+
+func (s *LuksService) keyfilePath(m *luksMapping) string {
+	return filepath.Join(s.state.LuksKeyDir, m.name+".key")
+}
+
+func (s *LuksService) hasKeyfile(m *luksMapping) bool {
+	if s.state.LuksKeyDir == "" {
+		return false
+	}
+	_, err := os.Stat(s.keyfilePath(m))
+	return err == nil
+}
+
+func (s *LuksService) writeKeyfile(m *luksMapping, passphrase string) errors.E {
+	if s.state.LuksKeyDir == "" {
+		return errors.WithDetails(dto.ErrorInvalidStateForOperation, "reason", "no keyfile directory is configured")
+	}
+	if err := os.MkdirAll(s.state.LuksKeyDir, 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.WriteFile(s.keyfilePath(m), []byte(passphrase), 0o600); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func newLuksMapping(diskID string, part *dto.Partition) *luksMapping {
+	id := *part.Id
+	if part.Uuid != nil && *part.Uuid != "" {
+		id = *part.Uuid
+	}
+	return &luksMapping{
+		diskID:   diskID,
+		parentID: *part.Id,
+		name:     luksMapperPrefix + strings.NewReplacer("/", "_", " ", "_").Replace(id),
+	}
+}
+
+func isLuksPartition(part *dto.Partition) bool {
+	if part.FsType == nil {
+		return false
+	}
+	return strings.EqualFold(*part.FsType, filesystem.LuksFsType) || *part.FsType == "luks"
+}
+
+func containerDevice(part *dto.Partition) string {
+	if part.LegacyDevicePath != nil && *part.LegacyDevicePath != "" {
+		return *part.LegacyDevicePath
+	}
+	if part.DevicePath != nil {
+		return *part.DevicePath
+	}
+	return ""
+}
+
+func cryptsetupReason(snapshot dto.CommandExecutionSnapshot, err error) string {
+	if line := lastStderrLine(snapshot); line != "" {
+		return line
+	}
+	return err.Error()
+}
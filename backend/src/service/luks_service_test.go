@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+// fakeCryptsetup records its arguments, one per line, and opens or closes a
+// container by creating or removing its entry in "$LUKS_MAPPER_DIR". The key,
+// read from stdin or from a keyfile, has to be "$LUKS_PASSPHRASE".
+const fakeCryptsetup = `#!/bin/sh
+printf '%s\n' "$@" > "$(dirname "$0")/args"
+case "$1" in
+open)
+	shift
+	key=""
+	while [ $# -gt 2 ]; do
+		case "$1" in
+		--key-file=-) key=$(cat) ;;
+		--key-file) shift; key=$(cat "$1") ;;
+		esac
+		shift
+	done
+	if [ "$key" != "$LUKS_PASSPHRASE" ]; then
+		echo "No key available with this passphrase." >&2
+		exit 2
+	fi
+	touch "$LUKS_MAPPER_DIR/$2"
+	;;
+close)
+	if [ ! -e "$LUKS_MAPPER_DIR/$2" ]; then
+		echo "Device $2 is not active." >&2
+		exit 4
+	fi
+	rm "$LUKS_MAPPER_DIR/$2"
+	;;
+esac
+`
+
+const (
+	luksTestDisk      = "ata-TEST_DISK"
+	luksTestPartition = "ata-TEST_DISK-part1"
+	luksTestUUID      = "0b5e6a4c-5c55-4a2f-9d2e-6f1b8c3a9e01"
+	luksTestMapper    = "luks-" + luksTestUUID
+)
+
+type LuksServiceSuite struct {
+	suite.Suite
+	app           *fxtest.App
+	db            *gorm.DB
+	disks         *dto.DiskMap
+	eventBus      events.EventBusInterface
+	volumeService VolumeServiceInterface
+	luksService   *LuksService
+	binDir        string
+	mapperDir     string
+	keyDir        string
+}
+
+func TestLuksServiceSuite(t *testing.T) {
+	suite.Run(t, new(LuksServiceSuite))
+}
+
+func (suite *LuksServiceSuite) SetupTest() {
+	suite.binDir = suite.T().TempDir()
+	suite.mapperDir = suite.T().TempDir()
+	suite.keyDir = filepath.Join(suite.T().TempDir(), "luks")
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.binDir, "cryptsetup"), []byte(fakeCryptsetup), 0o755))
+	suite.T().Setenv("PATH", suite.binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	suite.T().Setenv("LUKS_MAPPER_DIR", suite.mapperDir)
+	suite.T().Setenv("LUKS_PASSPHRASE", "correct horse")
+
+	suite.disks = &dto.DiskMap{}
+	suite.Require().NoError(suite.disks.AddOrUpdate(luksTestDiskWithContainer()))
+
+	var luksService LuksServiceInterface
+	var fsService FilesystemServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+					LuksKeyDir:   suite.keyDir,
+				}
+			},
+			func() *dto.DiskMap { return suite.disks },
+			dbom.NewDB,
+			events.NewEventBus,
+			commandexec.NewCommandExecutor,
+			mock.Mock[FilesystemServiceInterface],
+			mock.Mock[VolumeServiceInterface],
+			NewLuksService,
+		),
+		fx.Populate(&suite.db),
+		fx.Populate(&suite.eventBus),
+		fx.Populate(&suite.volumeService),
+		fx.Populate(&fsService),
+		fx.Populate(&luksService),
+	)
+	suite.app.RequireStart()
+	suite.Require().NoError(suite.db.Unscoped().Where("device_id = ?", luksTestMapper).Delete(&dbom.MountPointPath{}).Error)
+
+	suite.luksService = luksService.(*LuksService)
+	suite.luksService.mapperDir = suite.mapperDir
+
+	mock.When(fsService.FsTypeFromDevice(mock.Any[string]())).ThenReturn("ext4", nil)
+	mock.When(fsService.GetSupportAndInfo(mock.AnyContext(), mock.Exact("ext4"))).ThenReturn(&dto.FilesystemInfo{
+		Name:    "ext4",
+		Support: &dto.FilesystemSupport{CanMount: true, CanFormat: true},
+	}, nil)
+	// The volume service emits the unmount as the mount manager does.
+	mock.When(suite.volumeService.UnmountVolume(mock.Any[string](), mock.Any[bool]())).ThenAnswer(func(args []any) []any {
+		mp, ok := suite.disks.GetMountPointByPath(args[0].(string))
+		suite.Require().True(ok)
+		mp.IsMounted = false
+		_ = suite.eventBus.EmitMountPoint(events.MountPointEvent{
+			Event:      events.Event{Type: events.EventTypes.UPDATE},
+			MountPoint: mp,
+		})
+		return []any{nil}
+	})
+}
+
+func (suite *LuksServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+func luksTestDiskWithContainer() *dto.Disk {
+	return &dto.Disk{
+		Id: new(luksTestDisk),
+		Partitions: &map[string]dto.Partition{
+			luksTestPartition: {
+				Id:               new(luksTestPartition),
+				Uuid:             new(luksTestUUID),
+				DiskId:           new(luksTestDisk),
+				DevicePath:       new("/dev/disk/by-id/" + luksTestPartition),
+				LegacyDevicePath: new("/dev/sdz1"),
+				FsType:           new("crypto_LUKS"),
+				Size:             new(1 << 30),
+			},
+			"ata-TEST_DISK-part2": {
+				Id:               new("ata-TEST_DISK-part2"),
+				DiskId:           new(luksTestDisk),
+				DevicePath:       new("/dev/disk/by-id/ata-TEST_DISK-part2"),
+				LegacyDevicePath: new("/dev/sdz2"),
+				FsType:           new("ext4"),
+			},
+		},
+	}
+}
+
+func (suite *LuksServiceSuite) cryptsetupArgs() []string {
+	data, err := os.ReadFile(filepath.Join(suite.binDir, "args"))
+	suite.Require().NoError(err)
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func (suite *LuksServiceSuite) partition(id string) (dto.Partition, bool) {
+	disk, ok := suite.disks.Get(luksTestDisk)
+	suite.Require().True(ok)
+	part, ok := (*disk.Partitions)[id]
+	return part, ok
+}
+
+func (suite *LuksServiceSuite) mapperExists() bool {
+	_, err := os.Stat(filepath.Join(suite.mapperDir, luksTestMapper))
+	return err == nil
+}
+
+// mountChild records a mounted volume on the opened container, as the
+// volume service does.
+func (suite *LuksServiceSuite) mountChild(path string) {
+	mp := dto.MountPointData{Path: path, Root: "/", DeviceId: luksTestMapper, IsMounted: true, Type: "ADDON"}
+	suite.Require().NoError(suite.disks.AddOrUpdateMountPoint(luksTestDisk, luksTestMapper, mp))
+	suite.Require().NoError(suite.eventBus.EmitMountPoint(events.MountPointEvent{
+		Event:      events.Event{Type: events.EventTypes.UPDATE},
+		MountPoint: &mp,
+	}))
+}
+
+func (suite *LuksServiceSuite) TestUnlockExposesMapperPartition() {
+	var added []dto.Partition
+	unsubscribe := suite.eventBus.OnPartition(func(ctx context.Context, e events.PartitionEvent) errors.E {
+		added = append(added, *e.Partition)
+		return nil
+	})
+	defer unsubscribe()
+
+	child, err := suite.luksService.Unlock(luksTestPartition, "correct horse", false)
+	suite.Require().NoError(err)
+
+	suite.Equal([]string{"open", "--type", "luks", "--key-file=-", "/dev/sdz1", luksTestMapper}, suite.cryptsetupArgs(),
+		"the passphrase goes through stdin, never the arguments")
+	suite.True(suite.mapperExists())
+	suite.Equal(luksTestMapper, *child.Id)
+	suite.Equal(filepath.Join(suite.mapperDir, luksTestMapper), *child.DevicePath)
+	suite.Equal(luksTestPartition, *child.ParentId)
+	suite.Equal("ext4", *child.FsType)
+
+	stored, ok := suite.partition(luksTestMapper)
+	suite.Require().True(ok, "the opened container is a partition of the disk")
+	suite.Equal(luksTestDisk, *stored.DiskId)
+	suite.Require().Len(added, 1)
+	suite.Equal(luksTestMapper, *added[0].Id)
+
+	parent, _ := suite.partition(luksTestPartition)
+	suite.Require().NotNil(parent.Encryption)
+	suite.True(parent.Encryption.Unlocked)
+	suite.Equal(luksTestMapper, *parent.Encryption.MapperPartitionId)
+	suite.False(parent.Encryption.HasKeyfile)
+	suite.NoDirExists(suite.keyDir, "nothing is stored without store_keyfile")
+
+	_, err = suite.luksService.Unlock(luksTestPartition, "correct horse", false)
+	suite.ErrorIs(err, dto.ErrorInvalidStateForOperation)
+}
+
+func (suite *LuksServiceSuite) TestUnlockWrongPassphrase() {
+	_, err := suite.luksService.Unlock(luksTestPartition, "wrong", true)
+	suite.Require().ErrorIs(err, dto.ErrorInvalidParameter)
+	suite.Equal("no key is available with this passphrase", errors.AllDetails(err)["reason"])
+	suite.False(suite.mapperExists())
+	_, ok := suite.partition(luksTestMapper)
+	suite.False(ok)
+	suite.NoDirExists(suite.keyDir)
+
+	_, err = suite.luksService.Unlock(luksTestPartition, "correct horse", false)
+	suite.NoError(err, "a failed attempt does not keep the container reserved")
+}
+
+func (suite *LuksServiceSuite) TestUnlockRejectsOtherPartitions() {
+	_, err := suite.luksService.Unlock("ata-TEST_DISK-part2", "correct horse", false)
+	suite.ErrorIs(err, dto.ErrorInvalidParameter)
+	_, err = suite.luksService.Unlock("missing", "correct horse", false)
+	suite.ErrorIs(err, dto.ErrorNotFound)
+	_, err = suite.luksService.Unlock(luksTestPartition, "", false)
+	suite.ErrorIs(err, dto.ErrorInvalidParameter)
+}
+
+func (suite *LuksServiceSuite) TestUnlockStoresKeyfile() {
+	_, err := suite.luksService.Unlock(luksTestPartition, "correct horse", true)
+	suite.Require().NoError(err)
+
+	keyfile := filepath.Join(suite.keyDir, luksTestMapper+".key")
+	info, statErr := os.Stat(keyfile)
+	suite.Require().NoError(statErr)
+	suite.Equal(os.FileMode(0o600), info.Mode().Perm())
+	content, _ := os.ReadFile(keyfile)
+	suite.Equal("correct horse", string(content))
+	parent, _ := suite.partition(luksTestPartition)
+	suite.True(parent.Encryption.HasKeyfile)
+
+	suite.Require().NoError(suite.luksService.RemoveKeyfile(luksTestPartition))
+	suite.NoFileExists(keyfile)
+	parent, _ = suite.partition(luksTestPartition)
+	suite.False(parent.Encryption.HasKeyfile)
+	suite.ErrorIs(suite.luksService.RemoveKeyfile(luksTestPartition), dto.ErrorNotFound)
+}
+
+func (suite *LuksServiceSuite) TestLockUnmountsAndCloses() {
+	_, err := suite.luksService.Unlock(luksTestPartition, "correct horse", false)
+	suite.Require().NoError(err)
+	path := filepath.Join(suite.T().TempDir(), "secret")
+	suite.mountChild(path)
+
+	suite.Require().NoError(suite.luksService.Lock(luksTestPartition))
+
+	mock.Verify(suite.volumeService, matchers.Times(1)).UnmountVolume(mock.Exact(path), mock.Exact(false))
+	suite.Equal([]string{"close", luksTestMapper}, suite.cryptsetupArgs())
+	suite.False(suite.mapperExists())
+	_, ok := suite.partition(luksTestMapper)
+	suite.False(ok, "the partition of the closed container is removed")
+	parent, _ := suite.partition(luksTestPartition)
+	suite.False(parent.Encryption.Unlocked)
+
+	suite.ErrorIs(suite.luksService.Lock(luksTestPartition), dto.ErrorInvalidStateForOperation)
+}
+
+func (suite *LuksServiceSuite) TestUnmountClosesContainer() {
+	_, err := suite.luksService.Unlock(luksTestPartition, "correct horse", false)
+	suite.Require().NoError(err)
+	first := filepath.Join(suite.T().TempDir(), "first")
+	second := filepath.Join(suite.T().TempDir(), "second")
+	suite.mountChild(first)
+	suite.mountChild(second)
+
+	suite.Require().NoError(suite.volumeService.UnmountVolume(first, false))
+	suite.True(suite.mapperExists(), "still open while a volume is mounted")
+
+	suite.Require().NoError(suite.volumeService.UnmountVolume(second, false))
+	suite.False(suite.mapperExists())
+	_, ok := suite.partition(luksTestMapper)
+	suite.False(ok)
+}
+
+func (suite *LuksServiceSuite) TestUnmountedAtStartupKeepsContainerOpen() {
+	_, err := suite.luksService.Unlock(luksTestPartition, "correct horse", false)
+	suite.Require().NoError(err)
+
+	// The volume service reports a volume to mount at startup as unmounted
+	// right before mounting it.
+	suite.Require().NoError(suite.eventBus.EmitMountPoint(events.MountPointEvent{
+		Event: events.Event{Type: events.EventTypes.UPDATE},
+		MountPoint: &dto.MountPointData{
+			Path:               filepath.Join(suite.T().TempDir(), "secret"),
+			DeviceId:           luksTestMapper,
+			IsToMountAtStartup: new(true),
+		},
+	}))
+	suite.True(suite.mapperExists())
+}
+
+func (suite *LuksServiceSuite) TestRefreshAddsBackOpenedPartition() {
+	_, err := suite.luksService.Unlock(luksTestPartition, "correct horse", false)
+	suite.Require().NoError(err)
+
+	// A hardware refresh replaces the disk.
+	disk := luksTestDiskWithContainer()
+	suite.Require().NoError(suite.disks.AddOrUpdate(disk))
+	parent := (*disk.Partitions)[luksTestPartition]
+	suite.eventBus.EmitPartition(events.PartitionEvent{
+		Event:     events.Event{Type: events.EventTypes.UPDATE},
+		Partition: &parent,
+		Disk:      disk,
+	})
+
+	child, ok := suite.partition(luksTestMapper)
+	suite.Require().True(ok)
+	suite.Equal(luksTestPartition, *child.ParentId)
+	stored, _ := suite.partition(luksTestPartition)
+	suite.True(stored.Encryption.Unlocked)
+}
+
+func (suite *LuksServiceSuite) TestAutoUnlockWithKeyfile() {
+	suite.Require().NoError(os.MkdirAll(suite.keyDir, 0o700))
+	keyfile := filepath.Join(suite.keyDir, luksTestMapper+".key")
+	suite.Require().NoError(os.WriteFile(keyfile, []byte("correct horse"), 0o600))
+	suite.Require().NoError(suite.db.Create(&dbom.MountPointPath{
+		Path:               "/mnt/luks-secret",
+		DeviceId:           luksTestMapper,
+		Type:               "ADDON",
+		IsToMountAtStartup: new(true),
+	}).Error)
+
+	disk, _ := suite.disks.Get(luksTestDisk)
+	emit := func() {
+		parent := (*disk.Partitions)[luksTestPartition]
+		suite.eventBus.EmitPartition(events.PartitionEvent{
+			Event:     events.Event{Type: events.EventTypes.ADD},
+			Partition: &parent,
+			Disk:      disk,
+		})
+	}
+	emit()
+
+	suite.Equal([]string{"open", "--type", "luks", "--key-file", keyfile, "/dev/sdz1", luksTestMapper}, suite.cryptsetupArgs())
+	suite.True(suite.mapperExists())
+	_, ok := suite.partition(luksTestMapper)
+	suite.True(ok)
+
+	// Locked by the user, the container stays locked on the next refresh.
+	suite.Require().NoError(suite.luksService.Lock(luksTestPartition))
+	emit()
+	suite.False(suite.mapperExists())
+	parent, _ := suite.partition(luksTestPartition)
+	suite.False(parent.Encryption.Unlocked)
+	suite.True(parent.Encryption.HasKeyfile)
+}
+
+func (suite *LuksServiceSuite) TestNoAutoUnlockWithoutStartupMount() {
+	suite.Require().NoError(os.MkdirAll(suite.keyDir, 0o700))
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.keyDir, luksTestMapper+".key"), []byte("correct horse"), 0o600))
+
+	disk, _ := suite.disks.Get(luksTestDisk)
+	parent := (*disk.Partitions)[luksTestPartition]
+	suite.eventBus.EmitPartition(events.PartitionEvent{
+		Event:     events.Event{Type: events.EventTypes.ADD},
+		Partition: &parent,
+		Disk:      disk,
+	})
+
+	suite.False(suite.mapperExists())
+	stored, _ := suite.partition(luksTestPartition)
+	suite.Require().NotNil(stored.Encryption)
+	suite.False(stored.Encryption.Unlocked)
+	suite.True(stored.Encryption.HasKeyfile)
+}
@@ -0,0 +1,531 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+)
+
+// LvmCommandID identifies the LVM executions.
+const LvmCommandID = "lvm"
+
+// lvmDiskPrefix prefixes the id of the disk exposing the logical volumes of a
+// volume group, followed by the volume group UUID.
+const lvmDiskPrefix = "lvm-"
+
+// lvmName is what LVM accepts as a volume group or logical volume name.
+var lvmName = regexp.MustCompile(`^[a-zA-Z0-9+_.][a-zA-Z0-9+_.-]*$`)
+
+type LvmServiceInterface interface {
+	// Report lists the physical volumes, volume groups and logical volumes,
+	// exposing the logical volumes as partitions. It changes nothing: the
+	// logical volumes of an inactive volume group stay inactive until
+	// ActivateVolumeGroup.
+	Report() (*dto.LvmReport, errors.E)
+	// ActivateVolumeGroup activates the logical volumes of a volume group,
+	// making them mountable.
+	ActivateVolumeGroup(vgName string) (*dto.LvmReport, errors.E)
+	// CreateLogicalVolume allocates a logical volume in a volume group.
+	CreateLogicalVolume(vgName string, request dto.LvmCreateRequest) (*dto.LvmLogicalVolume, errors.E)
+	// ExtendLogicalVolume grows a logical volume, and its filesystem when
+	// asked to.
+	ExtendLogicalVolume(vgName, lvName string, request dto.LvmExtendRequest) (*dto.LvmLogicalVolume, errors.E)
+	// SnapshotLogicalVolume takes a snapshot of a logical volume.
+	SnapshotLogicalVolume(vgName, lvName string, request dto.LvmSnapshotRequest) (*dto.LvmLogicalVolume, errors.E)
+}
+
+type LvmService struct {
+	ctx       context.Context
+	state     *dto.ContextState
+	disks     *dto.DiskMap
+	eventBus  events.EventBusInterface
+	fsService FilesystemServiceInterface
+	executor  commandexec.Executor
+
+	refreshMu sync.Mutex
+	mu        sync.Mutex
+	pvs       map[string]bool // physical volume devices of the last report
+}
+
+type LvmServiceParams struct {
+	fx.In
+	Ctx               context.Context
+	State             *dto.ContextState
+	Disks             *dto.DiskMap
+	EventBus          events.EventBusInterface
+	FilesystemService FilesystemServiceInterface
+	Executor          commandexec.Executor
+}
+
+func NewLvmService(lc fx.Lifecycle, in LvmServiceParams) LvmServiceInterface {
+	s := &LvmService{
+		ctx:       in.Ctx,
+		state:     in.State,
+		disks:     in.Disks,
+		eventBus:  in.EventBus,
+		fsService: in.FilesystemService,
+		executor:  in.Executor,
+		pvs:       make(map[string]bool),
+	}
+
+	// Subscribed here rather than on start: the physical volumes found by the
+	// volume service on start are the ones bringing the logical volumes.
+	unsubscribe := in.EventBus.OnPartition(s.handlePartitionEvent)
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			unsubscribe()
+			return nil
+		},
+	})
+
+	return s
+}
+
+func (s *LvmService) Report() (*dto.LvmReport, errors.E) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	report, errE := s.read()
+	if errE != nil {
+		return nil, errE
+	}
+
+	pvs := make(map[string]bool, len(report.PhysicalVolumes))
+	for i := range report.PhysicalVolumes {
+		pv := &report.PhysicalVolumes[i]
+		pvs[pv.Device] = true
+		if diskID, partitionID, ok := s.disks.GetByLegacyDevicePath(pv.Device); ok {
+			pv.DiskId = new(diskID)
+			if partitionID != "" {
+				pv.PartitionId = new(partitionID)
+			}
+		}
+	}
+	s.mu.Lock()
+	s.pvs = pvs
+	s.mu.Unlock()
+
+	s.expose(report)
+	return report, nil
+}
+
+func (s *LvmService) ActivateVolumeGroup(vgName string) (*dto.LvmReport, errors.E) {
+	if s.state.ProtectedMode {
+		return nil, errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "ActivateVolumeGroup", "reason", "changing LVM volumes is not permitted when ProtectedMode is enabled")
+	}
+	report, errE := s.Report()
+	if errE != nil {
+		return nil, errE
+	}
+	if !slices.ContainsFunc(report.VolumeGroups, func(vg dto.LvmVolumeGroup) bool { return vg.Name == vgName }) {
+		return nil, errors.WithDetails(dto.ErrorNotFound, "VolumeGroup", vgName, "reason", "volume group not found")
+	}
+
+	snapshot, err := s.executor.Execute(s.ctx, LvmCommandID, "Activate "+vgName, "vgchange", "-ay", vgName)
+	if err != nil {
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "VolumeGroup", vgName, "reason", lvmReason(snapshot, err))
+	}
+	slog.InfoContext(s.ctx, "Activated LVM volume group", "vg", vgName)
+	return s.Report()
+}
+
+func (s *LvmService) CreateLogicalVolume(vgName string, request dto.LvmCreateRequest) (*dto.LvmLogicalVolume, errors.E) {
+	if errE := s.checkChange("CreateLogicalVolume", request.Name, request.Size); errE != nil {
+		return nil, errE
+	}
+	report, errE := s.Report()
+	if errE != nil {
+		return nil, errE
+	}
+	if !slices.ContainsFunc(report.VolumeGroups, func(vg dto.LvmVolumeGroup) bool { return vg.Name == vgName }) {
+		return nil, errors.WithDetails(dto.ErrorNotFound, "VolumeGroup", vgName, "reason", "volume group not found")
+	}
+	if lvmLogicalVolume(report, vgName, request.Name) != nil {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter,
+			"VolumeGroup", vgName, "LogicalVolume", request.Name, "reason", "a logical volume with this name already exists")
+	}
+
+	args := []string{"-y", "-n", request.Name}
+	if request.Size > 0 {
+		args = append(args, "-L", lvmBytes(request.Size))
+	} else {
+		args = append(args, "-l", "100%FREE")
+	}
+	args = append(args, vgName)
+	return s.change("Create "+vgName+"/"+request.Name, vgName, request.Name, "lvcreate", args...)
+}
+
+func (s *LvmService) ExtendLogicalVolume(vgName, lvName string, request dto.LvmExtendRequest) (*dto.LvmLogicalVolume, errors.E) {
+	if errE := s.checkChange("ExtendLogicalVolume", lvName, request.Size); errE != nil {
+		return nil, errE
+	}
+	lv, errE := s.logicalVolume(vgName, lvName)
+	if errE != nil {
+		return nil, errE
+	}
+	if request.Size > 0 && request.Size <= lv.Size {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter,
+			"VolumeGroup", vgName, "LogicalVolume", lvName, "reason", "the new size is not larger than the current one")
+	}
+
+	var args []string
+	if request.Size > 0 {
+		args = append(args, "-L", lvmBytes(request.Size))
+	} else {
+		args = append(args, "-l", "+100%FREE")
+	}
+	if request.ResizeFs {
+		args = append(args, "-r")
+	}
+	args = append(args, vgName+"/"+lvName)
+	return s.change("Extend "+vgName+"/"+lvName, vgName, lvName, "lvextend", args...)
+}
+
+func (s *LvmService) SnapshotLogicalVolume(vgName, lvName string, request dto.LvmSnapshotRequest) (*dto.LvmLogicalVolume, errors.E) {
+	if errE := s.checkChange("SnapshotLogicalVolume", request.Name, request.Size); errE != nil {
+		return nil, errE
+	}
+	origin, errE := s.logicalVolume(vgName, lvName)
+	if errE != nil {
+		return nil, errE
+	}
+	if origin.Pool == nil && request.Size == 0 {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter,
+			"VolumeGroup", vgName, "LogicalVolume", lvName, "reason", "the snapshot of a thick logical volume needs a size")
+	}
+
+	args := []string{"-y", "-s", "-n", request.Name}
+	if request.Size > 0 {
+		args = append(args, "-L", lvmBytes(request.Size))
+	}
+	args = append(args, vgName+"/"+lvName)
+	return s.change("Snapshot "+vgName+"/"+lvName, vgName, request.Name, "lvcreate", args...)
+}
+
+// checkChange validates the arguments common to the changes of the logical
+// volumes.
+func (s *LvmService) checkChange(operation, name string, size int64) errors.E {
+	if s.state.ProtectedMode {
+		return errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", operation, "reason", "changing LVM volumes is not permitted when ProtectedMode is enabled")
+	}
+	if !lvmName.MatchString(name) {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "Name", name, "reason", "invalid logical volume name")
+	}
+	if size < 0 {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "Size", size, "reason", "the size is negative")
+	}
+	return nil
+}
+
+// change runs an LVM command shown in the command console, then returns the
+// logical volume it made or changed.
+func (s *LvmService) change(label, vgName, lvName, command string, args ...string) (*dto.LvmLogicalVolume, errors.E) {
+	snapshot, err := s.executor.Execute(s.ctx, LvmCommandID, label, command, args...)
+	if err != nil {
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation,
+			"VolumeGroup", vgName, "LogicalVolume", lvName, "reason", lvmReason(snapshot, err))
+	}
+	slog.InfoContext(s.ctx, "Changed LVM logical volume", "operation", label)
+	return s.logicalVolume(vgName, lvName)
+}
+
+// logicalVolume returns a logical volume as of a new report.
+func (s *LvmService) logicalVolume(vgName, lvName string) (*dto.LvmLogicalVolume, errors.E) {
+	report, errE := s.Report()
+	if errE != nil {
+		return nil, errE
+	}
+	lv := lvmLogicalVolume(report, vgName, lvName)
+	if lv == nil {
+		return nil, errors.WithDetails(dto.ErrorNotFound,
+			"VolumeGroup", vgName, "LogicalVolume", lvName, "reason", "logical volume not found")
+	}
+	return lv, nil
+}
+
+// read runs the LVM reports.
+func (s *LvmService) read() (*dto.LvmReport, errors.E) {
+	pvs, errE := s.report("pvs", "pv_name,pv_uuid,vg_name,pv_size,pv_free")
+	if errE != nil {
+		return nil, errE
+	}
+	vgs, errE := s.report("vgs", "vg_name,vg_uuid,vg_size,vg_free,pv_count,lv_count")
+	if errE != nil {
+		return nil, errE
+	}
+	lvs, errE := s.report("lvs", "lv_name,vg_name,lv_uuid,lv_path,lv_size,lv_attr,origin,pool_lv")
+	if errE != nil {
+		return nil, errE
+	}
+
+	report := &dto.LvmReport{
+		PhysicalVolumes: make([]dto.LvmPhysicalVolume, 0, len(pvs)),
+		VolumeGroups:    make([]dto.LvmVolumeGroup, 0, len(vgs)),
+		LogicalVolumes:  make([]dto.LvmLogicalVolume, 0, len(lvs)),
+	}
+	for _, row := range pvs {
+		report.PhysicalVolumes = append(report.PhysicalVolumes, dto.LvmPhysicalVolume{
+			Device: row["pv_name"],
+			Uuid:   row["pv_uuid"],
+			VgName: row["vg_name"],
+			Size:   lvmInt(row["pv_size"]),
+			Free:   lvmInt(row["pv_free"]),
+		})
+	}
+	for _, row := range vgs {
+		report.VolumeGroups = append(report.VolumeGroups, dto.LvmVolumeGroup{
+			Name:    row["vg_name"],
+			Uuid:    row["vg_uuid"],
+			Size:    lvmInt(row["vg_size"]),
+			Free:    lvmInt(row["vg_free"]),
+			PvCount: int(lvmInt(row["pv_count"])),
+			LvCount: int(lvmInt(row["lv_count"])),
+		})
+	}
+	for _, row := range lvs {
+		lv := dto.LvmLogicalVolume{
+			Name:   row["lv_name"],
+			VgName: row["vg_name"],
+			Uuid:   row["lv_uuid"],
+			Path:   row["lv_path"],
+			Size:   lvmInt(row["lv_size"]),
+			Attr:   row["lv_attr"],
+			// The fifth lv_attr character is the state, (a)ctive.
+			Active: len(row["lv_attr"]) > 4 && row["lv_attr"][4] == 'a',
+		}
+		if origin := row["origin"]; origin != "" {
+			lv.Origin = new(origin)
+		}
+		if pool := row["pool_lv"]; pool != "" {
+			lv.Pool = new(pool)
+		}
+		report.LogicalVolumes = append(report.LogicalVolumes, lv)
+	}
+	return report, nil
+}
+
+// report runs a quiet LVM report command and returns its rows.
+func (s *LvmService) report(command, fields string) ([]map[string]string, errors.E) {
+	snapshot, err := s.executor.ExecuteQuiet(s.ctx, LvmCommandID, "List "+command, command,
+		"--reportformat", "json", "--units", "b", "--nosuffix", "-o", fields)
+	if err != nil {
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "Command", command, "reason", lvmReason(snapshot, err))
+	}
+	var out strings.Builder
+	for _, line := range snapshot.Lines {
+		if line.Channel == dto.CommandOutputChannelStdout {
+			out.WriteString(line.Line)
+			out.WriteByte('\n')
+		}
+	}
+	// {"report": [{"pv": [{"pv_name": "/dev/sdb1", ...}]}]}
+	var parsed struct {
+		Report []map[string][]map[string]string `json:"report"`
+	}
+	if err := json.Unmarshal([]byte(out.String()), &parsed); err != nil {
+		return nil, errors.WithDetails(err, "Command", command)
+	}
+	var rows []map[string]string
+	for _, section := range parsed.Report {
+		rows = append(rows, section[command[:2]]...)
+	}
+	return rows, nil
+}
+
+// expose makes a disk of each volume group holding its logical volumes as
+// partitions. New logical volumes are sent as partition events so that the
+// volume service mounts them as any other.
+func (s *LvmService) expose(report *dto.LvmReport) {
+	if s.disks == nil {
+		return
+	}
+	current := make(map[string]bool, len(report.VolumeGroups))
+	for i := range report.VolumeGroups {
+		vg := &report.VolumeGroups[i]
+		diskID := lvmDiskPrefix + vg.Uuid
+		vg.DiskId = new(diskID)
+		current[diskID] = true
+
+		existing, known := s.disks.Get(diskID)
+		partitions := make(map[string]dto.Partition)
+		var added, activated []dto.Partition
+		for j := range report.LogicalVolumes {
+			lv := &report.LogicalVolumes[j]
+			if lv.VgName != vg.Name || lv.Path == "" {
+				// Pools and the other internal volumes have no device.
+				continue
+			}
+			part := s.partition(diskID, vg, lv)
+			lv.PartitionId = part.Id
+			if known && existing.Partitions != nil {
+				if old, ok := (*existing.Partitions)[*part.Id]; ok {
+					old.Size = part.Size
+					old.Name = part.Name
+					if old.FsType == nil && lv.Active {
+						// Activated since the last report.
+						if s.setFsType(&old); old.FsType != nil {
+							activated = append(activated, old)
+						}
+					}
+					partitions[*part.Id] = old
+					continue
+				}
+			}
+			if lv.Active {
+				s.setFsType(&part)
+			}
+			if part.FilesystemInfo == nil || part.FilesystemInfo.Support == nil {
+				// Unknown content, as for a raw partition only formatting is offered.
+				part.FilesystemInfo = &dto.FilesystemInfo{Support: &dto.FilesystemSupport{CanFormat: true}}
+			}
+			partitions[*part.Id] = part
+			added = append(added, part)
+		}
+
+		changed := !known || len(added) > 0 || len(activated) > 0 || existing.Partitions == nil || len(*existing.Partitions) != len(partitions)
+		disk := &dto.Disk{
+			Id:               new(diskID),
+			DevicePath:       new("/dev/" + vg.Name),
+			LegacyDevicePath: new("/dev/" + vg.Name),
+			LegacyDeviceName: new(vg.Name),
+			Model:            new("LVM " + vg.Name),
+			Vendor:           new("Linux LVM"),
+			Size:             new(int(vg.Size)),
+			Removable:        new(false),
+			Ejectable:        new(false),
+			Partitions:       &partitions,
+		}
+		if known {
+			disk.RefreshVersion = existing.RefreshVersion
+		}
+		if err := s.disks.AddOrUpdate(disk); err != nil {
+			slog.WarnContext(s.ctx, "Failed to add the disk of an LVM volume group", "vg", vg.Name, "err", err)
+			continue
+		}
+		for _, part := range added {
+			s.eventBus.EmitPartition(events.PartitionEvent{
+				Event:     events.Event{Type: events.EventTypes.ADD},
+				Partition: &part,
+				Disk:      disk,
+			})
+		}
+		for _, part := range activated {
+			s.eventBus.EmitPartition(events.PartitionEvent{
+				Event:     events.Event{Type: events.EventTypes.UPDATE},
+				Partition: &part,
+				Disk:      disk,
+			})
+		}
+		if changed {
+			eventType := events.EventTypes.UPDATE
+			if !known {
+				eventType = events.EventTypes.ADD
+			}
+			s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: eventType}, Disk: disk})
+		}
+	}
+
+	for diskID, disk := range *s.disks {
+		if strings.HasPrefix(diskID, lvmDiskPrefix) && !current[diskID] {
+			s.disks.Remove(diskID)
+			s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.REMOVE}, Disk: disk})
+		}
+	}
+}
+
+// partition returns the partition exposing a logical volume. Its id is the
+// one the hardware service gives to /dev/disk/by-id/dm-uuid-LVM-<vg><lv>.
+func (s *LvmService) partition(diskID string, vg *dto.LvmVolumeGroup, lv *dto.LvmLogicalVolume) dto.Partition {
+	byID := "dm-uuid-LVM-" + strings.ReplaceAll(vg.Uuid, "-", "") + strings.ReplaceAll(lv.Uuid, "-", "")
+	legacyDevice := lv.Path
+	if resolved, err := filepath.EvalSymlinks(lv.Path); err == nil {
+		legacyDevice = resolved
+	}
+	return dto.Partition{
+		Id:               new("by-id-" + byID),
+		DevicePath:       new("/dev/disk/by-id/" + byID),
+		LegacyDevicePath: new(legacyDevice),
+		LegacyDeviceName: new(filepath.Base(legacyDevice)),
+		DiskId:           new(diskID),
+		Name:             new(lv.Name),
+		Size:             new(int(lv.Size)),
+		System:           new(false),
+	}
+}
+
+func (s *LvmService) setFsType(part *dto.Partition) {
+	if s.fsService == nil {
+		return
+	}
+	fsType, errE := s.fsService.FsTypeFromDevice(*part.LegacyDevicePath)
+	if errE != nil {
+		return
+	}
+	part.FsType = new(fsType)
+	part.FilesystemInfo, _ = s.fsService.GetSupportAndInfo(s.ctx, fsType)
+}
+
+// handlePartitionEvent reads the LVM volumes when a physical volume not seen
+// yet shows up.
+func (s *LvmService) handlePartitionEvent(ctx context.Context, e events.PartitionEvent) errors.E {
+	if e.Type != events.EventTypes.ADD || e.Partition == nil || e.Partition.FsType == nil ||
+		*e.Partition.FsType != filesystem.LvmFsType || e.Partition.LegacyDevicePath == nil {
+		return nil
+	}
+	s.mu.Lock()
+	seen := s.pvs[*e.Partition.LegacyDevicePath]
+	s.mu.Unlock()
+	if seen {
+		return nil
+	}
+	if _, errE := s.Report(); errE != nil {
+		tlog.DebugContext(ctx, "Failed to read the LVM volumes", "device", *e.Partition.LegacyDevicePath, "error", errE)
+	}
+	return nil
+}
+
+// lvmLogicalVolume returns the logical volume of a report with the given
+// names, nil when there is none.
+func lvmLogicalVolume(report *dto.LvmReport, vgName, lvName string) *dto.LvmLogicalVolume {
+	for i := range report.LogicalVolumes {
+		if report.LogicalVolumes[i].VgName == vgName && report.LogicalVolumes[i].Name == lvName {
+			return &report.LogicalVolumes[i]
+		}
+	}
+	return nil
+}
+
+// lvmInt reads a number of a report run with --units b --nosuffix.
+func lvmInt(value string) int64 {
+	n, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return n
+}
+
+// lvmBytes formats a size for -L, rounded up by LVM to whole extents.
+func lvmBytes(size int64) string {
+	return fmt.Sprintf("%db", size)
+}
+
+func lvmReason(snapshot dto.CommandExecutionSnapshot, err error) string {
+	if line := lastStderrLine(snapshot); line != "" {
+		return strings.TrimSpace(line)
+	}
+	return err.Error()
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+// fakeLvm stands for every LVM command it is linked as. It logs its name and
+// arguments to "$LVM_DIR/calls" and prints "$LVM_DIR/<command>.json" for the
+// reports. A change replaces lvs.json with "$LVM_DIR/<command>.lvs.json" when
+// there is one, and fails when "$LVM_DIR/refuse" exists.
+const fakeLvm = `#!/bin/sh
+command=$(basename "$0")
+echo "$command $*" >> "$LVM_DIR/calls"
+case "$command" in
+pvs|vgs|lvs)
+	cat "$LVM_DIR/$command.json"
+	;;
+*)
+	if [ -e "$LVM_DIR/refuse" ]; then
+		echo "  Insufficient free space: 256 extents needed, but only 10 available" >&2
+		exit 5
+	fi
+	if [ -e "$LVM_DIR/$command.lvs.json" ]; then
+		mv "$LVM_DIR/$command.lvs.json" "$LVM_DIR/lvs.json"
+	fi
+	;;
+esac
+`
+
+const (
+	lvmTestPvs = `{"report":[{"pv":[{"pv_name":"/dev/sdb1","pv_uuid":"pv-uuid-1","vg_name":"vg0","pv_size":"1000000000","pv_free":"500000000"}]}]}`
+	lvmTestVgs = `{"report":[{"vg":[{"vg_name":"vg0","vg_uuid":"Vg0U-uid1","vg_size":"1000000000","vg_free":"500000000","pv_count":"1","lv_count":"1"}]}]}`
+	lvmTestLvs = `{"report":[{"lv":[{"lv_name":"data","vg_name":"vg0","lv_uuid":"LvDa-ta01","lv_path":"/dev/vg0/data","lv_size":"500000000","lv_attr":"-wi-a-----","origin":"","pool_lv":""}]}]}`
+	// lvmTestDataPartition is the partition id of vg0/data.
+	lvmTestDataPartition = "by-id-dm-uuid-LVM-Vg0Uuid1LvData01"
+	lvmTestDisk          = "lvm-Vg0U-uid1"
+)
+
+type LvmServiceSuite struct {
+	suite.Suite
+	app        *fxtest.App
+	state      *dto.ContextState
+	disks      *dto.DiskMap
+	eventBus   events.EventBusInterface
+	lvmService LvmServiceInterface
+	dir        string
+	partitions []events.PartitionEvent
+}
+
+func TestLvmServiceSuite(t *testing.T) {
+	suite.Run(t, new(LvmServiceSuite))
+}
+
+func (suite *LvmServiceSuite) SetupTest() {
+	binDir := suite.T().TempDir()
+	suite.dir = suite.T().TempDir()
+	for _, command := range []string{"pvs", "vgs", "lvs", "vgchange", "lvcreate", "lvextend"} {
+		suite.Require().NoError(os.WriteFile(filepath.Join(binDir, command), []byte(fakeLvm), 0o755))
+	}
+	suite.T().Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	suite.T().Setenv("LVM_DIR", suite.dir)
+	suite.writeReport("pvs", lvmTestPvs)
+	suite.writeReport("vgs", lvmTestVgs)
+	suite.writeReport("lvs", lvmTestLvs)
+	suite.partitions = nil
+
+	suite.state = &dto.ContextState{}
+	suite.disks = &dto.DiskMap{}
+	suite.Require().NoError(suite.disks.AddOrUpdate(&dto.Disk{
+		Id:               new("ata-DISK_SDB"),
+		LegacyDevicePath: new("/dev/sdb"),
+		Partitions: &map[string]dto.Partition{
+			"ata-DISK_SDB-part1": {Id: new("ata-DISK_SDB-part1"), LegacyDevicePath: new("/dev/sdb1"), FsType: new("LVM2_member")},
+		},
+	}))
+
+	var fsService FilesystemServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState { return suite.state },
+			func() *dto.DiskMap { return suite.disks },
+			events.NewEventBus,
+			commandexec.NewCommandExecutor,
+			mock.Mock[FilesystemServiceInterface],
+			NewLvmService,
+		),
+		fx.Populate(&suite.eventBus),
+		fx.Populate(&fsService),
+		fx.Populate(&suite.lvmService),
+	)
+	suite.app.RequireStart()
+
+	mock.When(fsService.FsTypeFromDevice(mock.Any[string]())).ThenReturn("ext4", nil)
+	mock.When(fsService.GetSupportAndInfo(mock.AnyContext(), mock.Exact("ext4"))).ThenReturn(&dto.FilesystemInfo{
+		Name:    "ext4",
+		Support: &dto.FilesystemSupport{CanMount: true, CanFormat: true},
+	}, nil)
+	suite.eventBus.OnPartition(func(ctx context.Context, event events.PartitionEvent) errors.E {
+		if event.Disk != nil && strings.HasPrefix(*event.Disk.Id, lvmDiskPrefix) {
+			suite.partitions = append(suite.partitions, event)
+		}
+		return nil
+	})
+}
+
+func (suite *LvmServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+func (suite *LvmServiceSuite) writeReport(name, content string) {
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.dir, name+".json"), []byte(content), 0o644))
+}
+
+func (suite *LvmServiceSuite) calls() []string {
+	data, err := os.ReadFile(filepath.Join(suite.dir, "calls"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	suite.Require().NoError(err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func (suite *LvmServiceSuite) TestReportExposesLogicalVolumes() {
+	report, err := suite.lvmService.Report()
+	suite.Require().NoError(err)
+
+	suite.Require().Len(report.PhysicalVolumes, 1)
+	pv := report.PhysicalVolumes[0]
+	suite.Equal("/dev/sdb1", pv.Device)
+	suite.Equal("vg0", pv.VgName)
+	suite.Equal(int64(500000000), pv.Free)
+	suite.Equal("ata-DISK_SDB", *pv.DiskId)
+	suite.Equal("ata-DISK_SDB-part1", *pv.PartitionId)
+
+	suite.Require().Len(report.VolumeGroups, 1)
+	suite.Equal(lvmTestDisk, *report.VolumeGroups[0].DiskId)
+	suite.Equal(1, report.VolumeGroups[0].LvCount)
+
+	suite.Require().Len(report.LogicalVolumes, 1)
+	lv := report.LogicalVolumes[0]
+	suite.True(lv.Active)
+	suite.Nil(lv.Origin)
+	suite.Equal(lvmTestDataPartition, *lv.PartitionId)
+
+	part, ok := suite.disks.GetPartition(lvmTestDisk, lvmTestDataPartition)
+	suite.Require().True(ok)
+	suite.Equal("/dev/disk/by-id/dm-uuid-LVM-Vg0Uuid1LvData01", *part.DevicePath)
+	suite.Equal("/dev/vg0/data", *part.LegacyDevicePath)
+	suite.Equal("data", *part.Name)
+	suite.Equal("ext4", *part.FsType)
+	suite.Equal(500000000, *part.Size)
+	suite.Require().Len(suite.partitions, 1)
+	suite.Equal(events.EventTypes.ADD, suite.partitions[0].Type)
+	suite.Contains(suite.calls(), "pvs --reportformat json --units b --nosuffix -o pv_name,pv_uuid,vg_name,pv_size,pv_free")
+
+	// Known logical volumes keep their mount points and are not sent again.
+	suite.Require().NoError(suite.disks.AddOrUpdateMountPoint(lvmTestDisk, lvmTestDataPartition, dto.MountPointData{Path: "/mnt/data"}))
+	_, err = suite.lvmService.Report()
+	suite.Require().NoError(err)
+	suite.Len(suite.partitions, 1)
+	_, ok = suite.disks.GetMountPoint(lvmTestDisk, lvmTestDataPartition, "/mnt/data")
+	suite.True(ok)
+}
+
+func (suite *LvmServiceSuite) TestInactiveVolumeGroupIsActivatedOnRequest() {
+	suite.writeReport("lvs", strings.Replace(lvmTestLvs, "-wi-a-----", "-wi-------", 1))
+	suite.writeReport("vgchange.lvs", lvmTestLvs)
+
+	// Reading the volumes does not activate them.
+	report, err := suite.lvmService.Report()
+	suite.Require().NoError(err)
+	suite.False(report.LogicalVolumes[0].Active)
+	for _, call := range suite.calls() {
+		suite.False(strings.HasPrefix(call, "vgchange"), call)
+	}
+	part, ok := suite.disks.GetPartition(lvmTestDisk, lvmTestDataPartition)
+	suite.Require().True(ok)
+	suite.Nil(part.FsType)
+	suite.Require().Len(suite.partitions, 1)
+
+	report, err = suite.lvmService.ActivateVolumeGroup("vg0")
+	suite.Require().NoError(err)
+	suite.Contains(suite.calls(), "vgchange -ay vg0")
+	suite.True(report.LogicalVolumes[0].Active)
+	part, ok = suite.disks.GetPartition(lvmTestDisk, lvmTestDataPartition)
+	suite.Require().True(ok)
+	suite.Equal("ext4", *part.FsType)
+	suite.Require().Len(suite.partitions, 2)
+	suite.Equal(events.EventTypes.UPDATE, suite.partitions[1].Type)
+	suite.Equal("ext4", *suite.partitions[1].Partition.FsType)
+
+	_, err = suite.lvmService.ActivateVolumeGroup("vg9")
+	suite.True(errors.Is(err, dto.ErrorNotFound), "%v", err)
+}
+
+func (suite *LvmServiceSuite) TestCreateLogicalVolume() {
+	suite.writeReport("lvcreate.lvs", strings.Replace(lvmTestLvs, `}]}]}`,
+		`},{"lv_name":"media","vg_name":"vg0","lv_uuid":"LvMe-dia1","lv_path":"/dev/vg0/media","lv_size":"1073741824","lv_attr":"-wi-a-----","origin":"","pool_lv":""}]}]}`, 1))
+
+	lv, err := suite.lvmService.CreateLogicalVolume("vg0", dto.LvmCreateRequest{Name: "media", Size: 1 << 30})
+	suite.Require().NoError(err)
+	suite.Equal("media", lv.Name)
+	suite.Equal(int64(1<<30), lv.Size)
+	suite.Contains(suite.calls(), "lvcreate -y -n media -L 1073741824b vg0")
+	_, ok := suite.disks.GetPartition(lvmTestDisk, *lv.PartitionId)
+	suite.True(ok)
+	suite.Len(suite.partitions, 2)
+
+	_, err = suite.lvmService.CreateLogicalVolume("vg0", dto.LvmCreateRequest{Name: "media"})
+	suite.True(errors.Is(err, dto.ErrorInvalidParameter), "%v", err)
+	_, err = suite.lvmService.CreateLogicalVolume("vg9", dto.LvmCreateRequest{Name: "other"})
+	suite.True(errors.Is(err, dto.ErrorNotFound), "%v", err)
+	_, err = suite.lvmService.CreateLogicalVolume("vg0", dto.LvmCreateRequest{Name: "-bad"})
+	suite.True(errors.Is(err, dto.ErrorInvalidParameter), "%v", err)
+}
+
+func (suite *LvmServiceSuite) TestCreateLogicalVolumeWithFreeSpace() {
+	_, err := suite.lvmService.CreateLogicalVolume("vg0", dto.LvmCreateRequest{Name: "rest"})
+	// The fake does not list it afterwards.
+	suite.True(errors.Is(err, dto.ErrorNotFound), "%v", err)
+	suite.Contains(suite.calls(), "lvcreate -y -n rest -l 100%FREE vg0")
+}
+
+func (suite *LvmServiceSuite) TestExtendLogicalVolume() {
+	_, err := suite.lvmService.ExtendLogicalVolume("vg0", "data", dto.LvmExtendRequest{Size: 100})
+	suite.True(errors.Is(err, dto.ErrorInvalidParameter), "%v", err)
+
+	suite.writeReport("lvextend.lvs", strings.Replace(lvmTestLvs, `"500000000"`, `"800000000"`, 1))
+	lv, err := suite.lvmService.ExtendLogicalVolume("vg0", "data", dto.LvmExtendRequest{Size: 800000000, ResizeFs: true})
+	suite.Require().NoError(err)
+	suite.Equal(int64(800000000), lv.Size)
+	suite.Contains(suite.calls(), "lvextend -L 800000000b -r vg0/data")
+	part, ok := suite.disks.GetPartition(lvmTestDisk, lvmTestDataPartition)
+	suite.Require().True(ok)
+	suite.Equal(800000000, *part.Size)
+
+	_, err = suite.lvmService.ExtendLogicalVolume("vg0", "data", dto.LvmExtendRequest{})
+	suite.Require().NoError(err)
+	suite.Contains(suite.calls(), "lvextend -l +100%FREE vg0/data")
+
+	_, err = suite.lvmService.ExtendLogicalVolume("vg0", "missing", dto.LvmExtendRequest{})
+	suite.True(errors.Is(err, dto.ErrorNotFound), "%v", err)
+}
+
+func (suite *LvmServiceSuite) TestSnapshotLogicalVolume() {
+	_, err := suite.lvmService.SnapshotLogicalVolume("vg0", "data", dto.LvmSnapshotRequest{Name: "data-snap"})
+	suite.True(errors.Is(err, dto.ErrorInvalidParameter), "%v", err)
+
+	suite.writeReport("lvcreate.lvs", strings.Replace(lvmTestLvs, `}]}]}`,
+		`},{"lv_name":"data-snap","vg_name":"vg0","lv_uuid":"LvSn-ap01","lv_path":"/dev/vg0/data-snap","lv_size":"500000000","lv_attr":"swi-a-s---","origin":"data","pool_lv":""}]}]}`, 1))
+	lv, err := suite.lvmService.SnapshotLogicalVolume("vg0", "data", dto.LvmSnapshotRequest{Name: "data-snap", Size: 100000000})
+	suite.Require().NoError(err)
+	suite.Equal("data", *lv.Origin)
+	suite.Contains(suite.calls(), "lvcreate -y -s -n data-snap -L 100000000b vg0/data")
+}
+
+func (suite *LvmServiceSuite) TestChangeRefused() {
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.dir, "refuse"), nil, 0o644))
+
+	_, err := suite.lvmService.SnapshotLogicalVolume("vg0", "data", dto.LvmSnapshotRequest{Name: "data-snap", Size: 100000000})
+	suite.Require().Error(err)
+	suite.True(errors.Is(err, dto.ErrorInvalidStateForOperation), "%v", err)
+	suite.Contains(errors.AllDetails(err)["reason"], "Insufficient free space")
+}
+
+func (suite *LvmServiceSuite) TestProtectedMode() {
+	suite.state.ProtectedMode = true
+
+	_, err := suite.lvmService.CreateLogicalVolume("vg0", dto.LvmCreateRequest{Name: "media", Size: 1 << 30})
+	suite.True(errors.Is(err, dto.ErrorOperationNotPermittedInProtectedMode), "%v", err)
+	_, err = suite.lvmService.ActivateVolumeGroup("vg0")
+	suite.True(errors.Is(err, dto.ErrorOperationNotPermittedInProtectedMode), "%v", err)
+	suite.Empty(suite.calls())
+}
+
+func (suite *LvmServiceSuite) TestNewPhysicalVolumeTriggersReport() {
+	part := dto.Partition{Id: new("ata-DISK_SDB-part1"), LegacyDevicePath: new("/dev/sdb1"), FsType: new("LVM2_member")}
+	disk, _ := suite.disks.Get("ata-DISK_SDB")
+	for range 2 {
+		suite.eventBus.EmitPartition(events.PartitionEvent{
+			Event:     events.Event{Type: events.EventTypes.ADD},
+			Partition: &part,
+			Disk:      disk,
+		})
+	}
+	count := 0
+	for _, call := range suite.calls() {
+		if strings.HasPrefix(call, "pvs") {
+			count++
+		}
+	}
+	suite.Equal(1, count)
+	_, ok := suite.disks.Get(lvmTestDisk)
+	suite.True(ok)
+}
+
+func (suite *LvmServiceSuite) TestRemovedVolumeGroupIsHidden() {
+	_, err := suite.lvmService.Report()
+	suite.Require().NoError(err)
+
+	suite.writeReport("pvs", `{"report":[{"pv":[]}]}`)
+	suite.writeReport("vgs", `{"report":[{"vg":[]}]}`)
+	suite.writeReport("lvs", `{"report":[{"lv":[]}]}`)
+	report, err := suite.lvmService.Report()
+	suite.Require().NoError(err)
+	suite.Empty(report.VolumeGroups)
+	_, ok := suite.disks.Get(lvmTestDisk)
+	suite.False(ok)
+}
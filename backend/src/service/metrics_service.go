@@ -0,0 +1,288 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/openmetrics"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+)
+
+type MetricsServiceInterface interface {
+	// WriteMetrics writes the current disk, network, Samba, mount and problem
+	// metrics in the OpenMetrics text format.
+	WriteMetrics(ctx context.Context, out io.Writer) errors.E
+}
+
+type MetricsService struct {
+	diskStatsService    DiskStatsService
+	networkStatsService NetworkStatsService
+	serverService       ServerServiceInterface
+	volumeService       VolumeServiceInterface
+	problemService      ProblemServiceInterface
+}
+
+type MetricsServiceParams struct {
+	fx.In
+	DiskStatsService    DiskStatsService        `optional:"true"`
+	NetworkStatsService NetworkStatsService     `optional:"true"`
+	ServerService       ServerServiceInterface  `optional:"true"`
+	VolumeService       VolumeServiceInterface  `optional:"true"`
+	ProblemService      ProblemServiceInterface `optional:"true"`
+}
+
+func NewMetricsService(in MetricsServiceParams) MetricsServiceInterface {
+	return &MetricsService{
+		diskStatsService:    in.DiskStatsService,
+		networkStatsService: in.NetworkStatsService,
+		serverService:       in.ServerService,
+		volumeService:       in.VolumeService,
+		problemService:      in.ProblemService,
+	}
+}
+
+func (s *MetricsService) WriteMetrics(ctx context.Context, out io.Writer) errors.E {
+	var set openmetrics.Set
+	success := set.Gauge("srat_collector_success", "", "Whether the last collection of a group of metrics succeeded.")
+	collectors := []struct {
+		name    string
+		enabled bool
+		collect func(*openmetrics.Set) errors.E
+	}{
+		{"disks", s.diskStatsService != nil, s.collectDisks},
+		{"network", s.networkStatsService != nil, s.collectNetwork},
+		{"samba", s.serverService != nil, s.collectSamba},
+		{"mounts", s.volumeService != nil, s.collectMounts},
+		{"problems", s.problemService != nil, s.collectProblems},
+	}
+	for _, c := range collectors {
+		if !c.enabled {
+			continue
+		}
+		// A failing collector leaves the others' metrics in the scrape.
+		var part openmetrics.Set
+		if err := c.collect(&part); err != nil {
+			tlog.DebugContext(ctx, "Failed to collect metrics", "collector", c.name, "error", err)
+			success.Add(0, "collector", c.name)
+			continue
+		}
+		success.Add(1, "collector", c.name)
+		set.Append(&part)
+	}
+
+	if _, err := set.WriteTo(out); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s *MetricsService) collectDisks(set *openmetrics.Set) errors.E {
+	health, err := s.diskStatsService.GetDiskStats()
+	if err != nil {
+		return err
+	}
+
+	readIOPS := set.Gauge("srat_disk_read_iops", "", "Read operations per second.")
+	writeIOPS := set.Gauge("srat_disk_write_iops", "", "Write operations per second.")
+	readLatency := set.Gauge("srat_disk_read_latency_seconds", "seconds", "Average time of a read operation.")
+	writeLatency := set.Gauge("srat_disk_write_latency_seconds", "seconds", "Average time of a write operation.")
+	temperature := set.Gauge("srat_disk_smart_temperature_celsius", "celsius", "Disk temperature reported by SMART.")
+	powerOnHours := set.Gauge("srat_disk_smart_power_on_hours", "hours", "Power on time reported by SMART.")
+	powerCycles := set.Gauge("srat_disk_smart_power_cycles", "", "Power cycles reported by SMART.")
+	standby := set.Gauge("srat_disk_smart_standby", "", "Whether the disk was in standby when SMART was read.")
+	attrValue := set.Gauge("srat_disk_smart_attribute_value", "", "Normalized value of a SMART attribute.")
+	attrWorst := set.Gauge("srat_disk_smart_attribute_worst", "", "Worst normalized value of a SMART attribute.")
+	attrThreshold := set.Gauge("srat_disk_smart_attribute_threshold", "", "Failure threshold of a SMART attribute.")
+	for _, d := range sortedBy(health.PerDiskIO, func(d dto.DiskIOStats) string { return d.DeviceDescription }) {
+		labels := []string{"disk", d.DeviceDescription, "device", d.DeviceName}
+		readIOPS.Add(d.ReadIOPS, labels...)
+		writeIOPS.Add(d.WriteIOPS, labels...)
+		readLatency.Add(d.ReadLatency/1000, labels...)
+		writeLatency.Add(d.WriteLatency/1000, labels...)
+
+		smart := d.SmartData
+		if smart == nil || !smart.Enabled {
+			continue
+		}
+		disk := []string{"disk", d.DeviceDescription}
+		standby.Add(boolValue(smart.InStandby), disk...)
+		if smart.InStandby {
+			// The values were not read, to let the disk sleep.
+			continue
+		}
+		temperature.Add(float64(smart.Temperature.Value), disk...)
+		powerOnHours.Add(float64(smart.PowerOnHours.Value), disk...)
+		powerCycles.Add(float64(smart.PowerCycleCount.Value), disk...)
+		for _, name := range slices.Sorted(maps.Keys(smart.Additional)) {
+			attr := smart.Additional[name]
+			labels := append(slices.Clone(disk), "attribute", name, "id", strconv.Itoa(attr.Code))
+			attrValue.Add(float64(attr.Value), labels...)
+			if attr.Worst > 0 {
+				attrWorst.Add(float64(attr.Worst), labels...)
+			}
+			if attr.Thresholds > 0 {
+				attrThreshold.Add(float64(attr.Thresholds), labels...)
+			}
+		}
+	}
+
+	healthy := set.Gauge("srat_disk_smart_healthy", "", "Whether the SMART overall health check passed.")
+	spunDown := set.Gauge("srat_disk_spun_down", "", "Whether HDIdle spun the disk down.")
+	for _, id := range slices.Sorted(maps.Keys(health.PerDiskInfo)) {
+		info := health.PerDiskInfo[id]
+		if info.SmartHealth != nil {
+			healthy.Add(boolValue(info.SmartHealth.Passed), "disk", id)
+		}
+		if info.HDIdleStatus != nil {
+			spunDown.Add(boolValue(info.HDIdleStatus.SpunDown), "disk", id)
+		}
+	}
+	set.Gauge("srat_hdidle_running", "", "Whether HDIdle is spinning idle disks down.").Add(boolValue(health.HDIdleRunning))
+
+	size := set.Gauge("srat_filesystem_size_bytes", "bytes", "Size of a mounted filesystem.")
+	free := set.Gauge("srat_filesystem_free_bytes", "bytes", "Free space of a mounted filesystem.")
+	for _, id := range slices.Sorted(maps.Keys(health.PerPartitionInfo)) {
+		for _, part := range sortedBy(health.PerPartitionInfo[id], func(p dto.PerPartitionInfo) string { return p.MountPoint }) {
+			if part.MountPoint == "" {
+				continue
+			}
+			labels := []string{"disk", id, "device", part.Device, "mount_point", part.MountPoint, "fstype", part.FSType}
+			size.Add(float64(part.TotalSpace), labels...)
+			free.Add(float64(part.FreeSpace), labels...)
+		}
+	}
+	return nil
+}
+
+func (s *MetricsService) collectNetwork(set *openmetrics.Set) errors.E {
+	stats, err := s.networkStatsService.GetNetworkStats()
+	if err != nil {
+		return err
+	}
+	receive := set.Gauge("srat_network_receive_bytes_per_second", "", "Bytes received per second.")
+	transmit := set.Gauge("srat_network_transmit_bytes_per_second", "", "Bytes sent per second.")
+	speed := set.Gauge("srat_network_link_speed_bits_per_second", "", "Link speed of the interface.")
+	for _, nic := range sortedBy(stats.PerNicIO, func(n dto.NicIOStats) string { return n.DeviceName }) {
+		receive.Add(nic.InboundTraffic, "nic", nic.DeviceName)
+		transmit.Add(nic.OutboundTraffic, "nic", nic.DeviceName)
+		if nic.DeviceMaxSpeed > 0 {
+			// sysfs reports Mbit/s.
+			speed.Add(float64(nic.DeviceMaxSpeed)*1e6, "nic", nic.DeviceName)
+		}
+	}
+	return nil
+}
+
+func (s *MetricsService) collectSamba(set *openmetrics.Set) errors.E {
+	status, err := s.serverService.GetSambaStatus()
+	if err != nil {
+		return err
+	}
+
+	type key struct{ share, user, dialect string }
+	sessions := map[key]int{}
+	for _, session := range status.Sessions {
+		sessions[key{user: session.Username, dialect: session.SessionDialect}]++
+	}
+	connections := map[key]int{}
+	for _, tcon := range status.Tcons {
+		session := status.Sessions[tcon.SessionID]
+		connections[key{share: tcon.Service, user: session.Username, dialect: session.SessionDialect}]++
+	}
+	compare := func(a, b key) int {
+		if a.share != b.share {
+			return cmp.Compare(a.share, b.share)
+		}
+		if a.user != b.user {
+			return cmp.Compare(a.user, b.user)
+		}
+		return cmp.Compare(a.dialect, b.dialect)
+	}
+
+	sessionFamily := set.Gauge("srat_samba_sessions", "", "Open SMB sessions.")
+	for _, k := range slices.SortedFunc(maps.Keys(sessions), compare) {
+		sessionFamily.Add(float64(sessions[k]), "user", k.user, "dialect", k.dialect)
+	}
+	connectionFamily := set.Gauge("srat_samba_share_connections", "", "SMB connections to a share.")
+	for _, k := range slices.SortedFunc(maps.Keys(connections), compare) {
+		connectionFamily.Add(float64(connections[k]), "share", k.share, "user", k.user, "dialect", k.dialect)
+	}
+	set.Gauge("srat_samba_open_files", "", "Files held open by SMB clients.").Add(float64(len(status.OpenFiles)))
+	return nil
+}
+
+func (s *MetricsService) collectMounts(set *openmetrics.Set) errors.E {
+	mounted := set.Gauge("srat_mount_mounted", "", "Whether a mount point is mounted.")
+	type mount struct{ path, device, fstype string }
+	var mounts []mount
+	state := map[mount]bool{}
+	for _, disk := range s.volumeService.GetVolumesData() {
+		if disk == nil || disk.Partitions == nil {
+			continue
+		}
+		for _, part := range *disk.Partitions {
+			if part.MountPointData == nil {
+				continue
+			}
+			for _, mp := range *part.MountPointData {
+				m := mount{path: mp.Path}
+				if part.LegacyDeviceName != nil {
+					m.device = *part.LegacyDeviceName
+				}
+				if mp.FSType != nil {
+					m.fstype = *mp.FSType
+				}
+				if _, ok := state[m]; !ok {
+					mounts = append(mounts, m)
+				}
+				state[m] = mp.IsMounted
+			}
+		}
+	}
+	slices.SortFunc(mounts, func(a, b mount) int { return cmp.Compare(a.path, b.path) })
+	for _, m := range mounts {
+		mounted.Add(boolValue(state[m]), "path", m.path, "device", m.device, "fstype", m.fstype)
+	}
+	return nil
+}
+
+func (s *MetricsService) collectProblems(set *openmetrics.Set) errors.E {
+	problems, err := s.problemService.List()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	counts := map[dto.ProblemSeverity]int{}
+	for _, problem := range problems {
+		if problem == nil || isTerminalProblemStatus(problem.Status) {
+			continue
+		}
+		counts[problem.Severity]++
+	}
+	family := set.Gauge("srat_problems", "", "Open problems.")
+	// Every severity is reported, so the series don't come and go.
+	dto.ExhaustiveProblemSeverities(func(severity dto.ProblemSeverity) {
+		family.Add(float64(counts[severity]), "severity", severity.String())
+	})
+	return nil
+}
+
+// sortedBy returns a copy of items sorted by key.
+func sortedBy[T any](items []T, key func(T) string) []T {
+	sorted := slices.Clone(items)
+	slices.SortStableFunc(sorted, func(a, b T) int { return cmp.Compare(key(a), key(b)) })
+	return sorted
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/tozd/go/errors"
+)
+
+func newMetricsService(t *testing.T) (*MetricsService, ServerServiceInterface) {
+	ctrl := mock.NewMockController(t)
+	diskStats := mock.Mock[DiskStatsService](ctrl)
+	mock.When(diskStats.GetDiskStats()).ThenReturn(&dto.DiskHealth{
+		PerDiskIO: []dto.DiskIOStats{{
+			DeviceName: "sda", DeviceDescription: "WDC-123", ReadIOPS: 12.5, WriteIOPS: 3, ReadLatency: 4, WriteLatency: 8,
+			SmartData: &dto.SmartStatus{
+				Enabled:      true,
+				Temperature:  dto.SmartTempValue{Value: 38},
+				PowerOnHours: dto.SmartRangeValue{Value: 1200},
+				Additional: map[string]dto.SmartRangeValue{
+					"Reallocated_Sector_Ct": {Code: 5, Value: 100, Worst: 100, Thresholds: 10},
+				},
+			},
+		}},
+		PerDiskInfo: map[string]dto.PerDiskInfo{
+			"WDC-123": {SmartHealth: &dto.SmartHealthStatus{Passed: true}, HDIdleStatus: &dto.HDIdleDeviceStatus{SpunDown: false}},
+		},
+		PerPartitionInfo: map[string][]dto.PerPartitionInfo{
+			"WDC-123": {{MountPoint: "/mnt/data", Device: "sda1", FSType: "ext4", FreeSpace: 100, TotalSpace: 400}},
+		},
+		HDIdleRunning: true,
+	}, nil)
+	networkStats := mock.Mock[NetworkStatsService](ctrl)
+	mock.When(networkStats.GetNetworkStats()).ThenReturn(&dto.NetworkStats{
+		PerNicIO: []dto.NicIOStats{{DeviceName: "eth0", DeviceMaxSpeed: 1000, InboundTraffic: 2048, OutboundTraffic: 1024}},
+	}, nil)
+	serverService := mock.Mock[ServerServiceInterface](ctrl)
+	volumeService := mock.Mock[VolumeServiceInterface](ctrl)
+	mock.When(volumeService.GetVolumesData()).ThenReturn([]*dto.Disk{{
+		Partitions: &map[string]dto.Partition{
+			"p1": {
+				LegacyDeviceName: new("sda1"),
+				MountPointData: &map[string]dto.MountPointData{
+					"/mnt/data": {Path: "/mnt/data", FSType: new("ext4"), IsMounted: true},
+				},
+			},
+		},
+	}})
+	problemService := mock.Mock[ProblemServiceInterface](ctrl)
+	mock.When(problemService.List()).ThenReturn([]*dto.Problem{
+		{Severity: dto.ProblemSeverities.PROBLEMSEVERITYWARNING, Status: dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSCREATED},
+		{Severity: dto.ProblemSeverities.PROBLEMSEVERITYWARNING, Status: dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSDISMISSED},
+	}, nil)
+
+	// GetSambaStatus is left for each test to stub.
+	return &MetricsService{
+		diskStatsService:    diskStats,
+		networkStatsService: networkStats,
+		serverService:       serverService,
+		volumeService:       volumeService,
+		problemService:      problemService,
+	}, serverService
+}
+
+func TestWriteMetrics(t *testing.T) {
+	service, serverService := newMetricsService(t)
+	mock.When(serverService.GetSambaStatus()).ThenReturn(&dto.SambaStatus{
+		Sessions: map[string]dto.SambaSession{
+			"1": {Username: "alice", SessionDialect: "SMB3_11"},
+			"2": {Username: "alice", SessionDialect: "SMB3_11"},
+		},
+		Tcons: map[string]dto.SambaTcon{
+			"10": {SessionID: "1", Service: "media"},
+			"11": {SessionID: "2", Service: "media"},
+			"12": {SessionID: "2", Service: "backup"},
+		},
+	}, nil)
+
+	var out strings.Builder
+	require.NoError(t, service.WriteMetrics(context.Background(), &out))
+	metrics := out.String()
+
+	for _, line := range []string{
+		`srat_collector_success{collector="samba"} 1`,
+		`srat_disk_read_iops{disk="WDC-123",device="sda"} 12.5`,
+		`srat_disk_write_latency_seconds{disk="WDC-123",device="sda"} 0.008`,
+		`srat_disk_smart_temperature_celsius{disk="WDC-123"} 38`,
+		`srat_disk_smart_attribute_threshold{disk="WDC-123",attribute="Reallocated_Sector_Ct",id="5"} 10`,
+		`srat_disk_smart_healthy{disk="WDC-123"} 1`,
+		`srat_disk_spun_down{disk="WDC-123"} 0`,
+		`srat_hdidle_running 1`,
+		`srat_filesystem_free_bytes{disk="WDC-123",device="sda1",mount_point="/mnt/data",fstype="ext4"} 100`,
+		`srat_network_receive_bytes_per_second{nic="eth0"} 2048`,
+		`srat_network_link_speed_bits_per_second{nic="eth0"} 1e+09`,
+		`srat_samba_sessions{user="alice",dialect="SMB3_11"} 2`,
+		`srat_samba_share_connections{share="backup",user="alice",dialect="SMB3_11"} 1`,
+		`srat_samba_share_connections{share="media",user="alice",dialect="SMB3_11"} 2`,
+		`srat_mount_mounted{path="/mnt/data",device="sda1",fstype="ext4"} 1`,
+		`srat_problems{severity="warning"} 1`,
+		`srat_problems{severity="critical"} 0`,
+	} {
+		assert.Contains(t, metrics, line+"\n")
+	}
+	assert.True(t, strings.HasSuffix(metrics, "# EOF\n"))
+}
+
+func TestWriteMetricsFailingCollector(t *testing.T) {
+	service, serverService := newMetricsService(t)
+	mock.When(serverService.GetSambaStatus()).ThenReturn(nil, errors.New("smbd is not running"))
+
+	var out strings.Builder
+	require.NoError(t, service.WriteMetrics(context.Background(), &out))
+	metrics := out.String()
+
+	assert.Contains(t, metrics, `srat_collector_success{collector="samba"} 0`+"\n")
+	assert.NotContains(t, metrics, "srat_samba_sessions")
+	assert.Contains(t, metrics, `srat_collector_success{collector="disks"} 1`+"\n")
+	assert.Contains(t, metrics, "srat_disk_read_iops{")
+}
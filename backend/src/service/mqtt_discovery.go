@@ -0,0 +1,383 @@
+package service
+
+import (
+	"encoding/json"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/dianlight/srat/config"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/tlog"
+)
+
+type mqttTargetKind int
+
+const (
+	mqttTargetMount mqttTargetKind = iota
+	mqttTargetShare
+	mqttTargetSmartTest
+	mqttTargetSpinDown
+)
+
+// mqttTarget is what the command topic of an entity acts on.
+type mqttTarget struct {
+	kind mqttTargetKind
+	// id is the disk id, the mount path or the share name.
+	id         string
+	mountPoint dto.MountPointData
+	testType   dto.SmartTestType
+}
+
+// mqttEntity is an entity announced through Home Assistant MQTT discovery.
+type mqttEntity struct {
+	component string // sensor, binary_sensor, switch or button
+	objectID  string
+	config    map[string]any
+}
+
+func (e mqttEntity) payload() string {
+	// Maps are encoded with sorted keys, an unchanged entity gives the same
+	// payload and is not announced again.
+	b, err := json.Marshal(e.config)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// mqttSnapshot is everything published for one state of SRAT.
+type mqttSnapshot struct {
+	entities []mqttEntity
+	states   map[string]string
+	commands map[string]mqttTarget
+}
+
+func (c mqttConfig) availabilityTopic() string {
+	return c.topic + "/status"
+}
+
+func (c mqttConfig) discoveryTopic(e mqttEntity) string {
+	return c.discoveryPrefix + "/" + e.component + "/" + mqttObjectID(c.topic) + "/" + e.objectID + "/config"
+}
+
+// mqttObjectID turns an id into the [a-zA-Z0-9_-] characters allowed in the
+// topics and the object ids of Home Assistant.
+func mqttObjectID(id string) string {
+	var b strings.Builder
+	for _, r := range strings.Trim(id, "/") {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			b.WriteRune(r - 'A' + 'a')
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// mqttBuilder collects the entities of one snapshot.
+type mqttBuilder struct {
+	cfg      mqttConfig
+	snapshot mqttSnapshot
+	hub      map[string]any
+	disks    map[string]map[string]any // disk id -> device
+}
+
+func newMQTTBuilder(cfg mqttConfig) *mqttBuilder {
+	node := mqttObjectID(cfg.topic)
+	return &mqttBuilder{
+		cfg: cfg,
+		snapshot: mqttSnapshot{
+			states:   map[string]string{},
+			commands: map[string]mqttTarget{},
+		},
+		hub: map[string]any{
+			"identifiers":  []string{node},
+			"name":         "SRAT",
+			"manufacturer": "dianlight",
+			"model":        "SambaNAS2 Rest Administration Tool",
+			"sw_version":   config.BuildVersion(),
+		},
+		disks: map[string]map[string]any{},
+	}
+}
+
+func (b *mqttBuilder) device(group, id, name string, extra map[string]any) map[string]any {
+	node := mqttObjectID(b.cfg.topic)
+	device := map[string]any{
+		"identifiers": []string{node + "_" + group + "_" + mqttObjectID(id)},
+		"name":        name,
+		"via_device":  node,
+	}
+	maps.Copy(device, extra)
+	return device
+}
+
+// add announces an entity reading its value from the JSON state of its group.
+// command, when set, is the command topic of the entity and what it acts on.
+func (b *mqttBuilder) add(device map[string]any, group, id, key, component, name string, options map[string]any, command *mqttTarget) {
+	objectID := group + "_" + mqttObjectID(id) + "_" + key
+	base := b.cfg.topic + "/" + group + "/" + mqttObjectID(id)
+	entity := map[string]any{
+		"name":               name,
+		"unique_id":          mqttObjectID(b.cfg.topic) + "_" + objectID,
+		"object_id":          mqttObjectID(b.cfg.topic) + "_" + objectID,
+		"device":             device,
+		"availability_topic": b.cfg.availabilityTopic(),
+	}
+	if component != "button" {
+		entity["state_topic"] = base + "/state"
+		entity["value_template"] = "{{ value_json." + key + " }}"
+	}
+	if command != nil {
+		topic := base + "/" + key + "/set"
+		entity["command_topic"] = topic
+		b.snapshot.commands[topic] = *command
+	}
+	maps.Copy(entity, options)
+	b.snapshot.entities = append(b.snapshot.entities, mqttEntity{component: component, objectID: objectID, config: entity})
+}
+
+func (b *mqttBuilder) state(group, id string, values map[string]any) {
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return
+	}
+	b.snapshot.states[b.cfg.topic+"/"+group+"/"+mqttObjectID(id)+"/state"] = string(payload)
+}
+
+func onOff(v bool) string {
+	if v {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// collect builds the entities and the states from the current data. A source
+// failing only drops its own entities.
+func (s *MQTTService) collect(cfg mqttConfig) mqttSnapshot {
+	b := newMQTTBuilder(cfg)
+	hubState := map[string]any{}
+
+	var volumes []*dto.Disk
+	if s.volumeService != nil {
+		volumes = s.volumeService.GetVolumesData()
+	}
+	var health *dto.DiskHealth
+	if s.diskStatsService != nil {
+		var err error
+		if health, err = s.diskStatsService.GetDiskStats(); err != nil {
+			tlog.DebugContext(s.ctx, "Unable to read disk stats for MQTT", "error", err)
+			health = nil
+		}
+	}
+	s.collectDisks(b, volumes, health)
+	s.collectVolumes(b, volumes)
+
+	var samba *dto.SambaStatus
+	if s.serverService != nil {
+		var err error
+		if samba, err = s.serverService.GetSambaStatus(); err != nil {
+			tlog.DebugContext(s.ctx, "Unable to read Samba status for MQTT", "error", err)
+			samba = nil
+		}
+	}
+	s.collectShares(b, samba)
+
+	if samba != nil {
+		b.add(b.hub, "server", "samba", "sessions", "sensor", "Samba sessions",
+			map[string]any{"state_class": "measurement", "icon": "mdi:account-network"}, nil)
+		b.add(b.hub, "server", "samba", "open_files", "sensor", "Samba open files",
+			map[string]any{"state_class": "measurement", "icon": "mdi:file-lock"}, nil)
+		hubState["sessions"] = len(samba.Sessions)
+		hubState["open_files"] = len(samba.OpenFiles)
+	}
+	if health != nil {
+		b.add(b.hub, "server", "samba", "hdidle_running", "binary_sensor", "HDIdle",
+			map[string]any{"device_class": "running"}, nil)
+		hubState["hdidle_running"] = onOff(health.HDIdleRunning)
+	}
+	if len(hubState) > 0 {
+		b.state("server", "samba", hubState)
+	}
+	return b.snapshot
+}
+
+func (s *MQTTService) collectDisks(b *mqttBuilder, volumes []*dto.Disk, health *dto.DiskHealth) {
+	if health == nil {
+		return
+	}
+	disks := map[string]*dto.Disk{}
+	for _, disk := range volumes {
+		if disk != nil && disk.Id != nil {
+			disks[*disk.Id] = disk
+		}
+	}
+	io := map[string]dto.DiskIOStats{}
+	for _, d := range health.PerDiskIO {
+		io[d.DeviceDescription] = d
+	}
+	ids := slices.Collect(maps.Keys(io))
+	for id := range health.PerDiskInfo {
+		if _, ok := io[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		name, extra := id, map[string]any{}
+		if disk := disks[id]; disk != nil {
+			if disk.Model != nil && *disk.Model != "" {
+				name = *disk.Model
+				extra["model"] = *disk.Model
+			}
+			if disk.Vendor != nil && *disk.Vendor != "" {
+				extra["manufacturer"] = *disk.Vendor
+			}
+			if disk.Serial != nil && *disk.Serial != "" {
+				extra["serial_number"] = *disk.Serial
+			}
+			if disk.Revision != nil && *disk.Revision != "" {
+				extra["hw_version"] = *disk.Revision
+			}
+		}
+		device := b.device("disk", id, name, extra)
+		b.disks[id] = device
+		state := map[string]any{}
+
+		if d, ok := io[id]; ok {
+			b.add(device, "disk", id, "iops", "sensor", "IOPS",
+				map[string]any{"state_class": "measurement", "unit_of_measurement": "ops/s", "icon": "mdi:harddisk"}, nil)
+			state["iops"] = d.ReadIOPS + d.WriteIOPS
+
+			if smart := d.SmartData; smart != nil && smart.Enabled {
+				b.add(device, "disk", id, "temperature", "sensor", "Temperature",
+					map[string]any{"device_class": "temperature", "state_class": "measurement", "unit_of_measurement": "°C"}, nil)
+				b.add(device, "disk", id, "power_on_hours", "sensor", "Power on hours",
+					map[string]any{"device_class": "duration", "state_class": "total_increasing", "unit_of_measurement": "h", "entity_category": "diagnostic"}, nil)
+				b.add(device, "disk", id, "smart_problem", "binary_sensor", "SMART problem",
+					map[string]any{"device_class": "problem", "entity_category": "diagnostic"}, nil)
+				b.add(device, "disk", id, "smart_test_running", "binary_sensor", "SMART test running",
+					map[string]any{"device_class": "running", "entity_category": "diagnostic"}, nil)
+				// A disk in standby was not read, to let it sleep: the last
+				// published readings are kept.
+				if !smart.InStandby {
+					state["temperature"] = smart.Temperature.Value
+					state["power_on_hours"] = smart.PowerOnHours.Value
+				}
+				problem := smart.IsInWarning || smart.IsInDanger
+				if info, ok := health.PerDiskInfo[id]; ok && info.SmartHealth != nil && !info.SmartHealth.Passed {
+					problem = true
+				}
+				state["smart_problem"] = onOff(problem)
+				state["smart_test_running"] = onOff(smart.IsTestRunning)
+
+				if s.smartService != nil {
+					b.add(device, "disk", id, "smart_short_test", "button", "Start SMART short test",
+						map[string]any{"payload_press": "PRESS", "entity_category": "config", "icon": "mdi:stethoscope"},
+						&mqttTarget{kind: mqttTargetSmartTest, id: id, testType: dto.SmartTestTypes.SMARTTESTTYPESHORT})
+					b.add(device, "disk", id, "smart_long_test", "button", "Start SMART long test",
+						map[string]any{"payload_press": "PRESS", "entity_category": "config", "icon": "mdi:stethoscope"},
+						&mqttTarget{kind: mqttTargetSmartTest, id: id, testType: dto.SmartTestTypes.SMARTTESTTYPELONG})
+				}
+			}
+		}
+
+		if info, ok := health.PerDiskInfo[id]; ok && info.HDIdleStatus != nil {
+			b.add(device, "disk", id, "spun_down", "binary_sensor", "Spun down",
+				map[string]any{"icon": "mdi:sleep"}, nil)
+			state["spun_down"] = onOff(info.HDIdleStatus.SpunDown)
+		}
+		if s.hdidleService != nil {
+			b.add(device, "disk", id, "spin_down", "button", "Spin down",
+				map[string]any{"payload_press": "PRESS", "icon": "mdi:power-sleep"}, &mqttTarget{kind: mqttTargetSpinDown, id: id})
+		}
+		b.state("disk", id, state)
+	}
+}
+
+func (s *MQTTService) collectVolumes(b *mqttBuilder, volumes []*dto.Disk) {
+	type volume struct {
+		diskID string
+		name   string
+		mp     dto.MountPointData
+	}
+	var list []volume
+	for _, disk := range volumes {
+		if disk == nil || disk.Partitions == nil {
+			continue
+		}
+		for _, part := range *disk.Partitions {
+			if part.MountPointData == nil || (part.System != nil && *part.System) {
+				continue
+			}
+			for _, mp := range *part.MountPointData {
+				v := volume{name: path.Base(mp.Path), mp: mp}
+				if part.Name != nil && *part.Name != "" {
+					v.name = *part.Name
+				}
+				if disk.Id != nil {
+					v.diskID = *disk.Id
+				}
+				list = append(list, v)
+			}
+		}
+	}
+	slices.SortFunc(list, func(a, b volume) int { return strings.Compare(a.mp.Path, b.mp.Path) })
+
+	for _, v := range list {
+		// The volume belongs to its disk when the disk is announced.
+		device, ok := b.disks[v.diskID]
+		if !ok {
+			device = b.hub
+		}
+		var command *mqttTarget
+		if s.volumeService != nil {
+			command = &mqttTarget{kind: mqttTargetMount, id: v.mp.Path, mountPoint: v.mp}
+		}
+		b.add(device, "volume", v.mp.Path, "mounted", "switch", "Mount "+v.name,
+			map[string]any{"icon": "mdi:folder-network"}, command)
+		b.state("volume", v.mp.Path, map[string]any{"mounted": onOff(v.mp.IsMounted)})
+	}
+}
+
+func (s *MQTTService) collectShares(b *mqttBuilder, samba *dto.SambaStatus) {
+	if s.shareService == nil {
+		return
+	}
+	shares, err := s.shareService.ListShares()
+	if err != nil {
+		tlog.DebugContext(s.ctx, "Unable to list shares for MQTT", "error", err)
+		return
+	}
+	connections := map[string]int{}
+	if samba != nil {
+		for _, tcon := range samba.Tcons {
+			connections[tcon.Service]++
+		}
+	}
+	slices.SortFunc(shares, func(a, b dto.SharedResource) int { return strings.Compare(a.Name, b.Name) })
+	for _, share := range shares {
+		if share.Name == "" {
+			continue
+		}
+		device := b.device("share", share.Name, "Share "+share.Name, nil)
+		b.add(device, "share", share.Name, "enabled", "switch", "Enabled",
+			map[string]any{"icon": "mdi:folder-account"}, &mqttTarget{kind: mqttTargetShare, id: share.Name})
+		state := map[string]any{"enabled": onOff(share.Disabled == nil || !*share.Disabled)}
+		if samba != nil {
+			b.add(device, "share", share.Name, "connections", "sensor", "Connections",
+				map[string]any{"state_class": "measurement", "icon": "mdi:lan-connect"}, nil)
+			state["connections"] = connections[share.Name]
+		}
+		b.state("share", share.Name, state)
+	}
+}
@@ -0,0 +1,451 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/internal/mqtt"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+)
+
+const (
+	// mqttStateInterval is how often the states are published when no
+	// event asks for it sooner.
+	mqttStateInterval = time.Minute
+	// mqttMinBackoff and mqttMaxBackoff bound the wait before reconnecting
+	// to the broker, doubled after each failed attempt.
+	mqttMinBackoff = 5 * time.Second
+	mqttMaxBackoff = 5 * time.Minute
+	// mqttKeepAlive is the keep alive of the connection to the broker.
+	mqttKeepAlive = 30 * time.Second
+)
+
+var errMQTTReconfigure = errors.Base("mqtt settings changed")
+
+type MQTTServiceInterface interface {
+	// Status returns the state of the connection to the broker.
+	Status() dto.MQTTStatus
+}
+
+// mqttConfig is the part of the settings the connection depends on.
+type mqttConfig struct {
+	enabled         bool
+	addr            string
+	username        string
+	password        string
+	tls             bool
+	tlsInsecure     bool
+	topic           string
+	discoveryPrefix string
+}
+
+type MQTTService struct {
+	ctx              context.Context
+	state            *dto.ContextState
+	settingService   SettingServiceInterface
+	diskStatsService DiskStatsService
+	volumeService    VolumeServiceInterface
+	shareService     ShareServiceInterface
+	smartService     SmartServiceInterface
+	hdidleService    HDIdleServiceInterface
+	serverService    ServerServiceInterface
+	dial             func(ctx context.Context, opts mqtt.Options) (*mqtt.Client, error)
+
+	reconfigure chan struct{}
+	refresh     chan struct{}
+
+	// Owned by the run loop.
+	published map[string]string     // retained topic -> last payload
+	commands  map[string]mqttTarget // command topic -> target
+
+	mu     sync.Mutex
+	config mqttConfig
+	status dto.MQTTStatus
+}
+
+type MQTTServiceParams struct {
+	fx.In
+	Ctx              context.Context
+	State            *dto.ContextState
+	EventBus         events.EventBusInterface
+	SettingService   SettingServiceInterface
+	DiskStatsService DiskStatsService       `optional:"true"`
+	VolumeService    VolumeServiceInterface `optional:"true"`
+	ShareService     ShareServiceInterface  `optional:"true"`
+	SmartService     SmartServiceInterface  `optional:"true"`
+	HDIdleService    HDIdleServiceInterface `optional:"true"`
+	ServerService    ServerServiceInterface `optional:"true"`
+}
+
+func NewMQTTService(lc fx.Lifecycle, in MQTTServiceParams) MQTTServiceInterface {
+	s := &MQTTService{
+		ctx:              in.Ctx,
+		state:            in.State,
+		settingService:   in.SettingService,
+		diskStatsService: in.DiskStatsService,
+		volumeService:    in.VolumeService,
+		shareService:     in.ShareService,
+		smartService:     in.SmartService,
+		hdidleService:    in.HDIdleService,
+		serverService:    in.ServerService,
+		dial:             mqtt.Dial,
+		reconfigure:      make(chan struct{}, 1),
+		refresh:          make(chan struct{}, 1),
+	}
+
+	unsubscribe := []func(){
+		in.EventBus.OnSetting(func(ctx context.Context, event events.SettingEvent) errors.E {
+			if event.Setting == nil {
+				return nil
+			}
+			s.mu.Lock()
+			changed := mqttConfigFrom(event.Setting) != s.config
+			s.mu.Unlock()
+			if changed {
+				signal(s.reconfigure)
+			}
+			return nil
+		}),
+		in.EventBus.OnDisk(func(ctx context.Context, event events.DiskEvent) errors.E {
+			signal(s.refresh)
+			return nil
+		}),
+		in.EventBus.OnVolume(func(ctx context.Context, event events.VolumeEvent) errors.E {
+			signal(s.refresh)
+			return nil
+		}),
+		in.EventBus.OnMountPoint(func(ctx context.Context, event events.MountPointEvent) errors.E {
+			signal(s.refresh)
+			return nil
+		}),
+		in.EventBus.OnShare(func(ctx context.Context, event events.ShareEvent) errors.E {
+			signal(s.refresh)
+			return nil
+		}),
+		in.EventBus.OnSmart(func(ctx context.Context, event events.SmartEvent) errors.E {
+			signal(s.refresh)
+			return nil
+		}),
+		in.EventBus.OnPower(func(ctx context.Context, event events.PowerEvent) errors.E {
+			signal(s.refresh)
+			return nil
+		}),
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok && wg != nil {
+				wg.Go(s.run)
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			for _, unsub := range unsubscribe {
+				unsub()
+			}
+			return nil
+		},
+	})
+	return s
+}
+
+// signal wakes up the run loop without blocking, events arriving while it is
+// busy coalesce.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func mqttConfigFrom(settings *dto.Settings) mqttConfig {
+	useTLS := settings.MQTTTLS != nil && *settings.MQTTTLS
+	port := settings.MQTTPort
+	switch {
+	case port == 0 && useTLS:
+		port = 8883
+	case port == 0:
+		port = 1883
+	}
+	cfg := mqttConfig{
+		enabled:         settings.MQTTEnabled != nil && *settings.MQTTEnabled && settings.MQTTHost != "",
+		addr:            net.JoinHostPort(settings.MQTTHost, strconv.FormatUint(uint64(port), 10)),
+		username:        settings.MQTTUsername,
+		password:        settings.MQTTPassword.Expose(),
+		tls:             useTLS,
+		tlsInsecure:     useTLS && settings.MQTTTLSInsecure != nil && *settings.MQTTTLSInsecure,
+		topic:           strings.Trim(settings.MQTTTopic, "/"),
+		discoveryPrefix: strings.Trim(settings.MQTTDiscoveryPrefix, "/"),
+	}
+	if cfg.topic == "" {
+		cfg.topic = "srat"
+	}
+	if cfg.discoveryPrefix == "" {
+		cfg.discoveryPrefix = "homeassistant"
+	}
+	return cfg
+}
+
+func (s *MQTTService) Status() dto.MQTTStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *MQTTService) loadConfig() mqttConfig {
+	settings, err := s.settingService.Load()
+	if err != nil {
+		tlog.WarnContext(s.ctx, "Unable to load MQTT settings", "error", err)
+		return mqttConfig{}
+	}
+	cfg := mqttConfigFrom(settings)
+	s.mu.Lock()
+	s.config = cfg
+	s.status = dto.MQTTStatus{Enabled: cfg.enabled}
+	if cfg.enabled {
+		s.status.Broker = cfg.addr
+	}
+	s.mu.Unlock()
+	return cfg
+}
+
+// run keeps a connection to the broker while MQTT is enabled, reconnecting
+// with a growing backoff.
+func (s *MQTTService) run() {
+	backoff := mqttMinBackoff
+	for {
+		cfg := s.loadConfig()
+		if !cfg.enabled {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.reconfigure:
+				continue
+			}
+		}
+
+		err := s.session(cfg)
+		switch {
+		case s.ctx.Err() != nil:
+			return
+		case errors.Is(err, errMQTTReconfigure):
+			backoff = mqttMinBackoff
+			continue
+		case err != nil:
+			tlog.WarnContext(s.ctx, "MQTT connection failed", "broker", cfg.addr, "error", err, "retry_in", backoff)
+			s.mu.Lock()
+			s.status.Connected = false
+			s.status.ConnectedAt = nil
+			s.status.LastError = err.Error()
+			s.mu.Unlock()
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.reconfigure:
+			backoff = mqttMinBackoff
+		case <-time.After(backoff):
+			backoff = min(backoff*2, mqttMaxBackoff)
+		}
+	}
+}
+
+// session runs one connection to the broker until it is lost, the settings
+// change or SRAT stops.
+func (s *MQTTService) session(cfg mqttConfig) error {
+	incoming := make(chan mqtt.Message, 64)
+	dialCtx, cancel := context.WithTimeout(s.ctx, mqttKeepAlive)
+	defer cancel()
+	var tlsConfig *tls.Config
+	if cfg.tls {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: cfg.tlsInsecure} // #nosec G402
+	}
+	client, err := s.dial(dialCtx, mqtt.Options{
+		Addr:      cfg.addr,
+		ClientID:  "srat-" + mqttObjectID(cfg.topic),
+		Username:  cfg.username,
+		Password:  cfg.password,
+		TLS:       tlsConfig,
+		KeepAlive: mqttKeepAlive,
+		Will:      &mqtt.Message{Topic: cfg.availabilityTopic(), Payload: []byte("offline"), Retain: true},
+		OnMessage: func(msg mqtt.Message) {
+			select {
+			case incoming <- msg:
+			default:
+				tlog.DebugContext(s.ctx, "Dropping MQTT message, too many pending", "topic", msg.Topic)
+			}
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer client.Close()
+	now := time.Now()
+	s.mu.Lock()
+	s.status.Connected = true
+	s.status.ConnectedAt = &now
+	s.status.LastError = ""
+	s.mu.Unlock()
+	slog.InfoContext(s.ctx, "Connected to MQTT broker", "broker", cfg.addr)
+
+	s.published = make(map[string]string)
+	s.commands = make(map[string]mqttTarget)
+	if err := client.Subscribe(
+		cfg.topic+"/+/+/+/set",
+		cfg.discoveryPrefix+"/status",
+		cfg.discoveryPrefix+"/+/"+mqttObjectID(cfg.topic)+"/+/config",
+	); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := s.publishAll(client, cfg); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(mqttStateInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-s.ctx.Done():
+			_ = client.Publish(mqtt.Message{Topic: cfg.availabilityTopic(), Payload: []byte("offline"), Retain: true})
+			return nil
+		case <-s.reconfigure:
+			_ = client.Publish(mqtt.Message{Topic: cfg.availabilityTopic(), Payload: []byte("offline"), Retain: true})
+			return errMQTTReconfigure
+		case <-client.Done():
+			return errors.WithStack(client.Err())
+		case <-s.refresh:
+			err = s.publishAll(client, cfg)
+		case <-ticker.C:
+			err = s.publishAll(client, cfg)
+		case msg := <-incoming:
+			err = s.handleMessage(client, cfg, msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// publishAll announces the current entities, removes the gone ones and
+// publishes the states. Unchanged retained payloads are not sent again.
+func (s *MQTTService) publishAll(client *mqtt.Client, cfg mqttConfig) error {
+	snapshot := s.collect(cfg)
+
+	configs := make(map[string]bool, len(snapshot.entities))
+	for _, entity := range snapshot.entities {
+		topic := cfg.discoveryTopic(entity)
+		configs[topic] = true
+		if err := s.publishRetained(client, topic, entity.payload()); err != nil {
+			return err
+		}
+	}
+	for topic := range s.published {
+		if strings.HasPrefix(topic, cfg.discoveryPrefix+"/") && !configs[topic] {
+			if err := s.publishRetained(client, topic, ""); err != nil {
+				return err
+			}
+			delete(s.published, topic)
+		}
+	}
+	if err := s.publishRetained(client, cfg.availabilityTopic(), "online"); err != nil {
+		return err
+	}
+	for topic, payload := range snapshot.states {
+		if err := s.publishRetained(client, topic, payload); err != nil {
+			return err
+		}
+	}
+	s.commands = snapshot.commands
+
+	s.mu.Lock()
+	s.status.Entities = len(snapshot.entities)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MQTTService) publishRetained(client *mqtt.Client, topic, payload string) error {
+	if last, ok := s.published[topic]; ok && last == payload {
+		return nil
+	}
+	if err := client.Publish(mqtt.Message{Topic: topic, Payload: []byte(payload), Retain: true}); err != nil {
+		return errors.WithStack(err)
+	}
+	s.published[topic] = payload
+	return nil
+}
+
+// handleMessage runs a command, announces everything again when Home
+// Assistant restarts and removes the entities a previous run announced and
+// this one does not know.
+func (s *MQTTService) handleMessage(client *mqtt.Client, cfg mqttConfig, msg mqtt.Message) error {
+	switch {
+	case msg.Topic == cfg.discoveryPrefix+"/status":
+		if string(msg.Payload) == "online" {
+			tlog.DebugContext(s.ctx, "Home Assistant is online, announcing the MQTT entities again")
+			s.published = make(map[string]string)
+			return s.publishAll(client, cfg)
+		}
+	case strings.HasPrefix(msg.Topic, cfg.discoveryPrefix+"/"):
+		if _, ours := s.published[msg.Topic]; !ours && len(msg.Payload) > 0 {
+			tlog.DebugContext(s.ctx, "Removing stale MQTT entity", "topic", msg.Topic)
+			if err := client.Publish(mqtt.Message{Topic: msg.Topic, Retain: true}); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	default:
+		target, ok := s.commands[msg.Topic]
+		if !ok {
+			tlog.DebugContext(s.ctx, "Ignoring MQTT command for an unknown entity", "topic", msg.Topic)
+			return nil
+		}
+		if err := s.runCommand(target, strings.TrimSpace(string(msg.Payload))); err != nil {
+			tlog.WarnContext(s.ctx, "MQTT command failed", "topic", msg.Topic, "payload", string(msg.Payload), "error", err)
+		}
+		return s.publishAll(client, cfg)
+	}
+	return nil
+}
+
+// runCommand runs a command received on the command topic of an entity.
+func (s *MQTTService) runCommand(target mqttTarget, payload string) errors.E {
+	if s.state != nil && s.state.ReadOnlyMode {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "reason", "SRAT is in read-only mode")
+	}
+	tlog.InfoContext(s.ctx, "Running MQTT command", "kind", target.kind, "target", target.id, "payload", payload)
+	switch target.kind {
+	case mqttTargetMount:
+		switch payload {
+		case "ON":
+			mountPoint := target.mountPoint
+			return s.volumeService.MountVolume(&mountPoint)
+		case "OFF":
+			return s.volumeService.UnmountVolume(target.id, false)
+		}
+	case mqttTargetShare:
+		var err errors.E
+		switch payload {
+		case "ON":
+			_, err = s.shareService.EnableShare(target.id)
+			return err
+		case "OFF":
+			_, err = s.shareService.DisableShare(target.id)
+			return err
+		}
+	case mqttTargetSmartTest:
+		return s.smartService.BeginSelfTest(s.ctx, target.id, target.testType)
+	case mqttTargetSpinDown:
+		return s.hdidleService.SpinDown(target.id)
+	}
+	return errors.WithDetails(dto.ErrorInvalidParameter, "reason", "unsupported payload", "payload", payload)
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angusgmorrison/logfusc"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/mqtt"
+	"github.com/dianlight/srat/internal/mqtt/mqtttest"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MQTTServiceSuite struct {
+	suite.Suite
+	broker           *mqtttest.Broker
+	settings         *dto.Settings
+	settingService   SettingServiceInterface
+	diskStatsService DiskStatsService
+	shareService     ShareServiceInterface
+	smartService     SmartServiceInterface
+	hdidleService    HDIdleServiceInterface
+	serverService    ServerServiceInterface
+	state            *dto.ContextState
+	service          *MQTTService
+	cancel           context.CancelFunc
+	done             chan struct{}
+	// commands receives the commands the mocks run.
+	commands chan string
+}
+
+func TestMQTTServiceSuite(t *testing.T) {
+	suite.Run(t, new(MQTTServiceSuite))
+}
+
+func (suite *MQTTServiceSuite) SetupTest() {
+	suite.broker = mqtttest.NewBroker(suite.T())
+	host, port, err := net.SplitHostPort(suite.broker.Addr())
+	suite.Require().NoError(err)
+	portNumber, err := strconv.Atoi(port)
+	suite.Require().NoError(err)
+	suite.settings = &dto.Settings{
+		MQTTEnabled:         new(true),
+		MQTTHost:            host,
+		MQTTPort:            uint(portNumber),
+		MQTTTopic:           "srat",
+		MQTTDiscoveryPrefix: "homeassistant",
+	}
+	suite.commands = make(chan string, 10)
+	suite.state = &dto.ContextState{}
+
+	ctrl := mock.NewMockController(suite.T())
+	suite.settingService = mock.Mock[SettingServiceInterface](ctrl)
+	mock.When(suite.settingService.Load()).ThenAnswer(func(args []any) []any {
+		return []any{suite.settings, nil}
+	})
+	suite.diskStatsService = mock.Mock[DiskStatsService](ctrl)
+	mock.When(suite.diskStatsService.GetDiskStats()).ThenReturn(&dto.DiskHealth{
+		PerDiskIO: []dto.DiskIOStats{{
+			DeviceName:        "sda",
+			DeviceDescription: "sda",
+			ReadIOPS:          2,
+			WriteIOPS:         3,
+			SmartData: &dto.SmartStatus{
+				Enabled:      true,
+				Temperature:  dto.SmartTempValue{Value: 35},
+				PowerOnHours: dto.SmartRangeValue{Value: 1200},
+			},
+		}},
+		PerDiskInfo: map[string]dto.PerDiskInfo{
+			"sda": {
+				DeviceId:     "sda",
+				SmartHealth:  &dto.SmartHealthStatus{Passed: false},
+				HDIdleStatus: &dto.HDIdleDeviceStatus{SpunDown: false},
+			},
+		},
+		HDIdleRunning: true,
+	}, nil)
+	suite.shareService = mock.Mock[ShareServiceInterface](ctrl)
+	mock.When(suite.shareService.ListShares()).ThenReturn([]dto.SharedResource{{Name: "media"}}, nil)
+	mock.When(suite.shareService.DisableShare(mock.Any[string]())).ThenAnswer(func(args []any) []any {
+		suite.commands <- "disable " + args[0].(string)
+		return []any{&dto.SharedResource{Name: args[0].(string)}, nil}
+	})
+	suite.smartService = mock.Mock[SmartServiceInterface](ctrl)
+	mock.When(suite.smartService.BeginSelfTest(mock.AnyContext(), mock.Any[string](), mock.Any[dto.SmartTestType]())).ThenAnswer(func(args []any) []any {
+		suite.commands <- "smart " + args[1].(string) + " " + args[2].(dto.SmartTestType).String()
+		return []any{nil}
+	})
+	suite.hdidleService = mock.Mock[HDIdleServiceInterface](ctrl)
+	mock.When(suite.hdidleService.SpinDown(mock.Any[string]())).ThenAnswer(func(args []any) []any {
+		suite.commands <- "spin down " + args[0].(string)
+		return []any{nil}
+	})
+	suite.serverService = mock.Mock[ServerServiceInterface](ctrl)
+	mock.When(suite.serverService.GetSambaStatus()).ThenReturn(&dto.SambaStatus{
+		Sessions: map[string]dto.SambaSession{"1": {SessionID: "1"}},
+		Tcons:    map[string]dto.SambaTcon{"1": {SessionID: "1", Service: "media"}},
+	}, nil)
+}
+
+// start runs the service until the end of the test.
+func (suite *MQTTServiceSuite) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.cancel = cancel
+	suite.service = &MQTTService{
+		ctx:              ctx,
+		state:            suite.state,
+		settingService:   suite.settingService,
+		diskStatsService: suite.diskStatsService,
+		shareService:     suite.shareService,
+		smartService:     suite.smartService,
+		hdidleService:    suite.hdidleService,
+		serverService:    suite.serverService,
+		dial:             mqtt.Dial,
+		reconfigure:      make(chan struct{}, 1),
+		refresh:          make(chan struct{}, 1),
+	}
+	suite.done = make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(suite.service.run)
+	go func() {
+		wg.Wait()
+		close(suite.done)
+	}()
+	suite.Eventually(func() bool { return suite.service.Status().Connected }, 5*time.Second, 10*time.Millisecond)
+}
+
+func (suite *MQTTServiceSuite) stop() {
+	if suite.cancel == nil {
+		return
+	}
+	suite.cancel()
+	suite.cancel = nil
+	select {
+	case <-suite.done:
+	case <-time.After(5 * time.Second):
+		suite.Fail("MQTT service did not stop")
+	}
+}
+
+func (suite *MQTTServiceSuite) TearDownTest() {
+	suite.stop()
+}
+
+func (suite *MQTTServiceSuite) retainedJSON(topic string) map[string]any {
+	var msg mqtt.Message
+	suite.Eventually(func() bool {
+		var ok bool
+		msg, ok = suite.broker.Retained(topic)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond, "no retained message on %s", topic)
+	var payload map[string]any
+	suite.Require().NoError(json.Unmarshal(msg.Payload, &payload), string(msg.Payload))
+	return payload
+}
+
+// offline waits for the availability topic to tell the entities are gone.
+func (suite *MQTTServiceSuite) offline(broker *mqtttest.Broker, topic string) {
+	suite.Eventually(func() bool {
+		msg, ok := broker.Retained(topic)
+		return ok && string(msg.Payload) == "offline"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (suite *MQTTServiceSuite) expectCommand(want string) {
+	select {
+	case got := <-suite.commands:
+		suite.Equal(want, got)
+	case <-time.After(5 * time.Second):
+		suite.Fail("command not run", want)
+	}
+}
+
+func (suite *MQTTServiceSuite) TestPublishesDiscoveryAndStates() {
+	suite.start()
+
+	config := suite.retainedJSON("homeassistant/sensor/srat/disk_sda_temperature/config")
+	suite.Equal("srat/disk/sda/state", config["state_topic"])
+	suite.Equal("{{ value_json.temperature }}", config["value_template"])
+	suite.Equal("srat/status", config["availability_topic"])
+	suite.Equal("temperature", config["device_class"])
+	suite.Equal("srat_disk_sda_temperature", config["unique_id"])
+
+	spinDown := suite.retainedJSON("homeassistant/button/srat/disk_sda_spin_down/config")
+	suite.Equal("srat/disk/sda/spin_down/set", spinDown["command_topic"])
+	shareSwitch := suite.retainedJSON("homeassistant/switch/srat/share_media_enabled/config")
+	suite.Equal("srat/share/media/enabled/set", shareSwitch["command_topic"])
+	suite.retainedJSON("homeassistant/button/srat/disk_sda_smart_long_test/config")
+	suite.retainedJSON("homeassistant/sensor/srat/server_samba_sessions/config")
+
+	disk := suite.retainedJSON("srat/disk/sda/state")
+	suite.EqualValues(35, disk["temperature"])
+	suite.EqualValues(1200, disk["power_on_hours"])
+	suite.EqualValues(5, disk["iops"])
+	suite.Equal("ON", disk["smart_problem"], "the SMART health check failed")
+	suite.Equal("OFF", disk["spun_down"])
+	share := suite.retainedJSON("srat/share/media/state")
+	suite.Equal("ON", share["enabled"])
+	suite.EqualValues(1, share["connections"])
+	server := suite.retainedJSON("srat/server/samba/state")
+	suite.EqualValues(1, server["sessions"])
+	suite.Equal("ON", server["hdidle_running"])
+
+	status, ok := suite.broker.Retained("srat/status")
+	suite.Require().True(ok)
+	suite.Equal("online", string(status.Payload))
+	suite.Positive(suite.service.Status().Entities)
+
+	suite.stop()
+	suite.offline(suite.broker, "srat/status")
+}
+
+func (suite *MQTTServiceSuite) TestUnchangedStatesAreNotPublishedAgain() {
+	suite.start()
+	suite.retainedJSON("srat/disk/sda/state")
+	before := len(suite.broker.Published())
+
+	signal(suite.service.refresh)
+	// A command round trip orders the check after the refresh.
+	suite.broker.Publish(mqtt.Message{Topic: "srat/disk/sda/spin_down/set", Payload: []byte("PRESS")})
+	suite.expectCommand("spin down sda")
+	suite.Never(func() bool { return len(suite.broker.Published()) != before }, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func (suite *MQTTServiceSuite) TestCommands() {
+	suite.start()
+	suite.retainedJSON("homeassistant/switch/srat/share_media_enabled/config")
+
+	suite.broker.Publish(mqtt.Message{Topic: "srat/share/media/enabled/set", Payload: []byte("OFF")})
+	suite.expectCommand("disable media")
+	suite.broker.Publish(mqtt.Message{Topic: "srat/disk/sda/smart_short_test/set", Payload: []byte("PRESS")})
+	suite.expectCommand("smart sda short")
+	suite.broker.Publish(mqtt.Message{Topic: "srat/disk/sda/spin_down/set", Payload: []byte("PRESS")})
+	suite.expectCommand("spin down sda")
+
+	// Unknown entities are ignored.
+	suite.broker.Publish(mqtt.Message{Topic: "srat/disk/sdz/spin_down/set", Payload: []byte("PRESS")})
+	suite.broker.Publish(mqtt.Message{Topic: "srat/disk/sda/spin_down/set", Payload: []byte("PRESS")})
+	suite.expectCommand("spin down sda")
+}
+
+func (suite *MQTTServiceSuite) TestCommandsIgnoredInReadOnlyMode() {
+	suite.state.ReadOnlyMode = true
+	suite.start()
+	suite.retainedJSON("homeassistant/button/srat/disk_sda_spin_down/config")
+
+	suite.broker.Publish(mqtt.Message{Topic: "srat/disk/sda/spin_down/set", Payload: []byte("PRESS")})
+	suite.Never(func() bool { return len(suite.commands) > 0 }, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func (suite *MQTTServiceSuite) TestStaleEntitiesAreRemoved() {
+	stale := "homeassistant/sensor/srat/disk_sdb_temperature/config"
+	suite.broker.Publish(mqtt.Message{Topic: stale, Payload: []byte(`{"name":"Temperature"}`), Retain: true})
+	suite.start()
+
+	suite.Eventually(func() bool {
+		_, ok := suite.broker.Retained(stale)
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+	_, ok := suite.broker.Retained("homeassistant/sensor/srat/disk_sda_temperature/config")
+	suite.True(ok)
+}
+
+func (suite *MQTTServiceSuite) TestReconnectsWithNewSettings() {
+	suite.start()
+	suite.retainedJSON("homeassistant/sensor/srat/disk_sda_temperature/config")
+
+	other := mqtttest.NewBroker(suite.T())
+	host, port, err := net.SplitHostPort(other.Addr())
+	suite.Require().NoError(err)
+	portNumber, err := strconv.Atoi(port)
+	suite.Require().NoError(err)
+	suite.settings = &dto.Settings{
+		MQTTEnabled: new(true),
+		MQTTHost:    host,
+		MQTTPort:    uint(portNumber),
+		MQTTTopic:   "nas",
+	}
+	signal(suite.service.reconfigure)
+
+	msg := other.WaitFor(suite.T(), "nas/status", 5*time.Second)
+	suite.Equal("online", string(msg.Payload))
+	other.WaitFor(suite.T(), "homeassistant/sensor/nas/disk_sda_temperature/config", 5*time.Second)
+	suite.offline(suite.broker, "srat/status")
+}
+
+func (suite *MQTTServiceSuite) TestConnectsOverTLS() {
+	broker, _ := mqtttest.NewTLSBroker(suite.T())
+	broker.RequireCredentials("srat", "secret")
+	host, port, err := net.SplitHostPort(broker.Addr())
+	suite.Require().NoError(err)
+	portNumber, err := strconv.Atoi(port)
+	suite.Require().NoError(err)
+	suite.settings.MQTTHost = host
+	suite.settings.MQTTPort = uint(portNumber)
+	suite.settings.MQTTUsername = "srat"
+	suite.settings.MQTTPassword = logfusc.NewSecret("secret")
+	suite.settings.MQTTTLS = new(true)
+	suite.settings.MQTTTLSInsecure = new(true)
+	suite.start()
+
+	msg := broker.WaitFor(suite.T(), "srat/status", 5*time.Second)
+	suite.Equal("online", string(msg.Payload))
+}
+
+func (suite *MQTTServiceSuite) TestDisabled() {
+	suite.settings.MQTTEnabled = new(false)
+	suite.service = &MQTTService{
+		ctx:            context.Background(),
+		settingService: suite.settingService,
+	}
+	suite.service.loadConfig()
+	suite.Equal(dto.MQTTStatus{}, suite.service.Status())
+}
@@ -33,12 +33,14 @@ type networkStatsService struct {
 	updateMutex      *sync.Mutex
 	settingService   SettingServiceInterface
 	cachedSetting    *dto.Settings
+	statsHistory     StatsHistoryServiceInterface
 }
 
 // NewNetworkStatsService creates a new NetworkStatsService.
 func NewNetworkStatsService(lc fx.Lifecycle,
 	Ctx context.Context,
 	settingService SettingServiceInterface,
+	statsHistory StatsHistoryServiceInterface,
 	// prop_repo repository.PropertyRepositoryInterface,
 ) NetworkStatsService {
 	fs, err := procfs.NewFS("/proc")
@@ -57,6 +59,7 @@ func NewNetworkStatsService(lc fx.Lifecycle,
 		sysfs:          &sfs,
 		ctx:            Ctx,
 		settingService: settingService,
+		statsHistory:   statsHistory,
 		lastUpdateTime: time.Now(),
 		updateMutex:    &sync.Mutex{},
 		lastStats:      make(map[string]procfs.NetDevLine),
@@ -214,9 +217,28 @@ func (s *networkStatsService) updateNetworkStats(reloadSettings bool) error {
 	}
 
 	s.lastUpdateTime = time.Now()
+	s.recordHistory()
 	return nil
 }
 
+// recordHistory stores the throughput of the interfaces in the statistics
+// history.
+func (s *networkStatsService) recordHistory() {
+	if s.statsHistory == nil || len(s.currentNetHealth.PerNicIO) == 0 {
+		return
+	}
+	samples := make([]dto.StatsSample, 0, 2*len(s.currentNetHealth.PerNicIO))
+	for _, nic := range s.currentNetHealth.PerNicIO {
+		samples = append(samples,
+			dto.StatsSample{Metric: dto.StatsNetworkReceive, Series: nic.DeviceName, Value: nic.InboundTraffic},
+			dto.StatsSample{Metric: dto.StatsNetworkTransmit, Series: nic.DeviceName, Value: nic.OutboundTraffic},
+		)
+	}
+	if err := s.statsHistory.Record(s.ctx, s.lastUpdateTime, samples...); err != nil {
+		tlog.DebugContext(s.ctx, "Failed to record network statistics", "error", err)
+	}
+}
+
 // GetNetworkStats collects and returns network I/O statistics.
 func (s *networkStatsService) GetNetworkStats() (*dto.NetworkStats, errors.E) {
 	s.updateMutex.Lock()
@@ -56,6 +56,7 @@ func (suite *NetworkStatsServiceSuite) SetupTest() {
 			dbom.NewDB,
 			events.NewEventBus,
 			service.NewNetworkStatsService,
+			service.NewStatsHistoryService,
 			service.NewSettingService,
 		),
 		fx.Populate(&suite.ctrl),
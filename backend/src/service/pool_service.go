@@ -0,0 +1,567 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/dianlight/srat/service/filesystem"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// poolDiskPrefix prefixes the id of the disk, and of its only partition,
+// exposing a pool, followed by the pool name.
+const poolDiskPrefix = "pool-"
+
+// poolCreatePolicies are the mergerfs create policies a pool can use.
+var poolCreatePolicies = []string{"epmfs", "mfs", "lfs"}
+
+type PoolServiceInterface interface {
+	// ListPools returns the pools with the aggregate space of their members.
+	ListPools() ([]dto.StoragePool, errors.E)
+	// CreatePool pools mounted volumes together in a mergerfs union, mounts
+	// it and exposes it as a volume shares can be created on.
+	CreatePool(request dto.StoragePoolCreateRequest) (*dto.StoragePool, errors.E)
+	// MountPool mounts a pool again once all its members are mounted.
+	MountPool(name string) (*dto.StoragePool, errors.E)
+	// DeletePool unmounts a pool no share uses and forgets it. The files on
+	// the members are left untouched.
+	DeletePool(name string) errors.E
+	// MountedPoolOf returns the name of the mounted pool the volume mounted
+	// on path is a member of.
+	MountedPoolOf(path string) (string, bool)
+}
+
+type PoolService struct {
+	ctx       context.Context
+	state     *dto.ContextState
+	db        *gorm.DB
+	disks     *dto.DiskMap
+	eventBus  events.EventBusInterface
+	fsService FilesystemServiceInterface
+	mountRoot string
+	isMounted func(path string) (bool, error)
+
+	opMu      sync.Mutex
+	mu        sync.Mutex
+	attempted map[string]bool // pools the startup mount was tried on
+	degraded  map[string]bool // pools unmounted as a member went away
+}
+
+type PoolServiceParams struct {
+	fx.In
+	Ctx               context.Context
+	State             *dto.ContextState
+	Db                *gorm.DB
+	Disks             *dto.DiskMap
+	EventBus          events.EventBusInterface
+	FilesystemService FilesystemServiceInterface
+}
+
+func NewPoolService(lc fx.Lifecycle, in PoolServiceParams) PoolServiceInterface {
+	s := &PoolService{
+		ctx:       in.Ctx,
+		state:     in.State,
+		db:        in.Db,
+		disks:     in.Disks,
+		eventBus:  in.EventBus,
+		fsService: in.FilesystemService,
+		mountRoot: "/mnt",
+		isMounted: osutil.IsMounted,
+		attempted: make(map[string]bool),
+		degraded:  make(map[string]bool),
+	}
+
+	var unsubscribe func()
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			unsubscribe = in.EventBus.OnMountPoint(s.handleMountPointEvent)
+			pools, errE := s.load()
+			if errE != nil {
+				slog.WarnContext(s.ctx, "Failed to load the storage pools", "err", errE)
+				return nil
+			}
+			for i := range pools {
+				s.expose(&pools[i])
+				s.mountAtStartup(&pools[i])
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			if unsubscribe != nil {
+				unsubscribe()
+			}
+			return nil
+		},
+	})
+
+	return s
+}
+
+func (s *PoolService) ListPools() ([]dto.StoragePool, errors.E) {
+	pools, errE := s.load()
+	if errE != nil {
+		return nil, errE
+	}
+	ret := make([]dto.StoragePool, 0, len(pools))
+	for i := range pools {
+		ret = append(ret, *s.expose(&pools[i]))
+	}
+	return ret, nil
+}
+
+func (s *PoolService) CreatePool(request dto.StoragePoolCreateRequest) (*dto.StoragePool, errors.E) {
+	if s.state.ProtectedMode {
+		return nil, errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "CreatePool", "reason", "creating a pool is not permitted when ProtectedMode is enabled")
+	}
+	pool := &dbom.StoragePool{
+		Name:               request.Name,
+		Path:               filepath.Join(s.mountRoot, request.Name),
+		CreatePolicy:       request.CreatePolicy,
+		Members:            slices.Clone(request.Members),
+		IsToMountAtStartup: true,
+	}
+	if pool.CreatePolicy == "" {
+		pool.CreatePolicy = poolCreatePolicies[0]
+	}
+	if errE := s.validate(pool); errE != nil {
+		return nil, errE
+	}
+
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	if _, err := gorm.G[dbom.StoragePool](s.db).Where(g.StoragePool.Name.Eq(pool.Name)).First(s.ctx); err == nil {
+		return nil, errors.WithDetails(dto.ErrorConflict, "Pool", pool.Name, "reason", "a pool with this name already exists")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.WithStack(err)
+	}
+	if _, ok := s.disks.GetMountPointByPath(pool.Path); ok {
+		return nil, errors.WithDetails(dto.ErrorConflict, "Pool", pool.Name, "reason", pool.Path+" is already a mount point")
+	}
+
+	if errE := s.mount(pool); errE != nil {
+		return nil, errE
+	}
+	if errE := s.persist(pool); errE != nil {
+		if err := s.fsService.UnmountPartition(s.ctx, pool.Path, filesystem.MergerfsFsType, false, false); err != nil {
+			slog.WarnContext(s.ctx, "Failed to unmount a pool that could not be stored", "pool", pool.Name, "err", err)
+		}
+		return nil, errE
+	}
+	slog.InfoContext(s.ctx, "Created storage pool", "pool", pool.Name, "members", pool.Members, "policy", pool.CreatePolicy)
+	return s.expose(pool), nil
+}
+
+func (s *PoolService) MountPool(name string) (*dto.StoragePool, errors.E) {
+	if s.state.ProtectedMode {
+		return nil, errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "MountPool", "reason", "mounting a pool is not permitted when ProtectedMode is enabled")
+	}
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	pool, errE := s.get(name)
+	if errE != nil {
+		return nil, errE
+	}
+	if mounted, _ := s.isMounted(pool.Path); mounted {
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "Pool", name, "reason", "the pool is already mounted")
+	}
+	if member, ok := s.unmountedMember(pool); ok {
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "Pool", name, "reason", "the member "+member+" is not mounted")
+	}
+	if errE := s.mount(pool); errE != nil {
+		return nil, errE
+	}
+	return s.expose(pool), nil
+}
+
+func (s *PoolService) DeletePool(name string) errors.E {
+	if s.state.ProtectedMode {
+		return errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "DeletePool", "reason", "deleting a pool is not permitted when ProtectedMode is enabled")
+	}
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	pool, errE := s.get(name)
+	if errE != nil {
+		return errE
+	}
+	shares, err := gorm.G[dbom.ExportedShare](s.db).Where(g.ExportedShare.MountPointDataPath.Eq(pool.Path)).Find(s.ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(shares) > 0 {
+		names := make([]string, 0, len(shares))
+		for _, share := range shares {
+			names = append(names, share.Name)
+		}
+		return errors.WithDetails(dto.ErrorInvalidStateForOperation,
+			"Pool", name, "reason", "the pool is shared as "+strings.Join(names, ", "))
+	}
+
+	if mounted, _ := s.isMounted(pool.Path); mounted {
+		if errE := s.fsService.UnmountPartition(s.ctx, pool.Path, filesystem.MergerfsFsType, false, false); errE != nil {
+			return errors.WithDetails(dto.ErrorUnmountFail, "Pool", name, "Path", pool.Path, "reason", errE.Error())
+		}
+		if err := os.Remove(pool.Path); err != nil && !os.IsNotExist(err) {
+			slog.WarnContext(s.ctx, "Failed to remove the mount point of a pool", "path", pool.Path, "err", err)
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := gorm.G[dbom.StoragePool](tx).Where(g.StoragePool.Name.Eq(pool.Name)).Delete(s.ctx); err != nil {
+			return err
+		}
+		_, err := gorm.G[dbom.MountPointPath](tx.Unscoped()).Where(g.MountPointPath.Path.Eq(pool.Path)).Delete(s.ctx)
+		return err
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	diskID := poolDiskPrefix + pool.Name
+	if disk, ok := s.disks.Get(diskID); ok {
+		s.disks.Remove(diskID)
+		s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.REMOVE}, Disk: disk})
+	}
+	s.mu.Lock()
+	delete(s.attempted, pool.Name)
+	delete(s.degraded, pool.Name)
+	s.mu.Unlock()
+	slog.InfoContext(s.ctx, "Deleted storage pool", "pool", pool.Name)
+	return nil
+}
+
+func (s *PoolService) MountedPoolOf(path string) (string, bool) {
+	pools, errE := s.load()
+	if errE != nil {
+		slog.WarnContext(s.ctx, "Failed to load the storage pools", "err", errE)
+		return "", false
+	}
+	for _, pool := range pools {
+		if !slices.Contains(pool.Members, path) {
+			continue
+		}
+		if mounted, _ := s.isMounted(pool.Path); mounted {
+			return pool.Name, true
+		}
+	}
+	return "", false
+}
+
+// validate checks the members of a new pool are distinct mounted volumes.
+func (s *PoolService) validate(pool *dbom.StoragePool) errors.E {
+	if pool.Name == "" || strings.ContainsAny(pool.Name, "/:,") {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "Pool", pool.Name, "reason", "the pool name is not valid")
+	}
+	if !slices.Contains(poolCreatePolicies, pool.CreatePolicy) {
+		return errors.WithDetails(dto.ErrorInvalidParameter,
+			"Pool", pool.Name, "reason", "the create policy must be one of "+strings.Join(poolCreatePolicies, ", "))
+	}
+	if len(pool.Members) < 2 {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "Pool", pool.Name, "reason", "a pool needs at least two members")
+	}
+	for i, member := range pool.Members {
+		member = filepath.Clean(member)
+		pool.Members[i] = member
+		// mergerfs separates the branches with ':' and its options with ','.
+		if strings.ContainsAny(member, ":,") {
+			return errors.WithDetails(dto.ErrorInvalidParameter, "Pool", pool.Name, "reason", "the member "+member+" has a ':' or ',' in its path")
+		}
+		mp, ok := s.disks.GetMountPointByPath(member)
+		if !ok {
+			return errors.WithDetails(dto.ErrorInvalidParameter, "Pool", pool.Name, "reason", member+" is not a volume mount point")
+		}
+		if !mp.IsMounted {
+			return errors.WithDetails(dto.ErrorInvalidParameter, "Pool", pool.Name, "reason", "the member "+member+" is not mounted")
+		}
+		if strings.HasPrefix(mp.DeviceId, poolDiskPrefix) {
+			return errors.WithDetails(dto.ErrorInvalidParameter, "Pool", pool.Name, "reason", "the member "+member+" is a pool")
+		}
+		for _, other := range pool.Members[:i] {
+			if member == other || strings.HasPrefix(member+"/", other+"/") || strings.HasPrefix(other+"/", member+"/") {
+				return errors.WithDetails(dto.ErrorInvalidParameter,
+					"Pool", pool.Name, "reason", "the members "+other+" and "+member+" overlap")
+			}
+		}
+	}
+	return nil
+}
+
+// mount mounts the mergerfs union of a pool. The options let Samba, running
+// as another user, in and spread the writes as the create policy says.
+func (s *PoolService) mount(pool *dbom.StoragePool) errors.E {
+	data := strings.Join([]string{
+		"allow_other",
+		"cache.files=off",
+		"dropcacheonclose=true",
+		"moveonenospc=true",
+		"category.create=" + pool.CreatePolicy,
+		"fsname=" + poolDiskPrefix + pool.Name,
+	}, ",")
+	_, errE := s.fsService.MountPartition(s.ctx, strings.Join(pool.Members, ":"), pool.Path, "mergerfs", data, 0, func() error {
+		return os.MkdirAll(pool.Path, 0o750)
+	})
+	if errE != nil {
+		return errors.WithDetails(dto.ErrorMountFail, "Pool", pool.Name, "Path", pool.Path, "reason", errE.Error())
+	}
+	s.mu.Lock()
+	delete(s.degraded, pool.Name)
+	s.mu.Unlock()
+	return nil
+}
+
+// persist stores a pool with its mount point, which the shares of the pool
+// refer to.
+func (s *PoolService) persist(pool *dbom.StoragePool) errors.E {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := gorm.G[dbom.StoragePool](tx).Create(s.ctx, pool); err != nil {
+			return err
+		}
+		// The pool service mounts the union at startup, the volume service
+		// cannot as a union has no device.
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&dbom.MountPointPath{
+			Path:               pool.Path,
+			Root:               new("/"),
+			Type:               "ADDON",
+			DeviceId:           poolDiskPrefix + pool.Name,
+			FSType:             filesystem.MergerfsFsType,
+			IsToMountAtStartup: new(false),
+		}).Error
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// expose shows a pool as a disk with a single partition mounted on the pool
+// path, and returns the pool state.
+func (s *PoolService) expose(pool *dbom.StoragePool) *dto.StoragePool {
+	diskID := poolDiskPrefix + pool.Name
+	ret := &dto.StoragePool{
+		Name:               pool.Name,
+		Path:               pool.Path,
+		CreatePolicy:       pool.CreatePolicy,
+		Members:            slices.Clone(pool.Members),
+		IsToMountAtStartup: pool.IsToMountAtStartup,
+		PartitionId:        diskID,
+	}
+	ret.IsMounted, _ = s.isMounted(pool.Path)
+	s.mu.Lock()
+	ret.Degraded = s.degraded[pool.Name]
+	s.mu.Unlock()
+	ret.Size, ret.Free = poolSpace(pool.Members)
+	if s.disks == nil {
+		return ret
+	}
+
+	mp := dto.MountPointData{
+		Path:               pool.Path,
+		Root:               "/",
+		Type:               "ADDON",
+		FSType:             new(filesystem.MergerfsFsType),
+		DeviceId:           diskID,
+		IsMounted:          ret.IsMounted,
+		IsToMountAtStartup: new(false),
+		Flags:              &dto.MountFlags{},
+		CustomFlags:        &dto.MountFlags{},
+	}
+	if ret.IsMounted {
+		mp.IsWriteSupported = new(osutil.IsWritable(pool.Path))
+	}
+	existing, known := s.disks.Get(diskID)
+	wasMounted := false
+	if known && existing.Partitions != nil {
+		if old, ok := (*existing.Partitions)[diskID]; ok && old.MountPointData != nil {
+			if oldMp, ok := (*old.MountPointData)[pool.Path]; ok {
+				wasMounted = oldMp.IsMounted
+				mp.Share = oldMp.Share
+			}
+		}
+	}
+
+	part := dto.Partition{
+		Id:             new(diskID),
+		DiskId:         new(diskID),
+		Name:           new(pool.Name),
+		FsType:         new("mergerfs"),
+		Size:           new(int(ret.Size)),
+		System:         new(false),
+		Pool:           ret,
+		FilesystemInfo: &dto.FilesystemInfo{Name: "mergerfs", Support: &dto.FilesystemSupport{CanMount: true}},
+	}
+	if s.fsService != nil {
+		if info, errE := s.fsService.GetSupportAndInfo(s.ctx, "mergerfs"); errE == nil && info != nil {
+			part.FilesystemInfo = info
+		}
+	}
+	mp.Partition = &part
+	part.MountPointData = &map[string]dto.MountPointData{pool.Path: mp}
+	disk := &dto.Disk{
+		Id:               new(diskID),
+		LegacyDeviceName: new(pool.Name),
+		Model:            new("Pool " + pool.Name),
+		Vendor:           new("mergerfs"),
+		Size:             new(int(ret.Size)),
+		Removable:        new(false),
+		Ejectable:        new(false),
+		Partitions:       &map[string]dto.Partition{diskID: part},
+	}
+	if known {
+		disk.RefreshVersion = existing.RefreshVersion
+	}
+	if err := s.disks.AddOrUpdate(disk); err != nil {
+		slog.WarnContext(s.ctx, "Failed to add the disk of a storage pool", "pool", pool.Name, "err", err)
+		return ret
+	}
+	if !known {
+		s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.ADD}, Disk: disk})
+	}
+	if !known || wasMounted != ret.IsMounted {
+		_ = s.eventBus.EmitMountPoint(events.MountPointEvent{
+			Event:      events.Event{Type: events.EventTypes.UPDATE},
+			MountPoint: &mp,
+		})
+	}
+	return ret
+}
+
+// mountAtStartup mounts a pool once all its members are mounted, the first
+// time they are.
+func (s *PoolService) mountAtStartup(pool *dbom.StoragePool) {
+	if !pool.IsToMountAtStartup || s.state.ProtectedMode {
+		return
+	}
+	if mounted, _ := s.isMounted(pool.Path); mounted {
+		return
+	}
+	if _, ok := s.unmountedMember(pool); ok {
+		return
+	}
+	s.mu.Lock()
+	if s.attempted[pool.Name] {
+		s.mu.Unlock()
+		return
+	}
+	s.attempted[pool.Name] = true
+	s.mu.Unlock()
+
+	if errE := s.mount(pool); errE != nil {
+		slog.ErrorContext(s.ctx, "Failed to mount storage pool at startup", "pool", pool.Name, "err", errE)
+		return
+	}
+	slog.InfoContext(s.ctx, "Mounted storage pool", "pool", pool.Name, "path", pool.Path)
+	s.expose(pool)
+}
+
+// handleMountPointEvent mounts the pools whose members are now all mounted,
+// degrades the mounted pools a member of went away and refreshes a pool
+// whose mount point changed.
+func (s *PoolService) handleMountPointEvent(ctx context.Context, e events.MountPointEvent) errors.E {
+	mp := e.MountPoint
+	if mp == nil || mp.Path == "" {
+		return nil
+	}
+	pools, errE := s.load()
+	if errE != nil {
+		return errE
+	}
+	for i := range pools {
+		pool := &pools[i]
+		switch {
+		case pool.Path == mp.Path && !mp.IsMounted:
+			s.expose(pool)
+		case !mp.IsMounted && slices.Contains(pool.Members, mp.Path):
+			s.degrade(pool, mp.Path)
+		case mp.IsMounted && slices.Contains(pool.Members, mp.Path):
+			s.mountAtStartup(pool)
+		}
+	}
+	return nil
+}
+
+// degrade unmounts a mounted pool whose member went away, as mergerfs would
+// keep serving the pool without the files of that member. The pool is
+// mounted again once all its members are back.
+func (s *PoolService) degrade(pool *dbom.StoragePool, member string) {
+	if mounted, _ := s.isMounted(pool.Path); !mounted {
+		return
+	}
+	slog.WarnContext(s.ctx, "Unmounting degraded storage pool", "pool", pool.Name, "member", member)
+	if errE := s.fsService.UnmountPartition(s.ctx, pool.Path, filesystem.MergerfsFsType, false, true); errE != nil {
+		slog.ErrorContext(s.ctx, "Failed to unmount degraded storage pool", "pool", pool.Name, "err", errE)
+	}
+	s.mu.Lock()
+	s.degraded[pool.Name] = true
+	delete(s.attempted, pool.Name)
+	s.mu.Unlock()
+	s.expose(pool)
+}
+
+func (s *PoolService) unmountedMember(pool *dbom.StoragePool) (string, bool) {
+	for _, member := range pool.Members {
+		if mounted, _ := s.isMounted(member); !mounted {
+			return member, true
+		}
+	}
+	return "", false
+}
+
+func (s *PoolService) load() ([]dbom.StoragePool, errors.E) {
+	pools, err := gorm.G[dbom.StoragePool](s.db).Order(g.StoragePool.Name).Find(s.ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return pools, nil
+}
+
+func (s *PoolService) get(name string) (*dbom.StoragePool, errors.E) {
+	pool, err := gorm.G[dbom.StoragePool](s.db).Where(g.StoragePool.Name.Eq(name)).First(s.ctx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.WithDetails(dto.ErrorNotFound, "Pool", name, "reason", "no pool is named "+name)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &pool, nil
+}
+
+// poolSpace sums the size and the space available to users of the members,
+// counting a filesystem holding several members once when it has an id.
+func poolSpace(members []string) (size, free uint64) {
+	seen := make(map[syscall.Fsid]bool, len(members))
+	for _, member := range members {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(member, &stat); err != nil || stat.Bsize <= 0 {
+			continue
+		}
+		if stat.Fsid != (syscall.Fsid{}) {
+			if seen[stat.Fsid] {
+				continue
+			}
+			seen[stat.Fsid] = true
+		}
+		bsize := uint64(stat.Bsize)
+		size += stat.Blocks * bsize
+		free += stat.Bavail * bsize
+	}
+	return size, free
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/darwinstubs/mount"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+type PoolServiceSuite struct {
+	suite.Suite
+	app         *fxtest.App
+	db          *gorm.DB
+	state       *dto.ContextState
+	disks       *dto.DiskMap
+	eventBus    events.EventBusInterface
+	fsService   FilesystemServiceInterface
+	poolService *PoolService
+	root        string
+	members     []string
+
+	mu       sync.Mutex
+	mounted  map[string]bool
+	mounts   []string // source, target, data of each mergerfs mount
+	mountErr errors.E
+}
+
+func TestPoolServiceSuite(t *testing.T) {
+	suite.Run(t, new(PoolServiceSuite))
+}
+
+func (suite *PoolServiceSuite) SetupTest() {
+	suite.root = suite.T().TempDir()
+	suite.members = []string{suite.T().TempDir(), suite.T().TempDir()}
+	suite.mounted = map[string]bool{suite.members[0]: true, suite.members[1]: true}
+	suite.mounts = nil
+	suite.mountErr = nil
+
+	suite.state = &dto.ContextState{DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)"}
+	suite.disks = &dto.DiskMap{}
+	suite.Require().NoError(suite.disks.AddOrUpdate(&dto.Disk{
+		Id: new("usb-DISK_1"),
+		Partitions: &map[string]dto.Partition{
+			"usb-DISK_1-part1": {Id: new("usb-DISK_1-part1"), DiskId: new("usb-DISK_1"), MountPointData: &map[string]dto.MountPointData{
+				suite.members[0]: {Path: suite.members[0], DeviceId: "usb-DISK_1-part1", IsMounted: true},
+			}},
+			"usb-DISK_1-part2": {Id: new("usb-DISK_1-part2"), DiskId: new("usb-DISK_1"), MountPointData: &map[string]dto.MountPointData{
+				suite.members[1]: {Path: suite.members[1], DeviceId: "usb-DISK_1-part2", IsMounted: true},
+				"/mnt/unmounted": {Path: "/mnt/unmounted", DeviceId: "usb-DISK_1-part2"},
+			}},
+		},
+	}))
+
+	var poolService PoolServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState { return suite.state },
+			func() *dto.DiskMap { return suite.disks },
+			dbom.NewDB,
+			events.NewEventBus,
+			mock.Mock[FilesystemServiceInterface],
+			NewPoolService,
+		),
+		fx.Populate(&suite.db),
+		fx.Populate(&suite.eventBus),
+		fx.Populate(&suite.fsService),
+		fx.Populate(&poolService),
+	)
+	suite.poolService = poolService.(*PoolService)
+	suite.poolService.mountRoot = suite.root
+	suite.poolService.isMounted = func(path string) (bool, error) {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		return suite.mounted[path], nil
+	}
+	suite.cleanDB()
+
+	mock.When(suite.fsService.MountPartition(mock.AnyContext(), mock.Any[string](), mock.Any[string](), mock.Exact("mergerfs"),
+		mock.Any[string](), mock.Any[uintptr](), mock.Any[func() error]())).ThenAnswer(func(args []any) []any {
+		source, target, data := args[1].(string), args[2].(string), args[4].(string)
+		if suite.mountErr != nil {
+			return []any{nil, suite.mountErr}
+		}
+		suite.mu.Lock()
+		suite.mounted[target] = true
+		suite.mounts = append(suite.mounts, source+" "+target+" "+data)
+		suite.mu.Unlock()
+		return []any{&mount.MountPoint{Path: target, Device: source, FSType: filesystem.MergerfsFsType}, nil}
+	})
+	mock.When(suite.fsService.UnmountPartition(mock.AnyContext(), mock.Any[string](), mock.Exact(filesystem.MergerfsFsType),
+		mock.Any[bool](), mock.Any[bool]())).ThenAnswer(func(args []any) []any {
+		suite.mu.Lock()
+		delete(suite.mounted, args[1].(string))
+		suite.mu.Unlock()
+		return []any{nil}
+	})
+
+	suite.app.RequireStart()
+}
+
+func (suite *PoolServiceSuite) TearDownTest() {
+	suite.cleanDB()
+	suite.app.RequireStop()
+}
+
+func (suite *PoolServiceSuite) cleanDB() {
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.StoragePool{}).Error)
+	suite.Require().NoError(suite.db.Unscoped().Where("device_id LIKE ?", poolDiskPrefix+"%").Delete(&dbom.MountPointPath{}).Error)
+}
+
+func (suite *PoolServiceSuite) mountCount() int {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	return len(suite.mounts)
+}
+
+func (suite *PoolServiceSuite) create() *dto.StoragePool {
+	pool, err := suite.poolService.CreatePool(dto.StoragePoolCreateRequest{Name: "media", Members: suite.members, CreatePolicy: "mfs"})
+	suite.Require().NoError(err)
+	return pool
+}
+
+func (suite *PoolServiceSuite) TestCreatePoolMountsAndExposes() {
+	pool := suite.create()
+
+	path := filepath.Join(suite.root, "media")
+	suite.Equal(path, pool.Path)
+	suite.True(pool.IsMounted)
+	suite.True(pool.IsToMountAtStartup)
+	suite.Equal("pool-media", pool.PartitionId)
+	suite.NotZero(pool.Size)
+
+	suite.Require().Len(suite.mounts, 1)
+	mountArgs := strings.Split(suite.mounts[0], " ")
+	suite.Equal(strings.Join(suite.members, ":"), mountArgs[0])
+	suite.Equal(path, mountArgs[1])
+	suite.Contains(mountArgs[2], "category.create=mfs")
+	suite.Contains(mountArgs[2], "allow_other")
+
+	stored, err := gorm.G[dbom.StoragePool](suite.db).Where("name = ?", "media").First(context.Background())
+	suite.Require().NoError(err)
+	suite.Equal(suite.members, stored.Members)
+	mpp, err := gorm.G[dbom.MountPointPath](suite.db).Where("path = ?", path).First(context.Background())
+	suite.Require().NoError(err)
+	suite.Equal("pool-media", mpp.DeviceId)
+	suite.Equal(filesystem.MergerfsFsType, mpp.FSType)
+
+	mp, ok := suite.disks.GetMountPointByPath(path)
+	suite.Require().True(ok)
+	suite.True(mp.IsMounted)
+	suite.Equal("pool-media", mp.DeviceId)
+	part, _, ok := suite.disks.GetPartitionByID("pool-media")
+	suite.Require().True(ok)
+	suite.Require().NotNil(part.Pool)
+	suite.Equal(pool.Free, part.Pool.Free)
+}
+
+func (suite *PoolServiceSuite) TestCreatePoolDefaultsToEpmfs() {
+	_, err := suite.poolService.CreatePool(dto.StoragePoolCreateRequest{Name: "media", Members: suite.members})
+	suite.Require().NoError(err)
+	suite.Require().Len(suite.mounts, 1)
+	suite.Contains(suite.mounts[0], "category.create=epmfs")
+}
+
+func (suite *PoolServiceSuite) TestCreatePoolRejectsInvalidMembers() {
+	for name, members := range map[string][]string{
+		"single":    {suite.members[0]},
+		"unknown":   {suite.members[0], "/mnt/nowhere"},
+		"unmounted": {suite.members[0], "/mnt/unmounted"},
+		"overlap":   {suite.members[0], filepath.Join(suite.members[0], "sub")},
+		"separator": {suite.members[0], "/mnt/a:b"},
+	} {
+		_, err := suite.poolService.CreatePool(dto.StoragePoolCreateRequest{Name: "media", Members: members})
+		suite.ErrorIs(err, dto.ErrorInvalidParameter, name)
+	}
+	_, err := suite.poolService.CreatePool(dto.StoragePoolCreateRequest{Name: "media", Members: suite.members, CreatePolicy: "rand"})
+	suite.ErrorIs(err, dto.ErrorInvalidParameter)
+	suite.Zero(suite.mountCount())
+}
+
+func (suite *PoolServiceSuite) TestCreatePoolTwice() {
+	suite.create()
+
+	_, err := suite.poolService.CreatePool(dto.StoragePoolCreateRequest{Name: "media", Members: suite.members})
+	suite.ErrorIs(err, dto.ErrorConflict)
+	suite.Equal(1, suite.mountCount())
+}
+
+func (suite *PoolServiceSuite) TestCreatePoolMountFailureNotStored() {
+	suite.mountErr = errors.New("fuse: device not found")
+
+	_, err := suite.poolService.CreatePool(dto.StoragePoolCreateRequest{Name: "media", Members: suite.members})
+	suite.Require().ErrorIs(err, dto.ErrorMountFail)
+	suite.Contains(errors.AllDetails(err)["reason"], "fuse: device not found")
+
+	pools, errE := suite.poolService.ListPools()
+	suite.Require().NoError(errE)
+	suite.Empty(pools)
+	_, ok := suite.disks.Get("pool-media")
+	suite.False(ok)
+}
+
+func (suite *PoolServiceSuite) TestCreatePoolProtectedMode() {
+	suite.state.ProtectedMode = true
+
+	_, err := suite.poolService.CreatePool(dto.StoragePoolCreateRequest{Name: "media", Members: suite.members})
+	suite.ErrorIs(err, dto.ErrorOperationNotPermittedInProtectedMode)
+}
+
+func (suite *PoolServiceSuite) TestDeletePool() {
+	pool := suite.create()
+	var removed []string
+	suite.eventBus.OnDisk(func(ctx context.Context, event events.DiskEvent) errors.E {
+		if event.Type == events.EventTypes.REMOVE {
+			removed = append(removed, *event.Disk.Id)
+		}
+		return nil
+	})
+
+	suite.Require().NoError(suite.poolService.DeletePool("media"))
+
+	suite.False(suite.mounted[pool.Path])
+	suite.Equal([]string{"pool-media"}, removed)
+	_, ok := suite.disks.Get("pool-media")
+	suite.False(ok)
+	pools, err := suite.poolService.ListPools()
+	suite.Require().NoError(err)
+	suite.Empty(pools)
+	count, errC := gorm.G[dbom.MountPointPath](suite.db.Unscoped()).Where("path = ?", pool.Path).Count(context.Background(), "*")
+	suite.Require().NoError(errC)
+	suite.Zero(count)
+
+	suite.ErrorIs(suite.poolService.DeletePool("media"), dto.ErrorNotFound)
+}
+
+func (suite *PoolServiceSuite) TestDeletePoolRefusedWhileShared() {
+	pool := suite.create()
+	share := &dbom.ExportedShare{Name: "PoolShare", MountPointDataPath: &pool.Path, MountPointDataRoot: new("/")}
+	suite.Require().NoError(suite.db.Omit("Users", "RoUsers", "Groups", "RoGroups", "MountPointData").Create(share).Error)
+	defer func() {
+		suite.Require().NoError(suite.db.Unscoped().Delete(share).Error)
+	}()
+
+	err := suite.poolService.DeletePool("media")
+	suite.Require().ErrorIs(err, dto.ErrorInvalidStateForOperation)
+	suite.Contains(errors.AllDetails(err)["reason"], "PoolShare")
+	suite.True(suite.mounted[pool.Path])
+}
+
+func (suite *PoolServiceSuite) TestMountPoolWaitsForMembers() {
+	pool := suite.create()
+	suite.Require().NoError(suite.poolService.fsService.UnmountPartition(context.Background(), pool.Path, filesystem.MergerfsFsType, false, false))
+	suite.mu.Lock()
+	suite.mounted[suite.members[1]] = false
+	suite.mu.Unlock()
+
+	_, err := suite.poolService.MountPool("media")
+	suite.Require().ErrorIs(err, dto.ErrorInvalidStateForOperation)
+	suite.Contains(errors.AllDetails(err)["reason"], suite.members[1])
+
+	suite.mu.Lock()
+	suite.mounted[suite.members[1]] = true
+	suite.mu.Unlock()
+	mounted, err := suite.poolService.MountPool("media")
+	suite.Require().NoError(err)
+	suite.True(mounted.IsMounted)
+	suite.Equal(2, suite.mountCount())
+
+	_, err = suite.poolService.MountPool("media")
+	suite.ErrorIs(err, dto.ErrorInvalidStateForOperation)
+}
+
+func (suite *PoolServiceSuite) TestStartupMountOnceMembersAreMounted() {
+	path := filepath.Join(suite.root, "media")
+	suite.Require().NoError(suite.db.Create(&dbom.StoragePool{
+		Name: "media", Path: path, CreatePolicy: "lfs", Members: suite.members, IsToMountAtStartup: true,
+	}).Error)
+	suite.mu.Lock()
+	suite.mounted[suite.members[1]] = false
+	suite.mu.Unlock()
+	emit := func(member string) {
+		_ = suite.eventBus.EmitMountPoint(events.MountPointEvent{
+			Event:      events.Event{Type: events.EventTypes.UPDATE},
+			MountPoint: &dto.MountPointData{Path: member, IsMounted: true},
+		})
+	}
+
+	emit(suite.members[0])
+	suite.Zero(suite.mountCount())
+
+	suite.mu.Lock()
+	suite.mounted[suite.members[1]] = true
+	suite.mu.Unlock()
+	emit(suite.members[1])
+	suite.Require().Equal(1, suite.mountCount())
+	suite.Contains(suite.mounts[0], "category.create=lfs")
+	mp, ok := suite.disks.GetMountPointByPath(path)
+	suite.Require().True(ok)
+	suite.True(mp.IsMounted)
+
+	// Unmounted by the user: not mounted again until the next start.
+	suite.mu.Lock()
+	delete(suite.mounted, path)
+	suite.mu.Unlock()
+	emit(suite.members[1])
+	suite.Equal(1, suite.mountCount())
+}
+
+func (suite *PoolServiceSuite) TestLostMemberDegradesPool() {
+	pool := suite.create()
+	name, ok := suite.poolService.MountedPoolOf(suite.members[1])
+	suite.True(ok)
+	suite.Equal("media", name)
+	_, ok = suite.poolService.MountedPoolOf("/mnt/unmounted")
+	suite.False(ok)
+	emit := func(member string, mounted bool) {
+		suite.mu.Lock()
+		suite.mounted[member] = mounted
+		suite.mu.Unlock()
+		_ = suite.eventBus.EmitMountPoint(events.MountPointEvent{
+			Event:      events.Event{Type: events.EventTypes.UPDATE},
+			MountPoint: &dto.MountPointData{Path: member, IsMounted: mounted},
+		})
+	}
+
+	emit(suite.members[1], false)
+	suite.False(suite.mounted[pool.Path])
+	pools, err := suite.poolService.ListPools()
+	suite.Require().NoError(err)
+	suite.False(pools[0].IsMounted)
+	suite.True(pools[0].Degraded)
+	_, ok = suite.poolService.MountedPoolOf(suite.members[0])
+	suite.False(ok)
+
+	// Mounted again once the member is back.
+	emit(suite.members[1], true)
+	suite.Equal(2, suite.mountCount())
+	pools, err = suite.poolService.ListPools()
+	suite.Require().NoError(err)
+	suite.True(pools[0].IsMounted)
+	suite.False(pools[0].Degraded)
+}
+
+func (suite *PoolServiceSuite) TestPoolSpaceCountsFilesystemOnce() {
+	size, free := poolSpace(suite.members[:1])
+	suite.NotZero(size)
+	bothSize, bothFree := poolSpace(suite.members)
+	// Both temporary directories are on the same filesystem.
+	suite.Equal(size, bothSize)
+	suite.InDelta(float64(free), float64(bothFree), float64(size)/100)
+}
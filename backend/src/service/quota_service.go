@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// quotaRefreshInterval is how often share usage is compared to the limits.
+const quotaRefreshInterval = 5 * time.Minute
+
+// quotaProblemTranslationKey is shared by every "share almost full" Problem,
+// the key itself carries the share name.
+const quotaProblemTranslationKey = "share_quota_warning"
+
+// QuotaTagCommandID identifies the executions tagging the existing entries of
+// a share with its quota project in the command_output websocket events.
+const QuotaTagCommandID = "share_quota_tag"
+
+type QuotaServiceInterface interface {
+	// ApplyQuotas enforces the share and user quotas of a share with the native
+	// mechanism of its filesystem.
+	ApplyQuotas(share dto.SharedResource) errors.E
+	// RefreshQuotas updates the usage report of every share and raises or
+	// dismisses the quota Problems.
+	RefreshQuotas() errors.E
+	// GetShareQuotaStatus returns the last usage report of a share, nil when
+	// the share has no quotas.
+	GetShareQuotaStatus(name string) *dto.ShareQuotaStatus
+}
+
+type QuotaService struct {
+	ctx               context.Context
+	shareService      ShareServiceInterface
+	filesystemService FilesystemServiceInterface
+	problemService    ProblemServiceInterface
+	executor          commandexec.Executor
+
+	mu      sync.RWMutex
+	status  map[string]*dto.ShareQuotaStatus
+	warned  map[string]bool               // share name -> quota Problem raised, absent when unknown
+	applied map[string]dto.SharedResource // share name -> share as its limits are set on the filesystem
+}
+
+type QuotaServiceParams struct {
+	fx.In
+	Ctx               context.Context
+	ShareService      ShareServiceInterface
+	FilesystemService FilesystemServiceInterface
+	ProblemService    ProblemServiceInterface
+	Executor          commandexec.Executor
+	EventBus          events.EventBusInterface
+}
+
+func NewQuotaService(lc fx.Lifecycle, in QuotaServiceParams) QuotaServiceInterface {
+	s := &QuotaService{
+		ctx:               in.Ctx,
+		shareService:      in.ShareService,
+		filesystemService: in.FilesystemService,
+		problemService:    in.ProblemService,
+		executor:          in.Executor,
+		status:            make(map[string]*dto.ShareQuotaStatus),
+		warned:            make(map[string]bool),
+		applied:           make(map[string]dto.SharedResource),
+	}
+	unsubscribe := in.EventBus.OnShare(func(ctx context.Context, event events.ShareEvent) errors.E {
+		if event.Share == nil {
+			return nil
+		}
+		switch event.Type {
+		case events.EventTypes.ADD, events.EventTypes.UPDATE:
+			if err := s.ApplyQuotas(*event.Share); err != nil {
+				slog.WarnContext(ctx, "Unable to apply share quotas", "share", event.Share.Name, "err", err)
+			}
+		case events.EventTypes.REMOVE:
+			s.mu.Lock()
+			previous, ok := s.applied[event.Share.Name]
+			delete(s.applied, event.Share.Name)
+			s.mu.Unlock()
+			if ok {
+				if err := s.clearQuotas(previous, nil); err != nil {
+					slog.WarnContext(ctx, "Unable to clear share quotas", "share", event.Share.Name, "err", err)
+				}
+			}
+			s.forget(event.Share.Name)
+		}
+		return nil
+	})
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok && wg != nil {
+				wg.Go(func() {
+					if err := s.run(); err != nil && !errors.Is(err, context.Canceled) {
+						slog.WarnContext(s.ctx, "QuotaService run loop stopped with error", "error", err)
+					}
+				})
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			unsubscribe()
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *QuotaService) run() errors.E {
+	for {
+		if err := s.RefreshQuotas(); err != nil {
+			tlog.DebugContext(s.ctx, "Failed to refresh share quotas", "error", err)
+		}
+		select {
+		case <-s.ctx.Done():
+			slog.DebugContext(s.ctx, "Run process closed", "err", s.ctx.Err())
+			return errors.WithStack(s.ctx.Err())
+		case <-time.After(quotaRefreshInterval):
+		}
+	}
+}
+
+func hasQuotas(share dto.SharedResource) bool {
+	return share.QuotaBytes != nil || len(share.UserQuotas) > 0
+}
+
+// quotaAdapter returns the quota capability of the filesystem behind a share.
+func (s *QuotaService) quotaAdapter(share dto.SharedResource) (filesystem.QuotaAdapter, string, errors.E) {
+	if share.MountPointData == nil || !share.MountPointData.IsMounted || share.MountPointData.FSType == nil {
+		return nil, "", errors.WithDetails(dto.ErrorInvalidStateForOperation, "share", share.Name, "reason", "share path is not mounted")
+	}
+	adapter, err := s.filesystemService.GetAdapter(*share.MountPointData.FSType)
+	if err != nil {
+		return nil, "", errors.WithDetails(dto.ErrorQuotaNotSupported, "share", share.Name, "fstype", *share.MountPointData.FSType)
+	}
+	quota, ok := filesystem.AsQuotaAdapter(adapter)
+	if !ok {
+		return nil, "", errors.WithDetails(dto.ErrorQuotaNotSupported, "share", share.Name, "fstype", *share.MountPointData.FSType)
+	}
+	if share.SubPath != "" && share.QuotaBytes != nil && filesystem.DirQuotaCoversVolume(quota) {
+		return nil, "", errors.WithDetails(dto.ErrorQuotaNotSupported, "share", share.Name, "fstype", *share.MountPointData.FSType,
+			"reason", "the share quota would cap the whole volume, not the sub path of the share")
+	}
+	return quota, share.ExportPath(), nil
+}
+
+func (s *QuotaService) ApplyQuotas(share dto.SharedResource) errors.E {
+	s.mu.RLock()
+	previous, wasApplied := s.applied[share.Name]
+	s.mu.RUnlock()
+
+	if !hasQuotas(share) || share.Usage == dto.UsageAsInternal {
+		if wasApplied {
+			if err := s.clearQuotas(previous, nil); err != nil {
+				return errors.Wrapf(err, "failed to clear quotas of share %s", share.Name)
+			}
+			s.mu.Lock()
+			delete(s.applied, share.Name)
+			s.mu.Unlock()
+		}
+		s.forget(share.Name)
+		return nil
+	}
+	quota, path, errE := s.quotaAdapter(share)
+	if errE != nil {
+		s.refreshShare(share)
+		return errE
+	}
+	if wasApplied {
+		if err := s.clearQuotas(previous, &share); err != nil {
+			s.refreshShare(share)
+			return errors.Wrapf(err, "failed to clear quotas of share %s", share.Name)
+		}
+	}
+	if share.QuotaBytes != nil {
+		if err := quota.SetDirQuota(s.ctx, path, *share.QuotaBytes); err != nil {
+			s.refreshShare(share)
+			return errors.Wrapf(err, "failed to set quota of share %s", share.Name)
+		}
+		if !wasApplied || previous.QuotaBytes == nil || previous.ExportPath() != path {
+			s.tagTree(share, quota, path)
+		}
+	}
+	for _, userQuota := range share.UserQuotas {
+		if err := quota.SetUserQuota(s.ctx, path, userQuota.Username, userQuota.LimitBytes); err != nil {
+			s.refreshShare(share)
+			return errors.Wrapf(err, "failed to set quota of user %s on share %s", userQuota.Username, share.Name)
+		}
+	}
+	s.mu.Lock()
+	s.applied[share.Name] = share
+	s.mu.Unlock()
+	s.refreshShare(share)
+	return nil
+}
+
+// clearQuotas removes the limits previous set on the filesystem that current
+// no longer sets, all of them when current is nil. A user limit applies to the
+// whole filesystem, so it is kept while another share on the same volume still
+// sets it.
+func (s *QuotaService) clearQuotas(previous dto.SharedResource, current *dto.SharedResource) errors.E {
+	quota, path, errE := s.quotaAdapter(previous)
+	if errE != nil {
+		// Limits on a volume that is no longer mounted cannot be cleared.
+		slog.WarnContext(s.ctx, "Unable to clear quotas of share", "share", previous.Name, "err", errE)
+		return nil
+	}
+	moved := current == nil || current.Usage == dto.UsageAsInternal || current.ExportPath() != path
+	if previous.QuotaBytes != nil && (moved || current.QuotaBytes == nil) {
+		if err := quota.SetDirQuota(s.ctx, path, 0); err != nil {
+			return err
+		}
+	}
+	kept := map[string]bool{}
+	if !moved {
+		for _, userQuota := range current.UserQuotas {
+			kept[userQuota.Username] = true
+		}
+	}
+	for _, userQuota := range previous.UserQuotas {
+		if kept[userQuota.Username] || s.userQuotaElsewhere(previous, userQuota.Username) {
+			continue
+		}
+		if err := quota.SetUserQuota(s.ctx, path, userQuota.Username, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userQuotaElsewhere reports whether another share on the volume of share
+// sets a limit for username.
+func (s *QuotaService) userQuotaElsewhere(share dto.SharedResource, username string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for name, other := range s.applied {
+		if name == share.Name || other.MountPointData == nil || other.MountPointData.Path != share.MountPointData.Path {
+			continue
+		}
+		for _, userQuota := range other.UserQuotas {
+			if userQuota.Username == username {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tagTree starts, in the background, the walk binding the entries already in
+// the share to its quota project on filesystems that need it.
+func (s *QuotaService) tagTree(share dto.SharedResource, quota filesystem.QuotaAdapter, path string) {
+	tagger, ok := quota.(filesystem.QuotaTreeTagger)
+	if !ok {
+		return
+	}
+	command, args := tagger.DirQuotaTagCommand(path)
+	if _, err := s.executor.Start(s.ctx, QuotaTagCommandID, "Apply quota of "+share.Name+" to existing files", command, args...); err != nil {
+		slog.WarnContext(s.ctx, "Unable to tag the existing files of share", "share", share.Name, "err", err)
+	}
+}
+
+func (s *QuotaService) RefreshQuotas() errors.E {
+	shares, err := s.shareService.ListShares()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]struct{}, len(shares))
+	for _, share := range shares {
+		known[share.Name] = struct{}{}
+		if !hasQuotas(share) || share.Usage == dto.UsageAsInternal {
+			s.forget(share.Name)
+			continue
+		}
+		// Quotas stored before a restart were set on the filesystem then.
+		s.mu.Lock()
+		if _, ok := s.applied[share.Name]; !ok {
+			s.applied[share.Name] = share
+		}
+		s.mu.Unlock()
+		s.refreshShare(share)
+	}
+
+	s.mu.RLock()
+	stale := make([]string, 0)
+	for name := range s.status {
+		if _, ok := known[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+	s.mu.RUnlock()
+	for _, name := range stale {
+		s.forget(name)
+	}
+	return nil
+}
+
+func (s *QuotaService) GetShareQuotaStatus(name string) *dto.ShareQuotaStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status[name]
+}
+
+// refreshShare reads the current usage of a share and updates its Problem.
+func (s *QuotaService) refreshShare(share dto.SharedResource) {
+	status := &dto.ShareQuotaStatus{}
+	quota, path, errE := s.quotaAdapter(share)
+	if errE != nil {
+		if !errors.Is(errE, dto.ErrorQuotaNotSupported) {
+			status.Supported = true
+			status.Error = errE.Error()
+		}
+	} else {
+		status.Supported = true
+		if share.QuotaBytes != nil && *share.QuotaBytes > 0 {
+			usage, err := quota.GetDirQuota(s.ctx, path)
+			if err != nil {
+				status.Error = err.Error()
+			} else {
+				status.Share = &usage
+			}
+		}
+		for _, userQuota := range share.UserQuotas {
+			usage, err := quota.GetUserQuota(s.ctx, path, userQuota.Username)
+			if err != nil {
+				status.Error = err.Error()
+				continue
+			}
+			status.Users = append(status.Users, dto.UserQuotaUsage{Username: userQuota.Username, QuotaUsage: usage})
+		}
+	}
+
+	s.mu.Lock()
+	s.status[share.Name] = status
+	s.mu.Unlock()
+
+	s.updateProblem(share.Name, status.Share)
+}
+
+func quotaProblemKey(share string) string {
+	return "share_quota_" + share
+}
+
+// updateProblem raises a Problem when a share passes dto.QuotaWarningPercent
+// and dismisses it once usage falls back under the threshold.
+func (s *QuotaService) updateProblem(share string, usage *dto.QuotaUsage) {
+	full := usage != nil && usage.LimitBytes > 0 && usage.UsedPercent >= dto.QuotaWarningPercent
+
+	s.mu.Lock()
+	warned, known := s.warned[share]
+	s.warned[share] = full
+	s.mu.Unlock()
+
+	if full {
+		_, err := s.problemService.Upsert(&dto.Problem{
+			ProblemKey:     quotaProblemKey(share),
+			Title:          fmt.Sprintf("Share %s is almost full", share),
+			Description:    fmt.Sprintf("Share %s uses %.1f%% of its %d bytes quota.", share, usage.UsedPercent, usage.LimitBytes),
+			Severity:       dto.ProblemSeverities.PROBLEMSEVERITYWARNING,
+			Status:         dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSCREATED,
+			TranslationKey: quotaProblemTranslationKey,
+			IsPersistent:   true,
+		})
+		if err != nil {
+			tlog.WarnContext(s.ctx, "Unable to upsert share quota problem", "share", share, "error", err)
+		}
+		return
+	}
+	// A Problem raised before a restart is only known to the database.
+	if !known || warned {
+		s.dismissProblem(share)
+	}
+}
+
+func (s *QuotaService) dismissProblem(share string) {
+	if err := s.problemService.Dismiss(quotaProblemKey(share)); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		tlog.WarnContext(s.ctx, "Unable to dismiss share quota problem", "share", share, "error", err)
+	}
+}
+
+// forget drops the report of a share without quotas and dismisses its Problem.
+func (s *QuotaService) forget(share string) {
+	s.mu.Lock()
+	_, reported := s.status[share]
+	warned, known := s.warned[share]
+	delete(s.status, share)
+	s.warned[share] = false
+	s.mu.Unlock()
+	if reported || !known || warned {
+		s.dismissProblem(share)
+	}
+}
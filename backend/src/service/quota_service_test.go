@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+// fakeQuotaAdapter is a filesystem adapter with an in-memory quota capability.
+type fakeQuotaAdapter struct {
+	filesystem.FilesystemAdapter
+	dirLimit   uint64
+	dirUsed    uint64
+	userLimits map[string]uint64
+}
+
+func (f *fakeQuotaAdapter) SetDirQuota(_ context.Context, _ string, limit uint64) errors.E {
+	f.dirLimit = limit
+	return nil
+}
+
+func (f *fakeQuotaAdapter) GetDirQuota(_ context.Context, _ string) (dto.QuotaUsage, errors.E) {
+	return dto.NewQuotaUsage(f.dirUsed, f.dirLimit), nil
+}
+
+func (f *fakeQuotaAdapter) SetUserQuota(_ context.Context, _ string, username string, limit uint64) errors.E {
+	f.userLimits[username] = limit
+	return nil
+}
+
+func (f *fakeQuotaAdapter) DirQuotaTagCommand(path string) (string, []string) {
+	return "chattr", []string{"-R", "+P", path}
+}
+
+func (f *fakeQuotaAdapter) GetUserQuota(_ context.Context, _ string, username string) (dto.QuotaUsage, errors.E) {
+	return dto.NewQuotaUsage(0, f.userLimits[username]), nil
+}
+
+type QuotaServiceSuite struct {
+	suite.Suite
+	app               *fxtest.App
+	shareService      ShareServiceInterface
+	filesystemService FilesystemServiceInterface
+	problemService    ProblemServiceInterface
+	executor          commandexec.Executor
+	eventBus          events.EventBusInterface
+	quotaService      QuotaServiceInterface
+	adapter           *fakeQuotaAdapter
+}
+
+func TestQuotaServiceSuite(t *testing.T) {
+	suite.Run(t, new(QuotaServiceSuite))
+}
+
+func (suite *QuotaServiceSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			events.NewEventBus,
+			mock.Mock[ShareServiceInterface],
+			mock.Mock[FilesystemServiceInterface],
+			mock.Mock[ProblemServiceInterface],
+			mock.Mock[commandexec.Executor],
+			NewQuotaService,
+		),
+		fx.Populate(&suite.executor),
+		fx.Populate(&suite.eventBus),
+		fx.Populate(&suite.shareService),
+		fx.Populate(&suite.filesystemService),
+		fx.Populate(&suite.problemService),
+		fx.Populate(&suite.quotaService),
+	)
+	suite.app.RequireStart()
+
+	suite.adapter = &fakeQuotaAdapter{userLimits: map[string]uint64{}}
+	mock.When(suite.filesystemService.GetAdapter(mock.Exact("btrfs"))).ThenReturn(suite.adapter, nil)
+}
+
+func (suite *QuotaServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+func quotaShare(fsType string, limit uint64) dto.SharedResource {
+	return dto.SharedResource{
+		Name:       "data",
+		QuotaBytes: &limit,
+		UserQuotas: []dto.UserQuota{{Username: "alice", LimitBytes: 512}},
+		MountPointData: &dto.MountPointData{
+			Path:      "/mnt/data",
+			FSType:    &fsType,
+			IsMounted: true,
+		},
+	}
+}
+
+func (suite *QuotaServiceSuite) TestApplyQuotas_SetsLimitsAndReports() {
+	suite.adapter.dirUsed = 100
+
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(quotaShare("btrfs", 1000)))
+
+	suite.Equal(uint64(1000), suite.adapter.dirLimit)
+	suite.Equal(uint64(512), suite.adapter.userLimits["alice"])
+
+	status := suite.quotaService.GetShareQuotaStatus("data")
+	suite.Require().NotNil(status)
+	suite.True(status.Supported)
+	suite.Require().NotNil(status.Share)
+	suite.InDelta(10.0, status.Share.UsedPercent, 0.01)
+	suite.Require().Len(status.Users, 1)
+	suite.Equal("alice", status.Users[0].Username)
+	_, _ = mock.Verify(suite.problemService, matchers.Times(0)).Upsert(mock.Any[*dto.Problem]())
+}
+
+func (suite *QuotaServiceSuite) TestApplyQuotas_SubPathOfVolumeQuota() {
+	mock.When(suite.filesystemService.GetAdapter(mock.Exact("zfs"))).ThenReturn(filesystem.NewZfsAdapter(), nil)
+	share := quotaShare("zfs", 1000)
+	share.SubPath = "photos"
+
+	err := suite.quotaService.ApplyQuotas(share)
+
+	suite.ErrorIs(err, dto.ErrorQuotaNotSupported, "a dataset quota would cap the whole volume")
+	status := suite.quotaService.GetShareQuotaStatus("data")
+	suite.Require().NotNil(status)
+	suite.False(status.Supported)
+
+	share = quotaShare("ext4", 1000)
+	share.SubPath = "photos"
+	mock.When(suite.filesystemService.GetAdapter(mock.Exact("ext4"))).ThenReturn(suite.adapter, nil)
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share), "project quotas cap a directory tree")
+	suite.Equal(uint64(1000), suite.adapter.dirLimit)
+}
+
+func (suite *QuotaServiceSuite) TestApplyQuotas_UnsupportedFilesystem() {
+	mock.When(suite.filesystemService.GetAdapter(mock.Exact("vfat"))).ThenReturn(filesystem.NewVfatAdapter(), nil)
+
+	err := suite.quotaService.ApplyQuotas(quotaShare("vfat", 1000))
+
+	suite.ErrorIs(err, dto.ErrorQuotaNotSupported)
+	status := suite.quotaService.GetShareQuotaStatus("data")
+	suite.Require().NotNil(status)
+	suite.False(status.Supported)
+}
+
+func (suite *QuotaServiceSuite) TestRefreshQuotas_RaisesAndDismissesProblem() {
+	share := quotaShare("btrfs", 1000)
+	mock.When(suite.shareService.ListShares()).ThenReturn([]dto.SharedResource{share}, nil)
+	problemCaptor := mock.Captor[*dto.Problem]()
+	mock.When(suite.problemService.Upsert(problemCaptor.Capture())).ThenReturn(&dto.Problem{}, nil)
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+
+	suite.adapter.dirUsed = 950
+	suite.Require().NoError(suite.quotaService.RefreshQuotas())
+
+	suite.Require().NotNil(problemCaptor.Last())
+	suite.Equal("share_quota_data", problemCaptor.Last().ProblemKey)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYWARNING, problemCaptor.Last().Severity)
+
+	suite.adapter.dirUsed = 500
+	suite.Require().NoError(suite.quotaService.RefreshQuotas())
+	_ = mock.Verify(suite.problemService, matchers.AtLeastOnce()).Dismiss(mock.Exact("share_quota_data"))
+}
+
+func (suite *QuotaServiceSuite) TestRefreshQuotas_ForgetsRemovedShares() {
+	mock.When(suite.shareService.ListShares()).
+		ThenReturn([]dto.SharedResource{quotaShare("btrfs", 1000)}, nil).
+		ThenReturn([]dto.SharedResource{}, nil)
+	suite.Require().NoError(suite.quotaService.RefreshQuotas())
+	suite.NotNil(suite.quotaService.GetShareQuotaStatus("data"))
+
+	suite.Require().NoError(suite.quotaService.RefreshQuotas())
+	suite.Nil(suite.quotaService.GetShareQuotaStatus("data"))
+}
+
+func (suite *QuotaServiceSuite) TestApplyQuotas_TagsExistingFilesInBackground() {
+	share := quotaShare("btrfs", 1000)
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+
+	_, _ = mock.Verify(suite.executor, matchers.Times(1)).
+		Start(mock.Any[context.Context](), mock.Exact(QuotaTagCommandID), mock.Any[string](), mock.Exact("chattr"), mock.Exact("-R"), mock.Exact("+P"), mock.Exact("/mnt/data"))
+}
+
+func (suite *QuotaServiceSuite) TestApplyQuotas_ClearsRemovedLimits() {
+	share := quotaShare("btrfs", 1000)
+	share.UserQuotas = append(share.UserQuotas, dto.UserQuota{Username: "bob", LimitBytes: 256})
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+
+	share.UserQuotas = share.UserQuotas[1:]
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+	suite.Equal(uint64(0), suite.adapter.userLimits["alice"])
+	suite.Equal(uint64(256), suite.adapter.userLimits["bob"])
+	suite.Equal(uint64(1000), suite.adapter.dirLimit)
+
+	share.QuotaBytes = nil
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+	suite.Equal(uint64(0), suite.adapter.dirLimit)
+	suite.Equal(uint64(256), suite.adapter.userLimits["bob"])
+
+	share.UserQuotas = nil
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+	suite.Equal(uint64(0), suite.adapter.userLimits["bob"])
+	suite.Nil(suite.quotaService.GetShareQuotaStatus("data"))
+}
+
+func (suite *QuotaServiceSuite) TestApplyQuotas_KeepsUserLimitOfOtherShareOnVolume() {
+	share := quotaShare("btrfs", 1000)
+	other := quotaShare("btrfs", 2000)
+	other.Name = "media"
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(other))
+
+	share.UserQuotas = nil
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+	suite.Equal(uint64(512), suite.adapter.userLimits["alice"], "media still limits alice on the volume")
+}
+
+func (suite *QuotaServiceSuite) TestRemovedShareClearsLimits() {
+	share := quotaShare("btrfs", 1000)
+	suite.Require().NoError(suite.quotaService.ApplyQuotas(share))
+
+	suite.Require().NoError(suite.eventBus.EmitShare(events.ShareEvent{
+		Event: events.Event{Type: events.EventTypes.REMOVE},
+		Share: &share,
+	}))
+
+	suite.Equal(uint64(0), suite.adapter.dirLimit)
+	suite.Equal(uint64(0), suite.adapter.userLimits["alice"])
+}
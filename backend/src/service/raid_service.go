@@ -0,0 +1,683 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/tlog"
+	"github.com/prometheus/procfs"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// RaidCommandID identifies the mdadm executions.
+const RaidCommandID = "raid"
+
+const (
+	// raidCheckInterval is how often /proc/mdstat is read, short enough to
+	// follow a resync or a rebuild.
+	raidCheckInterval = 5 * time.Second
+	// raidProblemPrefix starts the key of the Problem raised for a degraded
+	// array, followed by the array name.
+	raidProblemPrefix = "raid_degraded_"
+	// raidProblemTranslationKey is shared by every degraded array Problem.
+	raidProblemTranslationKey = "raid_degraded"
+	// raidReAddAction is the ProblemAction returning the faulty and missing
+	// members to their array.
+	raidReAddAction = "re-add"
+	// raidByIdPrefix is the /dev/disk/by-id/ link udev makes for an array.
+	raidByIdPrefix = "md-uuid-"
+)
+
+type RaidServiceInterface interface {
+	// ListArrays returns the assembled arrays as of the last check.
+	ListArrays() []dto.RaidArray
+	// GetArray returns the array with the given kernel name, e.g. md0.
+	GetArray(name string) (*dto.RaidArray, errors.E)
+	// Refresh reads the arrays again, exposing the new ones as volumes and
+	// raising or dismissing their Problems.
+	Refresh() ([]dto.RaidArray, errors.E)
+	// ReAdd returns a faulty or missing member to its array, every one of
+	// them when device is empty.
+	ReAdd(name string, device string) (*dto.RaidArray, errors.E)
+}
+
+// raidDetail is the mdadm view of an array, reused until /proc/mdstat shows a
+// change of its members.
+type raidDetail struct {
+	signature string
+	array     dto.RaidArray
+}
+
+type RaidService struct {
+	ctx            context.Context
+	state          *dto.ContextState
+	disks          *dto.DiskMap
+	eventBus       events.EventBusInterface
+	fsService      FilesystemServiceInterface
+	problemService ProblemServiceInterface
+	executor       commandexec.Executor
+	procRoot       string
+
+	refreshMu sync.Mutex
+	mu        sync.Mutex
+	arrays    map[string]dto.RaidArray // array name -> last state
+	details   map[string]raidDetail    // array name -> cached mdadm --detail
+	known     map[string][]string      // array name -> member devices seen while healthy
+	raised    map[string]string        // array name -> members the Problem was raised for
+}
+
+type RaidServiceParams struct {
+	fx.In
+	Ctx               context.Context
+	State             *dto.ContextState
+	Disks             *dto.DiskMap
+	EventBus          events.EventBusInterface
+	FilesystemService FilesystemServiceInterface
+	ProblemService    ProblemServiceInterface `optional:"true"`
+	Executor          commandexec.Executor
+}
+
+func NewRaidService(lc fx.Lifecycle, in RaidServiceParams) RaidServiceInterface {
+	s := &RaidService{
+		ctx:            in.Ctx,
+		state:          in.State,
+		disks:          in.Disks,
+		eventBus:       in.EventBus,
+		fsService:      in.FilesystemService,
+		problemService: in.ProblemService,
+		executor:       in.Executor,
+		procRoot:       procfs.DefaultMountPoint,
+		arrays:         make(map[string]dto.RaidArray),
+		details:        make(map[string]raidDetail),
+		known:          make(map[string][]string),
+		raised:         make(map[string]string),
+	}
+	unsubscribe := in.EventBus.OnProblem(s.handleProblemEvent)
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok && wg != nil {
+				wg.Go(func() {
+					if err := s.run(); err != nil && !errors.Is(err, context.Canceled) {
+						slog.WarnContext(s.ctx, "RaidService run loop stopped with error", "error", err)
+					}
+				})
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			unsubscribe()
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *RaidService) run() errors.E {
+	for {
+		if _, err := s.Refresh(); err != nil {
+			tlog.DebugContext(s.ctx, "Failed to check the RAID arrays", "error", err)
+		}
+		select {
+		case <-s.ctx.Done():
+			slog.DebugContext(s.ctx, "Run process closed", "err", s.ctx.Err())
+			return errors.WithStack(s.ctx.Err())
+		case <-time.After(raidCheckInterval):
+		}
+	}
+}
+
+func (s *RaidService) ListArrays() []dto.RaidArray {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]dto.RaidArray, 0, len(s.arrays))
+	for _, array := range s.arrays {
+		ret = append(ret, array)
+	}
+	slices.SortFunc(ret, func(a, b dto.RaidArray) int { return strings.Compare(a.Name, b.Name) })
+	return ret
+}
+
+func (s *RaidService) GetArray(name string) (*dto.RaidArray, errors.E) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	array, ok := s.arrays[name]
+	if !ok {
+		return nil, errors.WithDetails(dto.ErrorNotFound, "Array", name, "reason", "RAID array not found")
+	}
+	return &array, nil
+}
+
+func (s *RaidService) Refresh() ([]dto.RaidArray, errors.E) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	procFS, err := procfs.NewFS(s.procRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open procfs")
+	}
+	stats, err := procFS.MDStat()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// No md driver loaded, hence no array.
+			stats = nil
+		} else {
+			return nil, errors.Wrap(err, "failed to read mdstat")
+		}
+	}
+
+	arrays := make(map[string]dto.RaidArray, len(stats))
+	for _, stat := range stats {
+		arrays[stat.Name] = s.readArray(stat)
+	}
+
+	s.mu.Lock()
+	previous := s.arrays
+	s.arrays = arrays
+	for name := range s.details {
+		if _, ok := arrays[name]; !ok {
+			delete(s.details, name)
+			delete(s.known, name)
+		}
+	}
+	s.mu.Unlock()
+
+	for name, array := range arrays {
+		old, existed := previous[name]
+		if !existed {
+			slog.InfoContext(s.ctx, "RAID array found", "array", name, "level", array.Level, "state", array.State)
+		}
+		if !existed || !reflect.DeepEqual(old, array) {
+			eventType := events.EventTypes.UPDATE
+			if !existed {
+				eventType = events.EventTypes.ADD
+			}
+			s.eventBus.EmitRaid(events.RaidEvent{Event: events.Event{Type: eventType}, Array: &array})
+		}
+		s.updateProblem(array)
+	}
+	for name, array := range previous {
+		if _, ok := arrays[name]; ok {
+			continue
+		}
+		slog.InfoContext(s.ctx, "RAID array stopped", "array", name)
+		s.hide(array)
+		s.eventBus.EmitRaid(events.RaidEvent{Event: events.Event{Type: events.EventTypes.REMOVE}, Array: &array})
+		s.dismissProblem(name)
+	}
+	return s.ListArrays(), nil
+}
+
+func (s *RaidService) ReAdd(name string, device string) (*dto.RaidArray, errors.E) {
+	if s.state.ProtectedMode {
+		return nil, errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "ReAdd", "reason", "changing RAID arrays is not permitted when ProtectedMode is enabled")
+	}
+	array, errE := s.GetArray(name)
+	if errE != nil {
+		return nil, errE
+	}
+	var members []dto.RaidMember
+	for _, member := range array.Members {
+		if (member.Faulty || member.Missing) && (device == "" || member.Device == device) {
+			members = append(members, member)
+		}
+	}
+	if len(members) == 0 {
+		if device != "" {
+			return nil, errors.WithDetails(dto.ErrorInvalidParameter,
+				"Array", name, "Device", device, "reason", "the device is not a faulty or missing member of the array")
+		}
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation,
+			"Array", name, "reason", "the array has no faulty or missing member")
+	}
+
+	for _, member := range members {
+		if member.Faulty {
+			// A faulty member has to leave the array before it comes back.
+			if snapshot, err := s.executor.ExecuteQuiet(s.ctx, RaidCommandID, "Remove "+member.Device+" from "+name,
+				"mdadm", "--manage", array.DevicePath, "--remove", member.Device); err != nil {
+				return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation,
+					"Array", name, "Device", member.Device, "reason", mdadmReason(snapshot, err))
+			}
+		}
+		if snapshot, err := s.executor.ExecuteQuiet(s.ctx, RaidCommandID, "Re-add "+member.Device+" to "+name,
+			"mdadm", "--manage", array.DevicePath, "--re-add", member.Device); err != nil {
+			return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation,
+				"Array", name, "Device", member.Device, "reason", mdadmReason(snapshot, err))
+		}
+		slog.InfoContext(s.ctx, "Re-added RAID member", "array", name, "device", member.Device)
+	}
+
+	if _, errE := s.Refresh(); errE != nil {
+		return nil, errE
+	}
+	return s.GetArray(name)
+}
+
+// readArray builds an array from its /proc/mdstat entry, completed with the
+// mdadm details when available.
+func (s *RaidService) readArray(stat procfs.MDStat) dto.RaidArray {
+	array := dto.RaidArray{
+		Name:        stat.Name,
+		DevicePath:  "/dev/" + stat.Name,
+		Level:       stat.Type,
+		State:       stat.ActivityState,
+		DisksActive: int(stat.DisksActive),
+		DisksTotal:  int(stat.DisksTotal),
+		DisksFailed: int(stat.DisksFailed),
+		DisksSpare:  int(stat.DisksSpare),
+		Degraded:    stat.DisksDown > 0,
+	}
+	if stat.BlocksTotal > 0 {
+		array.Size = new(int(stat.BlocksTotal * 1024))
+	}
+	for _, component := range stat.Devices {
+		member := dto.RaidMember{
+			Device: "/dev/" + component.Name,
+			State:  "active",
+			Faulty: component.Faulty,
+			Spare:  component.Spare,
+		}
+		switch {
+		case component.Faulty:
+			member.State = "faulty"
+		case component.Spare:
+			member.State = "spare"
+		}
+		array.Members = append(array.Members, member)
+	}
+	switch stat.ActivityState {
+	case "resyncing", "recovering", "reshaping", "checking":
+		array.Sync = &dto.RaidSync{
+			Action:        stat.ActivityState,
+			Percent:       stat.BlocksSyncedPct,
+			FinishMinutes: stat.BlocksSyncedFinishTime,
+			SpeedKBps:     int64(stat.BlocksSyncedSpeed),
+		}
+	}
+
+	if detail, ok := s.detail(stat); ok {
+		array.Level = detail.Level
+		array.State = detail.State
+		array.Uuid = detail.Uuid
+		array.Label = detail.Label
+		if detail.Size != nil {
+			array.Size = detail.Size
+		}
+		array.Degraded = array.Degraded || strings.Contains(detail.State, "degraded")
+		array.Members = detail.Members
+	}
+	s.trackMembers(&array)
+	for i := range array.Members {
+		s.linkMember(&array.Members[i])
+	}
+	array.DisksFailed = 0
+	for _, member := range array.Members {
+		if member.Faulty {
+			array.DisksFailed++
+		}
+	}
+	if stat.ActivityState != "inactive" {
+		s.expose(&array)
+	}
+	return array
+}
+
+// detail returns the mdadm view of an array, running mdadm only when the
+// members listed in /proc/mdstat changed since the last run.
+func (s *RaidService) detail(stat procfs.MDStat) (dto.RaidArray, bool) {
+	if s.executor == nil {
+		return dto.RaidArray{}, false
+	}
+	var signature strings.Builder
+	fmt.Fprintf(&signature, "%s %d/%d/%d/%d", stat.ActivityState, stat.DisksActive, stat.DisksDown, stat.DisksFailed, stat.DisksSpare)
+	for _, component := range stat.Devices {
+		fmt.Fprintf(&signature, " %s:%v:%v", component.Name, component.Faulty, component.Spare)
+	}
+	s.mu.Lock()
+	cached, ok := s.details[stat.Name]
+	s.mu.Unlock()
+	if ok && cached.signature == signature.String() {
+		return cached.array, true
+	}
+
+	snapshot, err := s.executor.ExecuteQuiet(s.ctx, RaidCommandID, "Detail "+stat.Name, "mdadm", "--detail", "/dev/"+stat.Name)
+	if err != nil {
+		tlog.DebugContext(s.ctx, "Failed to read the RAID array details", "array", stat.Name, "reason", mdadmReason(snapshot, err))
+		return dto.RaidArray{}, false
+	}
+	lines := make([]string, 0, len(snapshot.Lines))
+	for _, line := range snapshot.Lines {
+		if line.Channel == dto.CommandOutputChannelStdout {
+			lines = append(lines, line.Line)
+		}
+	}
+	array := parseMdadmDetail(lines)
+	s.mu.Lock()
+	s.details[stat.Name] = raidDetail{signature: signature.String(), array: array}
+	s.mu.Unlock()
+	return array, true
+}
+
+// trackMembers remembers the members of a healthy array and lists the ones
+// that left a degraded array as missing, so that they can be re-added.
+func (s *RaidService) trackMembers(array *dto.RaidArray) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	present := make([]string, 0, len(array.Members))
+	for _, member := range array.Members {
+		if member.Device != "" {
+			present = append(present, member.Device)
+		}
+	}
+	if !array.Degraded && slices.IndexFunc(array.Members, func(m dto.RaidMember) bool { return m.Faulty }) < 0 {
+		s.known[array.Name] = present
+		return
+	}
+	for _, device := range s.known[array.Name] {
+		if slices.Contains(present, device) {
+			continue
+		}
+		// mdadm lists a left slot as removed, without device: it is the
+		// member that was there.
+		if i := slices.IndexFunc(array.Members, func(m dto.RaidMember) bool { return m.Device == "" && m.State == "removed" }); i >= 0 {
+			array.Members[i].Device = device
+			array.Members[i].Missing = true
+			continue
+		}
+		array.Members = append(array.Members, dto.RaidMember{Device: device, State: "removed", Missing: true})
+	}
+	array.Members = slices.DeleteFunc(array.Members, func(m dto.RaidMember) bool { return m.Device == "" })
+}
+
+// linkMember sets the disk and the partition holding a member.
+func (s *RaidService) linkMember(member *dto.RaidMember) {
+	if s.disks == nil {
+		return
+	}
+	diskID, partitionID, ok := s.disks.GetByLegacyDevicePath(member.Device)
+	if !ok {
+		return
+	}
+	member.DiskId = new(diskID)
+	if partitionID != "" {
+		member.PartitionId = new(partitionID)
+	}
+}
+
+// expose adds the disk and the partition mounting an array the first time it
+// is seen. The partition events let the volume service mount it as any other.
+func (s *RaidService) expose(array *dto.RaidArray) {
+	if s.disks == nil {
+		return
+	}
+	diskID := raidDiskId(array)
+	devicePath := array.DevicePath
+	if array.Uuid != nil {
+		devicePath = "/dev/disk/by-id/" + diskID
+	}
+	partitionID := "by-id-" + diskID
+	array.DiskId = new(diskID)
+	array.PartitionId = new(partitionID)
+	if _, ok := s.disks.Get(diskID); ok {
+		return
+	}
+
+	partitions := make(map[string]dto.Partition, 1)
+	disk := &dto.Disk{
+		Id:               new(diskID),
+		DevicePath:       new(devicePath),
+		LegacyDevicePath: new(array.DevicePath),
+		LegacyDeviceName: new(array.Name),
+		Model:            new(strings.ToUpper(array.Level)),
+		Vendor:           new("Linux MD"),
+		Size:             array.Size,
+		Removable:        new(false),
+		Ejectable:        new(false),
+		Partitions:       &partitions,
+	}
+	part := dto.Partition{
+		Id:               new(partitionID),
+		DevicePath:       new(devicePath),
+		LegacyDevicePath: new(array.DevicePath),
+		LegacyDeviceName: new(array.Name),
+		DiskId:           new(diskID),
+		Name:             array.Label,
+		Size:             array.Size,
+		System:           new(false),
+	}
+	if s.fsService != nil {
+		if fsType, errE := s.fsService.FsTypeFromDevice(array.DevicePath); errE == nil {
+			part.FsType = new(fsType)
+			part.FilesystemInfo, _ = s.fsService.GetSupportAndInfo(s.ctx, fsType)
+		}
+	}
+	if part.FilesystemInfo == nil || part.FilesystemInfo.Support == nil {
+		// Unknown content, as for a raw partition only formatting is offered.
+		part.FilesystemInfo = &dto.FilesystemInfo{Support: &dto.FilesystemSupport{CanFormat: true}}
+	}
+	partitions[partitionID] = part
+	if err := s.disks.AddOrUpdate(disk); err != nil {
+		slog.WarnContext(s.ctx, "Failed to add the disk of a RAID array", "array", array.Name, "err", err)
+		return
+	}
+	s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.ADD}, Disk: disk})
+	s.eventBus.EmitPartition(events.PartitionEvent{
+		Event:     events.Event{Type: events.EventTypes.ADD},
+		Partition: &part,
+		Disk:      disk,
+	})
+}
+
+// hide removes the disk of a stopped array.
+func (s *RaidService) hide(array dto.RaidArray) {
+	if s.disks == nil || array.DiskId == nil {
+		return
+	}
+	disk, ok := s.disks.Get(*array.DiskId)
+	if !ok {
+		return
+	}
+	s.disks.Remove(*array.DiskId)
+	s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.REMOVE}, Disk: disk})
+}
+
+// updateProblem raises a critical Problem while an array misses members, and
+// dismisses it once the array is whole or rebuilding.
+func (s *RaidService) updateProblem(array dto.RaidArray) {
+	if s.problemService == nil {
+		return
+	}
+	var lost []string
+	for _, member := range array.Members {
+		if member.Faulty || member.Missing {
+			lost = append(lost, member.Device)
+		}
+	}
+	if len(lost) == 0 && (!array.Degraded || array.Sync != nil) {
+		s.dismissProblem(array.Name)
+		return
+	}
+
+	signature := array.State + " " + strings.Join(lost, ",")
+	s.mu.Lock()
+	if s.raised[array.Name] == signature {
+		s.mu.Unlock()
+		return
+	}
+	s.raised[array.Name] = signature
+	s.mu.Unlock()
+
+	description := fmt.Sprintf("The RAID array %s (%s) is %s and no longer protects its data against a disk failure.", array.Name, array.Level, array.State)
+	var actions []dto.ProblemAction
+	if len(lost) > 0 {
+		description = fmt.Sprintf("The RAID array %s (%s) is %s, the members %s left it.", array.Name, array.Level, array.State, strings.Join(lost, ", "))
+		actions = []dto.ProblemAction{{Key: raidReAddAction, Label: "Re-add", IsDefault: true}}
+	}
+	slog.WarnContext(s.ctx, "RAID array degraded", "array", array.Name, "state", array.State, "members", lost)
+	_, err := s.problemService.Upsert(&dto.Problem{
+		ProblemKey:     raidProblemPrefix + array.Name,
+		Title:          fmt.Sprintf("RAID array %s degraded", array.Name),
+		Description:    description,
+		Severity:       dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL,
+		Status:         dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSCREATED,
+		Actions:        actions,
+		TranslationKey: raidProblemTranslationKey,
+		TranslationPlaceholders: map[string]string{
+			"array":   array.Name,
+			"level":   array.Level,
+			"state":   array.State,
+			"members": strings.Join(lost, ", "),
+		},
+		IsFixable:    len(actions) > 0,
+		IsPersistent: true,
+	})
+	if err != nil {
+		tlog.WarnContext(s.ctx, "Unable to upsert degraded RAID array problem", "array", array.Name, "error", err)
+	}
+}
+
+func (s *RaidService) dismissProblem(name string) {
+	s.mu.Lock()
+	_, raised := s.raised[name]
+	delete(s.raised, name)
+	s.mu.Unlock()
+	if !raised || s.problemService == nil {
+		return
+	}
+	if err := s.problemService.Dismiss(raidProblemPrefix + name); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		tlog.WarnContext(s.ctx, "Unable to dismiss degraded RAID array problem", "array", name, "error", err)
+	}
+}
+
+// handleProblemEvent re-adds the members of an array when its Problem is
+// fixed, which is what running the "re-add" action does.
+func (s *RaidService) handleProblemEvent(ctx context.Context, event events.ProblemEvent) errors.E {
+	if event.Type != events.EventTypes.UPDATE || event.Problem == nil ||
+		event.Problem.Status != dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSFIXED {
+		return nil
+	}
+	name, ok := strings.CutPrefix(event.Problem.ProblemKey, raidProblemPrefix)
+	if !ok {
+		return nil
+	}
+	// Raised again by the next check when the array is still degraded.
+	s.mu.Lock()
+	delete(s.raised, name)
+	s.mu.Unlock()
+	if _, err := s.ReAdd(name, ""); err != nil {
+		slog.WarnContext(ctx, "Failed to re-add the RAID array members", "array", name, "error", err)
+	}
+	return nil
+}
+
+// raidDiskId is the id of the disk exposing an array, its /dev/disk/by-id/
+// name when the array UUID is known.
+func raidDiskId(array *dto.RaidArray) string {
+	if array.Uuid != nil && *array.Uuid != "" {
+		return raidByIdPrefix + *array.Uuid
+	}
+	return array.Name
+}
+
+// parseMdadmDetail reads the output of `mdadm --detail`: the "Key : value"
+// header, then the table of the members.
+//
+//	Raid Level : raid1
+//	     State : clean, degraded
+//	...
+//	Number   Major   Minor   RaidDevice State
+//	   0       8       17        0      active sync   /dev/sdb1
+//	   -       0        0        1      removed
+//	   2       8       33        -      faulty   /dev/sdc1
+func parseMdadmDetail(lines []string) dto.RaidArray {
+	var array dto.RaidArray
+	table := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "Number") && strings.Contains(trimmed, "RaidDevice") {
+			table = true
+			continue
+		}
+		if table {
+			if member, ok := parseMdadmMember(trimmed); ok {
+				array.Members = append(array.Members, member)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, " : ")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Raid Level":
+			array.Level = value
+		case "State":
+			array.State = value
+		case "UUID":
+			array.Uuid = new(value)
+		case "Name":
+			// "homeassistant:0  (local to host homeassistant)"
+			if name, _, _ := strings.Cut(value, " "); name != "" {
+				array.Label = new(name)
+			}
+		case "Array Size":
+			// "976630464 (931.39 GiB 1000.07 GB)", in KiB
+			if size, _, _ := strings.Cut(value, " "); size != "" {
+				if kib, err := strconv.Atoi(size); err == nil {
+					array.Size = new(kib * 1024)
+				}
+			}
+		}
+	}
+	return array
+}
+
+// parseMdadmMember reads a row of the `mdadm --detail` member table.
+func parseMdadmMember(row string) (dto.RaidMember, bool) {
+	fields := strings.Fields(row)
+	if len(fields) < 5 {
+		return dto.RaidMember{}, false
+	}
+	member := dto.RaidMember{}
+	state := fields[4:]
+	if last := state[len(state)-1]; strings.HasPrefix(last, "/dev/") {
+		member.Device = last
+		state = state[:len(state)-1]
+	}
+	member.State = strings.Join(state, " ")
+	if slot, err := strconv.Atoi(fields[3]); err == nil {
+		member.Slot = new(slot)
+	}
+	member.Faulty = slices.Contains(state, "faulty")
+	member.Spare = slices.Contains(state, "spare")
+	if member.Device == "" && !slices.Contains(state, "removed") {
+		return dto.RaidMember{}, false
+	}
+	return member, true
+}
+
+func mdadmReason(snapshot dto.CommandExecutionSnapshot, err error) string {
+	if line := lastStderrLine(snapshot); line != "" {
+		return line
+	}
+	return err.Error()
+}
@@ -0,0 +1,426 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+// fakeMdadm logs its arguments to "$RAID_DIR/calls", prints
+// "$RAID_DIR/detail" for --detail and refuses --manage when "$RAID_DIR/refuse"
+// exists.
+const fakeMdadm = `#!/bin/sh
+echo "$*" >> "$RAID_DIR/calls"
+case "$1" in
+--detail)
+	cat "$RAID_DIR/detail"
+	;;
+--manage)
+	if [ -e "$RAID_DIR/refuse" ]; then
+		echo "mdadm: --re-add for $4 to $2 is not possible" >&2
+		exit 1
+	fi
+	;;
+esac
+`
+
+const raidTestUUID = "3f2a1b4c:5d6e7f80:91a2b3c4:d5e6f708"
+
+const raidTestMdstatHealthy = `Personalities : [raid1]
+md0 : active raid1 sdc1[1] sdb1[0]
+      976630464 blocks super 1.2 [2/2] [UU]
+      bitmap: 0/8 pages [0KB], 65536KB chunk
+
+unused devices: <none>
+`
+
+const raidTestDetailHealthy = `/dev/md0:
+           Version : 1.2
+        Raid Level : raid1
+        Array Size : 976630464 (931.39 GiB 1000.07 GB)
+      Raid Devices : 2
+     Total Devices : 2
+             State : clean
+    Active Devices : 2
+    Failed Devices : 0
+     Spare Devices : 0
+              Name : homeassistant:0  (local to host homeassistant)
+              UUID : ` + raidTestUUID + `
+            Events : 1234
+
+    Number   Major   Minor   RaidDevice State
+       0       8       17        0      active sync   /dev/sdb1
+       1       8       33        1      active sync   /dev/sdc1
+`
+
+const raidTestMdstatRemoved = `Personalities : [raid1]
+md0 : active raid1 sdb1[0]
+      976630464 blocks super 1.2 [2/1] [U_]
+
+unused devices: <none>
+`
+
+const raidTestDetailRemoved = `/dev/md0:
+        Raid Level : raid1
+        Array Size : 976630464 (931.39 GiB 1000.07 GB)
+             State : clean, degraded
+              UUID : ` + raidTestUUID + `
+
+    Number   Major   Minor   RaidDevice State
+       0       8       17        0      active sync   /dev/sdb1
+       -       0        0        1      removed
+`
+
+const raidTestMdstatFaulty = `Personalities : [raid1]
+md0 : active raid1 sdc1[1](F) sdb1[0]
+      976630464 blocks super 1.2 [2/1] [U_]
+
+unused devices: <none>
+`
+
+const raidTestDetailFaulty = `/dev/md0:
+        Raid Level : raid1
+        Array Size : 976630464 (931.39 GiB 1000.07 GB)
+             State : clean, degraded
+              UUID : ` + raidTestUUID + `
+
+    Number   Major   Minor   RaidDevice State
+       0       8       17        0      active sync   /dev/sdb1
+       -       0        0        1      removed
+
+       1       8       33        -      faulty   /dev/sdc1
+`
+
+const raidTestMdstatRecovery = `Personalities : [raid1]
+md0 : active raid1 sdc1[2] sdb1[0]
+      976630464 blocks super 1.2 [2/1] [U_]
+      [==>..................]  recovery = 12.6% (123456789/976630464) finish=85.3min speed=166666K/sec
+
+unused devices: <none>
+`
+
+const raidTestDetailRecovery = `/dev/md0:
+        Raid Level : raid1
+        Array Size : 976630464 (931.39 GiB 1000.07 GB)
+             State : clean, degraded, recovering
+              UUID : ` + raidTestUUID + `
+
+    Number   Major   Minor   RaidDevice State
+       0       8       17        0      active sync   /dev/sdb1
+       2       8       33        1      spare rebuilding   /dev/sdc1
+`
+
+type RaidServiceSuite struct {
+	suite.Suite
+	app            *fxtest.App
+	disks          *dto.DiskMap
+	eventBus       events.EventBusInterface
+	problemService ProblemServiceInterface
+	raidService    *RaidService
+	dir            string
+
+	mu       sync.Mutex
+	raid     []events.RaidEvent
+	problems []dto.Problem
+}
+
+func TestRaidServiceSuite(t *testing.T) {
+	suite.Run(t, new(RaidServiceSuite))
+}
+
+func (suite *RaidServiceSuite) SetupTest() {
+	binDir := suite.T().TempDir()
+	suite.dir = suite.T().TempDir()
+	suite.Require().NoError(os.WriteFile(filepath.Join(binDir, "mdadm"), []byte(fakeMdadm), 0o755))
+	suite.T().Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	suite.T().Setenv("RAID_DIR", suite.dir)
+	suite.raid = nil
+	suite.problems = nil
+
+	suite.disks = &dto.DiskMap{}
+	for _, name := range []string{"sdb", "sdc"} {
+		diskID := "ata-DISK_" + strings.ToUpper(name)
+		partID := diskID + "-part1"
+		suite.Require().NoError(suite.disks.AddOrUpdate(&dto.Disk{
+			Id:               new(diskID),
+			LegacyDevicePath: new("/dev/" + name),
+			Partitions: &map[string]dto.Partition{
+				partID: {Id: new(partID), LegacyDevicePath: new("/dev/" + name + "1"), FsType: new("linux_raid_member")},
+			},
+		}))
+	}
+
+	var raidService RaidServiceInterface
+	var fsService FilesystemServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState { return &dto.ContextState{} },
+			func() *dto.DiskMap { return suite.disks },
+			events.NewEventBus,
+			commandexec.NewCommandExecutor,
+			mock.Mock[FilesystemServiceInterface],
+			mock.Mock[ProblemServiceInterface],
+			NewRaidService,
+		),
+		fx.Populate(&suite.eventBus),
+		fx.Populate(&suite.problemService),
+		fx.Populate(&fsService),
+		fx.Populate(&raidService),
+	)
+	suite.app.RequireStart()
+	suite.raidService = raidService.(*RaidService)
+	suite.raidService.procRoot = suite.dir
+
+	mock.When(fsService.FsTypeFromDevice(mock.Any[string]())).ThenReturn("ext4", nil)
+	mock.When(fsService.GetSupportAndInfo(mock.AnyContext(), mock.Exact("ext4"))).ThenReturn(&dto.FilesystemInfo{
+		Name:    "ext4",
+		Support: &dto.FilesystemSupport{CanMount: true, CanFormat: true},
+	}, nil)
+	mock.When(suite.problemService.Upsert(mock.Any[*dto.Problem]())).ThenAnswer(func(args []any) []any {
+		problem := args[0].(*dto.Problem)
+		suite.mu.Lock()
+		suite.problems = append(suite.problems, *problem)
+		suite.mu.Unlock()
+		return []any{problem, nil}
+	})
+	mock.When(suite.problemService.Dismiss(mock.Any[string]())).ThenReturn(nil)
+	suite.eventBus.OnRaid(func(ctx context.Context, event events.RaidEvent) errors.E {
+		suite.mu.Lock()
+		suite.raid = append(suite.raid, event)
+		suite.mu.Unlock()
+		return nil
+	})
+}
+
+func (suite *RaidServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+func (suite *RaidServiceSuite) writeState(mdstat, detail string) {
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.dir, "mdstat"), []byte(mdstat), 0o644))
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.dir, "detail"), []byte(detail), 0o644))
+}
+
+func (suite *RaidServiceSuite) mdadmCalls() []string {
+	data, err := os.ReadFile(filepath.Join(suite.dir, "calls"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	suite.Require().NoError(err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func (suite *RaidServiceSuite) TestParseMdadmDetail() {
+	array := parseMdadmDetail(strings.Split(raidTestDetailFaulty, "\n"))
+	suite.Equal("raid1", array.Level)
+	suite.Equal("clean, degraded", array.State)
+	suite.Equal(raidTestUUID, *array.Uuid)
+	suite.Equal(976630464*1024, *array.Size)
+	suite.Require().Len(array.Members, 3)
+	suite.Equal("/dev/sdb1", array.Members[0].Device)
+	suite.Equal("active sync", array.Members[0].State)
+	suite.Equal(0, *array.Members[0].Slot)
+	suite.Equal("removed", array.Members[1].State)
+	suite.Empty(array.Members[1].Device)
+	suite.Equal("/dev/sdc1", array.Members[2].Device)
+	suite.True(array.Members[2].Faulty)
+	suite.Nil(array.Members[2].Slot)
+
+	array = parseMdadmDetail(strings.Split(raidTestDetailHealthy, "\n"))
+	suite.Equal("homeassistant:0", *array.Label)
+}
+
+func (suite *RaidServiceSuite) TestRefreshExposesArray() {
+	suite.writeState(raidTestMdstatHealthy, raidTestDetailHealthy)
+	var partitions []events.PartitionEvent
+	suite.eventBus.OnPartition(func(ctx context.Context, event events.PartitionEvent) errors.E {
+		partitions = append(partitions, event)
+		return nil
+	})
+
+	arrays, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	suite.Require().Len(arrays, 1)
+	array := arrays[0]
+	suite.Equal("md0", array.Name)
+	suite.Equal("/dev/md0", array.DevicePath)
+	suite.Equal("clean", array.State)
+	suite.False(array.Degraded)
+	suite.Nil(array.Sync)
+	suite.Equal(2, array.DisksActive)
+	suite.Require().Len(array.Members, 2)
+	suite.Equal("ata-DISK_SDB", *array.Members[0].DiskId)
+	suite.Equal("ata-DISK_SDB-part1", *array.Members[0].PartitionId)
+	suite.Equal("ata-DISK_SDC-part1", *array.Members[1].PartitionId)
+
+	diskID := "md-uuid-" + raidTestUUID
+	suite.Equal(diskID, *array.DiskId)
+	disk, ok := suite.disks.Get(diskID)
+	suite.Require().True(ok)
+	part, ok := suite.disks.GetPartition(diskID, *array.PartitionId)
+	suite.Require().True(ok)
+	suite.Equal("/dev/disk/by-id/"+diskID, *part.DevicePath)
+	suite.Equal("/dev/md0", *part.LegacyDevicePath)
+	suite.Equal("ext4", *part.FsType)
+	suite.Equal("homeassistant:0", *part.Name)
+	suite.Equal(976630464*1024, *disk.Size)
+	suite.Require().Len(partitions, 1)
+	suite.Equal(events.EventTypes.ADD, partitions[0].Type)
+
+	// An unchanged array is neither exposed nor sent again.
+	_, err = suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	suite.Len(partitions, 1)
+	suite.Len(suite.raid, 1)
+	suite.Len(suite.mdadmCalls(), 1)
+	suite.Empty(suite.problems)
+}
+
+func (suite *RaidServiceSuite) TestRecoveryProgressIsSent() {
+	suite.writeState(raidTestMdstatRecovery, raidTestDetailRecovery)
+	arrays, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	suite.Require().NotNil(arrays[0].Sync)
+	suite.Equal("recovering", arrays[0].Sync.Action)
+	suite.InDelta(12.6, arrays[0].Sync.Percent, 0.01)
+	suite.InDelta(85.3, arrays[0].Sync.FinishMinutes, 0.01)
+	suite.Equal(int64(166666), arrays[0].Sync.SpeedKBps)
+	// A rebuilding member is not a lost one.
+	suite.True(arrays[0].Degraded)
+	suite.Equal(0, arrays[0].DisksFailed)
+	suite.Empty(suite.problems)
+
+	suite.writeState(strings.Replace(raidTestMdstatRecovery, "12.6%", "13.1%", 1), raidTestDetailRecovery)
+	_, err = suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	suite.Require().Len(suite.raid, 2)
+	suite.Equal(events.EventTypes.UPDATE, suite.raid[1].Type)
+	suite.InDelta(13.1, suite.raid[1].Array.Sync.Percent, 0.01)
+}
+
+func (suite *RaidServiceSuite) TestRemovedMemberRaisesProblem() {
+	suite.writeState(raidTestMdstatHealthy, raidTestDetailHealthy)
+	_, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+
+	suite.writeState(raidTestMdstatRemoved, raidTestDetailRemoved)
+	arrays, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	array := arrays[0]
+	suite.True(array.Degraded)
+	suite.Require().Len(array.Members, 2)
+	suite.Equal("/dev/sdc1", array.Members[1].Device)
+	suite.True(array.Members[1].Missing)
+	suite.Equal("ata-DISK_SDC-part1", *array.Members[1].PartitionId)
+
+	suite.Require().Len(suite.problems, 1)
+	problem := suite.problems[0]
+	suite.Equal("raid_degraded_md0", problem.ProblemKey)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL, problem.Severity)
+	suite.Require().Len(problem.Actions, 1)
+	suite.Equal("re-add", problem.Actions[0].Key)
+	suite.Equal("/dev/sdc1", problem.TranslationPlaceholders["members"])
+
+	// Raised once while the array stays the same.
+	_, err = suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	suite.Len(suite.problems, 1)
+
+	suite.writeState(raidTestMdstatHealthy, raidTestDetailHealthy)
+	_, err = suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	mock.Verify(suite.problemService, matchers.Times(1)).Dismiss(mock.Exact("raid_degraded_md0"))
+}
+
+func (suite *RaidServiceSuite) TestReAddFaultyMember() {
+	suite.writeState(raidTestMdstatFaulty, raidTestDetailFaulty)
+	arrays, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	suite.Equal(1, arrays[0].DisksFailed)
+	suite.Require().Len(suite.problems, 1)
+
+	array, err := suite.raidService.ReAdd("md0", "")
+	suite.Require().NoError(err)
+	suite.Equal("md0", array.Name)
+	calls := suite.mdadmCalls()
+	suite.Contains(calls, "--manage /dev/md0 --remove /dev/sdc1")
+	suite.Contains(calls, "--manage /dev/md0 --re-add /dev/sdc1")
+}
+
+func (suite *RaidServiceSuite) TestReAddRefused() {
+	suite.writeState(raidTestMdstatFaulty, raidTestDetailFaulty)
+	_, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.dir, "refuse"), nil, 0o644))
+
+	_, err = suite.raidService.ReAdd("md0", "/dev/sdc1")
+	suite.Require().Error(err)
+	suite.True(errors.Is(err, dto.ErrorInvalidStateForOperation))
+	suite.Contains(errors.AllDetails(err)["reason"], "is not possible")
+
+	_, err = suite.raidService.ReAdd("md0", "/dev/sdb1")
+	suite.True(errors.Is(err, dto.ErrorInvalidParameter))
+	_, err = suite.raidService.ReAdd("md9", "")
+	suite.True(errors.Is(err, dto.ErrorNotFound))
+}
+
+func (suite *RaidServiceSuite) TestReAddWithoutLostMember() {
+	suite.writeState(raidTestMdstatHealthy, raidTestDetailHealthy)
+	_, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+
+	_, err = suite.raidService.ReAdd("md0", "")
+	suite.True(errors.Is(err, dto.ErrorInvalidStateForOperation))
+}
+
+func (suite *RaidServiceSuite) TestProblemActionReAdds() {
+	suite.writeState(raidTestMdstatFaulty, raidTestDetailFaulty)
+	_, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+
+	suite.eventBus.EmitProblem(events.ProblemEvent{
+		Event: events.Event{Type: events.EventTypes.UPDATE},
+		Problem: &dto.Problem{
+			ProblemKey: "raid_degraded_md0",
+			Status:     dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSFIXED,
+		},
+	})
+	suite.Contains(suite.mdadmCalls(), "--manage /dev/md0 --re-add /dev/sdc1")
+	// The array did not change: the Problem comes back.
+	suite.Len(suite.problems, 2)
+}
+
+func (suite *RaidServiceSuite) TestStoppedArrayIsHidden() {
+	suite.writeState(raidTestMdstatHealthy, raidTestDetailHealthy)
+	_, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+
+	suite.writeState("Personalities : [raid1]\nunused devices: <none>\n", "")
+	arrays, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	suite.Empty(arrays)
+	_, ok := suite.disks.Get("md-uuid-" + raidTestUUID)
+	suite.False(ok)
+	suite.Equal(events.EventTypes.REMOVE, suite.raid[len(suite.raid)-1].Type)
+}
+
+func (suite *RaidServiceSuite) TestNoMdDriver() {
+	arrays, err := suite.raidService.Refresh()
+	suite.Require().NoError(err)
+	suite.Empty(arrays)
+}
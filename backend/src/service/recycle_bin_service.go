@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+)
+
+// recycleBinPurgeInterval is how often the retention of every recycle bin is
+// applied. Policies are expressed in days, so hourly is precise enough.
+const recycleBinPurgeInterval = time.Hour
+
+// fileChangeTime gives when a file was deleted: samba moves it into the bin
+// with a rename, which sets its ctime. The atime also changes whenever a
+// deleted file is read, which would push back its expiry.
+var fileChangeTime = osutil.ChangeTime
+
+type RecycleBinServiceInterface interface {
+	// ListRecycleBin returns the files in the recycle bin of a user of a
+	// share, most recently deleted first.
+	ListRecycleBin(share, user string) ([]dto.RecycleBinEntry, errors.E)
+	// RestoreRecycleBinEntry moves a file of the recycle bin of a user back
+	// to its original place in the share.
+	RestoreRecycleBinEntry(share, user, path string) errors.E
+	// EmptyRecycleBin deletes every file in the recycle bin of a user.
+	EmptyRecycleBin(share, user string) (*dto.RecycleBinPurgeResult, errors.E)
+	// PurgeRecycleBin applies the retention policy of a share to all its
+	// recycle bins. A non zero maxAge overrides the max age of the policy.
+	PurgeRecycleBin(share string, maxAge time.Duration) (*dto.RecycleBinPurgeResult, errors.E)
+	// PurgeAll purges the recycle bin of every share with a retention policy.
+	PurgeAll() errors.E
+}
+
+type RecycleBinService struct {
+	ctx          context.Context
+	shareService ShareServiceInterface
+	now          func() time.Time
+
+	mu sync.Mutex // serializes changes to the recycle bins
+}
+
+type RecycleBinServiceParams struct {
+	fx.In
+	Ctx          context.Context
+	ShareService ShareServiceInterface
+}
+
+// recycleBinFile is a file found while walking a recycle bin.
+type recycleBinFile struct {
+	path      string
+	size      uint64
+	deletedAt time.Time
+}
+
+func NewRecycleBinService(lc fx.Lifecycle, in RecycleBinServiceParams) RecycleBinServiceInterface {
+	s := &RecycleBinService{
+		ctx:          in.Ctx,
+		shareService: in.ShareService,
+		now:          time.Now,
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok && wg != nil {
+				wg.Go(func() {
+					if err := s.run(); err != nil && !errors.Is(err, context.Canceled) {
+						slog.WarnContext(s.ctx, "RecycleBinService run loop stopped with error", "error", err)
+					}
+				})
+			}
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *RecycleBinService) run() errors.E {
+	for {
+		if err := s.PurgeAll(); err != nil {
+			tlog.DebugContext(s.ctx, "Failed to purge recycle bins", "error", err)
+		}
+		select {
+		case <-s.ctx.Done():
+			slog.DebugContext(s.ctx, "Run process closed", "err", s.ctx.Err())
+			return errors.WithStack(s.ctx.Err())
+		case <-time.After(recycleBinPurgeInterval):
+		}
+	}
+}
+
+// recycleBinRoot returns the share and the directory holding its recycle bins.
+func (s *RecycleBinService) recycleBinRoot(name string) (*dto.SharedResource, string, errors.E) {
+	share, errE := s.shareService.GetShare(name)
+	if errE != nil {
+		return nil, "", errE
+	}
+	path, errE := sharePath(*share)
+	if errE != nil {
+		return nil, "", errE
+	}
+	return share, filepath.Join(path, dto.RecycleBinDir), nil
+}
+
+// userRecycleBin returns the share path and the recycle bin of a user. The
+// user name becomes a path element, so it must be a single one.
+func (s *RecycleBinService) userRecycleBin(share, user string) (string, string, errors.E) {
+	if user == "" || user == "." || user == ".." || strings.ContainsAny(user, "/\\") {
+		return "", "", errors.WithDetails(dto.ErrorInvalidParameter, "username", user)
+	}
+	_, root, errE := s.recycleBinRoot(share)
+	if errE != nil {
+		return "", "", errE
+	}
+	return filepath.Dir(root), filepath.Join(root, user), nil
+}
+
+// walkRecycleBin returns the files under dir and its sub directories, deepest
+// last. A missing dir is an empty bin.
+func walkRecycleBin(dir string) ([]recycleBinFile, []string, errors.E) {
+	var files []recycleBinFile
+	var dirs []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != dir {
+				dirs = append(dirs, p)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, recycleBinFile{
+			path:      p,
+			size:      uint64(info.Size()),
+			deletedAt: fileChangeTime(info),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.WithDetails(err, "path", dir)
+	}
+	return files, dirs, nil
+}
+
+// removeEmptyDirs removes the directories left empty by a purge, deepest
+// first so parents empty out after their children.
+func removeEmptyDirs(dirs []string) {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+}
+
+func (s *RecycleBinService) ListRecycleBin(share, user string) ([]dto.RecycleBinEntry, errors.E) {
+	_, bin, errE := s.userRecycleBin(share, user)
+	if errE != nil {
+		return nil, errE
+	}
+	files, _, errE := walkRecycleBin(bin)
+	if errE != nil {
+		return nil, errE
+	}
+	entries := make([]dto.RecycleBinEntry, 0, len(files))
+	for _, file := range files {
+		rel, err := filepath.Rel(bin, file.path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		entries = append(entries, dto.RecycleBinEntry{
+			Path:      filepath.ToSlash(rel),
+			Size:      file.size,
+			DeletedAt: file.deletedAt,
+		})
+	}
+	slices.SortFunc(entries, func(a, b dto.RecycleBinEntry) int {
+		return b.DeletedAt.Compare(a.DeletedAt)
+	})
+	return entries, nil
+}
+
+func (s *RecycleBinService) RestoreRecycleBinEntry(share, user, path string) errors.E {
+	root, bin, errE := s.userRecycleBin(share, user)
+	if errE != nil {
+		return errE
+	}
+	rel := filepath.FromSlash(path)
+	if !filepath.IsLocal(rel) || strings.SplitN(filepath.ToSlash(rel), "/", 2)[0] == dto.RecycleBinDir {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "path", path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source := filepath.Join(bin, rel)
+	info, err := os.Lstat(source)
+	if err != nil || info.IsDir() {
+		return errors.WithDetails(dto.ErrorNotFound, "share", share, "username", user, "path", path)
+	}
+	target := filepath.Join(root, rel)
+	if _, err := os.Lstat(target); err == nil {
+		return errors.WithDetails(dto.ErrorConflict, "share", share, "path", path, "reason", "a file with the same name exists")
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o777); err != nil {
+		return errors.Wrapf(err, "failed to recreate the parent of %s", path)
+	}
+	if err := os.Rename(source, target); err != nil {
+		return errors.Wrapf(err, "failed to restore %s", path)
+	}
+	// Drop the directories of the bin emptied by the restore.
+	for dir := filepath.Dir(source); dir != bin; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	tlog.InfoContext(s.ctx, "Recycle bin entry restored", "share", share, "username", user, "path", path)
+	return nil
+}
+
+func (s *RecycleBinService) EmptyRecycleBin(share, user string) (*dto.RecycleBinPurgeResult, errors.E) {
+	_, bin, errE := s.userRecycleBin(share, user)
+	if errE != nil {
+		return nil, errE
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, dirs, errE := walkRecycleBin(bin)
+	if errE != nil {
+		return nil, errE
+	}
+	result, errE := removeRecycleBinFiles(files)
+	removeEmptyDirs(dirs)
+	if errE != nil {
+		return nil, errE
+	}
+	tlog.InfoContext(s.ctx, "Recycle bin emptied", "share", share, "username", user, "files", result.RemovedFiles)
+	return result, nil
+}
+
+func removeRecycleBinFiles(files []recycleBinFile) (*dto.RecycleBinPurgeResult, errors.E) {
+	result := &dto.RecycleBinPurgeResult{}
+	for _, file := range files {
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			return result, errors.WithDetails(err, "path", file.path)
+		}
+		result.RemovedFiles++
+		result.FreedBytes += file.size
+	}
+	return result, nil
+}
+
+func (s *RecycleBinService) PurgeRecycleBin(name string, maxAge time.Duration) (*dto.RecycleBinPurgeResult, errors.E) {
+	share, root, errE := s.recycleBinRoot(name)
+	if errE != nil {
+		return nil, errE
+	}
+	policy := dto.RecycleBinPolicy{}
+	if share.RecycleBinPolicy != nil {
+		policy = *share.RecycleBinPolicy
+	}
+	if maxAge == 0 {
+		maxAge = time.Duration(policy.MaxAgeDays) * 24 * time.Hour
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, dirs, errE := walkRecycleBin(root)
+	if errE != nil {
+		return nil, errE
+	}
+	result, errE := removeRecycleBinFiles(recycleBinFilesToPurge(files, maxAge, policy.MaxSizeBytes, s.now()))
+	removeEmptyDirs(dirs)
+	if errE != nil {
+		return nil, errE
+	}
+	if result.RemovedFiles > 0 {
+		tlog.InfoContext(s.ctx, "Recycle bin purged", "share", name, "files", result.RemovedFiles, "bytes", result.FreedBytes)
+	}
+	return result, nil
+}
+
+// recycleBinFilesToPurge returns the files deleted before maxAge, then the
+// oldest of the others until the bin fits in maxSize. Zero disables a limit.
+func recycleBinFilesToPurge(files []recycleBinFile, maxAge time.Duration, maxSize uint64, now time.Time) []recycleBinFile {
+	slices.SortFunc(files, func(a, b recycleBinFile) int {
+		return a.deletedAt.Compare(b.deletedAt)
+	})
+	var total uint64
+	for _, file := range files {
+		total += file.size
+	}
+	purge := []recycleBinFile{}
+	for _, file := range files {
+		expired := maxAge > 0 && file.deletedAt.Before(now.Add(-maxAge))
+		oversize := maxSize > 0 && total > maxSize
+		if !expired && !oversize {
+			break
+		}
+		purge = append(purge, file)
+		total -= file.size
+	}
+	return purge
+}
+
+func (s *RecycleBinService) PurgeAll() errors.E {
+	shares, errE := s.shareService.ListShares()
+	if errE != nil {
+		return errE
+	}
+	for _, share := range shares {
+		policy := share.RecycleBinPolicy
+		if share.RecycleBin == nil || !*share.RecycleBin || (share.Disabled != nil && *share.Disabled) ||
+			policy == nil || (policy.MaxAgeDays == 0 && policy.MaxSizeBytes == 0) {
+			continue
+		}
+		if share.MountPointData == nil || !share.MountPointData.IsMounted {
+			continue
+		}
+		if _, err := s.PurgeRecycleBin(share.Name, 0); err != nil {
+			tlog.WarnContext(s.ctx, "Unable to purge recycle bin", "share", share.Name, "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type RecycleBinServiceSuite struct {
+	suite.Suite
+	app          *fxtest.App
+	shareService ShareServiceInterface
+	service      *RecycleBinService
+	now          time.Time
+	shareRoot    string
+	share        dto.SharedResource
+}
+
+func TestRecycleBinServiceSuite(t *testing.T) {
+	suite.Run(t, new(RecycleBinServiceSuite))
+}
+
+func (suite *RecycleBinServiceSuite) SetupTest() {
+	var recycleBinService RecycleBinServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			mock.Mock[ShareServiceInterface],
+			NewRecycleBinService,
+		),
+		fx.Populate(&suite.shareService),
+		fx.Populate(&recycleBinService),
+	)
+	suite.app.RequireStart()
+
+	suite.service = recycleBinService.(*RecycleBinService)
+	suite.now = time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	suite.service.now = func() time.Time { return suite.now }
+	// The ctime of a test file can't be set, so the fixtures date their
+	// deletion with the mtime.
+	fileChangeTime = func(info os.FileInfo) time.Time { return info.ModTime() }
+
+	suite.shareRoot = suite.T().TempDir()
+	enabled := true
+	suite.share = dto.SharedResource{
+		Name:           "data",
+		RecycleBin:     &enabled,
+		MountPointData: &dto.MountPointData{Path: suite.shareRoot, IsMounted: true},
+	}
+	mock.When(suite.shareService.GetShare(mock.Exact("data"))).ThenAnswer(func(_ []any) []any {
+		share := suite.share
+		return []any{&share, nil}
+	})
+}
+
+func (suite *RecycleBinServiceSuite) TearDownTest() {
+	fileChangeTime = osutil.ChangeTime
+	suite.app.RequireStop()
+}
+
+// recycled puts a file of size bytes in the bin of user, deleted age ago.
+func (suite *RecycleBinServiceSuite) recycled(user, path string, size int, age time.Duration) string {
+	file := filepath.Join(suite.shareRoot, dto.RecycleBinDir, user, filepath.FromSlash(path))
+	suite.Require().NoError(os.MkdirAll(filepath.Dir(file), 0o755))
+	suite.Require().NoError(os.WriteFile(file, make([]byte, size), 0o644))
+	deleted := suite.now.Add(-age)
+	suite.Require().NoError(os.Chtimes(file, deleted, deleted))
+	return file
+}
+
+func (suite *RecycleBinServiceSuite) TestListRecycleBin() {
+	suite.recycled("alice", "docs/old.odt", 10, 48*time.Hour)
+	suite.recycled("alice", "new.txt", 5, time.Hour)
+	suite.recycled("bob", "other.txt", 1, time.Hour)
+
+	entries, err := suite.service.ListRecycleBin("data", "alice")
+	suite.Require().NoError(err)
+	suite.Require().Len(entries, 2)
+	suite.Equal("new.txt", entries[0].Path, "most recently deleted first")
+	suite.Equal("docs/old.odt", entries[1].Path)
+	suite.Equal(uint64(10), entries[1].Size)
+	suite.True(entries[1].DeletedAt.Equal(suite.now.Add(-48 * time.Hour)))
+
+	entries, err = suite.service.ListRecycleBin("data", "carol")
+	suite.Require().NoError(err)
+	suite.Empty(entries, "a user without a bin has nothing deleted")
+}
+
+func (suite *RecycleBinServiceSuite) TestInvalidUsername() {
+	for _, user := range []string{"", ".", "..", "alice/../bob"} {
+		_, err := suite.service.ListRecycleBin("data", user)
+		suite.ErrorIs(err, dto.ErrorInvalidParameter, "user %q", user)
+	}
+}
+
+func (suite *RecycleBinServiceSuite) TestRestoreRecycleBinEntry() {
+	source := suite.recycled("alice", "docs/reports/q1.odt", 10, time.Hour)
+
+	suite.Require().NoError(suite.service.RestoreRecycleBinEntry("data", "alice", "docs/reports/q1.odt"))
+	suite.FileExists(filepath.Join(suite.shareRoot, "docs", "reports", "q1.odt"))
+	suite.NoFileExists(source)
+	suite.NoDirExists(filepath.Join(suite.shareRoot, dto.RecycleBinDir, "alice", "docs"), "emptied directories are removed")
+	suite.DirExists(filepath.Join(suite.shareRoot, dto.RecycleBinDir, "alice"))
+
+	suite.recycled("alice", "docs/reports/q1.odt", 10, time.Hour)
+	err := suite.service.RestoreRecycleBinEntry("data", "alice", "docs/reports/q1.odt")
+	suite.ErrorIs(err, dto.ErrorConflict, "an existing file is never overwritten")
+
+	err = suite.service.RestoreRecycleBinEntry("data", "alice", "missing.txt")
+	suite.ErrorIs(err, dto.ErrorNotFound)
+
+	for _, path := range []string{"../bob/other.txt", "/etc/passwd", ".recycle/bob/other.txt", ""} {
+		err = suite.service.RestoreRecycleBinEntry("data", "alice", path)
+		suite.ErrorIs(err, dto.ErrorInvalidParameter, "path %q", path)
+	}
+}
+
+func (suite *RecycleBinServiceSuite) TestEmptyRecycleBin() {
+	suite.recycled("alice", "docs/a.txt", 10, time.Hour)
+	suite.recycled("alice", "b.txt", 5, time.Hour)
+	other := suite.recycled("bob", "c.txt", 1, time.Hour)
+
+	result, err := suite.service.EmptyRecycleBin("data", "alice")
+	suite.Require().NoError(err)
+	suite.Equal(uint(2), result.RemovedFiles)
+	suite.Equal(uint64(15), result.FreedBytes)
+	suite.NoDirExists(filepath.Join(suite.shareRoot, dto.RecycleBinDir, "alice", "docs"))
+	suite.FileExists(other, "other users keep their bin")
+}
+
+func (suite *RecycleBinServiceSuite) TestPurgeRecycleBin_MaxAgeAndSize() {
+	expired := suite.recycled("alice", "docs/expired.txt", 100, 10*24*time.Hour)
+	oldest := suite.recycled("bob", "oldest.txt", 100, 5*24*time.Hour)
+	older := suite.recycled("alice", "older.txt", 100, 3*24*time.Hour)
+	recent := suite.recycled("bob", "recent.txt", 100, time.Hour)
+	suite.share.RecycleBinPolicy = &dto.RecycleBinPolicy{MaxAgeDays: 7, MaxSizeBytes: 250}
+
+	result, err := suite.service.PurgeRecycleBin("data", 0)
+	suite.Require().NoError(err)
+	suite.Equal(uint(2), result.RemovedFiles)
+	suite.Equal(uint64(200), result.FreedBytes)
+	suite.NoFileExists(expired)
+	suite.NoFileExists(oldest, "the oldest entries go until the bin fits")
+	suite.FileExists(older)
+	suite.FileExists(recent)
+	suite.NoDirExists(filepath.Dir(expired))
+
+	result, err = suite.service.PurgeRecycleBin("data", 2*24*time.Hour)
+	suite.Require().NoError(err)
+	suite.Equal(uint(1), result.RemovedFiles, "an explicit max age overrides the policy")
+	suite.NoFileExists(older)
+	suite.FileExists(recent)
+}
+
+func (suite *RecycleBinServiceSuite) TestPurgeAll_OnlySharesWithPolicy() {
+	expired := suite.recycled("alice", "expired.txt", 1, 40*24*time.Hour)
+	otherRoot := suite.T().TempDir()
+	otherFile := filepath.Join(otherRoot, dto.RecycleBinDir, "alice", "expired.txt")
+	suite.Require().NoError(os.MkdirAll(filepath.Dir(otherFile), 0o755))
+	suite.Require().NoError(os.WriteFile(otherFile, []byte("x"), 0o644))
+	old := suite.now.Add(-40 * 24 * time.Hour)
+	suite.Require().NoError(os.Chtimes(otherFile, old, old))
+
+	suite.share.RecycleBinPolicy = &dto.RecycleBinPolicy{MaxAgeDays: 30}
+	enabled := true
+	mock.When(suite.shareService.ListShares()).ThenReturn([]dto.SharedResource{
+		suite.share,
+		{
+			Name:           "nopolicy",
+			RecycleBin:     &enabled,
+			MountPointData: &dto.MountPointData{Path: otherRoot, IsMounted: true},
+		},
+	}, nil)
+
+	suite.Require().NoError(suite.service.PurgeAll())
+	suite.NoFileExists(expired)
+	suite.FileExists(otherFile, "bins without a policy grow as before")
+}
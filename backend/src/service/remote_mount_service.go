@@ -0,0 +1,894 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/prometheus/procfs"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// remoteDiskPrefix prefixes the id of the disk, and of its only partition,
+// exposing a remote mount, followed by the remote name.
+const remoteDiskPrefix = "remote-"
+
+const (
+	remoteCheckInterval       = 30 * time.Second
+	remoteNetworkWaitInterval = 5 * time.Second
+	remoteProbeTimeout        = 3 * time.Second
+)
+
+// remotePorts are the ports the health probe connects to, by protocol.
+var remotePorts = map[string]int{"cifs": 445, "nfs": 2049}
+
+type RemoteMountServiceInterface interface {
+	// ListRemoteMounts returns the remote mounts with the state of their server.
+	ListRemoteMounts() ([]dto.RemoteMount, errors.E)
+	// CreateRemoteMount mounts a CIFS share or an NFS export of another host
+	// and exposes it as a volume shares can be created on.
+	CreateRemoteMount(request dto.RemoteMountCreateRequest) (*dto.RemoteMount, errors.E)
+	// UpdateRemoteMount changes the mount options or the credentials of a
+	// remote, mounting it again when it is mounted.
+	UpdateRemoteMount(name string, request dto.RemoteMountUpdateRequest) (*dto.RemoteMount, errors.E)
+	// MountRemote mounts a remote and keeps it mounted across network losses.
+	MountRemote(name string) (*dto.RemoteMount, errors.E)
+	// UnmountRemote unmounts a remote until it is mounted again.
+	UnmountRemote(name string) (*dto.RemoteMount, errors.E)
+	// DeleteRemoteMount unmounts a remote no share uses and forgets it with
+	// its credentials.
+	DeleteRemoteMount(name string) errors.E
+}
+
+type RemoteMountService struct {
+	ctx       context.Context
+	state     *dto.ContextState
+	db        *gorm.DB
+	disks     *dto.DiskMap
+	eventBus  events.EventBusInterface
+	fsService FilesystemServiceInterface
+	mountRoot string
+	isMounted func(path string) (bool, error)
+	networkUp func() bool
+	probe     func(ctx context.Context, address string) error
+
+	opMu   sync.Mutex
+	mu     sync.Mutex
+	wanted map[string]bool   // remotes to keep mounted
+	health map[string]string // remote name -> why its server is unreachable, empty when it answers
+}
+
+type RemoteMountServiceParams struct {
+	fx.In
+	Ctx               context.Context
+	State             *dto.ContextState
+	Db                *gorm.DB
+	Disks             *dto.DiskMap
+	EventBus          events.EventBusInterface
+	FilesystemService FilesystemServiceInterface
+}
+
+func NewRemoteMountService(lc fx.Lifecycle, in RemoteMountServiceParams) RemoteMountServiceInterface {
+	s := &RemoteMountService{
+		ctx:       in.Ctx,
+		state:     in.State,
+		db:        in.Db,
+		disks:     in.Disks,
+		eventBus:  in.EventBus,
+		fsService: in.FilesystemService,
+		mountRoot: "/mnt",
+		isMounted: osutil.IsMounted,
+		networkUp: func() bool { return hasDefaultRoute(procfs.DefaultMountPoint) },
+		probe:     dialProbe,
+		wanted:    make(map[string]bool),
+		health:    make(map[string]string),
+	}
+
+	var unsubscribe func()
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			unsubscribe = in.EventBus.OnMountPoint(s.handleMountPointEvent)
+			s.startup()
+			if wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok && wg != nil {
+				wg.Go(func() {
+					if err := s.run(); err != nil && !errors.Is(err, context.Canceled) {
+						slog.WarnContext(s.ctx, "RemoteMountService run loop stopped with error", "error", err)
+					}
+				})
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			if unsubscribe != nil {
+				unsubscribe()
+			}
+			return nil
+		},
+	})
+
+	return s
+}
+
+// startup exposes the stored remotes and marks the ones to mount at startup,
+// which the run loop mounts once the network is up and their server answers.
+func (s *RemoteMountService) startup() {
+	remotes, errE := s.load()
+	if errE != nil {
+		slog.WarnContext(s.ctx, "Failed to load the remote mounts", "err", errE)
+		return
+	}
+	s.mu.Lock()
+	for _, remote := range remotes {
+		s.wanted[remote.Name] = remote.IsToMountAtStartup && !s.state.ProtectedMode
+	}
+	s.mu.Unlock()
+	for i := range remotes {
+		s.expose(&remotes[i])
+	}
+}
+
+func (s *RemoteMountService) run() errors.E {
+	for {
+		wait := remoteCheckInterval
+		if !s.check() {
+			wait = remoteNetworkWaitInterval
+		}
+		select {
+		case <-s.ctx.Done():
+			slog.DebugContext(s.ctx, "Run process closed", "err", s.ctx.Err())
+			return errors.WithStack(s.ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (s *RemoteMountService) ListRemoteMounts() ([]dto.RemoteMount, errors.E) {
+	remotes, errE := s.load()
+	if errE != nil {
+		return nil, errE
+	}
+	ret := make([]dto.RemoteMount, 0, len(remotes))
+	for i := range remotes {
+		ret = append(ret, *s.expose(&remotes[i]))
+	}
+	return ret, nil
+}
+
+func (s *RemoteMountService) CreateRemoteMount(request dto.RemoteMountCreateRequest) (*dto.RemoteMount, errors.E) {
+	if s.state.ProtectedMode {
+		return nil, errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "CreateRemoteMount", "reason", "mounting a remote is not permitted when ProtectedMode is enabled")
+	}
+	remote := &dbom.RemoteMount{
+		Name:               request.Name,
+		Protocol:           request.Protocol,
+		Server:             strings.Trim(request.Server, "[]"),
+		Share:              request.Share,
+		Path:               filepath.Join(s.mountRoot, request.Name),
+		Username:           request.Username,
+		Domain:             request.Domain,
+		Flags:              toMounDataFlags(request.Flags),
+		CustomFlags:        toMounDataFlags(request.CustomFlags),
+		IsToMountAtStartup: request.IsToMountAtStartup == nil || *request.IsToMountAtStartup,
+	}
+	if errE := s.validate(remote, request.Password); errE != nil {
+		return nil, errE
+	}
+
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	if _, err := gorm.G[dbom.RemoteMount](s.db).Where(g.RemoteMount.Name.Eq(remote.Name)).First(s.ctx); err == nil {
+		return nil, errors.WithDetails(dto.ErrorConflict, "Remote", remote.Name, "reason", "a remote with this name already exists")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.WithStack(err)
+	}
+	if _, ok := s.disks.GetMountPointByPath(remote.Path); ok {
+		return nil, errors.WithDetails(dto.ErrorConflict, "Remote", remote.Name, "reason", remote.Path+" is already a mount point")
+	}
+
+	if errE := s.storeCredentials(remote, request.Password); errE != nil {
+		return nil, errE
+	}
+	if errE := s.mount(remote); errE != nil {
+		s.removeCredentials(remote)
+		return nil, errE
+	}
+	if errE := s.persist(remote); errE != nil {
+		if err := s.fsService.UnmountPartition(s.ctx, remote.Path, remote.Protocol, false, false); err != nil {
+			slog.WarnContext(s.ctx, "Failed to unmount a remote that could not be stored", "remote", remote.Name, "err", err)
+		}
+		s.removeCredentials(remote)
+		return nil, errE
+	}
+	s.mu.Lock()
+	s.wanted[remote.Name] = true
+	s.health[remote.Name] = ""
+	s.mu.Unlock()
+	slog.InfoContext(s.ctx, "Created remote mount", "remote", remote.Name, "source", remoteSource(remote), "path", remote.Path)
+	return s.expose(remote), nil
+}
+
+func (s *RemoteMountService) UpdateRemoteMount(name string, request dto.RemoteMountUpdateRequest) (*dto.RemoteMount, errors.E) {
+	if s.state.ProtectedMode {
+		return nil, errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "UpdateRemoteMount", "reason", "changing a remote is not permitted when ProtectedMode is enabled")
+	}
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	remote, errE := s.get(name)
+	if errE != nil {
+		return nil, errE
+	}
+	credentialsChanged := request.Username != nil || request.Domain != nil || request.Password != nil
+	optionsChanged := request.Flags != nil || request.CustomFlags != nil
+	if request.Username != nil {
+		remote.Username = *request.Username
+	}
+	if request.Domain != nil {
+		remote.Domain = *request.Domain
+	}
+	if request.Flags != nil {
+		remote.Flags = toMounDataFlags(*request.Flags)
+	}
+	if request.CustomFlags != nil {
+		remote.CustomFlags = toMounDataFlags(*request.CustomFlags)
+	}
+	if request.IsToMountAtStartup != nil {
+		remote.IsToMountAtStartup = *request.IsToMountAtStartup
+	}
+	password := request.Password
+	if password == nil && remote.Username != "" {
+		password = s.storedPassword(remote)
+	}
+	if errE := s.validate(remote, password); errE != nil {
+		return nil, errE
+	}
+
+	if credentialsChanged {
+		if errE := s.storeCredentials(remote, password); errE != nil {
+			return nil, errE
+		}
+	}
+	if err := s.db.WithContext(s.ctx).Save(remote).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if mounted, _ := s.isMounted(remote.Path); mounted && (credentialsChanged || optionsChanged) {
+		if errE := s.fsService.UnmountPartition(s.ctx, remote.Path, remote.Protocol, false, false); errE != nil {
+			return nil, errors.WithDetails(dto.ErrorUnmountFail, "Remote", name, "Path", remote.Path, "reason", errE.Error())
+		}
+		if errE := s.mount(remote); errE != nil {
+			s.expose(remote)
+			return nil, errE
+		}
+		slog.InfoContext(s.ctx, "Mounted remote again with its new options", "remote", remote.Name)
+	}
+	return s.expose(remote), nil
+}
+
+func (s *RemoteMountService) MountRemote(name string) (*dto.RemoteMount, errors.E) {
+	if s.state.ProtectedMode {
+		return nil, errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "MountRemote", "reason", "mounting a remote is not permitted when ProtectedMode is enabled")
+	}
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	remote, errE := s.get(name)
+	if errE != nil {
+		return nil, errE
+	}
+	if mounted, _ := s.isMounted(remote.Path); mounted {
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "Remote", name, "reason", "the remote is already mounted")
+	}
+	if errE := s.mount(remote); errE != nil {
+		return nil, errE
+	}
+	s.mu.Lock()
+	s.wanted[remote.Name] = true
+	s.health[remote.Name] = ""
+	s.mu.Unlock()
+	return s.expose(remote), nil
+}
+
+func (s *RemoteMountService) UnmountRemote(name string) (*dto.RemoteMount, errors.E) {
+	if s.state.ProtectedMode {
+		return nil, errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "UnmountRemote", "reason", "unmounting a remote is not permitted when ProtectedMode is enabled")
+	}
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	remote, errE := s.get(name)
+	if errE != nil {
+		return nil, errE
+	}
+	if mounted, _ := s.isMounted(remote.Path); !mounted {
+		return nil, errors.WithDetails(dto.ErrorInvalidStateForOperation, "Remote", name, "reason", "the remote is not mounted")
+	}
+	s.mu.Lock()
+	s.wanted[remote.Name] = false
+	s.mu.Unlock()
+	if errE := s.fsService.UnmountPartition(s.ctx, remote.Path, remote.Protocol, false, false); errE != nil {
+		return nil, errors.WithDetails(dto.ErrorUnmountFail, "Remote", name, "Path", remote.Path, "reason", errE.Error())
+	}
+	return s.expose(remote), nil
+}
+
+func (s *RemoteMountService) DeleteRemoteMount(name string) errors.E {
+	if s.state.ProtectedMode {
+		return errors.WithDetails(dto.ErrorOperationNotPermittedInProtectedMode,
+			"Operation", "DeleteRemoteMount", "reason", "deleting a remote is not permitted when ProtectedMode is enabled")
+	}
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+
+	remote, errE := s.get(name)
+	if errE != nil {
+		return errE
+	}
+	shares, err := gorm.G[dbom.ExportedShare](s.db).Where(g.ExportedShare.MountPointDataPath.Eq(remote.Path)).Find(s.ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(shares) > 0 {
+		names := make([]string, 0, len(shares))
+		for _, share := range shares {
+			names = append(names, share.Name)
+		}
+		return errors.WithDetails(dto.ErrorInvalidStateForOperation,
+			"Remote", name, "reason", "the remote is shared as "+strings.Join(names, ", "))
+	}
+
+	if mounted, _ := s.isMounted(remote.Path); mounted {
+		if errE := s.fsService.UnmountPartition(s.ctx, remote.Path, remote.Protocol, false, false); errE != nil {
+			return errors.WithDetails(dto.ErrorUnmountFail, "Remote", name, "Path", remote.Path, "reason", errE.Error())
+		}
+		if err := os.Remove(remote.Path); err != nil && !os.IsNotExist(err) {
+			slog.WarnContext(s.ctx, "Failed to remove the mount point of a remote", "path", remote.Path, "err", err)
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := gorm.G[dbom.RemoteMount](tx).Where(g.RemoteMount.Name.Eq(remote.Name)).Delete(s.ctx); err != nil {
+			return err
+		}
+		_, err := gorm.G[dbom.MountPointPath](tx.Unscoped()).Where(g.MountPointPath.Path.Eq(remote.Path)).Delete(s.ctx)
+		return err
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s.removeCredentials(remote)
+
+	diskID := remoteDiskPrefix + remote.Name
+	if disk, ok := s.disks.Get(diskID); ok {
+		s.disks.Remove(diskID)
+		s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.REMOVE}, Disk: disk})
+	}
+	s.mu.Lock()
+	delete(s.wanted, remote.Name)
+	delete(s.health, remote.Name)
+	s.mu.Unlock()
+	slog.InfoContext(s.ctx, "Deleted remote mount", "remote", remote.Name)
+	return nil
+}
+
+// validate checks the server, the share and the credentials of a remote, and
+// that its mount options can be turned into a mount.
+func (s *RemoteMountService) validate(remote *dbom.RemoteMount, password *dto.Secret[string]) errors.E {
+	if remote.Name == "" || strings.ContainsAny(remote.Name, "/:,") {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "Remote", remote.Name, "reason", "the remote name is not valid")
+	}
+	if _, ok := remotePorts[remote.Protocol]; !ok {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "Remote", remote.Name, "reason", "the protocol must be cifs or nfs")
+	}
+	if remote.Server == "" || strings.ContainsAny(remote.Server, "/\\,= \t\n") {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "Remote", remote.Name, "reason", "the server is not valid")
+	}
+	if remote.Share == "" || strings.ContainsAny(remote.Share, ",\n") {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "Remote", remote.Name, "reason", "the share is not valid")
+	}
+	switch remote.Protocol {
+	case "nfs":
+		if !strings.HasPrefix(remote.Share, "/") {
+			return errors.WithDetails(dto.ErrorInvalidParameter, "Remote", remote.Name, "reason", "the exported path must start with /")
+		}
+		if remote.Username != "" || remote.Domain != "" || password != nil {
+			return errors.WithDetails(dto.ErrorInvalidParameter, "Remote", remote.Name, "reason", "an NFS export takes no credentials")
+		}
+	case "cifs":
+		if strings.HasPrefix(remote.Share, "/") {
+			return errors.WithDetails(dto.ErrorInvalidParameter, "Remote", remote.Name, "reason", "the share name must not start with /")
+		}
+		if remote.Username == "" && (remote.Domain != "" || password != nil) {
+			return errors.WithDetails(dto.ErrorInvalidParameter, "Remote", remote.Name, "reason", "a password or a domain needs a username")
+		}
+		if strings.ContainsAny(remote.Username+remote.Domain, "\n\r") ||
+			(password != nil && strings.ContainsAny(password.Expose(), "\n\r")) {
+			return errors.WithDetails(dto.ErrorInvalidParameter, "Remote", remote.Name, "reason", "the credentials cannot span several lines")
+		}
+	}
+	_, _, errE := s.mountOptions(remote)
+	return errE
+}
+
+// mountOptions turns the mount flags of a remote into the flags and the
+// data of its mount. The flags are checked against the ones the editor
+// offers, the standard flags and the custom flags of the protocol.
+func (s *RemoteMountService) mountOptions(remote *dbom.RemoteMount) (uintptr, string, errors.E) {
+	standard, errE := s.fsService.GetStandardMountFlags()
+	if errE != nil {
+		return 0, "", errE
+	}
+	specific, errE := s.fsService.GetFilesystemSpecificMountFlags(remote.Protocol)
+	if errE != nil {
+		return 0, "", errE
+	}
+
+	var switches []string
+	flags := make([]dto.MountFlag, 0)
+	for _, list := range []struct {
+		flags   *dbom.MounDataFlags
+		catalog []dto.MountFlag
+		custom  bool
+	}{{remote.Flags, standard, false}, {remote.CustomFlags, specific, true}} {
+		for _, flag := range fromMounDataFlags(list.flags) {
+			i := slices.IndexFunc(list.catalog, func(known dto.MountFlag) bool { return strings.EqualFold(known.Name, flag.Name) })
+			if i < 0 || strings.EqualFold(flag.Name, "remount") {
+				return 0, "", errors.WithDetails(dto.ErrorInvalidParameter,
+					"Remote", remote.Name, "reason", "the option "+flag.Name+" is not supported by "+remote.Protocol)
+			}
+			known := list.catalog[i]
+			if known.NeedsValue && flag.FlagValue == "" {
+				return 0, "", errors.WithDetails(dto.ErrorInvalidParameter,
+					"Remote", remote.Name, "reason", "the option "+known.Name+" needs a value")
+			}
+			flag.Name = known.Name
+			flag.NeedsValue = known.NeedsValue
+			flag.ValueDescription = known.ValueDescription
+			flag.ValueValidationRegex = known.ValueValidationRegex
+			if list.custom && !flag.NeedsValue && flag.FlagValue == "" {
+				// The switches of the protocol set no bit of the mount
+				// flags, they are passed on as they are.
+				switches = append(switches, known.Name)
+				continue
+			}
+			flags = append(flags, flag)
+		}
+	}
+
+	syscallFlags, data, errE := s.fsService.MountFlagsToSyscallFlagAndData(flags)
+	if errE != nil {
+		return 0, "", errors.WithDetails(errE, "Remote", remote.Name, "reason", "the mount options are not valid")
+	}
+	options := switches
+	if data != "" {
+		options = append(options, data)
+	}
+	if remote.Protocol == "cifs" {
+		if remote.Username != "" {
+			options = append(options, "credentials="+s.credentialsPath(remote))
+		} else {
+			options = append(options, "guest")
+		}
+	}
+	return syscallFlags, strings.Join(options, ","), nil
+}
+
+// mount mounts a remote with the mount helper of its protocol.
+func (s *RemoteMountService) mount(remote *dbom.RemoteMount) errors.E {
+	flags, data, errE := s.mountOptions(remote)
+	if errE != nil {
+		return errE
+	}
+	_, errE = s.fsService.MountPartition(s.ctx, remoteSource(remote), remote.Path, remote.Protocol, data, flags, func() error {
+		return os.MkdirAll(remote.Path, 0o750)
+	})
+	if errE != nil {
+		return errors.WithDetails(dto.ErrorMountFail, "Remote", remote.Name, "Path", remote.Path, "reason", errE.Error())
+	}
+	return nil
+}
+
+// persist stores a remote with its mount point, which the shares of the
+// remote refer to.
+func (s *RemoteMountService) persist(remote *dbom.RemoteMount) errors.E {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := gorm.G[dbom.RemoteMount](tx).Create(s.ctx, remote); err != nil {
+			return err
+		}
+		// The remote mount service mounts the remote once the network is
+		// up, the volume service cannot as a remote has no device.
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&dbom.MountPointPath{
+			Path:               remote.Path,
+			Root:               new("/"),
+			Type:               "ADDON",
+			DeviceId:           remoteDiskPrefix + remote.Name,
+			FSType:             remote.Protocol,
+			IsToMountAtStartup: new(false),
+		}).Error
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// check probes the server of each remote, mounts again the remotes to keep
+// mounted whose server answers, and refreshes their health. It returns
+// whether the network is up.
+func (s *RemoteMountService) check() bool {
+	remotes, errE := s.load()
+	if errE != nil {
+		slog.WarnContext(s.ctx, "Failed to load the remote mounts", "err", errE)
+		return true
+	}
+	up := s.networkUp()
+	for i := range remotes {
+		remote := &remotes[i]
+		reason := "the network is down"
+		if up {
+			reason = ""
+			if err := s.probe(s.ctx, remoteAddress(remote)); err != nil {
+				reason = "the server " + remote.Server + " is unreachable: " + err.Error()
+			}
+		}
+
+		s.mu.Lock()
+		old, probed := s.health[remote.Name]
+		s.health[remote.Name] = reason
+		wanted := s.wanted[remote.Name]
+		s.mu.Unlock()
+		if probed && old != reason {
+			if reason != "" {
+				slog.WarnContext(s.ctx, "Remote mount is unreachable", "remote", remote.Name, "reason", reason)
+			} else {
+				slog.InfoContext(s.ctx, "Remote mount is reachable again", "remote", remote.Name)
+			}
+		}
+
+		if reason == "" && wanted {
+			s.reconnect(remote)
+		}
+		s.expose(remote)
+	}
+	return up
+}
+
+// reconnect mounts a remote to keep mounted that is not, e.g. at startup or
+// after it was lost with the network.
+func (s *RemoteMountService) reconnect(remote *dbom.RemoteMount) {
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+	s.mu.Lock()
+	wanted := s.wanted[remote.Name]
+	s.mu.Unlock()
+	if !wanted {
+		return
+	}
+	if mounted, _ := s.isMounted(remote.Path); mounted {
+		return
+	}
+	if errE := s.mount(remote); errE != nil {
+		slog.ErrorContext(s.ctx, "Failed to mount remote", "remote", remote.Name, "err", errE)
+		return
+	}
+	slog.InfoContext(s.ctx, "Mounted remote", "remote", remote.Name, "path", remote.Path)
+}
+
+// expose shows a remote as a disk with a single partition mounted on the
+// remote path, and returns the remote state. The mount point is invalid while
+// the server does not answer, so its shares are not exported.
+func (s *RemoteMountService) expose(remote *dbom.RemoteMount) *dto.RemoteMount {
+	diskID := remoteDiskPrefix + remote.Name
+	s.mu.Lock()
+	reason, probed := s.health[remote.Name]
+	s.mu.Unlock()
+	ret := &dto.RemoteMount{
+		Name:               remote.Name,
+		Protocol:           remote.Protocol,
+		Server:             remote.Server,
+		Share:              remote.Share,
+		Path:               remote.Path,
+		Username:           remote.Username,
+		Domain:             remote.Domain,
+		HasPassword:        remote.Username != "" && s.storedPassword(remote) != nil,
+		Flags:              fromMounDataFlags(remote.Flags),
+		CustomFlags:        fromMounDataFlags(remote.CustomFlags),
+		IsReachable:        probed && reason == "",
+		IsToMountAtStartup: remote.IsToMountAtStartup,
+		PartitionId:        diskID,
+	}
+	ret.IsMounted, _ = s.isMounted(remote.Path)
+	if s.disks == nil {
+		return ret
+	}
+
+	mp := dto.MountPointData{
+		Path:               remote.Path,
+		Root:               "/",
+		Type:               "ADDON",
+		FSType:             new(remote.Protocol),
+		DeviceId:           diskID,
+		IsMounted:          ret.IsMounted,
+		IsInvalid:          probed && reason != "",
+		IsToMountAtStartup: new(false),
+		Flags:              new(ret.Flags),
+		CustomFlags:        new(ret.CustomFlags),
+	}
+	if mp.IsInvalid {
+		mp.InvalidError = new(reason)
+	}
+	var size uint64
+	// A mount whose server is gone blocks, only look into a reachable one.
+	if ret.IsMounted && ret.IsReachable {
+		mp.IsWriteSupported = new(osutil.IsWritable(remote.Path))
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(remote.Path, &stat); err == nil && stat.Bsize > 0 {
+			size = stat.Blocks * uint64(stat.Bsize)
+		}
+	}
+	existing, known := s.disks.Get(diskID)
+	wasMounted, wasInvalid := false, false
+	if known && existing.Partitions != nil {
+		if old, ok := (*existing.Partitions)[diskID]; ok && old.MountPointData != nil {
+			if oldMp, ok := (*old.MountPointData)[remote.Path]; ok {
+				wasMounted, wasInvalid = oldMp.IsMounted, oldMp.IsInvalid
+				mp.Share = oldMp.Share
+			}
+		}
+	}
+
+	part := dto.Partition{
+		Id:             new(diskID),
+		DiskId:         new(diskID),
+		Name:           new(remote.Name),
+		FsType:         new(remote.Protocol),
+		Size:           new(int(size)),
+		System:         new(false),
+		Remote:         ret,
+		FilesystemInfo: &dto.FilesystemInfo{Name: remote.Protocol, Support: &dto.FilesystemSupport{CanMount: true}},
+	}
+	if s.fsService != nil {
+		if info, errE := s.fsService.GetSupportAndInfo(s.ctx, remote.Protocol); errE == nil && info != nil {
+			part.FilesystemInfo = info
+		}
+	}
+	mp.Partition = &part
+	part.MountPointData = &map[string]dto.MountPointData{remote.Path: mp}
+	disk := &dto.Disk{
+		Id:               new(diskID),
+		LegacyDeviceName: new(remote.Name),
+		Model:            new(remoteSource(remote)),
+		Vendor:           new(remote.Server),
+		Size:             new(int(size)),
+		Removable:        new(false),
+		Ejectable:        new(false),
+		Partitions:       &map[string]dto.Partition{diskID: part},
+	}
+	if known {
+		disk.RefreshVersion = existing.RefreshVersion
+	}
+	if err := s.disks.AddOrUpdate(disk); err != nil {
+		slog.WarnContext(s.ctx, "Failed to add the disk of a remote mount", "remote", remote.Name, "err", err)
+		return ret
+	}
+	if !known {
+		s.eventBus.EmitDisk(events.DiskEvent{Event: events.Event{Type: events.EventTypes.ADD}, Disk: disk})
+	}
+	if !known || wasMounted != ret.IsMounted || wasInvalid != mp.IsInvalid {
+		_ = s.eventBus.EmitMountPoint(events.MountPointEvent{
+			Event:      events.Event{Type: events.EventTypes.UPDATE},
+			MountPoint: &mp,
+		})
+	}
+	return ret
+}
+
+// handleMountPointEvent refreshes a remote whose mount point was marked
+// unmounted by someone else.
+func (s *RemoteMountService) handleMountPointEvent(ctx context.Context, e events.MountPointEvent) errors.E {
+	mp := e.MountPoint
+	if mp == nil || mp.Path == "" || mp.IsMounted {
+		return nil
+	}
+	remote, err := gorm.G[dbom.RemoteMount](s.db).Where(g.RemoteMount.Path.Eq(mp.Path)).First(s.ctx)
+	if err != nil {
+		return nil
+	}
+	s.expose(&remote)
+	return nil
+}
+
+// credentialsPath is the mount.cifs credentials file of a remote.
+func (s *RemoteMountService) credentialsPath(remote *dbom.RemoteMount) string {
+	return filepath.Join(s.state.RemoteCredsDir, remote.Name+".cred")
+}
+
+// storeCredentials writes the credentials file of a cifs remote with a user,
+// readable by root only, so the password is neither stored in the database
+// nor passed on a command line.
+func (s *RemoteMountService) storeCredentials(remote *dbom.RemoteMount, password *dto.Secret[string]) errors.E {
+	if remote.Protocol != "cifs" || remote.Username == "" {
+		s.removeCredentials(remote)
+		return nil
+	}
+	if s.state.RemoteCredsDir == "" {
+		return errors.WithDetails(dto.ErrorInvalidStateForOperation, "Remote", remote.Name, "reason", "no credentials directory is configured")
+	}
+	if err := os.MkdirAll(s.state.RemoteCredsDir, 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	var content strings.Builder
+	content.WriteString("username=" + remote.Username + "\n")
+	if password != nil {
+		content.WriteString("password=" + password.Expose() + "\n")
+	}
+	if remote.Domain != "" {
+		content.WriteString("domain=" + remote.Domain + "\n")
+	}
+	path := s.credentialsPath(remote)
+	if err := os.WriteFile(path+".tmp", []byte(content.String()), 0o600); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// storedPassword returns the password in the credentials file of a remote,
+// nil when there is none.
+func (s *RemoteMountService) storedPassword(remote *dbom.RemoteMount) *dto.Secret[string] {
+	if s.state.RemoteCredsDir == "" {
+		return nil
+	}
+	file, err := os.Open(s.credentialsPath(remote))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if password, ok := strings.CutPrefix(scanner.Text(), "password="); ok {
+			return new(dto.NewSecret(password))
+		}
+	}
+	return nil
+}
+
+func (s *RemoteMountService) removeCredentials(remote *dbom.RemoteMount) {
+	if s.state.RemoteCredsDir == "" {
+		return
+	}
+	if err := os.Remove(s.credentialsPath(remote)); err != nil && !os.IsNotExist(err) {
+		slog.WarnContext(s.ctx, "Failed to remove the credentials of a remote", "remote", remote.Name, "err", err)
+	}
+}
+
+func (s *RemoteMountService) load() ([]dbom.RemoteMount, errors.E) {
+	remotes, err := gorm.G[dbom.RemoteMount](s.db).Order(g.RemoteMount.Name).Find(s.ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return remotes, nil
+}
+
+func (s *RemoteMountService) get(name string) (*dbom.RemoteMount, errors.E) {
+	remote, err := gorm.G[dbom.RemoteMount](s.db).Where(g.RemoteMount.Name.Eq(name)).First(s.ctx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.WithDetails(dto.ErrorNotFound, "Remote", name, "reason", "no remote is named "+name)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &remote, nil
+}
+
+// remoteSource is the source of the mount of a remote: //server/share for
+// cifs, server:/export for nfs.
+func remoteSource(remote *dbom.RemoteMount) string {
+	if remote.Protocol == "cifs" {
+		return "//" + remote.Server + "/" + strings.TrimPrefix(remote.Share, "/")
+	}
+	server := remote.Server
+	if strings.Contains(server, ":") {
+		server = "[" + server + "]"
+	}
+	return server + ":" + remote.Share
+}
+
+// remoteAddress is the address the health probe of a remote connects to.
+func remoteAddress(remote *dbom.RemoteMount) string {
+	port := remotePorts[remote.Protocol]
+	for _, flag := range fromMounDataFlags(remote.CustomFlags) {
+		if flag.Name == "port" {
+			if p, err := strconv.Atoi(flag.FlagValue); err == nil && p > 0 {
+				port = p
+			}
+		}
+	}
+	return net.JoinHostPort(remote.Server, strconv.Itoa(port))
+}
+
+// dialProbe checks a server answers on address.
+func dialProbe(ctx context.Context, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, remoteProbeTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// hasDefaultRoute reports whether the host has an IPv4 or IPv6 default route,
+// which the network being up means here.
+func hasDefaultRoute(procRoot string) bool {
+	if data, err := os.ReadFile(filepath.Join(procRoot, "net", "route")); err == nil {
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			// Iface Destination Gateway Flags ...
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[1] != "00000000" {
+				continue
+			}
+			if flags, err := strconv.ParseUint(fields[3], 16, 32); err == nil && flags&0x1 != 0 {
+				return true
+			}
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(procRoot, "net", "ipv6_route")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			// Destination PrefixLength Source SourcePrefixLength NextHop Metric RefCount Use Flags Iface
+			fields := strings.Fields(line)
+			if len(fields) < 10 || strings.Trim(fields[0], "0") != "" || fields[1] != "00" || fields[9] == "lo" {
+				continue
+			}
+			if flags, err := strconv.ParseUint(fields[8], 16, 32); err == nil && flags&0x1 != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toMounDataFlags(flags dto.MountFlags) *dbom.MounDataFlags {
+	ret := make(dbom.MounDataFlags, 0, len(flags))
+	for _, flag := range flags {
+		_ = ret.Add(dbom.MounDataFlag{Name: strings.TrimSpace(flag.Name), NeedsValue: flag.FlagValue != "", FlagValue: flag.FlagValue})
+	}
+	return &ret
+}
+
+func fromMounDataFlags(flags *dbom.MounDataFlags) dto.MountFlags {
+	ret := make(dto.MountFlags, 0)
+	if flags == nil {
+		return ret
+	}
+	for _, flag := range *flags {
+		ret = append(ret, dto.MountFlag{Name: flag.Name, NeedsValue: flag.NeedsValue, FlagValue: flag.FlagValue})
+	}
+	return ret
+}
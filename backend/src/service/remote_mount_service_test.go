@@ -0,0 +1,492 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/darwinstubs/mount"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+type RemoteMountServiceSuite struct {
+	suite.Suite
+	app           *fxtest.App
+	db            *gorm.DB
+	state         *dto.ContextState
+	disks         *dto.DiskMap
+	eventBus      events.EventBusInterface
+	fsService     FilesystemServiceInterface
+	remoteService *RemoteMountService
+	root          string
+
+	mu       sync.Mutex
+	mounted  map[string]bool
+	mounts   []string // source, target, data of each mount
+	flags    []uintptr
+	mountErr errors.E
+	probeErr error
+	up       bool
+}
+
+func TestRemoteMountServiceSuite(t *testing.T) {
+	suite.Run(t, new(RemoteMountServiceSuite))
+}
+
+func (suite *RemoteMountServiceSuite) SetupTest() {
+	suite.root = suite.T().TempDir()
+	suite.mounted = map[string]bool{}
+	suite.mounts = nil
+	suite.flags = nil
+	suite.mountErr = nil
+	suite.probeErr = nil
+	suite.up = true
+
+	suite.state = &dto.ContextState{
+		DatabasePath:   "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+		RemoteCredsDir: filepath.Join(suite.T().TempDir(), "remote"),
+	}
+	suite.disks = &dto.DiskMap{}
+
+	var remoteService RemoteMountServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState { return suite.state },
+			func() *dto.DiskMap { return suite.disks },
+			dbom.NewDB,
+			events.NewEventBus,
+			mock.Mock[FilesystemServiceInterface],
+			NewRemoteMountService,
+		),
+		fx.Populate(&suite.db),
+		fx.Populate(&suite.eventBus),
+		fx.Populate(&suite.fsService),
+		fx.Populate(&remoteService),
+	)
+	suite.remoteService = remoteService.(*RemoteMountService)
+	suite.remoteService.mountRoot = suite.root
+	suite.remoteService.isMounted = func(path string) (bool, error) {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		return suite.mounted[path], nil
+	}
+	suite.remoteService.networkUp = func() bool {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		return suite.up
+	}
+	suite.remoteService.probe = func(ctx context.Context, address string) error {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		return suite.probeErr
+	}
+	suite.cleanDB()
+
+	flagService := &FilesystemService{ctx: context.Background()}
+	mock.When(suite.fsService.GetStandardMountFlags()).
+		ThenReturn([]dto.MountFlag{{Name: "ro"}, {Name: "noatime"}, {Name: "remount"}}, nil)
+	mock.When(suite.fsService.GetFilesystemSpecificMountFlags(mock.Any[string]())).ThenAnswer(func(args []any) []any {
+		if args[0].(string) == "nfs" {
+			return []any{filesystem.NewNfsAdapter().GetMountFlags(), nil}
+		}
+		return []any{filesystem.NewCifsAdapter().GetMountFlags(), nil}
+	})
+	mock.When(suite.fsService.MountFlagsToSyscallFlagAndData(mock.Any[[]dto.MountFlag]())).ThenAnswer(func(args []any) []any {
+		flags, data, err := flagService.MountFlagsToSyscallFlagAndData(args[0].([]dto.MountFlag))
+		return []any{flags, data, err}
+	})
+	mock.When(suite.fsService.MountPartition(mock.AnyContext(), mock.Any[string](), mock.Any[string](), mock.Any[string](),
+		mock.Any[string](), mock.Any[uintptr](), mock.Any[func() error]())).ThenAnswer(func(args []any) []any {
+		source, target, fsType, data := args[1].(string), args[2].(string), args[3].(string), args[4].(string)
+		if suite.mountErr != nil {
+			return []any{nil, suite.mountErr}
+		}
+		suite.mu.Lock()
+		suite.mounted[target] = true
+		suite.mounts = append(suite.mounts, source+" "+target+" "+data)
+		suite.flags = append(suite.flags, args[5].(uintptr))
+		suite.mu.Unlock()
+		return []any{&mount.MountPoint{Path: target, Device: source, FSType: fsType}, nil}
+	})
+	mock.When(suite.fsService.UnmountPartition(mock.AnyContext(), mock.Any[string](), mock.Any[string](),
+		mock.Any[bool](), mock.Any[bool]())).ThenAnswer(func(args []any) []any {
+		suite.mu.Lock()
+		delete(suite.mounted, args[1].(string))
+		suite.mu.Unlock()
+		return []any{nil}
+	})
+
+	suite.app.RequireStart()
+}
+
+func (suite *RemoteMountServiceSuite) TearDownTest() {
+	suite.cleanDB()
+	suite.app.RequireStop()
+}
+
+func (suite *RemoteMountServiceSuite) cleanDB() {
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.RemoteMount{}).Error)
+	suite.Require().NoError(suite.db.Unscoped().Where("device_id LIKE ?", remoteDiskPrefix+"%").Delete(&dbom.MountPointPath{}).Error)
+}
+
+func (suite *RemoteMountServiceSuite) mountCount() int {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	return len(suite.mounts)
+}
+
+func (suite *RemoteMountServiceSuite) setMounted(path string, mounted bool) {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	suite.mounted[path] = mounted
+}
+
+func (suite *RemoteMountServiceSuite) setProbeErr(err error) {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	suite.probeErr = err
+}
+
+func (suite *RemoteMountServiceSuite) create() *dto.RemoteMount {
+	remote, err := suite.remoteService.CreateRemoteMount(dto.RemoteMountCreateRequest{
+		Name:        "media",
+		Protocol:    "cifs",
+		Server:      "nas",
+		Share:       "media",
+		Username:    "backup",
+		Password:    new(dto.NewSecret("s3cret")),
+		Domain:      "WORKGROUP",
+		Flags:       dto.MountFlags{{Name: "noatime"}},
+		CustomFlags: dto.MountFlags{{Name: "vers", FlagValue: "3.0"}, {Name: "seal"}},
+	})
+	suite.Require().NoError(err)
+	return remote
+}
+
+func (suite *RemoteMountServiceSuite) TestCreateCifsStoresCredentialsAndMounts() {
+	remote := suite.create()
+
+	path := filepath.Join(suite.root, "media")
+	credentials := filepath.Join(suite.state.RemoteCredsDir, "media.cred")
+	suite.Equal(path, remote.Path)
+	suite.True(remote.IsMounted)
+	suite.True(remote.IsReachable)
+	suite.True(remote.HasPassword)
+	suite.True(remote.IsToMountAtStartup)
+	suite.Equal("remote-media", remote.PartitionId)
+
+	suite.Require().Len(suite.mounts, 1)
+	mountArgs := strings.Split(suite.mounts[0], " ")
+	suite.Equal("//nas/media", mountArgs[0])
+	suite.Equal(path, mountArgs[1])
+	suite.Equal("seal,vers=3.0,credentials="+credentials, mountArgs[2])
+	suite.NotContains(suite.mounts[0], "s3cret")
+	suite.Equal(uintptr(syscall.MS_NOATIME), suite.flags[0])
+
+	info, err := os.Stat(credentials)
+	suite.Require().NoError(err)
+	suite.Equal(os.FileMode(0o600), info.Mode().Perm())
+	content, err := os.ReadFile(credentials)
+	suite.Require().NoError(err)
+	suite.Equal("username=backup\npassword=s3cret\ndomain=WORKGROUP\n", string(content))
+
+	stored, errG := gorm.G[dbom.RemoteMount](suite.db).Where("name = ?", "media").First(context.Background())
+	suite.Require().NoError(errG)
+	suite.Equal("backup", stored.Username)
+	mpp, errG := gorm.G[dbom.MountPointPath](suite.db).Where("path = ?", path).First(context.Background())
+	suite.Require().NoError(errG)
+	suite.Equal("remote-media", mpp.DeviceId)
+	suite.Equal("cifs", mpp.FSType)
+
+	mp, ok := suite.disks.GetMountPointByPath(path)
+	suite.Require().True(ok)
+	suite.True(mp.IsMounted)
+	suite.False(mp.IsInvalid)
+	part, _, ok := suite.disks.GetPartitionByID("remote-media")
+	suite.Require().True(ok)
+	suite.Require().NotNil(part.Remote)
+	suite.Equal("nas", part.Remote.Server)
+}
+
+func (suite *RemoteMountServiceSuite) TestCreateNfsAndGuestCifs() {
+	nfs, err := suite.remoteService.CreateRemoteMount(dto.RemoteMountCreateRequest{
+		Name: "backup", Protocol: "nfs", Server: "[fd00::2]", Share: "/export/backup",
+		CustomFlags: dto.MountFlags{{Name: "vers", FlagValue: "4.2"}, {Name: "port", FlagValue: "2050"}},
+	})
+	suite.Require().NoError(err)
+	suite.Equal("fd00::2", nfs.Server)
+	suite.False(nfs.HasPassword)
+	suite.Equal("[fd00::2]:2050", remoteAddress(&dbom.RemoteMount{Protocol: "nfs", Server: nfs.Server, CustomFlags: toMounDataFlags(nfs.CustomFlags)}))
+
+	_, err = suite.remoteService.CreateRemoteMount(dto.RemoteMountCreateRequest{Name: "public", Protocol: "cifs", Server: "nas", Share: "public"})
+	suite.Require().NoError(err)
+
+	suite.Require().Len(suite.mounts, 2)
+	suite.Equal("[fd00::2]:/export/backup "+filepath.Join(suite.root, "backup")+" vers=4.2,port=2050", suite.mounts[0])
+	suite.Equal("//nas/public "+filepath.Join(suite.root, "public")+" guest", suite.mounts[1])
+	suite.NoFileExists(filepath.Join(suite.state.RemoteCredsDir, "public.cred"))
+}
+
+func (suite *RemoteMountServiceSuite) TestCreateRejectsInvalidRequests() {
+	for name, request := range map[string]dto.RemoteMountCreateRequest{
+		"protocol":       {Name: "media", Protocol: "afp", Server: "nas", Share: "media"},
+		"server":         {Name: "media", Protocol: "cifs", Server: "nas/media", Share: "media"},
+		"nfs path":       {Name: "media", Protocol: "nfs", Server: "nas", Share: "export"},
+		"nfs user":       {Name: "media", Protocol: "nfs", Server: "nas", Share: "/export", Username: "backup"},
+		"password alone": {Name: "media", Protocol: "cifs", Server: "nas", Share: "media", Password: new(dto.NewSecret("s3cret"))},
+		"multiline":      {Name: "media", Protocol: "cifs", Server: "nas", Share: "media", Username: "backup", Password: new(dto.NewSecret("a\npassword=b"))},
+		"unknown option": {Name: "media", Protocol: "cifs", Server: "nas", Share: "media", CustomFlags: dto.MountFlags{{Name: "password", FlagValue: "x"}}},
+		"bad value":      {Name: "media", Protocol: "cifs", Server: "nas", Share: "media", CustomFlags: dto.MountFlags{{Name: "vers", FlagValue: "9"}}},
+		"missing value":  {Name: "media", Protocol: "cifs", Server: "nas", Share: "media", CustomFlags: dto.MountFlags{{Name: "vers"}}},
+		"switch value":   {Name: "media", Protocol: "cifs", Server: "nas", Share: "media", CustomFlags: dto.MountFlags{{Name: "seal", FlagValue: "yes"}}},
+		"remount":        {Name: "media", Protocol: "cifs", Server: "nas", Share: "media", Flags: dto.MountFlags{{Name: "remount"}}},
+		"nfs option":     {Name: "media", Protocol: "cifs", Server: "nas", Share: "media", CustomFlags: dto.MountFlags{{Name: "nolock"}}},
+	} {
+		_, err := suite.remoteService.CreateRemoteMount(request)
+		suite.ErrorIs(err, dto.ErrorInvalidParameter, name)
+	}
+	suite.Zero(suite.mountCount())
+	suite.NoFileExists(filepath.Join(suite.state.RemoteCredsDir, "media.cred"))
+}
+
+func (suite *RemoteMountServiceSuite) TestCreateTwice() {
+	suite.create()
+
+	_, err := suite.remoteService.CreateRemoteMount(dto.RemoteMountCreateRequest{Name: "media", Protocol: "cifs", Server: "nas", Share: "media"})
+	suite.ErrorIs(err, dto.ErrorConflict)
+	suite.Equal(1, suite.mountCount())
+}
+
+func (suite *RemoteMountServiceSuite) TestCreateMountFailureNotStored() {
+	suite.mountErr = errors.New("mount error(13): Permission denied")
+
+	_, err := suite.remoteService.CreateRemoteMount(dto.RemoteMountCreateRequest{
+		Name: "media", Protocol: "cifs", Server: "nas", Share: "media", Username: "backup", Password: new(dto.NewSecret("wrong")),
+	})
+	suite.Require().ErrorIs(err, dto.ErrorMountFail)
+	suite.Contains(errors.AllDetails(err)["reason"], "Permission denied")
+
+	remotes, errE := suite.remoteService.ListRemoteMounts()
+	suite.Require().NoError(errE)
+	suite.Empty(remotes)
+	suite.NoFileExists(filepath.Join(suite.state.RemoteCredsDir, "media.cred"))
+	_, ok := suite.disks.Get("remote-media")
+	suite.False(ok)
+}
+
+func (suite *RemoteMountServiceSuite) TestCreateProtectedMode() {
+	suite.state.ProtectedMode = true
+
+	_, err := suite.remoteService.CreateRemoteMount(dto.RemoteMountCreateRequest{Name: "media", Protocol: "cifs", Server: "nas", Share: "media"})
+	suite.ErrorIs(err, dto.ErrorOperationNotPermittedInProtectedMode)
+}
+
+func (suite *RemoteMountServiceSuite) TestHealthProbeMarksMountPointInvalid() {
+	remote := suite.create()
+	var updates []bool
+	suite.eventBus.OnMountPoint(func(ctx context.Context, event events.MountPointEvent) errors.E {
+		if event.MountPoint.Path == remote.Path {
+			updates = append(updates, event.MountPoint.IsInvalid)
+		}
+		return nil
+	})
+
+	suite.setProbeErr(errors.New("connection refused"))
+	suite.True(suite.remoteService.check())
+	mp, ok := suite.disks.GetMountPointByPath(remote.Path)
+	suite.Require().True(ok)
+	suite.True(mp.IsInvalid)
+	suite.Require().NotNil(mp.InvalidError)
+	suite.Contains(*mp.InvalidError, "the server nas is unreachable")
+	remotes, err := suite.remoteService.ListRemoteMounts()
+	suite.Require().NoError(err)
+	suite.False(remotes[0].IsReachable)
+
+	suite.setProbeErr(nil)
+	suite.remoteService.check()
+	mp, ok = suite.disks.GetMountPointByPath(remote.Path)
+	suite.Require().True(ok)
+	suite.False(mp.IsInvalid)
+	suite.Nil(mp.InvalidError)
+	suite.Equal([]bool{true, false}, updates)
+}
+
+func (suite *RemoteMountServiceSuite) TestReconnectAfterNetworkLoss() {
+	remote := suite.create()
+
+	suite.setMounted(remote.Path, false)
+	suite.setProbeErr(errors.New("no route to host"))
+	suite.remoteService.check()
+	suite.Equal(1, suite.mountCount())
+
+	suite.setProbeErr(nil)
+	suite.remoteService.check()
+	suite.Equal(2, suite.mountCount())
+	mp, ok := suite.disks.GetMountPointByPath(remote.Path)
+	suite.Require().True(ok)
+	suite.True(mp.IsMounted)
+	suite.False(mp.IsInvalid)
+}
+
+func (suite *RemoteMountServiceSuite) TestStartupMountWaitsForNetwork() {
+	path := filepath.Join(suite.root, "media")
+	suite.Require().NoError(suite.db.Create(&dbom.RemoteMount{
+		Name: "media", Protocol: "nfs", Server: "nas", Share: "/export/media", Path: path, IsToMountAtStartup: true,
+	}).Error)
+	suite.Require().NoError(suite.db.Create(&dbom.RemoteMount{
+		Name: "manual", Protocol: "nfs", Server: "nas", Share: "/export/manual", Path: filepath.Join(suite.root, "manual"),
+	}).Error)
+	suite.Require().NoError(suite.db.Model(&dbom.RemoteMount{}).Where("name = ?", "manual").Update("is_to_mount_at_startup", false).Error)
+	suite.mu.Lock()
+	suite.up = false
+	suite.mu.Unlock()
+
+	suite.remoteService.startup()
+	suite.False(suite.remoteService.check())
+	suite.Zero(suite.mountCount())
+	mp, ok := suite.disks.GetMountPointByPath(path)
+	suite.Require().True(ok)
+	suite.True(mp.IsInvalid)
+	suite.Contains(*mp.InvalidError, "the network is down")
+
+	suite.mu.Lock()
+	suite.up = true
+	suite.mu.Unlock()
+	suite.True(suite.remoteService.check())
+	suite.Require().Equal(1, suite.mountCount())
+	suite.Contains(suite.mounts[0], "nas:/export/media")
+	mp, ok = suite.disks.GetMountPointByPath(path)
+	suite.Require().True(ok)
+	suite.True(mp.IsMounted)
+	suite.False(mp.IsInvalid)
+}
+
+func (suite *RemoteMountServiceSuite) TestUpdateCredentialsRemounts() {
+	remote := suite.create()
+	credentials := filepath.Join(suite.state.RemoteCredsDir, "media.cred")
+
+	updated, err := suite.remoteService.UpdateRemoteMount("media", dto.RemoteMountUpdateRequest{Password: new(dto.NewSecret("n3w"))})
+	suite.Require().NoError(err)
+	suite.True(updated.IsMounted)
+	suite.Equal(2, suite.mountCount())
+	content, errR := os.ReadFile(credentials)
+	suite.Require().NoError(errR)
+	suite.Contains(string(content), "password=n3w\n")
+
+	// Changing the options keeps the stored password.
+	updated, err = suite.remoteService.UpdateRemoteMount("media", dto.RemoteMountUpdateRequest{
+		Username:    new("admin"),
+		CustomFlags: new(dto.MountFlags{{Name: "vers", FlagValue: "3.1.1"}}),
+	})
+	suite.Require().NoError(err)
+	suite.Equal("admin", updated.Username)
+	suite.True(updated.HasPassword)
+	suite.Equal(3, suite.mountCount())
+	suite.Contains(suite.mounts[2], "vers=3.1.1,credentials=")
+	content, errR = os.ReadFile(credentials)
+	suite.Require().NoError(errR)
+	suite.Equal("username=admin\npassword=n3w\ndomain=WORKGROUP\n", string(content))
+
+	// Only the startup mount changes: no remount.
+	updated, err = suite.remoteService.UpdateRemoteMount("media", dto.RemoteMountUpdateRequest{IsToMountAtStartup: new(false)})
+	suite.Require().NoError(err)
+	suite.False(updated.IsToMountAtStartup)
+	suite.Equal(3, suite.mountCount())
+	suite.Equal(remote.Path, updated.Path)
+
+	_, err = suite.remoteService.UpdateRemoteMount("media", dto.RemoteMountUpdateRequest{CustomFlags: new(dto.MountFlags{{Name: "bogus"}})})
+	suite.ErrorIs(err, dto.ErrorInvalidParameter)
+}
+
+func (suite *RemoteMountServiceSuite) TestUnmountStopsReconnect() {
+	remote := suite.create()
+
+	unmounted, err := suite.remoteService.UnmountRemote("media")
+	suite.Require().NoError(err)
+	suite.False(unmounted.IsMounted)
+	suite.remoteService.check()
+	suite.Equal(1, suite.mountCount())
+
+	_, err = suite.remoteService.UnmountRemote("media")
+	suite.ErrorIs(err, dto.ErrorInvalidStateForOperation)
+
+	mounted, err := suite.remoteService.MountRemote("media")
+	suite.Require().NoError(err)
+	suite.True(mounted.IsMounted)
+	suite.setMounted(remote.Path, false)
+	suite.remoteService.check()
+	suite.Equal(3, suite.mountCount())
+}
+
+func (suite *RemoteMountServiceSuite) TestDeleteRemoteMount() {
+	remote := suite.create()
+	var removed []string
+	suite.eventBus.OnDisk(func(ctx context.Context, event events.DiskEvent) errors.E {
+		if event.Type == events.EventTypes.REMOVE {
+			removed = append(removed, *event.Disk.Id)
+		}
+		return nil
+	})
+
+	suite.Require().NoError(suite.remoteService.DeleteRemoteMount("media"))
+
+	suite.False(suite.mounted[remote.Path])
+	suite.Equal([]string{"remote-media"}, removed)
+	suite.NoFileExists(filepath.Join(suite.state.RemoteCredsDir, "media.cred"))
+	count, errC := gorm.G[dbom.MountPointPath](suite.db.Unscoped()).Where("path = ?", remote.Path).Count(context.Background(), "*")
+	suite.Require().NoError(errC)
+	suite.Zero(count)
+
+	suite.ErrorIs(suite.remoteService.DeleteRemoteMount("media"), dto.ErrorNotFound)
+}
+
+func (suite *RemoteMountServiceSuite) TestDeleteRefusedWhileShared() {
+	remote := suite.create()
+	share := &dbom.ExportedShare{Name: "Backups", MountPointDataPath: &remote.Path, MountPointDataRoot: new("/")}
+	suite.Require().NoError(suite.db.Omit("Users", "RoUsers", "Groups", "RoGroups", "MountPointData").Create(share).Error)
+	defer func() {
+		suite.Require().NoError(suite.db.Unscoped().Delete(share).Error)
+	}()
+
+	err := suite.remoteService.DeleteRemoteMount("media")
+	suite.Require().ErrorIs(err, dto.ErrorInvalidStateForOperation)
+	suite.Contains(errors.AllDetails(err)["reason"], "Backups")
+	suite.True(suite.mounted[remote.Path])
+	suite.FileExists(filepath.Join(suite.state.RemoteCredsDir, "media.cred"))
+}
+
+func (suite *RemoteMountServiceSuite) TestHasDefaultRoute() {
+	proc := suite.T().TempDir()
+	suite.Require().NoError(os.MkdirAll(filepath.Join(proc, "net"), 0o755))
+	suite.False(hasDefaultRoute(proc))
+
+	route := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+		"eth0\t0011A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n"
+	suite.Require().NoError(os.WriteFile(filepath.Join(proc, "net", "route"), []byte(route), 0o644))
+	suite.False(hasDefaultRoute(proc))
+
+	route += "eth0\t00000000\t0111A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n"
+	suite.Require().NoError(os.WriteFile(filepath.Join(proc, "net", "route"), []byte(route), 0o644))
+	suite.True(hasDefaultRoute(proc))
+
+	suite.Require().NoError(os.Remove(filepath.Join(proc, "net", "route")))
+	ipv6 := "00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00450003 eth0\n"
+	suite.Require().NoError(os.WriteFile(filepath.Join(proc, "net", "ipv6_route"), []byte(ipv6), 0o644))
+	suite.True(hasDefaultRoute(proc))
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// ShareSyncCommandID identifies sync executions in the command_output
+// websocket events.
+const ShareSyncCommandID = "share_sync"
+
+// syncProblemTranslationKey is shared by every sync result Problem, the key
+// itself carries the job name.
+const syncProblemTranslationKey = "share_sync_result"
+
+// rsyncStats are the lines of the rsync --stats summary kept in the result.
+var rsyncStats = []string{
+	"Number of regular files transferred:",
+	"Number of deleted files:",
+	"Total transferred file size:",
+}
+
+type ReplicationServiceInterface interface {
+	// Sync replicates the share source to the destination of options and
+	// waits for the end. rsync output streams as command_output events and
+	// a failure is recorded as a Problem keyed by the job name.
+	Sync(ctx context.Context, name, source string, options dto.SyncOptions) (string, errors.E)
+}
+
+type ReplicationService struct {
+	ctx            context.Context
+	shareService   ShareServiceInterface
+	problemService ProblemServiceInterface
+	executor       commandexec.Executor
+	now            func() time.Time
+	// mountRoot is where volumes are mounted; local path destinations
+	// must be on one of them.
+	mountRoot string
+}
+
+type ReplicationServiceParams struct {
+	fx.In
+	Ctx            context.Context
+	ShareService   ShareServiceInterface
+	ProblemService ProblemServiceInterface
+	Executor       commandexec.Executor
+}
+
+func NewReplicationService(in ReplicationServiceParams) ReplicationServiceInterface {
+	return &ReplicationService{
+		ctx:            in.Ctx,
+		shareService:   in.ShareService,
+		problemService: in.ProblemService,
+		executor:       in.Executor,
+		now:            time.Now,
+		mountRoot:      "/mnt",
+	}
+}
+
+// parseSyncOptions checks the options of a sync job. Shares and paths are
+// resolved when the job runs, since they may be unmounted meanwhile.
+func parseSyncOptions(options map[string]string) (dto.SyncOptions, errors.E) {
+	parsed := dto.SyncOptions{
+		DestinationType: dto.SyncDestinationType(options["destination_type"]),
+		Destination:     strings.TrimSpace(options["destination"]),
+		Mode:            dto.SyncMode(options["mode"]),
+	}
+	if parsed.Mode == "" {
+		parsed.Mode = dto.SyncModeMirror
+	}
+	switch parsed.Mode {
+	case dto.SyncModeMirror, dto.SyncModeAppend, dto.SyncModeVersioned:
+	default:
+		return parsed, errors.WithDetails(dto.ErrorInvalidParameter, "mode", parsed.Mode, "reason", "mode must be mirror, append or versioned")
+	}
+
+	destination := parsed.Destination
+	// Arguments go to rsync unquoted: a leading dash would be an option.
+	if destination == "" || strings.HasPrefix(destination, "-") || strings.ContainsFunc(destination, func(r rune) bool { return r < ' ' }) {
+		return parsed, errors.WithDetails(dto.ErrorInvalidParameter, "destination", destination, "reason", "invalid sync destination")
+	}
+	switch parsed.DestinationType {
+	case dto.SyncDestinationShare:
+	case dto.SyncDestinationPath:
+		if !filepath.IsAbs(destination) {
+			return parsed, errors.WithDetails(dto.ErrorInvalidParameter, "destination", destination, "reason", "destination path must be absolute")
+		}
+		parsed.Destination = filepath.Clean(destination)
+	case dto.SyncDestinationRsync:
+		if !isRsyncTarget(destination) {
+			return parsed, errors.WithDetails(dto.ErrorInvalidParameter, "destination", destination,
+				"reason", "destination must be rsync://host/module[/path] or [user@]host:path")
+		}
+		if isSSHTarget(destination) {
+			parsed.SSHHostKey = strings.Join(strings.Fields(options["ssh_host_key"]), " ")
+			if !isSSHPublicKey(parsed.SSHHostKey) {
+				return parsed, errors.WithDetails(dto.ErrorInvalidParameter, "ssh_host_key", parsed.SSHHostKey,
+					"reason", "SSH targets need the host public key as \"<type> <base64>\"")
+			}
+		}
+	default:
+		return parsed, errors.WithDetails(dto.ErrorInvalidParameter, "destination_type", parsed.DestinationType,
+			"reason", "destination_type must be share, path or rsync")
+	}
+
+	if value := options["bwlimit_kbps"]; value != "" {
+		limit, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return parsed, errors.WithDetails(dto.ErrorInvalidParameter, "bwlimit_kbps", value)
+		}
+		parsed.BandwidthLimitKBps = uint(limit)
+	}
+	return parsed, nil
+}
+
+// isRsyncTarget accepts rsync daemon URLs and the host:path form of SSH.
+func isRsyncTarget(destination string) bool {
+	if rest, ok := strings.CutPrefix(destination, "rsync://"); ok {
+		host, module, _ := strings.Cut(rest, "/")
+		return host != "" && module != ""
+	}
+	host, path, ok := strings.Cut(destination, ":")
+	return ok && host != "" && path != "" && !strings.Contains(host, "/")
+}
+
+// isSSHTarget tells the host:path form of SSH from rsync daemon URLs.
+func isSSHTarget(destination string) bool {
+	return !strings.HasPrefix(destination, "rsync://")
+}
+
+// sshHost returns the host of a [user@]host:path target, as ssh looks it up
+// in known_hosts.
+func sshHost(destination string) string {
+	host, _, _ := strings.Cut(destination, ":")
+	if _, after, ok := strings.Cut(host, "@"); ok {
+		host = after
+	}
+	return host
+}
+
+// isSSHPublicKey checks a "<type> <base64>" public key: the blob must decode
+// and start with its own key type, as every SSH wire format key does.
+func isSSHPublicKey(key string) bool {
+	keyType, encoded, ok := strings.Cut(key, " ")
+	if !ok || keyType == "" || strings.Contains(encoded, " ") {
+		return false
+	}
+	blob, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(blob) < 4 {
+		return false
+	}
+	size := binary.BigEndian.Uint32(blob)
+	return uint64(size) <= uint64(len(blob)-4) && bytes.Equal(blob[4:4+size], []byte(keyType))
+}
+
+// writeKnownHosts writes the pinned key of an SSH target to a temporary
+// known_hosts file, which the caller removes after the sync.
+func writeKnownHosts(options dto.SyncOptions) (string, errors.E) {
+	file, err := os.CreateTemp("", "srat-known-hosts-*")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintf(file, "%s %s\n", sshHost(options.Destination), options.SSHHostKey); err != nil {
+		_ = os.Remove(file.Name())
+		return "", errors.WithStack(err)
+	}
+	return file.Name(), nil
+}
+
+// rsyncArgs builds the rsync command line of a sync. source and destination
+// are directories; the trailing slash copies the content of source.
+// knownHosts is the known_hosts file of SSH targets.
+func rsyncArgs(source, destination string, options dto.SyncOptions, now time.Time, knownHosts string) []string {
+	args := []string{
+		"--archive",
+		"--verbose",
+		"--stats",
+		"--exclude=/" + dto.RecycleBinDir + "/",
+		"--exclude=/.snapshots/",
+	}
+	switch options.Mode {
+	case dto.SyncModeMirror:
+		args = append(args, "--delete")
+	case dto.SyncModeVersioned:
+		// Excluded files are protected from --delete, so older versions
+		// stay at the destination.
+		args = append(args, "--delete", "--exclude=/"+dto.SyncVersionsDir+"/", "--backup",
+			"--backup-dir="+dto.SyncVersionsDir+"/"+now.UTC().Format("2006-01-02_15-04-05"))
+	}
+	if options.BandwidthLimitKBps > 0 {
+		args = append(args, "--bwlimit="+strconv.FormatUint(uint64(options.BandwidthLimitKBps), 10))
+	}
+	if options.DestinationType == dto.SyncDestinationRsync && isSSHTarget(options.Destination) {
+		// Scheduled runs have nobody to type a password, and only the
+		// pinned host key is trusted.
+		args = append(args, "--rsh=ssh -o BatchMode=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile="+knownHosts)
+	}
+	return append(args, strings.TrimSuffix(source, "/")+"/", destination)
+}
+
+// syncDestination resolves the destination of a sync, refusing local
+// destinations that overlap the source: rsync would copy into itself.
+func (s *ReplicationService) syncDestination(source string, options dto.SyncOptions) (string, errors.E) {
+	destination := options.Destination
+	switch options.DestinationType {
+	case dto.SyncDestinationRsync:
+		return destination, nil
+	case dto.SyncDestinationPath:
+		if errE := s.checkMountedVolume(destination); errE != nil {
+			return "", errE
+		}
+	case dto.SyncDestinationShare:
+		share, errE := s.shareService.GetShare(destination)
+		if errE != nil {
+			return "", errE
+		}
+		path, errE := sharePath(*share)
+		if errE != nil {
+			return "", errE
+		}
+		destination = path
+	}
+	if isSubPath(source, destination) || isSubPath(destination, source) {
+		return "", errors.WithDetails(dto.ErrorInvalidParameter, "destination", options.Destination,
+			"reason", "source and destination overlap")
+	}
+	return destination, nil
+}
+
+// checkMountedVolume refuses local destinations outside the volumes
+// mounted under mountRoot. A mirror deletes what the source lacks, so a path
+// like /etc, or a mount point whose volume is gone and leaves the directory
+// on the root filesystem, would be wiped.
+func (s *ReplicationService) checkMountedVolume(destination string) errors.E {
+	if destination == s.mountRoot || !isSubPath(s.mountRoot, destination) {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "destination", destination,
+			"reason", fmt.Sprintf("destination path must be on a volume mounted under %s", s.mountRoot))
+	}
+	mounts, err := osutil.LoadMountInfo()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	volume := ""
+	for _, mount := range mounts {
+		if isSubPath(mount.MountDir, destination) && len(mount.MountDir) > len(volume) {
+			volume = mount.MountDir
+		}
+	}
+	if volume == "" || volume == s.mountRoot || !isSubPath(s.mountRoot, volume) {
+		return errors.WithDetails(dto.ErrorInvalidStateForOperation, "destination", destination,
+			"reason", "no volume is mounted at the destination path")
+	}
+	return nil
+}
+
+// isSubPath reports whether path is root or lies below it.
+func isSubPath(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func (s *ReplicationService) Sync(ctx context.Context, name, source string, options dto.SyncOptions) (string, errors.E) {
+	result, errE := s.sync(ctx, source, options)
+	s.reportResult(name, source, options, errE)
+	return result, errE
+}
+
+func (s *ReplicationService) sync(ctx context.Context, source string, options dto.SyncOptions) (string, errors.E) {
+	share, errE := s.shareService.GetShare(source)
+	if errE != nil {
+		return "", errE
+	}
+	sourcePath, errE := sharePath(*share)
+	if errE != nil {
+		return "", errE
+	}
+	destination, errE := s.syncDestination(sourcePath, options)
+	if errE != nil {
+		return "", errE
+	}
+	if _, err := s.executor.LookPath("rsync"); err != nil {
+		return "", errors.WithDetails(dto.ErrorInvalidStateForOperation, "reason", "rsync is not installed")
+	}
+
+	knownHosts := ""
+	if options.DestinationType == dto.SyncDestinationRsync && isSSHTarget(destination) {
+		knownHosts, errE = writeKnownHosts(options)
+		if errE != nil {
+			return "", errE
+		}
+		defer os.Remove(knownHosts)
+	}
+
+	args := rsyncArgs(sourcePath, destination, options, s.now(), knownHosts)
+	snapshot, err := s.executor.Execute(ctx, ShareSyncCommandID,
+		fmt.Sprintf("Sync %s to %s", source, options.Destination), "rsync", args...)
+	if err != nil {
+		return "", errors.WithDetails(err, "execution_id", snapshot.ExecutionID, "output", lastStderrLine(snapshot))
+	}
+
+	stats := []string{}
+	for _, line := range snapshot.Lines {
+		for _, prefix := range rsyncStats {
+			if strings.HasPrefix(line.Line, prefix) {
+				stats = append(stats, strings.ToLower(strings.TrimSuffix(line.Line, ":")))
+			}
+		}
+	}
+	summary := fmt.Sprintf("synced %s to %s", source, options.Destination)
+	if len(stats) > 0 {
+		summary += ": " + strings.Join(stats, ", ")
+	}
+	return summary, nil
+}
+
+// lastStderrLine returns the last error printed by a command, which for
+// rsync names the cause of the failure.
+func lastStderrLine(snapshot dto.CommandExecutionSnapshot) string {
+	for i := len(snapshot.Lines) - 1; i >= 0; i-- {
+		if snapshot.Lines[i].Channel == dto.CommandOutputChannelStderr {
+			return snapshot.Lines[i].Line
+		}
+	}
+	return ""
+}
+
+func syncProblemKey(name string) string {
+	return "share_sync_" + name
+}
+
+// reportResult records a failed sync as a Problem, which the next
+// successful run marks fixed. Successes alone are not recorded: the summary
+// is the message of the job run.
+func (s *ReplicationService) reportResult(name, source string, options dto.SyncOptions, errE errors.E) {
+	key := syncProblemKey(name)
+	if errE == nil {
+		problem, err := s.problemService.Get(key)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				tlog.WarnContext(s.ctx, "Unable to read sync problem", "job", name, "error", err)
+			}
+			return
+		}
+		if problem.Status == dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSFIXED {
+			return
+		}
+		if _, err := s.problemService.ApplyLifecycle(key, dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSFIXED, nil); err != nil {
+			tlog.WarnContext(s.ctx, "Unable to close sync problem", "job", name, "error", err)
+		}
+		return
+	}
+
+	cause := errE.Error()
+	if output, ok := errors.AllDetails(errE)["output"].(string); ok && output != "" {
+		cause = output
+	}
+	problem := &dto.Problem{
+		ProblemKey:     key,
+		TranslationKey: syncProblemTranslationKey,
+		Title:          fmt.Sprintf("Sync %s failed", name),
+		Description:    fmt.Sprintf("Sync of share %s to %s failed: %s", source, options.Destination, cause),
+		Severity:       dto.ProblemSeverities.PROBLEMSEVERITYERROR,
+		Status:         dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSCREATED,
+		IsPersistent:   true,
+		LastError:      &cause,
+		Data: map[string]any{
+			"source":           source,
+			"destination":      options.Destination,
+			"destination_type": string(options.DestinationType),
+			"mode":             string(options.Mode),
+		},
+	}
+	if _, err := s.problemService.Upsert(problem); err != nil {
+		tlog.WarnContext(s.ctx, "Unable to record sync result", "job", name, "error", err)
+	}
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/dianlight/srat/internal/osutil"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+// fakeRsync records its arguments, one per line, prints a --stats excerpt
+// and fails with "$RSYNC_EXIT" when set.
+const fakeRsync = `#!/bin/sh
+printf '%s\n' "$@" > "$(dirname "$0")/args"
+echo "Number of regular files transferred: 3"
+echo "Total transferred file size: 1,024 bytes"
+if [ -n "$RSYNC_EXIT" ]; then
+	echo "rsync: connection unexpectedly closed" >&2
+	exit "$RSYNC_EXIT"
+fi
+`
+
+// testHostKey is an ed25519 public key in known_hosts form.
+const testHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8g"
+
+type ReplicationServiceSuite struct {
+	suite.Suite
+	app                *fxtest.App
+	shareService       ShareServiceInterface
+	problemService     ProblemServiceInterface
+	eventBus           events.EventBusInterface
+	replicationService *ReplicationService
+	binDir             string
+	sourcePath         string
+	backupPath         string
+	problems           map[string]*dto.Problem // recorded by earlier runs
+}
+
+func TestReplicationServiceSuite(t *testing.T) {
+	suite.Run(t, new(ReplicationServiceSuite))
+}
+
+func (suite *ReplicationServiceSuite) SetupTest() {
+	suite.binDir = suite.T().TempDir()
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.binDir, "rsync"), []byte(fakeRsync), 0o755))
+	suite.T().Setenv("PATH", suite.binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var replicationService ReplicationServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			events.NewEventBus,
+			commandexec.NewCommandExecutor,
+			mock.Mock[ShareServiceInterface],
+			mock.Mock[ProblemServiceInterface],
+			NewReplicationService,
+		),
+		fx.Populate(&suite.shareService),
+		fx.Populate(&suite.problemService),
+		fx.Populate(&suite.eventBus),
+		fx.Populate(&replicationService),
+	)
+	suite.app.RequireStart()
+	suite.replicationService = replicationService.(*ReplicationService)
+	suite.replicationService.now = func() time.Time { return time.Date(2026, 3, 1, 2, 30, 0, 0, time.UTC) }
+
+	suite.sourcePath = suite.T().TempDir()
+	suite.backupPath = suite.T().TempDir()
+	suite.problems = map[string]*dto.Problem{}
+	mock.When(suite.problemService.Get(mock.AnyString())).ThenAnswer(func(args []any) []any {
+		if problem, ok := suite.problems[args[0].(string)]; ok {
+			return []any{problem, nil}
+		}
+		return []any{nil, gorm.ErrRecordNotFound}
+	})
+	for name, path := range map[string]string{"data": suite.sourcePath, "backup": suite.backupPath} {
+		mock.When(suite.shareService.GetShare(mock.Exact(name))).ThenReturn(&dto.SharedResource{
+			Name:           name,
+			MountPointData: &dto.MountPointData{Path: path, IsMounted: true},
+		}, nil)
+	}
+}
+
+func (suite *ReplicationServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+func (suite *ReplicationServiceSuite) rsyncArgs() []string {
+	data, err := os.ReadFile(filepath.Join(suite.binDir, "args"))
+	suite.Require().NoError(err)
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func (suite *ReplicationServiceSuite) TestParseSyncOptions() {
+	options, err := parseSyncOptions(map[string]string{"destination_type": "rsync", "destination": "nas:/backup/data", "bwlimit_kbps": "512",
+		"ssh_host_key": " ssh-ed25519  AAAAC3NzaC1lZDI1NTE5AAAAIAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8g\n"})
+	suite.Require().NoError(err)
+	suite.Equal(dto.SyncModeMirror, options.Mode, "mirror is the default")
+	suite.Equal(uint(512), options.BandwidthLimitKBps)
+	suite.Equal(testHostKey, options.SSHHostKey)
+
+	options, err = parseSyncOptions(map[string]string{"destination_type": "rsync", "destination": "rsync://nas/backup"})
+	suite.Require().NoError(err)
+	suite.Empty(options.SSHHostKey, "rsync daemons need no host key")
+
+	for _, invalid := range []map[string]string{
+		{"destination_type": "ftp", "destination": "host:/x"},
+		{"destination_type": "path", "destination": "relative/dir"},
+		{"destination_type": "path", "destination": "/backup", "mode": "copy"},
+		{"destination_type": "rsync", "destination": "-e sh"},
+		{"destination_type": "rsync", "destination": "/just/a/path"},
+		{"destination_type": "rsync", "destination": "rsync://host"},
+		{"destination_type": "rsync", "destination": "nas:/backup"},
+		{"destination_type": "rsync", "destination": "nas:/backup", "ssh_host_key": "ssh-ed25519"},
+		{"destination_type": "rsync", "destination": "nas:/backup", "ssh_host_key": "ssh-rsa AAAAC3NzaC1lZDI1NTE5AAAAIAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8g"},
+		{"destination_type": "rsync", "destination": "nas:/backup", "ssh_host_key": "ssh-ed25519 not-base64"},
+		{"destination_type": "share", "destination": ""},
+		{"destination_type": "share", "destination": "backup", "bwlimit_kbps": "-1"},
+	} {
+		_, err := parseSyncOptions(invalid)
+		suite.ErrorIs(err, dto.ErrorInvalidParameter, "options %v", invalid)
+	}
+}
+
+func (suite *ReplicationServiceSuite) TestRsyncArgs_Modes() {
+	now := time.Date(2026, 3, 1, 2, 30, 0, 0, time.UTC)
+	mirror := rsyncArgs("/mnt/data", "/mnt/backup", dto.SyncOptions{Mode: dto.SyncModeMirror}, now, "")
+	suite.Contains(mirror, "--delete")
+	suite.Equal([]string{"/mnt/data/", "/mnt/backup"}, mirror[len(mirror)-2:])
+
+	appendOnly := rsyncArgs("/mnt/data", "/mnt/backup", dto.SyncOptions{Mode: dto.SyncModeAppend, BandwidthLimitKBps: 100}, now, "")
+	suite.NotContains(appendOnly, "--delete")
+	suite.Contains(appendOnly, "--bwlimit=100")
+
+	versioned := rsyncArgs("/mnt/data", "/mnt/backup", dto.SyncOptions{Mode: dto.SyncModeVersioned}, now, "")
+	suite.Contains(versioned, "--delete")
+	suite.Contains(versioned, "--backup-dir=.versions/2026-03-01_02-30-00")
+	suite.Contains(versioned, "--exclude=/.versions/")
+
+	ssh := rsyncArgs("/mnt/data", "nas:/backup", dto.SyncOptions{DestinationType: dto.SyncDestinationRsync, Destination: "nas:/backup", Mode: dto.SyncModeMirror}, now, "/tmp/known_hosts")
+	suite.Contains(ssh, "--rsh=ssh -o BatchMode=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=/tmp/known_hosts")
+	daemon := rsyncArgs("/mnt/data", "rsync://nas/backup", dto.SyncOptions{DestinationType: dto.SyncDestinationRsync, Destination: "rsync://nas/backup", Mode: dto.SyncModeMirror}, now, "")
+	suite.NotContains(strings.Join(daemon, " "), "--rsh")
+}
+
+func (suite *ReplicationServiceSuite) TestSync_ShareToShare() {
+	var mu sync.Mutex
+	var lines []string
+	suite.eventBus.OnCommandExecution(func(_ context.Context, event events.CommandExecutionEvent) errors.E {
+		if output, ok := event.Message.(dto.CommandOutputNotification); ok && output.CommandID == ShareSyncCommandID {
+			mu.Lock()
+			lines = append(lines, output.Line)
+			mu.Unlock()
+		}
+		return nil
+	})
+	summary, err := suite.replicationService.Sync(context.Background(), "nightly", "data",
+		dto.SyncOptions{DestinationType: dto.SyncDestinationShare, Destination: "backup", Mode: dto.SyncModeMirror})
+	suite.Require().NoError(err)
+	suite.Contains(summary, "number of regular files transferred: 3")
+
+	args := suite.rsyncArgs()
+	suite.Equal([]string{suite.sourcePath + "/", suite.backupPath}, args[len(args)-2:])
+
+	mu.Lock()
+	suite.Contains(lines, "Number of regular files transferred: 3", "rsync output streams as command_output events")
+	mu.Unlock()
+
+	_, _ = mock.Verify(suite.problemService, mock.Never()).Upsert(mock.Any[*dto.Problem]())
+	_, _ = mock.Verify(suite.problemService, mock.Never()).ApplyLifecycle(mock.AnyString(),
+		mock.Any[dto.ProblemLifecycleStatus](), mock.Any[*string]())
+}
+
+func (suite *ReplicationServiceSuite) TestSync_SuccessFixesPreviousFailure() {
+	suite.problems["share_sync_nightly"] = &dto.Problem{
+		ProblemKey: "share_sync_nightly",
+		Status:     dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSCREATED,
+	}
+	suite.problems["share_sync_weekly"] = &dto.Problem{
+		ProblemKey: "share_sync_weekly",
+		Status:     dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSFIXED,
+	}
+	options := dto.SyncOptions{DestinationType: dto.SyncDestinationShare, Destination: "backup", Mode: dto.SyncModeMirror}
+
+	_, err := suite.replicationService.Sync(context.Background(), "nightly", "data", options)
+	suite.Require().NoError(err)
+	_, err = suite.replicationService.Sync(context.Background(), "weekly", "data", options)
+	suite.Require().NoError(err)
+
+	_, _ = mock.Verify(suite.problemService, mock.Once()).ApplyLifecycle(mock.Exact("share_sync_nightly"),
+		mock.Exact(dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSFIXED), mock.Any[*string]())
+	_, _ = mock.Verify(suite.problemService, mock.Never()).ApplyLifecycle(mock.Exact("share_sync_weekly"),
+		mock.Any[dto.ProblemLifecycleStatus](), mock.Any[*string]())
+	_, _ = mock.Verify(suite.problemService, mock.Never()).Upsert(mock.Any[*dto.Problem]())
+}
+
+func (suite *ReplicationServiceSuite) TestSync_FailureRaisesProblem() {
+	suite.T().Setenv("RSYNC_EXIT", "12")
+	problemCaptor := mock.Captor[*dto.Problem]()
+	mock.When(suite.problemService.Upsert(problemCaptor.Capture())).ThenReturn(&dto.Problem{}, nil)
+
+	_, err := suite.replicationService.Sync(context.Background(), "offsite", "data",
+		dto.SyncOptions{DestinationType: dto.SyncDestinationRsync, Destination: "rsync://nas/backup", Mode: dto.SyncModeAppend})
+	suite.Require().Error(err)
+
+	problem := problemCaptor.Last()
+	suite.Require().NotNil(problem)
+	suite.Equal("share_sync_offsite", problem.ProblemKey)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYERROR, problem.Severity)
+	suite.Require().NotNil(problem.LastError)
+	suite.Equal("rsync: connection unexpectedly closed", *problem.LastError)
+}
+
+func (suite *ReplicationServiceSuite) TestSync_RefusesOverlappingDestination() {
+	nested := filepath.Join(suite.sourcePath, "copy")
+	_, err := suite.replicationService.Sync(context.Background(), "loop", "data",
+		dto.SyncOptions{DestinationType: dto.SyncDestinationPath, Destination: nested, Mode: dto.SyncModeMirror})
+	suite.ErrorIs(err, dto.ErrorInvalidParameter)
+	suite.NoFileExists(filepath.Join(suite.binDir, "args"), "rsync must not run")
+}
+
+func (suite *ReplicationServiceSuite) TestSync_PathMustBeOnMountedVolume() {
+	mountRoot := suite.T().TempDir()
+	suite.replicationService.mountRoot = mountRoot
+	usb := filepath.Join(mountRoot, "usb")
+	suite.T().Cleanup(osutil.MockMountInfo("1 0 8:1 / / rw - ext4 /dev/sda1 rw\n" +
+		"2 1 8:17 / " + usb + " rw - ext4 /dev/sdb1 rw"))
+	mirror := func(destination string) errors.E {
+		_, err := suite.replicationService.Sync(context.Background(), "local", "data",
+			dto.SyncOptions{DestinationType: dto.SyncDestinationPath, Destination: destination, Mode: dto.SyncModeMirror})
+		return err
+	}
+	mock.When(suite.problemService.Upsert(mock.Any[*dto.Problem]())).ThenReturn(&dto.Problem{}, nil)
+
+	for _, destination := range []string{"/", "/etc", "/data", mountRoot} {
+		suite.ErrorIs(mirror(destination), dto.ErrorInvalidParameter, "destination %s", destination)
+	}
+	suite.ErrorIs(mirror(filepath.Join(mountRoot, "gone", "backup")), dto.ErrorInvalidStateForOperation,
+		"a directory left by an unmounted volume is on the root filesystem")
+	suite.NoFileExists(filepath.Join(suite.binDir, "args"), "rsync must not run")
+
+	suite.Require().NoError(mirror(filepath.Join(usb, "backup")))
+	args := suite.rsyncArgs()
+	suite.Equal(filepath.Join(usb, "backup"), args[len(args)-1])
+}
+
+func (suite *ReplicationServiceSuite) TestSync_SSHPinsHostKey() {
+	_, err := suite.replicationService.Sync(context.Background(), "offsite", "data", dto.SyncOptions{
+		DestinationType: dto.SyncDestinationRsync, Destination: "backup@nas:/srv/data", Mode: dto.SyncModeMirror, SSHHostKey: testHostKey,
+	})
+	suite.Require().NoError(err)
+
+	var knownHosts string
+	for _, arg := range suite.rsyncArgs() {
+		if rsh, ok := strings.CutPrefix(arg, "--rsh="); ok {
+			suite.Contains(rsh, "StrictHostKeyChecking=yes")
+			_, knownHosts, _ = strings.Cut(rsh, "UserKnownHostsFile=")
+		}
+	}
+	suite.Require().NotEmpty(knownHosts)
+	suite.NoFileExists(knownHosts, "the known_hosts file is removed after the sync")
+	suite.Equal("nas", sshHost("backup@nas:/srv/data"))
+}
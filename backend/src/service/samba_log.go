@@ -0,0 +1,104 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// sambaHeaderTime matches the timestamp of a Samba debug header, like
+// `[2026/01/31 18:00:00.123456,  1, class=full_audit] ...(do_log)`. The
+// message follows on the next line.
+var sambaHeaderTime = regexp.MustCompile(`^\[(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?)`)
+
+// parseSambaHeaderTime returns the time of a Samba debug header line.
+func parseSambaHeaderTime(line string) (time.Time, bool) {
+	match := sambaHeaderTime.FindStringSubmatch(line)
+	if match == nil {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("2006/01/02 15:04:05.999999", match[1], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// sambaLogTail follows a log file written by smbd, across its rotations.
+type sambaLogTail struct {
+	file   os.FileInfo // log read up to offset
+	offset int64
+}
+
+// readLines returns the complete lines added to the log at path since the
+// last read. When smbd rotated the log, the end of the rotated file is read
+// first.
+func (t *sambaLogTail) readLines(path string) ([]string, errors.E) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var lines []string
+	if t.file != nil && !os.SameFile(t.file, info) {
+		if old, err := os.Stat(path + ".old"); err == nil && os.SameFile(t.file, old) {
+			rotated, _, errE := readLinesFrom(path+".old", t.offset)
+			if errE != nil {
+				return nil, errE
+			}
+			lines = rotated
+		}
+		t.offset = 0
+	} else if info.Size() < t.offset {
+		// Truncated.
+		t.offset = 0
+	}
+	t.file = info
+
+	added, offset, errE := readLinesFrom(path, t.offset)
+	if errE != nil {
+		return nil, errE
+	}
+	t.offset = offset
+	return append(lines, added...), nil
+}
+
+// readLinesFrom returns the complete lines of path after offset, and the
+// offset following the last one.
+func readLinesFrom(path string, offset int64) ([]string, int64, errors.E) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, offset, errors.WithStack(err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, errors.WithStack(err)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, offset, errors.WithStack(err)
+	}
+	// A line still being written is read at the next collection.
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil, offset, nil
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data[:end+1]))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, offset, errors.WithStack(err)
+	}
+	return lines, offset + int64(end) + 1, nil
+}
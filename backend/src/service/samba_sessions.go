@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+)
+
+// sendSmbControl sends message to the smbd process dest, a pid or "smbd"
+// for all of them, and drops the cached status so the change shows up.
+func (self *ServerService) sendSmbControl(ctx context.Context, dest, message string, args ...string) errors.E {
+	command := append([]string{"smbcontrol", dest, message}, args...)
+	out, err := self.runCommandWithRunner(ctx, "samba-control-"+message, "Samba "+message, command)
+	self.cache.Delete("samba_status")
+	if err != nil {
+		return errors.Errorf("Error executing smbcontrol: %w \n %#v", err, map[string]any{"error": err, "output": out, "cmd": strings.Join(command, " ")})
+	}
+	return nil
+}
+
+// shutdownSessions ends the smbd processes serving sessions: each client
+// connection has its own smbd process.
+func (self *ServerService) shutdownSessions(ctx context.Context, sessions []dto.SambaSession) (int, errors.E) {
+	var pids []string
+	for _, session := range sessions {
+		if session.ServerID.PID != "" && !slices.Contains(pids, session.ServerID.PID) {
+			pids = append(pids, session.ServerID.PID)
+		}
+	}
+	sort.Strings(pids)
+	for _, pid := range pids {
+		if err := self.sendSmbControl(ctx, pid, "shutdown"); err != nil {
+			return 0, err
+		}
+	}
+	return len(sessions), nil
+}
+
+func (self *ServerService) DisconnectSession(ctx context.Context, sessionID string) errors.E {
+	status, err := self.loadSambaStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, session := range status.Sessions {
+		if session.SessionID == sessionID {
+			tlog.InfoContext(ctx, "Disconnecting Samba session", "session", sessionID, "user", session.Username, "client", session.RemoteMachine)
+			_, err := self.shutdownSessions(ctx, []dto.SambaSession{session})
+			return err
+		}
+	}
+	return errors.WithDetails(dto.ErrorSambaSessionNotFound, "session_id", sessionID)
+}
+
+func (self *ServerService) DisconnectUser(ctx context.Context, username string) (int, errors.E) {
+	status, err := self.loadSambaStatus(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var sessions []dto.SambaSession
+	for _, session := range status.Sessions {
+		if session.Username == username {
+			sessions = append(sessions, session)
+		}
+	}
+	tlog.InfoContext(ctx, "Disconnecting Samba sessions of user", "user", username, "sessions", len(sessions))
+	return self.shutdownSessions(ctx, sessions)
+}
+
+func (self *ServerService) DisconnectClient(ctx context.Context, clientIP string) (int, errors.E) {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return 0, errors.WithDetails(dto.ErrorInvalidParameter, "client_ip", clientIP, "reason", "not an IP address")
+	}
+	status, err := self.loadSambaStatus(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, session := range status.Sessions {
+		if remote := net.ParseIP(session.RemoteMachine); remote != nil && remote.Equal(ip) {
+			count++
+		}
+	}
+	tlog.InfoContext(ctx, "Disconnecting Samba sessions of client", "client", clientIP, "sessions", count)
+	if err := self.sendSmbControl(ctx, "smbd", "kill-client-ip", ip.String()); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// CloseOpenFile releases the opens of the file at path, or only openID
+// ("<pid>/<share_file_id>") when given. Samba can't close a single handle
+// from outside, so the connection of each client holding the file to its
+// share is closed, releasing all the handles and locks of that client on
+// the share. The client reconnects on its next access.
+func (self *ServerService) CloseOpenFile(ctx context.Context, path, openID string) (int, errors.E) {
+	status, err := self.loadSambaStatus(ctx)
+	if err != nil {
+		return 0, err
+	}
+	file, ok := status.OpenFiles[path]
+	if !ok {
+		return 0, errors.WithDetails(dto.ErrorOpenFileNotFound, "path", path)
+	}
+
+	var pids []string
+	for id, open := range file.Opens {
+		if openID != "" && id != openID {
+			continue
+		}
+		if !slices.Contains(pids, open.ServerID.PID) {
+			pids = append(pids, open.ServerID.PID)
+		}
+	}
+	if len(pids) == 0 {
+		return 0, errors.WithDetails(dto.ErrorOpenFileNotFound, "path", path, "open_id", openID)
+	}
+	sort.Strings(pids)
+
+	for _, pid := range pids {
+		share, errE := self.shareOfOpenFile(status, pid, file.ServicePath)
+		if errE != nil {
+			return 0, errE
+		}
+		tlog.InfoContext(ctx, "Closing Samba open file", "path", path, "pid", pid, "share", share)
+		if err := self.sendSmbControl(ctx, pid, "close-share", share); err != nil {
+			return 0, err
+		}
+	}
+	return len(pids), nil
+}
+
+// shareOfOpenFile returns the name of the share exporting servicePath that
+// the smbd process pid is connected to.
+func (self *ServerService) shareOfOpenFile(status *dto.SambaStatus, pid, servicePath string) (string, errors.E) {
+	var connected []string
+	for _, tcon := range status.Tcons {
+		if tcon.ServerID.PID != pid {
+			continue
+		}
+		name := tcon.Service
+		if name == "" {
+			name = tcon.Share
+		}
+		connected = append(connected, name)
+	}
+	if len(connected) == 1 {
+		return connected[0], nil
+	}
+
+	if self.share_service != nil {
+		shares, err := self.share_service.ListShares()
+		if err != nil {
+			return "", err
+		}
+		for _, share := range shares {
+			if share.ExportPath() != "" && filepath.Clean(share.ExportPath()) == filepath.Clean(servicePath) &&
+				slices.ContainsFunc(connected, func(name string) bool { return strings.EqualFold(name, share.Name) }) {
+				return share.Name, nil
+			}
+		}
+	}
+	return "", errors.WithDetails(dto.ErrorOpenFileNotFound, "pid", pid, "service_path", servicePath,
+		"reason", "share of the open file not found")
+}
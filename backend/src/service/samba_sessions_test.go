@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	cache "github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/tozd/go/errors"
+)
+
+const sessionsSmbstatus = `{
+	"sessions": {
+		"100": {"session_id": "100", "server_id": {"pid": "4321"}, "username": "alice", "remote_machine": "192.168.1.10"},
+		"101": {"session_id": "101", "server_id": {"pid": "4322"}, "username": "alice", "remote_machine": "192.168.1.11"},
+		"102": {"session_id": "102", "server_id": {"pid": "4323"}, "username": "bob", "remote_machine": "192.168.1.10"}
+	},
+	"tcons": {
+		"1": {"tcon_id": "1", "session_id": "100", "service": "backup", "server_id": {"pid": "4321"}},
+		"2": {"tcon_id": "2", "session_id": "102", "service": "media", "server_id": {"pid": "4323"}},
+		"3": {"tcon_id": "3", "session_id": "102", "service": "backup", "server_id": {"pid": "4323"}}
+	},
+	"open_files": {
+		"/mnt/backup/mac.sparsebundle/token": {
+			"service_path": "/mnt/backup",
+			"filename": "mac.sparsebundle/token",
+			"opens": {
+				"4321/12": {"server_id": {"pid": "4321"}, "share_file_id": 12},
+				"4323/7": {"server_id": {"pid": "4323"}, "share_file_id": 7}
+			}
+		}
+	},
+	"byte_range_locks": {
+		"/mnt/backup/mac.sparsebundle/token": {
+			"fileid": {"devid": 2049, "inode": 1234, "extid": 0},
+			"file_name": "mac.sparsebundle/token",
+			"share_path": "/mnt/backup",
+			"locks": [
+				{"server_id": {"pid": "4321"}, "type": "W", "flavour": "Posix", "start": 0, "size": 1},
+				{"server_id": {"pid": "4323"}, "type": "R", "flavour": "Windows", "start": 100, "size": 20}
+			]
+		}
+	}
+}`
+
+// smbstatusRunner answers smbstatus with sessionsSmbstatus and records the
+// other commands.
+type smbstatusRunner struct {
+	applyCommandRunner
+	statusArgs []string
+}
+
+func (r *smbstatusRunner) Execute(ctx context.Context, id, label, command string, args ...string) (dto.CommandExecutionSnapshot, error) {
+	if command == "smbstatus" {
+		r.statusArgs = args
+		return dto.CommandExecutionSnapshot{Lines: []dto.CommandOutputLineSnapshot{
+			{Channel: dto.CommandOutputChannelStdout, Line: sessionsSmbstatus},
+		}}, nil
+	}
+	return r.applyCommandRunner.Execute(ctx, id, label, command, args...)
+}
+
+func newSessionsService(t *testing.T) (*ServerService, *smbstatusRunner) {
+	runner := &smbstatusRunner{applyCommandRunner: applyCommandRunner{fail: map[string]bool{}}}
+	ctrl := mock.NewMockController(t)
+	shareService := mock.Mock[ShareServiceInterface](ctrl)
+	mock.When(shareService.ListShares()).ThenReturn([]dto.SharedResource{
+		{Name: "media", MountPointData: &dto.MountPointData{Path: "/mnt/media"}},
+		{Name: "backup", MountPointData: &dto.MountPointData{Path: "/mnt/backup"}},
+	}, nil)
+	return &ServerService{
+		ctx:           context.Background(),
+		commandRunner: runner,
+		share_service: shareService,
+		cache:         cache.New(cache.NoExpiration, cache.NoExpiration),
+	}, runner
+}
+
+func TestLoadSambaStatus_ByteRangeLocks(t *testing.T) {
+	service, runner := newSessionsService(t)
+
+	status, err := service.loadSambaStatus(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-j", "-B"}, runner.statusArgs)
+	assert.Len(t, status.Sessions, 3, "sessions are still reported with the locks")
+	require.Contains(t, status.ByteRangeLocks, "/mnt/backup/mac.sparsebundle/token")
+	locks := status.ByteRangeLocks["/mnt/backup/mac.sparsebundle/token"]
+	assert.Equal(t, "/mnt/backup", locks.SharePath)
+	require.Len(t, locks.Locks, 2)
+	assert.Equal(t, "4323", locks.Locks[1].ServerID.PID)
+	assert.Equal(t, uint64(100), locks.Locks[1].Start)
+}
+
+func TestDisconnectSession(t *testing.T) {
+	service, runner := newSessionsService(t)
+	service.cache.Set("samba_status", &dto.SambaStatus{}, cache.DefaultExpiration)
+
+	require.NoError(t, service.DisconnectSession(context.Background(), "101"))
+	assert.Equal(t, [][]string{{"smbcontrol", "4322", "shutdown"}}, runner.commands)
+	_, cached := service.cache.Get("samba_status")
+	assert.False(t, cached, "the cached status is dropped")
+
+	err := service.DisconnectSession(context.Background(), "999")
+	assert.True(t, errors.Is(err, dto.ErrorSambaSessionNotFound))
+}
+
+func TestDisconnectUser(t *testing.T) {
+	service, runner := newSessionsService(t)
+
+	count, err := service.DisconnectUser(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, [][]string{{"smbcontrol", "4321", "shutdown"}, {"smbcontrol", "4322", "shutdown"}}, runner.commands)
+}
+
+func TestDisconnectClient(t *testing.T) {
+	service, runner := newSessionsService(t)
+
+	count, err := service.DisconnectClient(context.Background(), "192.168.1.10")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, [][]string{{"smbcontrol", "smbd", "kill-client-ip", "192.168.1.10"}}, runner.commands)
+
+	_, err = service.DisconnectClient(context.Background(), "not-an-ip")
+	assert.True(t, errors.Is(err, dto.ErrorInvalidParameter))
+}
+
+func TestCloseOpenFile(t *testing.T) {
+	service, runner := newSessionsService(t)
+
+	count, err := service.CloseOpenFile(context.Background(), "/mnt/backup/mac.sparsebundle/token", "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	// 4323 is connected to two shares: the one exporting the service path is closed.
+	assert.Equal(t, [][]string{
+		{"smbcontrol", "4321", "close-share", "backup"},
+		{"smbcontrol", "4323", "close-share", "backup"},
+	}, runner.commands)
+
+	runner.commands = nil
+	count, err = service.CloseOpenFile(context.Background(), "/mnt/backup/mac.sparsebundle/token", "4321/12")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, [][]string{{"smbcontrol", "4321", "close-share", "backup"}}, runner.commands)
+
+	_, err = service.CloseOpenFile(context.Background(), "/mnt/backup/mac.sparsebundle/token", "4321/99")
+	assert.True(t, errors.Is(err, dto.ErrorOpenFileNotFound))
+	_, err = service.CloseOpenFile(context.Background(), "/mnt/other", "")
+	assert.True(t, errors.Is(err, dto.ErrorOpenFileNotFound))
+}
@@ -8,15 +8,18 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/dianlight/srat/config"
 	"github.com/dianlight/srat/converter"
 	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
 	"github.com/dianlight/srat/dto"
 	"github.com/dianlight/srat/events"
 	"github.com/dianlight/srat/homeassistant/mount"
@@ -31,6 +34,7 @@ import (
 	"github.com/shirou/gopsutil/v4/process"
 	"gitlab.com/tozd/go/errors"
 	"go.uber.org/fx"
+	"gorm.io/gorm"
 )
 
 // Mockable functions for testing
@@ -109,6 +113,27 @@ type ServerServiceInterface interface {
 	GetServerProcesses() (*dto.ServerProcessStatus, errors.E)
 	GetSambaStatus() (*dto.SambaStatus, errors.E)
 	WriteConfigsAndRestartProcesses(ctx context.Context) errors.E
+	// ReloadConfig writes the configuration files and reloads the servers
+	// without restarting them.
+	ReloadConfig(ctx context.Context) errors.E
+	// ApplyClientBans has smbd refuse the clients banned now, leaving the
+	// other pending changes and the configuration generations alone.
+	ApplyClientBans(ctx context.Context) errors.E
+	// ListConfigGenerations returns the applied configurations, newest first.
+	ListConfigGenerations() ([]dto.ConfigGeneration, errors.E)
+	// RollbackConfig applies the files of a previous generation again.
+	RollbackConfig(ctx context.Context, generation uint) errors.E
+	// PreviewConfig tells what an apply would change, without applying.
+	PreviewConfig(ctx context.Context) (*dto.ConfigPreview, errors.E)
+	// DisconnectSession ends the Samba session sessionID.
+	DisconnectSession(ctx context.Context, sessionID string) errors.E
+	// DisconnectUser ends the Samba sessions of username and returns how many.
+	DisconnectUser(ctx context.Context, username string) (int, errors.E)
+	// DisconnectClient ends the Samba sessions from clientIP and returns how many.
+	DisconnectClient(ctx context.Context, clientIP string) (int, errors.E)
+	// CloseOpenFile releases a file held open by Samba clients and returns
+	// how many clients were affected.
+	CloseOpenFile(ctx context.Context, path, openID string) (int, errors.E)
 	SetState(state *dto.ContextState)
 }
 
@@ -122,10 +147,12 @@ type ServerService struct {
 	DockerInterface string
 	DockerNet       string
 	state           *dto.ContextState
+	db              *gorm.DB
 	share_service   ShareServiceInterface
 	user_service    UserServiceInterface
 	host_service    HostServiceInterface
 	setting_service SettingServiceInterface
+	dirty_service   DirtyDataServiceInterface
 	//prop_repo        repository.PropertyRepositoryInterface
 	mount_client     mount.ClientWithResponsesInterface
 	cache            *cache.Cache
@@ -136,6 +163,7 @@ type ServerService struct {
 	status           dto.ServerProcessStatus
 	internalServices []ServerProcessStatus
 	disks            *dto.DiskMap
+	applyMutex       sync.Mutex
 }
 
 type ServerServiceParams struct {
@@ -143,10 +171,12 @@ type ServerServiceParams struct {
 	Ctx             context.Context
 	CtxCancel       context.CancelFunc
 	State           *dto.ContextState
+	Db              *gorm.DB
 	Share_service   ShareServiceInterface
 	User_service    UserServiceInterface
 	Host_service    HostServiceInterface
 	Setting_service SettingServiceInterface
+	Dirty_service   DirtyDataServiceInterface `optional:"true"`
 	//Samba_user_repo   repository.SambaUserRepositoryInterface
 	Mount_client      mount.ClientWithResponsesInterface `optional:"true"`
 	Hdidle_service    HDIdleServiceInterface
@@ -169,6 +199,7 @@ type serviceConfig struct {
 
 var (
 	sambaUsersMapFile = "/etc/samba/smbusers"
+	nfsExportsFile    = "/etc/exports"
 
 	serviceConfigMap = map[string]serviceConfig{
 		"smbd": {
@@ -231,10 +262,12 @@ func NewServerProcessesService(lc fx.Lifecycle, in ServerServiceParams) ServerSe
 	p.ctx = in.Ctx
 	p.ctxCancel = in.CtxCancel
 	p.state = in.State
+	p.db = in.Db
 	p.share_service = in.Share_service
 	//p.prop_repo = in.Prop_repo
 	p.user_service = in.User_service
 	p.setting_service = in.Setting_service
+	p.dirty_service = in.Dirty_service
 	p.host_service = in.Host_service
 
 	//p.samba_user_repo = in.Samba_user_repo
@@ -352,17 +385,19 @@ func (self *ServerService) runCommandWithRunner(ctx context.Context, commandID,
 	return output, nil
 }
 
-func (self *ServerService) GetSambaStatus() (*dto.SambaStatus, errors.E) {
-	if x, found := self.cache.Get("samba_status"); found {
-		return x.(*dto.SambaStatus), nil
-	}
+// smbstatusCommand reports sessions, shares and open files as JSON. -B adds
+// the byte-range locks; -L would add nothing, as the open files are already
+// listed, and would drop the sessions and shares.
+var smbstatusCommand = []string{"smbstatus", "-j", "-B"}
 
-	ctx, cancel := context.WithTimeout(self.ctx, 30*time.Second)
+// loadSambaStatus runs smbstatus, bypassing the status cache.
+func (self *ServerService) loadSambaStatus(ctx context.Context) (*dto.SambaStatus, errors.E) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	out, err := self.runCommandWithRunner(ctx, "samba-status", "Samba status", []string{"smbstatus", "-j"})
+	out, err := self.runCommandWithRunner(ctx, "samba-status", "Samba status", smbstatusCommand)
 	if err != nil {
-		return nil, errors.Errorf("Error executing smbstatus: %w \n %#v", err, map[string]any{"error": err, "output": out, "cmd": "smbstatus -j"})
+		return nil, errors.Errorf("Error executing smbstatus: %w \n %#v", err, map[string]any{"error": err, "output": out, "cmd": strings.Join(smbstatusCommand, " ")})
 	}
 
 	// Validate that output is valid JSON before unmarshaling
@@ -380,11 +415,24 @@ func (self *ServerService) GetSambaStatus() (*dto.SambaStatus, errors.E) {
 		return nil, errors.Errorf("failed to parse smbstatus output as JSON: %w (output: %s)", unmarshalErr, outStr)
 	}
 
-	self.cache.Set("samba_status", &status, cache.DefaultExpiration)
-
 	return &status, nil
 }
 
+func (self *ServerService) GetSambaStatus() (*dto.SambaStatus, errors.E) {
+	if x, found := self.cache.Get("samba_status"); found {
+		return x.(*dto.SambaStatus), nil
+	}
+
+	status, err := self.loadSambaStatus(self.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	self.cache.Set("samba_status", status, cache.DefaultExpiration)
+
+	return status, nil
+}
+
 func (self *ServerService) CreateSambaConfigStream() (data *[]byte, err errors.E) {
 	config, err := self.jSONFromDatabase()
 	if err != nil {
@@ -412,6 +460,9 @@ func (self *ServerService) CreateSambaConfigStream() (data *[]byte, err errors.E
 	isSambaVersionSufficient, _ := unixsamba.IsSambaVersionSufficient()
 	(*config_2)["samba_version"] = sambaVersion
 	(*config_2)["samba_version_sufficient"] = isSambaVersionSufficient
+	if self.state.SambaConfigFile != "" {
+		(*config_2)["hosts_file"] = self.sambaHostsFile()
+	}
 
 	datar, err := tempio.RenderTemplateBuffer(config_2, self.state.Template)
 	return &datar, errors.WithStack(err)
@@ -534,10 +585,125 @@ func (self *ServerService) jSONFromDatabase() (tconfig config.Config, err errors
 	// mode (old, new, or both). Legacy names always resolve to the new
 	// application-based directories.
 	applyStandardShareNamesPolicy(&tconfig, settings.StandardShareNames)
+	applyHomesSettings(&tconfig, settings)
+	applyAuditSettings(&tconfig)
+
+	bans, err := self.bannedHosts()
+	if err != nil {
+		return tconfig, errors.WithStack(err)
+	}
+	applyIntrusionSettings(&tconfig, settings, bans)
 
 	return tconfig, nil
 }
 
+// bannedHosts returns the addresses of the clients banned until later than
+// now.
+func (self *ServerService) bannedHosts() ([]string, errors.E) {
+	if self.db == nil {
+		return nil, nil
+	}
+	rows, err := gorm.G[dbom.ClientBan](self.db).Where(g.ClientBan.ExpiresAt.Gt(time.Now())).Order(g.ClientBan.IP.Asc()).Find(self.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list client bans")
+	}
+	hosts := make([]string, 0, len(rows))
+	for _, row := range rows {
+		hosts = append(hosts, row.IP)
+	}
+	return hosts, nil
+}
+
+// sambaHostsFile is the fragment included at the end of the [global]
+// section of smb.conf, where ApplyClientBans writes the bans made since the
+// last apply.
+func (self *ServerService) sambaHostsFile() string {
+	return filepath.Join(filepath.Dir(self.state.SambaConfigFile), "smb.hosts.conf")
+}
+
+// hostsAllowLine matches the `hosts allow` parameter of smb.conf, without
+// its list of banned clients.
+var hostsAllowLine = regexp.MustCompile(`(?m)^\s*hosts allow = (.*?)(?: EXCEPT .*)?$`)
+
+// ApplyClientBans overrides the `hosts allow` of the installed smb.conf with
+// one excepting the clients banned now, in the fragment that smb.conf
+// includes, and has smbd reload it. Nothing else of the configuration is
+// applied and no generation is recorded: the next apply renders the bans in
+// smb.conf and empties the fragment.
+func (self *ServerService) ApplyClientBans(ctx context.Context) errors.E {
+	self.applyMutex.Lock()
+	defer self.applyMutex.Unlock()
+
+	installed, err := os.ReadFile(self.state.SambaConfigFile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", self.state.SambaConfigFile)
+	}
+	match := hostsAllowLine.FindSubmatch(installed)
+	if match == nil {
+		return errors.Errorf("no hosts allow in %s", self.state.SambaConfigFile)
+	}
+	bans, errE := self.bannedHosts()
+	if errE != nil {
+		return errE
+	}
+	line := "   hosts allow = " + strings.TrimSpace(string(match[1]))
+	if len(bans) > 0 {
+		line += " EXCEPT " + strings.Join(bans, " ")
+	}
+
+	file := dbom.ConfigGenerationFile{Path: self.sambaHostsFile(), Mode: 0o600, Content: []byte(line + "\n")}
+	staged, errE := stageConfigFile(file)
+	if errE != nil {
+		return errE
+	}
+	if err := os.Rename(staged, file.Path); err != nil {
+		_ = os.Remove(staged)
+		return errors.Wrapf(err, "failed to install %s", file.Path)
+	}
+	tlog.InfoContext(ctx, "Applying client bans", "bans", len(bans))
+	return self.sendSmbControl(ctx, "smbd", "reload-config")
+}
+
+// applyIntrusionSettings logs the authentications to authLogFile when
+// intrusion protection is on, and refuses the banned clients. Bans stay in
+// force when protection is turned off, until they expire or are lifted.
+func applyIntrusionSettings(tconfig *config.Config, settings *dto.Settings, bans []string) {
+	tconfig.AuthLogFile = ""
+	if settings.IntrusionProtection != nil && *settings.IntrusionProtection {
+		tconfig.AuthLogFile = authLogFile
+	}
+	tconfig.BannedHosts = bans
+}
+
+// applyHomesSettings enables the [homes] share when home directories are
+// turned on and a volume is chosen. Per-user quotas are enforced by the
+// filesystem (see HomesService), Samba reports them as free space.
+func applyHomesSettings(tconfig *config.Config, settings *dto.Settings) {
+	if settings.HomesEnabled == nil || !*settings.HomesEnabled || settings.HomesVolume == "" {
+		tconfig.Homes = nil
+		return
+	}
+	tconfig.Homes = &config.Homes{Path: homesRoot(settings.HomesVolume)}
+}
+
+// applyAuditSettings fills in the default operations of the audited shares
+// and sends the audit log to auditLogFile when a share is audited.
+func applyAuditSettings(tconfig *config.Config) {
+	tconfig.AuditLogFile = ""
+	for name, share := range tconfig.Shares {
+		if share.Audit == nil || !share.Audit.Enabled {
+			continue
+		}
+		if len(share.Audit.Operations) == 0 {
+			audit := *share.Audit
+			audit.Operations = dto.DefaultAuditOperations
+			share.Audit = &audit
+			tconfig.Shares[name] = share
+		}
+		tconfig.AuditLogFile = auditLogFile
+	}
+}
+
 // applyStandardShareNamesPolicy adjusts the standard share names exposed by
 // Samba based on the configured mode (issue #898):
 //   - "old": expose only the legacy names (addons, addon_configs)
@@ -636,19 +802,10 @@ func (self *ServerService) WriteConfigsAndRestartProcesses(ctx context.Context)
 	return self.writeConfigsAndRestartServers(ctx, defaultDirtyMask)
 }
 
-func (self *ServerService) writeSambaConfig(ctx context.Context) errors.E {
-	tlog.TraceContext(ctx, "Writing Samba configuration file", "file", self.state.SambaConfigFile)
-	stream, errE := self.CreateSambaConfigStream()
-	if errE != nil {
-		return errors.WithStack(errE)
-	}
-
-	// Restrict permissions on config file
-	err := os.WriteFile(self.state.SambaConfigFile, *stream, 0o600)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	return nil
+// ReloadConfig writes the configuration files and has the servers reload
+// them: open sessions are kept.
+func (self *ServerService) ReloadConfig(ctx context.Context) errors.E {
+	return self.writeConfigsAndRestartServers(ctx, dto.DataDirtyTracker{Shares: true})
 }
 
 func (self *ServerService) writeSambaUsersMapConfig(ctx context.Context) errors.E {
@@ -707,7 +864,7 @@ func (self *ServerService) recoverMediaUsageSymlinks(ctx context.Context, linkRo
 			continue
 		}
 
-		targetPath := share.MountPointData.Path
+		targetPath := share.ExportPath()
 		if !filepath.IsAbs(targetPath) {
 			slog.WarnContext(ctx, "Skipping media symlink recovery for non-absolute mount path", "share", share.Name, "target", targetPath)
 			continue
@@ -750,18 +907,38 @@ func (self *ServerService) recoverMediaUsageSymlinks(ctx context.Context, linkRo
 	return nil
 }
 
-func (self *ServerService) testSambaConfig(ctx context.Context) errors.E {
+// testSambaConfigFile validates the Samba configuration file at path.
+func (self *ServerService) testSambaConfigFile(ctx context.Context, path string) errors.E {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
-	tlog.TraceContext(ctx, "Testing Samba configuration file", "file", self.state.SambaConfigFile)
+	tlog.TraceContext(ctx, "Testing Samba configuration file", "file", path)
 
-	out, err := self.runCommandWithRunner(ctx, "samba-testparm", "Validate samba config", []string{"testparm", "-s", self.state.SambaConfigFile})
+	out, err := self.runCommandWithRunner(ctx, "samba-testparm", "Validate samba config", []string{"testparm", "-s", path})
 	if err != nil {
 		return errors.Errorf("Error executing testparm: %w \n %#v", err, map[string]any{"error": err, "output": out})
 	}
 	return nil
 }
 
+// serviceRestartAction tells what restartServerServices does to a managed
+// server, given its process status (nil when it is not running) and the
+// dirty data.
+func serviceRestartAction(processConfig serviceConfig, procStatus *dto.ProcessStatus, dirty dto.DataDirtyTracker) dto.ServiceRestartAction {
+	if procStatus == nil {
+		if len(processConfig.StartCommand) > 0 && osutil.CommandExists(processConfig.StartCommand) {
+			return dto.ServiceRestartActionStart
+		}
+		return dto.ServiceRestartActionNone
+	}
+	if procStatus.Pid <= 0 || dirty.AndMask(processConfig.HardResetServiceMask) {
+		return dto.ServiceRestartActionHard
+	}
+	if dirty.AndMask(processConfig.SoftResetServiceMask) {
+		return dto.ServiceRestartActionSoft
+	}
+	return dto.ServiceRestartActionNone
+}
+
 func (self *ServerService) restartServerServices(ctx context.Context, dirty dto.DataDirtyTracker) errors.E {
 	process, err := self.GetServerProcesses()
 	if err != nil {
@@ -778,34 +955,35 @@ func (self *ServerService) restartServerServices(ctx context.Context, dirty dto.
 				continue
 			}
 			tlog.TraceContext(ctx, "Restarting service", "service", processName)
-			if procStatus, ok := (*process)[processName]; ok {
-				if procStatus.Pid <= 0 || dirty.AndMask(processConfig.HardResetServiceMask) {
-					slog.InfoContext(ctx, "Performing hard restart of service...", "service", processName)
-					outHardRestart, restartErr := self.runCommandWithRunner(ctx, "service-hard-restart-"+processName, "Hard restart "+processName, processConfig.HardResetCommand)
-					if restartErr != nil {
-						return errors.Errorf("Error performing hard restart of service %s: %w \n %#v", processName, restartErr, map[string]any{"error": restartErr, "output": outHardRestart})
-					}
-				} else if dirty.AndMask(processConfig.SoftResetServiceMask) {
-					slog.InfoContext(ctx, "Performing soft restart of service...", "service", processName)
-					outSoftRestart, restartErr := self.runCommandWithRunner(ctx, "service-soft-restart-"+processName, "Soft restart "+processName, processConfig.SoftResetCommand)
-					if restartErr != nil {
-						return errors.Errorf("Error performing soft restart of service %s: %w \n %#v", processName, restartErr, map[string]any{"error": restartErr, "output": outSoftRestart})
-					}
-				} else {
-					slog.InfoContext(ctx, "No restart needed for service.", "service", processName)
-				}
-			} else {
+			procStatus := (*process)[processName]
+			if procStatus == nil {
 				slog.InfoContext(ctx, "Managed service not running yet; starting if configured", "service", processName)
-				if len(processConfig.StartCommand) > 0 && osutil.CommandExists(processConfig.StartCommand) {
-					slog.InfoContext(ctx, "Starting service...", "service", processName)
-					outStart, startErr := self.runCommandWithRunner(ctx, "service-start-"+processName, "Start "+processName, processConfig.StartCommand)
-					if startErr != nil {
-						return errors.Errorf("Error starting service %s: %w \n %#v", processName, startErr, map[string]any{"error": startErr, "output": outStart})
-					}
-				} else {
+			}
+			switch serviceRestartAction(processConfig, procStatus, dirty) {
+			case dto.ServiceRestartActionHard:
+				slog.InfoContext(ctx, "Performing hard restart of service...", "service", processName)
+				outHardRestart, restartErr := self.runCommandWithRunner(ctx, "service-hard-restart-"+processName, "Hard restart "+processName, processConfig.HardResetCommand)
+				if restartErr != nil {
+					return errors.Errorf("Error performing hard restart of service %s: %w \n %#v", processName, restartErr, map[string]any{"error": restartErr, "output": outHardRestart})
+				}
+			case dto.ServiceRestartActionSoft:
+				slog.InfoContext(ctx, "Performing soft restart of service...", "service", processName)
+				outSoftRestart, restartErr := self.runCommandWithRunner(ctx, "service-soft-restart-"+processName, "Soft restart "+processName, processConfig.SoftResetCommand)
+				if restartErr != nil {
+					return errors.Errorf("Error performing soft restart of service %s: %w \n %#v", processName, restartErr, map[string]any{"error": restartErr, "output": outSoftRestart})
+				}
+			case dto.ServiceRestartActionStart:
+				slog.InfoContext(ctx, "Starting service...", "service", processName)
+				outStart, startErr := self.runCommandWithRunner(ctx, "service-start-"+processName, "Start "+processName, processConfig.StartCommand)
+				if startErr != nil {
+					return errors.Errorf("Error starting service %s: %w \n %#v", processName, startErr, map[string]any{"error": startErr, "output": outStart})
+				}
+			default:
+				if procStatus == nil {
 					slog.InfoContext(ctx, "No start command defined for service or command does not exist, skipping.", "service", processName)
+				} else {
+					slog.InfoContext(ctx, "No restart needed for service.", "service", processName)
 				}
-				continue
 			}
 		}
 
@@ -819,48 +997,30 @@ func (self *ServerService) restartServerServices(ctx context.Context, dirty dto.
 	return nil
 }
 
-// WriteSambaConfig Test and Restart
+// writeConfigsAndRestartServers generates the configuration files and
+// applies them with applyConfigFiles, which restores the previous files when
+// the servers don't come back.
 func (self *ServerService) writeConfigsAndRestartServers(ctx context.Context, dirty dto.DataDirtyTracker) errors.E {
-	err := self.writeSambaConfig(ctx)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	err = self.writeSambaUsersMapConfig(ctx)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	err = self.testSambaConfig(ctx)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	if setting, err2 := self.setting_service.Load(); err2 == nil && setting.HAUseNFS != nil && *setting.HAUseNFS {
-		err = self.writeNFSConfig(ctx)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-	}
-	err = self.restartServerServices(ctx, dirty)
+	files, err := self.generateConfigFiles(ctx)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	return nil
+	return self.applyConfigFiles(ctx, files, dirty, 0)
 }
 
-// writeNFSConfig writes the NFS exports configuration to /etc/exports
-func (self *ServerService) writeNFSConfig(ctx context.Context) errors.E {
-	nfsExportsFile := "/etc/exports"
-	tlog.TraceContext(ctx, "Writing NFS exports configuration file", "file", nfsExportsFile)
+// createNFSExportsStream generates the NFS exports configuration
+func (self *ServerService) createNFSExportsStream(ctx context.Context) (*[]byte, errors.E) {
+	tlog.TraceContext(ctx, "Generating NFS exports configuration file", "file", nfsExportsFile)
 
 	hostname, err := self.host_service.GetHostName()
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
 	// Get all shares from the database
 	shares, err := self.share_service.ListShares()
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
 	// Build NFS exports content
@@ -899,8 +1059,8 @@ func (self *ServerService) writeNFSConfig(ctx context.Context) errors.E {
 			continue
 		}
 
-		// Get the share path from mount point data
-		path := share.MountPointData.Path
+		// Get the exported directory: the mount point or a sub path of it
+		path := share.ExportPath()
 		if path == "" {
 			tlog.WarnContext(ctx, "Skipping share with empty path", "name", share.Name)
 			continue
@@ -936,13 +1096,8 @@ func (self *ServerService) writeNFSConfig(ctx context.Context) errors.E {
 
 	slog.InfoContext(ctx, "Generated NFS exports configuration", "exportCount", exportCount)
 
-	// Write the exports file
-	err2 := os.WriteFile(nfsExportsFile, []byte(exportsContent.String()), 0o644)
-	if err2 != nil {
-		return errors.WithStack(err2)
-	}
-
-	return nil
+	data := []byte(exportsContent.String())
+	return &data, nil
 }
 
 func (self *ServerService) SetState(state *dto.ContextState) {
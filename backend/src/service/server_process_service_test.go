@@ -8,6 +8,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"slices"
@@ -15,6 +16,7 @@ import (
 	"sync"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/dianlight/srat/converter"
@@ -1001,6 +1003,286 @@ func (suite *ServerProcessServiceSuite) TestCreateConfigStream_Samba421_QUICEnab
 	suite.Contains(configStr, "WARNING: SMB over QUIC requires Samba 4.23.0+", "Samba 4.21 should emit version warning when QUIC is requested")
 }
 
+// TestCreateConfigStream_ShareSecurityOptions tests that per-share encryption,
+// signing and protocol floor are rendered, using the Samba 4.15 parameter name.
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_ShareSecurityOptions() {
+	defer unixsamba.MockSambaVersion("4.23.0")()
+	suite.setupSettingsMocks()
+
+	mock.When(suite.share_service.ListShares()).ThenReturn([]dto.SharedResource{
+		{
+			Name:           "FINANCE",
+			MountPointData: &dto.MountPointData{Path: "mnt/finance"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			SmbEncrypt:     dto.SmbEncryptRequired,
+			SmbSigning:     dto.SmbSigningMandatory,
+			SmbMinProtocol: dto.SmbProtocolSMB3_02,
+		},
+		{
+			Name:           "MEDIA",
+			MountPointData: &dto.MountPointData{Path: "mnt/media"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			SmbEncrypt:     dto.SmbEncryptDefault,
+		},
+	}, nil)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Contains(configStr, "server signing = mandatory", "a mandatory-signing share raises the global signing")
+	suite.Contains(configStr, "server smb encrypt = required")
+	suite.Contains(configStr, "root preexec = /bin/sh -c 'case %R in SMB3_02|SMB3_11) exit 0;; esac; exit 1'")
+	suite.Contains(configStr, "root preexec close = yes")
+	suite.Equal(1, strings.Count(configStr, "smb encrypt = "), "the default share must not render an encryption line")
+}
+
+// TestCreateConfigStream_ShareSecurityOptionsLegacyName tests that Samba
+// releases older than 4.15 get the legacy `smb encrypt` parameter.
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_ShareSecurityOptionsLegacyName() {
+	defer unixsamba.MockSambaVersion("4.14.0")()
+	suite.setupSettingsMocks()
+
+	mock.When(suite.share_service.ListShares()).ThenReturn([]dto.SharedResource{
+		{
+			Name:           "FINANCE",
+			MountPointData: &dto.MountPointData{Path: "mnt/finance"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			SmbEncrypt:     dto.SmbEncryptDesired,
+		},
+	}, nil)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Contains(configStr, "\n   smb encrypt = desired")
+	suite.NotContains(configStr, "server smb encrypt")
+	suite.Contains(configStr, "server signing = auto")
+	suite.NotContains(configStr, "root preexec")
+}
+
+// TestCreateConfigStream_ShareGroups tests that group grants are rendered as
+// @group principals and that read-only groups land in the read list.
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_ShareGroups() {
+	suite.setupSettingsMocks()
+
+	mock.When(suite.share_service.ListShares()).ThenReturn([]dto.SharedResource{
+		{
+			Name:           "PHOTOS",
+			MountPointData: &dto.MountPointData{Path: "mnt/photos"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			Groups:         []string{"family"},
+			RoGroups:       []string{"guests"},
+		},
+	}, nil)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Contains(configStr, "valid users =_ha_mount_user_ dianlight  @family @guests")
+	suite.Contains(configStr, "read list =  @guests")
+}
+
+// TestCreateConfigStream_SharePermissions tests that owner, group and modes
+// replace the root defaults and that inherited ACLs drop the forced modes.
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_SharePermissions() {
+	suite.setupSettingsMocks()
+
+	mock.When(suite.share_service.ListShares()).ThenReturn([]dto.SharedResource{
+		{
+			Name:           "FAMILY",
+			MountPointData: &dto.MountPointData{Path: "mnt/family"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			Permissions: &dto.SharePermissions{
+				Owner:    "dianlight",
+				Group:    "family",
+				FileMode: "0660",
+				DirMode:  "0770",
+			},
+		},
+		{
+			Name:           "PROJECTS",
+			MountPointData: &dto.MountPointData{Path: "mnt/projects"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			Permissions:    &dto.SharePermissions{InheritAcls: true},
+		},
+	}, nil)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Contains(configStr, "create mask = 0660\n   force create mode = 0660\n   directory mask = 0770\n   force directory mode = 0770")
+	suite.Contains(configStr, "force user = dianlight\n   force group = family")
+	suite.Contains(configStr, "create mask = 0664\n   directory mask = 0775\n")
+	suite.Contains(configStr, "inherit acls = yes")
+	suite.Equal(1, strings.Count(configStr, "force create mode"), "inherited ACLs must not force the modes")
+}
+
+// TestCreateConfigStream_ShareSnapshots tests that shadow copies are rendered
+// for btrfs and zfs shares of a whole volume only, with the snapshot directory
+// of each filesystem.
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_ShareSnapshots() {
+	suite.setupSettingsMocks()
+
+	btrfs, zfs, ext4 := "btrfs", "zfs", "ext4"
+	mock.When(suite.share_service.ListShares()).ThenReturn([]dto.SharedResource{
+		{
+			Name:           "PHOTOS",
+			MountPointData: &dto.MountPointData{Path: "mnt/photos", FSType: &btrfs},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			Snapshots:      &dto.SnapshotPolicy{ShadowCopy: true, KeepDaily: 7},
+		},
+		{
+			Name:           "ARCHIVE",
+			MountPointData: &dto.MountPointData{Path: "mnt/archive", FSType: &zfs},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			Snapshots:      &dto.SnapshotPolicy{ShadowCopy: true},
+		},
+		{
+			Name:           "MUSIC",
+			MountPointData: &dto.MountPointData{Path: "mnt/music", FSType: &ext4},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			Snapshots:      &dto.SnapshotPolicy{ShadowCopy: true},
+		},
+		{
+			Name:           "SCANS",
+			MountPointData: &dto.MountPointData{Path: "mnt/archive", FSType: &zfs},
+			SubPath:        "scans",
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			Snapshots:      &dto.SnapshotPolicy{ShadowCopy: true},
+		},
+	}, nil)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Contains(configStr, "shadow:snapdir = .snapshots\n")
+	suite.Contains(configStr, "shadow:snapdir = .zfs/snapshot\n")
+	suite.Contains(configStr, "shadow:format = GMT-%Y.%m.%d-%H.%M.%S")
+	suite.Equal(2, strings.Count(configStr, " shadow_copy2\n"), "ext4 has no snapshots, a sub path has none of its own")
+	suite.Equal(2, strings.Count(configStr, "shadow:localtime = no"))
+	suite.Equal(1, strings.Count(configStr, "veto files = /.snapshots/\n"), "the btrfs snapshots are hidden")
+	suite.NotContains(configStr, "delete veto files")
+}
+
+// TestCreateConfigStream_RecycleBinExclude tests that the exclude patterns of
+// the recycle bin policy are rendered as a single vfs_recycle list.
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_RecycleBinExclude() {
+	suite.setupSettingsMocks()
+
+	enabled := true
+	mock.When(suite.share_service.ListShares()).ThenReturn([]dto.SharedResource{
+		{
+			Name:             "DOCS",
+			MountPointData:   &dto.MountPointData{Path: "mnt/docs"},
+			Users:            []dto.User{{Username: "dianlight", IsAdmin: true}},
+			RecycleBin:       &enabled,
+			RecycleBinPolicy: &dto.RecycleBinPolicy{MaxAgeDays: 30, Exclude: []string{"*.tmp", "~$*"}},
+		},
+		{
+			Name:           "MUSIC",
+			MountPointData: &dto.MountPointData{Path: "mnt/music"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			RecycleBin:     &enabled,
+		},
+	}, nil)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Equal(2, strings.Count(configStr, "recycle:repository = .recycle/%U"))
+	suite.Contains(configStr, "recycle:exclude = *.tmp|~$*\n")
+	suite.Equal(1, strings.Count(configStr, "recycle:exclude = "), "shares without a policy keep the default")
+}
+
+// TestCreateConfigStream_SubPath tests that a share exporting a sub path of
+// a volume points Samba to that directory.
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_SubPath() {
+	suite.setupSettingsMocks()
+
+	mock.When(suite.share_service.ListShares()).ThenReturn([]dto.SharedResource{
+		{
+			Name:           "DATA",
+			MountPointData: &dto.MountPointData{Path: "mnt/data"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+		},
+		{
+			Name:           "PHOTOS",
+			MountPointData: &dto.MountPointData{Path: "mnt/data"},
+			SubPath:        "photos/2024",
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+		},
+	}, nil)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Contains(configStr, "path = mnt/data\n")
+	suite.Contains(configStr, "path = mnt/data/photos/2024\n")
+}
+
+// TestPreviewConfig tests that the preview diffs the pending smb.conf against
+// the file on disk without touching it.
+func (suite *ServerProcessServiceSuite) TestPreviewConfig() {
+	suite.setupSettingsMocks()
+	suite.setupSharesMocks()
+	suite.state.SambaConfigFile = filepath.Join(suite.T().TempDir(), "smb.conf")
+	suite.Require().NoError(os.WriteFile(suite.state.SambaConfigFile, []byte("[global]\n   workgroup = OLD\n"), 0o600))
+
+	preview, errE := suite.serverService.PreviewConfig(suite.ctx)
+	suite.Require().NoError(errE)
+	suite.Require().NotEmpty(preview.Files)
+
+	smbConf := preview.Files[0]
+	suite.Equal(suite.state.SambaConfigFile, smbConf.Path)
+	suite.True(smbConf.Changed)
+	suite.Contains(smbConf.Diff, "-   workgroup = OLD\n")
+	suite.Contains(smbConf.Diff, "+   workgroup = WORKGROUP\n")
+	suite.True(preview.Valid)
+
+	data, err := os.ReadFile(suite.state.SambaConfigFile)
+	suite.Require().NoError(err)
+	suite.Equal("[global]\n   workgroup = OLD\n", string(data), "the preview must not write")
+	entries, err := os.ReadDir(filepath.Dir(suite.state.SambaConfigFile))
+	suite.Require().NoError(err)
+	suite.Len(entries, 1, "the staged file is removed")
+}
+
+// TestCreateConfigStream_Homes tests that the [homes] share is rendered only
+// when home directories are enabled on a volume.
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_Homes() {
+	mock.When(suite.setting_service.Load()).ThenReturn(&dto.Settings{
+		Hostname:     "test-host",
+		Workgroup:    "WORKGROUP",
+		LocalMaster:  new(true),
+		HomesEnabled: new(true),
+		HomesVolume:  "/mnt/data",
+	}, nil)
+	mock.When(suite.share_service.ListShares()).ThenReturn([]dto.SharedResource{}, nil)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Contains(configStr, "[homes]\n")
+	suite.Contains(configStr, "path = /mnt/data/homes/%S\n")
+	suite.Contains(configStr, "valid users = %S\n")
+}
+
 // TestGetSambaProcess_ReturnsProcessStatus tests that GetSambaProcess returns process status
 func (suite *ServerProcessServiceSuite) TestGetSambaProcess_ReturnsProcessStatus() {
 	// GetSambaProcess should return a non-nil SambaProcessStatus
@@ -1233,3 +1515,75 @@ func (suite *ResolveInterfaceIPv4sSuite) TestResolveInterfaceIPv4s_LinkLocalFilt
 	suite.Contains(result, "192.168.1.10")
 	suite.NotContains(result, "169.254.1.1", "link-local addresses should be filtered")
 }
+
+// TestCreateConfigStream_Audit tests that an audited share loads
+// vfs_full_audit with the default operations and that its log goes to the
+// collected file.
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_Audit() {
+	suite.setupSettingsMocks()
+
+	mock.When(suite.share_service.ListShares()).ThenReturn([]dto.SharedResource{
+		{
+			Name:           "AUDITED",
+			MountPointData: &dto.MountPointData{Path: "mnt/audited"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			Audit:          &dto.ShareAudit{Enabled: true},
+		},
+		{
+			Name:           "PLAIN",
+			MountPointData: &dto.MountPointData{Path: "mnt/plain"},
+			Users:          []dto.User{{Username: "dianlight", IsAdmin: true}},
+			Audit:          &dto.ShareAudit{Enabled: false, Operations: []string{"pwrite"}},
+		},
+	}, nil)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Regexp(`log level = .* full_audit:1@/var/log/samba/audit.log\n`, configStr)
+	suite.Contains(configStr, "vfs objects = full_audit acl_xattr")
+	suite.Equal(1, strings.Count(configStr, "full_audit:prefix = srat-audit|%u|%I|%S\n"))
+	suite.Contains(configStr, "full_audit:success = mkdirat renameat unlinkat\n")
+	suite.Contains(configStr, "full_audit:failure = none\n")
+	suite.NotContains(configStr, "full_audit:success = pwrite")
+}
+
+func (suite *ServerProcessServiceSuite) TestCreateConfigStream_Bans() {
+	mock.When(suite.setting_service.Load()).ThenReturn(&dto.Settings{
+		Hostname:            "test-host",
+		Workgroup:           "WORKGROUP",
+		AllowHost:           []string{"10.0.0.0/8", "192.168.0.0/16"},
+		BindAllInterfaces:   true,
+		LocalMaster:         new(true),
+		HAUseNFS:            new(true),
+		AllowGuest:          new(false),
+		IntrusionProtection: new(true),
+	}, nil)
+	suite.setupSharesMocks()
+
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.ClientBan{}).Error)
+	defer suite.db.Where("1 = 1").Delete(&dbom.ClientBan{})
+	suite.Require().NoError(suite.db.Create(&[]dbom.ClientBan{
+		{IP: "192.168.1.66", ExpiresAt: time.Now().Add(time.Hour)},
+		{IP: "10.0.0.9", ExpiresAt: time.Now().Add(2 * time.Hour)},
+		{IP: "192.168.1.70", ExpiresAt: time.Now().Add(-time.Minute)},
+	}).Error)
+
+	stream, errE := suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Require().NotNil(stream)
+
+	configStr := string(*stream)
+	suite.Regexp(`log level = .* auth_audit:2@/var/log/samba/auth.log\n`, configStr)
+	suite.Regexp(`hosts allow = 127\.0\.0\.1 10\.0\.0\.0/8 192\.168\.0\.0/16 .*EXCEPT 10\.0\.0\.9 192\.168\.1\.66\n`, configStr)
+
+	suite.NotContains(configStr, "include = ", "no fragment without a smb.conf path")
+
+	suite.state.SambaConfigFile = "/etc/samba/smb.conf"
+	defer func() { suite.state.SambaConfigFile = "" }()
+	stream, errE = suite.serverService.CreateSambaConfigStream()
+	suite.Require().NoError(errE)
+	suite.Regexp(`EXCEPT 10\.0\.0\.9 192\.168\.1\.66\n   include = /etc/samba/smb\.hosts\.conf\n`, string(*stream))
+}
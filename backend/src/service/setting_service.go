@@ -141,11 +141,14 @@ func (self *settingService) ValidateSettings(setting *dto.Settings) {
 }
 
 func (self *settingService) UpdateSettings(setting *dto.Settings) errors.E {
-	if setting != nil && setting.HASmbPassword.Expose() == "" {
+	if setting != nil && (setting.HASmbPassword.Expose() == "" || setting.MQTTPassword.Expose() == "") {
 		existing, err := self.Load()
-		if err == nil && existing.HASmbPassword.Expose() != "" {
+		if err == nil && setting.HASmbPassword.Expose() == "" && existing.HASmbPassword.Expose() != "" {
 			setting.HASmbPassword = existing.HASmbPassword
 		}
+		if err == nil && setting.MQTTPassword.Expose() == "" {
+			setting.MQTTPassword = existing.MQTTPassword
+		}
 	}
 	errS := self.db.Transaction(func(tx *gorm.DB) error {
 		// Validate settings before saving
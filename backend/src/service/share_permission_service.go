@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+)
+
+// SharePermissionRepairCommandID identifies repair executions in the
+// command_output websocket events.
+const SharePermissionRepairCommandID = "share_permissions_repair"
+
+// repairScript walks the share once per step so chown/chmod -c print one line
+// per changed entry, which is the progress reported to the client.
+// Positional arguments: $1 path, $2 owner:group, $3 dir mode, $4 file mode.
+const repairScript = `chown -R -c "$2" "$1" && ` +
+	`find "$1" -type d -exec chmod -c "$3" {} + && ` +
+	`find "$1" -type f -exec chmod -c "$4" {} +`
+
+type SharePermissionServiceInterface interface {
+	// ApplyRootPermissions sets owner, group and directory mode of the share
+	// root only. It is a no-op for shares without permissions.
+	ApplyRootPermissions(share dto.SharedResource) errors.E
+	// RepairPermissions starts a recursive repair of the share tree and returns
+	// the snapshot of the started execution.
+	RepairPermissions(name string) (*dto.CommandExecutionSnapshot, errors.E)
+}
+
+type SharePermissionService struct {
+	ctx          context.Context
+	shareService ShareServiceInterface
+	executor     commandexec.Executor
+
+	mu      sync.Mutex
+	running map[string]string // share name -> execution id
+}
+
+type SharePermissionServiceParams struct {
+	fx.In
+	Ctx          context.Context
+	ShareService ShareServiceInterface
+	Executor     commandexec.Executor
+	EventBus     events.EventBusInterface
+}
+
+// lookupOwnership resolves the numeric ids of a unix owner and group.
+func lookupOwnership(owner, group string) (int, int, error) {
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return -1, -1, err
+	}
+	gr, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, -1, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return -1, -1, err
+	}
+	gid, err := strconv.Atoi(gr.Gid)
+	if err != nil {
+		return -1, -1, err
+	}
+	return uid, gid, nil
+}
+
+func NewSharePermissionService(lc fx.Lifecycle, in SharePermissionServiceParams) SharePermissionServiceInterface {
+	s := &SharePermissionService{
+		ctx:          in.Ctx,
+		shareService: in.ShareService,
+		executor:     in.Executor,
+		running:      make(map[string]string),
+	}
+	unsubscribe := in.EventBus.OnShare(func(ctx context.Context, event events.ShareEvent) errors.E {
+		if event.Share == nil || (event.Type != events.EventTypes.ADD && event.Type != events.EventTypes.UPDATE) {
+			return nil
+		}
+		if err := s.ApplyRootPermissions(*event.Share); err != nil {
+			slog.WarnContext(ctx, "Unable to apply share root permissions", "share", event.Share.Name, "err", err)
+		}
+		return nil
+	})
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			unsubscribe()
+			return nil
+		},
+	})
+	return s
+}
+
+// sharePath returns the share root when the share can safely be changed.
+func sharePath(share dto.SharedResource) (string, errors.E) {
+	if share.Usage == dto.UsageAsInternal {
+		return "", errors.Errorf("%w: permissions of internal share %s are managed by Home Assistant", dto.ErrorShareValidation, share.Name)
+	}
+	if share.MountPointData == nil || share.MountPointData.Path == "" || !share.MountPointData.IsMounted {
+		return "", errors.WithDetails(dto.ErrorInvalidStateForOperation, "share", share.Name, "reason", "share path is not mounted")
+	}
+	return share.ExportPath(), nil
+}
+
+func (s *SharePermissionService) ApplyRootPermissions(share dto.SharedResource) errors.E {
+	if share.Permissions == nil || share.Usage == dto.UsageAsInternal ||
+		share.MountPointData == nil || !share.MountPointData.IsMounted {
+		return nil
+	}
+	path := share.ExportPath()
+	perm := share.Permissions
+	uid, gid, err := lookupOwnership(perm.EffectiveOwner(), perm.EffectiveGroup())
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve %s:%s", perm.EffectiveOwner(), perm.EffectiveGroup())
+	}
+	mode, err := strconv.ParseUint(perm.EffectiveDirMode(), 8, 32)
+	if err != nil {
+		return errors.Wrapf(err, "invalid directory mode %s", perm.EffectiveDirMode())
+	}
+	if err := os.Chown(path, uid, gid); err != nil {
+		return errors.Wrapf(err, "failed to chown %s", path)
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		return errors.Wrapf(err, "failed to chmod %s", path)
+	}
+	return nil
+}
+
+func (s *SharePermissionService) RepairPermissions(name string) (*dto.CommandExecutionSnapshot, errors.E) {
+	share, errE := s.shareService.GetShare(name)
+	if errE != nil {
+		return nil, errE
+	}
+	path, errE := sharePath(*share)
+	if errE != nil {
+		return nil, errE
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if executionID, ok := s.running[share.Name]; ok {
+		if snapshot, found := s.executor.GetSnapshot(executionID); found && snapshot.Running {
+			return nil, errors.WithDetails(dto.ErrorConflict, "share", share.Name, "execution_id", executionID)
+		}
+		delete(s.running, share.Name)
+	}
+
+	perm := share.Permissions
+	executionID, err := s.executor.Start(s.ctx, SharePermissionRepairCommandID,
+		"Repair permissions of "+share.Name,
+		"sh", "-c", repairScript, "sh",
+		path,
+		perm.EffectiveOwner()+":"+perm.EffectiveGroup(),
+		perm.EffectiveDirMode(),
+		perm.EffectiveFileMode(),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to start permission repair of %s", share.Name)
+	}
+	s.running[share.Name] = executionID
+
+	snapshot, ok := s.executor.GetSnapshot(executionID)
+	if !ok {
+		snapshot = dto.CommandExecutionSnapshot{ExecutionID: executionID, CommandID: SharePermissionRepairCommandID, Running: true}
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type SharePermissionServiceSuite struct {
+	suite.Suite
+	app               *fxtest.App
+	shareService      ShareServiceInterface
+	executor          commandexec.Executor
+	permissionService SharePermissionServiceInterface
+	owner             string
+	group             string
+}
+
+func TestSharePermissionServiceSuite(t *testing.T) {
+	suite.Run(t, new(SharePermissionServiceSuite))
+}
+
+func (suite *SharePermissionServiceSuite) SetupTest() {
+	current, err := user.Current()
+	suite.Require().NoError(err)
+	primary, err := user.LookupGroupId(current.Gid)
+	suite.Require().NoError(err)
+	suite.owner = current.Username
+	suite.group = primary.Name
+
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			events.NewEventBus,
+			commandexec.NewCommandExecutor,
+			mock.Mock[ShareServiceInterface],
+			NewSharePermissionService,
+		),
+		fx.Populate(&suite.shareService),
+		fx.Populate(&suite.executor),
+		fx.Populate(&suite.permissionService),
+	)
+	suite.app.RequireStart()
+}
+
+func (suite *SharePermissionServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+func (suite *SharePermissionServiceSuite) share(path string) *dto.SharedResource {
+	return &dto.SharedResource{
+		Name: "data",
+		MountPointData: &dto.MountPointData{
+			Path:      path,
+			IsMounted: true,
+		},
+		Permissions: &dto.SharePermissions{
+			Owner:    suite.owner,
+			Group:    suite.group,
+			FileMode: "0640",
+			DirMode:  "0750",
+		},
+	}
+}
+
+func (suite *SharePermissionServiceSuite) TestRepairPermissions_Recursive() {
+	root := suite.T().TempDir()
+	sub := filepath.Join(root, "sub")
+	suite.Require().NoError(os.Mkdir(sub, 0700))
+	file := filepath.Join(sub, "file.txt")
+	suite.Require().NoError(os.WriteFile(file, []byte("x"), 0600))
+	mock.When(suite.shareService.GetShare("data")).ThenReturn(suite.share(root), nil)
+
+	started, err := suite.permissionService.RepairPermissions("data")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(started)
+	suite.Equal(SharePermissionRepairCommandID, started.CommandID)
+
+	deadline := time.Now().Add(10 * time.Second)
+	var snapshot dto.CommandExecutionSnapshot
+	for time.Now().Before(deadline) {
+		snapshot, _ = suite.executor.GetSnapshot(started.ExecutionID)
+		if !snapshot.Running {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	suite.Require().False(snapshot.Running, "repair did not complete")
+	suite.Require().True(snapshot.Success, "repair failed: %s %v", snapshot.Error, snapshot.Lines)
+
+	info, statErr := os.Stat(sub)
+	suite.Require().NoError(statErr)
+	suite.Equal(os.FileMode(0750), info.Mode().Perm())
+	info, statErr = os.Stat(file)
+	suite.Require().NoError(statErr)
+	suite.Equal(os.FileMode(0640), info.Mode().Perm())
+	suite.NotEmpty(snapshot.Lines, "changed entries are reported as output lines")
+}
+
+func (suite *SharePermissionServiceSuite) TestRepairPermissions_InternalShare() {
+	share := suite.share(suite.T().TempDir())
+	share.Usage = dto.UsageAsInternal
+	mock.When(suite.shareService.GetShare("data")).ThenReturn(share, nil)
+
+	_, err := suite.permissionService.RepairPermissions("data")
+	suite.Require().ErrorIs(err, dto.ErrorShareValidation)
+}
+
+func (suite *SharePermissionServiceSuite) TestRepairPermissions_NotMounted() {
+	share := suite.share(suite.T().TempDir())
+	share.MountPointData.IsMounted = false
+	mock.When(suite.shareService.GetShare("data")).ThenReturn(share, nil)
+
+	_, err := suite.permissionService.RepairPermissions("data")
+	suite.Require().ErrorIs(err, dto.ErrorInvalidStateForOperation)
+}
+
+func (suite *SharePermissionServiceSuite) TestApplyRootPermissions_OnlyRoot() {
+	root := suite.T().TempDir()
+	child := filepath.Join(root, "child")
+	suite.Require().NoError(os.Mkdir(child, 0700))
+
+	err := suite.permissionService.ApplyRootPermissions(*suite.share(root))
+	suite.Require().NoError(err)
+
+	info, statErr := os.Stat(root)
+	suite.Require().NoError(statErr)
+	suite.Equal(os.FileMode(0750), info.Mode().Perm())
+	info, statErr = os.Stat(child)
+	suite.Require().NoError(statErr)
+	suite.Equal(os.FileMode(0700), info.Mode().Perm(), "children are left to the repair action")
+}
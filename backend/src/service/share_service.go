@@ -4,6 +4,10 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/dianlight/srat/converter"
@@ -11,10 +15,12 @@ import (
 	"github.com/dianlight/srat/dbom/g"
 	"github.com/dianlight/srat/dto"
 	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/unixsamba"
 	"github.com/dianlight/tlog"
 	"gitlab.com/tozd/go/errors"
 	"go.uber.org/fx"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var internalShares = map[string]dto.SharedResource{
@@ -136,25 +142,25 @@ func NewShareService(lc fx.Lifecycle, in ShareServiceParams) ShareServiceInterfa
 	}
 	unsubscribe := s.eventBus.OnMountPoint(func(ctx context.Context, event events.MountPointEvent) errors.E {
 		slog.InfoContext(ctx, "Received MountPointEvent", "type", event.Type, "mountpoint", event.MountPoint)
-		share, err := s.GetShareFromPath(event.MountPoint.Path)
+		// Every share of the volume follows its mount state, the ones
+		// exporting a sub path included.
+		shares, err := s.listSharesOnMountPoint(event.MountPoint.Path)
 		if err != nil {
-			if errors.Is(err, dto.ErrorShareNotFound) {
-				if ensureErr := s.ensureInternalShare(ctx, event.MountPoint.Path, event.MountPoint); ensureErr != nil {
-					return ensureErr
-				}
-				tlog.TraceContext(ctx, "No share found for mount point", "path", event.MountPoint.Path)
-				return nil
-			}
 			return err
 		}
-		if share == nil {
+		if len(shares) == 0 {
+			if ensureErr := s.ensureInternalShare(ctx, event.MountPoint.Path, event.MountPoint); ensureErr != nil {
+				return ensureErr
+			}
 			tlog.TraceContext(ctx, "No share found for mount point", "path", event.MountPoint.Path)
 			return nil
 		}
-		_ = s.eventBus.EmitShare(events.ShareEvent{
-			Event: events.Event{Type: events.EventTypes.UPDATE},
-			Share: share, // Let subscribers fetch the share if needed
-		})
+		for i := range shares {
+			_ = s.eventBus.EmitShare(events.ShareEvent{
+				Event: events.Event{Type: events.EventTypes.UPDATE},
+				Share: &shares[i], // Let subscribers fetch the share if needed
+			})
+		}
 		return nil
 	})
 
@@ -227,6 +233,8 @@ func (s *ShareService) ListShares() ([]dto.SharedResource, errors.E) {
 		Preload("MountPointData", nil).
 		Preload("Users", nil).
 		Preload("RoUsers", nil).
+		Preload("Groups", nil).
+		Preload("RoGroups", nil).
 		Find(s.ctx)
 	if err != nil {
 		return nil, errors.Errorf("failed to list shares from repository: %w", err)
@@ -256,6 +264,8 @@ func (s *ShareService) GetShare(name string) (*dto.SharedResource, errors.E) {
 		Preload("MountPointData", nil).
 		Preload("Users", nil).
 		Preload("RoUsers", nil).
+		Preload("Groups", nil).
+		Preload("RoGroups", nil).
 		Where(g.ExportedShare.Name.Eq(name)).First(s.ctx)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -296,6 +306,217 @@ func validateShareData(share dto.SharedResource, requireMountData bool) errors.E
 			return errors.WithStack(dto.ErrorShareValidation)
 		}
 	}
+	if share.SubPath != "" {
+		if share.Usage == dto.UsageAsInternal {
+			return errors.Errorf("%w: internal share %s cannot export a sub path", dto.ErrorShareValidation, share.Name)
+		}
+		if !isValidSubPath(share.SubPath) {
+			return errors.Errorf("%w: sub_path %q must be a clean relative path inside the mount point", dto.ErrorShareValidation, share.SubPath)
+		}
+	}
+	return nil
+}
+
+// isValidSubPath accepts clean relative paths that stay below the mount
+// point. Control characters are refused as they would end the smb.conf line.
+func isValidSubPath(subPath string) bool {
+	return subPath != "." && filepath.IsLocal(subPath) && filepath.Clean(subPath) == subPath &&
+		!strings.ContainsFunc(subPath, func(r rune) bool { return r < ' ' || r == 0x7f })
+}
+
+// smbSecurityMinSamba lists the oldest Samba release able to honor a
+// per-share security option.
+var smbSecurityMinSamba = map[string][2]int{
+	"encrypt":                      {4, 1},
+	string(dto.SmbProtocolSMB3_00): {4, 0},
+	string(dto.SmbProtocolSMB3_02): {4, 1},
+	string(dto.SmbProtocolSMB3_11): {4, 3},
+}
+
+// validateShareSecurity checks the per-share encryption, signing and protocol
+// floor against each other and against the detected Samba version. An unknown
+// Samba version does not block the share: testparm still guards the config.
+func validateShareSecurity(share dto.SharedResource) errors.E {
+	if !share.SmbEncrypt.IsDefault() && !slices.Contains([]dto.SmbEncryptMode{
+		dto.SmbEncryptOff, dto.SmbEncryptIfRequired, dto.SmbEncryptDesired, dto.SmbEncryptRequired,
+	}, share.SmbEncrypt) {
+		return errors.Errorf("%w: unknown smb_encrypt value %q", dto.ErrorShareValidation, share.SmbEncrypt)
+	}
+	if !share.SmbSigning.IsDefault() && share.SmbSigning != dto.SmbSigningAuto && share.SmbSigning != dto.SmbSigningMandatory {
+		return errors.Errorf("%w: unknown smb_signing value %q", dto.ErrorShareValidation, share.SmbSigning)
+	}
+	if !share.SmbMinProtocol.IsDefault() && share.SmbMinProtocol.Rank() < 0 {
+		return errors.Errorf("%w: unknown smb_min_protocol value %q", dto.ErrorShareValidation, share.SmbMinProtocol)
+	}
+
+	// Encryption only exists from SMB3 on: a floor below it would let in
+	// clients that a required-encryption share always refuses.
+	if share.SmbEncrypt == dto.SmbEncryptRequired && !share.SmbMinProtocol.IsDefault() &&
+		share.SmbMinProtocol.Rank() < dto.SmbProtocolSMB3_00.Rank() {
+		return errors.Errorf("%w: smb_encrypt=required needs smb_min_protocol SMB3_00 or newer, got %s",
+			dto.ErrorShareValidation, share.SmbMinProtocol)
+	}
+
+	required := []string{}
+	if !share.SmbEncrypt.IsDefault() && share.SmbEncrypt != dto.SmbEncryptOff {
+		required = append(required, "encrypt")
+	}
+	if !share.SmbMinProtocol.IsDefault() {
+		required = append(required, string(share.SmbMinProtocol))
+	}
+	for _, feature := range required {
+		minVersion, ok := smbSecurityMinSamba[feature]
+		if !ok {
+			continue
+		}
+		supported, err := unixsamba.IsSambaVersionAtLeast(minVersion[0], minVersion[1])
+		if err != nil {
+			slog.Debug("Unable to detect Samba version, skipping share security check", "share", share.Name, "err", err)
+			return nil
+		}
+		if !supported {
+			version, _ := unixsamba.GetSambaVersion()
+			if version == "" {
+				return nil
+			}
+			return errors.Errorf("%w: %s requires Samba >= %d.%d (found %s)",
+				dto.ErrorShareValidation, feature, minVersion[0], minVersion[1], version)
+		}
+	}
+	return nil
+}
+
+// validateShareGroups makes sure every `@group` principal of the share refers
+// to an existing group, so that saving the share never creates empty groups.
+func (s *ShareService) validateShareGroups(share dto.SharedResource) errors.E {
+	names := slices.Concat(share.Groups, share.RoGroups)
+	if len(names) == 0 {
+		return nil
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+	count, err := gorm.G[dbom.SambaGroup](s.db).Where(g.SambaGroup.Name.In(names...)).Count(s.ctx, "*")
+	if err != nil {
+		return errors.Wrap(err, "failed to check share groups")
+	}
+	if int(count) != len(names) {
+		return errors.Errorf("%w: unknown group in %v", dto.ErrorShareValidation, names)
+	}
+	return nil
+}
+
+// validateSharePermissions checks that the modes are octal and that owner and
+// group are root or entities managed by SRAT, so Samba can resolve them.
+func (s *ShareService) validateSharePermissions(share dto.SharedResource) errors.E {
+	perm := share.Permissions
+	if perm == nil {
+		return nil
+	}
+	for _, mode := range []string{perm.FileMode, perm.DirMode} {
+		if mode == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(mode, 8, 32); err != nil || len(mode) > 4 {
+			return errors.Errorf("%w: invalid mode %q", dto.ErrorShareValidation, mode)
+		}
+	}
+	if perm.Owner != "" && perm.Owner != dto.DefaultShareOwner {
+		count, err := gorm.G[dbom.SambaUser](s.db).Where(g.SambaUser.Username.Eq(perm.Owner)).Count(s.ctx, "*")
+		if err != nil {
+			return errors.Wrap(err, "failed to check share owner")
+		}
+		if count == 0 {
+			return errors.Errorf("%w: unknown owner %s", dto.ErrorShareValidation, perm.Owner)
+		}
+	}
+	if perm.Group != "" && perm.Group != dto.DefaultShareGroup {
+		count, err := gorm.G[dbom.SambaGroup](s.db).Where(g.SambaGroup.Name.Eq(perm.Group)).Count(s.ctx, "*")
+		if err != nil {
+			return errors.Wrap(err, "failed to check share group")
+		}
+		if count == 0 {
+			return errors.Errorf("%w: unknown group %s", dto.ErrorShareValidation, perm.Group)
+		}
+	}
+	return nil
+}
+
+// renameShareOwnership carries the rename of a user, or of a group when group
+// is set, over to the owner or group of the shares. An empty newName resets
+// them to the default, so that no share forces an account that no longer
+// exists.
+func renameShareOwnership(ctx context.Context, tx *gorm.DB, group bool, oldName, newName string) error {
+	var shares []dbom.ExportedShare
+	if err := tx.WithContext(ctx).Unscoped().Select("name", "permissions").Where("permissions IS NOT NULL").Find(&shares).Error; err != nil {
+		return errors.Wrap(err, "failed to load share permissions")
+	}
+	for _, share := range shares {
+		perm := share.Permissions
+		switch {
+		case perm == nil:
+			continue
+		case group && perm.Group == oldName:
+			perm.Group = newName
+		case !group && perm.Owner == oldName:
+			perm.Owner = newName
+		default:
+			continue
+		}
+		err := tx.WithContext(ctx).Unscoped().Model(&dbom.ExportedShare{Name: share.Name}).
+			Select("Permissions").Updates(&dbom.ExportedShare{Permissions: perm}).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to update the permissions of share %s", share.Name)
+		}
+	}
+	return nil
+}
+
+// validateShareQuotas makes sure every user quota refers to a single, known user.
+func (s *ShareService) validateShareQuotas(share dto.SharedResource) errors.E {
+	if len(share.UserQuotas) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(share.UserQuotas))
+	for _, quota := range share.UserQuotas {
+		if slices.Contains(names, quota.Username) {
+			return errors.Errorf("%w: duplicate quota for user %s", dto.ErrorShareValidation, quota.Username)
+		}
+		names = append(names, quota.Username)
+	}
+	count, err := gorm.G[dbom.SambaUser](s.db).Where(g.SambaUser.Username.In(names...)).Count(s.ctx, "*")
+	if err != nil {
+		return errors.Wrap(err, "failed to check quota users")
+	}
+	if int(count) != len(names) {
+		return errors.Errorf("%w: unknown user in quotas %v", dto.ErrorShareValidation, names)
+	}
+	return nil
+}
+
+// validateShareRecycleBin checks the exclude patterns of the recycle bin
+// policy: vfs_recycle takes them as one `|` separated list of file names.
+func validateShareRecycleBin(share dto.SharedResource) errors.E {
+	if share.RecycleBinPolicy == nil {
+		return nil
+	}
+	for _, pattern := range share.RecycleBinPolicy.Exclude {
+		if pattern == "" || strings.ContainsAny(pattern, "|/\n") {
+			return errors.Errorf("%w: invalid recycle bin exclude pattern %q", dto.ErrorShareValidation, pattern)
+		}
+	}
+	return nil
+}
+
+// validateShareAudit checks the operations logged by the audit of a share.
+func validateShareAudit(share dto.SharedResource) errors.E {
+	if share.Audit == nil {
+		return nil
+	}
+	for _, operation := range share.Audit.Operations {
+		if !slices.Contains(dto.AuditOperations, operation) {
+			return errors.Errorf("%w: unknown audit operation %q", dto.ErrorShareValidation, operation)
+		}
+	}
 	return nil
 }
 
@@ -303,6 +524,24 @@ func (s *ShareService) CreateShare(share dto.SharedResource) (*dto.SharedResourc
 	if err := validateShareData(share, true); err != nil {
 		return nil, err
 	}
+	if err := validateShareSecurity(share); err != nil {
+		return nil, err
+	}
+	if err := s.validateShareGroups(share); err != nil {
+		return nil, err
+	}
+	if err := s.validateSharePermissions(share); err != nil {
+		return nil, err
+	}
+	if err := s.validateShareQuotas(share); err != nil {
+		return nil, err
+	}
+	if err := validateShareRecycleBin(share); err != nil {
+		return nil, err
+	}
+	if err := validateShareAudit(share); err != nil {
+		return nil, err
+	}
 
 	check, err := gorm.G[dbom.ExportedShare](s.db).Scopes(dbom.IncludeSoftDeleted).Where("name = ? and deleted_at IS NOT NULL", share.Name).Update(s.ctx, "deleted_at", nil)
 	if err != nil {
@@ -359,11 +598,28 @@ func (s *ShareService) UpdateShare(name string, share dto.SharedResource) (*dto.
 	if err := validateShareData(share, false); err != nil {
 		return nil, err
 	}
+	if err := s.validateShareGroups(share); err != nil {
+		return nil, err
+	}
+	if err := s.validateSharePermissions(share); err != nil {
+		return nil, err
+	}
+	if err := s.validateShareQuotas(share); err != nil {
+		return nil, err
+	}
+	if err := validateShareRecycleBin(share); err != nil {
+		return nil, err
+	}
+	if err := validateShareAudit(share); err != nil {
+		return nil, err
+	}
 
 	dbShare, err := gorm.G[dbom.ExportedShare](s.db).
 		Preload("MountPointData", nil).
 		Preload("Users", nil).
 		Preload("RoUsers", nil).
+		Preload("Groups", nil).
+		Preload("RoGroups", nil).
 		Where(g.ExportedShare.Name.Eq(name)).First(s.ctx)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -379,6 +635,14 @@ func (s *ShareService) UpdateShare(name string, share dto.SharedResource) (*dto.
 		return nil, errors.Wrap(err, "failed to convert share")
 	}
 	updatedName := dbShare.Name
+	if err := validateShareSecurity(dto.SharedResource{
+		Name:           updatedName,
+		SmbEncrypt:     dbShare.SmbEncrypt,
+		SmbSigning:     dbShare.SmbSigning,
+		SmbMinProtocol: dbShare.SmbMinProtocol,
+	}); err != nil {
+		return nil, err
+	}
 	if dbShare.MountPointDataRoot != nil && *dbShare.MountPointDataRoot == "" {
 		dbShare.MountPointDataRoot = nil
 	}
@@ -419,9 +683,15 @@ func (s *ShareService) UpdateShare(name string, share dto.SharedResource) (*dto.
 		if err := tx.Model(&currentShare).Association("RoUsers").Clear(); err != nil {
 			return errors.Wrap(err, "failed to clear RoUsers associations during update")
 		}
+		if err := tx.Model(&currentShare).Association("Groups").Clear(); err != nil {
+			return errors.Wrap(err, "failed to clear Groups associations during update")
+		}
+		if err := tx.Model(&currentShare).Association("RoGroups").Clear(); err != nil {
+			return errors.Wrap(err, "failed to clear RoGroups associations during update")
+		}
 
 		if err := tx.Model(&currentShare).
-			Omit("Users", "RoUsers").
+			Omit("Users", "RoUsers", "Groups", "RoGroups").
 			Updates(&dbShare).Error; err != nil {
 			return err
 		}
@@ -437,6 +707,12 @@ func (s *ShareService) UpdateShare(name string, share dto.SharedResource) (*dto.
 		if err := tx.Model(&reloadedShare).Association("RoUsers").Replace(dbShare.RoUsers); err != nil {
 			return errors.Wrap(err, "failed to update RoUsers associations during update")
 		}
+		if err := tx.Model(&reloadedShare).Omit("Groups.*").Association("Groups").Replace(dbShare.Groups); err != nil {
+			return errors.Wrap(err, "failed to update Groups associations during update")
+		}
+		if err := tx.Model(&reloadedShare).Omit("RoGroups.*").Association("RoGroups").Replace(dbShare.RoGroups); err != nil {
+			return errors.Wrap(err, "failed to update RoGroups associations during update")
+		}
 
 		return nil
 	})
@@ -448,6 +724,8 @@ func (s *ShareService) UpdateShare(name string, share dto.SharedResource) (*dto.
 		Preload("MountPointData", nil).
 		Preload("Users", nil).
 		Preload("RoUsers", nil).
+		Preload("Groups", nil).
+		Preload("RoGroups", nil).
 		Where(g.ExportedShare.Name.Eq(updatedName)).First(s.ctx)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to load updated share '%s'", updatedName)
@@ -487,6 +765,8 @@ func (s *ShareService) DeleteShare(name string) errors.E {
 	if err := s.db.WithContext(s.ctx).
 		Preload("Users").
 		Preload("RoUsers").
+		Preload("Groups").
+		Preload("RoGroups").
 		Where("name = ?", name).First(&dbShare).Error; err != nil {
 		return errors.Wrap(err, "failed to retrieve share for deletion")
 	}
@@ -498,6 +778,12 @@ func (s *ShareService) DeleteShare(name string) errors.E {
 	if err := s.db.WithContext(s.ctx).Model(&dbShare).Association("RoUsers").Clear(); err != nil {
 		return errors.Wrap(err, "failed to clear RoUsers associations")
 	}
+	if err := s.db.WithContext(s.ctx).Model(&dbShare).Association("Groups").Clear(); err != nil {
+		return errors.Wrap(err, "failed to clear Groups associations")
+	}
+	if err := s.db.WithContext(s.ctx).Model(&dbShare).Association("RoGroups").Clear(); err != nil {
+		return errors.Wrap(err, "failed to clear RoGroups associations")
+	}
 
 	// Now perform the soft delete
 	_, errS := gorm.G[dbom.ExportedShare](s.db).
@@ -508,20 +794,83 @@ func (s *ShareService) DeleteShare(name string) errors.E {
 	return nil
 }
 
-func (s *ShareService) GetShareFromPath(path string) (*dto.SharedResource, errors.E) {
-	share, err := gorm.G[dbom.ExportedShare](s.db).
+// findSharesByPath returns the shares exporting path, or a directory below
+// it when withChildren is set, ordered by name. Only the shares mounted on
+// path or one of its parents, or below path with withChildren, are loaded.
+func (s *ShareService) findSharesByPath(path string, withChildren bool) ([]dbom.ExportedShare, errors.E) {
+	path = filepath.Clean(path)
+	mountPoints := []string{path}
+	for dir := path; dir != filepath.Dir(dir); {
+		dir = filepath.Dir(dir)
+		mountPoints = append(mountPoints, dir)
+	}
+	where := g.ExportedShare.MountPointDataPath.In(mountPoints...)
+	if withChildren {
+		where = clause.Or(where, g.ExportedShare.MountPointDataPath.Like(strings.TrimSuffix(path, "/")+"/%"))
+	}
+	shares, err := gorm.G[dbom.ExportedShare](s.db).
 		Preload("MountPointData", nil).
 		Preload("Users", nil).
 		Preload("RoUsers", nil).
-		Where(g.ExportedShare.MountPointDataPath.Eq(path)).First(s.ctx)
+		Preload("Groups", nil).
+		Preload("RoGroups", nil).
+		Where(where).
+		Order(g.ExportedShare.Name.Asc()).
+		Find(s.ctx)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.WithStack(dto.ErrorShareNotFound)
-		}
 		return nil, errors.Wrap(err, "failed to get share by mount path")
 	}
+	found := []dbom.ExportedShare{}
+	for _, share := range shares {
+		exportPath := filepath.Join(*share.MountPointDataPath, share.SubPath)
+		if exportPath == path || (withChildren && isSubPath(path, exportPath)) {
+			found = append(found, share)
+		}
+	}
+	return found, nil
+}
+
+// listSharesOnMountPoint returns the shares of the volume mounted on path.
+func (s *ShareService) listSharesOnMountPoint(path string) ([]dto.SharedResource, errors.E) {
+	shares, err := gorm.G[dbom.ExportedShare](s.db).
+		Preload("MountPointData", nil).
+		Preload("Users", nil).
+		Preload("RoUsers", nil).
+		Preload("Groups", nil).
+		Preload("RoGroups", nil).
+		Where(g.ExportedShare.MountPointDataPath.Eq(path)).
+		Order(g.ExportedShare.Name.Asc()).
+		Find(s.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list shares of mount point")
+	}
 	var conv converter.DtoToDbomConverterImpl
-	dtoShare, errS := conv.ExportedShareToSharedResource(share)
+	dtoShares := make([]dto.SharedResource, 0, len(shares))
+	for _, share := range shares {
+		dtoShare, errS := conv.ExportedShareToSharedResource(share)
+		if errS != nil {
+			return nil, errors.Wrap(errS, "failed to convert share")
+		}
+		if err := s.VerifyShare(&dtoShare); err != nil {
+			slog.Warn("Share verification failed", "share", dtoShare.Name, "err", err)
+		}
+		dtoShares = append(dtoShares, dtoShare)
+	}
+	return dtoShares, nil
+}
+
+// GetShareFromPath returns the share exporting path, which is either a mount
+// point or the sub path of a share inside one.
+func (s *ShareService) GetShareFromPath(path string) (*dto.SharedResource, errors.E) {
+	shares, errE := s.findSharesByPath(path, false)
+	if errE != nil {
+		return nil, errE
+	}
+	if len(shares) == 0 {
+		return nil, errors.WithStack(dto.ErrorShareNotFound)
+	}
+	var conv converter.DtoToDbomConverterImpl
+	dtoShare, errS := conv.ExportedShareToSharedResource(shares[0])
 	if errS != nil {
 		return nil, errors.Wrap(errS, "failed to convert share")
 	}
@@ -533,21 +882,35 @@ func (s *ShareService) GetShareFromPath(path string) (*dto.SharedResource, error
 	return &dtoShare, nil
 }
 
+// SetShareFromPathEnabled enables or disables the share exporting path and
+// every share exporting a directory below it, so that disabling a volume
+// disables its sub path shares too. It returns the share exporting path, or
+// the first affected share when only sub paths are exported.
 func (s *ShareService) SetShareFromPathEnabled(path string, enabled bool) (*dto.SharedResource, errors.E) {
-	share, err := gorm.G[dbom.ExportedShare](s.db).
-		Preload("MountPointData", nil).
-		Preload("Users", nil).
-		Preload("RoUsers", nil).
-		Where(g.ExportedShare.MountPointDataPath.Eq(path)).First(s.ctx)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.WithStack(dto.ErrorShareNotFound)
+	shares, errE := s.findSharesByPath(path, true)
+	if errE != nil {
+		return nil, errE
+	}
+	if len(shares) == 0 {
+		return nil, errors.WithStack(dto.ErrorShareNotFound)
+	}
+	var result *dto.SharedResource
+	for _, share := range shares {
+		dtoShare, errE := s.setExportedShareEnabled(share, enabled)
+		if errE != nil {
+			return nil, errE
+		}
+		if result == nil || (share.SubPath == "" && *share.MountPointDataPath == filepath.Clean(path)) {
+			result = dtoShare
 		}
-		return nil, errors.Wrap(err, "failed to get share by mount path")
 	}
+	return result, nil
+}
+
+func (s *ShareService) setExportedShareEnabled(share dbom.ExportedShare, enabled bool) (*dto.SharedResource, errors.E) {
 	if share.Disabled != nil && *share.Disabled == !enabled {
 		// No change needed
-		tlog.Debug("No update on Share", "path", path, "share", share)
+		tlog.Debug("No update on Share", "share", share.Name)
 		var conv converter.DtoToDbomConverterImpl
 		dtoShare, err := conv.ExportedShareToSharedResource(share)
 		if err != nil {
@@ -558,7 +921,9 @@ func (s *ShareService) SetShareFromPathEnabled(path string, enabled bool) (*dto.
 
 	disabled := !enabled
 	share.Disabled = &disabled
-	_, err = gorm.G[dbom.ExportedShare](s.db).Updates(s.ctx, share)
+	// Update the column alone: saving the preloaded associations of a share
+	// found by path is neither needed nor supported on a copy.
+	_, err := gorm.G[dbom.ExportedShare](s.db).Where(g.ExportedShare.Name.Eq(share.Name)).Update(s.ctx, "disabled", disabled)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to save share")
 	}
@@ -589,6 +954,8 @@ func (s *ShareService) setShareEnabled(name string, enabled bool) (*dto.SharedRe
 		Preload("MountPointData", nil).
 		Preload("Users", nil).
 		Preload("RoUsers", nil).
+		Preload("Groups", nil).
+		Preload("RoGroups", nil).
 		Where(g.ExportedShare.Name.Eq(name)).First(s.ctx)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -689,6 +1056,24 @@ func (s *ShareService) VerifyShare(share *dto.SharedResource) errors.E {
 			share.Status.IsValid = false
 			return nil
 		}
+
+		if share.SubPath != "" {
+			if reason := subPathProblem(*share); reason != "" {
+				slog.Warn("Share sub path is not usable",
+					"share", share.Name,
+					"path", share.ExportPath(),
+					"reason", reason)
+				share.Status.IsValid = false
+				return nil
+			}
+		}
+	}
+
+	// A share forcing an unknown owner or group cannot be served.
+	if err := s.validateSharePermissions(*share); err != nil {
+		slog.Warn("Share permissions are not usable", "share", share.Name, "reason", err)
+		share.Status.IsValid = false
+		return nil
 	}
 
 	// Cases 1 & 2: Volume is mounted - validate write support vs user permissions
@@ -714,10 +1099,39 @@ func (s *ShareService) VerifyShare(share *dto.SharedResource) errors.E {
 		}
 		// Case 1: RW volume - share state depends on DB disabled value (already set)
 	}
+
+	// Security options the running Samba cannot honor make the share unusable
+	// so it is left out of smb.conf instead of breaking testparm.
+	if err := validateShareSecurity(*share); err != nil {
+		slog.Warn("Share security options not supported", "share", share.Name, "err", err)
+		share.Status.IsValid = false
+		return nil
+	}
 	share.Status.IsValid = true
 	return nil
 }
 
+// subPathProblem tells why the sub path of a share cannot be exported, empty
+// when it can: it must be a directory and must not leave the mount point
+// through a symlink.
+func subPathProblem(share dto.SharedResource) string {
+	root, err := filepath.EvalSymlinks(share.MountPointData.Path)
+	if err != nil {
+		return "mount point is not reachable"
+	}
+	target, err := filepath.EvalSymlinks(share.ExportPath())
+	if err != nil {
+		return "sub path does not exist"
+	}
+	if !isSubPath(root, target) {
+		return "sub path leaves the mount point"
+	}
+	if info, err := osStat(target); err != nil || !info.IsDir() {
+		return "sub path is not a directory"
+	}
+	return ""
+}
+
 func (s *ShareService) SetSupervisorService(svc SupervisorServiceInterface) {
 	s.supervisor_service = svc
 }
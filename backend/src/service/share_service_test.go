@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/dianlight/srat/events"
 	"github.com/dianlight/srat/internal/ctxkeys"
 	"github.com/dianlight/srat/service"
+	"github.com/dianlight/srat/unixsamba"
 	"github.com/ovechkin-dm/mockio/v2/matchers"
 	"github.com/ovechkin-dm/mockio/v2/mock"
 	"github.com/stretchr/testify/suite"
@@ -143,6 +145,27 @@ func (suite *ShareServiceSuite) TestVerifyShareWithMountedRWVolume() {
 	suite.Len(share.Users[0].RwShares, 1, "RW permissions should be preserved")
 }
 
+// TestVerifyShareWithUnknownOwner tests that a share forcing a missing owner is invalid
+func (suite *ShareServiceSuite) TestVerifyShareWithUnknownOwner() {
+	isWriteSupported := true
+	share := &dto.SharedResource{
+		Name:        "test-owner-share",
+		Disabled:    boolPtr(false),
+		Permissions: &dto.SharePermissions{Owner: "ghost"},
+		MountPointData: &dto.MountPointData{
+			Path:             "/mnt/test",
+			IsMounted:        true,
+			IsWriteSupported: &isWriteSupported,
+		},
+	}
+
+	err := suite.shareService.VerifyShare(share)
+
+	suite.NoError(err)
+	suite.NotNil(share.Status)
+	suite.False(share.Status.IsValid, "share forcing an unknown owner should be marked as invalid")
+}
+
 // TestVerifyShareWithMountedROVolume tests share verification with mounted RO volume
 func (suite *ShareServiceSuite) TestVerifyShareWithMountedROVolume() {
 	isWriteSupported := false
@@ -744,6 +767,319 @@ func (suite *ShareServiceSuite) TestUpdateShareSuccess() {
 	suite.Equal(dto.HAMountUsage("backup"), result.Usage)
 }
 
+// TestUpdateShareSecurityOptions asserts that per-share encryption, signing
+// and protocol floor are persisted through UpdateShare.
+func (suite *ShareServiceSuite) TestUpdateShareSecurityOptions() {
+	defer unixsamba.MockSambaVersion("4.23.0")()
+	mock.When(suite.userService.GetAdmin()).ThenReturn(&dto.User{
+		Username: "homeassistant",
+	}, nil)
+
+	share := dto.SharedResource{
+		Name: "finance",
+		MountPointData: &dto.MountPointData{
+			Path:     "/mnt/finance",
+			DeviceId: "financedev",
+			Type:     "ADDON",
+		},
+		Users: []dto.User{{Username: "homeassistant"}},
+	}
+	_, err := suite.shareService.CreateShare(share)
+	suite.Require().NoError(err)
+
+	share.SmbEncrypt = dto.SmbEncryptRequired
+	share.SmbSigning = dto.SmbSigningMandatory
+	share.SmbMinProtocol = dto.SmbProtocolSMB3_11
+	result, err := suite.shareService.UpdateShare("finance", share)
+
+	suite.Require().NoError(err)
+	suite.Equal(dto.SmbEncryptRequired, result.SmbEncrypt)
+	suite.Equal(dto.SmbSigningMandatory, result.SmbSigning)
+	suite.Equal(dto.SmbProtocolSMB3_11, result.SmbMinProtocol)
+}
+
+// TestUpdateShareSecurityOptionsUnsupportedSamba asserts that a protocol floor
+// the detected Samba cannot negotiate is rejected as a validation error.
+func (suite *ShareServiceSuite) TestUpdateShareSecurityOptionsUnsupportedSamba() {
+	defer unixsamba.MockSambaVersion("4.2.0")()
+	mock.When(suite.userService.GetAdmin()).ThenReturn(&dto.User{
+		Username: "homeassistant",
+	}, nil)
+
+	share := dto.SharedResource{
+		Name: "legacy",
+		MountPointData: &dto.MountPointData{
+			Path:     "/mnt/legacy",
+			DeviceId: "legacydev",
+			Type:     "ADDON",
+		},
+		Users: []dto.User{{Username: "homeassistant"}},
+	}
+	_, err := suite.shareService.CreateShare(share)
+	suite.Require().NoError(err)
+
+	share.SmbMinProtocol = dto.SmbProtocolSMB3_11
+	result, err := suite.shareService.UpdateShare("legacy", share)
+
+	suite.Nil(result)
+	suite.True(errors.Is(err, dto.ErrorShareValidation), "expected ErrorShareValidation, got %v", err)
+}
+
+// TestCreateShareEncryptRequiredBelowSMB3 asserts that required encryption
+// combined with a pre-SMB3 protocol floor is rejected.
+func (suite *ShareServiceSuite) TestCreateShareEncryptRequiredBelowSMB3() {
+	defer unixsamba.MockSambaVersion("4.23.0")()
+
+	created, err := suite.shareService.CreateShare(dto.SharedResource{
+		Name: "mixed",
+		MountPointData: &dto.MountPointData{
+			Path:     "/mnt/mixed",
+			DeviceId: "mixeddev",
+			Type:     "ADDON",
+		},
+		SmbEncrypt:     dto.SmbEncryptRequired,
+		SmbMinProtocol: dto.SmbProtocolSMB2_10,
+	})
+
+	suite.Nil(created)
+	suite.True(errors.Is(err, dto.ErrorShareValidation), "expected ErrorShareValidation, got %v", err)
+}
+
+// TestCreateShareUnknownGroup asserts that a share cannot reference a group
+// that has not been created.
+func (suite *ShareServiceSuite) TestCreateShareUnknownGroup() {
+	created, err := suite.shareService.CreateShare(dto.SharedResource{
+		Name: "family",
+		MountPointData: &dto.MountPointData{
+			Path:     "/mnt/family",
+			DeviceId: "familydev",
+			Type:     "ADDON",
+		},
+		Groups: []string{"nosuchgroup"},
+	})
+
+	suite.Nil(created)
+	suite.True(errors.Is(err, dto.ErrorShareValidation), "expected ErrorShareValidation, got %v", err)
+}
+
+// TestCreateShareInvalidPermissions asserts that share permissions must use
+// octal modes and an owner known to SRAT.
+func (suite *ShareServiceSuite) TestCreateShareInvalidPermissions() {
+	for _, perm := range []dto.SharePermissions{
+		{FileMode: "0698"},
+		{DirMode: "07755"},
+		{Owner: "nosuchuser"},
+		{Group: "nosuchgroup"},
+	} {
+		created, err := suite.shareService.CreateShare(dto.SharedResource{
+			Name: "perms",
+			MountPointData: &dto.MountPointData{
+				Path:     "/mnt/perms",
+				DeviceId: "permsdev",
+				Type:     "ADDON",
+			},
+			Permissions: &perm,
+		})
+
+		suite.Nil(created)
+		suite.True(errors.Is(err, dto.ErrorShareValidation), "expected ErrorShareValidation for %+v, got %v", perm, err)
+	}
+}
+
+// TestCreateShareInvalidUserQuotas asserts that user quotas must name distinct
+// users known to SRAT.
+func (suite *ShareServiceSuite) TestCreateShareInvalidUserQuotas() {
+	for _, quotas := range [][]dto.UserQuota{
+		{{Username: "nosuchuser", LimitBytes: 1024}},
+		{{Username: "nosuchuser", LimitBytes: 1024}, {Username: "nosuchuser", LimitBytes: 2048}},
+	} {
+		created, err := suite.shareService.CreateShare(dto.SharedResource{
+			Name: "quota",
+			MountPointData: &dto.MountPointData{
+				Path:     "/mnt/quota",
+				DeviceId: "quotadev",
+				Type:     "ADDON",
+			},
+			UserQuotas: quotas,
+		})
+
+		suite.Nil(created)
+		suite.True(errors.Is(err, dto.ErrorShareValidation), "expected ErrorShareValidation for %+v, got %v", quotas, err)
+	}
+}
+
+// TestCreateShareInvalidRecycleBinExclude asserts that exclude patterns cannot
+// break the `|` separated list written for vfs_recycle.
+func (suite *ShareServiceSuite) TestCreateShareInvalidRecycleBinExclude() {
+	for _, pattern := range []string{"", "*.tmp|*.bak", "cache/*", "a\nb"} {
+		created, err := suite.shareService.CreateShare(dto.SharedResource{
+			Name: "recycle",
+			MountPointData: &dto.MountPointData{
+				Path:     "/mnt/recycle",
+				DeviceId: "recycledev",
+				Type:     "ADDON",
+			},
+			RecycleBinPolicy: &dto.RecycleBinPolicy{Exclude: []string{"*.tmp", pattern}},
+		})
+
+		suite.Nil(created)
+		suite.True(errors.Is(err, dto.ErrorShareValidation), "expected ErrorShareValidation for %q, got %v", pattern, err)
+	}
+}
+
+// TestCreateShareInvalidAuditOperation asserts that only vfs_full_audit
+// operations can be audited.
+func (suite *ShareServiceSuite) TestCreateShareInvalidAuditOperation() {
+	created, err := suite.shareService.CreateShare(dto.SharedResource{
+		Name: "audit",
+		MountPointData: &dto.MountPointData{
+			Path:     "/mnt/audit",
+			DeviceId: "auditdev",
+			Type:     "ADDON",
+		},
+		Audit: &dto.ShareAudit{Enabled: true, Operations: []string{"unlinkat", "format_disk"}},
+	})
+
+	suite.Nil(created)
+	suite.True(errors.Is(err, dto.ErrorShareValidation), "expected ErrorShareValidation, got %v", err)
+}
+
+func (suite *ShareServiceSuite) TestCreateShareInvalidSubPath() {
+	for _, subPath := range []string{"../etc", "/etc", "photos/../../etc", "photos/", ".", "a\nb"} {
+		created, err := suite.shareService.CreateShare(dto.SharedResource{
+			Name: "subpath",
+			MountPointData: &dto.MountPointData{
+				Path:     "/mnt/subpath",
+				DeviceId: "subpathdev",
+				Type:     "ADDON",
+			},
+			SubPath: subPath,
+		})
+
+		suite.Nil(created)
+		suite.True(errors.Is(err, dto.ErrorShareValidation), "expected ErrorShareValidation for %q, got %v", subPath, err)
+	}
+}
+
+// createSubPathShares creates a share exporting the volume mounted on path
+// and two shares exporting its photos and docs directories.
+func (suite *ShareServiceSuite) createSubPathShares(prefix, path string) {
+	mock.When(suite.userService.GetAdmin()).ThenReturn(&dto.User{Username: "homeassistant"}, nil)
+	for name, subPath := range map[string]string{prefix: "", prefix + "-photos": "photos", prefix + "-docs": "docs"} {
+		_, err := suite.shareService.CreateShare(dto.SharedResource{
+			Name:     name,
+			Disabled: boolPtr(false),
+			MountPointData: &dto.MountPointData{
+				Path:     path,
+				DeviceId: prefix + "dev",
+				Type:     "ADDON",
+			},
+			SubPath: subPath,
+			Users:   []dto.User{{Username: "homeassistant"}},
+		})
+		suite.Require().NoError(err)
+	}
+}
+
+func (suite *ShareServiceSuite) TestGetShareFromPathFollowsSubPath() {
+	suite.createSubPathShares("frompath", "/mnt/frompath")
+
+	share, err := suite.shareService.GetShareFromPath("/mnt/frompath/photos")
+	suite.Require().NoError(err)
+	suite.Equal("frompath-photos", share.Name)
+	suite.Equal("/mnt/frompath/photos", share.ExportPath())
+
+	share, err = suite.shareService.GetShareFromPath("/mnt/frompath")
+	suite.Require().NoError(err)
+	suite.Equal("frompath", share.Name)
+
+	_, err = suite.shareService.GetShareFromPath("/mnt/frompath/music")
+	suite.True(errors.Is(err, dto.ErrorShareNotFound))
+}
+
+func (suite *ShareServiceSuite) TestSetShareFromPathEnabledDisablesSubPathShares() {
+	suite.createSubPathShares("unmounted", "/mnt/unmounted")
+
+	share, err := suite.shareService.SetShareFromPathEnabled("/mnt/unmounted", false)
+	suite.Require().NoError(err)
+	suite.Equal("unmounted", share.Name, "the share of the volume itself is returned")
+
+	for _, name := range []string{"unmounted", "unmounted-photos", "unmounted-docs"} {
+		share, err := suite.shareService.GetShare(name)
+		suite.Require().NoError(err)
+		suite.True(*share.Disabled, "share %s should be disabled", name)
+	}
+
+	share, err = suite.shareService.SetShareFromPathEnabled("/mnt/unmounted/docs", true)
+	suite.Require().NoError(err)
+	suite.Equal("unmounted-docs", share.Name)
+	photos, err := suite.shareService.GetShare("unmounted-photos")
+	suite.Require().NoError(err)
+	suite.True(*photos.Disabled, "sibling sub paths are left alone")
+}
+
+func (suite *ShareServiceSuite) TestSetShareFromPathEnabledFollowsNestedVolumes() {
+	mock.When(suite.userService.GetAdmin()).ThenReturn(&dto.User{Username: "homeassistant"}, nil)
+	for name, path := range map[string]string{"outer": "/mnt/outer", "inner": "/mnt/outer/inner", "sibling": "/mnt/outer_x"} {
+		_, err := suite.shareService.CreateShare(dto.SharedResource{
+			Name:     name,
+			Disabled: boolPtr(false),
+			MountPointData: &dto.MountPointData{
+				Path:     path,
+				DeviceId: name + "dev",
+				Type:     "ADDON",
+			},
+			Users: []dto.User{{Username: "homeassistant"}},
+		})
+		suite.Require().NoError(err)
+	}
+
+	share, err := suite.shareService.SetShareFromPathEnabled("/mnt/outer", false)
+	suite.Require().NoError(err)
+	suite.Equal("outer", share.Name)
+	for name, disabled := range map[string]bool{"outer": true, "inner": true, "sibling": false} {
+		share, err := suite.shareService.GetShare(name)
+		suite.Require().NoError(err)
+		suite.Equal(disabled, *share.Disabled, "share %s", name)
+	}
+}
+
+func (suite *ShareServiceSuite) TestVerifyShareSubPath() {
+	volume := suite.T().TempDir()
+	suite.Require().NoError(os.Mkdir(filepath.Join(volume, "photos"), 0o755))
+	suite.Require().NoError(os.Symlink(suite.T().TempDir(), filepath.Join(volume, "escape")))
+	suite.Require().NoError(os.WriteFile(filepath.Join(volume, "notes.txt"), nil, 0o644))
+
+	for subPath, valid := range map[string]bool{"photos": true, "missing": false, "escape": false, "notes.txt": false} {
+		share := &dto.SharedResource{
+			Name:           "verify-subpath",
+			MountPointData: &dto.MountPointData{Path: volume, IsMounted: true},
+			SubPath:        subPath,
+		}
+		suite.Require().NoError(suite.shareService.VerifyShare(share))
+		suite.Equal(valid, share.Status.IsValid, "sub path %s", subPath)
+	}
+}
+
+// TestVerifyShareUnsupportedEncryption asserts that a stored share asking for
+// encryption on a Samba without SMB3 encryption is marked invalid.
+func (suite *ShareServiceSuite) TestVerifyShareUnsupportedEncryption() {
+	defer unixsamba.MockSambaVersion("4.0.0")()
+	share := &dto.SharedResource{
+		Name:       "encrypted",
+		SmbEncrypt: dto.SmbEncryptDesired,
+		MountPointData: &dto.MountPointData{
+			Path:      "/mnt/encrypted",
+			IsMounted: true,
+		},
+	}
+
+	err := suite.shareService.VerifyShare(share)
+
+	suite.NoError(err)
+	suite.False(share.Status.IsValid)
+}
+
 func (suite *ShareServiceSuite) TestUpdateShareChangeUsers() {
 	// Setup: Create a share first
 	mock.When(suite.userService.GetAdmin()).ThenReturn(&dto.User{
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// smartPredictionProblemTranslationKey is shared by every disk health Problem,
+// the key itself carries the disk.
+const smartPredictionProblemTranslationKey = "smart_prediction"
+
+// Baselines that are not SMART attributes.
+const (
+	smartWearBaseline     = "wear"
+	smartOvertempBaseline = "overtemp_minutes"
+)
+
+// Vendor-independent thresholds.
+const (
+	smartTemperatureWarning = 60 // °C
+	smartTemperatureError   = 70 // °C
+	smartWearWarning        = 80 // % of the rated endurance
+	smartWearError          = 90
+	smartLifeWarningDays    = 365
+	smartLifeErrorDays      = 90
+	// smartWearObservation is how long the wear must be observed before its
+	// own growth is trusted over the average since the disk was new.
+	smartWearObservation = 30 * 24 * time.Hour
+)
+
+// smartCounterRule grades an error counter, read from its raw value. Any count
+// is a warning, a growth since the baseline an error.
+type smartCounterRule struct {
+	code     int    // ATA attribute id
+	name     string // NVMe attribute name, when code is 0
+	what     string
+	critical int64 // count that makes the disk critical, 0 caps it at a warning
+}
+
+var smartCounterRules = []smartCounterRule{
+	{code: 5, what: "reallocated sectors", critical: 100},
+	{code: 187, what: "reported uncorrectable errors", critical: 100},
+	{code: 197, what: "pending sectors", critical: 100},
+	{code: 198, what: "offline uncorrectable sectors", critical: 100},
+	// CRC errors point to a bad cable rather than to a failing disk.
+	{code: 199, what: "interface CRC errors"},
+	{name: "MediaErrors", what: "media errors", critical: 100},
+}
+
+// smartLifeLeftCodes are the ATA attributes whose normalized value is the
+// endurance left of an SSD, in the order they are trusted.
+var smartLifeLeftCodes = []int{
+	231, // SSD_Life_Left
+	202, // Percent_Lifetime_Remain
+	233, // Media_Wearout_Indicator
+	177, // Wear_Leveling_Count
+}
+
+type SmartAnalysisServiceInterface interface {
+	// Analyze grades the SMART status of a disk against its baselines and
+	// raises or dismisses the disk health Problem.
+	Analyze(ctx context.Context, diskId string, status *dto.SmartStatus) (*dto.SmartPrediction, errors.E)
+	// GetPrediction returns the last analysis of a disk.
+	GetPrediction(diskId string) (*dto.SmartPrediction, errors.E)
+}
+
+type SmartAnalysisService struct {
+	ctx            context.Context
+	db             *gorm.DB
+	problemService ProblemServiceInterface
+	now            func() time.Time
+
+	mu          sync.Mutex
+	baselines   map[string]map[string]dbom.SmartBaseline // disk -> attribute -> first value
+	predictions map[string]*dto.SmartPrediction
+	raised      map[string]bool // disk -> Problem raised, absent when unknown
+}
+
+type SmartAnalysisServiceParams struct {
+	fx.In
+	Ctx            context.Context
+	Db             *gorm.DB
+	ProblemService ProblemServiceInterface `optional:"true"`
+}
+
+func NewSmartAnalysisService(in SmartAnalysisServiceParams) SmartAnalysisServiceInterface {
+	return &SmartAnalysisService{
+		ctx:            in.Ctx,
+		db:             in.Db,
+		problemService: in.ProblemService,
+		now:            time.Now,
+		baselines:      make(map[string]map[string]dbom.SmartBaseline),
+		predictions:    make(map[string]*dto.SmartPrediction),
+		raised:         make(map[string]bool),
+	}
+}
+
+func (s *SmartAnalysisService) GetPrediction(diskId string) (*dto.SmartPrediction, errors.E) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prediction, ok := s.predictions[diskId]
+	if !ok {
+		return nil, errors.WithDetails(dto.ErrorNotFound, "disk", diskId, "reason", "SMART status not read yet")
+	}
+	return prediction, nil
+}
+
+func (s *SmartAnalysisService) Analyze(ctx context.Context, diskId string, status *dto.SmartStatus) (*dto.SmartPrediction, errors.E) {
+	now := s.now().UTC()
+
+	current := map[string]int64{smartOvertempBaseline: int64(status.Temperature.OvertempCounter)}
+	for _, rule := range smartCounterRules {
+		if name, attr, ok := smartCounter(status, rule); ok {
+			current[name] = attr.Raw
+		}
+	}
+	wear, hasWear := smartWear(status)
+	if hasWear {
+		current[smartWearBaseline] = int64(wear)
+	}
+	baselines, err := s.baselinesOf(ctx, diskId, current, now)
+	if err != nil {
+		return nil, err
+	}
+
+	prediction := &dto.SmartPrediction{
+		DiskId:     diskId,
+		Severity:   dto.ProblemSeverities.PROBLEMSEVERITYINFO,
+		Findings:   []dto.SmartFinding{},
+		AnalyzedAt: now,
+	}
+	for _, rule := range smartCounterRules {
+		if name, attr, ok := smartCounter(status, rule); ok {
+			if finding, ok := gradeSmartCounter(rule, name, attr.Raw, baselines[name]); ok {
+				prediction.Findings = append(prediction.Findings, finding)
+			}
+		}
+	}
+	if hasWear {
+		prediction.WearPercent = &wear
+		days, ok := smartRemainingLife(wear, baselines[smartWearBaseline], status.PowerOnHours.Value, now)
+		if ok {
+			prediction.RemainingLifeDays = &days
+		}
+		if finding, ok := gradeSmartWear(wear, prediction.RemainingLifeDays); ok {
+			prediction.Findings = append(prediction.Findings, finding)
+		}
+	}
+	prediction.Findings = append(prediction.Findings, gradeNvmeHealth(status)...)
+	prediction.Findings = append(prediction.Findings, gradeSmartTemperature(status.Temperature, baselines[smartOvertempBaseline])...)
+
+	for _, finding := range prediction.Findings {
+		if finding.Severity.Rank() > prediction.Severity.Rank() {
+			prediction.Severity = finding.Severity
+		}
+	}
+
+	s.mu.Lock()
+	s.predictions[diskId] = prediction
+	s.mu.Unlock()
+	s.updateProblem(prediction)
+	return prediction, nil
+}
+
+// baselinesOf returns the baselines of a disk, storing the current values of
+// the attributes seen for the first time.
+func (s *SmartAnalysisService) baselinesOf(ctx context.Context, diskId string, current map[string]int64, now time.Time) (map[string]dbom.SmartBaseline, errors.E) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	baselines, ok := s.baselines[diskId]
+	if !ok {
+		rows, err := gorm.G[dbom.SmartBaseline](s.db).Where(g.SmartBaseline.DiskID.Eq(diskId)).Find(ctx)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		baselines = make(map[string]dbom.SmartBaseline, len(rows))
+		for _, row := range rows {
+			baselines[row.Attribute] = row
+		}
+		s.baselines[diskId] = baselines
+	}
+
+	var missing []dbom.SmartBaseline
+	for attribute, value := range current {
+		if _, ok := baselines[attribute]; !ok {
+			missing = append(missing, dbom.SmartBaseline{DiskID: diskId, Attribute: attribute, Value: value, SeenAt: now})
+		}
+	}
+	if len(missing) > 0 {
+		err := gorm.G[dbom.SmartBaseline](s.db, clause.OnConflict{DoNothing: true}).CreateInBatches(ctx, &missing, 100)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, baseline := range missing {
+			baselines[baseline.Attribute] = baseline
+		}
+	}
+	return maps.Clone(baselines), nil
+}
+
+func (s *SmartAnalysisService) updateProblem(prediction *dto.SmartPrediction) {
+	if s.problemService == nil {
+		return
+	}
+	key := smartPredictionProblemKey(prediction.DiskId)
+
+	s.mu.Lock()
+	raised, known := s.raised[prediction.DiskId]
+	s.raised[prediction.DiskId] = len(prediction.Findings) > 0
+	s.mu.Unlock()
+
+	if len(prediction.Findings) == 0 {
+		// A Problem raised before a restart is only known to the database.
+		if !known || raised {
+			if err := s.problemService.Dismiss(key); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				tlog.WarnContext(s.ctx, "Unable to dismiss disk health problem", "disk", prediction.DiskId, "error", err)
+			}
+		}
+		return
+	}
+
+	messages := make([]string, 0, len(prediction.Findings))
+	for _, finding := range prediction.Findings {
+		messages = append(messages, finding.Message)
+	}
+	problem := &dto.Problem{
+		ProblemKey:     key,
+		Title:          fmt.Sprintf("Disk %s may be failing", prediction.DiskId),
+		Description:    fmt.Sprintf("Disk %s: %s.", prediction.DiskId, strings.Join(messages, "; ")),
+		Severity:       prediction.Severity,
+		Status:         dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSCREATED,
+		TranslationKey: smartPredictionProblemTranslationKey,
+		IsPersistent:   true,
+	}
+	// Upserting an unchanged Problem would bring an ignored one back.
+	if existing, err := s.problemService.Get(key); err == nil {
+		if existing.Description == problem.Description && existing.Severity == problem.Severity {
+			return
+		}
+		problem.Ignored = existing.Ignored
+	}
+	if _, err := s.problemService.Upsert(problem); err != nil {
+		tlog.WarnContext(s.ctx, "Unable to upsert disk health problem", "disk", prediction.DiskId, "error", err)
+	}
+}
+
+func smartPredictionProblemKey(diskId string) string {
+	return "smart_prediction_" + diskId
+}
+
+// smartCounter returns the attribute of a status a counter rule reads.
+func smartCounter(status *dto.SmartStatus, rule smartCounterRule) (string, dto.SmartRangeValue, bool) {
+	if rule.code == 0 {
+		attr, ok := status.Additional[rule.name]
+		return rule.name, attr, ok
+	}
+	for name, attr := range status.Additional {
+		if attr.Code == rule.code {
+			return name, attr, true
+		}
+	}
+	return "", dto.SmartRangeValue{}, false
+}
+
+func gradeSmartCounter(rule smartCounterRule, name string, value int64, baseline dbom.SmartBaseline) (dto.SmartFinding, bool) {
+	if value <= 0 {
+		return dto.SmartFinding{}, false
+	}
+	finding := dto.SmartFinding{
+		Attribute: name,
+		Value:     value,
+		Baseline:  &baseline.Value,
+		Since:     &baseline.SeenAt,
+		Severity:  dto.ProblemSeverities.PROBLEMSEVERITYWARNING,
+		Message:   fmt.Sprintf("%d %s", value, rule.what),
+	}
+	if value > baseline.Value {
+		finding.Message = fmt.Sprintf("%s grew from %d to %d since %s", rule.what, baseline.Value, value, baseline.SeenAt.Format(time.DateOnly))
+		if rule.critical > 0 {
+			finding.Severity = dto.ProblemSeverities.PROBLEMSEVERITYERROR
+		}
+	}
+	if rule.critical > 0 && value >= rule.critical {
+		finding.Severity = dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL
+	}
+	return finding, true
+}
+
+// smartWear returns the rated endurance an SSD used, in percent.
+func smartWear(status *dto.SmartStatus) (int, bool) {
+	if used, ok := status.Additional["PercentageUsed"]; ok {
+		return used.Value, true
+	}
+	for _, code := range smartLifeLeftCodes {
+		for _, attr := range status.Additional {
+			if attr.Code == code && attr.Value > 0 && attr.Value <= 100 {
+				return 100 - attr.Value, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// smartRemainingLife estimates the days before an SSD reaches its rated
+// endurance. The wear rate is the one observed since the baseline when it is
+// old enough, the average since the disk was new otherwise.
+func smartRemainingLife(wear int, baseline dbom.SmartBaseline, powerOnHours int, now time.Time) (int, bool) {
+	if wear >= 100 {
+		return 0, true
+	}
+	var perDay float64
+	if observed := now.Sub(baseline.SeenAt); !baseline.SeenAt.IsZero() && observed >= smartWearObservation && int64(wear) > baseline.Value {
+		perDay = float64(int64(wear)-baseline.Value) / observed.Hours() * 24
+	} else if wear > 0 && powerOnHours > 0 {
+		perDay = float64(wear) / float64(powerOnHours) * 24
+	}
+	if perDay <= 0 {
+		return 0, false
+	}
+	return int(float64(100-wear) / perDay), true
+}
+
+func gradeSmartWear(wear int, remainingDays *int) (dto.SmartFinding, bool) {
+	finding := dto.SmartFinding{
+		Attribute: smartWearBaseline,
+		Value:     int64(wear),
+		Severity:  dto.ProblemSeverities.PROBLEMSEVERITYINFO,
+		Message:   fmt.Sprintf("the SSD used %d%% of its rated endurance", wear),
+	}
+	switch {
+	case wear >= 100:
+		finding.Severity = dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL
+	case wear >= smartWearError:
+		finding.Severity = dto.ProblemSeverities.PROBLEMSEVERITYERROR
+	case wear >= smartWearWarning:
+		finding.Severity = dto.ProblemSeverities.PROBLEMSEVERITYWARNING
+	}
+	if remainingDays != nil && wear < 100 {
+		// Months keep the message, and so the Problem, from changing every hour.
+		if months := *remainingDays / 30; months > 0 {
+			finding.Message += fmt.Sprintf(", about %d months left at the current wear rate", months)
+		} else {
+			finding.Message += ", less than a month left at the current wear rate"
+		}
+		switch {
+		case *remainingDays < smartLifeErrorDays && finding.Severity.Rank() < dto.ProblemSeverities.PROBLEMSEVERITYERROR.Rank():
+			finding.Severity = dto.ProblemSeverities.PROBLEMSEVERITYERROR
+		case *remainingDays < smartLifeWarningDays && finding.Severity.Rank() < dto.ProblemSeverities.PROBLEMSEVERITYWARNING.Rank():
+			finding.Severity = dto.ProblemSeverities.PROBLEMSEVERITYWARNING
+		}
+	}
+	return finding, finding.Severity != dto.ProblemSeverities.PROBLEMSEVERITYINFO
+}
+
+// gradeNvmeHealth reports the spare blocks and the critical warning an NVMe
+// controller grades itself.
+func gradeNvmeHealth(status *dto.SmartStatus) []dto.SmartFinding {
+	var findings []dto.SmartFinding
+	if spare, ok := status.Additional["AvailableSpare"]; ok && spare.Thresholds > 0 && spare.Value < spare.Thresholds {
+		findings = append(findings, dto.SmartFinding{
+			Attribute: "AvailableSpare",
+			Value:     int64(spare.Value),
+			Severity:  dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL,
+			Message:   fmt.Sprintf("available spare %d%% is below the %d%% threshold", spare.Value, spare.Thresholds),
+		})
+	}
+	if warning, ok := status.Additional["CriticalWarning"]; ok && warning.Value != 0 {
+		findings = append(findings, dto.SmartFinding{
+			Attribute: "CriticalWarning",
+			Value:     int64(warning.Value),
+			Severity:  dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL,
+			Message:   fmt.Sprintf("the controller reports a critical warning (0x%02x)", warning.Value),
+		})
+	}
+	return findings
+}
+
+func gradeSmartTemperature(temperature dto.SmartTempValue, overtemp dbom.SmartBaseline) []dto.SmartFinding {
+	var findings []dto.SmartFinding
+	if temperature.Value >= smartTemperatureWarning {
+		finding := dto.SmartFinding{
+			Attribute: "Temperature",
+			Value:     int64(temperature.Value),
+			Severity:  dto.ProblemSeverities.PROBLEMSEVERITYWARNING,
+			Message:   fmt.Sprintf("running at %d °C", temperature.Value),
+		}
+		if temperature.Value >= smartTemperatureError {
+			finding.Severity = dto.ProblemSeverities.PROBLEMSEVERITYERROR
+		}
+		findings = append(findings, finding)
+	}
+	if minutes := int64(temperature.OvertempCounter); minutes > overtemp.Value {
+		findings = append(findings, dto.SmartFinding{
+			Attribute: smartOvertempBaseline,
+			Value:     minutes,
+			Baseline:  &overtemp.Value,
+			Since:     &overtemp.SeenAt,
+			Severity:  dto.ProblemSeverities.PROBLEMSEVERITYWARNING,
+			Message:   fmt.Sprintf("spent %d more minutes above its warning temperature since %s", minutes-overtemp.Value, overtemp.SeenAt.Format(time.DateOnly)),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+func TestSmartRemainingLife(t *testing.T) {
+	now := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		wear         int
+		baseline     dbom.SmartBaseline
+		powerOnHours int
+		want         int
+		ok           bool
+	}{
+		{name: "worn out", wear: 100, want: 0, ok: true},
+		{name: "average since new", wear: 10, powerOnHours: 365 * 24, want: 9 * 365, ok: true},
+		{name: "observed growth", wear: 20, baseline: dbom.SmartBaseline{Value: 10, SeenAt: now.Add(-100 * 24 * time.Hour)}, powerOnHours: 365 * 24, want: 800, ok: true},
+		{name: "observed too shortly", wear: 20, baseline: dbom.SmartBaseline{Value: 10, SeenAt: now.Add(-24 * time.Hour)}, powerOnHours: 200 * 24, want: 800, ok: true},
+		{name: "no wear yet", wear: 0, powerOnHours: 100},
+		{name: "no power on hours", wear: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days, ok := smartRemainingLife(tt.wear, tt.baseline, tt.powerOnHours, now)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, days)
+		})
+	}
+}
+
+func TestSmartWear(t *testing.T) {
+	wear, ok := smartWear(&dto.SmartStatus{Additional: map[string]dto.SmartRangeValue{"PercentageUsed": {Value: 7}}})
+	assert.True(t, ok)
+	assert.Equal(t, 7, wear)
+
+	wear, ok = smartWear(&dto.SmartStatus{Additional: map[string]dto.SmartRangeValue{
+		"Wear_Leveling_Count": {Code: 177, Value: 60},
+		"SSD_Life_Left":       {Code: 231, Value: 95},
+	}})
+	assert.True(t, ok)
+	assert.Equal(t, 5, wear, "SSD_Life_Left is trusted first")
+
+	_, ok = smartWear(&dto.SmartStatus{Additional: map[string]dto.SmartRangeValue{"Reallocated_Sector_Ct": {Code: 5, Value: 100}}})
+	assert.False(t, ok)
+}
+
+type SmartAnalysisServiceSuite struct {
+	suite.Suite
+	app            *fxtest.App
+	db             *gorm.DB
+	problemService ProblemServiceInterface
+	service        *SmartAnalysisService
+	now            time.Time
+}
+
+func TestSmartAnalysisServiceSuite(t *testing.T) {
+	suite.Run(t, new(SmartAnalysisServiceSuite))
+}
+
+func (suite *SmartAnalysisServiceSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+				}
+			},
+			dbom.NewDB,
+		),
+		fx.Populate(&suite.db),
+	)
+	suite.app.RequireStart()
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.SmartBaseline{}).Error)
+
+	ctrl := mock.NewMockController(suite.T())
+	suite.problemService = mock.Mock[ProblemServiceInterface](ctrl)
+	mock.When(suite.problemService.Get(mock.Any[string]())).ThenReturn(nil, gorm.ErrRecordNotFound)
+	mock.When(suite.problemService.Dismiss(mock.Any[string]())).ThenReturn(gorm.ErrRecordNotFound)
+	// Upsert is left for each test to stub.
+
+	suite.now = time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	suite.service = suite.newService()
+}
+
+func (suite *SmartAnalysisServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+// newService returns a service starting from scratch, as after a restart.
+func (suite *SmartAnalysisServiceSuite) newService() *SmartAnalysisService {
+	return &SmartAnalysisService{
+		ctx:            context.Background(),
+		db:             suite.db,
+		problemService: suite.problemService,
+		now:            func() time.Time { return suite.now },
+		baselines:      make(map[string]map[string]dbom.SmartBaseline),
+		predictions:    make(map[string]*dto.SmartPrediction),
+		raised:         make(map[string]bool),
+	}
+}
+
+func ataStatus(reallocated, pending int64) *dto.SmartStatus {
+	return &dto.SmartStatus{
+		Enabled:      true,
+		Temperature:  dto.SmartTempValue{Value: 35},
+		PowerOnHours: dto.SmartRangeValue{Value: 20000},
+		Additional: map[string]dto.SmartRangeValue{
+			"Reallocated_Sector_Ct":  {Code: 5, Value: 100, Thresholds: 10, Raw: reallocated},
+			"Current_Pending_Sector": {Code: 197, Value: 100, Raw: pending},
+			"UDMA_CRC_Error_Count":   {Code: 199, Value: 200},
+		},
+	}
+}
+
+func (suite *SmartAnalysisServiceSuite) TestHealthyDisk() {
+	prediction, err := suite.service.Analyze(context.Background(), "sda", ataStatus(0, 0))
+	suite.Require().NoError(err)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYINFO, prediction.Severity)
+	suite.Empty(prediction.Findings)
+	suite.Nil(prediction.WearPercent)
+
+	// The Problem of a previous run is dismissed once, even if there is none.
+	_, err = suite.service.Analyze(context.Background(), "sda", ataStatus(0, 0))
+	suite.Require().NoError(err)
+	mock.Verify(suite.problemService, matchers.Times(1)).Dismiss(mock.Exact("smart_prediction_sda"))
+	_, _ = mock.Verify(suite.problemService, matchers.Times(0)).Upsert(mock.Any[*dto.Problem]())
+
+	stored, errE := suite.service.GetPrediction("sda")
+	suite.Require().NoError(errE)
+	suite.Equal(prediction, stored)
+	_, errE = suite.service.GetPrediction("sdb")
+	suite.ErrorIs(errE, dto.ErrorNotFound)
+}
+
+func (suite *SmartAnalysisServiceSuite) TestGrowingCounters() {
+	captor := mock.Captor[*dto.Problem]()
+	mock.When(suite.problemService.Upsert(captor.Capture())).ThenAnswer(func(args []any) []any {
+		return []any{args[0], nil}
+	})
+
+	prediction, err := suite.service.Analyze(context.Background(), "sda", ataStatus(3, 0))
+	suite.Require().NoError(err)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYWARNING, prediction.Severity, "a count known from the start is a warning")
+	suite.Require().Len(prediction.Findings, 1)
+	suite.Equal("Reallocated_Sector_Ct", prediction.Findings[0].Attribute)
+	suite.Equal("3 reallocated sectors", prediction.Findings[0].Message)
+
+	// The baselines survive a restart.
+	suite.now = suite.now.Add(48 * time.Hour)
+	suite.service = suite.newService()
+	prediction, err = suite.service.Analyze(context.Background(), "sda", ataStatus(8, 2))
+	suite.Require().NoError(err)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYERROR, prediction.Severity)
+	suite.Require().Len(prediction.Findings, 2)
+	suite.Equal("reallocated sectors grew from 3 to 8 since 2026-02-01", prediction.Findings[0].Message)
+	suite.Require().NotNil(prediction.Findings[0].Baseline)
+	suite.Equal(int64(3), *prediction.Findings[0].Baseline)
+	suite.Equal("pending sectors grew from 0 to 2 since 2026-02-01", prediction.Findings[1].Message)
+
+	problem := captor.Last()
+	suite.Equal("smart_prediction_sda", problem.ProblemKey)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYERROR, problem.Severity)
+	suite.Equal("Disk sda: reallocated sectors grew from 3 to 8 since 2026-02-01; pending sectors grew from 0 to 2 since 2026-02-01.", problem.Description)
+
+	prediction, err = suite.service.Analyze(context.Background(), "sda", ataStatus(120, 2))
+	suite.Require().NoError(err)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL, prediction.Severity)
+}
+
+func (suite *SmartAnalysisServiceSuite) TestUnchangedProblemIsKept() {
+	status := ataStatus(3, 0)
+	prediction, err := suite.service.Analyze(context.Background(), "sda", status)
+	suite.Require().NoError(err)
+
+	ctrl := mock.NewMockController(suite.T())
+	suite.problemService = mock.Mock[ProblemServiceInterface](ctrl)
+	mock.When(suite.problemService.Get(mock.Exact("smart_prediction_sda"))).ThenReturn(&dto.Problem{
+		ProblemKey:  "smart_prediction_sda",
+		Description: "Disk sda: 3 reallocated sectors.",
+		Severity:    prediction.Severity,
+		Ignored:     true,
+	}, nil)
+	suite.service.problemService = suite.problemService
+
+	_, err = suite.service.Analyze(context.Background(), "sda", status)
+	suite.Require().NoError(err)
+	_, _ = mock.Verify(suite.problemService, matchers.Times(0)).Upsert(mock.Any[*dto.Problem]())
+}
+
+func (suite *SmartAnalysisServiceSuite) TestNvmeWear() {
+	status := &dto.SmartStatus{
+		Enabled:      true,
+		Temperature:  dto.SmartTempValue{Value: 72, OvertempCounter: 10},
+		PowerOnHours: dto.SmartRangeValue{Value: 365 * 24},
+		Additional: map[string]dto.SmartRangeValue{
+			"AvailableSpare":  {Value: 100, Thresholds: 10},
+			"PercentageUsed":  {Value: 85},
+			"CriticalWarning": {Value: 0},
+			"MediaErrors":     {Value: 0, Raw: 0},
+		},
+	}
+	prediction, err := suite.service.Analyze(context.Background(), "nvme0n1", status)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(prediction.WearPercent)
+	suite.Equal(85, *prediction.WearPercent)
+	suite.Require().NotNil(prediction.RemainingLifeDays)
+	suite.Equal(64, *prediction.RemainingLifeDays)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYERROR, prediction.Severity)
+	suite.Require().Len(prediction.Findings, 2)
+	suite.Equal("the SSD used 85% of its rated endurance, about 2 months left at the current wear rate", prediction.Findings[0].Message)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYERROR, prediction.Findings[0].Severity, "less than 90 days left")
+	suite.Equal("running at 72 °C", prediction.Findings[1].Message)
+
+	status.Temperature = dto.SmartTempValue{Value: 40, OvertempCounter: 25}
+	status.Additional["AvailableSpare"] = dto.SmartRangeValue{Value: 5, Thresholds: 10}
+	prediction, err = suite.service.Analyze(context.Background(), "nvme0n1", status)
+	suite.Require().NoError(err)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL, prediction.Severity)
+	suite.Require().Len(prediction.Findings, 3)
+	suite.Equal("available spare 5% is below the 10% threshold", prediction.Findings[1].Message)
+	suite.Equal("spent 15 more minutes above its warning temperature since 2026-02-01", prediction.Findings[2].Message)
+}
@@ -2,17 +2,20 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dianlight/smartmontools-sdk/bindings/go/v8"
 	"github.com/dianlight/srat/converter"
 	"github.com/dianlight/srat/dto"
 	"github.com/dianlight/srat/events"
+	"github.com/dianlight/srat/internal/commandexec"
 
 	"github.com/dianlight/tlog"
 	"gitlab.com/tozd/go/errors"
@@ -24,10 +27,16 @@ type SmartServiceInterface interface {
 	GetSmartStatus(ctx context.Context, deviceId string) (*dto.SmartStatus, errors.E)
 	GetHealthStatus(ctx context.Context, deviceId string) (*dto.SmartHealthStatus, errors.E)
 	StartSelfTest(ctx context.Context, deviceId string, testType dto.SmartTestType) errors.E
+	// BeginSelfTest starts a self-test and returns at once, GetTestStatus
+	// tells its progress.
+	BeginSelfTest(ctx context.Context, deviceId string, testType dto.SmartTestType) errors.E
 	AbortSelfTest(ctx context.Context, deviceId string) errors.E
 	GetTestStatus(ctx context.Context, deviceId string) (*dto.SmartTestStatus, errors.E)
 	EnableSMART(ctx context.Context, deviceId string) errors.E
 	DisableSMART(ctx context.Context, deviceId string) errors.E
+	// GetSmartPrediction reads the SMART status of a device and returns the
+	// trend analysis of its attributes.
+	GetSmartPrediction(ctx context.Context, deviceId string) (*dto.SmartPrediction, errors.E)
 	MockDeviceToDevice(func(string) (string, error))
 }
 
@@ -36,6 +45,9 @@ type smartService struct {
 	client           smartmontools.SmartClient
 	conv             converter.SmartMonToolsToDtoImpl
 	eventBus         events.EventBusInterface
+	statsHistory     StatsHistoryServiceInterface
+	smartAnalysis    SmartAnalysisServiceInterface
+	executor         commandexec.Executor
 	deviceIdToDevice func(string) (string, error)
 }
 
@@ -44,9 +56,14 @@ type SmartServiceParams struct {
 	// Client is optional: when provided (e.g. in tests via mock injection) it is
 	// used as-is. When nil (production), NewSmartService initialises the client
 	// internally by probing the lib backend first, then falling back to exec.
-	Client   smartmontools.SmartClient `optional:"true"`
-	ApiCtx   *dto.ContextState         `optional:"true"`
-	EventBus events.EventBusInterface
+	Client        smartmontools.SmartClient `optional:"true"`
+	ApiCtx        *dto.ContextState         `optional:"true"`
+	EventBus      events.EventBusInterface
+	StatsHistory  StatsHistoryServiceInterface  `optional:"true"`
+	SmartAnalysis SmartAnalysisServiceInterface `optional:"true"`
+	// Executor reads the self-test log with smartctl, the bindings do not
+	// expose it.
+	Executor commandexec.Executor `optional:"true"`
 }
 
 // recordLibSmartBackendOutcome records the lib SMART backend availability and,
@@ -71,6 +88,9 @@ func NewSmartService(in SmartServiceParams) SmartServiceInterface {
 	return &smartService{
 		client:           client,
 		eventBus:         in.EventBus,
+		statsHistory:     in.StatsHistory,
+		smartAnalysis:    in.SmartAnalysis,
+		executor:         in.Executor,
 		conv:             converter.SmartMonToolsToDtoImpl{},
 		deviceIdToDevice: converter.DeviceIdToDevice,
 	}
@@ -225,6 +245,7 @@ func (s *smartService) GetSmartStatus(ctx context.Context, deviceId string) (*dt
 							Value:      attr.Value,
 							Worst:      attr.Worst,
 							Thresholds: attr.Thresh,
+							Raw:        attr.Raw.Value,
 						}
 					}
 				}
@@ -263,13 +284,63 @@ func (s *smartService) GetSmartStatus(ctx context.Context, deviceId string) (*dt
 		others["CriticalWarning"] = dto.SmartRangeValue{
 			Value: smartInfo.NvmeSmartHealth.CriticalWarning,
 		}
+		others["MediaErrors"] = dto.SmartRangeValue{
+			Value: int(smartInfo.NvmeSmartHealth.MediaErrors),
+			Raw:   smartInfo.NvmeSmartHealth.MediaErrors,
+		}
 		ret.Additional = others
 
 	}
 
+	s.recordHistory(ctx, deviceId, ret)
+	s.analyze(ctx, deviceId, ret)
 	return ret, nil
 }
 
+// recordHistory stores the temperature, the counters and the raw values of
+// the attributes of a SMART status in the statistics history: the raw values
+// are the counts that grow as a disk wears, the normalized ones barely move.
+// A disk in standby reports none.
+func (s *smartService) recordHistory(ctx context.Context, deviceId string, status *dto.SmartStatus) {
+	if s.statsHistory == nil || !status.Enabled || status.InStandby {
+		return
+	}
+	samples := []dto.StatsSample{
+		{Metric: dto.StatsSmartPowerOnHours, Series: deviceId, Value: float64(status.PowerOnHours.Value)},
+		{Metric: dto.StatsSmartPowerCycles, Series: deviceId, Value: float64(status.PowerCycleCount.Value)},
+	}
+	if status.Temperature.Value > 0 {
+		samples = append(samples, dto.StatsSample{Metric: dto.StatsSmartTemperature, Series: deviceId, Value: float64(status.Temperature.Value)})
+	}
+	for name, attr := range status.Additional {
+		samples = append(samples, dto.StatsSample{Metric: dto.StatsSmartAttribute, Series: deviceId + "/" + name, Value: float64(attr.Raw)})
+	}
+	if err := s.statsHistory.Record(ctx, time.Now(), samples...); err != nil {
+		tlog.DebugContext(ctx, "Failed to record SMART statistics", "disk", deviceId, "error", err)
+	}
+}
+
+// analyze runs the trend analysis of a SMART status. A disk in standby
+// reports no attributes, its last analysis is kept.
+func (s *smartService) analyze(ctx context.Context, deviceId string, status *dto.SmartStatus) {
+	if s.smartAnalysis == nil || !status.Enabled || status.InStandby {
+		return
+	}
+	if _, err := s.smartAnalysis.Analyze(ctx, deviceId, status); err != nil {
+		tlog.WarnContext(ctx, "Failed to analyze SMART status", "disk", deviceId, "error", err)
+	}
+}
+
+func (s *smartService) GetSmartPrediction(ctx context.Context, deviceId string) (*dto.SmartPrediction, errors.E) {
+	if s.smartAnalysis == nil {
+		return nil, errors.WithDetails(dto.ErrorSMARTNotSupported, "device", deviceId, "reason", "SMART analysis not available")
+	}
+	if _, err := s.GetSmartStatus(ctx, deviceId); err != nil {
+		return nil, err
+	}
+	return s.smartAnalysis.GetPrediction(deviceId)
+}
+
 // GetHealthStatus returns the health status of a device by evaluating SMART attributes
 func (s *smartService) GetHealthStatus(ctx context.Context, deviceId string) (*dto.SmartHealthStatus, errors.E) {
 	// Check if client is available
@@ -430,6 +501,42 @@ func (s *smartService) StartSelfTest(ctx context.Context, deviceId string, testT
 	return nil
 }
 
+func (s *smartService) BeginSelfTest(ctx context.Context, deviceId string, testType dto.SmartTestType) errors.E {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !testType.IsValid() {
+		return errors.WithDetails(dto.ErrorInvalidParameter, "test_type", testType)
+	}
+	if s.client == nil {
+		return errors.WithDetails(dto.ErrorSMARTNotSupported, "device", deviceId, "reason", "smartctl not available")
+	}
+	devicePath, err := s.deviceIdToDevice(deviceId)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve device path for device ID %s", deviceId)
+	}
+
+	if err := s.client.RunSelfTest(ctx, devicePath, testType.String()); err != nil {
+		if strings.Contains(err.Error(), "not supported") {
+			return errors.WithDetails(dto.ErrorSMARTNotSupported, "device", devicePath,
+				"reason", "self-test not supported")
+		}
+		return errors.Wrapf(err, "failed to start SMART self-test")
+	}
+	s.eventBus.EmitSmart(events.SmartEvent{
+		Event: events.Event{
+			Type: events.EventTypes.UPDATE,
+		},
+		SmartTestStatus: dto.SmartTestStatus{
+			TestType: testType.String(),
+			Running:  true,
+			DiskId:   deviceId,
+		},
+	})
+	slog.DebugContext(ctx, "SMART self-test started", "device", devicePath, "type", testType)
+	return nil
+}
+
 // AbortSelfTest aborts the currently running SMART self-test on the device
 func (s *smartService) AbortSelfTest(ctx context.Context, deviceId string) errors.E {
 	s.mutex.Lock()
@@ -518,11 +625,40 @@ func (s *smartService) GetTestStatus(ctx context.Context, deviceId string) (*dto
 			} else if strings.Contains(ls, "conveyance") {
 				status.TestType = "conveyance"
 			}
+			if !status.Running {
+				status.Passed = ataSelfTestPassed(st)
+				s.addLastSelfTest(ctx, devicePath, status)
+			}
 		}
 
 		return status, nil
 	}
 
+	// NVMe reports the running test only, the outcome is in the self-test log
+	if testLog := smartInfo.NvmeSmartTestLog; testLog != nil {
+		status := &dto.SmartTestStatus{
+			DiskId:   deviceId,
+			Status:   "idle",
+			TestType: "none",
+		}
+		if testLog.CurrentOpeation != nil && *testLog.CurrentOpeation != 0 {
+			status.Running = true
+			status.Status = "in progress"
+			switch *testLog.CurrentOpeation {
+			case 1:
+				status.TestType = "short"
+			case 2:
+				status.TestType = "long"
+			}
+			if testLog.CurrentCompletion != nil {
+				status.PercentComplete = *testLog.CurrentCompletion
+			}
+		} else {
+			s.addLastSelfTest(ctx, devicePath, status)
+		}
+		return status, nil
+	}
+
 	// Return a default status if no self-test info is available
 	return &dto.SmartTestStatus{
 		Status:   "idle",
@@ -530,6 +666,132 @@ func (s *smartService) GetTestStatus(ctx context.Context, deviceId string) (*dto
 	}, nil
 }
 
+// ataSelfTestPassed tells from the self-test execution status whether the
+// last test passed, nil when it was aborted or is unknown.
+func ataSelfTestPassed(st *smartmontools.StatusField) *bool {
+	if st.Passed != nil {
+		return st.Passed
+	}
+	var passed bool
+	switch st.Value >> 4 {
+	case 0:
+		// A status read as a plain string has no value
+		passed = !strings.Contains(strings.ToLower(st.String), "fail")
+	case 1, 2, 15: // aborted by the host, interrupted by a reset, in progress
+		return nil
+	}
+	return &passed
+}
+
+// selfTestLogEntry is the newest entry of the self-test log of a disk.
+type selfTestLogEntry struct {
+	TestType string
+	Status   string
+	Passed   *bool
+	LBA      *int64
+}
+
+// smartctlSelfTestLog is the output of smartctl --json -l selftest.
+type smartctlSelfTestLog struct {
+	Ata *struct {
+		Standard struct {
+			Table []struct {
+				Type struct {
+					String string `json:"string"`
+				} `json:"type"`
+				Status smartmontools.StatusField `json:"status"`
+				LBA    *int64                    `json:"lba"`
+			} `json:"table"`
+		} `json:"standard"`
+	} `json:"ata_smart_self_test_log"`
+	Nvme *struct {
+		Table []struct {
+			Code struct {
+				String string `json:"string"`
+			} `json:"self_test_code"`
+			Result struct {
+				Value  int    `json:"value"`
+				String string `json:"string"`
+			} `json:"self_test_result"`
+			LBA *int64 `json:"lba"`
+		} `json:"table"`
+	} `json:"nvme_self_test_log"`
+}
+
+// parseSelfTestLog returns the newest entry of a self-test log.
+func parseSelfTestLog(data []byte) (*selfTestLogEntry, bool) {
+	var testLog smartctlSelfTestLog
+	if err := json.Unmarshal(data, &testLog); err != nil {
+		return nil, false
+	}
+	if testLog.Ata != nil && len(testLog.Ata.Standard.Table) > 0 {
+		last := testLog.Ata.Standard.Table[0]
+		return &selfTestLogEntry{
+			TestType: last.Type.String,
+			Status:   last.Status.String,
+			Passed:   ataSelfTestPassed(&last.Status),
+			LBA:      last.LBA,
+		}, true
+	}
+	if testLog.Nvme != nil && len(testLog.Nvme.Table) > 0 {
+		last := testLog.Nvme.Table[0]
+		entry := &selfTestLogEntry{
+			TestType: last.Code.String,
+			Status:   last.Result.String,
+			LBA:      last.LBA,
+		}
+		switch last.Result.Value {
+		case 0:
+			entry.Passed = new(true)
+		case 5, 6, 7: // fatal error, unknown segment failure, failed segments
+			entry.Passed = new(false)
+		}
+		return entry, true
+	}
+	return nil, false
+}
+
+// addLastSelfTest completes the status of a finished test with the newest
+// entry of the self-test log.
+func (s *smartService) addLastSelfTest(ctx context.Context, devicePath string, status *dto.SmartTestStatus) {
+	if s.executor == nil {
+		return
+	}
+	snapshot, err := s.executor.ExecuteQuiet(ctx, "smartctl-selftest-log", "SMART self-test log", "smartctl", "--json=c", "-l", "selftest", devicePath)
+	// smartctl exits with an error bit set when the log holds failed tests
+	var out strings.Builder
+	for _, line := range snapshot.Lines {
+		if line.Channel == dto.CommandOutputChannelStdout {
+			out.WriteString(line.Line)
+		}
+	}
+	entry, ok := parseSelfTestLog([]byte(out.String()))
+	if !ok {
+		if err != nil {
+			tlog.DebugContext(ctx, "Failed to read SMART self-test log", "device", devicePath, "error", err)
+		}
+		return
+	}
+	if status.Status == "idle" || status.Status == "unknown" {
+		status.Status = entry.Status
+		lt := strings.ToLower(entry.TestType)
+		switch {
+		case strings.Contains(lt, "short"):
+			status.TestType = "short"
+		case strings.Contains(lt, "extended"), strings.Contains(lt, "long"):
+			status.TestType = "long"
+		case strings.Contains(lt, "conveyance"):
+			status.TestType = "conveyance"
+		}
+	}
+	if status.Passed == nil {
+		status.Passed = entry.Passed
+	}
+	if entry.LBA != nil && entry.Passed != nil && !*entry.Passed {
+		status.LBAOfFirstError = strconv.FormatInt(*entry.LBA, 10)
+	}
+}
+
 // EnableSMART enables SMART functionality on the device
 func (s *smartService) EnableSMART(ctx context.Context, deviceId string) errors.E {
 	s.mutex.Lock()
@@ -3,11 +3,13 @@ package service
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/dianlight/srat/dto"
 	"github.com/dianlight/srat/events"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gitlab.com/tozd/go/errors"
 )
 
 // TestRecordLibSmartBackendOutcome covers the shared capability recorder used by
@@ -65,3 +67,77 @@ func TestNewSmartServiceWithoutClientRecordsBackendOutcome(t *testing.T) {
 	assert.False(t, apiCtx.LibSmartAvailable, "without a bundled .so the lib backend cannot be available")
 	assert.NotEmpty(t, apiCtx.LibSmartUnavailableReason, "a reason for the fallback must be recorded")
 }
+
+func TestParseSelfTestLog(t *testing.T) {
+	t.Run("ata read failure", func(t *testing.T) {
+		entry, ok := parseSelfTestLog([]byte(`{"ata_smart_self_test_log":{"standard":{"table":[
+			{"type":{"value":2,"string":"Extended offline"},"status":{"value":121,"string":"Completed: read failure","passed":false},"lba":123456},
+			{"type":{"value":1,"string":"Short offline"},"status":{"value":0,"string":"Completed without error","passed":true}}
+		]}}}`))
+		require.True(t, ok)
+		assert.Equal(t, "Extended offline", entry.TestType)
+		assert.Equal(t, "Completed: read failure", entry.Status)
+		require.NotNil(t, entry.Passed)
+		assert.False(t, *entry.Passed)
+		require.NotNil(t, entry.LBA)
+		assert.Equal(t, int64(123456), *entry.LBA)
+	})
+
+	t.Run("ata aborted", func(t *testing.T) {
+		entry, ok := parseSelfTestLog([]byte(`{"ata_smart_self_test_log":{"standard":{"table":[
+			{"type":{"string":"Short offline"},"status":{"value":16,"string":"Aborted by host"}}
+		]}}}`))
+		require.True(t, ok)
+		assert.Nil(t, entry.Passed)
+	})
+
+	t.Run("nvme passed", func(t *testing.T) {
+		entry, ok := parseSelfTestLog([]byte(`{"nvme_self_test_log":{"table":[
+			{"self_test_code":{"value":1,"string":"Short"},"self_test_result":{"value":0,"string":"Completed without error"}}
+		]}}`))
+		require.True(t, ok)
+		assert.Equal(t, "Short", entry.TestType)
+		require.NotNil(t, entry.Passed)
+		assert.True(t, *entry.Passed)
+	})
+
+	t.Run("empty log", func(t *testing.T) {
+		_, ok := parseSelfTestLog([]byte(`{"ata_smart_self_test_log":{"standard":{"table":[]}}}`))
+		assert.False(t, ok)
+		_, ok = parseSelfTestLog([]byte(`not json`))
+		assert.False(t, ok)
+	})
+}
+
+// recordingStatsHistory keeps the samples recorded.
+type recordingStatsHistory struct {
+	StatsHistoryServiceInterface
+	samples []dto.StatsSample
+}
+
+func (h *recordingStatsHistory) Record(_ context.Context, _ time.Time, samples ...dto.StatsSample) errors.E {
+	h.samples = append(h.samples, samples...)
+	return nil
+}
+
+func TestRecordHistoryStoresRawAttributeValues(t *testing.T) {
+	history := &recordingStatsHistory{}
+	svc := &smartService{statsHistory: history}
+
+	svc.recordHistory(context.Background(), "sda", &dto.SmartStatus{
+		Enabled: true,
+		Additional: map[string]dto.SmartRangeValue{
+			"Reallocated_Sector_Ct": {Code: 5, Value: 100, Raw: 8},
+		},
+	})
+
+	var found bool
+	for _, sample := range history.samples {
+		if sample.Metric == dto.StatsSmartAttribute {
+			found = true
+			assert.Equal(t, "sda/Reallocated_Sector_Ct", sample.Series)
+			assert.Equal(t, float64(8), sample.Value)
+		}
+	}
+	assert.True(t, found)
+}
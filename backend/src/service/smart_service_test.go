@@ -582,6 +582,22 @@ func (suite *SmartServiceSuite) TestStartSelfTestSuccess() {
 	suite.NoError(err)
 }
 
+func (suite *SmartServiceSuite) TestBeginSelfTestDoesNotWait() {
+	tempFile, _ := os.CreateTemp("", "testdevice")
+	defer os.Remove(tempFile.Name())
+
+	mock.When(suite.smartClient.RunSelfTest(mock.Any[context.Context](), mock.Exact(tempFile.Name()), mock.Exact("long"))).ThenReturn(nil)
+	suite.service.MockDeviceToDevice(func(deviceId string) (string, error) {
+		return tempFile.Name(), nil
+	})
+
+	err := suite.service.BeginSelfTest(context.Background(), "sda", dto.SmartTestTypes.SMARTTESTTYPELONG)
+
+	suite.NoError(err)
+	mock.Verify(suite.smartClient, matchers.Times(1)).RunSelfTest(mock.Any[context.Context](), mock.Exact(tempFile.Name()), mock.Exact("long"))
+	mock.Verify(suite.smartClient, matchers.Times(0)).RunSelfTestWithProgress(mock.Any[context.Context](), mock.Any[string](), mock.Any[string](), mock.Any[smartmontools.ProgressCallback]())
+}
+
 func (suite *SmartServiceSuite) TestEnableDisableSMARTDeviceNotExist() {
 
 	suite.service.MockDeviceToDevice(func(deviceId string) (string, error) {
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"gorm.io/gorm"
+)
+
+// smartTestPollInterval is how often a self-test waiting for its turn checks
+// again, and how often a running one is polled. The first poll comes one
+// interval after the start, so that the result of the previous test is not
+// taken for its own.
+var smartTestPollInterval = time.Minute
+
+// smartTestRun is a self-test running on a disk.
+type smartTestRun struct {
+	diskId    string
+	testType  dto.SmartTestType
+	trigger   dto.JobTrigger
+	group     string
+	startedAt time.Time
+}
+
+// runSmartSelfTest runs a self-test of the disk job.Target and relays its
+// progress. The test waits while another test runs on the disk or on a disk
+// of its group, and while HDIdle keeps the disk spun down unless the
+// schedule of the disk forces it (see SmartTestService). The disk runs the
+// test on its own: it is started without waiting and polled until it ends,
+// then its result is recorded.
+func (s *JobService) runSmartSelfTest(ctx context.Context, job dto.Job, jobRun dto.JobRun, progress func(int)) (string, errors.E) {
+	testType, errE := jobSmartTestType(job)
+	if errE != nil {
+		return "", errE
+	}
+	schedule, err := gorm.G[dbom.SmartTestSchedule](s.db).Where(g.SmartTestSchedule.DiskID.Eq(job.Target)).First(ctx)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", errors.Wrapf(err, "failed to get SMART test schedule of %s", job.Target)
+	}
+
+	run := smartTestRun{diskId: job.Target, testType: testType, trigger: jobRun.Trigger, group: schedule.Group}
+	for !s.claimSmartTest(job.ID, run, schedule.Force) {
+		if err := sleepContext(ctx, smartTestPollInterval); err != nil {
+			return "", err
+		}
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.smartTests, job.ID)
+		s.mu.Unlock()
+	}()
+
+	run.startedAt = s.now()
+	if err := s.smartService.BeginSelfTest(ctx, run.diskId, testType); err != nil {
+		return "", err
+	}
+	tlog.InfoContext(ctx, "SMART self-test started", "disk", run.diskId, "type", testType, "trigger", run.trigger)
+
+	for {
+		if err := sleepContext(ctx, smartTestPollInterval); err != nil {
+			return "", err
+		}
+		status, err := s.smartService.GetTestStatus(ctx, run.diskId)
+		switch {
+		case err != nil && s.now().Sub(run.startedAt) < smartTestTimeout:
+			tlog.DebugContext(ctx, "Failed to poll SMART self-test", "disk", run.diskId, "error", err)
+			continue
+		case err != nil:
+			status = &dto.SmartTestStatus{Status: "no longer reported by the disk"}
+		case status == nil:
+			continue
+		}
+		status.DiskId = run.diskId
+		status.TestType = testType.String()
+		s.eventBus.EmitSmart(events.SmartEvent{
+			Event:           events.Event{Type: events.EventTypes.UPDATE},
+			SmartTestStatus: *status,
+		})
+		if status.Running {
+			progress(status.PercentComplete)
+			continue
+		}
+
+		result := s.recordSmartTest(ctx, run, status)
+		if result.Outcome == dto.SmartTestOutcomeFailed {
+			return "", errors.Errorf("SMART %s self-test of %s failed: %s", testType, run.diskId, result.Status)
+		}
+		return fmt.Sprintf("SMART %s self-test of %s %s: %s", testType, run.diskId, result.Outcome, result.Status), nil
+	}
+}
+
+// claimSmartTest reserves the disk of run and its group for job, when no
+// other test runs on them and the disk may be tested.
+func (s *JobService) claimSmartTest(jobID uint, run smartTestRun, force bool) bool {
+	if !force && s.spunDown(run.diskId) {
+		tlog.DebugContext(s.ctx, "SMART self-test deferred, disk is spun down", "disk", run.diskId, "type", run.testType)
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.smartTests {
+		if other.diskId == run.diskId || (run.group != "" && other.group == run.group) {
+			return false
+		}
+	}
+	s.smartTests[jobID] = run
+	return true
+}
+
+// spunDown tells whether HDIdle spun the disk down.
+func (s *JobService) spunDown(diskId string) bool {
+	if s.hdidleService == nil {
+		return false
+	}
+	path, err := s.hdidleService.ResolveDevicePath(diskId)
+	if err != nil {
+		return false
+	}
+	status, err := s.hdidleService.GetDeviceStatus(path)
+	return err == nil && status != nil && status.SpunDown
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) errors.E {
+	select {
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// recordSmartTest stores the result of a test and raises or dismisses its
+// Problem.
+func (s *JobService) recordSmartTest(ctx context.Context, run smartTestRun, status *dto.SmartTestStatus) dbom.SmartTestResult {
+	result := dbom.SmartTestResult{
+		DiskID:          run.diskId,
+		TestType:        run.testType,
+		Trigger:         run.trigger,
+		Outcome:         smartTestOutcome(status),
+		Status:          status.Status,
+		LBAOfFirstError: status.LBAOfFirstError,
+		StartedAt:       run.startedAt.UTC(),
+		FinishedAt:      s.now().UTC(),
+	}
+	if err := gorm.G[dbom.SmartTestResult](s.db).Create(ctx, &result); err != nil {
+		tlog.WarnContext(ctx, "Failed to store SMART self-test result", "disk", run.diskId, "error", err)
+	} else {
+		s.pruneSmartTests(ctx, run.diskId)
+	}
+	tlog.InfoContext(ctx, "SMART self-test ended", "disk", run.diskId, "type", run.testType, "outcome", result.Outcome, "status", result.Status)
+	s.updateSmartTestProblem(ctx, result)
+	return result
+}
+
+func smartTestOutcome(status *dto.SmartTestStatus) dto.SmartTestOutcome {
+	if status.Passed != nil {
+		if *status.Passed {
+			return dto.SmartTestOutcomePassed
+		}
+		return dto.SmartTestOutcomeFailed
+	}
+	if ls := strings.ToLower(status.Status); strings.Contains(ls, "abort") || strings.Contains(ls, "interrupt") {
+		return dto.SmartTestOutcomeAborted
+	}
+	return dto.SmartTestOutcomeUnknown
+}
+
+// pruneSmartTests keeps only the last smartTestHistoryLimit results of a
+// disk.
+func (s *JobService) pruneSmartTests(ctx context.Context, diskId string) {
+	err := s.db.WithContext(ctx).
+		Where("disk_id = ? AND id NOT IN (?)", diskId,
+			s.db.Model(&dbom.SmartTestResult{}).Select("id").Where("disk_id = ?", diskId).Order("id DESC").Limit(smartTestHistoryLimit)).
+		Delete(&dbom.SmartTestResult{}).Error
+	if err != nil {
+		tlog.WarnContext(ctx, "Failed to prune SMART self-test history", "disk", diskId, "error", err)
+	}
+}
+
+// updateSmartTestProblem raises a critical Problem for a failed test, a
+// later passed test of the disk dismisses it.
+func (s *JobService) updateSmartTestProblem(ctx context.Context, result dbom.SmartTestResult) {
+	if s.problemService == nil {
+		return
+	}
+	key := smartTestProblemKey(result.DiskID)
+	switch result.Outcome {
+	case dto.SmartTestOutcomeFailed:
+		description := fmt.Sprintf("The %s SMART self-test of disk %s failed: %s.", result.TestType, result.DiskID, result.Status)
+		if result.LBAOfFirstError != "" {
+			description = fmt.Sprintf("The %s SMART self-test of disk %s failed at LBA %s: %s.", result.TestType, result.DiskID, result.LBAOfFirstError, result.Status)
+		}
+		_, err := s.problemService.Upsert(&dto.Problem{
+			ProblemKey:     key,
+			Title:          fmt.Sprintf("SMART self-test of disk %s failed", result.DiskID),
+			Description:    description,
+			Severity:       dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL,
+			Status:         dto.ProblemLifecycleStatuses.PROBLEMLIFECYCLESTATUSCREATED,
+			TranslationKey: smartTestProblemTranslationKey,
+			IsPersistent:   true,
+		})
+		if err != nil {
+			tlog.WarnContext(ctx, "Unable to upsert SMART self-test problem", "disk", result.DiskID, "error", err)
+		}
+	case dto.SmartTestOutcomePassed:
+		if err := s.problemService.Dismiss(key); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			tlog.WarnContext(ctx, "Unable to dismiss SMART self-test problem", "disk", result.DiskID, "error", err)
+		}
+	}
+}
+
+func smartTestProblemKey(diskId string) string {
+	return "smart_self_test_" + diskId
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// smartTestTimeout is when a test the disk never reported as ended is
+	// recorded with an unknown outcome, freeing its group.
+	smartTestTimeout = 24 * time.Hour
+	// smartTestHistoryLimit is the number of results kept per disk.
+	smartTestHistoryLimit = 100
+)
+
+// smartTestProblemTranslationKey is shared by every failed self-test Problem,
+// the key itself carries the disk.
+const smartTestProblemTranslationKey = "smart_self_test_failed"
+
+type SmartTestServiceInterface interface {
+	// GetSchedule returns the self-test schedule of a disk, the disabled
+	// defaults when it has none.
+	GetSchedule(diskId string) (*dto.SmartTestSchedule, errors.E)
+	SetSchedule(diskId string, schedule dto.SmartTestSchedule) (*dto.SmartTestSchedule, errors.E)
+	// ListResults returns the completed self-tests of a disk, newest first.
+	ListResults(diskId string, limit int) ([]dto.SmartTestResult, errors.E)
+}
+
+// SmartTestService keeps the self-test schedules of the disks. Each test of
+// a schedule is a smart_self_test job of JobService, which runs it.
+type SmartTestService struct {
+	ctx        context.Context
+	db         *gorm.DB
+	jobService JobServiceInterface
+}
+
+type SmartTestServiceParams struct {
+	fx.In
+	Ctx        context.Context
+	Db         *gorm.DB
+	JobService JobServiceInterface
+}
+
+func NewSmartTestService(in SmartTestServiceParams) SmartTestServiceInterface {
+	return &SmartTestService{
+		ctx:        in.Ctx,
+		db:         in.Db,
+		jobService: in.JobService,
+	}
+}
+
+// smartTestJobName is the name of the job running the testType self-tests
+// of a disk.
+func smartTestJobName(diskId string, testType dto.SmartTestType) string {
+	return fmt.Sprintf("SMART %s self-test of %s", testType, diskId)
+}
+
+// smartTestSpecs returns the cron expressions of a schedule by test type.
+func smartTestSpecs(schedule dbom.SmartTestSchedule) map[dto.SmartTestType]string {
+	specs := make(map[dto.SmartTestType]string, 2)
+	if schedule.ShortSchedule != "" {
+		specs[dto.SmartTestTypes.SMARTTESTTYPESHORT] = schedule.ShortSchedule
+	}
+	if schedule.LongSchedule != "" {
+		specs[dto.SmartTestTypes.SMARTTESTTYPELONG] = schedule.LongSchedule
+	}
+	return specs
+}
+
+// smartTestJobs returns the jobs of the schedule of a disk by test type.
+func (s *SmartTestService) smartTestJobs(diskId string) (map[dto.SmartTestType]dto.Job, errors.E) {
+	jobs, err := s.jobService.ListJobs()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[dto.SmartTestType]dto.Job, 2)
+	for _, job := range jobs {
+		for _, testType := range []dto.SmartTestType{dto.SmartTestTypes.SMARTTESTTYPESHORT, dto.SmartTestTypes.SMARTTESTTYPELONG} {
+			if job.Type == dto.JobTypeSmartSelfTest && job.Name == smartTestJobName(diskId, testType) {
+				ret[testType] = job
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (s *SmartTestService) GetSchedule(diskId string) (*dto.SmartTestSchedule, errors.E) {
+	schedule, err := gorm.G[dbom.SmartTestSchedule](s.db).Where(g.SmartTestSchedule.DiskID.Eq(diskId)).First(s.ctx)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.Wrapf(err, "failed to get SMART test schedule of %s", diskId)
+		}
+		schedule = dbom.SmartTestSchedule{
+			DiskID:        diskId,
+			ShortSchedule: dto.SmartTestDefaultShortSchedule,
+			LongSchedule:  dto.SmartTestDefaultLongSchedule,
+		}
+	}
+	ret := &dto.SmartTestSchedule{
+		DiskId:        schedule.DiskID,
+		Enabled:       schedule.Enabled,
+		ShortSchedule: schedule.ShortSchedule,
+		LongSchedule:  schedule.LongSchedule,
+		Group:         schedule.Group,
+		Force:         schedule.Force,
+	}
+	if schedule.Enabled {
+		jobs, errE := s.smartTestJobs(diskId)
+		if errE != nil {
+			return nil, errE
+		}
+		ret.NextShortAt = jobs[dto.SmartTestTypes.SMARTTESTTYPESHORT].NextRunAt
+		ret.NextLongAt = jobs[dto.SmartTestTypes.SMARTTESTTYPELONG].NextRunAt
+	}
+	return ret, nil
+}
+
+func (s *SmartTestService) SetSchedule(diskId string, schedule dto.SmartTestSchedule) (*dto.SmartTestSchedule, errors.E) {
+	row := dbom.SmartTestSchedule{
+		DiskID:        diskId,
+		Enabled:       schedule.Enabled,
+		ShortSchedule: strings.TrimSpace(schedule.ShortSchedule),
+		LongSchedule:  strings.TrimSpace(schedule.LongSchedule),
+		Group:         strings.TrimSpace(schedule.Group),
+		Force:         schedule.Force,
+	}
+	specs := smartTestSpecs(row)
+	for _, spec := range specs {
+		if _, err := parseJobSchedule(spec); err != nil {
+			return nil, err
+		}
+	}
+	if row.Enabled && len(specs) == 0 {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "disk", diskId, "reason", "an enabled schedule needs a short or a long test")
+	}
+
+	err := gorm.G[dbom.SmartTestSchedule](s.db, clause.OnConflict{UpdateAll: true}).Create(s.ctx, &row)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to save SMART test schedule of %s", diskId)
+	}
+	if errE := s.syncJobs(row, specs); errE != nil {
+		return nil, errE
+	}
+	tlog.InfoContext(s.ctx, "SMART test schedule saved", "disk", diskId, "enabled", row.Enabled, "short", row.ShortSchedule, "long", row.LongSchedule, "group", row.Group)
+	return s.GetSchedule(diskId)
+}
+
+// syncJobs creates, updates or deletes the jobs of a schedule so that there
+// is one per test type with a cron expression.
+func (s *SmartTestService) syncJobs(row dbom.SmartTestSchedule, specs map[dto.SmartTestType]string) errors.E {
+	jobs, errE := s.smartTestJobs(row.DiskID)
+	if errE != nil {
+		return errE
+	}
+	for _, testType := range []dto.SmartTestType{dto.SmartTestTypes.SMARTTESTTYPESHORT, dto.SmartTestTypes.SMARTTESTTYPELONG} {
+		existing, found := jobs[testType]
+		spec, scheduled := specs[testType]
+		if !scheduled {
+			if found {
+				if errE := s.jobService.DeleteJob(existing.ID); errE != nil {
+					return errE
+				}
+			}
+			continue
+		}
+		job := dto.Job{
+			Name:     smartTestJobName(row.DiskID, testType),
+			Type:     dto.JobTypeSmartSelfTest,
+			Schedule: spec,
+			Target:   row.DiskID,
+			Options:  map[string]string{"test_type": testType.String()},
+			Enabled:  row.Enabled,
+		}
+		if found {
+			_, errE = s.jobService.UpdateJob(existing.ID, job)
+		} else {
+			_, errE = s.jobService.CreateJob(job)
+		}
+		if errE != nil {
+			return errE
+		}
+	}
+	return nil
+}
+
+func (s *SmartTestService) ListResults(diskId string, limit int) ([]dto.SmartTestResult, errors.E) {
+	if limit <= 0 || limit > smartTestHistoryLimit {
+		limit = smartTestHistoryLimit
+	}
+	rows, err := gorm.G[dbom.SmartTestResult](s.db).
+		Where(g.SmartTestResult.DiskID.Eq(diskId)).
+		Order(g.SmartTestResult.ID.Desc()).
+		Limit(limit).
+		Find(s.ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list SMART self-tests of %s", diskId)
+	}
+	results := make([]dto.SmartTestResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, dto.SmartTestResult{
+			ID:              row.ID,
+			DiskId:          row.DiskID,
+			TestType:        row.TestType,
+			Trigger:         row.Trigger,
+			Outcome:         row.Outcome,
+			Status:          row.Status,
+			LBAOfFirstError: row.LBAOfFirstError,
+			StartedAt:       row.StartedAt,
+			FinishedAt:      row.FinishedAt,
+		})
+	}
+	return results, nil
+}
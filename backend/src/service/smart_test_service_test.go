@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/events"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+type SmartTestServiceSuite struct {
+	suite.Suite
+	app            *fxtest.App
+	db             *gorm.DB
+	smartService   SmartServiceInterface
+	hdidleService  HDIdleServiceInterface
+	problemService ProblemServiceInterface
+	jobService     *JobService
+	service        *SmartTestService
+	pollInterval   time.Duration
+
+	mu       sync.Mutex
+	now      time.Time
+	begun    []string                           // disks a test was started on, in order
+	ended    map[string]*dto.SmartTestStatus    // disks whose test ended
+	statuses map[string]*dto.HDIdleDeviceStatus // spin state by device path
+}
+
+func TestSmartTestServiceSuite(t *testing.T) {
+	suite.Run(t, new(SmartTestServiceSuite))
+}
+
+func (suite *SmartTestServiceSuite) SetupTest() {
+	var jobService JobServiceInterface
+	var smartTestService SmartTestServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+				}
+			},
+			dbom.NewDB,
+			events.NewEventBus,
+			mock.Mock[SmartServiceInterface],
+			mock.Mock[FilesystemServiceInterface],
+			mock.Mock[ShareServiceInterface],
+			mock.Mock[RecycleBinServiceInterface],
+			mock.Mock[ReplicationServiceInterface],
+			mock.Mock[HDIdleServiceInterface],
+			mock.Mock[ProblemServiceInterface],
+			NewJobService,
+			NewSmartTestService,
+		),
+		fx.Populate(&suite.db),
+		fx.Populate(&suite.smartService),
+		fx.Populate(&suite.hdidleService),
+		fx.Populate(&suite.problemService),
+		fx.Populate(&jobService),
+		fx.Populate(&smartTestService),
+	)
+	suite.app.RequireStart()
+	suite.Require().NoError(suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&dbom.JobRun{}).Error)
+	suite.Require().NoError(suite.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&dbom.ScheduledJob{}).Error)
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.SmartTestSchedule{}).Error)
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.SmartTestResult{}).Error)
+
+	suite.pollInterval = smartTestPollInterval
+	smartTestPollInterval = time.Millisecond
+
+	suite.now = time.Date(2026, 2, 1, 1, 30, 0, 0, time.UTC)
+	suite.begun = nil
+	suite.ended = map[string]*dto.SmartTestStatus{}
+	suite.statuses = map[string]*dto.HDIdleDeviceStatus{}
+	suite.jobService = jobService.(*JobService)
+	suite.jobService.now = func() time.Time {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		return suite.now
+	}
+	suite.service = smartTestService.(*SmartTestService)
+
+	mock.When(suite.smartService.BeginSelfTest(mock.AnyContext(), mock.Any[string](), mock.Any[dto.SmartTestType]())).ThenAnswer(func(args []any) []any {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		suite.begun = append(suite.begun, args[1].(string))
+		return []any{nil}
+	})
+	mock.When(suite.smartService.GetTestStatus(mock.AnyContext(), mock.Any[string]())).ThenAnswer(func(args []any) []any {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		if status, ok := suite.ended[args[1].(string)]; ok {
+			return []any{status, nil}
+		}
+		return []any{&dto.SmartTestStatus{Running: true, PercentComplete: 40}, nil}
+	})
+	mock.When(suite.hdidleService.ResolveDevicePath(mock.Any[string]())).ThenAnswer(func(args []any) []any {
+		return []any{"/dev/" + args[0].(string), nil}
+	})
+	mock.When(suite.hdidleService.GetDeviceStatus(mock.Any[string]())).ThenAnswer(func(args []any) []any {
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		if status, ok := suite.statuses[args[0].(string)]; ok {
+			return []any{status, nil}
+		}
+		return []any{&dto.HDIdleDeviceStatus{}, nil}
+	})
+	mock.When(suite.problemService.Upsert(mock.Any[*dto.Problem]())).ThenAnswer(func(args []any) []any {
+		return []any{args[0], nil}
+	})
+	mock.When(suite.problemService.Dismiss(mock.Any[string]())).ThenReturn(gorm.ErrRecordNotFound)
+}
+
+func (suite *SmartTestServiceSuite) TearDownTest() {
+	suite.mu.Lock()
+	for _, disk := range []string{"sda", "sdb", "sdc"} {
+		if _, ok := suite.ended[disk]; !ok {
+			suite.ended[disk] = &dto.SmartTestStatus{Status: "Aborted by host"}
+		}
+	}
+	suite.statuses = map[string]*dto.HDIdleDeviceStatus{}
+	suite.mu.Unlock()
+	suite.jobService.wg.Wait()
+	smartTestPollInterval = suite.pollInterval
+	suite.app.RequireStop()
+}
+
+func (suite *SmartTestServiceSuite) setSchedule(disk string, schedule dto.SmartTestSchedule) {
+	_, err := suite.service.SetSchedule(disk, schedule)
+	suite.Require().NoError(err)
+}
+
+// at moves the clock and starts the due jobs.
+func (suite *SmartTestServiceSuite) at(now time.Time) {
+	suite.mu.Lock()
+	suite.now = now
+	suite.mu.Unlock()
+	suite.Require().NoError(suite.jobService.runDueJobs())
+}
+
+func (suite *SmartTestServiceSuite) end(disk string, status *dto.SmartTestStatus) {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	suite.ended[disk] = status
+}
+
+func (suite *SmartTestServiceSuite) begunOn() []string {
+	suite.mu.Lock()
+	defer suite.mu.Unlock()
+	return slices.Clone(suite.begun)
+}
+
+// settle gives the waiting runs a few polls to move.
+func (suite *SmartTestServiceSuite) settle() {
+	time.Sleep(20 * smartTestPollInterval)
+}
+
+func (suite *SmartTestServiceSuite) TestScheduledTestRuns() {
+	suite.setSchedule("sda", dto.SmartTestSchedule{Enabled: true, ShortSchedule: dto.SmartTestDefaultShortSchedule})
+
+	schedule, err := suite.service.GetSchedule("sda")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(schedule.NextShortAt)
+	suite.Equal(time.Date(2026, 2, 1, 2, 0, 0, 0, time.UTC), *schedule.NextShortAt)
+	suite.Nil(schedule.NextLongAt)
+
+	suite.at(time.Date(2026, 2, 1, 1, 59, 0, 0, time.UTC))
+	suite.jobService.wg.Wait()
+	suite.Empty(suite.begunOn())
+
+	passed := true
+	suite.end("sda", &dto.SmartTestStatus{Status: "Completed without error", Passed: &passed})
+	suite.at(time.Date(2026, 2, 1, 2, 0, 0, 0, time.UTC))
+	suite.jobService.wg.Wait()
+	suite.Equal([]string{"sda"}, suite.begunOn())
+	mock.Verify(suite.smartService, matchers.Times(0)).StartSelfTest(mock.AnyContext(), mock.Any[string](), mock.Any[dto.SmartTestType]())
+
+	results, err := suite.service.ListResults("sda", 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal(dto.SmartTestOutcomePassed, results[0].Outcome)
+	suite.Equal(dto.JobTriggerSchedule, results[0].Trigger)
+	suite.Equal(dto.SmartTestTypes.SMARTTESTTYPESHORT, results[0].TestType)
+	mock.Verify(suite.problemService, matchers.Times(1)).Dismiss(mock.Exact("smart_self_test_sda"))
+
+	jobs, errE := suite.service.smartTestJobs("sda")
+	suite.Require().NoError(errE)
+	runs, errE := suite.jobService.ListJobRuns(jobs[dto.SmartTestTypes.SMARTTESTTYPESHORT].ID)
+	suite.Require().NoError(errE)
+	suite.Require().Len(runs, 1)
+	suite.Equal(dto.JobRunStatusSuccess, runs[0].Status)
+}
+
+func (suite *SmartTestServiceSuite) TestGroupIsStaggered() {
+	for _, disk := range []string{"sda", "sdb", "sdc"} {
+		group := "usb-hub-1"
+		if disk == "sdc" {
+			group = ""
+		}
+		suite.setSchedule(disk, dto.SmartTestSchedule{Enabled: true, LongSchedule: dto.SmartTestDefaultLongSchedule, Group: group})
+	}
+
+	suite.at(time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC))
+	suite.Eventually(func() bool { return len(suite.begunOn()) == 2 }, time.Second, smartTestPollInterval)
+	suite.settle()
+	begun := suite.begunOn()
+	suite.Require().Len(begun, 2, "the second disk of the group waits")
+	suite.Contains(begun, "sdc")
+	first := begun[0]
+	if first == "sdc" {
+		first = begun[1]
+	}
+	second := map[string]string{"sda": "sdb", "sdb": "sda"}[first]
+
+	suite.end(first, &dto.SmartTestStatus{Status: "Aborted by host"})
+	suite.Eventually(func() bool { return slices.Contains(suite.begunOn(), second) }, time.Second, smartTestPollInterval)
+
+	suite.end(second, &dto.SmartTestStatus{Status: "Aborted by host"})
+	suite.end("sdc", &dto.SmartTestStatus{Status: "Aborted by host"})
+	suite.jobService.wg.Wait()
+	results, err := suite.service.ListResults(first, 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal(dto.SmartTestOutcomeAborted, results[0].Outcome)
+}
+
+func (suite *SmartTestServiceSuite) TestSpunDownDiskIsDeferred() {
+	suite.mu.Lock()
+	suite.statuses["/dev/sda"] = &dto.HDIdleDeviceStatus{SpunDown: true}
+	suite.statuses["/dev/sdb"] = &dto.HDIdleDeviceStatus{SpunDown: true}
+	suite.mu.Unlock()
+	suite.setSchedule("sda", dto.SmartTestSchedule{Enabled: true, ShortSchedule: dto.SmartTestDefaultShortSchedule})
+	suite.setSchedule("sdb", dto.SmartTestSchedule{Enabled: true, ShortSchedule: dto.SmartTestDefaultShortSchedule, Force: true})
+
+	suite.at(time.Date(2026, 2, 1, 2, 0, 0, 0, time.UTC))
+	suite.Eventually(func() bool { return slices.Contains(suite.begunOn(), "sdb") }, time.Second, smartTestPollInterval)
+	suite.settle()
+	suite.NotContains(suite.begunOn(), "sda")
+
+	suite.mu.Lock()
+	delete(suite.statuses, "/dev/sda")
+	suite.mu.Unlock()
+	suite.Eventually(func() bool { return slices.Contains(suite.begunOn(), "sda") }, time.Second, smartTestPollInterval)
+}
+
+func (suite *SmartTestServiceSuite) TestFailedTestRaisesProblem() {
+	passed := false
+	suite.end("sda", &dto.SmartTestStatus{
+		Status:          "Completed: read failure",
+		Passed:          &passed,
+		LBAOfFirstError: "123456",
+	})
+	suite.setSchedule("sda", dto.SmartTestSchedule{Enabled: true, LongSchedule: dto.SmartTestDefaultLongSchedule})
+	jobs, errE := suite.service.smartTestJobs("sda")
+	suite.Require().NoError(errE)
+	job := jobs[dto.SmartTestTypes.SMARTTESTTYPELONG]
+
+	_, errE = suite.jobService.RunJob(job.ID)
+	suite.Require().NoError(errE)
+	suite.jobService.wg.Wait()
+
+	results, err := suite.service.ListResults("sda", 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal(dto.SmartTestOutcomeFailed, results[0].Outcome)
+	suite.Equal(dto.JobTriggerManual, results[0].Trigger)
+	suite.Equal(dto.SmartTestTypes.SMARTTESTTYPELONG, results[0].TestType)
+	suite.Equal("123456", results[0].LBAOfFirstError)
+
+	captor := mock.Captor[*dto.Problem]()
+	mock.Verify(suite.problemService, matchers.Times(1)).Upsert(captor.Capture())
+	problem := captor.Last()
+	suite.Equal("smart_self_test_sda", problem.ProblemKey)
+	suite.Equal(dto.ProblemSeverities.PROBLEMSEVERITYCRITICAL, problem.Severity)
+	suite.Equal("The long SMART self-test of disk sda failed at LBA 123456: Completed: read failure.", problem.Description)
+
+	runs, errE := suite.jobService.ListJobRuns(job.ID)
+	suite.Require().NoError(errE)
+	suite.Require().Len(runs, 1)
+	suite.Equal(dto.JobRunStatusFailure, runs[0].Status)
+}
+
+func (suite *SmartTestServiceSuite) TestSetSchedule() {
+	schedule, err := suite.service.GetSchedule("sda")
+	suite.Require().NoError(err)
+	suite.False(schedule.Enabled)
+	suite.Equal(dto.SmartTestDefaultShortSchedule, schedule.ShortSchedule)
+	suite.Equal(dto.SmartTestDefaultLongSchedule, schedule.LongSchedule)
+
+	_, err = suite.service.SetSchedule("sda", dto.SmartTestSchedule{Enabled: true, ShortSchedule: "every day"})
+	suite.ErrorIs(err, dto.ErrorInvalidParameter)
+	_, err = suite.service.SetSchedule("sda", dto.SmartTestSchedule{Enabled: true})
+	suite.ErrorIs(err, dto.ErrorInvalidParameter)
+
+	schedule, err = suite.service.SetSchedule("sda", dto.SmartTestSchedule{Enabled: true, ShortSchedule: "0 2 * * *", LongSchedule: "0 3 1 * *"})
+	suite.Require().NoError(err)
+	suite.NotNil(schedule.NextShortAt)
+	suite.NotNil(schedule.NextLongAt)
+	jobs, err := suite.service.smartTestJobs("sda")
+	suite.Require().NoError(err)
+	suite.Require().Len(jobs, 2)
+	long := jobs[dto.SmartTestTypes.SMARTTESTTYPELONG]
+	suite.Equal("sda", long.Target)
+	suite.Equal("0 3 1 * *", long.Schedule)
+	suite.Equal(map[string]string{"test_type": "long"}, long.Options)
+	suite.True(long.Enabled)
+
+	schedule, err = suite.service.SetSchedule("sda", dto.SmartTestSchedule{ShortSchedule: " 0 4 * * * ", Group: "psu"})
+	suite.Require().NoError(err)
+	suite.False(schedule.Enabled)
+	suite.Equal("0 4 * * *", schedule.ShortSchedule)
+	suite.Empty(schedule.LongSchedule)
+	suite.Equal("psu", schedule.Group)
+	suite.Nil(schedule.NextShortAt)
+
+	jobs, err = suite.service.smartTestJobs("sda")
+	suite.Require().NoError(err)
+	suite.Require().Len(jobs, 1, "the job of the removed long test is deleted")
+	short := jobs[dto.SmartTestTypes.SMARTTESTTYPESHORT]
+	suite.Equal("0 4 * * *", short.Schedule)
+	suite.False(short.Enabled)
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+)
+
+// snapshotCheckInterval is how often scheduled snapshots and retention are
+// evaluated. Snapshots are aligned on the hour, so a few minutes of delay is
+// harmless.
+const snapshotCheckInterval = 5 * time.Minute
+
+type SnapshotServiceInterface interface {
+	// ListSnapshots returns the snapshots of a share, newest first.
+	ListSnapshots(share string) ([]dto.Snapshot, errors.E)
+	// CreateSnapshot takes a snapshot of a share now.
+	CreateSnapshot(share string) (*dto.Snapshot, errors.E)
+	// DeleteSnapshot removes a snapshot of a share.
+	DeleteSnapshot(share, name string) errors.E
+	// RollbackSnapshot restores a share to one of its snapshots. It fails with
+	// dto.ErrorConflict when newer snapshots would be destroyed, unless
+	// destroyNewer is set.
+	RollbackSnapshot(share, name string, destroyNewer bool) errors.E
+	// ApplyRetention takes the scheduled snapshots that are due and prunes
+	// the ones outside the retention windows of every share.
+	ApplyRetention() errors.E
+}
+
+type SnapshotService struct {
+	ctx               context.Context
+	shareService      ShareServiceInterface
+	filesystemService FilesystemServiceInterface
+	now               func() time.Time
+
+	mu sync.Mutex // serializes snapshot changes
+}
+
+type SnapshotServiceParams struct {
+	fx.In
+	Ctx               context.Context
+	ShareService      ShareServiceInterface
+	FilesystemService FilesystemServiceInterface
+}
+
+func NewSnapshotService(lc fx.Lifecycle, in SnapshotServiceParams) SnapshotServiceInterface {
+	s := &SnapshotService{
+		ctx:               in.Ctx,
+		shareService:      in.ShareService,
+		filesystemService: in.FilesystemService,
+		now:               time.Now,
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok && wg != nil {
+				wg.Go(func() {
+					if err := s.run(); err != nil && !errors.Is(err, context.Canceled) {
+						slog.WarnContext(s.ctx, "SnapshotService run loop stopped with error", "error", err)
+					}
+				})
+			}
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *SnapshotService) run() errors.E {
+	for {
+		if err := s.ApplyRetention(); err != nil {
+			tlog.DebugContext(s.ctx, "Failed to apply snapshot retention", "error", err)
+		}
+		select {
+		case <-s.ctx.Done():
+			slog.DebugContext(s.ctx, "Run process closed", "err", s.ctx.Err())
+			return errors.WithStack(s.ctx.Err())
+		case <-time.After(snapshotCheckInterval):
+		}
+	}
+}
+
+// snapshotAdapter returns the snapshot capability of the filesystem behind a share.
+func (s *SnapshotService) snapshotAdapter(share dto.SharedResource) (filesystem.SnapshotAdapter, string, errors.E) {
+	path, errE := sharePath(share)
+	if errE != nil {
+		return nil, "", errE
+	}
+	if share.MountPointData.FSType == nil {
+		return nil, "", errors.WithDetails(dto.ErrorSnapshotNotSupported, "share", share.Name)
+	}
+	if share.SubPath != "" {
+		// A snapshot, and a rollback above all, covers the whole volume.
+		return nil, "", errors.WithDetails(dto.ErrorSnapshotNotSupported, "share", share.Name,
+			"reason", "snapshots cover the whole volume, not the sub path of the share")
+	}
+	adapter, err := s.filesystemService.GetAdapter(*share.MountPointData.FSType)
+	if err != nil {
+		return nil, "", errors.WithDetails(dto.ErrorSnapshotNotSupported, "share", share.Name, "fstype", *share.MountPointData.FSType)
+	}
+	snapshot, ok := filesystem.AsSnapshotAdapter(adapter)
+	if !ok {
+		return nil, "", errors.WithDetails(dto.ErrorSnapshotNotSupported, "share", share.Name, "fstype", *share.MountPointData.FSType)
+	}
+	return snapshot, path, nil
+}
+
+func (s *SnapshotService) shareSnapshotAdapter(name string) (filesystem.SnapshotAdapter, string, errors.E) {
+	share, errE := s.shareService.GetShare(name)
+	if errE != nil {
+		return nil, "", errE
+	}
+	return s.snapshotAdapter(*share)
+}
+
+func (s *SnapshotService) ListSnapshots(share string) ([]dto.Snapshot, errors.E) {
+	adapter, path, errE := s.shareSnapshotAdapter(share)
+	if errE != nil {
+		return nil, errE
+	}
+	return adapter.ListSnapshots(s.ctx, path)
+}
+
+func (s *SnapshotService) CreateSnapshot(share string) (*dto.Snapshot, errors.E) {
+	adapter, path, errE := s.shareSnapshotAdapter(share)
+	if errE != nil {
+		return nil, errE
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createSnapshot(adapter, path, share)
+}
+
+func (s *SnapshotService) createSnapshot(adapter filesystem.SnapshotAdapter, path, share string) (*dto.Snapshot, errors.E) {
+	snapshots, errE := adapter.ListSnapshots(s.ctx, path)
+	if errE != nil {
+		return nil, errE
+	}
+	now := s.now().UTC().Truncate(time.Second)
+	name := dto.SnapshotName(now)
+	for _, snapshot := range snapshots {
+		if snapshot.Name == name {
+			return nil, errors.WithDetails(dto.ErrorConflict, "share", share, "snapshot", name)
+		}
+	}
+	if err := adapter.CreateSnapshot(s.ctx, path, name); err != nil {
+		return nil, errors.Wrapf(err, "failed to snapshot share %s", share)
+	}
+	tlog.InfoContext(s.ctx, "Share snapshot created", "share", share, "snapshot", name)
+	return &dto.Snapshot{
+		Name:      name,
+		CreatedAt: now,
+		Path:      filepath.Join(path, adapter.SnapshotDir(), name),
+	}, nil
+}
+
+// findSnapshot fails with dto.ErrorSnapshotNotFound when name is not a
+// snapshot of the share.
+func (s *SnapshotService) findSnapshot(adapter filesystem.SnapshotAdapter, path, share, name string) errors.E {
+	snapshots, errE := adapter.ListSnapshots(s.ctx, path)
+	if errE != nil {
+		return errE
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Name == name {
+			return nil
+		}
+	}
+	return errors.WithDetails(dto.ErrorSnapshotNotFound, "share", share, "snapshot", name)
+}
+
+func (s *SnapshotService) DeleteSnapshot(share, name string) errors.E {
+	adapter, path, errE := s.shareSnapshotAdapter(share)
+	if errE != nil {
+		return errE
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.findSnapshot(adapter, path, share, name); err != nil {
+		return err
+	}
+	if err := adapter.DeleteSnapshot(s.ctx, path, name); err != nil {
+		return errors.Wrapf(err, "failed to delete snapshot %s of share %s", name, share)
+	}
+	tlog.InfoContext(s.ctx, "Share snapshot deleted", "share", share, "snapshot", name)
+	return nil
+}
+
+func (s *SnapshotService) RollbackSnapshot(share, name string, destroyNewer bool) errors.E {
+	adapter, path, errE := s.shareSnapshotAdapter(share)
+	if errE != nil {
+		return errE
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.findSnapshot(adapter, path, share, name); err != nil {
+		return err
+	}
+	if err := adapter.RollbackSnapshot(s.ctx, path, name, destroyNewer); err != nil {
+		return errors.Wrapf(err, "failed to roll back share %s to %s", share, name)
+	}
+	tlog.InfoContext(s.ctx, "Share rolled back to snapshot", "share", share, "snapshot", name)
+	return nil
+}
+
+func (s *SnapshotService) ApplyRetention() errors.E {
+	shares, errE := s.shareService.ListShares()
+	if errE != nil {
+		return errE
+	}
+	for _, share := range shares {
+		if !share.Snapshots.IsScheduled() || (share.Disabled != nil && *share.Disabled) {
+			continue
+		}
+		if err := s.applyShareRetention(share); err != nil {
+			tlog.WarnContext(s.ctx, "Unable to apply snapshot retention", "share", share.Name, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *SnapshotService) applyShareRetention(share dto.SharedResource) errors.E {
+	adapter, path, errE := s.snapshotAdapter(share)
+	if errE != nil {
+		return errE
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots, errE := adapter.ListSnapshots(s.ctx, path)
+	if errE != nil {
+		return errE
+	}
+	if snapshotDue(*share.Snapshots, snapshots, s.now()) {
+		snapshot, errE := s.createSnapshot(adapter, path, share.Name)
+		if errE != nil {
+			return errE
+		}
+		snapshots = append([]dto.Snapshot{*snapshot}, snapshots...)
+	}
+	for _, snapshot := range snapshotsToPrune(*share.Snapshots, snapshots) {
+		if err := adapter.DeleteSnapshot(s.ctx, path, snapshot.Name); err != nil {
+			return errors.Wrapf(err, "failed to prune snapshot %s of share %s", snapshot.Name, share.Name)
+		}
+		tlog.DebugContext(s.ctx, "Share snapshot pruned", "share", share.Name, "snapshot", snapshot.Name)
+	}
+	return nil
+}
+
+// snapshotBuckets maps a snapshot time to its hourly, daily and weekly
+// retention bucket.
+var snapshotBuckets = []func(time.Time) string{
+	func(t time.Time) string { return t.UTC().Format("2006-01-02T15") },
+	func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	func(t time.Time) string {
+		year, week := t.UTC().ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	},
+}
+
+func snapshotKeeps(policy dto.SnapshotPolicy) []uint {
+	return []uint{policy.KeepHourly, policy.KeepDaily, policy.KeepWeekly}
+}
+
+// snapshotDue reports whether the finest enabled window of the policy has no
+// snapshot in its current bucket. snapshots are sorted newest first.
+func snapshotDue(policy dto.SnapshotPolicy, snapshots []dto.Snapshot, now time.Time) bool {
+	for i, keep := range snapshotKeeps(policy) {
+		if keep == 0 {
+			continue
+		}
+		return len(snapshots) == 0 || snapshotBuckets[i](snapshots[0].CreatedAt) != snapshotBuckets[i](now)
+	}
+	return false
+}
+
+// snapshotsToPrune returns the snapshots outside every retention window. For
+// each window the newest snapshot of each of the last Keep* buckets is kept.
+// snapshots are sorted newest first.
+func snapshotsToPrune(policy dto.SnapshotPolicy, snapshots []dto.Snapshot) []dto.Snapshot {
+	kept := make(map[string]bool, len(snapshots))
+	for i, keep := range snapshotKeeps(policy) {
+		seen := make(map[string]bool)
+		for _, snapshot := range snapshots {
+			if uint(len(seen)) >= keep {
+				break
+			}
+			bucket := snapshotBuckets[i](snapshot.CreatedAt)
+			if seen[bucket] {
+				continue
+			}
+			seen[bucket] = true
+			kept[snapshot.Name] = true
+		}
+	}
+	prune := []dto.Snapshot{}
+	for _, snapshot := range snapshots {
+		if !kept[snapshot.Name] {
+			prune = append(prune, snapshot)
+		}
+	}
+	return prune
+}
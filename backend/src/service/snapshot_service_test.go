@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/service/filesystem"
+	"github.com/ovechkin-dm/mockio/v2/matchers"
+	"github.com/ovechkin-dm/mockio/v2/mock"
+	"github.com/stretchr/testify/suite"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+// fakeSnapshotAdapter is a filesystem adapter with in-memory snapshots.
+type fakeSnapshotAdapter struct {
+	filesystem.FilesystemAdapter
+	names      []string
+	rolledBack string
+}
+
+func (f *fakeSnapshotAdapter) SnapshotDir() string { return ".snapshots" }
+
+func (f *fakeSnapshotAdapter) CreateSnapshot(_ context.Context, _ string, name string) errors.E {
+	f.names = append(f.names, name)
+	return nil
+}
+
+func (f *fakeSnapshotAdapter) ListSnapshots(_ context.Context, path string) ([]dto.Snapshot, errors.E) {
+	snapshots := []dto.Snapshot{}
+	for _, name := range f.names {
+		created, _ := dto.ParseSnapshotName(name)
+		snapshots = append(snapshots, dto.Snapshot{Name: name, CreatedAt: created, Path: path + "/.snapshots/" + name})
+	}
+	slices.SortFunc(snapshots, func(a, b dto.Snapshot) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return snapshots, nil
+}
+
+func (f *fakeSnapshotAdapter) DeleteSnapshot(_ context.Context, _ string, name string) errors.E {
+	f.names = slices.DeleteFunc(f.names, func(n string) bool { return n == name })
+	return nil
+}
+
+func (f *fakeSnapshotAdapter) RollbackSnapshot(_ context.Context, _ string, name string, _ bool) errors.E {
+	f.rolledBack = name
+	return nil
+}
+
+type SnapshotServiceSuite struct {
+	suite.Suite
+	app               *fxtest.App
+	shareService      ShareServiceInterface
+	filesystemService FilesystemServiceInterface
+	snapshotService   *SnapshotService
+	adapter           *fakeSnapshotAdapter
+	now               time.Time
+}
+
+func TestSnapshotServiceSuite(t *testing.T) {
+	suite.Run(t, new(SnapshotServiceSuite))
+}
+
+func (suite *SnapshotServiceSuite) SetupTest() {
+	var snapshotService SnapshotServiceInterface
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() *matchers.MockController { return mock.NewMockController(suite.T()) },
+			func() context.Context { return context.Background() },
+			mock.Mock[ShareServiceInterface],
+			mock.Mock[FilesystemServiceInterface],
+			NewSnapshotService,
+		),
+		fx.Populate(&suite.shareService),
+		fx.Populate(&suite.filesystemService),
+		fx.Populate(&snapshotService),
+	)
+	suite.app.RequireStart()
+
+	suite.snapshotService = snapshotService.(*SnapshotService)
+	suite.now = time.Date(2026, 1, 31, 18, 0, 0, 0, time.UTC)
+	suite.snapshotService.now = func() time.Time { return suite.now }
+	suite.adapter = &fakeSnapshotAdapter{}
+	mock.When(suite.filesystemService.GetAdapter(mock.Exact("btrfs"))).ThenReturn(suite.adapter, nil)
+	share := snapshotShare("btrfs", &dto.SnapshotPolicy{KeepHourly: 2, KeepDaily: 2})
+	mock.When(suite.shareService.GetShare(mock.Exact("data"))).ThenReturn(&share, nil)
+	mock.When(suite.shareService.ListShares()).ThenReturn([]dto.SharedResource{share}, nil)
+}
+
+func (suite *SnapshotServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+func snapshotShare(fsType string, policy *dto.SnapshotPolicy) dto.SharedResource {
+	return dto.SharedResource{
+		Name:      "data",
+		Snapshots: policy,
+		MountPointData: &dto.MountPointData{
+			Path:      "/mnt/data",
+			FSType:    &fsType,
+			IsMounted: true,
+		},
+	}
+}
+
+func (suite *SnapshotServiceSuite) TestCreateSnapshot() {
+	snapshot, err := suite.snapshotService.CreateSnapshot("data")
+	suite.Require().NoError(err)
+	suite.Equal("GMT-2026.01.31-18.00.00", snapshot.Name)
+	suite.Equal("/mnt/data/.snapshots/GMT-2026.01.31-18.00.00", snapshot.Path)
+
+	_, err = suite.snapshotService.CreateSnapshot("data")
+	suite.ErrorIs(err, dto.ErrorConflict, "a second snapshot in the same second collides")
+}
+
+func (suite *SnapshotServiceSuite) TestCreateSnapshot_UnsupportedFilesystem() {
+	share := snapshotShare("ext4", nil)
+	mock.When(suite.shareService.GetShare(mock.Exact("music"))).ThenReturn(&share, nil)
+	mock.When(suite.filesystemService.GetAdapter(mock.Exact("ext4"))).ThenReturn(filesystem.NewExt4Adapter(), nil)
+
+	_, err := suite.snapshotService.CreateSnapshot("music")
+	suite.ErrorIs(err, dto.ErrorSnapshotNotSupported)
+}
+
+func (suite *SnapshotServiceSuite) TestSnapshots_RefusedForSubPathShares() {
+	share := snapshotShare("btrfs", nil)
+	share.Name = "photos"
+	share.SubPath = "photos"
+	mock.When(suite.shareService.GetShare(mock.Exact("photos"))).ThenReturn(&share, nil)
+	suite.adapter.names = []string{"GMT-2026.01.30-18.00.00"}
+
+	_, err := suite.snapshotService.CreateSnapshot("photos")
+	suite.ErrorIs(err, dto.ErrorSnapshotNotSupported)
+	err = suite.snapshotService.RollbackSnapshot("photos", "GMT-2026.01.30-18.00.00", false)
+	suite.ErrorIs(err, dto.ErrorSnapshotNotSupported, "a rollback would revert the whole volume")
+	suite.Empty(suite.adapter.rolledBack)
+}
+
+func (suite *SnapshotServiceSuite) TestDeleteAndRollback_UnknownSnapshot() {
+	suite.ErrorIs(suite.snapshotService.DeleteSnapshot("data", "GMT-2020.01.01-00.00.00"), dto.ErrorSnapshotNotFound)
+	suite.ErrorIs(suite.snapshotService.RollbackSnapshot("data", "GMT-2020.01.01-00.00.00", false), dto.ErrorSnapshotNotFound)
+}
+
+func (suite *SnapshotServiceSuite) TestRollbackSnapshot() {
+	suite.adapter.names = []string{"GMT-2026.01.30-18.00.00"}
+	suite.Require().NoError(suite.snapshotService.RollbackSnapshot("data", "GMT-2026.01.30-18.00.00", false))
+	suite.Equal("GMT-2026.01.30-18.00.00", suite.adapter.rolledBack)
+}
+
+func (suite *SnapshotServiceSuite) TestApplyRetention_TakesDueSnapshotAndPrunes() {
+	suite.adapter.names = []string{
+		"GMT-2026.01.31-17.00.00",
+		"GMT-2026.01.31-16.00.00",
+		"GMT-2026.01.30-18.00.00",
+		"GMT-2026.01.29-18.00.00",
+	}
+
+	suite.Require().NoError(suite.snapshotService.ApplyRetention())
+
+	// Hourly keeps 18:00 and 17:00, daily keeps 31 (18:00) and 30.
+	suite.ElementsMatch([]string{
+		"GMT-2026.01.31-18.00.00",
+		"GMT-2026.01.31-17.00.00",
+		"GMT-2026.01.30-18.00.00",
+	}, suite.adapter.names)
+
+	suite.Require().NoError(suite.snapshotService.ApplyRetention())
+	suite.Len(suite.adapter.names, 3, "no new snapshot within the same hour")
+}
+
+func snapshotsAt(times ...string) []dto.Snapshot {
+	snapshots := make([]dto.Snapshot, 0, len(times))
+	for _, t := range times {
+		created, _ := time.Parse(time.RFC3339, t)
+		snapshots = append(snapshots, dto.Snapshot{Name: dto.SnapshotName(created), CreatedAt: created})
+	}
+	return snapshots
+}
+
+func (suite *SnapshotServiceSuite) TestSnapshotDue() {
+	now := time.Date(2026, 1, 31, 18, 30, 0, 0, time.UTC)
+	sameHour := snapshotsAt("2026-01-31T18:05:00Z")
+	suite.False(snapshotDue(dto.SnapshotPolicy{}, nil, now), "no window, no schedule")
+	suite.True(snapshotDue(dto.SnapshotPolicy{KeepHourly: 1}, nil, now))
+	suite.False(snapshotDue(dto.SnapshotPolicy{KeepHourly: 1}, sameHour, now))
+	suite.True(snapshotDue(dto.SnapshotPolicy{KeepHourly: 1}, snapshotsAt("2026-01-31T17:55:00Z"), now))
+	suite.False(snapshotDue(dto.SnapshotPolicy{KeepDaily: 1}, snapshotsAt("2026-01-31T01:00:00Z"), now))
+	suite.False(snapshotDue(dto.SnapshotPolicy{KeepWeekly: 1}, snapshotsAt("2026-01-26T01:00:00Z"), now), "same ISO week")
+}
+
+func (suite *SnapshotServiceSuite) TestSnapshotsToPrune_Weekly() {
+	snapshots := snapshotsAt(
+		"2026-01-31T00:00:00Z",
+		"2026-01-27T00:00:00Z",
+		"2026-01-24T00:00:00Z",
+		"2026-01-17T00:00:00Z",
+	)
+	prune := snapshotsToPrune(dto.SnapshotPolicy{KeepWeekly: 2}, snapshots)
+	suite.Equal([]dto.Snapshot{snapshots[1], snapshots[3]}, prune)
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/dianlight/srat/internal/ctxkeys"
+	"github.com/dianlight/tlog"
+	"gitlab.com/tozd/go/errors"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// statsCompactInterval is how often the history is rolled up and pruned.
+	statsCompactInterval = time.Minute
+	// statsRollUpBuckets bounds the buckets rolled up per read, so a long
+	// backlog is not loaded at once.
+	statsRollUpBuckets = 360
+	// defaultStatsHistoryPoints is about the number of points per series
+	// when a query sets no step; maxStatsHistoryPoints bounds it.
+	defaultStatsHistoryPoints = 300
+	maxStatsHistoryPoints     = 5000
+	// statsInsertBatch is the number of samples stored per insert.
+	statsInsertBatch = 500
+)
+
+// statsTier is a resolution of the history and how long it is kept.
+type statsTier struct {
+	resolution time.Duration // zero for the raw samples
+	retention  time.Duration
+}
+
+// statsTiers are ordered from the finest; each one is rolled up from the one
+// before.
+var statsTiers = []statsTier{
+	{resolution: 0, retention: 24 * time.Hour},
+	{resolution: time.Minute, retention: 7 * 24 * time.Hour},
+	{resolution: time.Hour, retention: 90 * 24 * time.Hour},
+	{resolution: 24 * time.Hour, retention: 2 * 365 * 24 * time.Hour},
+}
+
+type StatsHistoryServiceInterface interface {
+	// Record stores samples taken at the given time.
+	Record(ctx context.Context, at time.Time, samples ...dto.StatsSample) errors.E
+	// Compact rolls the complete buckets of each resolution up into the next
+	// one and removes the buckets older than their retention.
+	Compact(ctx context.Context) errors.E
+	// History returns the series of a metric, with one point per step.
+	History(ctx context.Context, query dto.StatsHistoryQuery) ([]dto.StatsSeries, errors.E)
+}
+
+type StatsHistoryService struct {
+	ctx context.Context
+	db  *gorm.DB
+	wg  *sync.WaitGroup
+	now func() time.Time
+
+	mu       sync.Mutex
+	rolledUp []time.Time // per tier, end of the buckets rolled up; zero until read back
+}
+
+type StatsHistoryServiceParams struct {
+	fx.In
+	Ctx context.Context
+	Db  *gorm.DB
+}
+
+func NewStatsHistoryService(lc fx.Lifecycle, in StatsHistoryServiceParams) StatsHistoryServiceInterface {
+	wg, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup)
+	if !ok || wg == nil {
+		wg = &sync.WaitGroup{}
+	}
+	s := &StatsHistoryService{
+		ctx:      in.Ctx,
+		db:       in.Db,
+		wg:       wg,
+		now:      time.Now,
+		rolledUp: make([]time.Time, len(statsTiers)),
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if _, ok := in.Ctx.Value(ctxkeys.WaitGroup).(*sync.WaitGroup); ok {
+				s.wg.Go(func() {
+					if err := s.run(); err != nil && !errors.Is(err, context.Canceled) {
+						slog.WarnContext(s.ctx, "StatsHistoryService run loop stopped with error", "error", err)
+					}
+				})
+			}
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *StatsHistoryService) run() errors.E {
+	for {
+		select {
+		case <-s.ctx.Done():
+			slog.DebugContext(s.ctx, "Run process closed", "err", s.ctx.Err())
+			return errors.WithStack(s.ctx.Err())
+		case <-time.After(statsCompactInterval):
+			if err := s.Compact(s.ctx); err != nil {
+				tlog.DebugContext(s.ctx, "Failed to compact the statistics history", "error", err)
+			}
+		}
+	}
+}
+
+func (s *StatsHistoryService) Record(ctx context.Context, at time.Time, samples ...dto.StatsSample) errors.E {
+	// SQLite compares times as text: keep them all in UTC.
+	at = at.UTC()
+	rows := make([]dbom.StatsSample, 0, len(samples))
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		rows = append(rows, dbom.StatsSample{
+			Metric: sample.Metric,
+			Series: sample.Series,
+			Time:   at,
+			Min:    sample.Value,
+			Max:    sample.Value,
+			Sum:    sample.Value,
+			Count:  1,
+		})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := gorm.G[dbom.StatsSample](s.db, clause.OnConflict{UpdateAll: true}).CreateInBatches(ctx, &rows, statsInsertBatch); err != nil {
+		return errors.Wrap(err, "failed to store statistics samples")
+	}
+	return nil
+}
+
+func (s *StatsHistoryService) Compact(ctx context.Context) errors.E {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UTC()
+	for i := 1; i < len(statsTiers); i++ {
+		if err := s.rollUp(ctx, i, now); err != nil {
+			return err
+		}
+	}
+	for _, tier := range statsTiers {
+		_, err := gorm.G[dbom.StatsSample](s.db).
+			Where(g.StatsSample.Resolution.Eq(int64(tier.resolution / time.Second))).
+			Where(g.StatsSample.Time.Lt(now.Add(-tier.retention))).
+			Delete(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to prune the statistics history")
+		}
+	}
+	return nil
+}
+
+// rollUp aggregates the samples of the tier before into the complete
+// buckets of tier i.
+func (s *StatsHistoryService) rollUp(ctx context.Context, i int, now time.Time) errors.E {
+	tier := statsTiers[i]
+	resolution := int64(tier.resolution / time.Second)
+	sourceResolution := int64(statsTiers[i-1].resolution / time.Second)
+	until := now.Truncate(tier.resolution)
+
+	from := s.rolledUp[i]
+	if from.IsZero() {
+		// After a restart, go on after the last bucket stored.
+		last, err := gorm.G[dbom.StatsSample](s.db).Where(g.StatsSample.Resolution.Eq(resolution)).Order(g.StatsSample.Time.Desc()).First(ctx)
+		switch {
+		case err == nil:
+			from = last.Time.UTC().Add(tier.resolution)
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return errors.Wrap(err, "failed to read the last statistics bucket")
+		default:
+			first, err := gorm.G[dbom.StatsSample](s.db).Where(g.StatsSample.Resolution.Eq(sourceResolution)).Order(g.StatsSample.Time.Asc()).First(ctx)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			} else if err != nil {
+				return errors.Wrap(err, "failed to read the first statistics sample")
+			}
+			from = first.Time.UTC().Truncate(tier.resolution)
+		}
+	}
+
+	for from.Before(until) {
+		end := from.Add(statsRollUpBuckets * tier.resolution)
+		if end.After(until) {
+			end = until
+		}
+		rows, err := gorm.G[dbom.StatsSample](s.db).
+			Where(g.StatsSample.Resolution.Eq(sourceResolution)).
+			Where(g.StatsSample.Time.Gte(from)).
+			Where(g.StatsSample.Time.Lt(end)).
+			Find(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to read statistics samples")
+		}
+		buckets := mergeStatsSamples(rows, tier.resolution)
+		for j := range buckets {
+			buckets[j].Resolution = resolution
+		}
+		if len(buckets) > 0 {
+			if err := gorm.G[dbom.StatsSample](s.db, clause.OnConflict{UpdateAll: true}).CreateInBatches(ctx, &buckets, statsInsertBatch); err != nil {
+				return errors.Wrap(err, "failed to store statistics buckets")
+			}
+		}
+		from = end
+		s.rolledUp[i] = end
+	}
+	return nil
+}
+
+// mergeStatsSamples merges rows into buckets of width step, ordered by
+// metric, series and time.
+func mergeStatsSamples(rows []dbom.StatsSample, step time.Duration) []dbom.StatsSample {
+	type key struct {
+		metric, series string
+		time           time.Time
+	}
+	buckets := map[key]*dbom.StatsSample{}
+	for _, row := range rows {
+		k := key{row.Metric, row.Series, row.Time.UTC().Truncate(step)}
+		bucket, ok := buckets[k]
+		if !ok {
+			bucket = &dbom.StatsSample{Metric: k.metric, Series: k.series, Time: k.time, Min: row.Min, Max: row.Max}
+			buckets[k] = bucket
+		}
+		bucket.Min = min(bucket.Min, row.Min)
+		bucket.Max = max(bucket.Max, row.Max)
+		bucket.Sum += row.Sum
+		bucket.Count += row.Count
+	}
+	merged := make([]dbom.StatsSample, 0, len(buckets))
+	for _, bucket := range buckets {
+		merged = append(merged, *bucket)
+	}
+	slices.SortFunc(merged, func(a, b dbom.StatsSample) int {
+		if a.Metric != b.Metric {
+			return cmp.Compare(a.Metric, b.Metric)
+		}
+		if a.Series != b.Series {
+			return cmp.Compare(a.Series, b.Series)
+		}
+		return a.Time.Compare(b.Time)
+	})
+	return merged
+}
+
+// statsTierFor returns the coarsest tier still holding from with buckets no
+// wider than step, else the finest tier holding from.
+func statsTierFor(from, now time.Time, step time.Duration) statsTier {
+	var chosen *statsTier
+	for i := range statsTiers {
+		tier := &statsTiers[i]
+		if from.Before(now.Add(-tier.retention)) {
+			continue
+		}
+		if chosen == nil || tier.resolution <= step {
+			chosen = tier
+		}
+	}
+	if chosen == nil {
+		return statsTiers[len(statsTiers)-1]
+	}
+	return *chosen
+}
+
+func (s *StatsHistoryService) History(ctx context.Context, query dto.StatsHistoryQuery) ([]dto.StatsSeries, errors.E) {
+	if !slices.Contains(dto.StatsMetrics, query.Metric) {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "metric", query.Metric, "reason", "unknown metric")
+	}
+	now := s.now().UTC()
+	to := query.To.UTC()
+	if query.To.IsZero() {
+		to = now
+	}
+	from := query.From.UTC()
+	if query.From.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	if !from.Before(to) {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "from", from, "to", to, "reason", "from is not before to")
+	}
+	if query.Step < 0 {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "step", query.Step, "reason", "step is negative")
+	}
+
+	step := query.Step
+	if step == 0 {
+		step = to.Sub(from) / defaultStatsHistoryPoints
+	}
+	step = max(step.Truncate(time.Second), time.Second)
+	tier := statsTierFor(from, now, step)
+	step = max(step, tier.resolution)
+	if to.Sub(from)/step > maxStatsHistoryPoints {
+		return nil, errors.WithDetails(dto.ErrorInvalidParameter, "step", step, "reason", "step is too small for the time range")
+	}
+
+	start := from
+	if tier.resolution > 0 {
+		// Include the bucket from falls in.
+		start = from.Truncate(tier.resolution)
+	}
+	selection := gorm.G[dbom.StatsSample](s.db).
+		Where(g.StatsSample.Metric.Eq(query.Metric)).
+		Where(g.StatsSample.Resolution.Eq(int64(tier.resolution / time.Second))).
+		Where(g.StatsSample.Time.Gte(start)).
+		Where(g.StatsSample.Time.Lt(to))
+	if query.Series != "" {
+		selection = selection.Where(g.StatsSample.Series.Eq(query.Series))
+	}
+	rows, err := selection.Find(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the statistics history")
+	}
+
+	history := []dto.StatsSeries{}
+	for _, bucket := range mergeStatsSamples(rows, step) {
+		if len(history) == 0 || history[len(history)-1].Series != bucket.Series {
+			history = append(history, dto.StatsSeries{
+				Metric: bucket.Metric,
+				Series: bucket.Series,
+				Step:   int64(step / time.Second),
+				Points: []dto.StatsPoint{},
+			})
+		}
+		series := &history[len(history)-1]
+		series.Points = append(series.Points, dto.StatsPoint{
+			Time: bucket.Time,
+			Avg:  bucket.Sum / float64(bucket.Count),
+			Min:  bucket.Min,
+			Max:  bucket.Max,
+		})
+	}
+	return history, nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dianlight/srat/dbom"
+	"github.com/dianlight/srat/dbom/g"
+	"github.com/dianlight/srat/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+)
+
+func TestStatsTierFor(t *testing.T) {
+	now := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		from time.Time
+		step time.Duration
+		want time.Duration
+	}{
+		{name: "recent, fine step", from: now.Add(-time.Hour), step: 10 * time.Second, want: 0},
+		{name: "recent, minute step", from: now.Add(-time.Hour), step: 5 * time.Minute, want: time.Minute},
+		{name: "past the raw samples", from: now.Add(-48 * time.Hour), step: 10 * time.Second, want: time.Minute},
+		{name: "last month", from: now.Add(-30 * 24 * time.Hour), step: 6 * time.Hour, want: time.Hour},
+		{name: "last year", from: now.Add(-365 * 24 * time.Hour), step: time.Hour, want: 24 * time.Hour},
+		{name: "older than any retention", from: now.Add(-10 * 365 * 24 * time.Hour), step: time.Hour, want: 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, statsTierFor(tt.from, now, tt.step).resolution)
+		})
+	}
+}
+
+type StatsHistoryServiceSuite struct {
+	suite.Suite
+	app     *fxtest.App
+	db      *gorm.DB
+	service *StatsHistoryService
+	now     time.Time
+}
+
+func TestStatsHistoryServiceSuite(t *testing.T) {
+	suite.Run(t, new(StatsHistoryServiceSuite))
+}
+
+func (suite *StatsHistoryServiceSuite) SetupTest() {
+	suite.app = fxtest.New(suite.T(),
+		fx.Provide(
+			func() context.Context { return context.Background() },
+			func() *dto.ContextState {
+				return &dto.ContextState{
+					DatabasePath: "file::memory:?cache=shared&_pragma=foreign_keys(1)",
+				}
+			},
+			dbom.NewDB,
+		),
+		fx.Populate(&suite.db),
+	)
+	suite.app.RequireStart()
+	suite.Require().NoError(suite.db.Where("1 = 1").Delete(&dbom.StatsSample{}).Error)
+
+	suite.now = time.Date(2026, 2, 1, 10, 3, 5, 0, time.UTC)
+	suite.service = suite.newService()
+}
+
+func (suite *StatsHistoryServiceSuite) TearDownTest() {
+	suite.app.RequireStop()
+}
+
+// newService returns a service starting from scratch, as after a restart.
+func (suite *StatsHistoryServiceSuite) newService() *StatsHistoryService {
+	return &StatsHistoryService{
+		ctx:      context.Background(),
+		db:       suite.db,
+		now:      func() time.Time { return suite.now },
+		rolledUp: make([]time.Time, len(statsTiers)),
+	}
+}
+
+// recordMinutes records a temperature every 10 seconds from 10:00 to 10:03,
+// rising by one degree per sample from 30.
+func (suite *StatsHistoryServiceSuite) recordMinutes() {
+	start := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	for i := range 18 {
+		suite.Require().NoError(suite.service.Record(context.Background(), start.Add(time.Duration(i)*10*time.Second),
+			dto.StatsSample{Metric: dto.StatsSmartTemperature, Series: "sda", Value: float64(30 + i)},
+		))
+	}
+}
+
+func (suite *StatsHistoryServiceSuite) countSamples(resolution time.Duration) int {
+	rows, err := gorm.G[dbom.StatsSample](suite.db).Where(g.StatsSample.Resolution.Eq(int64(resolution / time.Second))).Find(context.Background())
+	suite.Require().NoError(err)
+	return len(rows)
+}
+
+func (suite *StatsHistoryServiceSuite) TestRawHistory() {
+	at := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	suite.Require().NoError(suite.service.Record(context.Background(), at,
+		dto.StatsSample{Metric: dto.StatsDiskReadIOPS, Series: "sdb", Value: 4},
+		dto.StatsSample{Metric: dto.StatsDiskReadIOPS, Series: "sda", Value: 2},
+		dto.StatsSample{Metric: dto.StatsDiskWriteIOPS, Series: "sda", Value: 9},
+	))
+	suite.Require().NoError(suite.service.Record(context.Background(), at.Add(10*time.Second),
+		dto.StatsSample{Metric: dto.StatsDiskReadIOPS, Series: "sda", Value: 6},
+	))
+
+	history, err := suite.service.History(context.Background(), dto.StatsHistoryQuery{
+		Metric: dto.StatsDiskReadIOPS,
+		From:   at.Add(-time.Minute),
+		To:     at.Add(time.Minute),
+		Step:   10 * time.Second,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(history, 2)
+	suite.Equal("sda", history[0].Series)
+	suite.Equal(int64(10), history[0].Step)
+	suite.Equal([]dto.StatsPoint{
+		{Time: at, Avg: 2, Min: 2, Max: 2},
+		{Time: at.Add(10 * time.Second), Avg: 6, Min: 6, Max: 6},
+	}, history[0].Points)
+	suite.Equal("sdb", history[1].Series)
+
+	history, err = suite.service.History(context.Background(), dto.StatsHistoryQuery{
+		Metric: dto.StatsDiskReadIOPS,
+		Series: "sdb",
+		From:   at.Add(-time.Minute),
+		To:     at.Add(time.Minute),
+		Step:   10 * time.Second,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(history, 1)
+	suite.Equal("sdb", history[0].Series)
+}
+
+func (suite *StatsHistoryServiceSuite) TestCompactRollsUp() {
+	suite.recordMinutes()
+	suite.Require().NoError(suite.service.Compact(context.Background()))
+	suite.Equal(3, suite.countSamples(time.Minute))
+	suite.Equal(0, suite.countSamples(time.Hour), "the hour is not complete yet")
+
+	// Compacting again, even after a restart, adds nothing.
+	suite.Require().NoError(suite.service.Compact(context.Background()))
+	suite.Require().NoError(suite.newService().Compact(context.Background()))
+	suite.Equal(3, suite.countSamples(time.Minute))
+
+	history, err := suite.service.History(context.Background(), dto.StatsHistoryQuery{
+		Metric: dto.StatsSmartTemperature,
+		From:   time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+		To:     suite.now,
+		Step:   time.Minute,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(history, 1)
+	suite.Equal(int64(60), history[0].Step)
+	suite.Equal([]dto.StatsPoint{
+		{Time: time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC), Avg: 32.5, Min: 30, Max: 35},
+		{Time: time.Date(2026, 2, 1, 10, 1, 0, 0, time.UTC), Avg: 38.5, Min: 36, Max: 41},
+		{Time: time.Date(2026, 2, 1, 10, 2, 0, 0, time.UTC), Avg: 44.5, Min: 42, Max: 47},
+	}, history[0].Points)
+
+	// An hour later the minutes are rolled up into the hour.
+	suite.now = time.Date(2026, 2, 1, 11, 0, 30, 0, time.UTC)
+	suite.Require().NoError(suite.service.Compact(context.Background()))
+	history, err = suite.service.History(context.Background(), dto.StatsHistoryQuery{
+		Metric: dto.StatsSmartTemperature,
+		From:   time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+		To:     suite.now,
+		Step:   time.Hour,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(history, 1)
+	suite.Equal([]dto.StatsPoint{
+		{Time: time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC), Avg: 38.5, Min: 30, Max: 47},
+	}, history[0].Points)
+}
+
+func (suite *StatsHistoryServiceSuite) TestCompactPrunes() {
+	suite.recordMinutes()
+	suite.Require().NoError(suite.service.Compact(context.Background()))
+	suite.Equal(18, suite.countSamples(0))
+
+	suite.now = suite.now.Add(25 * time.Hour)
+	suite.Require().NoError(suite.service.Compact(context.Background()))
+	suite.Equal(0, suite.countSamples(0), "raw samples are kept for a day")
+	suite.Equal(3, suite.countSamples(time.Minute))
+	suite.Equal(1, suite.countSamples(time.Hour))
+
+	suite.now = suite.now.Add(8 * 24 * time.Hour)
+	suite.Require().NoError(suite.service.Compact(context.Background()))
+	suite.Equal(0, suite.countSamples(time.Minute), "minutes are kept for a week")
+	suite.Equal(1, suite.countSamples(time.Hour))
+	suite.Equal(1, suite.countSamples(24*time.Hour))
+
+	// The week-old history is served from the hours.
+	history, err := suite.service.History(context.Background(), dto.StatsHistoryQuery{
+		Metric: dto.StatsSmartTemperature,
+		Series: "sda",
+		From:   time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		To:     suite.now,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(history, 1)
+	suite.Require().Len(history[0].Points, 1)
+	suite.InDelta(38.5, history[0].Points[0].Avg, 0.001)
+}
+
+func (suite *StatsHistoryServiceSuite) TestHistoryInvalid() {
+	tests := []dto.StatsHistoryQuery{
+		{Metric: "cpu_usage"},
+		{Metric: dto.StatsSmartTemperature, From: suite.now, To: suite.now.Add(-time.Hour)},
+		{Metric: dto.StatsSmartTemperature, From: suite.now.Add(-24 * time.Hour), Step: time.Second},
+		{Metric: dto.StatsSmartTemperature, Step: -time.Second},
+	}
+	for _, query := range tests {
+		_, err := suite.service.History(context.Background(), query)
+		suite.ErrorIs(err, dto.ErrorInvalidParameter, "%+v", query)
+	}
+}
@@ -40,6 +40,7 @@ type UserService struct {
 	ctx            context.Context
 	eventBus       events.EventBusInterface
 	settingService SettingServiceInterface
+	homesService   HomesServiceInterface
 }
 
 type UserServiceParams struct {
@@ -48,6 +49,7 @@ type UserServiceParams struct {
 	Ctx context.Context
 	//UserRepo       repository.SambaUserRepositoryInterface
 	SettingService SettingServiceInterface
+	HomesService   HomesServiceInterface
 	EventBus       events.EventBusInterface
 	//DefaultConfig  *config.DefaultConfig
 }
@@ -59,6 +61,7 @@ func NewUserService(lc fx.Lifecycle, params UserServiceParams) UserServiceInterf
 		db:             params.Db,
 		eventBus:       params.EventBus,
 		settingService: params.SettingService,
+		homesService:   params.HomesService,
 	}
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
@@ -123,6 +126,10 @@ func NewUserService(lc fx.Lifecycle, params UserServiceParams) UserServiceInterf
 				})
 				if err != nil {
 					slog.ErrorContext(ctx, "Error autocreating user", "name", user.Username, "err", err)
+					continue
+				}
+				if err := us.homesService.CreateHome(user.Username); err != nil {
+					slog.WarnContext(ctx, "Error creating home directory", "name", user.Username, "err", err)
 				}
 			}
 			slog.DebugContext(ctx, "******* Autocreating users done! ********")
@@ -226,6 +233,11 @@ func (s *UserService) CreateUser(userDto dto.User) (*dto.User, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to restore samba user %s for soft-deleted user", dbUser.Username)
 	}
+	// The account exists at this point: a missing home directory is created
+	// again at the next start or settings change.
+	if err := s.homesService.CreateHome(dbUser.Username); err != nil {
+		tlog.WarnContext(s.ctx, "Unable to create home directory", "user", dbUser.Username, "err", err)
+	}
 
 	//slog.Debug("Attempting to create user in DB", "dbUser", dbUser)
 
@@ -271,6 +283,7 @@ func (s *UserService) UpdateUser(currentUsername string, userDto dto.User) (*dto
 	if err != nil {
 		return nil, err
 	}
+	s.renameHome(currentUsername, dbUser.Username)
 
 	updatedUserDto, err := conv.SambaUserToUser(dbUser)
 	if err != nil {
@@ -306,6 +319,9 @@ func (s *UserService) updateUser(currentUsername string, currentPassword string,
 			if err := tx.Model(&dbom.SambaUser{}).Where("username = ?", currentUsername).Update("username", dbUser.Username).Error; err != nil {
 				return errors.Wrapf(err, "failed to rename username in DB from %s to %s", currentUsername, dbUser.Username)
 			}
+			if err := renameShareOwnership(s.ctx, tx, false, currentUsername, dbUser.Username); err != nil {
+				return err
+			}
 			// Advance the local variable so the general Updates below targets the new PK.
 			currentUsername = dbUser.Username
 		}
@@ -328,6 +344,16 @@ func (s *UserService) updateUser(currentUsername string, currentPassword string,
 	return dbUser, errF
 }
 
+// renameHome moves the home directory of a renamed user.
+func (s *UserService) renameHome(currentUsername, newUsername string) {
+	if newUsername == "" || newUsername == currentUsername {
+		return
+	}
+	if err := s.homesService.RenameHome(currentUsername, newUsername); err != nil {
+		tlog.WarnContext(s.ctx, "Unable to rename home directory", "from", currentUsername, "to", newUsername, "err", err)
+	}
+}
+
 func (s *UserService) UpdateAdminUser(userDto dto.User) (*dto.User, error) {
 	if userDto.Password != nil && userDto.Password.Expose() == "" {
 		return nil, dto.ErrorPasswordRequired
@@ -350,6 +376,7 @@ func (s *UserService) UpdateAdminUser(userDto dto.User) (*dto.User, error) {
 	if err != nil {
 		return nil, err
 	}
+	s.renameHome(originalAdminUsername, dbUser.Username)
 
 	updatedAdminDto, err := conv.SambaUserToUser(dbUser)
 	if err != nil {
@@ -365,18 +392,28 @@ func (s *UserService) UpdateAdminUser(userDto dto.User) (*dto.User, error) {
 }
 
 func (s *UserService) DeleteUser(username string) error {
-	found, err := query.SambaUserQuery[dbom.SambaUser](s.db).DeleteByName(s.ctx, username)
-	if errors.Is(err, gorm.ErrRecordNotFound) || found == 0 {
-		return dto.ErrorUserNotFound
-	}
+	// The shares the user owns fall back to the default owner.
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		found, err := query.SambaUserQuery[dbom.SambaUser](tx).DeleteByName(s.ctx, username)
+		if errors.Is(err, gorm.ErrRecordNotFound) || found == 0 {
+			return dto.ErrorUserNotFound
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete user %s from repository %v", username, err)
+		}
+		return renameShareOwnership(s.ctx, tx, false, username, "")
+	})
 	if err != nil {
-		return errors.Wrapf(err, "failed to delete user %s from repository %v", username, err)
+		return err
 	}
 
 	err = unixsamba.DeleteSambaUser(s.ctx, username)
 	if err != nil {
 		return errors.Wrapf(err, "failed to delete samba user %s", username)
 	}
+	if err := s.homesService.RemoveHome(username); err != nil {
+		tlog.WarnContext(s.ctx, "Unable to remove home directory", "user", username, "err", err)
+	}
 
 	s.eventBus.EmitUser(events.UserEvent{
 		Event: events.Event{
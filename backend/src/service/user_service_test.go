@@ -35,6 +35,7 @@ type UserServiceSuite struct {
 	//	userRepoMock repository.SambaUserRepositoryInterface
 	dirtyService DirtyDataServiceInterface
 	shareMock    ShareServiceInterface
+	homesMock    HomesServiceInterface
 	userService  UserServiceInterface
 }
 
@@ -66,10 +67,12 @@ func (suite *UserServiceSuite) SetupTest() {
 			events.NewEventBus,
 			mock.Mock[TelemetryServiceInterface],
 			mock.Mock[ShareServiceInterface],
+			mock.Mock[HomesServiceInterface],
 		),
 		fx.Populate(&suite.ctx, &suite.cancel),
 		fx.Populate(&suite.dirtyService),
 		fx.Populate(&suite.shareMock),
+		fx.Populate(&suite.homesMock),
 		fx.Populate(&suite.userService),
 		fx.Populate(&suite.db),
 	)
@@ -283,6 +286,7 @@ func (suite *UserServiceSuite) TestCreateUser_Success() {
 	//mock.Verify(suite.userRepoMock, matchers.Times(2)).Create(mock.Any[*dbom.SambaUser]())
 	suite.True(suite.dirtyService.GetDirtyDataTracker().Users)
 	suite.Require().NoError(suite.db.Where("username = ?", userDto.Username).First(&dbom.SambaUser{}).Error)
+	mock.Verify(suite.homesMock, mock.Once()).CreateHome(userDto.Username)
 }
 
 func (suite *UserServiceSuite) TestCreateUser_IgnoresClientSuppliedDefaultPassword() {
@@ -642,6 +646,7 @@ func (suite *UserServiceSuite) TestUpdateUser_RenameSuccess() {
 	//mock.Verify(suite.userRepoMock, matchers.Times(1)).Rename(currentUsername, newUsername)
 	//mock.Verify(suite.userRepoMock, matchers.Times(1)).Save(mock.Any[*dbom.SambaUser]())
 	suite.True(suite.dirtyService.GetDirtyDataTracker().Users)
+	mock.Verify(suite.homesMock, mock.Once()).RenameHome(currentUsername, newUsername)
 }
 
 func (suite *UserServiceSuite) TestUpdateUser_RenameWithShares_Success() {
@@ -693,6 +698,29 @@ func (suite *UserServiceSuite) TestUpdateUser_RenameWithShares_Success() {
 	suite.Equal(roShare.Name, renamedUser.RoShares[0].Name)
 }
 
+func (suite *UserServiceSuite) TestUpdateUser_RenameFollowsSharePermissions() {
+	// Arrange
+	currentUsername := fmt.Sprintf("rnowner_old%d", time.Now().UnixNano())
+	newUsername := fmt.Sprintf("rnowner_new%d", time.Now().UnixNano())
+	_, err := suite.userService.CreateUser(dto.User{Username: currentUsername, Password: new(dto.NewSecret("password"))})
+	suite.Require().NoError(err)
+	share := dbom.ExportedShare{
+		Name:        fmt.Sprintf("rnowner_%d", time.Now().UnixNano()),
+		Permissions: &dto.SharePermissions{Owner: currentUsername},
+	}
+	suite.Require().NoError(suite.db.Create(&share).Error)
+
+	// Act
+	_, err = suite.userService.UpdateUser(currentUsername, dto.User{Username: newUsername, Password: new(dto.NewSecret("password"))})
+
+	// Assert
+	suite.Require().NoError(err)
+	var stored dbom.ExportedShare
+	suite.Require().NoError(suite.db.First(&stored, "name = ?", share.Name).Error)
+	suite.Require().NotNil(stored.Permissions)
+	suite.Equal(newUsername, stored.Permissions.Owner)
+}
+
 func (suite *UserServiceSuite) TestUpdateUser_RenameToExistingUser() {
 	// Arrange
 	currentUsername := fmt.Sprintf("roldname%d", time.Now().Unix())
@@ -899,6 +927,7 @@ func (suite *UserServiceSuite) TestDeleteUser_Success() {
 	suite.NoError(err)
 	//mock.Verify(suite.userRepoMock, matchers.Times(1)).Delete(username)
 	suite.True(suite.dirtyService.GetDirtyDataTracker().Users)
+	mock.Verify(suite.homesMock, mock.Once()).RemoveHome(username)
 }
 
 func (suite *UserServiceSuite) TestDeleteUser_Success_Reget() {
@@ -923,6 +952,27 @@ func (suite *UserServiceSuite) TestDeleteUser_Success_Reget() {
 	suite.True(errors.Is(result.Error, gorm.ErrRecordNotFound))
 }
 
+func (suite *UserServiceSuite) TestDeleteUser_ClearsSharePermissions() {
+	// Arrange
+	username := "ownerToDelete"
+	_, err := suite.userService.CreateUser(dto.User{Username: username, Password: new(dto.NewSecret("password"))})
+	suite.Require().NoError(err)
+	share := dbom.ExportedShare{Name: "ownedShare", Permissions: &dto.SharePermissions{Owner: username, Group: "users"}}
+	suite.Require().NoError(suite.db.Create(&share).Error)
+
+	// Act
+	err = suite.userService.DeleteUser(username)
+
+	// Assert
+	suite.Require().NoError(err)
+	var stored dbom.ExportedShare
+	suite.Require().NoError(suite.db.First(&stored, "name = ?", share.Name).Error)
+	suite.Require().NotNil(stored.Permissions)
+	suite.Empty(stored.Permissions.Owner, "the share falls back to the default owner")
+	suite.Equal(dto.DefaultShareOwner, stored.Permissions.EffectiveOwner())
+	suite.Equal("users", stored.Permissions.Group)
+}
+
 func (suite *UserServiceSuite) TestDeleteUser_WithShares_Success() {
 	// Arrange
 	username := fmt.Sprintf("delshares_%d", time.Now().UnixNano())
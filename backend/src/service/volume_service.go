@@ -58,6 +58,7 @@ type VolumeService struct {
 	sfGroup         singleflight.Group
 	haService       HomeAssistantServiceInterface
 	hdidleService   HDIdleServiceInterface
+	poolService     PoolServiceInterface
 	eventBus        events.EventBusInterface
 	convDto         converter.DtoToDbomConverterImpl
 	mounter         VolumeMountManagerInterface
@@ -77,6 +78,7 @@ type VolumeServiceProps struct {
 	State             *dto.ContextState
 	HAService         HomeAssistantServiceInterface `optional:"true"`
 	HDIdleService     HDIdleServiceInterface        `optional:"true"`
+	PoolService       PoolServiceInterface          `optional:"true"`
 	EventBus          events.EventBusInterface
 	Mounter           VolumeMountManagerInterface
 	Disks             *dto.DiskMap
@@ -95,6 +97,7 @@ func NewVolumeService(
 		shareService:    in.ShareService,
 		haService:       in.HAService,
 		hdidleService:   in.HDIdleService,
+		poolService:     in.PoolService,
 		eventBus:        in.EventBus,
 		convDto:         converter.DtoToDbomConverterImpl{},
 		mounter:         in.Mounter,
@@ -132,6 +135,11 @@ func NewVolumeService(
 				})
 			}
 		case events.EventTypes.ADD, events.EventTypes.UPDATE:
+			if se.Share.SubPath != "" {
+				// A volume shows the share exporting it as a whole, sub path
+				// shares are only listed with the shares.
+				return nil
+			}
 			disk, err := p.disks.AddMountPointShare(se.Share)
 			if err != nil {
 				if se.Share.Usage != "internal" {
@@ -366,6 +374,13 @@ func (ms *VolumeService) MountVolume(md *dto.MountPointData) errors.E {
 }
 
 func (ms *VolumeService) UnmountVolume(path string, force bool) errors.E {
+	// A pool keeps its members busy; a forced unmount degrades the pool.
+	if !force && ms.poolService != nil {
+		if pool, ok := ms.poolService.MountedPoolOf(path); ok {
+			return errors.WithDetails(dto.ErrorInvalidStateForOperation,
+				"Detail", "the volume is a member of the mounted pool "+pool, "Path", path, "Pool", pool)
+		}
+	}
 	// Look up mount point data from in-memory cache first
 	md, ok := ms.disks.GetMountPointByPath(path)
 	if ok && md.Share != nil && md.Share.Status.IsHAMounted {
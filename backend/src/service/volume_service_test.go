@@ -5,6 +5,7 @@ import (
 	"context"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -35,6 +36,7 @@ type VolumeServiceTestSuite struct {
 	volumeService      service.VolumeServiceInterface
 	filesystemService  service.FilesystemServiceInterface
 	hardwareService    service.HardwareServiceInterface
+	poolService        service.PoolServiceInterface
 	eventBus           events.EventBusInterface
 	disks              *dto.DiskMap
 	ctx                context.Context
@@ -89,6 +91,7 @@ func (suite *VolumeServiceTestSuite) SetupTest() {
 			//mock.Mock[repository.MountPointPathRepositoryInterface],
 			mock.Mock[service.HardwareServiceInterface],
 			mock.Mock[service.ShareServiceInterface],
+			mock.Mock[service.PoolServiceInterface],
 			//mock.Mock[events.EventBusInterface],
 		),
 		fx.Populate(&suite.volumeService),
@@ -96,6 +99,7 @@ func (suite *VolumeServiceTestSuite) SetupTest() {
 		fx.Populate(&suite.mockHardwareClient),
 		fx.Populate(&suite.filesystemService),
 		fx.Populate(&suite.hardwareService),
+		fx.Populate(&suite.poolService),
 		fx.Populate(&suite.eventBus),
 		fx.Populate(&suite.disks),
 		fx.Populate(&suite.ctx),
@@ -255,7 +259,12 @@ func (suite *VolumeServiceTestSuite) TestMountUnmountVolume_Success() {
 	suite.Require().NoError(err, "Error finding loop device")
 	err = suite.filesystemService.CreateBlockDevice(suite.ctx, device)
 	suite.Require().NoError(err, "Error creating block device")
-	err = loop.SetFile(device, "../../test/data/image.dmg")
+	// Mounting writes to the image: work on a copy of the fixture.
+	image, err := os.ReadFile("../../test/data/image.dmg")
+	suite.Require().NoError(err, "Error reading test image")
+	imagePath := filepath.Join(suite.T().TempDir(), "image.dmg")
+	suite.Require().NoError(os.WriteFile(imagePath, image, 0o600), "Error copying test image")
+	err = loop.SetFile(device, imagePath)
 	suite.Require().NoError(err, "Error setting loop device file")
 	mountPath := "/mnt/test1"
 	root := "/"
@@ -343,6 +352,15 @@ func (suite *VolumeServiceTestSuite) TestMountUnmountVolume_Success() {
 }
 
 /*
+func (suite *VolumeServiceTestSuite) TestUnmountVolume_RefusedWhilePoolMounted() {
+	mock.When(suite.poolService.MountedPoolOf(mock.Exact("/mnt/member"))).ThenReturn("media", true)
+
+	err := suite.volumeService.UnmountVolume("/mnt/member", false)
+	suite.Require().Error(err)
+	suite.ErrorIs(err, dto.ErrorInvalidStateForOperation)
+	suite.Contains(err.Details()["Detail"], "mounted pool media")
+}
+
 func (suite *VolumeServiceTestSuite) TestMountVolume_RepoFindByPathError() {
 	mountPath := "/mnt/test1"
 	mountData := dto.MountPointData{Path: mountPath, DeviceId: "sda1"}
@@ -139,7 +139,11 @@ func TestHandlePartitionUdevRemoveEvent_LoopbackExt4EvictsCache(t *testing.T) {
 		t.Skipf("no loop device available: %v", err)
 	}
 
-	imagePath := filepath.Clean("../../test/data/image.dmg")
+	// Mounting writes to the image: work on a copy of the fixture.
+	image, err := os.ReadFile("../../test/data/image.dmg")
+	require.NoError(t, err)
+	imagePath := filepath.Join(t.TempDir(), "image.dmg")
+	require.NoError(t, os.WriteFile(imagePath, image, 0o600))
 	require.NoError(t, loop.SetFile(device, imagePath))
 	t.Cleanup(func() {
 		_ = loop.ClearFile(device)
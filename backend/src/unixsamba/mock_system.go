@@ -41,6 +41,7 @@ type MockSystem struct {
 	mu sync.RWMutex
 
 	users   map[string]*mockUserState
+	groups  map[string][]string
 	nextUID int
 
 	commandQueue      map[string][]mockCommandResponse
@@ -58,6 +59,7 @@ type queuedLookup struct {
 func NewMockSystem() *MockSystem {
 	return &MockSystem{
 		users:             make(map[string]*mockUserState),
+		groups:            make(map[string][]string),
 		nextUID:           1000,
 		commandQueue:      make(map[string][]mockCommandResponse),
 		commandInputQueue: make(map[string][]mockCommandResponse),
@@ -178,6 +180,14 @@ func (m *MockSystem) DeleteUser(username string) {
 	delete(m.users, username)
 }
 
+// GroupMembers returns the members of a mock unix group and whether it exists.
+func (m *MockSystem) GroupMembers(name string) ([]string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	members, ok := m.groups[name]
+	return slices.Clone(members), ok
+}
+
 // SetSambaAccountFlags updates Samba account flags for an existing user.
 func (m *MockSystem) SetSambaAccountFlags(username, flags string) {
 	m.mu.Lock()
@@ -357,6 +367,43 @@ func (m *MockSystem) RunCommand(ctx context.Context, command string, args ...str
 		}
 
 		return "", m.commandError(command, "unsupported usermod args")
+
+	case "groupadd":
+		if len(args) == 0 {
+			return "", m.commandError(command, "missing group name")
+		}
+		name := args[len(args)-1]
+		if _, exists := m.groups[name]; exists {
+			return "", m.commandError(command, "groupadd: group '"+name+"' already exists")
+		}
+		m.groups[name] = []string{}
+		return "", nil
+
+	case "groupdel":
+		if len(args) == 0 {
+			return "", m.commandError(command, "missing group name")
+		}
+		name := args[len(args)-1]
+		if _, exists := m.groups[name]; !exists {
+			return "", m.commandError(command, "groupdel: group '"+name+"' does not exist")
+		}
+		delete(m.groups, name)
+		return "", nil
+
+	case "gpasswd":
+		if len(args) == 3 && args[0] == "-M" {
+			name := args[2]
+			if _, exists := m.groups[name]; !exists {
+				return "", m.commandError(command, "gpasswd: group '"+name+"' does not exist")
+			}
+			members := []string{}
+			if args[1] != "" {
+				members = strings.Split(args[1], ",")
+			}
+			m.groups[name] = members
+			return "", nil
+		}
+		return "", m.commandError(command, "unsupported gpasswd args")
 	default:
 		return "", m.commandError(command, "unsupported command")
 	}
@@ -69,6 +69,9 @@ var allowedUnixSambaCommands = map[string]any{
 	"deluser":   nil,
 	"usermod":   nil,
 	"smbd":      nil,
+	"groupadd":  nil,
+	"groupdel":  nil,
+	"gpasswd":   nil,
 }
 
 func validateUnixSambaCommand(command string, args ...string) error {
@@ -688,6 +691,54 @@ func isSmbDisabledHash(hash string) bool {
 	return true
 }
 
+// CreateUnixGroup creates a unix group so that Samba can resolve `@name`
+// principals. An already existing group is not an error.
+func CreateUnixGroup(ctx context.Context, name string) errors.E {
+	_, err := cmdExec.RunCommand(ctx, "groupadd", name)
+	if err != nil {
+		if e, ok := errors.AsType[errors.E](err); ok {
+			if stderr, ok := e.Details()["stderr"].(string); ok && strings.Contains(strings.ToLower(stderr), "already exists") {
+				return nil
+			}
+		}
+		return errors.WithMessagef(err, "failed to create unix group '%s'", name)
+	}
+	tlog.DebugContext(ctx, "Group created successfully", "group", name)
+	return nil
+}
+
+// DeleteUnixGroup removes a unix group. A missing group is not an error.
+func DeleteUnixGroup(ctx context.Context, name string) errors.E {
+	_, err := cmdExec.RunCommand(ctx, "groupdel", name)
+	if err != nil {
+		if e, ok := errors.AsType[errors.E](err); ok {
+			if stderr, ok := e.Details()["stderr"].(string); ok && strings.Contains(strings.ToLower(stderr), "does not exist") {
+				return nil
+			}
+		}
+		return errors.WithMessagef(err, "failed to delete unix group '%s'", name)
+	}
+	tlog.DebugContext(ctx, "Group deleted successfully", "group", name)
+	return nil
+}
+
+// SetUnixGroupMembers replaces the member list of a unix group. Usernames are
+// normalized the same way CreateSambaUser does.
+func SetUnixGroupMembers(ctx context.Context, name string, members []string) errors.E {
+	normalized := make([]string, 0, len(members))
+	for _, member := range members {
+		if n := NormalizeUsernameForUnixSamba(member); n != "" {
+			normalized = append(normalized, n)
+		}
+	}
+	_, err := cmdExec.RunCommand(ctx, "gpasswd", "-M", strings.Join(normalized, ","), name)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to set members of unix group '%s'", name)
+	}
+	tlog.DebugContext(ctx, "Group members updated", "group", name, "members", normalized)
+	return nil
+}
+
 // ListSambaUsers retrieves a list of all usernames known to Samba.
 // This function requires privileges to run `pdbedit -L`.
 func ListSambaUsers(ctx context.Context) ([]string, error) {
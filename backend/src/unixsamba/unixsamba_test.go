@@ -505,3 +505,30 @@ func (s *UnixSambaTestSuite) TestCheckSambaUser_NTHashParseError() {
 	s.Require().Error(err)
 	s.Contains(err.Error(), "failed to parse samba password hash")
 }
+
+// --- Unix group Tests ---
+
+func (s *UnixSambaTestSuite) TestCreateUnixGroup_AlreadyExists() {
+	s.enqueueCmd("groupadd", []string{"family"}, "", s.cmdErr("groupadd: group 'family' already exists"))
+
+	err := unixsamba.CreateUnixGroup(s.T().Context(), "family")
+	s.Require().NoError(err)
+}
+
+func (s *UnixSambaTestSuite) TestDeleteUnixGroup_Missing() {
+	err := unixsamba.DeleteUnixGroup(s.T().Context(), "nosuchgroup")
+	s.Require().NoError(err)
+	s.True(s.hasCall(false, "groupdel", "nosuchgroup"))
+}
+
+func (s *UnixSambaTestSuite) TestSetUnixGroupMembers_NormalizesUsernames() {
+	s.Require().NoError(unixsamba.CreateUnixGroup(s.T().Context(), "family"))
+
+	err := unixsamba.SetUnixGroupMembers(s.T().Context(), "family", []string{"alice", " bob "})
+	s.Require().NoError(err)
+
+	s.True(s.hasCall(false, "gpasswd", "-M", "alice,bob", "family"))
+	members, ok := s.mockSystem.GroupMembers("family")
+	s.Require().True(ok)
+	s.Equal([]string{"alice", "bob"}, members)
+}